@@ -86,6 +86,13 @@ type sparseEntry struct {
 	numBytes int64 // Length of the fragment
 }
 
+// A SparseEntry is a data fragment of a sparse file, as returned by
+// Reader.SparseEntries. Regions of the file not covered by a fragment are holes.
+type SparseEntry struct {
+	Offset int64 // Starting position of the fragment
+	Length int64 // Length of the fragment
+}
+
 // Keywords for GNU sparse files in a PAX extended header
 const (
 	paxGNUSparseNumBlocks = "GNU.sparse.numblocks"
@@ -195,6 +202,43 @@ loop:
 	return hdr, nil
 }
 
+// SparseEntries returns the data fragments of the current file that have not
+// yet been read if it is a sparse file, or nil if it is not. Reading from the
+// Reader still returns the expanded file contents, with holes read as zeros,
+// so a caller can read just the fragments by skipping the holes between them
+// with SkipHole.
+func (tr *Reader) SparseEntries() []SparseEntry {
+	sfr, ok := tr.curr.(*sparseFileReader)
+	if !ok {
+		return nil
+	}
+	sp := make([]SparseEntry, 0, len(sfr.sp))
+	for _, s := range sfr.sp {
+		e := SparseEntry{Offset: s.offset, Length: s.numBytes}
+		if sfr.pos > e.Offset {
+			// The fragment has been partially read.
+			e.Length -= sfr.pos - e.Offset
+			e.Offset = sfr.pos
+		}
+		if e.Length > 0 {
+			sp = append(sp, e)
+		}
+	}
+	return sp
+}
+
+// SkipHole advances past the sparse hole at the current position of the
+// current file without reading its zeros, and returns the number of bytes
+// skipped. It returns 0 if the current file is not sparse or the current
+// position is not in a hole.
+func (tr *Reader) SkipHole() int64 {
+	sfr, ok := tr.curr.(*sparseFileReader)
+	if !ok {
+		return 0
+	}
+	return sfr.skipHole()
+}
+
 // checkForGNUSparsePAXHeaders checks the PAX headers for GNU sparse headers. If they are found, then
 // this function reads the sparse map and returns it. Unknown sparse formats are ignored, causing the file to
 // be treated as a regular file.
@@ -231,13 +275,13 @@ func (tr *Reader) checkForGNUSparsePAXHeaders(hdr *Header, headers map[string]st
 		hdr.Name = sparseName
 	}
 	if sparseSizeOk {
-		realSize, err := strconv.ParseInt(sparseSize, 10, 0)
+		realSize, err := strconv.ParseInt(sparseSize, 10, 64)
 		if err != nil {
 			return nil, ErrHeader
 		}
 		hdr.Size = realSize
 	} else if sparseRealSizeOk {
-		realSize, err := strconv.ParseInt(sparseRealSize, 10, 0)
+		realSize, err := strconv.ParseInt(sparseRealSize, 10, 64)
 		if err != nil {
 			return nil, ErrHeader
 		}
@@ -309,7 +353,7 @@ func mergePAX(hdr *Header, headers map[string]string) error {
 			}
 			hdr.CreationTime = t
 		case paxSize:
-			size, err := strconv.ParseInt(v, 10, 0)
+			size, err := strconv.ParseInt(v, 10, 64)
 			if err != nil {
 				return err
 			}
@@ -939,11 +983,28 @@ func (sfr *sparseFileReader) readHole(b []byte, endOffset int64) int {
 	if n64 > int64(len(b)) {
 		n64 = int64(len(b))
 	}
-	n := int(n64)
-	for i := 0; i < n; i++ {
+	b = b[:n64]
+	for i := range b {
 		b[i] = 0
 	}
 	sfr.pos += n64
+	return len(b)
+}
+
+// skipHole skips the sparse hole, if any, at the current position.
+func (sfr *sparseFileReader) skipHole() int64 {
+	for len(sfr.sp) > 0 && sfr.sp[0].numBytes == 0 {
+		sfr.sp = sfr.sp[1:]
+	}
+	endOffset := sfr.total
+	if len(sfr.sp) > 0 {
+		endOffset = sfr.sp[0].offset
+	}
+	if sfr.pos >= endOffset {
+		return 0
+	}
+	n := endOffset - sfr.pos
+	sfr.pos = endOffset
 	return n
 }
 
@@ -668,6 +668,127 @@ func TestSparseFileReader(t *testing.T) {
 	}
 }
 
+func TestSparseEntries(t *testing.T) {
+	f, err := os.Open("testdata/sparse-formats.tar")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer f.Close()
+
+	tr := NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		sp := tr.SparseEntries()
+		if !strings.HasPrefix(hdr.Name, "sparse-") {
+			if sp != nil {
+				t.Errorf("%s: unexpected sparse map %v", hdr.Name, sp)
+			}
+			continue
+		}
+		if len(sp) == 0 {
+			t.Errorf("%s: missing sparse map", hdr.Name)
+			continue
+		}
+
+		// Reading the fragments and skipping the holes must match the
+		// expanded file contents.
+		expanded := make([]byte, hdr.Size)
+		var pos int64
+		for _, s := range sp {
+			if n := tr.SkipHole(); n != s.Offset-pos {
+				t.Fatalf("%s: skipped %d bytes, want %d", hdr.Name, n, s.Offset-pos)
+			}
+			if _, err := io.ReadFull(tr, expanded[s.Offset:s.Offset+s.Length]); err != nil {
+				t.Fatalf("%s: unexpected error: %v", hdr.Name, err)
+			}
+			pos = s.Offset + s.Length
+		}
+		if strings.Count(string(expanded), "\x00") == len(expanded) {
+			t.Errorf("%s: no data read from sparse map %v", hdr.Name, sp)
+		}
+	}
+}
+
+func TestLargeSparseFile(t *testing.T) {
+	// A PAX 1.0 sparse file with a real size beyond the 8GB limit of the
+	// octal size field, holding one fragment near its end.
+	const realSize = 1<<33 + 1024
+	sparseMap := "1\n" + fmt.Sprint(realSize-512) + "\n5\n"
+	data := sparseMap + strings.Repeat("\x00", blockSize-len(sparseMap)) + "hello"
+	hdr := &Header{Name: "GNUSparseFile.0/large", Typeflag: TypeReg, Size: int64(len(data))}
+	var b bytes.Buffer
+	tw := NewWriter(&b)
+	err := tw.writePAXHeader(hdr, map[string]string{
+		paxGNUSparseMajor:    "1",
+		paxGNUSparseMinor:    "0",
+		paxGNUSparseName:     "large",
+		paxGNUSparseRealSize: fmt.Sprint(realSize),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := tw.writeHeader(hdr, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := io.WriteString(tw, data); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tr := NewReader(&b)
+	hdr, err = tr.Next()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if hdr.Name != "large" || hdr.Size != realSize {
+		t.Fatalf("incorrect header: got %s with size %d", hdr.Name, hdr.Size)
+	}
+	sp := tr.SparseEntries()
+	if want := []SparseEntry{{Offset: realSize - 512, Length: 5}}; !reflect.DeepEqual(sp, want) {
+		t.Fatalf("incorrect sparse map: got %v, want %v", sp, want)
+	}
+	if n := tr.SkipHole(); n != realSize-512 {
+		t.Fatalf("incorrect hole size: got %d, want %d", n, realSize-512)
+	}
+	got := make([]byte, 5)
+	if _, err := io.ReadFull(tr, got); err != nil || string(got) != "hello" {
+		t.Fatalf("incorrect fragment: got %q, %v", got, err)
+	}
+	if n := tr.SkipHole(); n != 507 {
+		t.Fatalf("incorrect trailing hole size: got %d, want 507", n)
+	}
+	if n, err := tr.Read(got); n != 0 || err != io.EOF {
+		t.Fatalf("unexpected read at end: got %d, %v", n, err)
+	}
+	if _, err := tr.Next(); err != io.EOF {
+		t.Fatalf("unexpected error: got %v, want %v", err, io.EOF)
+	}
+}
+
+func TestLargePAXSize(t *testing.T) {
+	const size = 1<<33 + 1
+	var b bytes.Buffer
+	tw := NewWriter(&b)
+	if err := tw.WriteHeader(&Header{Name: "large", Typeflag: TypeReg, Size: size}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	hdr, err := NewReader(&b).Next()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if hdr.Size != size {
+		t.Fatalf("incorrect size: got %d, want %d", hdr.Size, size)
+	}
+}
+
 func TestReadGNUSparseMap0x1(t *testing.T) {
 	const (
 		maxUint = ^uint(0)
@@ -8,12 +8,14 @@ import (
 	"io/ioutil"
 	"os"
 	"runtime"
+	"sync"
 	"syscall"
 	"unicode/utf16"
 )
 
 //sys backupRead(h syscall.Handle, b []byte, bytesRead *uint32, abort bool, processSecurity bool, context *uintptr) (err error) = BackupRead
 //sys backupWrite(h syscall.Handle, b []byte, bytesWritten *uint32, abort bool, processSecurity bool, context *uintptr) (err error) = BackupWrite
+//sys backupSeek(h syscall.Handle, lowBytesToSeek uint32, highBytesToSeek uint32, lowBytesSeeked *uint32, highBytesSeeked *uint32, context *uintptr) (err error) = BackupSeek
 
 const (
 	BackupData = uint32(iota + 1)
@@ -59,18 +61,19 @@ type win32StreamId struct {
 type BackupStreamReader struct {
 	r         io.Reader
 	bytesLeft int64
+	hdr       *BackupHeader
 }
 
 // NewBackupStreamReader produces a BackupStreamReader from any io.Reader.
 func NewBackupStreamReader(r io.Reader) *BackupStreamReader {
-	return &BackupStreamReader{r, 0}
+	return &BackupStreamReader{r, 0, nil}
 }
 
 // Next returns the next backup stream and prepares for calls to Write(). It skips the remainder of the current stream if
 // it was not completely read.
 func (r *BackupStreamReader) Next() (*BackupHeader, error) {
 	if r.bytesLeft > 0 {
-		if _, err := io.Copy(ioutil.Discard, r); err != nil {
+		if _, err := r.Skip(r.bytesLeft); err != nil {
 			return nil, err
 		}
 	}
@@ -91,12 +94,21 @@ func (r *BackupStreamReader) Next() (*BackupHeader, error) {
 		hdr.Name = syscall.UTF16ToString(name)
 	}
 	if wsi.StreamId == BackupSparseBlock {
+		// The stream data of a sparse block begins with the int64 offset of the block
+		// within the file; this is not part of the block's data.
+		if hdr.Size < 8 {
+			return nil, fmt.Errorf("invalid sparse block size %d", hdr.Size)
+		}
 		if err := binary.Read(r.r, binary.LittleEndian, &hdr.Offset); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
 			return nil, err
 		}
 		hdr.Size -= 8
 	}
 	r.bytesLeft = hdr.Size
+	r.hdr = hdr
 	return hdr, nil
 }
 
@@ -118,6 +130,56 @@ func (r *BackupStreamReader) Read(b []byte) (int, error) {
 	return n, err
 }
 
+// Skip skips over the next n bytes of the current stream, or over the rest of the stream
+// if fewer than n bytes remain, and returns the number of bytes skipped. If the stream is
+// being read from a BackupFileReader, the data is skipped with BackupSeek rather than
+// read and discarded.
+func (r *BackupStreamReader) Skip(n int64) (int64, error) {
+	if n > r.bytesLeft {
+		n = r.bytesLeft
+	}
+	if n <= 0 {
+		return 0, nil
+	}
+	var (
+		skipped int64
+		err     error
+	)
+	if fr, ok := r.r.(*BackupFileReader); ok {
+		skipped, err = fr.seek(n)
+	} else {
+		skipped, err = io.CopyN(ioutil.Discard, r.r, n)
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+	}
+	r.bytesLeft -= skipped
+	return skipped, err
+}
+
+// DataSection returns a reader for random access to the contents of the current stream,
+// which must be the unnamed data stream of a file read with a BackupFileReader. The
+// returned reader reads the file directly rather than through the backup stream, so it
+// can be used to inspect the file (for example, to sniff its format from the first few
+// bytes) without consuming the stream. It remains valid until the BackupFileReader is
+// closed and may be used concurrently with reads from the stream.
+func (r *BackupStreamReader) DataSection() (*io.SectionReader, error) {
+	if r.hdr == nil || r.hdr.Id != BackupData {
+		return nil, errors.New("current stream is not the unnamed data stream")
+	}
+	fr, ok := r.r.(*BackupFileReader)
+	if !ok {
+		return nil, errors.New("backup stream is not being read from a file")
+	}
+	// For sparse files the size of the data stream does not reflect the file size, so
+	// use the size of the file itself.
+	fi, err := fr.f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return io.NewSectionReader(backupFileReaderAt{fr}, 0, fi.Size()), nil
+}
+
 // BackupStreamWriter writes a stream compatible with the BackupWrite Win32 API.
 type BackupStreamWriter struct {
 	w         io.Writer
@@ -134,6 +196,12 @@ func (w *BackupStreamWriter) WriteHeader(hdr *BackupHeader) error {
 	if w.bytesLeft != 0 {
 		return fmt.Errorf("missing %d bytes", w.bytesLeft)
 	}
+	if hdr.Size < 0 {
+		return fmt.Errorf("invalid stream size %d", hdr.Size)
+	}
+	if hdr.Id == BackupSparseBlock && hdr.Offset < 0 {
+		return fmt.Errorf("invalid sparse block offset %d", hdr.Offset)
+	}
 	name := utf16.Encode([]rune(hdr.Name))
 	wsi := win32StreamId{
 		StreamId:   hdr.Id,
@@ -172,78 +240,231 @@ func (w *BackupStreamWriter) Write(b []byte) (int, error) {
 	return n, err
 }
 
-// BackupFileReader provides an io.ReadCloser interface on top of the BackupRead Win32 API.
-type BackupFileReader struct {
+// BackupContext holds the state of a sequence of BackupRead and BackupSeek calls, or of
+// BackupWrite calls, on a file. Each call continues where the previous one left off,
+// until Abort releases the context; the next call then starts over at the beginning
+// of the file's backup stream.
+//
+// BackupFileReader and BackupFileWriter are built on BackupContext. Use it directly to
+// interleave backup operations with other work on the file, to track progress, or to
+// abandon a backup or restore part way through. A BackupContext is not safe for
+// concurrent use.
+type BackupContext struct {
 	f               *os.File
+	write           bool
 	includeSecurity bool
 	ctx             uintptr
+	transferred     int64
+}
+
+// NewBackupReadContext returns a BackupContext for reading the backup stream of f with
+// BackupRead. If includeSecurity is true, the stream includes the security descriptor
+// of the file.
+func NewBackupReadContext(f *os.File, includeSecurity bool) *BackupContext {
+	return newBackupContext(f, false, includeSecurity)
+}
+
+// NewBackupWriteContext returns a BackupContext for restoring f from a backup stream with
+// BackupWrite. If includeSecurity is true, the security descriptor of the file is
+// restored from the stream.
+func NewBackupWriteContext(f *os.File, includeSecurity bool) *BackupContext {
+	return newBackupContext(f, true, includeSecurity)
+}
+
+func newBackupContext(f *os.File, write bool, includeSecurity bool) *BackupContext {
+	c := &BackupContext{f: f, write: write, includeSecurity: includeSecurity}
+	runtime.SetFinalizer(c, func(c *BackupContext) { c.Abort() })
+	return c
+}
+
+// Read reads the next part of the backup stream with BackupRead. Unlike an io.Reader, it
+// returns 0, nil once the stream has been read completely.
+func (c *BackupContext) Read(b []byte) (int, error) {
+	if c.write {
+		return 0, errors.New("BackupRead on a BackupWrite context")
+	}
+	var bytesRead uint32
+	err := backupRead(syscall.Handle(c.f.Fd()), b, &bytesRead, false, c.includeSecurity, &c.ctx)
+	c.transferred += int64(bytesRead)
+	if err != nil {
+		return int(bytesRead), &os.PathError{Op: "BackupRead", Path: c.f.Name(), Err: err}
+	}
+	return int(bytesRead), nil
+}
+
+// Skip skips up to n bytes of the data of the current stream with BackupSeek and returns
+// the number of bytes skipped. It does not skip past the end of the current stream.
+func (c *BackupContext) Skip(n int64) (int64, error) {
+	if c.write {
+		return 0, errors.New("BackupSeek on a BackupWrite context")
+	}
+	var low, high uint32
+	err := backupSeek(syscall.Handle(c.f.Fd()), uint32(n), uint32(n>>32), &low, &high, &c.ctx)
+	seeked := int64(high)<<32 | int64(low)
+	c.transferred += seeked
+	if err != nil && seeked < n {
+		return seeked, &os.PathError{Op: "BackupSeek", Path: c.f.Name(), Err: err}
+	}
+	return seeked, nil
+}
+
+// Write restores the next part of the file from its backup stream with BackupWrite.
+func (c *BackupContext) Write(b []byte) (int, error) {
+	if !c.write {
+		return 0, errors.New("BackupWrite on a BackupRead context")
+	}
+	var bytesWritten uint32
+	err := backupWrite(syscall.Handle(c.f.Fd()), b, &bytesWritten, false, c.includeSecurity, &c.ctx)
+	c.transferred += int64(bytesWritten)
+	if err != nil {
+		return int(bytesWritten), &os.PathError{Op: "BackupWrite", Path: c.f.Name(), Err: err}
+	}
+	return int(bytesWritten), nil
+}
+
+// BytesTransferred returns the number of bytes of the backup stream that have been read,
+// skipped, or written since the context was created or last aborted.
+func (c *BackupContext) BytesTransferred() int64 {
+	return c.transferred
+}
+
+// Abort releases the Win32 context of the backup operation. Any data already written
+// remains in the file. The context can be used again afterwards, starting over at the
+// beginning of the backup stream. It does not close the underlying file.
+func (c *BackupContext) Abort() error {
+	c.transferred = 0
+	if c.ctx == 0 {
+		return nil
+	}
+	var err error
+	op := "BackupRead"
+	if c.write {
+		op = "BackupWrite"
+		err = backupWrite(syscall.Handle(c.f.Fd()), nil, nil, true, false, &c.ctx)
+	} else {
+		err = backupRead(syscall.Handle(c.f.Fd()), nil, nil, true, false, &c.ctx)
+	}
+	c.ctx = 0
+	if err != nil {
+		return &os.PathError{Op: op, Path: c.f.Name(), Err: err}
+	}
+	return nil
+}
+
+// BackupFileReader provides an io.ReadCloser interface on top of the BackupRead Win32 API.
+type BackupFileReader struct {
+	f   *os.File
+	ctx *BackupContext
+	// lock serializes BackupRead with positional reads of the file, since the latter
+	// temporarily move the file pointer.
+	lock sync.Mutex
 }
 
 // NewBackupFileReader returns a new BackupFileReader from a file handle. If includeSecurity is true,
 // Read will attempt to read the security descriptor of the file.
 func NewBackupFileReader(f *os.File, includeSecurity bool) *BackupFileReader {
-	r := &BackupFileReader{f, includeSecurity, 0}
+	r := &BackupFileReader{f: f, ctx: NewBackupReadContext(f, includeSecurity)}
 	runtime.SetFinalizer(r, func(r *BackupFileReader) { r.Close() })
 	return r
 }
 
+// Context returns the BackupContext used by the reader.
+func (r *BackupFileReader) Context() *BackupContext {
+	return r.ctx
+}
+
 // Read reads a backup stream from the file by calling the Win32 API BackupRead().
 func (r *BackupFileReader) Read(b []byte) (int, error) {
-	var bytesRead uint32
-	err := backupRead(syscall.Handle(r.f.Fd()), b, &bytesRead, false, r.includeSecurity, &r.ctx)
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	n, err := r.ctx.Read(b)
 	if err != nil {
-		return 0, &os.PathError{"BackupRead", r.f.Name(), err}
+		return 0, err
 	}
-	if bytesRead == 0 {
+	if n == 0 {
 		return 0, io.EOF
 	}
-	return int(bytesRead), nil
+	return n, nil
+}
+
+// seek skips n bytes of the current stream using BackupSeek.
+func (r *BackupFileReader) seek(n int64) (int64, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.ctx.Skip(n)
 }
 
 // Close frees Win32 resources associated with the BackupFileReader. It does not close
 // the underlying file.
 func (r *BackupFileReader) Close() error {
-	if r.ctx != 0 {
-		backupRead(syscall.Handle(r.f.Fd()), nil, nil, true, false, &r.ctx)
-		r.ctx = 0
-	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.ctx.Abort()
 	return nil
 }
 
+// backupFileReaderAt reads the file underlying a BackupFileReader at arbitrary offsets.
+type backupFileReaderAt struct {
+	r *BackupFileReader
+}
+
+func (ra backupFileReaderAt) ReadAt(b []byte, off int64) (int, error) {
+	ra.r.lock.Lock()
+	defer ra.r.lock.Unlock()
+	return ra.r.f.ReadAt(b, off)
+}
+
 // BackupFileWriter provides an io.WriteCloser interface on top of the BackupWrite Win32 API.
 type BackupFileWriter struct {
-	f               *os.File
-	includeSecurity bool
-	ctx             uintptr
+	f         *os.File
+	ctx       *BackupContext
+	basicInfo *FileBasicInfo
 }
 
 // NewBackupFileWrtier returns a new BackupFileWriter from a file handle. If includeSecurity is true,
 // Write() will attempt to restore the security descriptor from the stream.
 func NewBackupFileWriter(f *os.File, includeSecurity bool) *BackupFileWriter {
-	w := &BackupFileWriter{f, includeSecurity, 0}
+	w := &BackupFileWriter{f, NewBackupWriteContext(f, includeSecurity), nil}
 	runtime.SetFinalizer(w, func(w *BackupFileWriter) { w.Close() })
 	return w
 }
 
+// Context returns the BackupContext used by the writer.
+func (w *BackupFileWriter) Context() *BackupContext {
+	return w.ctx
+}
+
 // Write restores a portion of the file using the provided backup stream.
 func (w *BackupFileWriter) Write(b []byte) (int, error) {
-	var bytesWritten uint32
-	err := backupWrite(syscall.Handle(w.f.Fd()), b, &bytesWritten, false, w.includeSecurity, &w.ctx)
+	n, err := w.ctx.Write(b)
 	if err != nil {
-		return 0, &os.PathError{"BackupWrite", w.f.Name(), err}
+		return 0, err
 	}
-	if int(bytesWritten) != len(b) {
-		return int(bytesWritten), errors.New("not all bytes could be written")
+	if n != len(b) {
+		return n, errors.New("not all bytes could be written")
 	}
 	return len(b), nil
 }
 
+// SetBasicInfoOnClose arranges for Close to set the file's times and attributes to bi
+// after the backup stream has been fully written. Pass nil to disable this.
+//
+// Setting the times explicitly at the end of the restore defeats NTFS file name tunneling,
+// which otherwise gives a file recreated shortly after a file of the same name was deleted
+// the creation time of the deleted file. It also prevents the writes performed by
+// BackupWrite from overwriting the restored last write time.
+func (w *BackupFileWriter) SetBasicInfoOnClose(bi *FileBasicInfo) {
+	w.basicInfo = bi
+}
+
 // Close frees Win32 resources associated with the BackupFileWriter. It does not
 // close the underlying file.
 func (w *BackupFileWriter) Close() error {
-	if w.ctx != 0 {
-		backupWrite(syscall.Handle(w.f.Fd()), nil, nil, true, false, &w.ctx)
-		w.ctx = 0
+	w.ctx.Abort()
+	if w.basicInfo != nil {
+		bi := w.basicInfo
+		w.basicInfo = nil
+		return SetFileBasicInfo(w.f, bi)
 	}
 	return nil
 }
@@ -264,3 +485,27 @@ func OpenForBackup(path string, access uint32, share uint32, createmode uint32)
 	}
 	return os.NewFile(uintptr(h), path), nil
 }
+
+// OpenFileForBackup opens a file or directory like OpenForBackup, but for overlapped IO
+// like OpenFile.
+func OpenFileForBackup(path string, access uint32, share uint32, createmode uint32) (io.ReadWriteCloser, error) {
+	return OpenFile(path, access, share, createmode, &FileConfig{BackupSemantics: true})
+}
+
+// OpenFileForBackupWithPrivileges opens a file or directory like OpenFileForBackup with
+// SeBackupPrivilege and SeRestorePrivilege enabled, so that the open is not subject to
+// access checks. The privileges are only enabled on the calling thread while the file
+// is opened; the file keeps the access it was granted. Both privileges must be held by
+// the process token.
+func OpenFileForBackupWithPrivileges(path string, access uint32, share uint32, createmode uint32) (io.ReadWriteCloser, error) {
+	var f io.ReadWriteCloser
+	err := RunWithPrivileges([]string{SeBackupPrivilege, SeRestorePrivilege}, func() error {
+		var err error
+		f, err = OpenFileForBackup(path, access, share, createmode)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
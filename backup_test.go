@@ -1,13 +1,21 @@
 package winio
 
 import (
+	"bytes"
+	"encoding/binary"
 	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"syscall"
 	"testing"
+	"time"
+
+	"golang.org/x/sys/windows"
 )
 
+const cFILE_ATTRIBUTE_SPARSE_FILE = 0x200
+
 var testFileName string
 
 func TestMain(m *testing.M) {
@@ -68,6 +76,86 @@ func TestBackupRead(t *testing.T) {
 	}
 }
 
+func TestInspectBackupStream(t *testing.T) {
+	err := makeTestFile(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(testFileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r := NewBackupFileReader(f, true)
+	defer r.Close()
+	summaries, err := InspectBackupStream(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	types := make(map[string]*BackupStreamSummary)
+	for i := range summaries {
+		types[summaries[i].Type] = &summaries[i]
+	}
+	if s := types["data"]; s == nil || s.Size != 14 {
+		t.Fatalf("missing data stream in %+v", summaries)
+	}
+	if s := types["alternateData"]; s == nil || s.Name != ":ads.txt:$DATA" {
+		t.Fatalf("missing alternate data stream in %+v", summaries)
+	}
+	if s := types["security"]; s == nil || s.Owner == "" || s.DACLACEs == nil || s.Error != "" {
+		t.Fatalf("missing security stream in %+v", summaries)
+	}
+}
+
+func TestBackupContextAbortRestarts(t *testing.T) {
+	err := makeTestFile(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(testFileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	c := NewBackupReadContext(f, false)
+	defer c.Abort()
+
+	readAll := func() []byte {
+		var all []byte
+		b := make([]byte, 7)
+		for {
+			n, err := c.Read(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n == 0 {
+				return all
+			}
+			all = append(all, b[:n]...)
+		}
+	}
+	first := readAll()
+	if c.BytesTransferred() != int64(len(first)) {
+		t.Fatalf("transferred %d bytes, read %d", c.BytesTransferred(), len(first))
+	}
+
+	// Abandon the backup part way through and start over.
+	c.Abort()
+	if _, err = c.Read(make([]byte, 10)); err != nil {
+		t.Fatal(err)
+	}
+	c.Abort()
+	if c.BytesTransferred() != 0 {
+		t.Fatal("Abort did not reset the byte count")
+	}
+	second := readAll()
+	if !bytes.Equal(first, second) {
+		t.Fatal("backup stream changed after Abort")
+	}
+}
+
 func TestBackupStreamRead(t *testing.T) {
 	err := makeTestFile(true)
 	if err != nil {
@@ -134,6 +222,112 @@ func TestBackupStreamRead(t *testing.T) {
 	}
 }
 
+func TestBackupStreamDataSection(t *testing.T) {
+	err := makeTestFile(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(testFileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r := NewBackupFileReader(f, false)
+	defer r.Close()
+
+	br := NewBackupStreamReader(r)
+	for {
+		hdr, err := br.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Id == BackupData {
+			break
+		}
+	}
+
+	sr, err := br.DataSection()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, 6)
+	_, err = sr.ReadAt(b, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "1 2 3\n" {
+		t.Fatalf("incorrect section data %q", b)
+	}
+
+	b, err = ioutil.ReadAll(br)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "testing 1 2 3\n" {
+		t.Fatalf("incorrect data %v", b)
+	}
+
+	_, err = br.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = br.DataSection(); err == nil {
+		t.Fatal("expected failure for alternate data stream")
+	}
+}
+
+func TestBackupStreamSkip(t *testing.T) {
+	err := makeTestFile(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(testFileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r := NewBackupFileReader(f, false)
+	defer r.Close()
+
+	br := NewBackupStreamReader(r)
+	hdr, err := br.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hdr.Id != BackupData {
+		t.Fatalf("unexpected stream ID %d", hdr.Id)
+	}
+	n, err := br.Skip(8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 8 {
+		t.Fatalf("skipped %d bytes, expected 8", n)
+	}
+	b, err := ioutil.ReadAll(br)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "1 2 3\n" {
+		t.Fatalf("incorrect data %q", b)
+	}
+
+	// Skip the whole alternate data stream via Next.
+	hdr, err = br.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hdr.Id != BackupAlternateData {
+		t.Fatalf("unexpected stream ID %d", hdr.Id)
+	}
+	_, err = br.Next()
+	if err != io.EOF {
+		t.Fatalf("expected EOF, got %v", err)
+	}
+}
+
 func TestBackupStreamWrite(t *testing.T) {
 	f, err := os.Create(testFileName)
 	if err != nil {
@@ -190,6 +384,89 @@ func TestBackupStreamWrite(t *testing.T) {
 	}
 }
 
+func writeTunneledFile(bi *FileBasicInfo) error {
+	os.Remove(testFileName)
+	f, err := os.Create(testFileName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := NewBackupFileWriter(f, false)
+	defer w.Close()
+	w.SetBasicInfoOnClose(bi)
+
+	data := "testing 1 2 3\n"
+	br := NewBackupStreamWriter(w)
+	err = br.WriteHeader(&BackupHeader{Id: BackupData, Size: int64(len(data))})
+	if err != nil {
+		return err
+	}
+	_, err = br.Write([]byte(data))
+	if err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+func getTestFileBasicInfo(t *testing.T) *FileBasicInfo {
+	f, err := os.Open(testFileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	bi, err := GetFileBasicInfo(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bi
+}
+
+func TestBackupWriteDefeatsTunneling(t *testing.T) {
+	// Create a file with an old creation time, so that a file recreated with the same
+	// name shortly after it is deleted picks up the old creation time via tunneling.
+	err := makeTestFile(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(testFileName, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := syscall.NsecToFiletime(time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC).UnixNano())
+	err = SetFileBasicInfo(f, &FileBasicInfo{CreationTime: old})
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Without explicit times, the recreated file gets the tunneled creation time.
+	if err = writeTunneledFile(nil); err != nil {
+		t.Fatal(err)
+	}
+	if bi := getTestFileBasicInfo(t); bi.CreationTime != old {
+		t.Fatalf("got creation time %d, expected the tunneled %d", bi.CreationTime.Nanoseconds(), old.Nanoseconds())
+	}
+
+	want := syscall.NsecToFiletime(time.Date(2010, 1, 1, 0, 0, 0, 0, time.UTC).UnixNano())
+	err = writeTunneledFile(&FileBasicInfo{
+		CreationTime:   want,
+		LastAccessTime: want,
+		LastWriteTime:  want,
+		ChangeTime:     want,
+		FileAttributes: syscall.FILE_ATTRIBUTE_NORMAL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bi := getTestFileBasicInfo(t)
+	if bi.CreationTime != want {
+		t.Fatalf("got creation time %d, expected %d", bi.CreationTime.Nanoseconds(), want.Nanoseconds())
+	}
+	if bi.LastWriteTime != want {
+		t.Fatalf("got last write time %d, expected %d", bi.LastWriteTime.Nanoseconds(), want.Nanoseconds())
+	}
+}
+
 func makeSparseFile() error {
 	os.Remove(testFileName)
 	f, err := os.Create(testFileName)
@@ -253,3 +530,159 @@ func TestBackupSparseFile(t *testing.T) {
 		t.Log(hdr)
 	}
 }
+
+func TestBackupSparseBlockHeaderRoundTrip(t *testing.T) {
+	var b bytes.Buffer
+	bw := NewBackupStreamWriter(&b)
+	err := bw.WriteHeader(&BackupHeader{Id: BackupSparseBlock, Attributes: StreamSparseAttributes, Size: 4, Offset: 1000000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = bw.Write([]byte("data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	br := NewBackupStreamReader(&b)
+	hdr, err := br.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hdr.Id != BackupSparseBlock || hdr.Offset != 1000000 || hdr.Size != 4 {
+		t.Fatalf("unexpected header %+v", hdr)
+	}
+	data, err := ioutil.ReadAll(br)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "data" {
+		t.Fatalf("incorrect data %q", data)
+	}
+}
+
+func TestBackupSparseBlockTooSmall(t *testing.T) {
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, &win32StreamId{StreamId: BackupSparseBlock, Size: 4})
+	b.Write([]byte("data"))
+	_, err := NewBackupStreamReader(&b).Next()
+	if err == nil {
+		t.Fatal("expected failure for truncated sparse block")
+	}
+}
+
+func TestBackupSparseFileRoundTrip(t *testing.T) {
+	err := makeSparseFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := ioutil.ReadFile(testFileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(testFileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r := NewBackupFileReader(f, false)
+	defer r.Close()
+
+	restoredName := testFileName + ".restored"
+	g, err := os.Create(restoredName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(restoredName)
+	defer g.Close()
+	w := NewBackupFileWriter(g, false)
+	defer w.Close()
+
+	br := NewBackupStreamReader(r)
+	bw := NewBackupStreamWriter(w)
+	for {
+		hdr, err := br.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = bw.WriteHeader(hdr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = io.Copy(bw, br)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bi, err := GetFileBasicInfo(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bi.FileAttributes&cFILE_ATTRIBUTE_SPARSE_FILE == 0 {
+		t.Error("restored file is not sparse")
+	}
+	g.Close()
+
+	actual, err := ioutil.ReadFile(restoredName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(actual, expected) {
+		t.Fatal("restored file contents do not match")
+	}
+}
+
+func TestOpenFileForBackup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Directories can only be opened with backup semantics.
+	d, err := OpenFileForBackup(dir, syscall.GENERIC_READ, syscall.FILE_SHARE_READ|syscall.FILE_SHARE_WRITE, syscall.OPEN_EXISTING)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Close()
+
+	// A file with an empty DACL can only be read by bypassing the access check.
+	path := filepath.Join(dir, "file")
+	if err := ioutil.WriteFile(path, []byte("data"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	acl, err := windows.ACLFromEntries(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = windows.SetNamedSecurityInfo(path, windows.SE_FILE_OBJECT, windows.DACL_SECURITY_INFORMATION|windows.PROTECTED_DACL_SECURITY_INFORMATION, nil, nil, acl, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenFileForBackup(path, syscall.GENERIC_READ, syscall.FILE_SHARE_READ, syscall.OPEN_EXISTING); !os.IsPermission(err) {
+		t.Fatalf("expected access denied, got %v", err)
+	}
+	f, err := OpenFileForBackupWithPrivileges(path, syscall.GENERIC_READ, syscall.FILE_SHARE_READ, syscall.OPEN_EXISTING)
+	if _, ok := err.(*PrivilegeError); ok {
+		t.Skip("backup and restore privileges are not held")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	b, err := ioutil.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "data" {
+		t.Fatalf("unexpected data %q", b)
+	}
+}
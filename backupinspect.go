@@ -0,0 +1,139 @@
+package winio
+
+import (
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+
+	"github.com/Microsoft/go-winio/pkg/security"
+)
+
+// maxInspectedStreamSize is the largest security, EA, or reparse stream whose contents
+// InspectBackupStream decodes. Larger streams are reported as malformed.
+const maxInspectedStreamSize = 1024 * 1024
+
+var backupStreamTypes = map[uint32]string{
+	BackupData:          "data",
+	BackupEaData:        "ea",
+	BackupSecurity:      "security",
+	BackupAlternateData: "alternateData",
+	BackupLink:          "link",
+	BackupPropertyData:  "propertyData",
+	BackupObjectId:      "objectId",
+	BackupReparseData:   "reparseData",
+	BackupSparseBlock:   "sparseBlock",
+	BackupTxfsData:      "txfsData",
+}
+
+// BackupStreamSummary describes a stream in a backup stream, for diagnostics. It is
+// designed to be marshaled as JSON.
+type BackupStreamSummary struct {
+	// Type is the name of the stream type, such as data or security, or unknown.
+	Type       string `json:"type"`
+	ID         uint32 `json:"id"`
+	Name       string `json:"name,omitempty"`
+	Attributes uint32 `json:"attributes,omitempty"`
+	Size       int64  `json:"size"`
+	// Offset is the offset of a sparse block in the file.
+	Offset int64 `json:"offset,omitempty"`
+
+	// ReparseTag is the tag of the reparse point in a reparse data stream.
+	ReparseTag uint32 `json:"reparseTag,omitempty"`
+	// EACount is the number of extended attributes in an EA stream.
+	EACount int `json:"eaCount,omitempty"`
+	// Owner, Group, DACLACEs, and SACLACEs describe the security descriptor in a
+	// security stream. The ACE counts are nil if the descriptor has no DACL or SACL.
+	Owner    string `json:"owner,omitempty"`
+	Group    string `json:"group,omitempty"`
+	DACLACEs *int   `json:"daclAces,omitempty"`
+	SACLACEs *int   `json:"saclAces,omitempty"`
+
+	// Error describes why the contents of the stream could not be decoded.
+	Error string `json:"error,omitempty"`
+}
+
+// InspectBackupStream reads a backup stream, such as one produced by BackupRead, and
+// returns a summary of each of its streams. Streams whose contents are malformed are
+// reported with Error set; an error is only returned if the stream itself cannot be
+// read, in which case the summaries of the streams read so far are also returned.
+func InspectBackupStream(r io.Reader) ([]BackupStreamSummary, error) {
+	br := NewBackupStreamReader(r)
+	var summaries []BackupStreamSummary
+	for {
+		hdr, err := br.Next()
+		if err == io.EOF {
+			return summaries, nil
+		}
+		if err != nil {
+			return summaries, err
+		}
+		s := BackupStreamSummary{
+			Type:       backupStreamTypes[hdr.Id],
+			ID:         hdr.Id,
+			Name:       hdr.Name,
+			Attributes: hdr.Attributes,
+			Size:       hdr.Size,
+			Offset:     hdr.Offset,
+		}
+		if s.Type == "" {
+			s.Type = "unknown"
+		}
+		switch hdr.Id {
+		case BackupSecurity, BackupEaData, BackupReparseData:
+			if hdr.Size > maxInspectedStreamSize {
+				s.Error = "stream too large to decode"
+				_, err = io.Copy(ioutil.Discard, br)
+				break
+			}
+			var b []byte
+			b, err = ioutil.ReadAll(br)
+			if err == nil {
+				s.inspect(hdr.Id, b)
+			}
+		default:
+			_, err = io.Copy(ioutil.Discard, br)
+		}
+		if err != nil {
+			return summaries, err
+		}
+		summaries = append(summaries, s)
+	}
+}
+
+func (s *BackupStreamSummary) inspect(id uint32, b []byte) {
+	switch id {
+	case BackupSecurity:
+		sd, err := security.ParseSecurityDescriptor(b)
+		if err != nil {
+			s.Error = err.Error()
+			return
+		}
+		if sd.Owner != nil {
+			s.Owner = sd.Owner.String()
+		}
+		if sd.Group != nil {
+			s.Group = sd.Group.String()
+		}
+		if sd.DACL != nil {
+			n := len(sd.DACL.ACEs)
+			s.DACLACEs = &n
+		}
+		if sd.SACL != nil {
+			n := len(sd.SACL.ACEs)
+			s.SACLACEs = &n
+		}
+	case BackupEaData:
+		eas, err := DecodeExtendedAttributes(b)
+		if err != nil {
+			s.Error = err.Error()
+			return
+		}
+		s.EACount = len(eas)
+	case BackupReparseData:
+		if len(b) < 8 {
+			s.Error = "reparse data too short"
+			return
+		}
+		s.ReparseTag = binary.LittleEndian.Uint32(b)
+	}
+}
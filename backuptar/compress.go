@@ -0,0 +1,239 @@
+package backuptar
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+
+	"github.com/Microsoft/go-winio/archive/tar"
+)
+
+// Compression identifies the compression applied to an archive stream.
+type Compression int
+
+const (
+	// Uncompressed leaves the archive uncompressed.
+	Uncompressed Compression = iota
+	// Gzip compresses the archive with gzip.
+	Gzip
+)
+
+// StreamOptions configures NewCompressedWriter and NewCompressedReader.
+type StreamOptions struct {
+	// Compression selects a built-in compression format.
+	Compression Compression
+
+	// NewCompressor, if set, is used instead of Compression to create the compressing
+	// writer, so that other formats such as zstd can be used. Closing the writer must
+	// flush all compressed data to w.
+	NewCompressor func(w io.Writer) (io.WriteCloser, error)
+
+	// NewDecompressor, if set, is used instead of Compression to create the
+	// decompressing reader.
+	NewDecompressor func(r io.Reader) (io.ReadCloser, error)
+
+	// Progress, if set, is called after each write to or read from the archive with the
+	// number of uncompressed and compressed bytes processed so far. The compressed count
+	// lags behind while the compressor buffers data.
+	Progress func(uncompressed int64, compressed int64)
+}
+
+// StreamStats contains the sizes and SHA-256 digests of an archive stream before and
+// after compression. Digests are in the form sha256:<hex>.
+type StreamStats struct {
+	UncompressedSize   int64
+	UncompressedDigest string
+	CompressedSize     int64
+	CompressedDigest   string
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+	h hash.Hash
+}
+
+func (w *countingWriter) Write(b []byte) (int, error) {
+	n, err := w.w.Write(b)
+	w.n += int64(n)
+	w.h.Write(b[:n])
+	return n, err
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+	h hash.Hash
+}
+
+func (r *countingReader) Read(b []byte) (int, error) {
+	n, err := r.r.Read(b)
+	r.n += int64(n)
+	r.h.Write(b[:n])
+	return n, err
+}
+
+func digest(h hash.Hash) string {
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// CompressedWriter is a tar writer that compresses the archive and keeps track of its
+// size and digest, both before and after compression, in a single pass.
+type CompressedWriter struct {
+	*tar.Writer
+	compressed   *countingWriter
+	uncompressed *countingWriter
+	compressor   io.WriteCloser
+	progress     func(int64, int64)
+}
+
+// NewCompressedWriter returns a CompressedWriter that writes the compressed archive to w.
+func NewCompressedWriter(w io.Writer, opts *StreamOptions) (*CompressedWriter, error) {
+	if opts == nil {
+		opts = &StreamOptions{}
+	}
+	cw := &CompressedWriter{
+		compressed: &countingWriter{w: w, h: sha256.New()},
+		progress:   opts.Progress,
+	}
+	var err error
+	switch {
+	case opts.NewCompressor != nil:
+		cw.compressor, err = opts.NewCompressor(cw.compressed)
+	case opts.Compression == Uncompressed:
+		cw.compressor = nopWriteCloser{cw.compressed}
+	case opts.Compression == Gzip:
+		cw.compressor = gzip.NewWriter(cw.compressed)
+	default:
+		err = fmt.Errorf("unknown compression %d", opts.Compression)
+	}
+	if err != nil {
+		return nil, err
+	}
+	cw.uncompressed = &countingWriter{w: cw.compressor, h: sha256.New()}
+	cw.Writer = tar.NewWriter(progressWriter{cw})
+	return cw, nil
+}
+
+type progressWriter struct {
+	cw *CompressedWriter
+}
+
+func (w progressWriter) Write(b []byte) (int, error) {
+	n, err := w.cw.uncompressed.Write(b)
+	if w.cw.progress != nil {
+		w.cw.progress(w.cw.uncompressed.n, w.cw.compressed.n)
+	}
+	return n, err
+}
+
+// Close writes the tar trailer and flushes the compressor. It does not close the
+// underlying writer.
+func (w *CompressedWriter) Close() error {
+	err := w.Writer.Close()
+	if err != nil {
+		return err
+	}
+	err = w.compressor.Close()
+	if err != nil {
+		return err
+	}
+	if w.progress != nil {
+		w.progress(w.uncompressed.n, w.compressed.n)
+	}
+	return nil
+}
+
+// Stats returns the sizes and digests of the data written so far. They describe the
+// complete archive once Close has returned.
+func (w *CompressedWriter) Stats() StreamStats {
+	return StreamStats{
+		UncompressedSize:   w.uncompressed.n,
+		UncompressedDigest: digest(w.uncompressed.h),
+		CompressedSize:     w.compressed.n,
+		CompressedDigest:   digest(w.compressed.h),
+	}
+}
+
+// CompressedReader is a tar reader for a compressed archive that keeps track of its size
+// and digest, both before and after decompression.
+type CompressedReader struct {
+	*tar.Reader
+	compressed   *countingReader
+	uncompressed *countingReader
+	decompressor io.ReadCloser
+	progress     func(int64, int64)
+}
+
+// NewCompressedReader returns a CompressedReader that reads a compressed archive from r.
+func NewCompressedReader(r io.Reader, opts *StreamOptions) (*CompressedReader, error) {
+	if opts == nil {
+		opts = &StreamOptions{}
+	}
+	cr := &CompressedReader{
+		compressed: &countingReader{r: r, h: sha256.New()},
+		progress:   opts.Progress,
+	}
+	var err error
+	switch {
+	case opts.NewDecompressor != nil:
+		cr.decompressor, err = opts.NewDecompressor(cr.compressed)
+	case opts.Compression == Uncompressed:
+		cr.decompressor = ioutil.NopCloser(cr.compressed)
+	case opts.Compression == Gzip:
+		cr.decompressor, err = gzip.NewReader(cr.compressed)
+	default:
+		err = fmt.Errorf("unknown compression %d", opts.Compression)
+	}
+	if err != nil {
+		return nil, err
+	}
+	cr.uncompressed = &countingReader{r: cr.decompressor, h: sha256.New()}
+	cr.Reader = tar.NewReader(progressReader{cr})
+	return cr, nil
+}
+
+type progressReader struct {
+	cr *CompressedReader
+}
+
+func (r progressReader) Read(b []byte) (int, error) {
+	n, err := r.cr.uncompressed.Read(b)
+	if r.cr.progress != nil {
+		r.cr.progress(r.cr.uncompressed.n, r.cr.compressed.n)
+	}
+	return n, err
+}
+
+// Close reads and discards the rest of the stream, including any data after the tar
+// trailer, so that Stats describes the complete stream, and then closes the
+// decompressor. It does not close the underlying reader.
+func (r *CompressedReader) Close() error {
+	_, err := io.Copy(ioutil.Discard, progressReader{r})
+	if err != nil {
+		return err
+	}
+	return r.decompressor.Close()
+}
+
+// Stats returns the sizes and digests of the data read so far.
+func (r *CompressedReader) Stats() StreamStats {
+	return StreamStats{
+		UncompressedSize:   r.uncompressed.n,
+		UncompressedDigest: digest(r.uncompressed.h),
+		CompressedSize:     r.compressed.n,
+		CompressedDigest:   digest(r.compressed.h),
+	}
+}
@@ -0,0 +1,120 @@
+package backuptar
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/Microsoft/go-winio"
+	"github.com/Microsoft/go-winio/archive/tar"
+)
+
+// FileSummary describes a file in an archive written by WriteTarFileFromBackupStream,
+// for diagnostics. It is designed to be marshaled as JSON.
+type FileSummary struct {
+	Name string `json:"name"`
+	// Type is file, directory, hardlink, symlink, or the tar type flag of other
+	// entries.
+	Type       string                      `json:"type"`
+	Size       int64                       `json:"size"`
+	Attributes uint32                      `json:"attributes"`
+	Linkname   string                      `json:"linkname,omitempty"`
+	Streams    []winio.BackupStreamSummary `json:"streams,omitempty"`
+	// Error describes why the file's entries could not be read or converted to a
+	// backup stream.
+	Error string `json:"error,omitempty"`
+}
+
+func entryType(hdr *tar.Header) string {
+	switch hdr.Typeflag {
+	case tar.TypeReg, tar.TypeRegA:
+		return "file"
+	case tar.TypeDir:
+		return "directory"
+	case tar.TypeLink:
+		return "hardlink"
+	case tar.TypeSymlink:
+		return "symlink"
+	}
+	return string(hdr.Typeflag)
+}
+
+type inspectResult struct {
+	streams []winio.BackupStreamSummary
+	err     error
+}
+
+// InspectTar reads an archive written by WriteTarFileFromBackupStream, such as one
+// written by WriteTarFromDirectory, and returns a summary of each file and of the
+// streams of the backup stream that would be restored for it. If the archive cannot be
+// read, the summaries of the files read so far are returned along with the error, and
+// the last summary describes the file that failed.
+func InspectTar(t *tar.Reader) ([]FileSummary, error) {
+	var summaries []FileSummary
+	hdr, err := t.Next()
+	for err == nil {
+		name, size, fileInfo, ferr := FileInfoFromHeader(hdr)
+		s := FileSummary{
+			Name:     name,
+			Type:     entryType(hdr),
+			Size:     size,
+			Linkname: hdr.Linkname,
+		}
+		if ferr != nil {
+			s.Error = ferr.Error()
+			summaries = append(summaries, s)
+			hdr, err = t.Next()
+			continue
+		}
+		s.Attributes = uint32(fileInfo.FileAttributes)
+		if hdr.Typeflag == tar.TypeLink {
+			summaries = append(summaries, s)
+			hdr, err = t.Next()
+			continue
+		}
+
+		pr, pw := io.Pipe()
+		done := make(chan inspectResult)
+		go func() {
+			streams, err := winio.InspectBackupStream(pr)
+			if err == nil {
+				// Unblock the writer if the stream has trailing data.
+				pr.Close()
+			} else {
+				pr.CloseWithError(err)
+			}
+			done <- inspectResult{streams, err}
+		}()
+		hdr, err = WriteBackupStreamFromTarFile(pw, t, hdr)
+		if err != nil && err != io.EOF {
+			pw.CloseWithError(err)
+		} else {
+			pw.Close()
+		}
+		r := <-done
+		s.Streams = r.streams
+		if err != nil && err != io.EOF {
+			s.Error = err.Error()
+		} else if r.err != nil {
+			s.Error = r.err.Error()
+			err = r.err
+		}
+		summaries = append(summaries, s)
+	}
+	if err == io.EOF {
+		err = nil
+	}
+	return summaries, err
+}
+
+// WriteTarSummary writes the summaries returned by InspectTar to w as indented JSON.
+// The summaries are written even if the archive could not be fully read, in which case
+// the error is also returned.
+func WriteTarSummary(w io.Writer, t *tar.Reader) error {
+	summaries, err := InspectTar(t)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if jerr := enc.Encode(summaries); jerr != nil {
+		return jerr
+	}
+	return err
+}
@@ -0,0 +1,661 @@
+package backuptar
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/Microsoft/go-winio"
+	"github.com/Microsoft/go-winio/archive/tar"
+)
+
+const (
+	defaultPipelineWorkers    = 4
+	defaultPipelineBufferSize = 1024 * 1024
+	pipelineChunkSize         = 64 * 1024
+)
+
+var errPipelineCanceled = errors.New("backuptar pipeline canceled")
+
+// PipelineOptions configures WriteTarFromDirectory and ExtractTarToDirectory.
+type PipelineOptions struct {
+	// Workers is the maximum number of files that are read or written concurrently.
+	// If zero, 4 is used.
+	Workers int
+
+	// BufferSize is the maximum number of bytes of backup stream data that are buffered
+	// for each file while it waits for its turn in the archive. If zero, 1MB is used.
+	BufferSize int
+
+	// Collision is the policy that ExtractTarToDirectory applies to entries whose path
+	// already exists.
+	Collision CollisionPolicy
+
+	// OnCollision, if set, is called by ExtractTarToDirectory for each entry whose path
+	// already exists, with the name of the entry and the existing file, and returns the
+	// policy to apply to that entry instead of Collision.
+	OnCollision func(name string, existing os.FileInfo) CollisionPolicy
+
+	// SkipFileTimes stops ExtractTarToDirectory from setting the times of extracted
+	// files and directories to those in the archive; their attributes are still
+	// restored. By default the times are set once each backup stream has been
+	// written, which defeats NTFS file name tunneling. With SkipFileTimes, a file
+	// recreated shortly after a file of the same name was deleted can get the creation
+	// time of the deleted file.
+	SkipFileTimes bool
+}
+
+// CollisionPolicy determines how ExtractTarToDirectory handles an entry whose path
+// already exists in the destination.
+//
+// Except under CollisionFail, a directory entry whose path already exists as a
+// directory is merged with it, so that the contents of both are kept. Only its metadata
+// is subject to the policy: CollisionSkip keeps the metadata of the existing directory,
+// CollisionMergeSecurity keeps its security descriptor, and the other policies replace
+// it.
+type CollisionPolicy int
+
+const (
+	// CollisionFail fails the extraction. This is the default.
+	CollisionFail CollisionPolicy = iota
+	// CollisionOverwrite deletes the existing file, or directory tree, and extracts the
+	// entry in its place.
+	CollisionOverwrite
+	// CollisionSkip keeps the existing file and skips the entry, along with the
+	// contents of a skipped directory and any hard links to a skipped file.
+	CollisionSkip
+	// CollisionRename extracts the entry under a new name, formed by adding a suffix such
+	// as " (1)" before the extension. Later entries inside a renamed directory, and hard
+	// links to a renamed file, use the new name.
+	CollisionRename
+	// CollisionMergeSecurity overwrites the data and metadata of an existing file with
+	// those of the entry, but keeps the security descriptor of the existing file, as
+	// well as any of its named streams that the entry does not have.
+	CollisionMergeSecurity
+)
+
+func (o *PipelineOptions) limits() (workers int, chunks int) {
+	workers = defaultPipelineWorkers
+	bufferSize := defaultPipelineBufferSize
+	if o != nil {
+		if o.Workers > 0 {
+			workers = o.Workers
+		}
+		if o.BufferSize > 0 {
+			bufferSize = o.BufferSize
+		}
+	}
+	chunks = (bufferSize + pipelineChunkSize - 1) / pipelineChunkSize
+	return
+}
+
+// pipeline tracks the first error of a set of cooperating goroutines and tells the
+// rest of them to stop.
+type pipeline struct {
+	cancel chan struct{}
+	once   sync.Once
+	err    error
+	wg     sync.WaitGroup
+}
+
+func newPipeline() *pipeline {
+	return &pipeline{cancel: make(chan struct{})}
+}
+
+func (p *pipeline) fail(err error) {
+	p.once.Do(func() {
+		p.err = err
+		close(p.cancel)
+	})
+}
+
+// wait stops all goroutines that are still running and returns the first error.
+func (p *pipeline) wait(err error) error {
+	if err != nil {
+		p.fail(err)
+	}
+	p.wg.Wait()
+	p.fail(nil)
+	return p.err
+}
+
+// chunkPipe is an in-memory pipe that holds a bounded amount of data, so that the
+// writing side can run ahead of the reading side.
+type chunkPipe struct {
+	ch     chan []byte
+	cur    []byte
+	err    error
+	cancel <-chan struct{}
+}
+
+func newChunkPipe(chunks int, cancel <-chan struct{}) *chunkPipe {
+	return &chunkPipe{ch: make(chan []byte, chunks), cancel: cancel}
+}
+
+func (p *chunkPipe) Write(b []byte) (int, error) {
+	n := 0
+	for len(b) > 0 {
+		c := b
+		if len(c) > pipelineChunkSize {
+			c = c[:pipelineChunkSize]
+		}
+		select {
+		case p.ch <- append([]byte(nil), c...):
+		case <-p.cancel:
+			return n, errPipelineCanceled
+		}
+		n += len(c)
+		b = b[len(c):]
+	}
+	return n, nil
+}
+
+// CloseWithError closes the writing side of the pipe. Once the buffered data has been
+// read, reads return err, or io.EOF if err is nil.
+func (p *chunkPipe) CloseWithError(err error) {
+	p.err = err
+	close(p.ch)
+}
+
+func (p *chunkPipe) Read(b []byte) (int, error) {
+	for len(p.cur) == 0 {
+		select {
+		case c, ok := <-p.ch:
+			if !ok {
+				if p.err != nil {
+					return 0, p.err
+				}
+				return 0, io.EOF
+			}
+			p.cur = c
+		case <-p.cancel:
+			return 0, errPipelineCanceled
+		}
+	}
+	n := copy(b, p.cur)
+	p.cur = p.cur[n:]
+	return n, nil
+}
+
+type exportFile struct {
+	name     string
+	size     int64
+	fileInfo *winio.FileBasicInfo
+	err      error
+	ready    chan struct{}
+	data     *chunkPipe
+}
+
+// WriteTarFromDirectory writes the contents of the directory tree rooted at root to a
+// tar writer, in the format written by WriteTarFileFromBackupStream. Entries are named
+// relative to root and are written in lexical order, depth first.
+//
+// Up to opts.Workers files are opened and read with BackupRead ahead of the file that
+// is currently being written to the archive, so that the latency of opening and reading
+// files overlaps with writing the archive. Reparse points are archived but not followed.
+func WriteTarFromDirectory(t *tar.Writer, root string, opts *PipelineOptions) error {
+	workers, chunks := opts.limits()
+	p := newPipeline()
+	sem := make(chan struct{}, workers)
+	queue := make(chan *exportFile, workers)
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		defer close(queue)
+		err := enumerateDirectory(p, root, "", sem, queue, chunks)
+		if err != nil {
+			p.fail(err)
+		}
+	}()
+
+	var err error
+	for ef := range queue {
+		<-ef.ready
+		err = ef.err
+		if err == nil {
+			err = WriteTarFileFromBackupStream(t, ef.data, ef.name, ef.size, ef.fileInfo)
+		}
+		<-sem
+		if err != nil {
+			break
+		}
+	}
+	return p.wait(err)
+}
+
+func enumerateDirectory(p *pipeline, root string, name string, sem chan struct{}, queue chan<- *exportFile, chunks int) error {
+	dir, err := os.Open(filepath.Join(root, name))
+	if err != nil {
+		return err
+	}
+	names, err := dir.Readdirnames(-1)
+	dir.Close()
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		n = filepath.Join(name, n)
+		path := filepath.Join(root, n)
+		fi, err := os.Lstat(path)
+		if err != nil {
+			return err
+		}
+		select {
+		case sem <- struct{}{}:
+		case <-p.cancel:
+			return nil
+		}
+		ef := &exportFile{
+			name:  filepath.ToSlash(n),
+			ready: make(chan struct{}),
+			data:  newChunkPipe(chunks, p.cancel),
+		}
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			prefetchFile(ef, path)
+		}()
+		select {
+		case queue <- ef:
+		case <-p.cancel:
+			return nil
+		}
+		attr := fi.Sys().(*syscall.Win32FileAttributeData).FileAttributes
+		if attr&syscall.FILE_ATTRIBUTE_DIRECTORY != 0 && attr&syscall.FILE_ATTRIBUTE_REPARSE_POINT == 0 {
+			err = enumerateDirectory(p, root, n, sem, queue, chunks)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func prefetchFile(ef *exportFile, path string) {
+	f, err := winio.OpenForBackup(path, syscall.GENERIC_READ, syscall.FILE_SHARE_READ, syscall.OPEN_EXISTING)
+	if err != nil {
+		ef.err = err
+		close(ef.ready)
+		return
+	}
+	defer f.Close()
+	ef.fileInfo, err = winio.GetFileBasicInfo(f)
+	if err == nil {
+		var fi os.FileInfo
+		fi, err = f.Stat()
+		if err == nil {
+			ef.size = fi.Size()
+		}
+	}
+	if err != nil {
+		ef.err = err
+		close(ef.ready)
+		return
+	}
+	close(ef.ready)
+
+	br := winio.NewBackupFileReader(f, true)
+	_, err = io.CopyBuffer(ef.data, br, make([]byte, pipelineChunkSize))
+	br.Close()
+	ef.data.CloseWithError(err)
+}
+
+type extractedDir struct {
+	path     string
+	fileInfo *winio.FileBasicInfo
+}
+
+// extractor holds the state of ExtractTarToDirectory.
+type extractor struct {
+	p      *pipeline
+	t      *tar.Reader
+	root   string
+	sem    chan struct{}
+	chunks int
+	opts   PipelineOptions
+	dirs   []extractedDir
+	// renamed maps the paths of renamed entries, relative to root, to their new
+	// paths. Skipped entries map to "".
+	renamed map[string]string
+	// reparsePoints holds the paths, relative to root, of the reparse points that have
+	// been extracted. Entries beneath them are rejected, since they would be written
+	// wherever the reparse points lead.
+	reparsePoints map[string]bool
+}
+
+// ExtractTarToDirectory extracts an archive written by WriteTarFromDirectory, or any
+// other sequence of files written by WriteTarFileFromBackupStream, into the directory
+// root, which must already exist. Entries whose path already exists are handled
+// according to opts.Collision and opts.OnCollision.
+//
+// Files and directories are created in archive order, but their backup streams are
+// written with BackupWrite by up to opts.Workers goroutines concurrently while the
+// archive continues to be read. The times of directories are set after all their
+// contents have been extracted. Restoring security descriptors and reparse points
+// generally requires the restore privilege. Reparse points are restored but never
+// followed: an entry beneath one fails the extraction.
+func ExtractTarToDirectory(t *tar.Reader, root string, opts *PipelineOptions) error {
+	workers, chunks := opts.limits()
+	x := &extractor{
+		p:             newPipeline(),
+		t:             t,
+		root:          root,
+		sem:           make(chan struct{}, workers),
+		chunks:        chunks,
+		renamed:       make(map[string]string),
+		reparsePoints: make(map[string]bool),
+	}
+	if opts != nil {
+		x.opts = *opts
+	}
+	hdr, err := t.Next()
+	for err == nil {
+		hdr, err = x.extractEntry(hdr)
+	}
+	if err == io.EOF {
+		err = nil
+	}
+	err = x.p.wait(err)
+	if err != nil {
+		return err
+	}
+
+	// Children come after their parents in the archive, so walk backwards to set the
+	// times of each directory after those of the directories inside it.
+	for i := len(x.dirs) - 1; i >= 0; i-- {
+		err = setDirectoryInfo(x.dirs[i].path, x.dirs[i].fileInfo)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// relPath returns the path of an entry relative to root, taking into account renamed
+// and skipped entries, or skip set if the entry should be skipped.
+func (x *extractor) relPath(name string) (rel string, skip bool, err error) {
+	p := filepath.Clean(filepath.FromSlash(name))
+	if filepath.IsAbs(p) || filepath.VolumeName(p) != "" || p == ".." || strings.HasPrefix(p, ".."+string(filepath.Separator)) {
+		return "", false, fmt.Errorf("%s: invalid path in archive", name)
+	}
+	rel = p
+	for dir := p; dir != "."; dir = filepath.Dir(dir) {
+		if r, ok := x.renamed[dir]; ok {
+			if r == "" {
+				return "", true, nil
+			}
+			rel = r + p[len(dir):]
+			break
+		}
+	}
+	for dir := filepath.Dir(rel); dir != "."; dir = filepath.Dir(dir) {
+		if x.reparsePoints[dir] {
+			return "", false, fmt.Errorf("%s: path in archive is beneath a reparse point", name)
+		}
+	}
+	return rel, false, nil
+}
+
+// collision returns the policy for an entry whose path exists.
+func (x *extractor) collision(name string, rel string) (CollisionPolicy, os.FileInfo, error) {
+	fi, err := os.Lstat(filepath.Join(x.root, rel))
+	if err != nil {
+		return 0, nil, err
+	}
+	policy := x.opts.Collision
+	if x.opts.OnCollision != nil {
+		policy = x.opts.OnCollision(name, fi)
+	}
+	return policy, fi, nil
+}
+
+// rename finds an unused name for an entry and records it for later entries.
+func (x *extractor) rename(rel string) (string, error) {
+	ext := filepath.Ext(rel)
+	stem := rel[:len(rel)-len(ext)]
+	for i := 1; ; i++ {
+		candidate := fmt.Sprintf("%s (%d)%s", stem, i, ext)
+		_, err := os.Lstat(filepath.Join(x.root, candidate))
+		if os.IsNotExist(err) {
+			x.renamed[rel] = candidate
+			return candidate, nil
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+}
+
+func removeExisting(path string, fi os.FileInfo) error {
+	if fi.IsDir() {
+		return os.RemoveAll(path)
+	}
+	return winio.PosixRemove(path)
+}
+
+func (x *extractor) extractEntry(hdr *tar.Header) (*tar.Header, error) {
+	name, _, fileInfo, err := FileInfoFromHeader(hdr)
+	if err != nil {
+		return nil, err
+	}
+	if x.opts.SkipFileTimes {
+		fileInfo = &winio.FileBasicInfo{FileAttributes: fileInfo.FileAttributes}
+	}
+	rel, skip, err := x.relPath(name)
+	if err != nil {
+		return nil, err
+	}
+	if skip {
+		return WriteBackupStreamFromTarFile(ioutil.Discard, x.t, hdr)
+	}
+	if hdr.Typeflag == tar.TypeLink {
+		return x.extractLink(name, rel, hdr)
+	}
+
+	var (
+		f               *os.File
+		includeSecurity bool
+		closeInfo       = fileInfo
+	)
+	if fileInfo.FileAttributes&syscall.FILE_ATTRIBUTE_DIRECTORY != 0 {
+		var path string
+		f, path, includeSecurity, err = x.createDirectory(name, rel)
+		if f != nil {
+			// The directory's contents are extracted while its backup stream is
+			// being written, and its times are set once they are all done.
+			closeInfo = nil
+			x.dirs = append(x.dirs, extractedDir{path, fileInfo})
+		}
+	} else {
+		f, includeSecurity, err = x.createFile(name, rel)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if f == nil {
+		return WriteBackupStreamFromTarFile(ioutil.Discard, x.t, hdr)
+	}
+	if hdr.Typeflag == tar.TypeSymlink {
+		if r, ok := x.renamed[rel]; ok {
+			rel = r
+		}
+		x.reparsePoints[rel] = true
+	}
+
+	select {
+	case x.sem <- struct{}{}:
+	case <-x.p.cancel:
+		f.Close()
+		return nil, errPipelineCanceled
+	}
+	data := newChunkPipe(x.chunks, x.p.cancel)
+	x.p.wg.Add(1)
+	go func() {
+		defer x.p.wg.Done()
+		defer func() { <-x.sem }()
+		err := restoreFile(f, data, closeInfo, includeSecurity)
+		if err != nil {
+			x.p.fail(err)
+		}
+	}()
+	hdr, err = WriteBackupStreamFromTarFile(data, x.t, hdr)
+	if err != nil && err != io.EOF {
+		data.CloseWithError(err)
+		return nil, err
+	}
+	data.CloseWithError(nil)
+	return hdr, err
+}
+
+func (x *extractor) extractLink(name string, rel string, hdr *tar.Header) (*tar.Header, error) {
+	targetRel, skip, err := x.relPath(hdr.Linkname)
+	if err != nil {
+		return nil, err
+	}
+	if skip {
+		x.renamed[rel] = ""
+		return x.t.Next()
+	}
+	target := filepath.Join(x.root, targetRel)
+	err = os.Link(target, filepath.Join(x.root, rel))
+	if os.IsExist(err) {
+		policy, fi, cerr := x.collision(name, rel)
+		if cerr != nil {
+			return nil, cerr
+		}
+		switch policy {
+		case CollisionSkip:
+			x.renamed[rel] = ""
+			return x.t.Next()
+		case CollisionOverwrite, CollisionMergeSecurity:
+			err = removeExisting(filepath.Join(x.root, rel), fi)
+			if err == nil {
+				err = os.Link(target, filepath.Join(x.root, rel))
+			}
+		case CollisionRename:
+			rel, err = x.rename(rel)
+			if err == nil {
+				err = os.Link(target, filepath.Join(x.root, rel))
+			}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return x.t.Next()
+}
+
+// createDirectory creates the directory for an entry, or opens the existing directory it
+// is merged with, and returns it along with its path and whether its security descriptor
+// should be restored. It returns a nil file if the entry's backup stream should be
+// skipped.
+func (x *extractor) createDirectory(name string, rel string) (*os.File, string, bool, error) {
+	path := filepath.Join(x.root, rel)
+	includeSecurity := true
+	err := os.Mkdir(path, 0)
+	if os.IsExist(err) {
+		policy, fi, cerr := x.collision(name, rel)
+		if cerr != nil {
+			return nil, "", false, cerr
+		}
+		switch {
+		case policy == CollisionFail:
+			// Keep the exists error, even for an existing directory.
+		case fi.IsDir():
+			err = nil
+			if policy == CollisionSkip {
+				return nil, "", false, nil
+			}
+			includeSecurity = policy != CollisionMergeSecurity
+		case policy == CollisionSkip:
+			x.renamed[rel] = ""
+			return nil, "", false, nil
+		case policy == CollisionOverwrite || policy == CollisionMergeSecurity:
+			err = removeExisting(path, fi)
+			if err == nil {
+				err = os.Mkdir(path, 0)
+			}
+		case policy == CollisionRename:
+			rel, err = x.rename(rel)
+			if err == nil {
+				path = filepath.Join(x.root, rel)
+				err = os.Mkdir(path, 0)
+			}
+		}
+	}
+	if err != nil {
+		return nil, "", false, err
+	}
+	f, err := winio.OpenForBackup(path, syscall.GENERIC_WRITE|winio.WRITE_DAC|winio.WRITE_OWNER, syscall.FILE_SHARE_READ|syscall.FILE_SHARE_WRITE|syscall.FILE_SHARE_DELETE, syscall.OPEN_EXISTING)
+	if err != nil {
+		return nil, "", false, err
+	}
+	return f, path, includeSecurity, nil
+}
+
+// createFile creates the file for an entry, or opens the existing file that it
+// overwrites, and returns it along with whether its security descriptor should be
+// restored. It returns a nil file if the entry should be skipped.
+func (x *extractor) createFile(name string, rel string) (*os.File, bool, error) {
+	const access = syscall.GENERIC_WRITE | winio.WRITE_DAC | winio.WRITE_OWNER
+	// Create the file before moving on so that later entries can refer to it.
+	f, err := winio.OpenForBackup(filepath.Join(x.root, rel), access, 0, syscall.CREATE_NEW)
+	if !os.IsExist(err) {
+		return f, true, err
+	}
+	policy, fi, cerr := x.collision(name, rel)
+	if cerr != nil {
+		return nil, false, cerr
+	}
+	path := filepath.Join(x.root, rel)
+	switch {
+	case policy == CollisionSkip:
+		x.renamed[rel] = ""
+		return nil, false, nil
+	case policy == CollisionMergeSecurity && !fi.IsDir():
+		f, err = winio.OpenForBackup(path, syscall.GENERIC_WRITE, 0, syscall.TRUNCATE_EXISTING)
+		return f, false, err
+	case policy == CollisionOverwrite || policy == CollisionMergeSecurity:
+		err = removeExisting(path, fi)
+		if err == nil {
+			f, err = winio.OpenForBackup(path, access, 0, syscall.CREATE_NEW)
+		}
+	case policy == CollisionRename:
+		rel, err = x.rename(rel)
+		if err == nil {
+			f, err = winio.OpenForBackup(filepath.Join(x.root, rel), access, 0, syscall.CREATE_NEW)
+		}
+	}
+	return f, true, err
+}
+
+func restoreFile(f *os.File, r io.Reader, fileInfo *winio.FileBasicInfo, includeSecurity bool) error {
+	defer f.Close()
+	bw := winio.NewBackupFileWriter(f, includeSecurity)
+	_, err := io.CopyBuffer(bw, r, make([]byte, pipelineChunkSize))
+	if err != nil {
+		bw.Close()
+		return err
+	}
+	if fileInfo != nil {
+		bw.SetBasicInfoOnClose(fileInfo)
+	}
+	return bw.Close()
+}
+
+func setDirectoryInfo(path string, fileInfo *winio.FileBasicInfo) error {
+	f, err := winio.OpenForBackup(path, syscall.GENERIC_WRITE, syscall.FILE_SHARE_READ|syscall.FILE_SHARE_WRITE|syscall.FILE_SHARE_DELETE, syscall.OPEN_EXISTING)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return winio.SetFileBasicInfo(f, fileInfo)
+}
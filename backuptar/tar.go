@@ -7,6 +7,7 @@ import (
 	"io"
 	"io/ioutil"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"syscall"
@@ -34,6 +35,7 @@ const (
 	hdrSecurityDescriptor    = "sd"
 	hdrRawSecurityDescriptor = "rawsd"
 	hdrMountPoint            = "mountpoint"
+	hdrEaPrefix              = "xattr."
 )
 
 func writeZeroes(w io.Writer, count int64) error {
@@ -64,10 +66,16 @@ func copySparse(t *tar.Writer, br *winio.BackupStreamReader) error {
 		if bhdr.Id != winio.BackupSparseBlock {
 			return fmt.Errorf("unexpected stream %d", bhdr.Id)
 		}
+		if bhdr.Offset < curOffset {
+			return fmt.Errorf("sparse block at offset %d overlaps previous data ending at %d", bhdr.Offset, curOffset)
+		}
 
 		// archive/tar does not support writing sparse files
 		// so just write zeroes to catch up to the current offset.
 		err = writeZeroes(t, bhdr.Offset-curOffset)
+		if err != nil {
+			return err
+		}
 		if bhdr.Size == 0 {
 			break
 		}
@@ -80,6 +88,53 @@ func copySparse(t *tar.Writer, br *winio.BackupStreamReader) error {
 	return nil
 }
 
+// writeSparseBackupData writes the data of a sparse tar file as a sparse data stream,
+// with one sparse block per data fragment, so that the holes are neither stored nor
+// written as zeroes. This is the inverse of copySparse.
+func writeSparseBackupData(bw *winio.BackupStreamWriter, t *tar.Reader, sp []tar.SparseEntry, size int64) error {
+	bhdr := winio.BackupHeader{
+		Id:         winio.BackupData,
+		Attributes: winio.StreamSparseAttributes,
+	}
+	err := bw.WriteHeader(&bhdr)
+	if err != nil {
+		return err
+	}
+	curOffset := int64(0)
+	for _, s := range sp {
+		if t.SkipHole() != s.Offset-curOffset {
+			return fmt.Errorf("sparse hole before offset %d does not match the sparse map", s.Offset)
+		}
+		bhdr := winio.BackupHeader{
+			Id:     winio.BackupSparseBlock,
+			Offset: s.Offset,
+			Size:   s.Length,
+		}
+		err = bw.WriteHeader(&bhdr)
+		if err != nil {
+			return err
+		}
+		_, err = io.CopyN(bw, t, s.Length)
+		if err != nil {
+			return err
+		}
+		curOffset = s.Offset + s.Length
+	}
+	// An empty block at the end of the file terminates the stream and sets the
+	// file size when the file ends in a hole.
+	bhdr = winio.BackupHeader{
+		Id:     winio.BackupSparseBlock,
+		Offset: size,
+	}
+	return bw.WriteHeader(&bhdr)
+}
+
+type eaByName []winio.ExtendedAttribute
+
+func (e eaByName) Len() int           { return len(e) }
+func (e eaByName) Less(i, j int) bool { return e[i].Name < e[j].Name }
+func (e eaByName) Swap(i, j int)      { e[i], e[j] = e[j], e[i] }
+
 // BasicInfoHeader creates a tar header from basic file information.
 func BasicInfoHeader(name string, size int64, fileInfo *winio.FileBasicInfo) *tar.Header {
 	hdr := &tar.Header{
@@ -113,6 +168,8 @@ func BasicInfoHeader(name string, size int64, fileInfo *winio.FileBasicInfo) *ta
 // MSWINDOWS.rawsd: The Win32 security descriptor, in raw binary format
 //
 // MSWINDOWS.mountpoint: If present, this is a mount point and not a symlink, even though the type is '2' (symlink)
+//
+// MSWINDOWS.xattr.<name>: An extended attribute of the file, with the value base64 encoded
 func WriteTarFileFromBackupStream(t *tar.Writer, r io.Reader, name string, size int64, fileInfo *winio.FileBasicInfo) error {
 	name = filepath.ToSlash(name)
 	hdr := BasicInfoHeader(name, size, fileInfo)
@@ -149,7 +206,19 @@ func WriteTarFileFromBackupStream(t *tar.Writer, r io.Reader, name string, size
 				hdr.Winheaders[hdrMountPoint] = "1"
 			}
 			hdr.Linkname = rp.Target
-		case winio.BackupEaData, winio.BackupLink, winio.BackupPropertyData, winio.BackupObjectId, winio.BackupTxfsData:
+		case winio.BackupEaData:
+			eab, err := ioutil.ReadAll(br)
+			if err != nil {
+				return err
+			}
+			eas, err := winio.DecodeExtendedAttributes(eab)
+			if err != nil {
+				return err
+			}
+			for _, ea := range eas {
+				hdr.Winheaders[hdrEaPrefix+ea.Name] = base64.StdEncoding.EncodeToString(ea.Value)
+			}
+		case winio.BackupLink, winio.BackupPropertyData, winio.BackupObjectId, winio.BackupTxfsData:
 			// ignore these streams
 		default:
 			return fmt.Errorf("%s: unknown stream ID %d", name, bhdr.Id)
@@ -291,6 +360,40 @@ func WriteBackupStreamFromTarFile(w io.Writer, t *tar.Reader, hdr *tar.Header) (
 			return nil, err
 		}
 	}
+	var eas []winio.ExtendedAttribute
+	for k, v := range hdr.Winheaders {
+		if !strings.HasPrefix(k, hdrEaPrefix) {
+			continue
+		}
+		data, err := base64.StdEncoding.DecodeString(v)
+		if err != nil {
+			return nil, err
+		}
+		eas = append(eas, winio.ExtendedAttribute{
+			Name:  k[len(hdrEaPrefix):],
+			Value: data,
+		})
+	}
+	if len(eas) != 0 {
+		// Map iteration order is random; keep the EA order stable.
+		sort.Sort(eaByName(eas))
+		eadata, err := winio.EncodeExtendedAttributes(eas)
+		if err != nil {
+			return nil, err
+		}
+		bhdr := winio.BackupHeader{
+			Id:   winio.BackupEaData,
+			Size: int64(len(eadata)),
+		}
+		err = bw.WriteHeader(&bhdr)
+		if err != nil {
+			return nil, err
+		}
+		_, err = bw.Write(eadata)
+		if err != nil {
+			return nil, err
+		}
+	}
 	if hdr.Typeflag == tar.TypeSymlink {
 		_, isMountPoint := hdr.Winheaders[hdrMountPoint]
 		rp := winio.ReparsePoint{
@@ -312,17 +415,24 @@ func WriteBackupStreamFromTarFile(w io.Writer, t *tar.Reader, hdr *tar.Header) (
 		}
 	}
 	if hdr.Typeflag == tar.TypeReg || hdr.Typeflag == tar.TypeRegA {
-		bhdr := winio.BackupHeader{
-			Id:   winio.BackupData,
-			Size: hdr.Size,
-		}
-		err := bw.WriteHeader(&bhdr)
-		if err != nil {
-			return nil, err
-		}
-		_, err = io.Copy(bw, t)
-		if err != nil {
-			return nil, err
+		if sp := t.SparseEntries(); sp != nil {
+			err = writeSparseBackupData(bw, t, sp, hdr.Size)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			bhdr := winio.BackupHeader{
+				Id:   winio.BackupData,
+				Size: hdr.Size,
+			}
+			err := bw.WriteHeader(&bhdr)
+			if err != nil {
+				return nil, err
+			}
+			_, err = io.Copy(bw, t)
+			if err != nil {
+				return nil, err
+			}
 		}
 	}
 	// Copy all the alternate data streams and return the next non-ADS header.
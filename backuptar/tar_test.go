@@ -2,11 +2,18 @@ package backuptar
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"reflect"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/Microsoft/go-winio"
 	"github.com/Microsoft/go-winio/archive/tar"
@@ -82,3 +89,510 @@ func TestRoundTrip(t *testing.T) {
 
 	ensurePresent(t, hdr.Winheaders, "fileattr", "sd")
 }
+
+func TestExtendedAttributesRoundTrip(t *testing.T) {
+	eas := []winio.ExtendedAttribute{
+		{Name: "$LXUID", Value: []byte{0, 0, 0, 0}},
+		{Name: "foo", Value: []byte("bar")},
+	}
+	eadata, err := winio.EncodeExtendedAttributes(eas)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := "testing 1 2 3\n"
+	var stream bytes.Buffer
+	bw := winio.NewBackupStreamWriter(&stream)
+	err = bw.WriteHeader(&winio.BackupHeader{Id: winio.BackupEaData, Size: int64(len(eadata))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = bw.Write(eadata); err != nil {
+		t.Fatal(err)
+	}
+	err = bw.WriteHeader(&winio.BackupHeader{Id: winio.BackupData, Size: int64(len(data))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = bw.Write([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	err = WriteTarFileFromBackupStream(tw, &stream, "file.txt", int64(len(data)), &winio.FileBasicInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tr := tar.NewReader(&buf)
+	hdr, err := tr.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ensurePresent(t, hdr.Winheaders, "xattr.$LXUID", "xattr.foo")
+
+	var out bytes.Buffer
+	_, err = WriteBackupStreamFromTarFile(&out, tr, hdr)
+	if err != io.EOF {
+		t.Fatalf("expected EOF, got %v", err)
+	}
+	br := winio.NewBackupStreamReader(&out)
+	bhdr, err := br.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bhdr.Id != winio.BackupEaData {
+		t.Fatalf("unexpected stream ID %d", bhdr.Id)
+	}
+	b, err := ioutil.ReadAll(br)
+	if err != nil {
+		t.Fatal(err)
+	}
+	eas2, err := winio.DecodeExtendedAttributes(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(eas, eas2) {
+		t.Errorf("got %+v, expected %+v", eas2, eas)
+	}
+}
+
+func TestDirectoryRoundTrip(t *testing.T) {
+	src, err := ioutil.TempDir("", "tst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(src)
+	files := map[string]string{
+		"a.txt":         "testing 1 2 3\n",
+		"b/c.txt":       "more testing\n",
+		"b/d/e.txt":     "",
+		"b/d/f.txt":     "even more testing\n",
+		"b/f.txt:a.txt": "alternate data stream\n",
+	}
+	for name, data := range files {
+		path := filepath.Join(src, filepath.FromSlash(name))
+		if err = os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err = ioutil.WriteFile(path, []byte(data), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	err = WriteTarFromDirectory(tw, src, &PipelineOptions{Workers: 2, BufferSize: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	tr := tar.NewReader(bytes.NewReader(buf.Bytes()))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, hdr.Name)
+	}
+	expected := []string{"a.txt", "b", "b/c.txt", "b/d", "b/d/e.txt", "b/d/f.txt", "b/f.txt", "b/f.txt:a.txt"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Fatalf("got entries %v, expected %v", names, expected)
+	}
+
+	dst, err := ioutil.TempDir("", "tst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dst)
+	err = ExtractTarToDirectory(tar.NewReader(&buf), dst, &PipelineOptions{Workers: 2, BufferSize: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range files {
+		b, err := ioutil.ReadFile(filepath.Join(dst, filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != data {
+			t.Errorf("%s: got %q, expected %q", name, b, data)
+		}
+	}
+}
+
+func TestExtractCollisions(t *testing.T) {
+	src, err := ioutil.TempDir("", "tst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(src)
+	if err = os.Mkdir(filepath.Join(src, "b"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a.txt", `b\c.txt`} {
+		if err = ioutil.WriteFile(filepath.Join(src, name), []byte("new"), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	if err = WriteTarFromDirectory(tw, src, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err = tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		opts     PipelineOptions
+		fail     bool
+		expected map[string]string
+	}{
+		{"fail", PipelineOptions{}, true, nil},
+		{"skip", PipelineOptions{Collision: CollisionSkip}, false, map[string]string{"a.txt": "old", `b\c.txt`: "old"}},
+		{"overwrite", PipelineOptions{Collision: CollisionOverwrite}, false, map[string]string{"a.txt": "new", `b\c.txt`: "new"}},
+		{"mergesecurity", PipelineOptions{Collision: CollisionMergeSecurity}, false, map[string]string{"a.txt": "new", `b\c.txt`: "new"}},
+		{"rename", PipelineOptions{Collision: CollisionRename}, false, map[string]string{"a.txt": "old", "a (1).txt": "new", `b\c.txt`: "old", `b\c (1).txt`: "new"}},
+		{"callback", PipelineOptions{OnCollision: func(name string, existing os.FileInfo) CollisionPolicy {
+			if name == "a.txt" {
+				return CollisionSkip
+			}
+			return CollisionOverwrite
+		}}, false, map[string]string{"a.txt": "old", `b\c.txt`: "new"}},
+	}
+	for _, test := range tests {
+		dst, err := ioutil.TempDir("", "tst")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dst)
+		if err = os.Mkdir(filepath.Join(dst, "b"), 0777); err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range []string{"a.txt", `b\c.txt`} {
+			if err = ioutil.WriteFile(filepath.Join(dst, name), []byte("old"), 0666); err != nil {
+				t.Fatal(err)
+			}
+		}
+		err = ExtractTarToDirectory(tar.NewReader(bytes.NewReader(buf.Bytes())), dst, &test.opts)
+		if test.fail {
+			if !os.IsExist(err) {
+				t.Errorf("%s: expected exists error, got %v", test.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+		for name, data := range test.expected {
+			b, err := ioutil.ReadFile(filepath.Join(dst, name))
+			if err != nil {
+				t.Fatalf("%s: %s", test.name, err)
+			}
+			if string(b) != data {
+				t.Errorf("%s: %s: got %q, expected %q", test.name, name, b, data)
+			}
+		}
+	}
+
+	// An existing directory is not merged with a directory entry by default.
+	var dirBuf bytes.Buffer
+	tw = tar.NewWriter(&dirBuf)
+	if err = tw.WriteHeader(&tar.Header{Name: "b", Typeflag: tar.TypeDir, Mode: 0777}); err != nil {
+		t.Fatal(err)
+	}
+	if err = tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	dst, err := ioutil.TempDir("", "tst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dst)
+	if err = os.Mkdir(filepath.Join(dst, "b"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	err = ExtractTarToDirectory(tar.NewReader(&dirBuf), dst, nil)
+	if !os.IsExist(err) {
+		t.Errorf("directory: expected exists error, got %v", err)
+	}
+}
+
+func TestExtractSkipFileTimes(t *testing.T) {
+	modTime := time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC)
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	if err := tw.WriteHeader(&tar.Header{Name: "a.txt", Typeflag: tar.TypeReg, Size: 4, Mode: 0666, ModTime: modTime}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write([]byte("test")); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, skip := range []bool{false, true} {
+		dst, err := ioutil.TempDir("", "tst")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dst)
+		err = ExtractTarToDirectory(tar.NewReader(bytes.NewReader(buf.Bytes())), dst, &PipelineOptions{SkipFileTimes: skip})
+		if err != nil {
+			t.Fatal(err)
+		}
+		fi, err := os.Stat(filepath.Join(dst, "a.txt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if restored := fi.ModTime().Equal(modTime); restored == skip {
+			t.Errorf("SkipFileTimes %v: got modification time %v", skip, fi.ModTime())
+		}
+	}
+}
+
+func TestExtractBeneathReparsePoint(t *testing.T) {
+	outside, err := ioutil.TempDir("", "tst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(outside)
+	dst, err := ioutil.TempDir("", "tst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dst)
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	hdrs := []*tar.Header{
+		{
+			Name:       "link",
+			Typeflag:   tar.TypeSymlink,
+			Linkname:   outside,
+			Winheaders: map[string]string{hdrFileAttributes: "1040", hdrMountPoint: "1"},
+		},
+		{Name: "link/x", Typeflag: tar.TypeReg, Size: 4},
+	}
+	for _, hdr := range hdrs {
+		if err = tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err = tw.Write([]byte("test")); err != nil {
+		t.Fatal(err)
+	}
+	if err = tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	err = ExtractTarToDirectory(tar.NewReader(&buf), dst, nil)
+	if err == nil {
+		t.Fatal("extracted an entry beneath a reparse point")
+	}
+	if _, err := os.Lstat(filepath.Join(outside, "x")); !os.IsNotExist(err) {
+		t.Fatalf("file was written through the reparse point: %v", err)
+	}
+}
+
+func TestWriteTarSummary(t *testing.T) {
+	src, err := ioutil.TempDir("", "tst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(src)
+	if err = ioutil.WriteFile(filepath.Join(src, "a.txt"), []byte("testing"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(src, "a.txt:ads"), []byte("stream"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	if err = WriteTarFromDirectory(tw, src, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err = tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err = WriteTarSummary(&out, tar.NewReader(&buf)); err != nil {
+		t.Fatal(err)
+	}
+	var summaries []FileSummary
+	if err = json.Unmarshal(out.Bytes(), &summaries); err != nil {
+		t.Fatal(err)
+	}
+	if len(summaries) != 1 || summaries[0].Name != "a.txt" || summaries[0].Type != "file" {
+		t.Fatalf("unexpected summaries %s", out.Bytes())
+	}
+	var types []string
+	for _, s := range summaries[0].Streams {
+		types = append(types, s.Type)
+	}
+	if !reflect.DeepEqual(types, []string{"security", "data", "alternateData"}) {
+		t.Fatalf("unexpected streams %v", types)
+	}
+}
+
+func TestCompressedStreamStats(t *testing.T) {
+	var buf bytes.Buffer
+	cw, err := NewCompressedWriter(&buf, &StreamOptions{Compression: Gzip})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := "testing 1 2 3\n"
+	err = WriteTarFileFromBackupStream(cw.Writer, bytes.NewReader(nil), "empty.txt", 0, &winio.FileBasicInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = cw.WriteHeader(&tar.Header{Name: "file.txt", Size: int64(len(data)), Typeflag: tar.TypeReg})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = cw.Write([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+	if err = cw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	ws := cw.Stats()
+	sum := sha256.Sum256(buf.Bytes())
+	if ws.CompressedSize != int64(buf.Len()) || ws.CompressedDigest != "sha256:"+hex.EncodeToString(sum[:]) {
+		t.Fatalf("unexpected compressed stats %+v", ws)
+	}
+
+	var last int64
+	cr, err := NewCompressedReader(bytes.NewReader(buf.Bytes()), &StreamOptions{
+		Compression: Gzip,
+		Progress:    func(uncompressed, compressed int64) { last = uncompressed },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for {
+		_, err = cr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = cr.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if rs := cr.Stats(); rs != ws {
+		t.Fatalf("got stats %+v, expected %+v", rs, ws)
+	}
+	if last != ws.UncompressedSize {
+		t.Fatalf("got progress %d, expected %d", last, ws.UncompressedSize)
+	}
+}
+
+// rawTarHeader returns a ustar header block. It is used instead of tar.Writer to
+// build entries whose PAX records the writer would not emit on its own.
+func rawTarHeader(name string, typeflag byte, size int64) []byte {
+	b := make([]byte, 512)
+	copy(b, name)
+	copy(b[100:], "0000644\x00")
+	copy(b[124:], fmt.Sprintf("%011o\x00", size))
+	b[156] = typeflag
+	copy(b[257:], "ustar\x0000")
+	copy(b[148:], "        ")
+	sum := 0
+	for _, c := range b {
+		sum += int(c)
+	}
+	copy(b[148:], fmt.Sprintf("%06o\x00 ", sum))
+	return b
+}
+
+func padTarBlock(b []byte) []byte {
+	return append(b, make([]byte, (512-len(b)%512)%512)...)
+}
+
+func TestSparseBackupStreamFromTar(t *testing.T) {
+	// A GNU PAX 1.0 sparse file larger than the 8GB limit of the ustar size
+	// field, with two small fragments.
+	const realSize = 1<<33 + 4096
+	sparseMap := fmt.Sprintf("2\n0\n4\n%d\n4\n", realSize-4096)
+	data := append(padTarBlock([]byte(sparseMap)), "headtail"...)
+	var pax []byte
+	for _, kv := range []string{"GNU.sparse.major=1", "GNU.sparse.minor=0", "GNU.sparse.name=large.vhd", fmt.Sprintf("GNU.sparse.realsize=%d", realSize)} {
+		n := len(kv) + 2
+		n += len(strconv.Itoa(n + len(strconv.Itoa(n))))
+		pax = append(pax, fmt.Sprintf("%d %s\n", n, kv)...)
+	}
+	var archive []byte
+	archive = append(archive, rawTarHeader("PaxHeaders.0/large.vhd", tar.TypeXHeader, int64(len(pax)))...)
+	archive = append(archive, padTarBlock(pax)...)
+	archive = append(archive, rawTarHeader("GNUSparseFile.0/large.vhd", tar.TypeReg, int64(len(data)))...)
+	archive = append(archive, padTarBlock(data)...)
+	archive = append(archive, make([]byte, 1024)...)
+
+	tr := tar.NewReader(bytes.NewReader(archive))
+	hdr, err := tr.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hdr.Name != "large.vhd" || hdr.Size != realSize {
+		t.Fatalf("got %s with size %d", hdr.Name, hdr.Size)
+	}
+	var buf bytes.Buffer
+	if _, err := WriteBackupStreamFromTarFile(&buf, tr, hdr); err != io.EOF {
+		t.Fatalf("expected io.EOF, got %v", err)
+	}
+	if buf.Len() > 4096 {
+		t.Fatalf("backup stream of %d bytes was not written sparsely", buf.Len())
+	}
+
+	type block struct {
+		Offset int64
+		Data   string
+	}
+	var blocks []block
+	br := winio.NewBackupStreamReader(&buf)
+	bhdr, err := br.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bhdr.Id != winio.BackupData || bhdr.Attributes&winio.StreamSparseAttributes == 0 || bhdr.Size != 0 {
+		t.Fatalf("unexpected data stream %+v", bhdr)
+	}
+	for {
+		bhdr, err := br.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bhdr.Id != winio.BackupSparseBlock {
+			t.Fatalf("unexpected stream %+v", bhdr)
+		}
+		b, err := ioutil.ReadAll(br)
+		if err != nil {
+			t.Fatal(err)
+		}
+		blocks = append(blocks, block{bhdr.Offset, string(b)})
+	}
+	expected := []block{{0, "head"}, {realSize - 4096, "tail"}, {realSize, ""}}
+	if !reflect.DeepEqual(blocks, expected) {
+		t.Fatalf("got blocks %v, expected %v", blocks, expected)
+	}
+}
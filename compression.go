@@ -0,0 +1,118 @@
+package winio
+
+import (
+	"encoding/binary"
+	"os"
+	"syscall"
+)
+
+const (
+	cFSCTL_GET_COMPRESSION         = 0x0009003c
+	cFSCTL_SET_COMPRESSION         = 0x0009c040
+	cFSCTL_SET_EXTERNAL_BACKING    = 0x0009030c
+	cFSCTL_GET_EXTERNAL_BACKING    = 0x00090310
+	cFSCTL_DELETE_EXTERNAL_BACKING = 0x00090314
+
+	cCOMPRESSION_FORMAT_NONE    = 0
+	cCOMPRESSION_FORMAT_DEFAULT = 1
+
+	cWOF_CURRENT_VERSION           = 1
+	cFILE_PROVIDER_CURRENT_VERSION = 1
+
+	cERROR_OBJECT_NOT_EXTERNALLY_BACKED = syscall.Errno(342)
+)
+
+// GetFileCompression returns whether a file or directory is compressed with NTFS
+// compression.
+func GetFileCompression(f *os.File) (bool, error) {
+	var out [2]byte
+	_, err := fsctl(f, "FSCTL_GET_COMPRESSION", cFSCTL_GET_COMPRESSION, nil, out[:])
+	if err != nil {
+		return false, err
+	}
+	return binary.LittleEndian.Uint16(out[:]) != cCOMPRESSION_FORMAT_NONE, nil
+}
+
+// SetFileCompression enables or disables NTFS compression for a file, compressing or
+// decompressing its existing data. For a directory, it sets the default for files
+// created in it later. The file must have been opened with read and write access.
+func SetFileCompression(f *os.File, compress bool) error {
+	var in [2]byte
+	if compress {
+		binary.LittleEndian.PutUint16(in[:], cCOMPRESSION_FORMAT_DEFAULT)
+	}
+	_, err := fsctl(f, "FSCTL_SET_COMPRESSION", cFSCTL_SET_COMPRESSION, in[:], nil)
+	return err
+}
+
+// WofProvider identifies the Windows Overlay Filter provider that backs a file.
+type WofProvider uint32
+
+const (
+	// WofProviderWim backs files with the contents of a WIM image, as used by WIMBoot.
+	WofProviderWim WofProvider = 1
+	// WofProviderFile backs files with a compressed copy of their own data, as used by
+	// CompactOS.
+	WofProviderFile WofProvider = 2
+)
+
+// WofAlgorithm is a compression algorithm of the WOF file provider.
+type WofAlgorithm uint32
+
+// The algorithms supported by the WOF file provider, in order of increasing compression
+// ratio: XPRESS with 4KB, 8KB, and 16KB chunks, and LZX with 32KB chunks.
+const (
+	WofXpress4K WofAlgorithm = iota
+	WofLZX
+	WofXpress8K
+	WofXpress16K
+)
+
+// WofBacking describes the external backing of a file.
+type WofBacking struct {
+	Provider WofProvider
+	// Algorithm is the compression algorithm, if Provider is WofProviderFile.
+	Algorithm WofAlgorithm
+}
+
+// SetFileWofCompression compresses a file with the WOF file provider and the given
+// algorithm. The compressed file can be read normally; writing to it decompresses it.
+// This requires Windows 10 and a volume that the Windows Overlay Filter is attached to.
+// The file must have been opened with read access.
+func SetFileWofCompression(f *os.File, algorithm WofAlgorithm) error {
+	var in [20]byte
+	binary.LittleEndian.PutUint32(in[0:4], cWOF_CURRENT_VERSION)
+	binary.LittleEndian.PutUint32(in[4:8], uint32(WofProviderFile))
+	binary.LittleEndian.PutUint32(in[8:12], cFILE_PROVIDER_CURRENT_VERSION)
+	binary.LittleEndian.PutUint32(in[12:16], uint32(algorithm))
+	_, err := fsctl(f, "FSCTL_SET_EXTERNAL_BACKING", cFSCTL_SET_EXTERNAL_BACKING, in[:], nil)
+	return err
+}
+
+// RemoveFileWofBacking removes the external backing of a file, decompressing it if it
+// was compressed by SetFileWofCompression.
+func RemoveFileWofBacking(f *os.File) error {
+	_, err := fsctl(f, "FSCTL_DELETE_EXTERNAL_BACKING", cFSCTL_DELETE_EXTERNAL_BACKING, nil, nil)
+	return err
+}
+
+// GetFileWofBacking returns the external backing of a file, or nil if the file is not
+// externally backed.
+func GetFileWofBacking(f *os.File) (*WofBacking, error) {
+	var out [1024]byte
+	n, err := fsctl(f, "FSCTL_GET_EXTERNAL_BACKING", cFSCTL_GET_EXTERNAL_BACKING, nil, out[:])
+	if perr, ok := err.(*os.PathError); ok && perr.Err == cERROR_OBJECT_NOT_EXTERNALLY_BACKED {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if n < 8 {
+		return nil, &os.PathError{Op: "FSCTL_GET_EXTERNAL_BACKING", Path: f.Name(), Err: syscall.EINVAL}
+	}
+	b := &WofBacking{Provider: WofProvider(binary.LittleEndian.Uint32(out[4:8]))}
+	if b.Provider == WofProviderFile && n >= 16 {
+		b.Algorithm = WofAlgorithm(binary.LittleEndian.Uint32(out[12:16]))
+	}
+	return b, nil
+}
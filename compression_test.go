@@ -0,0 +1,85 @@
+package winio
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func makeCompressibleFile(t *testing.T) *os.File {
+	f, err := ioutil.TempFile("", "compress")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.Write(bytes.Repeat([]byte("compressible "), 64*1024))
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestFileCompression(t *testing.T) {
+	f := makeCompressibleFile(t)
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	err := SetFileCompression(f, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compressed, err := GetFileCompression(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !compressed {
+		t.Fatal("file was not compressed")
+	}
+	err = SetFileCompression(f, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compressed, err = GetFileCompression(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if compressed {
+		t.Fatal("file was not decompressed")
+	}
+}
+
+func TestFileWofCompression(t *testing.T) {
+	f := makeCompressibleFile(t)
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	err := SetFileWofCompression(f, WofXpress8K)
+	if perr, ok := err.(*os.PathError); ok && (perr.Err == syscall.Errno(1) || perr.Err == cERROR_NOT_SUPPORTED) {
+		// ERROR_INVALID_FUNCTION is returned if WOF is not attached to the volume.
+		t.Skip("WOF is not available: ", err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := GetFileWofBacking(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b == nil || *b != (WofBacking{WofProviderFile, WofXpress8K}) {
+		t.Fatalf("unexpected backing %+v", b)
+	}
+	err = RemoveFileWofBacking(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err = GetFileWofBacking(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b != nil {
+		t.Fatalf("unexpected backing %+v after removal", b)
+	}
+}
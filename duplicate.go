@@ -0,0 +1,80 @@
+package winio
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// ErrProtectedProcess is returned when duplicating a handle into a protected
+// process, which other processes may not open for handle duplication.
+var ErrProtectedProcess = errors.New("cannot duplicate a handle into a protected process")
+
+// HandleDuplicator is implemented by the files and connections returned by this
+// package, to hand their handles off to another process, such as a worker started by
+// a broker that accepted its connections.
+type HandleDuplicator interface {
+	// DuplicateTo duplicates the handle into the process with handle process,
+	// which must have PROCESS_DUP_HANDLE access, and returns the value of the new
+	// handle in that process. The new handle belongs to the target process, and it
+	// remains open for overlapped I/O. The original handle is not affected.
+	DuplicateTo(process syscall.Handle) (syscall.Handle, error)
+
+	// DuplicateToProcess is like DuplicateTo, but opens the process by ID.
+	DuplicateToProcess(pid int) (syscall.Handle, error)
+}
+
+// DuplicateTo implements HandleDuplicator.
+//
+// AF_UNIX sockets duplicated this way are only usable in the target process when no
+// layered service providers are installed.
+func (f *win32File) DuplicateTo(process syscall.Handle) (syscall.Handle, error) {
+	f.wg.Add(1)
+	defer f.wg.Done()
+	if f.closing {
+		return 0, ErrFileClosed
+	}
+	var h syscall.Handle
+	err := syscall.DuplicateHandle(syscall.Handle(^uintptr(0)), f.handle, process, &h, 0, false, syscall.DUPLICATE_SAME_ACCESS)
+	if err != nil {
+		if err == syscall.ERROR_ACCESS_DENIED && isProtectedProcess(process) {
+			return 0, ErrProtectedProcess
+		}
+		return 0, os.NewSyscallError("DuplicateHandle", err)
+	}
+	return h, nil
+}
+
+// DuplicateToProcess implements HandleDuplicator.
+func (f *win32File) DuplicateToProcess(pid int) (syscall.Handle, error) {
+	p, err := syscall.OpenProcess(windows.PROCESS_DUP_HANDLE, false, uint32(pid))
+	if err != nil {
+		if err == syscall.ERROR_ACCESS_DENIED {
+			// Protected processes can still be opened to query their protection.
+			q, qerr := syscall.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, uint32(pid))
+			if qerr == nil {
+				protected := isProtectedProcess(q)
+				syscall.CloseHandle(q)
+				if protected {
+					return 0, ErrProtectedProcess
+				}
+			}
+		}
+		return 0, os.NewSyscallError("OpenProcess", err)
+	}
+	defer syscall.CloseHandle(p)
+	return f.DuplicateTo(p)
+}
+
+// isProtectedProcess returns whether process is a protected process, or false if
+// this cannot be determined.
+func isProtectedProcess(process syscall.Handle) bool {
+	// PS_PROTECTION is a single byte whose low three bits are the protection type,
+	// which is zero for unprotected processes.
+	var protection byte
+	err := windows.NtQueryInformationProcess(windows.Handle(process), windows.ProcessProtectionInformation, unsafe.Pointer(&protection), 1, nil)
+	return err == nil && protection&7 != 0
+}
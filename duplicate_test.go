@@ -0,0 +1,49 @@
+package winio
+
+import (
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestDuplicateToProcess(t *testing.T) {
+	client, server, err := PipePair(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	defer server.Close()
+	d, ok := server.(HandleDuplicator)
+	if !ok {
+		t.Fatal("pipe does not implement HandleDuplicator")
+	}
+	h, err := d.DuplicateToProcess(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer syscall.CloseHandle(h)
+	if ft, err := syscall.GetFileType(h); err != nil || ft != syscall.FILE_TYPE_PIPE {
+		t.Fatalf("duplicate has type %d: %v", ft, err)
+	}
+
+	server.Close()
+	if _, err := d.DuplicateTo(syscall.Handle(^uintptr(0))); err != ErrFileClosed {
+		t.Fatalf("expected ErrFileClosed, got %v", err)
+	}
+}
+
+func TestDuplicateToSystemProcess(t *testing.T) {
+	client, server, err := PipePair(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	defer server.Close()
+	// The System process cannot be opened for handle duplication, even by
+	// administrators.
+	h, err := server.(HandleDuplicator).DuplicateToProcess(4)
+	if err == nil {
+		t.Fatalf("duplicated handle %#x into the System process", h)
+	}
+	t.Log(err)
+}
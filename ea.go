@@ -0,0 +1,193 @@
+package winio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"syscall"
+)
+
+//sys ntQueryEaFile(handle syscall.Handle, iosb *ioStatusBlock, buf *byte, length uint32, returnSingleEntry bool, eaList *byte, eaListLength uint32, eaIndex *uint32, restartScan bool) (status ntstatus) = ntdll.NtQueryEaFile
+//sys ntSetEaFile(handle syscall.Handle, iosb *ioStatusBlock, buf *byte, length uint32) (status ntstatus) = ntdll.NtSetEaFile
+
+const (
+	cSTATUS_BUFFER_OVERFLOW  = ntstatus(-0x7ffffffb) // 0x80000005
+	cSTATUS_NO_EAS_ON_FILE   = ntstatus(-0x3fffffae) // 0xC0000052
+	cSTATUS_BUFFER_TOO_SMALL = ntstatus(-0x3fffffdd) // 0xC0000023
+
+	// The EAs of a file can take at most 64KB.
+	maxEaBufferSize = 64 * 1024
+)
+
+type ioStatusBlock struct {
+	Status, Information uintptr
+}
+
+type fileFullEaInformation struct {
+	NextEntryOffset uint32
+	Flags           uint8
+	NameLength      uint8
+	ValueLength     uint16
+}
+
+var (
+	fileFullEaInformationSize = binary.Size(&fileFullEaInformation{})
+
+	errInvalidEaBuffer = errors.New("invalid extended attribute buffer")
+	errEaNameTooLarge  = errors.New("extended attribute name too large")
+	errEaValueTooLarge = errors.New("extended attribute value too large")
+)
+
+// ExtendedAttribute represents a single Windows EA.
+type ExtendedAttribute struct {
+	Name  string
+	Value []byte
+	Flags uint8
+}
+
+func parseEa(b []byte) (ea ExtendedAttribute, nb []byte, err error) {
+	var info fileFullEaInformation
+	err = binary.Read(bytes.NewReader(b), binary.LittleEndian, &info)
+	if err != nil {
+		err = errInvalidEaBuffer
+		return
+	}
+
+	nameOffset := fileFullEaInformationSize
+	nameLen := int(info.NameLength)
+	valueOffset := nameOffset + int(info.NameLength) + 1
+	valueLen := int(info.ValueLength)
+	nextOffset := int(info.NextEntryOffset)
+	if valueLen+valueOffset > len(b) || nextOffset < 0 || nextOffset > len(b) {
+		err = errInvalidEaBuffer
+		return
+	}
+
+	ea.Name = string(b[nameOffset : nameOffset+nameLen])
+	ea.Value = b[valueOffset : valueOffset+valueLen]
+	ea.Flags = info.Flags
+	if info.NextEntryOffset != 0 {
+		nb = b[info.NextEntryOffset:]
+	}
+	return
+}
+
+// DecodeExtendedAttributes decodes a list of EAs from a FILE_FULL_EA_INFORMATION
+// buffer retrieved from BackupRead, ZwQueryEaFile, etc.
+func DecodeExtendedAttributes(b []byte) (eas []ExtendedAttribute, err error) {
+	for len(b) != 0 {
+		ea, nb, err := parseEa(b)
+		if err != nil {
+			return nil, err
+		}
+
+		eas = append(eas, ea)
+		b = nb
+	}
+	return
+}
+
+func writeEa(buf *bytes.Buffer, ea *ExtendedAttribute, last bool) error {
+	if int(uint8(len(ea.Name))) != len(ea.Name) {
+		return errEaNameTooLarge
+	}
+	if int(uint16(len(ea.Value))) != len(ea.Value) {
+		return errEaValueTooLarge
+	}
+	entrySize := uint32(fileFullEaInformationSize + len(ea.Name) + 1 + len(ea.Value))
+	withPadding := (entrySize + 3) &^ 3
+	nextOffset := uint32(0)
+	if !last {
+		nextOffset = withPadding
+	}
+	info := fileFullEaInformation{
+		NextEntryOffset: nextOffset,
+		Flags:           ea.Flags,
+		NameLength:      uint8(len(ea.Name)),
+		ValueLength:     uint16(len(ea.Value)),
+	}
+
+	err := binary.Write(buf, binary.LittleEndian, &info)
+	if err != nil {
+		return err
+	}
+
+	_, err = buf.Write([]byte(ea.Name))
+	if err != nil {
+		return err
+	}
+
+	err = buf.WriteByte(0)
+	if err != nil {
+		return err
+	}
+
+	_, err = buf.Write(ea.Value)
+	if err != nil {
+		return err
+	}
+
+	_, err = buf.Write([]byte{0, 0, 0}[0 : withPadding-entrySize])
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// EncodeExtendedAttributes encodes a list of EAs into a FILE_FULL_EA_INFORMATION
+// buffer for use with BackupWrite, ZwSetEaFile, etc.
+func EncodeExtendedAttributes(eas []ExtendedAttribute) ([]byte, error) {
+	var buf bytes.Buffer
+	for i := range eas {
+		last := false
+		if i == len(eas)-1 {
+			last = true
+		}
+
+		err := writeEa(&buf, &eas[i], last)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// GetFileEA retrieves the extended attributes of a file. The file must have been opened
+// with FILE_READ_EA access.
+func GetFileEA(f *os.File) ([]ExtendedAttribute, error) {
+	for size := 4096; ; size *= 2 {
+		buf := make([]byte, size)
+		var iosb ioStatusBlock
+		status := ntQueryEaFile(syscall.Handle(f.Fd()), &iosb, &buf[0], uint32(len(buf)), false, nil, 0, nil, true)
+		if status == cSTATUS_NO_EAS_ON_FILE {
+			return nil, nil
+		}
+		if (status == cSTATUS_BUFFER_OVERFLOW || status == cSTATUS_BUFFER_TOO_SMALL) && size < maxEaBufferSize*2 {
+			continue
+		}
+		if err := status.Err(); err != nil {
+			return nil, &os.PathError{Op: "NtQueryEaFile", Path: f.Name(), Err: err}
+		}
+		return DecodeExtendedAttributes(buf[:iosb.Information])
+	}
+}
+
+// SetFileEA sets extended attributes on a file, replacing existing EAs with the same
+// names. An EA with an empty value is removed. The file must have been opened with
+// FILE_WRITE_EA access.
+func SetFileEA(f *os.File, eas []ExtendedAttribute) error {
+	buf, err := EncodeExtendedAttributes(eas)
+	if err != nil {
+		return err
+	}
+	if len(buf) == 0 {
+		return nil
+	}
+	var iosb ioStatusBlock
+	if err := ntSetEaFile(syscall.Handle(f.Fd()), &iosb, &buf[0], uint32(len(buf))).Err(); err != nil {
+		return &os.PathError{Op: "NtSetEaFile", Path: f.Name(), Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+package winio
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+var (
+	testEas = []ExtendedAttribute{
+		{Name: "foo", Value: []byte("bar")},
+		{Name: "fizz", Value: []byte("buzz")},
+	}
+
+	testEasEncoded   = []byte{16, 0, 0, 0, 0, 3, 3, 0, 102, 111, 111, 0, 98, 97, 114, 0, 0, 0, 0, 0, 0, 4, 4, 0, 102, 105, 122, 122, 0, 98, 117, 122, 122, 0, 0, 0}
+	testEasNotPadded = testEasEncoded[0 : len(testEasEncoded)-3]
+	testEasTruncated = testEasEncoded[0:20]
+)
+
+func TestRoundTripEas(t *testing.T) {
+	b, err := EncodeExtendedAttributes(testEas)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(testEasEncoded, b) {
+		t.Fatalf("encoded mismatch %v %v", testEasEncoded, b)
+	}
+	eas, err := DecodeExtendedAttributes(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(testEas, eas) {
+		t.Fatalf("mismatch %+v %+v", testEas, eas)
+	}
+}
+
+func TestEasDontNeedPaddingAtEnd(t *testing.T) {
+	eas, err := DecodeExtendedAttributes(testEasNotPadded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(testEas, eas) {
+		t.Fatalf("mismatch %+v %+v", testEas, eas)
+	}
+}
+
+func TestTruncatedEasFailCorrectly(t *testing.T) {
+	_, err := DecodeExtendedAttributes(testEasTruncated)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestNilEasEncodeAndDecodeAsNil(t *testing.T) {
+	b, err := EncodeExtendedAttributes(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b) != 0 {
+		t.Fatal("expected empty")
+	}
+	eas, err := DecodeExtendedAttributes(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(eas) != 0 {
+		t.Fatal("expected empty")
+	}
+}
+
+func TestSetFileEa(t *testing.T) {
+	f, err := ioutil.TempFile("", "tst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	eas, err := GetFileEA(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(eas) != 0 {
+		t.Fatalf("expected no EAs, got %+v", eas)
+	}
+
+	// NTFS stores EA names in upper case.
+	want := []ExtendedAttribute{
+		{Name: "FOO", Value: []byte("bar")},
+		{Name: "FIZZ", Value: []byte("buzz")},
+	}
+	if err = SetFileEA(f, want); err != nil {
+		t.Fatal(err)
+	}
+	eas, err = GetFileEA(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(eas, want) {
+		t.Fatalf("got %+v, expected %+v", eas, want)
+	}
+
+	if err = SetFileEA(f, []ExtendedAttribute{{Name: "FOO"}}); err != nil {
+		t.Fatal(err)
+	}
+	eas, err = GetFileEA(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(eas, want[1:]) {
+		t.Fatalf("got %+v, expected %+v", eas, want[1:])
+	}
+}
+
+func TestLxEas(t *testing.T) {
+	ea := LxModeEA(0100644)
+	mode, err := DecodeLxUint32EA(&ea)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ea.Name != "$LXMOD" || mode != 0100644 {
+		t.Fatalf("unexpected mode EA %+v", ea)
+	}
+
+	ea = LxDevEA(8, 1)
+	major, minor, err := DecodeLxDevEA(&ea)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if major != 8 || minor != 1 {
+		t.Fatalf("unexpected device %d %d", major, minor)
+	}
+
+	attrb := LxAttrb{Version: 1, Mode: 040755, UID: 1000, GID: 1000, ModifyTime: 1500000000, ModifyTimeNsec: 5}
+	ea = attrb.EA()
+	if len(ea.Value) != 56 {
+		t.Fatalf("unexpected LXATTRB size %d", len(ea.Value))
+	}
+	decoded, err := DecodeLxAttrb(&ea)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&attrb, decoded) {
+		t.Fatalf("mismatch %+v %+v", attrb, decoded)
+	}
+}
+
+func TestLxSecurityEa(t *testing.T) {
+	capability := LxCapability{Flags: LxCapEffective, Permitted: 1 << 10}
+	ea, err := LxSecurityEA(LxCapabilityXattr, capability.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ea.Name != "LX.SECURITY.CAPABILITY" {
+		t.Fatalf("unexpected name %s", ea.Name)
+	}
+	name, value, ok := LxSecurityXattr(&ea)
+	if !ok || name != LxCapabilityXattr {
+		t.Fatalf("unexpected xattr %s", name)
+	}
+	decoded, err := DecodeLxCapability(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&capability, decoded) {
+		t.Fatalf("mismatch %+v %+v", capability, decoded)
+	}
+
+	if _, err = LxSecurityEA("user.foo", nil); err == nil {
+		t.Fatal("expected error")
+	}
+}
@@ -0,0 +1,80 @@
+package winio
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+)
+
+//sys rtlNtStatusToDosError(status ntstatus) (winerr error) = ntdll.RtlNtStatusToDosErrorNoTeb
+
+const cERROR_PRIVILEGE_NOT_HELD = syscall.Errno(1314)
+
+// Errors for conditions that callers commonly need to detect. The errors returned by
+// this package hold the syscall.Errno they were caused by, often in an *os.PathError,
+// so these can be matched with errors.Is rather than by comparing error text. An
+// NTStatus matches the Win32 error it converts to.
+var (
+	// ErrAccessDenied is ERROR_ACCESS_DENIED.
+	ErrAccessDenied error = syscall.ERROR_ACCESS_DENIED
+	// ErrPipeBusy is ERROR_PIPE_BUSY, returned when every instance of a named pipe
+	// is in use. DialPipe retries busy pipes until its timeout, and then returns
+	// ErrTimeout.
+	ErrPipeBusy error = cERROR_PIPE_BUSY
+	// ErrBrokenPipe is ERROR_BROKEN_PIPE. Writes to a pipe whose other end has been
+	// closed fail with ERROR_BROKEN_PIPE, ERROR_NO_DATA, or ERROR_PIPE_NOT_CONNECTED,
+	// depending on the state of the pipe; use IsBrokenPipe to match all three.
+	ErrBrokenPipe error = syscall.ERROR_BROKEN_PIPE
+	// ErrPrivilegeNotHeld is ERROR_PRIVILEGE_NOT_HELD. A *PrivilegeError also matches
+	// it.
+	ErrPrivilegeNotHeld error = cERROR_PRIVILEGE_NOT_HELD
+)
+
+// NTStatus is an NTSTATUS value, the status code returned by native APIs and found in
+// I/O status blocks. Negative values are errors.
+type NTStatus int32
+
+type ntstatus = NTStatus
+
+// Err returns nil if status is a success or informational status, and otherwise the
+// Win32 error it converts to.
+func (status NTStatus) Err() error {
+	if status >= 0 {
+		return nil
+	}
+	return rtlNtStatusToDosError(status)
+}
+
+// Errno returns the Win32 error that status converts to, as Win32 functions that call
+// native APIs do. Statuses without a Win32 equivalent convert to
+// ERROR_MR_MID_NOT_FOUND (317).
+func (status NTStatus) Errno() syscall.Errno {
+	e, _ := rtlNtStatusToDosError(status).(syscall.Errno)
+	return e
+}
+
+func (status NTStatus) Error() string {
+	return fmt.Sprintf("NTSTATUS 0x%08x: %s", uint32(status), status.Errno().Error())
+}
+
+// Unwrap returns the Win32 error that status converts to, so that
+// errors.Is(status, ErrAccessDenied) and errors.Is(status, os.ErrNotExist) work as
+// they do for the equivalent syscall.Errno.
+func (status NTStatus) Unwrap() error {
+	if e := status.Errno(); e != 0 {
+		return e
+	}
+	return nil
+}
+
+// IsBrokenPipe reports whether err is one of the errors that reads and writes fail
+// with once the other end of a pipe has been closed: ERROR_BROKEN_PIPE, ERROR_NO_DATA,
+// or ERROR_PIPE_NOT_CONNECTED.
+func IsBrokenPipe(err error) bool {
+	return errors.Is(err, ErrBrokenPipe) || errors.Is(err, cERROR_NO_DATA) || errors.Is(err, cERROR_PIPE_NOT_CONNECTED)
+}
+
+// Is reports whether target is ErrPrivilegeNotHeld.
+func (e *PrivilegeError) Is(target error) bool {
+	return target == ErrPrivilegeNotHeld
+}
@@ -0,0 +1,54 @@
+package winio
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestNTStatus(t *testing.T) {
+	const (
+		statusAccessDenied       = NTStatus(-0x3fffffde) // 0xC0000022
+		statusObjectNameNotFound = NTStatus(-0x3fffffcc) // 0xC0000034
+		statusPrivilegeNotHeld   = NTStatus(-0x3fffff9f) // 0xC0000061
+		statusObjectNameExists   = NTStatus(0x40000000)
+	)
+	if err := NTStatus(0).Err(); err != nil {
+		t.Fatalf("expected nil error for success, got %v", err)
+	}
+	if err := statusObjectNameExists.Err(); err != nil {
+		t.Fatalf("expected nil error for informational status, got %v", err)
+	}
+	if e := statusAccessDenied.Errno(); e != ErrAccessDenied {
+		t.Fatalf("expected ERROR_ACCESS_DENIED, got %d", e)
+	}
+	if !errors.Is(statusAccessDenied, ErrAccessDenied) || errors.Is(statusAccessDenied, ErrPipeBusy) {
+		t.Fatal("access denied status did not match its Win32 error")
+	}
+	if !errors.Is(&os.PathError{Op: "open", Path: "x", Err: statusObjectNameNotFound}, os.ErrNotExist) {
+		t.Fatal("object name not found status did not match os.ErrNotExist")
+	}
+	if !errors.Is(statusPrivilegeNotHeld, ErrPrivilegeNotHeld) {
+		t.Fatal("privilege status did not match ErrPrivilegeNotHeld")
+	}
+	if s := statusAccessDenied.Error(); s[:len("NTSTATUS 0xc0000022: ")] != "NTSTATUS 0xc0000022: " {
+		t.Fatalf("unexpected message %q", s)
+	}
+}
+
+func TestErrorConditions(t *testing.T) {
+	if !errors.Is(&os.PathError{Op: "open", Path: testPipeName, Err: cERROR_PIPE_BUSY}, ErrPipeBusy) {
+		t.Fatal("ERROR_PIPE_BUSY did not match ErrPipeBusy")
+	}
+	for _, e := range []error{ErrBrokenPipe, cERROR_NO_DATA, cERROR_PIPE_NOT_CONNECTED} {
+		if !IsBrokenPipe(&os.PathError{Op: "write", Path: testPipeName, Err: e}) {
+			t.Fatalf("%v is not a broken pipe error", e)
+		}
+	}
+	if IsBrokenPipe(ErrAccessDenied) || IsBrokenPipe(nil) {
+		t.Fatal("unexpected broken pipe error")
+	}
+	if !errors.Is(&PrivilegeError{}, ErrPrivilegeNotHeld) || errors.Is(&PrivilegeError{}, ErrAccessDenied) {
+		t.Fatal("PrivilegeError did not match only ErrPrivilegeNotHeld")
+	}
+}
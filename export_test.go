@@ -0,0 +1,5 @@
+package winio
+
+// CurrentUserSid is exported for the integration tests, which are in package winio_test
+// so that they can import the packages built on this one.
+var CurrentUserSid = currentUserSid
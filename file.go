@@ -3,6 +3,7 @@ package winio
 import (
 	"errors"
 	"io"
+	"os"
 	"runtime"
 	"sync"
 	"syscall"
@@ -44,6 +45,19 @@ type ioResult struct {
 type ioOperation struct {
 	o  syscall.Overlapped
 	ch chan ioResult
+	// timer implements the deadline of the operation. It is kept with the
+	// operation so that it can be reused, and is stopped and drained between uses.
+	timer *time.Timer
+}
+
+// ioOperations holds completed operations for reuse, so that the common case of an
+// IO that completes synchronously does not allocate.
+var ioOperations = sync.Pool{
+	New: func() interface{} {
+		// The channel is buffered so that the completion processor never blocks
+		// on an operation whose issuer has not started waiting yet.
+		return &ioOperation{ch: make(chan ioResult, 1)}
+	},
 }
 
 func initIo() {
@@ -63,6 +77,14 @@ type win32File struct {
 	closing       bool
 	readDeadline  time.Time
 	writeDeadline time.Time
+
+	// seekable is set for files, as opposed to pipes, whose reads and writes must
+	// specify the position in the file to access.
+	seekable bool
+	offset   int64
+
+	// socket is set for Winsock sockets, which must be released with closesocket.
+	socket bool
 }
 
 // makeWin32File makes a new win32File from an existing file handle
@@ -85,6 +107,54 @@ func MakeOpenFile(h syscall.Handle) (io.ReadWriteCloser, error) {
 	return makeWin32File(h)
 }
 
+// FileConfig contains options for OpenFile.
+type FileConfig struct {
+	// WriteThrough opens the file with FILE_FLAG_WRITE_THROUGH, so that writes do
+	// not complete until the data has been written to the storage device rather
+	// than to the system cache.
+	WriteThrough bool
+
+	// BackupSemantics opens the file with FILE_FLAG_BACKUP_SEMANTICS and
+	// FILE_FLAG_OPEN_REPARSE_POINT, like OpenForBackup, so that directories and
+	// reparse points themselves can be opened, and access checks are skipped if the
+	// backup or restore privileges have been enabled.
+	BackupSemantics bool
+}
+
+// OpenFile opens or creates the file at path for overlapped IO, so reads and writes do
+// not block an OS thread; they proceed sequentially from the start of the file, and
+// must not be issued concurrently. access, share and createmode are passed to
+// CreateFile. c may be nil.
+func OpenFile(path string, access uint32, share uint32, createmode uint32, c *FileConfig) (io.ReadWriteCloser, error) {
+	if c == nil {
+		c = &FileConfig{}
+	}
+	var flags uint32 = syscall.FILE_FLAG_OVERLAPPED
+	if c.WriteThrough {
+		flags |= cFILE_FLAG_WRITE_THROUGH
+	}
+	if c.BackupSemantics {
+		flags |= syscall.FILE_FLAG_BACKUP_SEMANTICS | syscall.FILE_FLAG_OPEN_REPARSE_POINT
+	}
+	h, err := createFile(path, access, share, nil, createmode, flags, 0)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: path, Err: err}
+	}
+	f, err := makeWin32File(h)
+	if err != nil {
+		syscall.Close(h)
+		return nil, err
+	}
+	f.seekable = true
+	return f, nil
+}
+
+// Flusher is implemented by the files and pipes returned by this package.
+type Flusher interface {
+	// Flush waits until the data written so far has left the system's buffers.
+	Flush() error
+}
+
 // closeHandle closes the resources associated with a Win32 handle
 func (f *win32File) closeHandle() {
 	if !f.closing {
@@ -93,7 +163,11 @@ func (f *win32File) closeHandle() {
 		cancelIoEx(f.handle, nil)
 		f.wg.Wait()
 		// at this point, no new IO can start
-		syscall.Close(f.handle)
+		if f.socket {
+			syscall.Closesocket(f.handle)
+		} else {
+			syscall.Close(f.handle)
+		}
 		f.handle = 0
 	}
 }
@@ -111,8 +185,8 @@ func (f *win32File) prepareIo() (*ioOperation, error) {
 	if f.closing {
 		return nil, ErrFileClosed
 	}
-	c := &ioOperation{}
-	c.ch = make(chan ioResult)
+	c := ioOperations.Get().(*ioOperation)
+	c.o = syscall.Overlapped{}
 	return c, nil
 }
 
@@ -137,6 +211,12 @@ func ioCompletionProcessor(h syscall.Handle) {
 func (f *win32File) asyncIo(c *ioOperation, deadline time.Time, bytes uint32, err error) (int, error) {
 	if err != syscall.ERROR_IO_PENDING {
 		f.wg.Done()
+		if err == nil {
+			// No completion packet is queued for an IO that succeeds synchronously,
+			// so the operation can be reused. Some failures, such as ERROR_MORE_DATA,
+			// still queue a packet, so the operation is not reused after them.
+			ioOperations.Put(c)
+		}
 		return int(bytes), err
 	} else {
 		var r ioResult
@@ -149,11 +229,22 @@ func (f *win32File) asyncIo(c *ioOperation, deadline time.Time, bytes uint32, er
 			if !deadline.After(now) {
 				timedout = true
 			} else {
-				timeout := time.After(deadline.Sub(now))
+				if c.timer == nil {
+					c.timer = time.NewTimer(deadline.Sub(now))
+				} else {
+					c.timer.Reset(deadline.Sub(now))
+				}
 				select {
 				case r = <-c.ch:
 					wait = false
-				case <-timeout:
+					if !c.timer.Stop() {
+						// Drain the timer if it fired while the result arrived.
+						select {
+						case <-c.timer.C:
+						default:
+						}
+					}
+				case <-c.timer.C:
 					timedout = true
 				}
 			}
@@ -173,6 +264,7 @@ func (f *win32File) asyncIo(c *ioOperation, deadline time.Time, bytes uint32, er
 			}
 		}
 		f.wg.Done()
+		ioOperations.Put(c)
 		return int(r.bytes), err
 	}
 }
@@ -183,14 +275,16 @@ func (f *win32File) Read(b []byte) (int, error) {
 	if err != nil {
 		return 0, err
 	}
+	f.setOffset(c)
 	var bytes uint32
 	err = syscall.ReadFile(f.handle, b, &bytes, &c.o)
 	n, err := f.asyncIo(c, f.readDeadline, bytes, err)
+	f.offset += int64(n)
 
 	// Handle EOF conditions.
 	if err == nil && n == 0 && len(b) != 0 {
 		return 0, io.EOF
-	} else if err == syscall.ERROR_BROKEN_PIPE {
+	} else if err == syscall.ERROR_BROKEN_PIPE || err == syscall.ERROR_HANDLE_EOF {
 		return 0, io.EOF
 	} else {
 		return n, err
@@ -203,9 +297,36 @@ func (f *win32File) Write(b []byte) (int, error) {
 	if err != nil {
 		return 0, err
 	}
+	f.setOffset(c)
 	var bytes uint32
 	err = syscall.WriteFile(f.handle, b, &bytes, &c.o)
-	return f.asyncIo(c, f.writeDeadline, bytes, err)
+	n, err := f.asyncIo(c, f.writeDeadline, bytes, err)
+	f.offset += int64(n)
+	return n, err
+}
+
+// Flush calls FlushFileBuffers, which for a file writes any cached data to the storage
+// device. For a pipe, it waits until the other end has read all the data written to
+// it, so a Close that races with it also waits.
+func (f *win32File) Flush() error {
+	f.wg.Add(1)
+	defer f.wg.Done()
+	if f.closing {
+		return ErrFileClosed
+	}
+	err := syscall.FlushFileBuffers(f.handle)
+	if err != nil {
+		return os.NewSyscallError("FlushFileBuffers", err)
+	}
+	return nil
+}
+
+// setOffset sets the file position of an IO operation on a seekable file.
+func (f *win32File) setOffset(c *ioOperation) {
+	if f.seekable {
+		c.o.Offset = uint32(f.offset)
+		c.o.OffsetHigh = uint32(f.offset >> 32)
+	}
 }
 
 func (f *win32File) SetReadDeadline(t time.Time) error {
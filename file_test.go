@@ -0,0 +1,44 @@
+package winio
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestOpenFileWriteThrough(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "file")
+	f, err := OpenFile(path, syscall.GENERIC_READ|syscall.GENERIC_WRITE, syscall.FILE_SHARE_READ, syscall.CREATE_NEW, &FileConfig{WriteThrough: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err = f.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if err = f.(Flusher).Flush(); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "hello" {
+		t.Fatalf("unexpected data %q", b)
+	}
+
+	if _, err = OpenFile(path, syscall.GENERIC_READ, 0, syscall.CREATE_NEW, nil); !os.IsExist(err) {
+		t.Fatalf("expected an exists error, got %v", err)
+	}
+	f.Close()
+	if err = f.(Flusher).Flush(); err != ErrFileClosed {
+		t.Fatalf("expected ErrFileClosed, got %v", err)
+	}
+}
@@ -1,17 +1,38 @@
 package winio
 
 import (
+	"encoding/binary"
 	"os"
 	"syscall"
+	"unicode/utf16"
 	"unsafe"
+
+	"github.com/Microsoft/go-winio/pkg/fs"
 )
 
 //sys getFileInformationByHandleEx(h syscall.Handle, class uint32, buffer *byte, size uint32) (err error) = GetFileInformationByHandleEx
 //sys setFileInformationByHandle(h syscall.Handle, class uint32, buffer *byte, size uint32) (err error) = SetFileInformationByHandle
 
 const (
-	fileBasicInfo = 0
-	fileIDInfo    = 0x12
+	fileBasicInfo         = 0
+	fileStandardInfo      = 1
+	fileRenameInfo        = 3
+	fileDispositionInfo   = 4
+	fileAttributeTagInfo  = 9
+	fileFullDirectoryInfo = 0xe
+	fileIDInfo            = 0x12
+	fileDispositionInfoEx = 0x15
+
+	cFILE_DISPOSITION_FLAG_DELETE                    = 0x1
+	cFILE_DISPOSITION_FLAG_POSIX_SEMANTICS           = 0x2
+	cFILE_DISPOSITION_FLAG_IGNORE_READONLY_ATTRIBUTE = 0x10
+
+	cDELETE = 0x10000
+
+	cFILE_READ_ATTRIBUTES  = 0x80
+	cFILE_WRITE_ATTRIBUTES = 0x100
+
+	cERROR_NOT_SUPPORTED = syscall.Errno(50)
 )
 
 // FileBasicInfo contains file access time and file attributes information.
@@ -20,21 +41,104 @@ type FileBasicInfo struct {
 	FileAttributes                                          uintptr // includes padding
 }
 
+// getFileInfo queries the information class class of f into the structure at p.
+func getFileInfo(f *os.File, class uint32, p unsafe.Pointer, size uintptr) error {
+	if err := getFileInformationByHandleEx(syscall.Handle(f.Fd()), class, (*byte)(p), uint32(size)); err != nil {
+		return &os.PathError{Op: "GetFileInformationByHandleEx", Path: f.Name(), Err: err}
+	}
+	return nil
+}
+
+// setFileInfo sets the information class class of f from the structure at p.
+func setFileInfo(f *os.File, class uint32, p unsafe.Pointer, size uintptr) error {
+	if err := setFileInformationByHandle(syscall.Handle(f.Fd()), class, (*byte)(p), uint32(size)); err != nil {
+		return &os.PathError{Op: "SetFileInformationByHandle", Path: f.Name(), Err: err}
+	}
+	return nil
+}
+
 // GetFileBasicInfo retrieves times and attributes for a file.
 func GetFileBasicInfo(f *os.File) (*FileBasicInfo, error) {
 	bi := &FileBasicInfo{}
-	if err := getFileInformationByHandleEx(syscall.Handle(f.Fd()), fileBasicInfo, (*byte)(unsafe.Pointer(bi)), uint32(unsafe.Sizeof(*bi))); err != nil {
-		return nil, &os.PathError{Op: "GetFileInformationByHandleEx", Path: f.Name(), Err: err}
+	if err := getFileInfo(f, fileBasicInfo, unsafe.Pointer(bi), unsafe.Sizeof(*bi)); err != nil {
+		return nil, err
 	}
 	return bi, nil
 }
 
 // SetFileBasicInfo sets times and attributes for a file.
 func SetFileBasicInfo(f *os.File, bi *FileBasicInfo) error {
-	if err := setFileInformationByHandle(syscall.Handle(f.Fd()), fileBasicInfo, (*byte)(unsafe.Pointer(bi)), uint32(unsafe.Sizeof(*bi))); err != nil {
-		return &os.PathError{Op: "SetFileInformationByHandle", Path: f.Name(), Err: err}
+	return setFileInfo(f, fileBasicInfo, unsafe.Pointer(bi), unsafe.Sizeof(*bi))
+}
+
+// FileStandardInfo contains the size, link count, and deletion state of a file.
+type FileStandardInfo struct {
+	AllocationSize, EndOfFile int64
+	NumberOfLinks             uint32
+	DeletePending, Directory  bool
+}
+
+// GetFileStandardInfo retrieves the size, link count, and deletion state of a file.
+func GetFileStandardInfo(f *os.File) (*FileStandardInfo, error) {
+	si := &FileStandardInfo{}
+	if err := getFileInfo(f, fileStandardInfo, unsafe.Pointer(si), unsafe.Sizeof(*si)); err != nil {
+		return nil, err
 	}
-	return nil
+	return si, nil
+}
+
+// FileAttributeTagInfo contains the attributes of a file and, if it is a reparse point,
+// its reparse tag.
+type FileAttributeTagInfo struct {
+	FileAttributes uint32
+	ReparseTag     uint32
+}
+
+// GetFileAttributeTagInfo retrieves the attributes and reparse tag of a file. This is the
+// cheapest way to tell whether a file opened with FILE_FLAG_OPEN_REPARSE_POINT is a
+// symbolic link, a mount point, or some other kind of reparse point.
+func GetFileAttributeTagInfo(f *os.File) (*FileAttributeTagInfo, error) {
+	ti := &FileAttributeTagInfo{}
+	if err := getFileInfo(f, fileAttributeTagInfo, unsafe.Pointer(ti), unsafe.Sizeof(*ti)); err != nil {
+		return nil, err
+	}
+	return ti, nil
+}
+
+// fileNameInformation is the fixed part of FILE_RENAME_INFO and FILE_LINK_INFORMATION,
+// which is followed by a file name.
+type fileNameInformation struct {
+	Flags          uint32
+	RootDirectory  syscall.Handle
+	FileNameLength uint32
+}
+
+// makeFileNameInformation returns a FILE_RENAME_INFO or FILE_LINK_INFORMATION buffer.
+func makeFileNameInformation(flags uint32, name string) []byte {
+	name16 := utf16.Encode([]rune(name))
+	// FileName immediately follows FileNameLength, ignoring any trailing padding.
+	nameOffset := int(unsafe.Offsetof(fileNameInformation{}.FileNameLength) + 4)
+	buf := make([]byte, nameOffset+(len(name16)+1)*2)
+	info := (*fileNameInformation)(unsafe.Pointer(&buf[0]))
+	info.Flags = flags
+	info.FileNameLength = uint32(len(name16) * 2)
+	for i, c := range name16 {
+		binary.LittleEndian.PutUint16(buf[nameOffset+i*2:], c)
+	}
+	return buf
+}
+
+// RenameFileByHandle renames the file opened as f, which must have been opened with
+// DELETE access. newName is either a full path on the same volume, or a bare name, in
+// which case the file is renamed within its directory. If replaceIfExists is true, an
+// existing file at newName is replaced.
+func RenameFileByHandle(f *os.File, newName string, replaceIfExists bool) error {
+	var flags uint32
+	if replaceIfExists {
+		flags = 1
+	}
+	buf := makeFileNameInformation(flags, newName)
+	return setFileInfo(f, fileRenameInfo, unsafe.Pointer(&buf[0]), uintptr(len(buf)))
 }
 
 // FileIDInfo contains the volume serial number and file ID for a file. This pair should be
@@ -47,8 +151,118 @@ type FileIDInfo struct {
 // GetFileID retrieves the unique (volume, file ID) pair for a file.
 func GetFileID(f *os.File) (*FileIDInfo, error) {
 	fileID := &FileIDInfo{}
-	if err := getFileInformationByHandleEx(syscall.Handle(f.Fd()), fileIDInfo, (*byte)(unsafe.Pointer(fileID)), uint32(unsafe.Sizeof(*fileID))); err != nil {
-		return nil, &os.PathError{Op: "GetFileInformationByHandleEx", Path: f.Name(), Err: err}
+	if err := getFileInfo(f, fileIDInfo, unsafe.Pointer(fileID), unsafe.Sizeof(*fileID)); err != nil {
+		return nil, err
 	}
 	return fileID, nil
 }
+
+// SetCaseSensitivity sets whether file names in the directory at path are case
+// sensitive. Changing case sensitivity requires permission to write the attributes of
+// the directory as well as to add and delete its entries; if the directory cannot be
+// opened with the caller's own access, SetCaseSensitivity tries again with the backup and
+// restore privileges enabled. To change the case sensitivity of a directory that is
+// already open, use fs.SetFileCaseSensitivity.
+func SetCaseSensitivity(path string, enable bool) error {
+	set := func() error {
+		f, err := OpenForBackup(path, cFILE_READ_ATTRIBUTES|cFILE_WRITE_ATTRIBUTES, syscall.FILE_SHARE_READ|syscall.FILE_SHARE_WRITE|syscall.FILE_SHARE_DELETE, syscall.OPEN_EXISTING)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return fs.SetFileCaseSensitivity(f, enable)
+	}
+	err := set()
+	if perr, ok := err.(*os.PathError); ok && perr.Err == syscall.ERROR_ACCESS_DENIED {
+		err2 := RunWithPrivileges([]string{SeBackupPrivilege, SeRestorePrivilege}, set)
+		if _, ok := err2.(*PrivilegeError); !ok {
+			err = err2
+		}
+	}
+	return err
+}
+
+// PosixDelete marks a file for deletion with POSIX semantics: its name is removed from
+// its directory as soon as f is closed, even if other handles to the file remain open,
+// and it is deleted even if it is read-only. The file must have been opened with DELETE
+// access, and also FILE_WRITE_ATTRIBUTES access to delete read-only files.
+//
+// On versions of Windows before 10 1709, which do not support POSIX semantics, the file
+// is marked for deletion in the classic way instead, after clearing its read-only
+// attribute; its name then remains until the last handle to it is closed.
+func PosixDelete(f *os.File) error {
+	flags := uint32(cFILE_DISPOSITION_FLAG_DELETE | cFILE_DISPOSITION_FLAG_POSIX_SEMANTICS | cFILE_DISPOSITION_FLAG_IGNORE_READONLY_ATTRIBUTE)
+	err := setFileInformationByHandle(syscall.Handle(f.Fd()), fileDispositionInfoEx, (*byte)(unsafe.Pointer(&flags)), uint32(unsafe.Sizeof(flags)))
+	if err == cERROR_INVALID_PARAMETER || err == cERROR_NOT_SUPPORTED {
+		return classicDelete(f)
+	}
+	if err != nil {
+		return &os.PathError{Op: "SetFileInformationByHandle", Path: f.Name(), Err: err}
+	}
+	return nil
+}
+
+func classicDelete(f *os.File) error {
+	bi, err := GetFileBasicInfo(f)
+	if err != nil {
+		return err
+	}
+	if bi.FileAttributes&syscall.FILE_ATTRIBUTE_READONLY != 0 {
+		bi.FileAttributes &^= syscall.FILE_ATTRIBUTE_READONLY
+		if bi.FileAttributes == 0 {
+			bi.FileAttributes = syscall.FILE_ATTRIBUTE_NORMAL
+		}
+		err = SetFileBasicInfo(f, bi)
+		if err != nil {
+			return err
+		}
+	}
+	deleteFile := uint32(1)
+	return setFileInfo(f, fileDispositionInfo, unsafe.Pointer(&deleteFile), unsafe.Sizeof(deleteFile))
+}
+
+// PosixRemove removes the file or empty directory at path with POSIX semantics, as
+// described for PosixDelete. Unlike os.Remove, it succeeds for files that are still
+// open elsewhere with FILE_SHARE_DELETE sharing, and for read-only files.
+func PosixRemove(path string) error {
+	f, err := OpenForBackup(path, cDELETE|cFILE_READ_ATTRIBUTES|cFILE_WRITE_ATTRIBUTES, syscall.FILE_SHARE_READ|syscall.FILE_SHARE_WRITE|syscall.FILE_SHARE_DELETE, syscall.OPEN_EXISTING)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return PosixDelete(f)
+}
+
+// readDirNames returns the names of the entries in the directory opened as f, excluding
+// "." and "..". Unlike os.File.Readdirnames, this enumerates the directory through its
+// handle, so it works for directories opened with OpenForBackup.
+func readDirNames(f *os.File) ([]string, error) {
+	var names []string
+	buf := make([]byte, 64*1024)
+	for {
+		err := getFileInformationByHandleEx(syscall.Handle(f.Fd()), fileFullDirectoryInfo, &buf[0], uint32(len(buf)))
+		if err == syscall.ERROR_NO_MORE_FILES {
+			return names, nil
+		}
+		if err != nil {
+			return nil, &os.PathError{Op: "GetFileInformationByHandleEx", Path: f.Name(), Err: err}
+		}
+		// Walk the FILE_FULL_DIR_INFO entries in the buffer.
+		for b := buf; ; {
+			next := binary.LittleEndian.Uint32(b[0:4])
+			nameLength := binary.LittleEndian.Uint32(b[60:64])
+			name16 := make([]uint16, nameLength/2)
+			for i := range name16 {
+				name16[i] = binary.LittleEndian.Uint16(b[68+i*2:])
+			}
+			name := string(utf16.Decode(name16))
+			if name != "." && name != ".." {
+				names = append(names, name)
+			}
+			if next == 0 {
+				break
+			}
+			b = b[next:]
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package winio
+
+import (
+	"io/ioutil"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/Microsoft/go-winio/pkg/fs"
+)
+
+func TestSetCaseSensitivity(t *testing.T) {
+	d, err := ioutil.TempDir("", "casetest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(d)
+
+	err = SetCaseSensitivity(d, true)
+	// Older builds and systems without WSL do not support case sensitive directories.
+	if perr, ok := err.(*os.PathError); ok && (perr.Err == cERROR_INVALID_PARAMETER || perr.Err == cERROR_NOT_SUPPORTED) {
+		t.Skip("case sensitive directories are not supported: ", err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := OpenForBackup(d, cFILE_READ_ATTRIBUTES, syscall.FILE_SHARE_READ|syscall.FILE_SHARE_WRITE, syscall.OPEN_EXISTING)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	enabled, err := fs.GetFileCaseSensitivity(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !enabled {
+		t.Fatal("case sensitivity was not enabled")
+	}
+
+	err = SetCaseSensitivity(d, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enabled, err = fs.GetFileCaseSensitivity(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if enabled {
+		t.Fatal("case sensitivity was not disabled")
+	}
+}
+
+func TestPosixRemove(t *testing.T) {
+	d, err := ioutil.TempDir("", "posixdelete")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(d)
+
+	name := d + `\readonly.txt`
+	err = ioutil.WriteFile(name, []byte("data"), 0444)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Keep the file open, as a virus scanner or indexer might.
+	f, err := OpenForBackup(name, syscall.GENERIC_READ, syscall.FILE_SHARE_READ|syscall.FILE_SHARE_WRITE|syscall.FILE_SHARE_DELETE, syscall.OPEN_EXISTING)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = PosixRemove(name)
+	if err != nil {
+		f.Close()
+		t.Fatal(err)
+	}
+	f.Close()
+	if _, err = os.Stat(name); !os.IsNotExist(err) {
+		t.Fatalf("expected file to be removed, got %v", err)
+	}
+}
+
+func TestFileStandardAndAttributeTagInfo(t *testing.T) {
+	f, err := ioutil.TempFile("", "fileinfo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	_, err = f.Write([]byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	si, err := GetFileStandardInfo(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if si.EndOfFile != 5 || si.NumberOfLinks != 1 || si.Directory || si.DeletePending {
+		t.Fatalf("unexpected standard info %+v", si)
+	}
+
+	ti, err := GetFileAttributeTagInfo(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ti.FileAttributes&syscall.FILE_ATTRIBUTE_DIRECTORY != 0 || ti.ReparseTag != 0 {
+		t.Fatalf("unexpected attribute tag info %+v", ti)
+	}
+}
+
+func TestRenameFileByHandle(t *testing.T) {
+	d, err := ioutil.TempDir("", "rename")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(d)
+
+	err = ioutil.WriteFile(d+`\old.txt`, []byte("data"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(d+`\new.txt`, []byte("replaced"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := OpenForBackup(d+`\old.txt`, cDELETE, syscall.FILE_SHARE_READ, syscall.OPEN_EXISTING)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if err = RenameFileByHandle(f, d+`\new.txt`, false); err == nil {
+		t.Fatal("expected rename over an existing file to fail")
+	}
+	err = RenameFileByHandle(f, d+`\new.txt`, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(d + `\new.txt`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "data" {
+		t.Fatalf("unexpected contents %q", b)
+	}
+}
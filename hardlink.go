@@ -0,0 +1,111 @@
+package winio
+
+import (
+	"os"
+	"syscall"
+
+	"github.com/Microsoft/go-winio/pkg/fs"
+)
+
+//sys ntSetInformationFile(handle syscall.Handle, iosb *ioStatusBlock, info *byte, length uint32, class uint32) (status ntstatus) = ntdll.NtSetInformationFile
+//sys findFirstFileName(name string, flags uint32, length *uint32, buffer *uint16) (h syscall.Handle, err error) [failretval==syscall.InvalidHandle] = FindFirstFileNameW
+//sys findNextFileName(h syscall.Handle, length *uint32, buffer *uint16) (err error) = FindNextFileNameW
+
+const (
+	fileLinkInformation   = 11
+	fileLinkInformationEx = 72
+
+	cFILE_LINK_REPLACE_IF_EXISTS = 0x1
+	cFILE_LINK_POSIX_SEMANTICS   = 0x2
+
+	cSTATUS_INVALID_INFO_CLASS = ntstatus(-0x3ffffffd) // 0xC0000003
+	cSTATUS_INVALID_PARAMETER  = ntstatus(-0x3ffffff3) // 0xC000000D
+	cSTATUS_NOT_SUPPORTED      = ntstatus(-0x3fffff45) // 0xC00000BB
+
+	cERROR_HANDLE_EOF = syscall.Errno(38)
+	cERROR_MORE_DATA  = syscall.Errno(234)
+)
+
+// LinkFileByHandle creates a hard link named newName to the file opened as f. f can be
+// opened with OpenForBackup, so that linking files the caller cannot otherwise open
+// only requires the backup privilege. If replaceIfExists is true, an existing file at
+// newName is replaced; on Windows 10 1809 and later it is replaced with POSIX
+// semantics, so that this succeeds even if that file is open.
+func LinkFileByHandle(f *os.File, newName string, replaceIfExists bool) error {
+	name, err := fs.NTPathFromDosPath(newName)
+	if err != nil {
+		return &os.PathError{Op: "link", Path: newName, Err: err}
+	}
+	var flags uint32
+	if replaceIfExists {
+		flags = cFILE_LINK_REPLACE_IF_EXISTS
+	}
+	buf := makeFileNameInformation(flags|cFILE_LINK_POSIX_SEMANTICS, name)
+	var iosb ioStatusBlock
+	status := ntSetInformationFile(syscall.Handle(f.Fd()), &iosb, &buf[0], uint32(len(buf)), fileLinkInformationEx)
+	if status == cSTATUS_INVALID_INFO_CLASS || status == cSTATUS_INVALID_PARAMETER || status == cSTATUS_NOT_SUPPORTED {
+		// Older versions of Windows do not support FileLinkInformationEx, which has
+		// the same layout but takes flags instead of a BOOLEAN.
+		buf = makeFileNameInformation(flags, name)
+		status = ntSetInformationFile(syscall.Handle(f.Fd()), &iosb, &buf[0], uint32(len(buf)), fileLinkInformation)
+	}
+	if err := status.Err(); err != nil {
+		return &os.PathError{Op: "NtSetInformationFile", Path: newName, Err: err}
+	}
+	return nil
+}
+
+// CreateHardLink creates newName as a hard link to the file oldName, using backup
+// semantics to open oldName. See LinkFileByHandle.
+func CreateHardLink(oldName, newName string, replaceIfExists bool) error {
+	f, err := OpenForBackup(oldName, cFILE_WRITE_ATTRIBUTES, syscall.FILE_SHARE_READ|syscall.FILE_SHARE_WRITE|syscall.FILE_SHARE_DELETE, syscall.OPEN_EXISTING)
+	if err == nil {
+		err = LinkFileByHandle(f, newName, replaceIfExists)
+		f.Close()
+	}
+	if err != nil {
+		if perr, ok := err.(*os.PathError); ok {
+			err = perr.Err
+		}
+		return &os.LinkError{Op: "link", Old: oldName, New: newName, Err: err}
+	}
+	return nil
+}
+
+// GetFileLinks returns the names of all the hard links to the file at path. The names are
+// relative to the root of the file's volume, such as \dir\file.txt.
+func GetFileLinks(path string) ([]string, error) {
+	buf := make([]uint16, syscall.MAX_PATH)
+	var (
+		h     syscall.Handle
+		err   error
+		names []string
+	)
+	for {
+		length := uint32(len(buf))
+		if h == 0 {
+			h, err = findFirstFileName(path, 0, &length, &buf[0])
+			if err != nil {
+				h = 0
+			}
+		} else {
+			err = findNextFileName(h, &length, &buf[0])
+		}
+		if err == cERROR_MORE_DATA {
+			buf = make([]uint16, length)
+			continue
+		}
+		if err == cERROR_HANDLE_EOF {
+			break
+		}
+		if err != nil {
+			if h != 0 {
+				syscall.FindClose(h)
+			}
+			return nil, &os.PathError{Op: "FindFirstFileName", Path: path, Err: err}
+		}
+		names = append(names, syscall.UTF16ToString(buf[:length]))
+	}
+	syscall.FindClose(h)
+	return names, nil
+}
@@ -0,0 +1,57 @@
+package winio
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestCreateHardLink(t *testing.T) {
+	d, err := ioutil.TempDir("", "hardlink")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(d)
+
+	err = ioutil.WriteFile(filepath.Join(d, "a"), []byte("data"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(d, "c"), []byte("other"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = CreateHardLink(filepath.Join(d, "a"), filepath.Join(d, "b"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = CreateHardLink(filepath.Join(d, "a"), filepath.Join(d, "c"), false); err == nil {
+		t.Fatal("expected link over an existing file to fail")
+	}
+	err = CreateHardLink(filepath.Join(d, "a"), filepath.Join(d, "c"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	links, err := GetFileLinks(filepath.Join(d, "a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(links) != 3 {
+		t.Fatalf("expected 3 links, got %v", links)
+	}
+	var names []string
+	for _, l := range links {
+		if filepath.VolumeName(l) != "" || !strings.HasPrefix(l, `\`) {
+			t.Fatalf("link %s is not volume relative", l)
+		}
+		names = append(names, filepath.Base(l))
+	}
+	sort.Strings(names)
+	if strings.Join(names, ",") != "a,b,c" {
+		t.Fatalf("unexpected links %v", links)
+	}
+}
@@ -0,0 +1,300 @@
+package winio
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	heartbeatFrameData = iota
+	heartbeatFramePing
+	heartbeatFramePong
+
+	heartbeatHeaderSize   = 5
+	heartbeatMaxFrameSize = 64 * 1024
+
+	defaultHeartbeatInterval      = 5 * time.Second
+	defaultHeartbeatMissThreshold = 3
+)
+
+var errHeartbeatProtocol = errors.New("invalid heartbeat frame")
+
+// HeartbeatConfig contains configuration for a heartbeat connection.
+type HeartbeatConfig struct {
+	// Interval is the time between pings sent to the peer. If zero, pings are
+	// sent every 5 seconds.
+	Interval time.Duration
+
+	// MissThreshold is the number of intervals that may pass without receiving
+	// anything from the peer before the peer is considered dead. If zero, 3 is used.
+	MissThreshold int
+
+	// StateChanged, if set, is called from a background goroutine whenever the
+	// peer transitions between alive and dead.
+	StateChanged func(alive bool)
+}
+
+// HeartbeatConn is a net.Conn that exchanges periodic ping and pong frames with its
+// peer in addition to the application's data, so that a peer that has stopped
+// responding can be detected. Neither named pipes nor most other transports in this
+// package have a protocol-level keepalive visible to the peer.
+//
+// Both ends of the connection must be wrapped with NewHeartbeatConn since data is
+// framed on the wire. Frames are only processed while the application reads from the
+// connection, so an application that stops reading will eventually be seen as dead by
+// its peer.
+type HeartbeatConn struct {
+	conn         net.Conn
+	cfg          HeartbeatConfig
+	writeLock    sync.Mutex
+	pinging      int32
+	ponging      int32
+	stateLock    sync.Mutex
+	lastHeard    time.Time
+	alive        bool
+	readDeadline time.Time
+	dataCh       chan []byte
+	pending      []byte
+	readErr      error
+	closeOnce    sync.Once
+	closeCh      chan struct{}
+	readLoopDone chan struct{}
+}
+
+// NewHeartbeatConn wraps c in a HeartbeatConn and starts sending pings to the peer.
+// The HeartbeatConn takes ownership of c.
+func NewHeartbeatConn(c net.Conn, cfg *HeartbeatConfig) *HeartbeatConn {
+	hc := &HeartbeatConn{
+		conn:         c,
+		lastHeard:    time.Now(),
+		alive:        true,
+		dataCh:       make(chan []byte),
+		closeCh:      make(chan struct{}),
+		readLoopDone: make(chan struct{}),
+	}
+	if cfg != nil {
+		hc.cfg = *cfg
+	}
+	if hc.cfg.Interval == 0 {
+		hc.cfg.Interval = defaultHeartbeatInterval
+	}
+	if hc.cfg.MissThreshold == 0 {
+		hc.cfg.MissThreshold = defaultHeartbeatMissThreshold
+	}
+	go hc.readLoop()
+	go hc.pingLoop()
+	return hc
+}
+
+// Alive returns whether the peer has been heard from recently.
+func (c *HeartbeatConn) Alive() bool {
+	c.stateLock.Lock()
+	defer c.stateLock.Unlock()
+	return c.alive
+}
+
+func (c *HeartbeatConn) setAlive(alive bool) {
+	c.stateLock.Lock()
+	changed := c.alive != alive
+	c.alive = alive
+	if alive {
+		c.lastHeard = time.Now()
+	}
+	c.stateLock.Unlock()
+	if changed && c.cfg.StateChanged != nil {
+		c.cfg.StateChanged(alive)
+	}
+}
+
+func (c *HeartbeatConn) checkAlive() {
+	c.stateLock.Lock()
+	expired := time.Since(c.lastHeard) > c.cfg.Interval*time.Duration(c.cfg.MissThreshold)
+	c.stateLock.Unlock()
+	if expired {
+		c.setAlive(false)
+	}
+}
+
+func (c *HeartbeatConn) writeFrame(frameType byte, b []byte) error {
+	var hdr [heartbeatHeaderSize]byte
+	hdr[0] = frameType
+	binary.LittleEndian.PutUint32(hdr[1:], uint32(len(b)))
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	_, err := c.conn.Write(append(hdr[:], b...))
+	return err
+}
+
+func (c *HeartbeatConn) sendPing() {
+	// Only one ping may be outstanding, so that a peer that is not reading does not
+	// cause writes to pile up.
+	if !atomic.CompareAndSwapInt32(&c.pinging, 0, 1) {
+		return
+	}
+	go func() {
+		c.writeFrame(heartbeatFramePing, nil)
+		atomic.StoreInt32(&c.pinging, 0)
+	}()
+}
+
+func (c *HeartbeatConn) sendPong() {
+	// Pings received while a pong is being written are answered by that pong, so
+	// that a peer flooding pings does not cause writes to pile up.
+	if !atomic.CompareAndSwapInt32(&c.ponging, 0, 1) {
+		return
+	}
+	go func() {
+		c.writeFrame(heartbeatFramePong, nil)
+		atomic.StoreInt32(&c.ponging, 0)
+	}()
+}
+
+func (c *HeartbeatConn) pingLoop() {
+	t := time.NewTicker(c.cfg.Interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-c.closeCh:
+			return
+		case <-t.C:
+			c.checkAlive()
+			c.sendPing()
+		}
+	}
+}
+
+func (c *HeartbeatConn) readLoop() {
+	defer close(c.readLoopDone)
+	var hdr [heartbeatHeaderSize]byte
+	for {
+		_, err := io.ReadFull(c.conn, hdr[:])
+		if err != nil {
+			c.readErr = err
+			return
+		}
+		c.setAlive(true)
+		size := binary.LittleEndian.Uint32(hdr[1:])
+		switch hdr[0] {
+		case heartbeatFrameData:
+			if size > heartbeatMaxFrameSize {
+				c.readErr = errHeartbeatProtocol
+				return
+			}
+			b := make([]byte, size)
+			_, err = io.ReadFull(c.conn, b)
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			if err != nil {
+				c.readErr = err
+				return
+			}
+			select {
+			case c.dataCh <- b:
+			case <-c.closeCh:
+				c.readErr = ErrFileClosed
+				return
+			}
+		case heartbeatFramePing:
+			if size != 0 {
+				c.readErr = errHeartbeatProtocol
+				return
+			}
+			c.sendPong()
+		case heartbeatFramePong:
+			if size != 0 {
+				c.readErr = errHeartbeatProtocol
+				return
+			}
+		default:
+			c.readErr = errHeartbeatProtocol
+			return
+		}
+	}
+}
+
+// Read reads data sent by the peer.
+func (c *HeartbeatConn) Read(b []byte) (int, error) {
+	if len(c.pending) == 0 {
+		var timeout <-chan time.Time
+		c.stateLock.Lock()
+		deadline := c.readDeadline
+		c.stateLock.Unlock()
+		if !deadline.IsZero() {
+			d := deadline.Sub(time.Now())
+			if d <= 0 {
+				return 0, ErrTimeout
+			}
+			t := time.NewTimer(d)
+			defer t.Stop()
+			timeout = t.C
+		}
+		select {
+		case c.pending = <-c.dataCh:
+		case <-c.readLoopDone:
+			return 0, c.readErr
+		case <-timeout:
+			return 0, ErrTimeout
+		}
+	}
+	n := copy(b, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
+
+// Write writes data to the peer.
+func (c *HeartbeatConn) Write(b []byte) (int, error) {
+	n := 0
+	for len(b) > 0 {
+		chunk := b
+		if len(chunk) > heartbeatMaxFrameSize {
+			chunk = chunk[:heartbeatMaxFrameSize]
+		}
+		err := c.writeFrame(heartbeatFrameData, chunk)
+		if err != nil {
+			return n, err
+		}
+		n += len(chunk)
+		b = b[len(chunk):]
+	}
+	return n, nil
+}
+
+// Close stops sending pings and closes the underlying connection.
+func (c *HeartbeatConn) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		close(c.closeCh)
+		err = c.conn.Close()
+	})
+	return err
+}
+
+func (c *HeartbeatConn) LocalAddr() net.Addr {
+	return c.conn.LocalAddr()
+}
+
+func (c *HeartbeatConn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+func (c *HeartbeatConn) SetDeadline(t time.Time) error {
+	c.SetReadDeadline(t)
+	return c.SetWriteDeadline(t)
+}
+
+func (c *HeartbeatConn) SetReadDeadline(t time.Time) error {
+	c.stateLock.Lock()
+	c.readDeadline = t
+	c.stateLock.Unlock()
+	return nil
+}
+
+func (c *HeartbeatConn) SetWriteDeadline(t time.Time) error {
+	return c.conn.SetWriteDeadline(t)
+}
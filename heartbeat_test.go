@@ -0,0 +1,72 @@
+package winio
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestHeartbeatReadWrite(t *testing.T) {
+	p1, p2 := net.Pipe()
+	c := NewHeartbeatConn(p1, &HeartbeatConfig{Interval: 10 * time.Millisecond})
+	defer c.Close()
+	s := NewHeartbeatConn(p2, &HeartbeatConfig{Interval: 10 * time.Millisecond})
+	defer s.Close()
+
+	go func() {
+		c.Write([]byte("hello world\n"))
+	}()
+
+	b := make([]byte, 12)
+	_, err := io.ReadFull(s, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "hello world\n" {
+		t.Fatalf("incorrect data %q", b)
+	}
+
+	// Pings must not be reported as data.
+	time.Sleep(50 * time.Millisecond)
+	s.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+	_, err = s.Read(b)
+	if err != ErrTimeout {
+		t.Fatalf("expected ErrTimeout, got %v", err)
+	}
+	if !c.Alive() || !s.Alive() {
+		t.Fatal("expected both ends to be alive")
+	}
+}
+
+func TestHeartbeatDetectsDeadPeer(t *testing.T) {
+	p1, p2 := net.Pipe()
+	defer p2.Close()
+	ch := make(chan bool, 1)
+	c := NewHeartbeatConn(p1, &HeartbeatConfig{
+		Interval:      10 * time.Millisecond,
+		MissThreshold: 2,
+		StateChanged:  func(alive bool) { ch <- alive },
+	})
+	defer c.Close()
+
+	select {
+	case alive := <-ch:
+		if alive {
+			t.Fatal("expected peer to be reported dead")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for the peer to be reported dead")
+	}
+	if c.Alive() {
+		t.Fatal("expected Alive to return false")
+	}
+}
+
+func TestHeartbeatCloseEOF(t *testing.T) {
+	p1, p2 := net.Pipe()
+	c := NewHeartbeatConn(p1, nil)
+	s := NewHeartbeatConn(p2, nil)
+	defer s.Close()
+	ensureEOFOnClose(t, s, c)
+}
@@ -0,0 +1,274 @@
+package winio_test
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/Microsoft/go-winio"
+	"github.com/Microsoft/go-winio/archive/tar"
+	"github.com/Microsoft/go-winio/backuptar"
+	"github.com/Microsoft/go-winio/pkg/fs"
+	"github.com/Microsoft/go-winio/pkg/security"
+	"golang.org/x/sys/windows"
+)
+
+// These tests combine several packages in the ways that callers are expected to. They
+// are skipped in short mode, and when probes find that the environment lacks the
+// capabilities they need.
+
+const integrationPipeName = `\\.\pipe\winiointegrationpipe`
+
+func skipIfShort(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+}
+
+// requirePipeIdentification skips the test unless a pipe server can identify its
+// clients, which is what the pipe tests depend on.
+func requirePipeIdentification(t *testing.T) {
+	const probePipeName = `\\.\pipe\winiointegrationprobe`
+	l, err := winio.ListenPipe(probePipeName, nil)
+	if err != nil {
+		t.Skip("cannot create named pipes: ", err)
+	}
+	defer l.Close()
+	ch := make(chan error, 1)
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			ch <- err
+			return
+		}
+		defer c.Close()
+		if _, err = c.Read(make([]byte, 1)); err != nil {
+			ch <- err
+			return
+		}
+		ch <- winio.RunAsPipeClient(c, func() error {
+			token, err := openThreadToken()
+			if err == nil {
+				token.Close()
+			}
+			return err
+		})
+	}()
+	c, err := winio.DialPipeImpLevel(probePipeName, nil, winio.PipeImpLevelIdentification)
+	if err != nil {
+		t.Skip("cannot connect to named pipes: ", err)
+	}
+	defer c.Close()
+	if _, err = c.Write([]byte("x")); err == nil {
+		err = <-ch
+	}
+	if err != nil {
+		t.Skip("cannot identify pipe clients: ", err)
+	}
+}
+
+// requireVolumeFeatures skips the test unless the volume holding path has all of flags.
+func requireVolumeFeatures(t *testing.T, path string, flags fs.VolumeFlags) {
+	info, err := fs.GetVolumeInformation(path)
+	if err != nil {
+		t.Skip("cannot query volume features: ", err)
+	}
+	if info.Flags&flags != flags {
+		t.Skipf("%s volume lacks features %#x", info.FileSystem, flags&^info.Flags)
+	}
+}
+
+func openThreadToken() (windows.Token, error) {
+	var token windows.Token
+	err := windows.OpenThreadToken(windows.CurrentThread(), windows.TOKEN_QUERY, true, &token)
+	return token, err
+}
+
+// pipeDescriptor returns a descriptor that grants user access to a pipe. It has an owner
+// and group so that it can be passed to AccessCheck.
+func pipeDescriptor(user *security.SID, access security.AccessMask) *security.SecurityDescriptor {
+	sd := &security.SecurityDescriptor{
+		Control: security.ControlDACLProtected,
+		Owner:   user,
+		Group:   user,
+		DACL:    &security.ACL{},
+	}
+	sd.DACL.AddACE(security.AllowACE(user, access, 0))
+	return sd
+}
+
+func TestIntegrationPipeServerAuthorization(t *testing.T) {
+	skipIfShort(t)
+	requirePipeIdentification(t)
+	user := winio.CurrentUserSid(t)
+	const clientAccess = security.GenericRead | security.GenericWrite
+	for _, test := range []struct {
+		name    string
+		granted security.AccessMask
+	}{
+		{"readwrite", security.FileGenericRead | security.FileGenericWrite},
+		{"readonly", security.FileGenericRead},
+	} {
+		sd := pipeDescriptor(user, test.granted)
+
+		// Decide up front whether clients will be able to connect.
+		_, ok, err := security.AccessCheck(sd, 0, clientAccess, &security.FileGenericMapping)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sddl, err := sd.SDDL()
+		if err != nil {
+			t.Fatal(err)
+		}
+		l, err := winio.ListenPipe(integrationPipeName, &winio.PipeConfig{SecurityDescriptor: sddl})
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg := []byte("hello")
+		ch := make(chan error, 1)
+		go func() {
+			c, err := l.Accept()
+			if err != nil {
+				ch <- err
+				return
+			}
+			defer c.Close()
+			b := make([]byte, len(msg))
+			if _, err = io.ReadFull(c, b); err != nil {
+				ch <- err
+				return
+			}
+			// Identify the client and check it against the pipe's descriptor before
+			// answering it.
+			err = winio.RunAsPipeClient(c, func() error {
+				token, err := openThreadToken()
+				if err != nil {
+					return err
+				}
+				defer token.Close()
+				client, err := security.TokenUser(token)
+				if err != nil {
+					return err
+				}
+				if !client.Equal(user) {
+					return fmt.Errorf("client is %s, expected %s", client, user)
+				}
+				_, ok, err := security.AccessCheck(sd, token, clientAccess, &security.FileGenericMapping)
+				if err == nil && !ok {
+					err = fmt.Errorf("client %s was not granted access", client)
+				}
+				return err
+			})
+			if err == nil {
+				_, err = c.Write(b)
+			}
+			ch <- err
+		}()
+
+		c, err := winio.DialPipeImpLevel(integrationPipeName, nil, winio.PipeImpLevelIdentification)
+		if !ok {
+			l.Close()
+			if perr, isPathErr := err.(*os.PathError); !isPathErr || perr.Err != syscall.ERROR_ACCESS_DENIED {
+				t.Fatalf("%s: expected access denied, got %v", test.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			l.Close()
+			t.Fatalf("%s: %s", test.name, err)
+		}
+		if _, err = c.Write(msg); err != nil {
+			t.Fatal(err)
+		}
+		b := make([]byte, len(msg))
+		if _, err = io.ReadFull(c, b); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b, msg) {
+			t.Fatalf("%s: got %q", test.name, b)
+		}
+		if err = <-ch; err != nil {
+			t.Fatalf("%s: server: %s", test.name, err)
+		}
+		c.Close()
+		l.Close()
+	}
+}
+
+func TestIntegrationBackupTarRoundTrip(t *testing.T) {
+	skipIfShort(t)
+	src, err := ioutil.TempDir("", "tst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(src)
+	requireVolumeFeatures(t, src, fs.VolumePersistentACLs|fs.VolumeNamedStreams)
+	name := filepath.Join(src, "file.txt")
+	if err = ioutil.WriteFile(name, []byte("data"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(name+":ads", []byte("stream"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	// Protect the file with an explicit DACL so that restoring it is observable.
+	user := winio.CurrentUserSid(t)
+	sd := &security.SecurityDescriptor{Control: security.ControlDACLProtected, DACL: &security.ACL{}}
+	sd.DACL.AddACE(security.AllowACE(user, security.FileAllAccess, 0))
+	sd.DACL.AddACE(security.AllowACE(security.Users.SID(), security.FileGenericRead, 0))
+	if err = security.SetNamedSecurityInfo(name, security.FileObject, security.DACLSecurityInformation, sd); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	if err = backuptar.WriteTarFromDirectory(tw, src, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err = tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	summaries, err := backuptar.InspectTar(tar.NewReader(bytes.NewReader(buf.Bytes())))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(summaries) != 1 || len(summaries[0].Streams) != 3 {
+		t.Fatalf("unexpected archive contents %+v", summaries)
+	}
+
+	// Extract twice; the second copy is renamed.
+	dst, err := ioutil.TempDir("", "tst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dst)
+	for i := 0; i < 2; i++ {
+		err = backuptar.ExtractTarToDirectory(tar.NewReader(bytes.NewReader(buf.Bytes())), dst, &backuptar.PipelineOptions{Collision: backuptar.CollisionRename})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, n := range []string{"file.txt", "file (1).txt"} {
+		path := filepath.Join(dst, n)
+		b, err := ioutil.ReadFile(path + ":ads")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != "stream" {
+			t.Fatalf("%s: unexpected stream contents %q", n, b)
+		}
+		got, err := security.GetNamedSecurityInfo(path, security.FileObject, security.DACLSecurityInformation)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Control&security.ControlDACLProtected == 0 || len(got.DACL.ACEs) != 2 || !got.DACL.ACEs[1].SID.Equal(security.Users.SID()) {
+			t.Fatalf("%s: DACL not restored: %+v", n, got.DACL)
+		}
+	}
+}
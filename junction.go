@@ -0,0 +1,129 @@
+package winio
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/Microsoft/go-winio/pkg/fs"
+)
+
+// Junction describes an NTFS junction, a directory with a mount point reparse point
+// that redirects to another directory on a local volume.
+type Junction struct {
+	// Target is the Win32 path of the directory the junction points to. It is the
+	// print name of the junction or, if the junction has none, the Win32 form of its
+	// substitute name.
+	Target string
+
+	// SubstituteName is the NT path that the file system follows, such as \??\C:\dir
+	// or \??\Volume{...}\dir.
+	SubstituteName string
+
+	// PrintName is the path displayed to users. Junctions created by some tools have
+	// no print name.
+	PrintName string
+}
+
+// DecodeJunction decodes a REPARSE_DATA_BUFFER structure containing a mount point.
+func DecodeJunction(b []byte) (*Junction, error) {
+	if len(b) < 8 {
+		return nil, errInvalidReparseData
+	}
+	if tag := binary.LittleEndian.Uint32(b[0:4]); tag != ReparseTagMountPoint {
+		return nil, &UnsupportedReparsePointError{tag}
+	}
+	substituteName, printName, err := decodeReparseNames(b[8:], false)
+	if err != nil {
+		return nil, err
+	}
+	j := &Junction{Target: printName, SubstituteName: substituteName, PrintName: printName}
+	if j.Target == "" {
+		j.Target = win32PathFromNT(substituteName)
+	}
+	return j, nil
+}
+
+// CreateJunction creates a junction at path that points to the directory target. A
+// relative target is made absolute, since the file system does not resolve junctions
+// relative to their location. The target need not exist. path must not exist, and
+// its parent directory must.
+func CreateJunction(path, target string) error {
+	if !strings.HasPrefix(target, `\\?\`) {
+		abs, err := filepath.Abs(target)
+		if err != nil {
+			return &os.LinkError{Op: "junction", Old: target, New: path, Err: err}
+		}
+		target = abs
+	}
+	if strings.HasPrefix(target, `\\`) && !strings.HasPrefix(target, `\\?\`) {
+		// Junctions cannot point to network shares.
+		return &os.LinkError{Op: "junction", Old: target, New: path, Err: syscall.EINVAL}
+	}
+	if err := os.Mkdir(path, 0777); err != nil {
+		return err
+	}
+	f, err := OpenForBackup(path, syscall.GENERIC_WRITE, 0, syscall.OPEN_EXISTING)
+	if err == nil {
+		_, err = fsctl(f, "FSCTL_SET_REPARSE_POINT", cFSCTL_SET_REPARSE_POINT, EncodeReparsePoint(&ReparsePoint{Target: target, IsMountPoint: true}), nil)
+		f.Close()
+	}
+	if err != nil {
+		os.Remove(path)
+		return err
+	}
+	return nil
+}
+
+// ReadJunction returns the junction at path. If path is not a junction, the error
+// wraps an *UnsupportedReparsePointError, or ERROR_NOT_A_REPARSE_POINT if path is not
+// a reparse point at all.
+func ReadJunction(path string) (*Junction, error) {
+	f, err := OpenForBackup(path, cFILE_READ_ATTRIBUTES, syscall.FILE_SHARE_READ|syscall.FILE_SHARE_WRITE|syscall.FILE_SHARE_DELETE, syscall.OPEN_EXISTING)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	b, err := readReparsePoint(f)
+	if err != nil {
+		return nil, err
+	}
+	j, err := DecodeJunction(b)
+	if err != nil {
+		return nil, &os.PathError{Op: "read junction", Path: path, Err: err}
+	}
+	return j, nil
+}
+
+// DeleteJunction removes the junction at path, leaving its target untouched. Unlike
+// os.RemoveAll, it fails if path is not a junction.
+func DeleteJunction(path string) error {
+	if _, err := ReadJunction(path); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// ResolveJunction returns the final path of the directory that the junction at path
+// points to, after following any junctions and symlinks in the target itself.
+func ResolveJunction(path string) (string, error) {
+	if _, err := ReadJunction(path); err != nil {
+		return "", err
+	}
+	path16, err := syscall.UTF16FromString(path)
+	if err != nil {
+		return "", &os.PathError{Op: "open", Path: path, Err: err}
+	}
+	h, err := syscall.CreateFile(&path16[0], cFILE_READ_ATTRIBUTES, syscall.FILE_SHARE_READ|syscall.FILE_SHARE_WRITE|syscall.FILE_SHARE_DELETE, nil, syscall.OPEN_EXISTING, syscall.FILE_FLAG_BACKUP_SEMANTICS, 0)
+	if err != nil {
+		return "", &os.PathError{Op: "open", Path: path, Err: err}
+	}
+	defer syscall.CloseHandle(h)
+	final, err := fs.GetFinalPathNameByHandle(h, fs.VolumeNameDOS)
+	if err != nil {
+		return "", err
+	}
+	return win32PathFromNT(`\??\` + strings.TrimPrefix(final, `\\?\`)), nil
+}
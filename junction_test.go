@@ -0,0 +1,89 @@
+package winio
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDecodeJunctionWithoutPrintName(t *testing.T) {
+	b := EncodeReparsePoint(&ReparsePoint{Target: `C:\target`, IsMountPoint: true})
+	// Clear the print name length.
+	b[14], b[15] = 0, 0
+	j, err := DecodeJunction(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j.Target != `C:\target` || j.SubstituteName != `\??\C:\target` || j.PrintName != "" {
+		t.Fatalf("unexpected junction %+v", j)
+	}
+	if _, err := DecodeJunction(b[:10]); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestJunction(t *testing.T) {
+	d, err := ioutil.TempDir("", "junction")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(d)
+	target := filepath.Join(d, "target")
+	if err := os.Mkdir(target, 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(target, "file"), []byte("data"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	j1 := filepath.Join(d, "j1")
+	j2 := filepath.Join(d, "j2")
+	if err := CreateJunction(j1, target); err != nil {
+		t.Fatal(err)
+	}
+	if err := CreateJunction(j2, j1); err != nil {
+		t.Fatal(err)
+	}
+
+	j, err := ReadJunction(j2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j.Target != j1 || j.SubstituteName != `\??\`+j1 {
+		t.Fatalf("unexpected junction %+v", j)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(j2, "file"))
+	if err != nil || string(b) != "data" {
+		t.Fatalf("unexpected contents %q: %v", b, err)
+	}
+
+	resolved, err := ResolveJunction(j2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The temporary directory may itself be reached through a short name or a link.
+	wantFinal, err := ResolveJunction(j1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resolved != wantFinal || !strings.EqualFold(filepath.Base(resolved), "target") {
+		t.Fatalf("unexpected resolved path %s, expected %s", resolved, wantFinal)
+	}
+
+	if _, err := ReadJunction(target); err == nil {
+		t.Fatal("expected error for a directory that is not a junction")
+	}
+	if err := DeleteJunction(target); err == nil {
+		t.Fatal("expected error for a directory that is not a junction")
+	}
+	if err := DeleteJunction(j1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Lstat(j1); !os.IsNotExist(err) {
+		t.Fatalf("junction still exists: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(target, "file")); err != nil {
+		t.Fatal(err)
+	}
+}
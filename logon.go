@@ -0,0 +1,97 @@
+package winio
+
+import (
+	"os"
+	"runtime"
+	"syscall"
+
+	"golang.org/x/sys/windows"
+)
+
+//sys logonUser(username *uint16, domain *uint16, password *uint16, logonType uint32, logonProvider uint32, token *windows.Token) (err error) = advapi32.LogonUserW
+//sys impersonateLoggedOnUser(token windows.Token) (err error) = advapi32.ImpersonateLoggedOnUser
+
+// LogonType is the type of logon performed by LogonUser.
+type LogonType uint32
+
+const (
+	// LogonInteractive is for users who will use the machine interactively.
+	LogonInteractive LogonType = 2
+	// LogonNetwork is for servers that authenticate plaintext passwords. The token
+	// cannot access network resources.
+	LogonNetwork LogonType = 3
+	// LogonBatch is for batch servers, and requires the log on as a batch job right.
+	LogonBatch LogonType = 4
+	// LogonService is for services, and requires the log on as a service right.
+	LogonService LogonType = 5
+	// LogonNetworkCleartext is like LogonNetwork, but keeps the credentials so the
+	// token can access network resources.
+	LogonNetworkCleartext LogonType = 8
+	// LogonNewCredentials clones the caller's token for local access but uses the
+	// given credentials for network connections.
+	LogonNewCredentials LogonType = 9
+)
+
+const cLOGON32_PROVIDER_DEFAULT = 0
+
+// LogonUser logs on a user and returns its primary token, which the caller must close.
+// user may be a user principal name such as user@domain, in which case domain must be
+// empty.
+func LogonUser(user, domain, password string, logonType LogonType) (windows.Token, error) {
+	user16, err := syscall.UTF16PtrFromString(user)
+	if err != nil {
+		return 0, err
+	}
+	// A user principal name is only accepted if the domain is NULL, not empty.
+	var domain16 *uint16
+	if domain != "" {
+		domain16, err = syscall.UTF16PtrFromString(domain)
+		if err != nil {
+			return 0, err
+		}
+	}
+	password16, err := syscall.UTF16PtrFromString(password)
+	if err != nil {
+		return 0, err
+	}
+	var token windows.Token
+	err = logonUser(user16, domain16, password16, uint32(logonType), cLOGON32_PROVIDER_DEFAULT, &token)
+	if err != nil {
+		return 0, &os.SyscallError{Syscall: "LogonUser", Err: err}
+	}
+	return token, nil
+}
+
+// RunAsUser logs on a user with LogonUser and runs fn while impersonating it. See
+// RunAsToken.
+func RunAsUser(user, domain, password string, logonType LogonType, fn func() error) error {
+	token, err := LogonUser(user, domain, password, logonType)
+	if err != nil {
+		return err
+	}
+	defer token.Close()
+	return RunAsToken(token, fn)
+}
+
+// RunAsToken runs fn while the calling thread impersonates token, which must have
+// been opened with TOKEN_QUERY and TOKEN_DUPLICATE access. The goroutine is locked to its
+// thread for the duration of the call, and the impersonation is reverted when fn
+// returns or panics.
+//
+// fn must not call RunWithPrivileges, which ends any impersonation of the thread when
+// it returns; enable privileges in token with RunWithTokenPrivileges instead.
+func RunAsToken(token windows.Token, fn func() error) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	err := impersonateLoggedOnUser(token)
+	if err != nil {
+		return &os.SyscallError{Syscall: "ImpersonateLoggedOnUser", Err: err}
+	}
+	defer func() {
+		err := revertToSelf()
+		if err != nil {
+			panic(err)
+		}
+	}()
+	return fn()
+}
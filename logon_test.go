@@ -0,0 +1,60 @@
+package winio
+
+import (
+	"os"
+	"runtime"
+	"syscall"
+	"testing"
+
+	"golang.org/x/sys/windows"
+)
+
+func TestLogonUserFails(t *testing.T) {
+	_, err := LogonUser("winio-no-such-user", ".", "password", LogonNetwork)
+	if serr, ok := err.(*os.SyscallError); !ok || serr.Err != windows.ERROR_LOGON_FAILURE {
+		t.Fatalf("expected logon failure, got %v", err)
+	}
+}
+
+func isImpersonating() bool {
+	var token windows.Token
+	err := openThreadToken(getCurrentThread(), syscall.TOKEN_QUERY, true, &token)
+	if err == nil {
+		token.Close()
+		return true
+	}
+	return false
+}
+
+func TestRunAsToken(t *testing.T) {
+	p, _ := windows.GetCurrentProcess()
+	var token windows.Token
+	err := windows.OpenProcessToken(p, windows.TOKEN_QUERY|windows.TOKEN_DUPLICATE, &token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer token.Close()
+
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	err = RunAsToken(token, func() error {
+		if !isImpersonating() {
+			t.Error("not impersonating")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if isImpersonating() {
+		t.Fatal("still impersonating")
+	}
+
+	func() {
+		defer func() { recover() }()
+		RunAsToken(token, func() error { panic("fail") })
+	}()
+	if isImpersonating() {
+		t.Fatal("still impersonating after panic")
+	}
+}
@@ -0,0 +1,221 @@
+package winio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"strings"
+)
+
+// Names of the EAs in which WSL stores Linux metadata. NTFS stores EA names in upper
+// case, so names should be compared case-insensitively.
+const (
+	// LxUIDEAName holds the owner of a file on a DrvFs volume as a 32-bit integer.
+	LxUIDEAName = "$LXUID"
+	// LxGIDEAName holds the group of a file on a DrvFs volume as a 32-bit integer.
+	LxGIDEAName = "$LXGID"
+	// LxModeEAName holds the mode bits of a file on a DrvFs volume as a 32-bit integer.
+	LxModeEAName = "$LXMOD"
+	// LxDevEAName holds the major and minor device numbers of a device file on a DrvFs
+	// volume.
+	LxDevEAName = "$LXDEV"
+	// LxAttrbEAName holds the LXATTRB structure of a file in a WSL 1 (LxFs) root file
+	// system.
+	LxAttrbEAName = "LXATTRB"
+
+	lxSecurityEAPrefix = "LX.SECURITY."
+	lxSecurityPrefix   = "security."
+
+	lxAttrbVersion = 1
+
+	lxCapRevision2   = 0x02000000
+	lxCapRevision3   = 0x03000000
+	lxCapRevisionMax = 0xff000000
+	// LxCapEffective is set in LxCapability.Flags if the permitted capabilities are
+	// raised in the effective set on exec.
+	LxCapEffective = 0x1
+	// LxCapabilityXattr is the name of the xattr that holds file capabilities.
+	LxCapabilityXattr = "security.capability"
+)
+
+var (
+	errInvalidLxEa      = errors.New("invalid WSL extended attribute")
+	errInvalidLxXattr   = errors.New("not a security xattr name")
+	errInvalidLxCapData = errors.New("invalid file capability data")
+)
+
+func lxUint32EA(name string, v uint32) ExtendedAttribute {
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint32(b, v)
+	return ExtendedAttribute{Name: name, Value: b}
+}
+
+// LxUIDEA returns a $LXUID EA that sets the owner of a file.
+func LxUIDEA(uid uint32) ExtendedAttribute {
+	return lxUint32EA(LxUIDEAName, uid)
+}
+
+// LxGIDEA returns a $LXGID EA that sets the group of a file.
+func LxGIDEA(gid uint32) ExtendedAttribute {
+	return lxUint32EA(LxGIDEAName, gid)
+}
+
+// LxModeEA returns a $LXMOD EA that sets the Linux mode of a file, including its file
+// type bits (S_IFMT).
+func LxModeEA(mode uint32) ExtendedAttribute {
+	return lxUint32EA(LxModeEAName, mode)
+}
+
+// LxDevEA returns a $LXDEV EA that sets the device numbers of a character or block
+// device file.
+func LxDevEA(major, minor uint32) ExtendedAttribute {
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint32(b[0:4], major)
+	binary.LittleEndian.PutUint32(b[4:8], minor)
+	return ExtendedAttribute{Name: LxDevEAName, Value: b}
+}
+
+// DecodeLxUint32EA decodes the value of a $LXUID, $LXGID, or $LXMOD EA.
+func DecodeLxUint32EA(ea *ExtendedAttribute) (uint32, error) {
+	if len(ea.Value) != 4 {
+		return 0, errInvalidLxEa
+	}
+	return binary.LittleEndian.Uint32(ea.Value), nil
+}
+
+// DecodeLxDevEA decodes the value of a $LXDEV EA.
+func DecodeLxDevEA(ea *ExtendedAttribute) (major, minor uint32, err error) {
+	if len(ea.Value) != 8 {
+		return 0, 0, errInvalidLxEa
+	}
+	return binary.LittleEndian.Uint32(ea.Value[0:4]), binary.LittleEndian.Uint32(ea.Value[4:8]), nil
+}
+
+// LxAttrb is the Linux metadata that WSL 1 stores in the LXATTRB EA of each file in its
+// root file system. Times are in seconds and nanoseconds since the Unix epoch.
+type LxAttrb struct {
+	Flags          uint16
+	Version        uint16
+	Mode           uint32
+	UID            uint32
+	GID            uint32
+	DeviceID       uint32
+	AccessTimeNsec uint32
+	ModifyTimeNsec uint32
+	ChangeTimeNsec uint32
+	AccessTime     uint64
+	ModifyTime     uint64
+	ChangeTime     uint64
+}
+
+var lxAttrbSize = binary.Size(&LxAttrb{})
+
+// EA returns the LXATTRB EA for a. If a.Version is zero, the current version is used.
+func (a *LxAttrb) EA() ExtendedAttribute {
+	attrb := *a
+	if attrb.Version == 0 {
+		attrb.Version = lxAttrbVersion
+	}
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, &attrb)
+	return ExtendedAttribute{Name: LxAttrbEAName, Value: buf.Bytes()}
+}
+
+// DecodeLxAttrb decodes the value of an LXATTRB EA.
+func DecodeLxAttrb(ea *ExtendedAttribute) (*LxAttrb, error) {
+	if len(ea.Value) < lxAttrbSize {
+		return nil, errInvalidLxEa
+	}
+	var a LxAttrb
+	err := binary.Read(bytes.NewReader(ea.Value), binary.LittleEndian, &a)
+	if err != nil {
+		return nil, errInvalidLxEa
+	}
+	return &a, nil
+}
+
+// LxSecurityEA returns the LX.SECURITY.* EA in which WSL stores the Linux xattr name,
+// which must be in the security namespace (such as security.capability). Since NTFS
+// upper-cases EA names, the case of the xattr name is not preserved.
+func LxSecurityEA(name string, value []byte) (ExtendedAttribute, error) {
+	if !strings.HasPrefix(name, lxSecurityPrefix) || len(name) == len(lxSecurityPrefix) {
+		return ExtendedAttribute{}, errInvalidLxXattr
+	}
+	return ExtendedAttribute{
+		Name:  lxSecurityEAPrefix + strings.ToUpper(name[len(lxSecurityPrefix):]),
+		Value: value,
+	}, nil
+}
+
+// LxSecurityXattr returns the name and value of the Linux xattr stored in an
+// LX.SECURITY.* EA. The name is returned in lower case. ok is false if ea is not such
+// an EA.
+func LxSecurityXattr(ea *ExtendedAttribute) (name string, value []byte, ok bool) {
+	if len(ea.Name) <= len(lxSecurityEAPrefix) || !strings.EqualFold(ea.Name[:len(lxSecurityEAPrefix)], lxSecurityEAPrefix) {
+		return "", nil, false
+	}
+	return lxSecurityPrefix + strings.ToLower(ea.Name[len(lxSecurityEAPrefix):]), ea.Value, true
+}
+
+// LxCapability holds the file capabilities stored in the security.capability xattr, in
+// the layout of the Linux vfs_cap_data structure.
+type LxCapability struct {
+	// Flags contains LxCapEffective or zero.
+	Flags       uint32
+	Permitted   uint64
+	Inheritable uint64
+	// RootID is the user ID of root in the user namespace the capabilities apply to. If
+	// it is zero, the capabilities are encoded in the older revision 2 layout, which
+	// applies to all namespaces.
+	RootID uint32
+}
+
+// Encode encodes the capabilities as the value of a security.capability xattr.
+func (c *LxCapability) Encode() []byte {
+	size := 20
+	revision := uint32(lxCapRevision2)
+	if c.RootID != 0 {
+		size = 24
+		revision = lxCapRevision3
+	}
+	b := make([]byte, size)
+	binary.LittleEndian.PutUint32(b[0:4], revision|c.Flags&LxCapEffective)
+	binary.LittleEndian.PutUint32(b[4:8], uint32(c.Permitted))
+	binary.LittleEndian.PutUint32(b[8:12], uint32(c.Inheritable))
+	binary.LittleEndian.PutUint32(b[12:16], uint32(c.Permitted>>32))
+	binary.LittleEndian.PutUint32(b[16:20], uint32(c.Inheritable>>32))
+	if c.RootID != 0 {
+		binary.LittleEndian.PutUint32(b[20:24], c.RootID)
+	}
+	return b
+}
+
+// DecodeLxCapability decodes the value of a security.capability xattr. Only the
+// revision 2 and 3 layouts are supported.
+func DecodeLxCapability(b []byte) (*LxCapability, error) {
+	if len(b) < 4 {
+		return nil, errInvalidLxCapData
+	}
+	magic := binary.LittleEndian.Uint32(b[0:4])
+	switch magic & lxCapRevisionMax {
+	case lxCapRevision2:
+		if len(b) != 20 {
+			return nil, errInvalidLxCapData
+		}
+	case lxCapRevision3:
+		if len(b) != 24 {
+			return nil, errInvalidLxCapData
+		}
+	default:
+		return nil, errInvalidLxCapData
+	}
+	c := &LxCapability{
+		Flags:       magic &^ lxCapRevisionMax,
+		Permitted:   uint64(binary.LittleEndian.Uint32(b[4:8])) | uint64(binary.LittleEndian.Uint32(b[12:16]))<<32,
+		Inheritable: uint64(binary.LittleEndian.Uint32(b[8:12])) | uint64(binary.LittleEndian.Uint32(b[16:20]))<<32,
+	}
+	if len(b) == 24 {
+		c.RootID = binary.LittleEndian.Uint32(b[20:24])
+	}
+	return c, nil
+}
@@ -0,0 +1,206 @@
+package winio
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+const (
+	cFSCTL_REQUEST_OPLOCK = 0x90240
+
+	cREQUEST_OPLOCK_INPUT_FLAG_REQUEST         = 0x1
+	cREQUEST_OPLOCK_INPUT_FLAG_ACK             = 0x2
+	cREQUEST_OPLOCK_OUTPUT_FLAG_ACK_REQUIRED   = 0x1
+	cREQUEST_OPLOCK_OUTPUT_FLAG_MODES_PROVIDED = 0x2
+	cREQUEST_OPLOCK_CURRENT_VERSION            = 1
+
+	cERROR_OPLOCK_NOT_GRANTED            = syscall.Errno(300)
+	cERROR_CANNOT_GRANT_REQUESTED_OPLOCK = syscall.Errno(807)
+)
+
+var (
+	// ErrOplockNotGranted is returned when an oplock cannot be granted, for example
+	// because other opens of the file conflict with the requested level.
+	ErrOplockNotGranted = errors.New("oplock not granted")
+
+	errNotWin32File = errors.New("not a file opened by this package")
+)
+
+// OplockLevel is a combination of the caching rights of an oplock, as used by SMB 2.1
+// leases.
+type OplockLevel uint32
+
+const (
+	// OplockRead allows the holder to cache reads.
+	OplockRead OplockLevel = 0x1
+	// OplockHandle allows the holder to keep the file open after the client has
+	// closed it.
+	OplockHandle OplockLevel = 0x2
+	// OplockWrite allows the holder to cache writes. It must be combined with
+	// OplockRead.
+	OplockWrite OplockLevel = 0x4
+)
+
+// OplockBreak describes a break of an oplock to a lower level.
+type OplockBreak struct {
+	// OriginalLevel and NewLevel are the levels of the oplock before and after the
+	// break.
+	OriginalLevel OplockLevel
+	NewLevel      OplockLevel
+	// AckRequired is set if the operation that broke the oplock waits until the
+	// break is acknowledged with Acknowledge or the file is closed.
+	AckRequired bool
+	// AccessMode and ShareMode are the access and share modes of the open that
+	// broke the oplock, when the system provides them.
+	AccessMode uint32
+	ShareMode  uint32
+	// Err is set if waiting for the break failed.
+	Err error
+}
+
+type requestOplockInputBuffer struct {
+	StructureVersion     uint16
+	StructureLength      uint16
+	RequestedOplockLevel uint32
+	Flags                uint32
+}
+
+type requestOplockOutputBuffer struct {
+	StructureVersion    uint16
+	StructureLength     uint16
+	OriginalOplockLevel uint32
+	NewOplockLevel      uint32
+	Flags               uint32
+	AccessMode          uint32
+	ShareMode           uint16
+}
+
+// Oplock is an oplock on a file, which lets a file server cache the file's contents
+// or handle on behalf of its clients until another open of the file breaks it.
+type Oplock struct {
+	f         *win32File
+	breaks    chan OplockBreak
+	closeOnce sync.Once
+
+	m     sync.Mutex
+	level OplockLevel
+}
+
+// RequestOplock requests an oplock of the given level on f, which must be a file
+// returned by MakeOpenFile or OpenFileByID. Breaks are delivered through the same
+// completion port as f's reads and writes. The oplock is released when f is closed.
+func RequestOplock(f io.ReadWriteCloser, level OplockLevel) (*Oplock, error) {
+	wf, ok := f.(*win32File)
+	if !ok {
+		return nil, errNotWin32File
+	}
+	o := &Oplock{f: wf, breaks: make(chan OplockBreak, 1)}
+	if err := o.request(level, cREQUEST_OPLOCK_INPUT_FLAG_REQUEST); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// Breaks returns a channel that receives the oplock's breaks. Each break must be
+// received before the next one can be delivered. The channel is closed once the
+// oplock has been broken to no caching rights or the file has been closed.
+func (o *Oplock) Breaks() <-chan OplockBreak {
+	return o.breaks
+}
+
+// Level returns the current level of the oplock.
+func (o *Oplock) Level() OplockLevel {
+	o.m.Lock()
+	defer o.m.Unlock()
+	return o.level
+}
+
+// Acknowledge acknowledges a break that has AckRequired set, keeping the given level,
+// which is normally the break's NewLevel. Acknowledging with a level of zero releases
+// the oplock.
+func (o *Oplock) Acknowledge(level OplockLevel) error {
+	return o.request(level, cREQUEST_OPLOCK_INPUT_FLAG_ACK)
+}
+
+func (o *Oplock) close() {
+	o.closeOnce.Do(func() { close(o.breaks) })
+}
+
+// request issues FSCTL_REQUEST_OPLOCK. When the oplock is granted, the request
+// remains pending until the oplock breaks.
+func (o *Oplock) request(level OplockLevel, flags uint32) error {
+	c, err := o.f.prepareIo()
+	if err != nil {
+		return err
+	}
+	in := requestOplockInputBuffer{
+		StructureVersion:     cREQUEST_OPLOCK_CURRENT_VERSION,
+		StructureLength:      uint16(unsafe.Sizeof(requestOplockInputBuffer{})),
+		RequestedOplockLevel: uint32(level),
+		Flags:                flags,
+	}
+	// out is written when the request completes, so it must not be on the stack.
+	out := new(requestOplockOutputBuffer)
+	var bytes uint32
+	err = syscall.DeviceIoControl(o.f.handle, cFSCTL_REQUEST_OPLOCK, (*byte)(unsafe.Pointer(&in)), uint32(unsafe.Sizeof(in)), (*byte)(unsafe.Pointer(out)), uint32(unsafe.Sizeof(*out)), &bytes, &c.o)
+	if err != syscall.ERROR_IO_PENDING {
+		o.f.wg.Done()
+		switch err {
+		case nil:
+		case cERROR_OPLOCK_NOT_GRANTED, cERROR_CANNOT_GRANT_REQUESTED_OPLOCK:
+			return ErrOplockNotGranted
+		default:
+			return os.NewSyscallError("DeviceIoControl", err)
+		}
+		if flags&cREQUEST_OPLOCK_INPUT_FLAG_ACK != 0 && level == 0 {
+			o.setLevel(0)
+			o.close()
+			return nil
+		}
+		// The oplock broke before the request could pend.
+		o.deliver(out)
+		return nil
+	}
+	o.setLevel(level)
+	go func() {
+		_, err := o.f.asyncIo(c, time.Time{}, 0, err)
+		if err != nil {
+			o.setLevel(0)
+			if err != ErrFileClosed {
+				o.breaks <- OplockBreak{Err: err}
+			}
+			o.close()
+			return
+		}
+		o.deliver(out)
+	}()
+	return nil
+}
+
+func (o *Oplock) setLevel(level OplockLevel) {
+	o.m.Lock()
+	o.level = level
+	o.m.Unlock()
+}
+
+func (o *Oplock) deliver(out *requestOplockOutputBuffer) {
+	b := OplockBreak{
+		OriginalLevel: OplockLevel(out.OriginalOplockLevel),
+		NewLevel:      OplockLevel(out.NewOplockLevel),
+		AckRequired:   out.Flags&cREQUEST_OPLOCK_OUTPUT_FLAG_ACK_REQUIRED != 0,
+	}
+	if out.Flags&cREQUEST_OPLOCK_OUTPUT_FLAG_MODES_PROVIDED != 0 {
+		b.AccessMode = out.AccessMode
+		b.ShareMode = uint32(out.ShareMode)
+	}
+	o.setLevel(b.NewLevel)
+	o.breaks <- b
+	if b.NewLevel == 0 && !b.AckRequired {
+		o.close()
+	}
+}
@@ -0,0 +1,115 @@
+package winio
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func openOplockTestFile(t *testing.T) (string, *win32File) {
+	dir, err := ioutil.TempDir("", "oplock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "file")
+	if err := ioutil.WriteFile(path, []byte("data"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	p, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := syscall.CreateFile(p, syscall.GENERIC_READ|syscall.GENERIC_WRITE, syscall.FILE_SHARE_READ|syscall.FILE_SHARE_WRITE|syscall.FILE_SHARE_DELETE, nil, syscall.OPEN_EXISTING, syscall.FILE_FLAG_OVERLAPPED, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := makeWin32File(h)
+	if err != nil {
+		syscall.CloseHandle(h)
+		t.Fatal(err)
+	}
+	return path, f
+}
+
+func TestOplockBreak(t *testing.T) {
+	path, f := openOplockTestFile(t)
+	defer os.RemoveAll(filepath.Dir(path))
+	defer f.Close()
+	o, err := RequestOplock(f, OplockRead|OplockWrite|OplockHandle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.Level() != OplockRead|OplockWrite|OplockHandle {
+		t.Fatalf("level %#x", o.Level())
+	}
+
+	// A second open breaks the write caching right and waits for the break to be
+	// acknowledged.
+	opened := make(chan error)
+	go func() {
+		f2, err := os.Open(path)
+		if err == nil {
+			f2.Close()
+		}
+		opened <- err
+	}()
+	var b OplockBreak
+	select {
+	case b = <-o.Breaks():
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the oplock to break")
+	}
+	if b.Err != nil {
+		t.Fatal(b.Err)
+	}
+	if b.OriginalLevel != OplockRead|OplockWrite|OplockHandle || b.NewLevel&OplockWrite != 0 || !b.AckRequired {
+		t.Fatalf("unexpected break %+v", b)
+	}
+	select {
+	case err := <-opened:
+		t.Fatalf("open completed before the break was acknowledged: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if err := o.Acknowledge(b.NewLevel); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-opened; err != nil {
+		t.Fatal(err)
+	}
+	if o.Level() != b.NewLevel {
+		t.Fatalf("level %#x after acknowledging", o.Level())
+	}
+
+	f.Close()
+	if _, ok := <-o.Breaks(); ok {
+		t.Fatal("expected the break channel to be closed")
+	}
+}
+
+func TestOplockNotGranted(t *testing.T) {
+	path, f := openOplockTestFile(t)
+	defer os.RemoveAll(filepath.Dir(path))
+	defer f.Close()
+	f2, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f2.Close()
+	// Write caching cannot be granted while another handle is open.
+	if _, err := RequestOplock(f, OplockRead|OplockWrite); err != ErrOplockNotGranted {
+		t.Fatalf("expected ErrOplockNotGranted, got %v", err)
+	}
+}
+
+func TestOplockRequiresWin32File(t *testing.T) {
+	p1, p2 := net.Pipe()
+	defer p1.Close()
+	defer p2.Close()
+	if _, err := RequestOplock(p1, OplockRead); err != errNotWin32File {
+		t.Fatalf("expected errNotWin32File, got %v", err)
+	}
+}
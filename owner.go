@@ -0,0 +1,118 @@
+package winio
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/Microsoft/go-winio/pkg/security"
+)
+
+//sys setSecurityInfo(handle syscall.Handle, objectType uint32, si uint32, owner *byte, group *byte, dacl *byte, sacl *byte) (win32err error) = advapi32.SetSecurityInfo
+//sys treeResetNamedSecurityInfo(name string, objectType uint32, si uint32, owner *byte, group *byte, dacl *byte, sacl *byte, keepExplicit bool, progress uintptr, invokeSetting uint32, args uintptr) (win32err error) = advapi32.TreeResetNamedSecurityInfoW
+
+const (
+	cSE_FILE_OBJECT = 1
+
+	cOWNER_SECURITY_INFORMATION            = 0x1
+	cDACL_SECURITY_INFORMATION             = 0x4
+	cUNPROTECTED_DACL_SECURITY_INFORMATION = 0x20000000
+
+	cFILE_LIST_DIRECTORY = 0x1
+	cREAD_CONTROL        = 0x20000
+)
+
+// TakeOwnership makes newOwner the owner of the file or directory at path. newOwner
+// may be an account name or a SID string such as "S-1-5-32-544". If recursive is true,
+// the owner of everything in the directory tree rooted at path is changed as well.
+// Reparse points are updated but never followed.
+//
+// The take ownership, backup, and restore privileges are enabled for the duration of
+// the call so that existing ACLs do not get in the way. The caller must hold these
+// privileges, which is usually the case for administrators.
+func TakeOwnership(path string, newOwner string, recursive bool) error {
+	return takeOwnership(path, newOwner, recursive, false)
+}
+
+// TakeOwnershipAndResetDacl behaves like TakeOwnership, but additionally replaces the
+// DACL of path with an empty, unprotected one, so that only ACEs inherited from the
+// parent directory remain. If recursive is true, the explicit ACEs of everything in the
+// tree are removed as well, leaving each file and directory with inherited ACEs only.
+func TakeOwnershipAndResetDacl(path string, newOwner string, recursive bool) error {
+	return takeOwnership(path, newOwner, recursive, true)
+}
+
+func takeOwnership(path string, newOwner string, recursive bool, resetDacl bool) error {
+	owner, err := sidFromString(newOwner)
+	if err != nil {
+		return err
+	}
+	var dacl []byte
+	if resetDacl {
+		dacl, err = (&security.ACL{}).Bytes()
+		if err != nil {
+			return err
+		}
+	}
+	privileges := []string{SeTakeOwnershipPrivilege, SeBackupPrivilege, SeRestorePrivilege}
+	return RunWithPrivileges(privileges, func() error {
+		if resetDacl && recursive {
+			return resetTree(path, owner, dacl)
+		}
+		// Setting the DACL of a directory propagates its inheritable ACEs to the
+		// existing children, so a non-recursive reset needs no walk either.
+		return setOwnerTree(path, owner, dacl, recursive)
+	})
+}
+
+// resetTree sets the owner and DACL of path and replaces the DACL of everything
+// beneath it with an empty one, so that only inherited ACEs remain.
+func resetTree(path string, owner []byte, dacl []byte) error {
+	si := uint32(cOWNER_SECURITY_INFORMATION | cDACL_SECURITY_INFORMATION | cUNPROTECTED_DACL_SECURITY_INFORMATION)
+	err := treeResetNamedSecurityInfo(path, cSE_FILE_OBJECT, si, &owner[0], nil, &dacl[0], nil, false, 0, 0, 0)
+	if err != nil {
+		return &os.PathError{Op: "TreeResetNamedSecurityInfo", Path: path, Err: err}
+	}
+	return nil
+}
+
+func setOwnerTree(path string, owner []byte, dacl []byte, recursive bool) error {
+	f, err := OpenForBackup(path, cREAD_CONTROL|WRITE_OWNER|WRITE_DAC|cFILE_LIST_DIRECTORY, syscall.FILE_SHARE_READ|syscall.FILE_SHARE_WRITE|syscall.FILE_SHARE_DELETE, syscall.OPEN_EXISTING)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	si := uint32(cOWNER_SECURITY_INFORMATION)
+	var daclp *byte
+	if dacl != nil {
+		si |= cDACL_SECURITY_INFORMATION | cUNPROTECTED_DACL_SECURITY_INFORMATION
+		daclp = &dacl[0]
+	}
+	err = setSecurityInfo(syscall.Handle(f.Fd()), cSE_FILE_OBJECT, si, &owner[0], nil, daclp, nil)
+	if err != nil {
+		return &os.PathError{Op: "SetSecurityInfo", Path: path, Err: err}
+	}
+	if !recursive {
+		return nil
+	}
+
+	bi, err := GetFileBasicInfo(f)
+	if err != nil {
+		return err
+	}
+	if bi.FileAttributes&syscall.FILE_ATTRIBUTE_DIRECTORY == 0 || bi.FileAttributes&syscall.FILE_ATTRIBUTE_REPARSE_POINT != 0 {
+		return nil
+	}
+	names, err := readDirNames(f)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		err = setOwnerTree(filepath.Join(path, name), owner, dacl, true)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
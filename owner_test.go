@@ -0,0 +1,140 @@
+package winio
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Microsoft/go-winio/pkg/security"
+	"golang.org/x/sys/windows"
+)
+
+const administratorsSid = "S-1-5-32-544"
+
+// makeOwnerTree creates a directory with a file and a subdirectory holding another
+// file, and returns the root and every path in the tree.
+func makeOwnerTree(t *testing.T) (string, []string) {
+	root, err := ioutil.TempDir("", "tst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub := filepath.Join(root, "sub")
+	paths := []string{root, filepath.Join(root, "file"), sub, filepath.Join(sub, "file")}
+	if err := os.Mkdir(sub, 0777); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{paths[1], paths[3]} {
+		if err := ioutil.WriteFile(p, []byte("test"), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root, paths
+}
+
+func currentUserSid(t *testing.T) *security.SID {
+	sid, err := security.TokenUser(windows.GetCurrentProcessToken())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sid
+}
+
+func takeOwnershipOrSkip(t *testing.T, f func(string, string, bool) error, path string, owner string, recursive bool) {
+	err := f(path, owner, recursive)
+	if _, ok := err.(*PrivilegeError); ok {
+		t.Skip("skipping without the take ownership, backup, and restore privileges")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func getFileSecurity(t *testing.T, path string) *security.SecurityDescriptor {
+	sd, err := security.GetNamedSecurityInfo(path, security.FileObject, security.OwnerSecurityInformation|security.DACLSecurityInformation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sd
+}
+
+func TestTakeOwnership(t *testing.T) {
+	root, paths := makeOwnerTree(t)
+	defer os.RemoveAll(root)
+
+	user := currentUserSid(t)
+	admins, err := security.ParseSID(administratorsSid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	takeOwnershipOrSkip(t, TakeOwnership, root, user.String(), true)
+	takeOwnershipOrSkip(t, TakeOwnership, root, administratorsSid, false)
+	for i, p := range paths {
+		expected := user
+		if i == 0 {
+			expected = admins
+		}
+		if owner := getFileSecurity(t, p).Owner; !owner.Equal(expected) {
+			t.Errorf("%s: owner is %s, expected %s", p, owner, expected)
+		}
+	}
+}
+
+func TestTakeOwnershipRecursive(t *testing.T) {
+	root, paths := makeOwnerTree(t)
+	defer os.RemoveAll(root)
+
+	user := currentUserSid(t)
+	admins, err := security.ParseSID(administratorsSid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	takeOwnershipOrSkip(t, TakeOwnership, root, user.String(), true)
+	takeOwnershipOrSkip(t, TakeOwnership, root, administratorsSid, true)
+	for _, p := range paths {
+		if owner := getFileSecurity(t, p).Owner; !owner.Equal(admins) {
+			t.Errorf("%s: owner is %s, expected %s", p, owner, admins)
+		}
+	}
+}
+
+func TestTakeOwnershipAndResetDacl(t *testing.T) {
+	root, paths := makeOwnerTree(t)
+	defer os.RemoveAll(root)
+
+	user := currentUserSid(t)
+	takeOwnershipOrSkip(t, TakeOwnershipAndResetDacl, root, user.String(), true)
+	for _, p := range paths {
+		sd := getFileSecurity(t, p)
+		if !sd.Owner.Equal(user) {
+			t.Errorf("%s: owner is %s, expected %s", p, sd.Owner, user)
+		}
+		if sd.DACL == nil {
+			t.Fatalf("%s: no DACL", p)
+		}
+		if sd.Control&security.ControlDACLProtected != 0 {
+			t.Errorf("%s: DACL is protected", p)
+		}
+		var explicit []security.ACE
+		for _, ace := range sd.DACL.ACEs {
+			if ace.Flags&security.InheritedACE == 0 {
+				explicit = append(explicit, ace)
+			}
+		}
+		if len(explicit) != 0 {
+			t.Errorf("%s: unexpected explicit ACEs %+v", p, explicit)
+		}
+		if len(sd.DACL.ACEs) == 0 {
+			t.Errorf("%s: no inherited ACEs", p)
+		}
+	}
+
+	// The ACEs inherited from the temporary directory still let the user open the files.
+	for _, p := range []string{paths[1], paths[3]} {
+		f, err := os.OpenFile(p, os.O_RDWR, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+	}
+}
@@ -2,20 +2,28 @@ package winio
 
 import (
 	"errors"
+	"fmt"
 	"io"
 	"net"
 	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
+	"unicode/utf16"
 	"unsafe"
 )
 
 //sys connectNamedPipe(pipe syscall.Handle, o *syscall.Overlapped) (err error) = ConnectNamedPipe
+//sys disconnectNamedPipe(pipe syscall.Handle) (err error) = DisconnectNamedPipe
 //sys createNamedPipe(name string, flags uint32, pipeMode uint32, maxInstances uint32, outSize uint32, inSize uint32, defaultTimeout uint32, sa *securityAttributes) (handle syscall.Handle, err error)  [failretval==syscall.InvalidHandle] = CreateNamedPipeW
 //sys createFile(name string, access uint32, mode uint32, sa *securityAttributes, createmode uint32, attrs uint32, templatefile syscall.Handle) (handle syscall.Handle, err error) [failretval==syscall.InvalidHandle] = CreateFileW
 //sys waitNamedPipe(name string, timeout uint32) (err error) = WaitNamedPipeW
 //sys getNamedPipeInfo(pipe syscall.Handle, flags *uint32, outSize *uint32, inSize *uint32, maxInstances *uint32) (err error) = GetNamedPipeInfo
 //sys getNamedPipeHandleState(pipe syscall.Handle, state *uint32, curInstances *uint32, maxCollectionCount *uint32, collectDataTimeout *uint32, userName *uint16, maxUserNameSize uint32) (err error) = GetNamedPipeHandleStateW
+//sys impersonateNamedPipeClient(pipe syscall.Handle) (err error) = advapi32.ImpersonateNamedPipeClient
 
 type securityAttributes struct {
 	Length             uint32
@@ -24,14 +32,20 @@ type securityAttributes struct {
 }
 
 const (
-	cERROR_PIPE_BUSY      = syscall.Errno(231)
-	cERROR_PIPE_CONNECTED = syscall.Errno(535)
-	cERROR_SEM_TIMEOUT    = syscall.Errno(121)
+	cERROR_PIPE_BUSY          = syscall.Errno(231)
+	cERROR_NO_DATA            = syscall.Errno(232)
+	cERROR_PIPE_NOT_CONNECTED = syscall.Errno(233)
+	cERROR_PIPE_CONNECTED     = syscall.Errno(535)
+	cERROR_SEM_TIMEOUT        = syscall.Errno(121)
 
 	cPIPE_ACCESS_DUPLEX            = 0x3
 	cFILE_FLAG_FIRST_PIPE_INSTANCE = 0x80000
+	cFILE_FLAG_WRITE_THROUGH       = 0x80000000
 	cSECURITY_SQOS_PRESENT         = 0x100000
 	cSECURITY_ANONYMOUS            = 0
+	cSECURITY_IDENTIFICATION       = 0x10000
+	cSECURITY_IMPERSONATION        = 0x20000
+	cSECURITY_DELEGATION           = 0x30000
 
 	cPIPE_REJECT_REMOTE_CLIENTS = 0x8
 
@@ -51,11 +65,21 @@ var (
 	ErrPipeListenerClosed = errors.New("use of closed network connection")
 
 	errPipeWriteClosed = errors.New("pipe has been closed for write")
+	errInvalidPipePath = errors.New("not a named pipe path")
+	errInvalidPipeName = errors.New("invalid character in named pipe path")
+	errPipeNameTooLong = errors.New("named pipe name too long")
+	errNotPipeConn     = errors.New("not a named pipe connection")
 )
 
 type win32Pipe struct {
 	*win32File
 	path string
+
+	// flushTimeout is set for pipes returned by Accept whose listener has a positive
+	// FlushTimeout. They are flushed and disconnected when they are closed; flushed
+	// is set once that has started.
+	flushTimeout time.Duration
+	flushed      int32
 }
 
 type win32MessageBytePipe struct {
@@ -66,12 +90,126 @@ type win32MessageBytePipe struct {
 
 type pipeAddress string
 
+// PipeAddr is the address of a named pipe, \\<server>\pipe\<name>.
+type PipeAddr struct {
+	// Server is the name of the machine hosting the pipe, or "." for the local machine.
+	Server string
+
+	// Name is the name of the pipe, without the \\<server>\pipe\ prefix.
+	Name string
+}
+
+// maxPipeNameLength is the maximum length of the name of a pipe, in UTF-16
+// characters.
+const maxPipeNameLength = 256
+
+// ParsePipeAddr parses a named pipe path of the form \\<server>\pipe\<name>. Either
+// slashes or backslashes may be used as separators. The server \\?\ is treated as the
+// local machine, like \\.\.
+func ParsePipeAddr(path string) (*PipeAddr, error) {
+	p := strings.Replace(path, "/", `\`, -1)
+	if !strings.HasPrefix(p, `\\`) {
+		return nil, &os.PathError{Op: "parse", Path: path, Err: errInvalidPipePath}
+	}
+	parts := strings.SplitN(p[2:], `\`, 3)
+	if len(parts) != 3 || parts[0] == "" || !strings.EqualFold(parts[1], "pipe") || parts[2] == "" {
+		return nil, &os.PathError{Op: "parse", Path: path, Err: errInvalidPipePath}
+	}
+	server, name := parts[0], parts[2]
+	if server == "?" {
+		server = "."
+	}
+	if strings.ContainsAny(server, `:*?"<>| `+"\x00") || strings.ContainsRune(name, 0) {
+		return nil, &os.PathError{Op: "parse", Path: path, Err: errInvalidPipeName}
+	}
+	if len(utf16.Encode([]rune(name))) > maxPipeNameLength {
+		return nil, &os.PathError{Op: "parse", Path: path, Err: errPipeNameTooLong}
+	}
+	return &PipeAddr{Server: server, Name: name}, nil
+}
+
+// ParsePipePath validates a named pipe path, as accepted by ParsePipeAddr, and returns
+// it in the normalized form \\<server>\pipe\<name> that DialPipe and ListenPipe use.
+func ParsePipePath(path string) (string, error) {
+	a, err := ParsePipeAddr(path)
+	if err != nil {
+		return "", err
+	}
+	return a.String(), nil
+}
+
+// IsLocal reports whether the pipe is on the local machine.
+func (a *PipeAddr) IsLocal() bool {
+	return a.Server == "" || a.Server == "."
+}
+
+// Local returns the path of the pipe with the same name on the local machine.
+func (a *PipeAddr) Local() *PipeAddr {
+	return &PipeAddr{Server: ".", Name: a.Name}
+}
+
+// OnServer returns the UNC path of the pipe with the same name on server.
+func (a *PipeAddr) OnServer(server string) *PipeAddr {
+	return &PipeAddr{Server: server, Name: a.Name}
+}
+
+func (a *PipeAddr) Network() string {
+	return "pipe"
+}
+
+// String returns the path of the pipe, which can be passed to DialPipe.
+func (a *PipeAddr) String() string {
+	server := a.Server
+	if server == "" {
+		server = "."
+	}
+	return `\\` + server + `\pipe\` + a.Name
+}
+
+// makePipeAddr returns the address for a pipe path. Paths that are not of the form
+// \\<server>\pipe\<name> are reported as is.
+func makePipeAddr(path string) net.Addr {
+	if a, err := ParsePipeAddr(path); err == nil {
+		return a
+	}
+	return pipeAddress(path)
+}
+
 func (f *win32Pipe) LocalAddr() net.Addr {
-	return pipeAddress(f.path)
+	return makePipeAddr(f.path)
 }
 
 func (f *win32Pipe) RemoteAddr() net.Addr {
-	return pipeAddress(f.path)
+	return makePipeAddr(f.path)
+}
+
+// Close closes the pipe. On the server end, if the listener has a FlushTimeout, Close
+// first waits up to that long for the client to read any data that is still in the
+// pipe, and then disconnects the client, so that short-lived clients do not lose the
+// tail of the server's output.
+func (f *win32Pipe) Close() error {
+	if f.flushTimeout > 0 && atomic.CompareAndSwapInt32(&f.flushed, 0, 1) {
+		f.flushAndDisconnect()
+	}
+	return f.win32File.Close()
+}
+
+func (f *win32Pipe) flushAndDisconnect() {
+	f.wg.Add(1)
+	defer f.wg.Done()
+	// FlushFileBuffers blocks until the client has read everything, so run it on a
+	// separate thread. Disconnecting the pipe makes it return early.
+	ch := make(chan error, 1)
+	go func() {
+		ch <- syscall.FlushFileBuffers(f.handle)
+	}()
+	select {
+	case <-ch:
+		disconnectNamedPipe(f.handle)
+	case <-time.After(f.flushTimeout):
+		disconnectNamedPipe(f.handle)
+		<-ch
+	}
 }
 
 func (f *win32Pipe) SetDeadline(t time.Time) error {
@@ -85,7 +223,7 @@ func (f *win32MessageBytePipe) CloseWrite() error {
 	if f.writeClosed {
 		return errPipeWriteClosed
 	}
-	_, err := f.win32File.Write(nil)
+	_, err := f.win32Pipe.Write(nil)
 	if err != nil {
 		return err
 	}
@@ -102,7 +240,7 @@ func (f *win32MessageBytePipe) Write(b []byte) (int, error) {
 	if len(b) == 0 {
 		return 0, nil
 	}
-	return f.win32File.Write(b)
+	return f.win32Pipe.Write(b)
 }
 
 // Read reads bytes from a message pipe in byte mode. A read of a zero-byte message on a message
@@ -135,14 +273,67 @@ func (s pipeAddress) String() string {
 // takes longer than the specified duration. If timeout is nil, then the timeout
 // is the default timeout established by the pipe server.
 func DialPipe(path string, timeout *time.Duration) (net.Conn, error) {
+	return DialPipeImpLevel(path, timeout, PipeImpLevelAnonymous)
+}
+
+// PipeImpLevel is the impersonation level that a pipe client allows the server to
+// use with its identity.
+type PipeImpLevel uint32
+
+const (
+	// PipeImpLevelAnonymous prevents the server from identifying or impersonating
+	// the client. This is the level used by DialPipe.
+	PipeImpLevelAnonymous = PipeImpLevel(cSECURITY_ANONYMOUS)
+	// PipeImpLevelIdentification lets the server query the client's identity and
+	// privileges, but not act as the client.
+	PipeImpLevelIdentification = PipeImpLevel(cSECURITY_IDENTIFICATION)
+	// PipeImpLevelImpersonation lets the server act as the client on the local
+	// system.
+	PipeImpLevelImpersonation = PipeImpLevel(cSECURITY_IMPERSONATION)
+	// PipeImpLevelDelegation lets the server act as the client on remote systems as
+	// well.
+	PipeImpLevelDelegation = PipeImpLevel(cSECURITY_DELEGATION)
+)
+
+// DialPipeImpLevel connects to a named pipe by path like DialPipe, offering the server
+// the given impersonation level.
+func DialPipeImpLevel(path string, timeout *time.Duration, level PipeImpLevel) (net.Conn, error) {
+	return DialPipeConfig(path, timeout, &PipeDialConfig{ImpLevel: level})
+}
+
+// PipeDialConfig contains options for DialPipeConfig.
+type PipeDialConfig struct {
+	// ImpLevel is the impersonation level offered to the server. The default is
+	// PipeImpLevelAnonymous.
+	ImpLevel PipeImpLevel
+
+	// WriteThrough enables write-through mode, so that writes do not return until
+	// the data has been transmitted to the server. This only affects byte mode pipes
+	// whose server is on a remote machine.
+	WriteThrough bool
+}
+
+// DialPipeConfig connects to a named pipe by path like DialPipe, with the options in c,
+// which may be nil.
+func DialPipeConfig(path string, timeout *time.Duration, c *PipeDialConfig) (net.Conn, error) {
 	var absTimeout time.Time
 	if timeout != nil {
 		absTimeout = time.Now().Add(*timeout)
 	}
-	var err error
+	path, err := ParsePipePath(path)
+	if err != nil {
+		return nil, err
+	}
+	if c == nil {
+		c = &PipeDialConfig{}
+	}
+	attrs := syscall.FILE_FLAG_OVERLAPPED | cSECURITY_SQOS_PRESENT | uint32(c.ImpLevel)
+	if c.WriteThrough {
+		attrs |= cFILE_FLAG_WRITE_THROUGH
+	}
 	var h syscall.Handle
 	for {
-		h, err = createFile(path, syscall.GENERIC_READ|syscall.GENERIC_WRITE, 0, nil, syscall.OPEN_EXISTING, syscall.FILE_FLAG_OVERLAPPED|cSECURITY_SQOS_PRESENT|cSECURITY_ANONYMOUS, 0)
+		h, err = createFile(path, syscall.GENERIC_READ|syscall.GENERIC_WRITE, 0, nil, syscall.OPEN_EXISTING, attrs, 0)
 		if err != cERROR_PIPE_BUSY {
 			break
 		}
@@ -212,6 +403,14 @@ type win32PipeListener struct {
 	acceptCh           chan (chan acceptResponse)
 	closeCh            chan int
 	doneCh             chan int
+
+	// When config.AcceptBacklog is positive, backlogRoutine keeps that many instances
+	// outstanding. Each holds a slot until Accept receives its result from backlog.
+	backlog     chan acceptResponse
+	slots       chan struct{}
+	pendingLock sync.Mutex
+	pending     map[*win32File]struct{}
+	connectWg   sync.WaitGroup
 }
 
 func makeServerPipeHandle(path string, securityDescriptor []byte, c *PipeConfig, first bool) (syscall.Handle, error) {
@@ -290,7 +489,79 @@ func (l *win32PipeListener) listenerRoutine() {
 	close(l.doneCh)
 }
 
+func (l *win32PipeListener) backlogRoutine() {
+	for {
+		select {
+		case l.slots <- struct{}{}:
+		case <-l.closeCh:
+			l.closeBacklog()
+			return
+		}
+		p, err := l.makeServerPipe()
+		if err != nil {
+			// Report the error to Accept, which frees the slot, rather than retrying
+			// immediately.
+			l.backlog <- acceptResponse{nil, err}
+			continue
+		}
+		l.pendingLock.Lock()
+		l.pending[p] = struct{}{}
+		l.pendingLock.Unlock()
+		l.connectWg.Add(1)
+		go func() {
+			defer l.connectWg.Done()
+			err := connectPipe(p)
+			l.pendingLock.Lock()
+			delete(l.pending, p)
+			l.pendingLock.Unlock()
+			if err != nil {
+				p.Close()
+				p = nil
+				if err == ErrFileClosed {
+					err = ErrPipeListenerClosed
+				}
+			}
+			l.backlog <- acceptResponse{p, err}
+		}()
+	}
+}
+
+// closeBacklog aborts the pending connect requests, and disconnects the clients that
+// have connected but not been accepted.
+func (l *win32PipeListener) closeBacklog() {
+	l.pendingLock.Lock()
+	var pending []*win32File
+	for p := range l.pending {
+		pending = append(pending, p)
+	}
+	l.pendingLock.Unlock()
+	for _, p := range pending {
+		p.Close()
+	}
+	// The backlog has room for the result of every connect request, so these have
+	// all finished without blocking.
+	l.connectWg.Wait()
+	for {
+		select {
+		case r := <-l.backlog:
+			if r.f != nil {
+				r.f.Close()
+			}
+		default:
+			syscall.Close(l.firstHandle)
+			l.firstHandle = 0
+			close(l.doneCh)
+			return
+		}
+	}
+}
+
 // PipeConfig contain configuration for the pipe listener.
+//
+// There is no server-side write-through option: FILE_FLAG_WRITE_THROUGH only affects
+// byte mode pipes whose other end is on a remote machine, and listeners always reject
+// remote clients with PIPE_REJECT_REMOTE_CLIENTS, so it would have no effect. To make
+// sure clients receive the last writes before the pipe is closed, use FlushTimeout.
 type PipeConfig struct {
 	// SecurityDescriptor contains a Windows security descriptor in SDDL format.
 	SecurityDescriptor string
@@ -308,6 +579,19 @@ type PipeConfig struct {
 
 	// OutputBufferSize specifies the size the input buffer, in bytes.
 	OutputBufferSize int32
+
+	// FlushTimeout is the maximum time that closing an accepted connection waits
+	// for the client to read the data remaining in the pipe before disconnecting
+	// it. If zero or negative, Close closes the pipe immediately and unread data is
+	// discarded.
+	FlushTimeout time.Duration
+
+	// AcceptBacklog is the number of pipe instances the listener keeps waiting for
+	// clients to connect, whether or not Accept is being called. Clients that connect
+	// while Accept is not being called are queued in these instances, rather than
+	// failing with ERROR_PIPE_BUSY, which smooths bursts of connections. If zero, an
+	// instance is only created while Accept is being called.
+	AcceptBacklog int
 }
 
 // ListenPipe creates a listener on a Windows named pipe path, e.g. \\.\pipe\mypipe.
@@ -320,6 +604,10 @@ func ListenPipe(path string, c *PipeConfig) (net.Listener, error) {
 	if c == nil {
 		c = &PipeConfig{}
 	}
+	path, err = ParsePipePath(path)
+	if err != nil {
+		return nil, err
+	}
 	if c.SecurityDescriptor != "" {
 		sd, err = SddlToSecurityDescriptor(c.SecurityDescriptor)
 		if err != nil {
@@ -347,7 +635,14 @@ func ListenPipe(path string, c *PipeConfig) (net.Listener, error) {
 		closeCh:            make(chan int),
 		doneCh:             make(chan int),
 	}
-	go l.listenerRoutine()
+	if c.AcceptBacklog > 0 {
+		l.backlog = make(chan acceptResponse, c.AcceptBacklog)
+		l.slots = make(chan struct{}, c.AcceptBacklog)
+		l.pending = make(map[*win32File]struct{})
+		go l.backlogRoutine()
+	} else {
+		go l.listenerRoutine()
+	}
 	return l, nil
 }
 
@@ -365,23 +660,67 @@ func connectPipe(p *win32File) error {
 }
 
 func (l *win32PipeListener) Accept() (net.Conn, error) {
-	ch := make(chan acceptResponse)
-	select {
-	case l.acceptCh <- ch:
-		response := <-ch
-		err := response.err
-		if err != nil {
-			return nil, err
+	var response acceptResponse
+	if l.backlog != nil {
+		select {
+		case response = <-l.backlog:
+			<-l.slots
+		case <-l.doneCh:
+			return nil, ErrPipeListenerClosed
 		}
-		if l.config.MessageMode {
-			return &win32MessageBytePipe{
-				win32Pipe: win32Pipe{win32File: response.f, path: l.path},
-			}, nil
+	} else {
+		ch := make(chan acceptResponse)
+		select {
+		case l.acceptCh <- ch:
+			response = <-ch
+		case <-l.doneCh:
+			return nil, ErrPipeListenerClosed
 		}
-		return &win32Pipe{win32File: response.f, path: l.path}, nil
-	case <-l.doneCh:
-		return nil, ErrPipeListenerClosed
 	}
+	if response.err != nil {
+		return nil, response.err
+	}
+	p := win32Pipe{
+		win32File:    response.f,
+		path:         l.path,
+		flushTimeout: l.config.FlushTimeout,
+	}
+	if l.config.MessageMode {
+		return &win32MessageBytePipe{win32Pipe: p}, nil
+	}
+	return &p, nil
+}
+
+// RunAsPipeClient runs fn while the calling thread impersonates the client of c, a
+// connection returned by the Accept method of a pipe listener. The server must have read
+// from c first. How far the client can be impersonated depends on the PipeImpLevel it
+// dialed with; at PipeImpLevelIdentification, fn can open the thread token to find out
+// who the client is, for example to pass it to security.AccessCheck, but cannot access
+// resources as the client. The goroutine is locked to its thread for the duration of
+// the call, and the impersonation is reverted when fn returns or panics.
+func RunAsPipeClient(c net.Conn, fn func() error) error {
+	var p *win32Pipe
+	switch c := c.(type) {
+	case *win32Pipe:
+		p = c
+	case *win32MessageBytePipe:
+		p = &c.win32Pipe
+	default:
+		return errNotPipeConn
+	}
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	err := impersonateNamedPipeClient(p.handle)
+	if err != nil {
+		return &os.PathError{Op: "ImpersonateNamedPipeClient", Path: p.path, Err: err}
+	}
+	defer func() {
+		err := revertToSelf()
+		if err != nil {
+			panic(err)
+		}
+	}()
+	return fn()
 }
 
 func (l *win32PipeListener) Close() error {
@@ -394,5 +733,43 @@ func (l *win32PipeListener) Close() error {
 }
 
 func (l *win32PipeListener) Addr() net.Addr {
-	return pipeAddress(l.path)
+	return makePipeAddr(l.path)
+}
+
+var pipePairCount uint32
+
+// PipePair returns the client and server ends of a connection over a new, uniquely named
+// pipe, listening with configuration c. The pipe is removed once both ends are closed.
+// It is intended for tests that exercise pipe-specific behavior, such as message mode or
+// deadlines; net.Pipe provides an in-memory equivalent when that is not needed.
+func PipePair(c *PipeConfig) (client net.Conn, server net.Conn, err error) {
+	path := fmt.Sprintf(`\\.\pipe\winio-pair-%d-%d-%d`, os.Getpid(), atomic.AddUint32(&pipePairCount, 1), time.Now().UnixNano())
+	l, err := ListenPipe(path, c)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer l.Close()
+
+	type response struct {
+		c   net.Conn
+		err error
+	}
+	ch := make(chan response)
+	go func() {
+		c, err := l.Accept()
+		ch <- response{c, err}
+	}()
+
+	client, err = DialPipe(path, nil)
+	if err != nil {
+		l.Close()
+		<-ch
+		return nil, nil, err
+	}
+	r := <-ch
+	if r.err != nil {
+		client.Close()
+		return nil, nil, r.err
+	}
+	return client, r.c, nil
 }
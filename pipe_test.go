@@ -2,12 +2,19 @@ package winio
 
 import (
 	"bufio"
+	"bytes"
+	"fmt"
 	"io"
+	"io/ioutil"
 	"net"
 	"os"
+	"strings"
 	"syscall"
 	"testing"
 	"time"
+
+	"github.com/Microsoft/go-winio/pkg/security"
+	"golang.org/x/sys/windows"
 )
 
 var testPipeName = `\\.\pipe\winiotestpipe`
@@ -157,6 +164,218 @@ func TestFullListenDialReadWrite(t *testing.T) {
 	<-ch
 }
 
+func TestDialPipeImpLevel(t *testing.T) {
+	for _, level := range []PipeImpLevel{PipeImpLevelAnonymous, PipeImpLevelIdentification, PipeImpLevelImpersonation, PipeImpLevelDelegation} {
+		l, err := ListenPipe(testPipeName, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ch := make(chan int)
+		go server(l, ch)
+
+		c, err := DialPipeImpLevel(testPipeName, nil, level)
+		if err != nil {
+			l.Close()
+			t.Fatal(err)
+		}
+
+		_, err = c.Write([]byte("hello\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, err := bufio.NewReader(c).ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s != "got hello\n" {
+			t.Errorf("level %#x: expected 'got hello', got '%s'", level, s)
+		}
+		<-ch
+		c.Close()
+		l.Close()
+	}
+}
+
+func TestRunAsPipeClient(t *testing.T) {
+	user := currentUserSid(t)
+	l, err := ListenPipe(testPipeName, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	ch := make(chan error, 1)
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			ch <- err
+			return
+		}
+		defer c.Close()
+		if _, err := c.Read(make([]byte, 1)); err != nil {
+			ch <- err
+			return
+		}
+		ch <- RunAsPipeClient(c, func() error {
+			var token windows.Token
+			err := windows.OpenThreadToken(windows.CurrentThread(), windows.TOKEN_QUERY, true, &token)
+			if err != nil {
+				return err
+			}
+			defer token.Close()
+			sid, err := security.TokenUser(token)
+			if err != nil {
+				return err
+			}
+			if !sid.Equal(user) {
+				return fmt.Errorf("client is %s, expected %s", sid, user)
+			}
+			return nil
+		})
+	}()
+
+	c, err := DialPipeImpLevel(testPipeName, nil, PipeImpLevelIdentification)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if _, err = c.Write([]byte("x")); err != nil {
+		t.Fatal(err)
+	}
+	if err = <-ch; err != nil {
+		t.Fatal(err)
+	}
+	p, _ := net.Pipe()
+	defer p.Close()
+	if err = RunAsPipeClient(p, func() error { return nil }); err != errNotPipeConn {
+		t.Fatalf("expected errNotPipeConn, got %v", err)
+	}
+}
+
+func TestServerCloseFlushesData(t *testing.T) {
+	l, err := ListenPipe(testPipeName, &PipeConfig{FlushTimeout: 5 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	data := make([]byte, 256*1024)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	ch := make(chan error)
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			ch <- err
+			return
+		}
+		_, err = c.Write(data)
+		c.Close()
+		ch <- err
+	}()
+
+	c, err := DialPipe(testPipeName, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// Give the server a chance to close before the data has been read.
+	time.Sleep(100 * time.Millisecond)
+	b, err := ioutil.ReadAll(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, data) {
+		t.Fatalf("read %d bytes, expected %d", len(b), len(data))
+	}
+	if err = <-ch; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestServerCloseFlushTimeout(t *testing.T) {
+	l, err := ListenPipe(testPipeName, &PipeConfig{FlushTimeout: 100 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	ch := make(chan error)
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			ch <- err
+			return
+		}
+		_, err = c.Write([]byte("unread"))
+		c.Close()
+		ch <- err
+	}()
+
+	c, err := DialPipe(testPipeName, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	start := time.Now()
+	select {
+	case err = <-ch:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("server close did not time out")
+	}
+	if d := time.Since(start); d < 50*time.Millisecond {
+		t.Fatalf("server close returned after %v without waiting for the client", d)
+	}
+	// The client was disconnected, so the data it did not read was discarded.
+	b, _ := ioutil.ReadAll(c)
+	if len(b) != 0 {
+		t.Fatalf("read %q after the flush timed out", b)
+	}
+}
+
+func TestServerCloseWithoutFlushTimeout(t *testing.T) {
+	l, err := ListenPipe(testPipeName, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	ch := make(chan error)
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			ch <- err
+			return
+		}
+		_, err = c.Write([]byte("unread"))
+		c.Close()
+		ch <- err
+	}()
+
+	c, err := DialPipe(testPipeName, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// Without a FlushTimeout, Close does not wait for the client to read.
+	select {
+	case err = <-ch:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("server close waited for the client")
+	}
+}
+
 func TestCloseAbortsListen(t *testing.T) {
 	l, err := ListenPipe(testPipeName, nil)
 	if err != nil {
@@ -260,3 +479,297 @@ func TestDialTimesOutByDefault(t *testing.T) {
 		t.Fatalf("expected ErrTimeout, got %v", err)
 	}
 }
+
+func TestParsePipeAddr(t *testing.T) {
+	a, err := ParsePipeAddr(`//server/PIPE/some\name`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Server != "server" || a.Name != `some\name` {
+		t.Fatalf("unexpected address %+v", a)
+	}
+	if s := a.String(); s != `\\server\pipe\some\name` {
+		t.Fatalf("unexpected string %s", s)
+	}
+	for _, p := range []string{`c:\pipe\foo`, `\\.\pipe\`, `\\.\notpipe\foo`, `\\\pipe\foo`} {
+		_, err = ParsePipeAddr(p)
+		if err == nil {
+			t.Fatalf("expected failure parsing %s", p)
+		}
+	}
+}
+
+func TestParsePipePath(t *testing.T) {
+	for _, test := range []struct{ path, expected string }{
+		{`\\.\pipe\foo`, `\\.\pipe\foo`},
+		{`//./PIPE/foo/bar`, `\\.\pipe\foo\bar`},
+		{`\\?\pipe\foo`, `\\.\pipe\foo`},
+		{`\\server\Pipe\foo`, `\\server\pipe\foo`},
+	} {
+		p, err := ParsePipePath(test.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.path, test.expected, p)
+		}
+	}
+	for _, p := range []string{`\\a:b\pipe\foo`, `\\server name\pipe\foo`, "\\\\.\\pipe\\foo\x00", `\\.\pipe\` + strings.Repeat("x", 257)} {
+		if _, err := ParsePipePath(p); err == nil {
+			t.Errorf("expected failure parsing %q", p)
+		}
+	}
+	if _, err := DialPipe(`\\.\notpipe\foo`, nil); err == nil {
+		t.Error("expected DialPipe to reject an invalid path")
+	}
+
+	a, err := ParsePipeAddr(`\\server\pipe\foo`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.IsLocal() || !a.Local().IsLocal() || a.Local().String() != `\\.\pipe\foo` {
+		t.Fatalf("unexpected local address %s", a.Local())
+	}
+	if s := a.Local().OnServer("other").String(); s != `\\other\pipe\foo` {
+		t.Fatalf("unexpected remote address %s", s)
+	}
+}
+
+func TestPipeAddr(t *testing.T) {
+	l, err := ListenPipe(testPipeName, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	a, ok := l.Addr().(*PipeAddr)
+	if !ok {
+		t.Fatalf("expected *PipeAddr, got %T", l.Addr())
+	}
+	if a.Network() != "pipe" || a.String() != testPipeName {
+		t.Fatalf("unexpected address %s %s", a.Network(), a)
+	}
+}
+
+func TestPipePair(t *testing.T) {
+	client, server, err := PipePair(&PipeConfig{MessageMode: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	defer server.Close()
+
+	client2, server2, err := PipePair(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client2.Close()
+	defer server2.Close()
+	if client.RemoteAddr().String() == client2.RemoteAddr().String() {
+		t.Fatal("pipe pairs share a name")
+	}
+
+	_, err = server.Write([]byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = server.(interface {
+		CloseWrite() error
+	}).CloseWrite()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "hello" {
+		t.Fatalf("unexpected data %q", b)
+	}
+
+	client2.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+	_, err = client2.Read(make([]byte, 1))
+	if err != ErrTimeout {
+		t.Fatalf("expected timeout, got %v", err)
+	}
+}
+
+func TestPipeFlush(t *testing.T) {
+	l, err := ListenPipe(testPipeName, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	c, err := DialPipeConfig(testPipeName, nil, &PipeDialConfig{WriteThrough: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	s, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if _, err = s.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	ch := make(chan error)
+	go func() {
+		ch <- s.(Flusher).Flush()
+	}()
+	select {
+	case err := <-ch:
+		t.Fatalf("flush completed before the data was read: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	b := make([]byte, 5)
+	if _, err = io.ReadFull(c, b); err != nil {
+		t.Fatal(err)
+	}
+	if err = <-ch; err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "hello" {
+		t.Fatalf("unexpected data %q", b)
+	}
+}
+
+func benchmarkPipeEcho(b *testing.B, deadline bool) {
+	client, server, err := PipePair(nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer client.Close()
+	defer server.Close()
+	go io.Copy(server, server)
+
+	buf := make([]byte, 1024)
+	b.SetBytes(int64(len(buf)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if deadline {
+			client.SetDeadline(time.Now().Add(time.Minute))
+		}
+		if _, err := client.Write(buf); err != nil {
+			b.Fatal(err)
+		}
+		if _, err := io.ReadFull(client, buf); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkPipeEcho(b *testing.B) {
+	benchmarkPipeEcho(b, false)
+}
+
+func BenchmarkPipeEchoDeadline(b *testing.B) {
+	benchmarkPipeEcho(b, true)
+}
+
+func TestPipeDeadlineReuse(t *testing.T) {
+	client, server, err := PipePair(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	defer server.Close()
+
+	// Alternate reads that complete before their deadline with reads that time
+	// out, so that operations and their timers are reused in both states.
+	b := make([]byte, 1)
+	for i := 0; i < 10; i++ {
+		client.SetReadDeadline(time.Now().Add(5 * time.Second))
+		go server.Write([]byte{byte(i)})
+		if _, err := client.Read(b); err != nil {
+			t.Fatal(err)
+		}
+		if b[0] != byte(i) {
+			t.Fatalf("read %d, expected %d", b[0], i)
+		}
+		client.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+		if _, err := client.Read(b); err != ErrTimeout {
+			t.Fatalf("expected timeout, got %v", err)
+		}
+	}
+}
+
+func TestPipeAcceptBacklog(t *testing.T) {
+	const backlog = 4
+	l, err := ListenPipe(testPipeName, &PipeConfig{AcceptBacklog: backlog})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	// Every client connects without waiting for Accept.
+	var clients []net.Conn
+	for i := 0; i < backlog; i++ {
+		d := 2 * time.Second
+		c, err := DialPipe(testPipeName, &d)
+		if err != nil {
+			t.Fatalf("client %d: %v", i, err)
+		}
+		defer c.Close()
+		if _, err := c.Write([]byte{byte(i)}); err != nil {
+			t.Fatal(err)
+		}
+		clients = append(clients, c)
+	}
+	seen := make(map[byte]bool)
+	for range clients {
+		s, err := l.Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b := make([]byte, 1)
+		if _, err := io.ReadFull(s, b); err != nil {
+			t.Fatal(err)
+		}
+		seen[b[0]] = true
+		s.Close()
+	}
+	if len(seen) != backlog {
+		t.Fatalf("accepted %v, expected %d distinct clients", seen, backlog)
+	}
+}
+
+func TestPipeAcceptBacklogClose(t *testing.T) {
+	l, err := ListenPipe(testPipeName, &PipeConfig{AcceptBacklog: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := 2 * time.Second
+	c, err := DialPipe(testPipeName, &d)
+	if err != nil {
+		l.Close()
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// Closing the listener disconnects the client that was never accepted.
+	l.Close()
+	if _, err := c.Read(make([]byte, 1)); err == nil {
+		t.Fatal("expected read from unaccepted client to fail")
+	}
+	if _, err := l.Accept(); err != ErrPipeListenerClosed {
+		t.Fatalf("expected ErrPipeListenerClosed, got %v", err)
+	}
+}
+
+func TestPipeWriteBrokenPipe(t *testing.T) {
+	for _, c := range []*PipeConfig{nil, {MessageMode: true}} {
+		client, server, err := PipePair(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		client.Close()
+		_, err = server.Write([]byte("hello"))
+		server.Close()
+		if !IsBrokenPipe(err) {
+			t.Fatalf("expected a broken pipe error, got %v", err)
+		}
+	}
+}
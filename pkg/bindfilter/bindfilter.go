@@ -0,0 +1,219 @@
+// Package bindfilter manages the directory mappings of the Windows bind filter
+// (bindflt.sys), which makes the contents of a target directory appear at a
+// virtualization root, as container runtimes do to map volumes.
+package bindfilter
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"strings"
+	"syscall"
+	"unicode/utf16"
+	"unsafe"
+
+	"github.com/Microsoft/go-winio/pkg/fs"
+)
+
+//sys bfSetupFilter(job syscall.Handle, flags uint32, root string, target string, exceptions **uint16, exceptionCount uint32) (hr error) = bindfltapi.BfSetupFilter
+//sys bfRemoveMapping(job syscall.Handle, root string) (hr error) = bindfltapi.BfRemoveMapping
+//sys bfGetMappings(flags uint32, job syscall.Handle, root *uint16, sid *byte, size *uint32, buffer *byte) (hr error) = bindfltapi.BfGetMappings
+
+const (
+	cBINDFLT_GET_MAPPINGS_FLAG_VOLUME = 0x1
+	cBINDFLT_GET_MAPPINGS_FLAG_SILO   = 0x2
+
+	cHRESULT_ERROR_ACCESS_DENIED       = syscall.Errno(0x80070005)
+	cHRESULT_ERROR_INSUFFICIENT_BUFFER = syscall.Errno(0x8007007a)
+
+	// The response to BfGetMappings is a header of three uint32s followed by an
+	// entry of five uint32s per mapping and, for each mapping, its targets as pairs
+	// of uint32s. All offsets are from the start of the response.
+	mappingsHeaderSize = 12
+	mappingEntrySize   = 20
+	targetEntrySize    = 8
+)
+
+var errInvalidMappings = errors.New("invalid bind filter mapping data")
+
+// Flags control how a mapping behaves.
+type Flags uint32
+
+const (
+	// ReadOnly makes the mapping read-only.
+	ReadOnly Flags = 0x1
+	// Merged merges the contents of the target with those of the root, rather than
+	// hiding the root's contents.
+	Merged Flags = 0x2
+	// UseCurrentSiloMapping applies the mapping to the job's silo using the silo's
+	// current view of the target.
+	UseCurrentSiloMapping Flags = 0x4
+	// ReparseOnFiles allows the root and target to be files.
+	ReparseOnFiles Flags = 0x8
+	// SkipSharingCheck skips the check that the target is not shared.
+	SkipSharingCheck Flags = 0x10
+	// NoMultipleTargets fails the mapping if the root already has a target.
+	NoMultipleTargets Flags = 0x40
+)
+
+// Mapping is a bind mapping on a volume.
+type Mapping struct {
+	// Root is the virtualization root, relative to the root of the volume, such as
+	// \mnt\data.
+	Root string
+	// Targets are the directories mapped to Root, as reported by the bind filter.
+	Targets []string
+	Flags   Flags
+}
+
+func checkAPI() error {
+	if err := modbindfltapi.Load(); err != nil {
+		return &os.SyscallError{Syscall: "bindfltapi.dll", Err: err}
+	}
+	return nil
+}
+
+// AddMapping maps the directory target to root, which must exist, for all processes
+// on the system. Paths under root listed in exceptions are not mapped. Mappings do
+// not persist across reboots.
+func AddMapping(root, target string, flags Flags, exceptions []string) error {
+	return AddJobMapping(0, root, target, flags, exceptions)
+}
+
+// AddJobMapping is like AddMapping, but the mapping applies only to the processes in
+// the silo of the job object job. Only server silos can have mappings of their own.
+func AddJobMapping(job syscall.Handle, root, target string, flags Flags, exceptions []string) error {
+	if err := checkAPI(); err != nil {
+		return err
+	}
+	var ex []*uint16
+	for _, e := range exceptions {
+		p, err := syscall.UTF16PtrFromString(e)
+		if err != nil {
+			return err
+		}
+		ex = append(ex, p)
+	}
+	var exp **uint16
+	if len(ex) != 0 {
+		exp = &ex[0]
+	}
+	if err := bfSetupFilter(job, uint32(flags), withTrailingBackslash(root), withTrailingBackslash(target), exp, uint32(len(ex))); err != nil {
+		return &os.PathError{Op: "bind", Path: root, Err: err}
+	}
+	return nil
+}
+
+// RemoveMapping removes the system-wide mapping at root.
+func RemoveMapping(root string) error {
+	return RemoveJobMapping(0, root)
+}
+
+// RemoveJobMapping removes the mapping at root from the silo of the job object job.
+func RemoveJobMapping(job syscall.Handle, root string) error {
+	if err := checkAPI(); err != nil {
+		return err
+	}
+	if err := bfRemoveMapping(job, withTrailingBackslash(root)); err != nil {
+		return &os.PathError{Op: "unbind", Path: root, Err: err}
+	}
+	return nil
+}
+
+// Mappings returns the system-wide mappings on the volume that contains path.
+func Mappings(path string) ([]Mapping, error) {
+	return getMappings(cBINDFLT_GET_MAPPINGS_FLAG_VOLUME, 0, path)
+}
+
+// JobMappings returns the mappings in the silo of the job object job.
+func JobMappings(job syscall.Handle) ([]Mapping, error) {
+	return getMappings(cBINDFLT_GET_MAPPINGS_FLAG_SILO, job, "")
+}
+
+func getMappings(flags uint32, job syscall.Handle, path string) ([]Mapping, error) {
+	if err := checkAPI(); err != nil {
+		return nil, err
+	}
+	var root *uint16
+	if path != "" {
+		mountPoint, err := fs.GetVolumePathName(path)
+		if err != nil {
+			return nil, err
+		}
+		volume, err := fs.GetVolumeNameForVolumeMountPoint(mountPoint)
+		if err != nil {
+			return nil, err
+		}
+		root, err = syscall.UTF16PtrFromString(volume)
+		if err != nil {
+			return nil, err
+		}
+	}
+	size := uint32(4096)
+	for {
+		// Use a []uint64 for the alignment of the response.
+		buf := make([]uint64, (size+7)/8)
+		err := bfGetMappings(flags, job, root, nil, &size, (*byte)(unsafe.Pointer(&buf[0])))
+		if err == cHRESULT_ERROR_INSUFFICIENT_BUFFER {
+			continue
+		}
+		if err != nil {
+			return nil, &os.PathError{Op: "get bind mappings", Path: path, Err: err}
+		}
+		b := (*[1 << 30]byte)(unsafe.Pointer(&buf[0]))[:size:size]
+		return parseMappings(b)
+	}
+}
+
+func parseMappings(b []byte) ([]Mapping, error) {
+	if len(b) < mappingsHeaderSize {
+		return nil, errInvalidMappings
+	}
+	count := binary.LittleEndian.Uint32(b[8:12])
+	if uint64(count)*mappingEntrySize > uint64(len(b)-mappingsHeaderSize) {
+		return nil, errInvalidMappings
+	}
+	mappings := make([]Mapping, 0, count)
+	for i := uint32(0); i < count; i++ {
+		e := b[mappingsHeaderSize+i*mappingEntrySize:]
+		root, err := stringAt(b, binary.LittleEndian.Uint32(e[4:8]), binary.LittleEndian.Uint32(e[0:4]))
+		if err != nil {
+			return nil, err
+		}
+		m := Mapping{Root: root, Flags: Flags(binary.LittleEndian.Uint32(e[8:12]))}
+		ntargets := binary.LittleEndian.Uint32(e[12:16])
+		targets := uint64(binary.LittleEndian.Uint32(e[16:20]))
+		if targets+uint64(ntargets)*targetEntrySize > uint64(len(b)) {
+			return nil, errInvalidMappings
+		}
+		for j := uint64(0); j < uint64(ntargets); j++ {
+			t := b[targets+j*targetEntrySize:]
+			target, err := stringAt(b, binary.LittleEndian.Uint32(t[4:8]), binary.LittleEndian.Uint32(t[0:4]))
+			if err != nil {
+				return nil, err
+			}
+			m.Targets = append(m.Targets, target)
+		}
+		mappings = append(mappings, m)
+	}
+	return mappings, nil
+}
+
+// stringAt returns the UTF-16 string of length bytes at off in b.
+func stringAt(b []byte, off, length uint32) (string, error) {
+	if uint64(off)+uint64(length) > uint64(len(b)) || length%2 != 0 {
+		return "", errInvalidMappings
+	}
+	s := make([]uint16, length/2)
+	for i := range s {
+		s[i] = binary.LittleEndian.Uint16(b[off+uint32(i)*2:])
+	}
+	return string(utf16.Decode(s)), nil
+}
+
+func withTrailingBackslash(path string) string {
+	if strings.HasSuffix(path, `\`) {
+		return path
+	}
+	return path + `\`
+}
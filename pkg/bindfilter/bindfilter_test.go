@@ -0,0 +1,121 @@
+package bindfilter
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+func mappingsBuffer(mappings []Mapping) []byte {
+	b := make([]byte, mappingsHeaderSize+len(mappings)*mappingEntrySize)
+	binary.LittleEndian.PutUint32(b[8:], uint32(len(mappings)))
+	appendString := func(s string) (uint32, uint32) {
+		off := uint32(len(b))
+		for _, c := range utf16.Encode([]rune(s)) {
+			b = append(b, byte(c), byte(c>>8))
+		}
+		return off, uint32(len(b)) - off
+	}
+	for i, m := range mappings {
+		e := mappingsHeaderSize + i*mappingEntrySize
+		off, length := appendString(m.Root)
+		binary.LittleEndian.PutUint32(b[e:], length)
+		binary.LittleEndian.PutUint32(b[e+4:], off)
+		binary.LittleEndian.PutUint32(b[e+8:], uint32(m.Flags))
+		binary.LittleEndian.PutUint32(b[e+12:], uint32(len(m.Targets)))
+		targets := len(b)
+		binary.LittleEndian.PutUint32(b[e+16:], uint32(targets))
+		b = append(b, make([]byte, len(m.Targets)*targetEntrySize)...)
+		for j, t := range m.Targets {
+			off, length := appendString(t)
+			binary.LittleEndian.PutUint32(b[targets+j*targetEntrySize:], length)
+			binary.LittleEndian.PutUint32(b[targets+j*targetEntrySize+4:], off)
+		}
+	}
+	binary.LittleEndian.PutUint32(b, uint32(len(b)))
+	return b
+}
+
+func TestParseMappings(t *testing.T) {
+	want := []Mapping{
+		{Root: `\mnt\a`, Targets: []string{`\Device\HarddiskVolume1\src`}, Flags: ReadOnly},
+		{Root: `\mnt\b`, Targets: []string{`\Device\HarddiskVolume1\x`, `\Device\HarddiskVolume2\y`}, Flags: Merged},
+	}
+	b := mappingsBuffer(want)
+	got, err := parseMappings(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d mappings", len(got))
+	}
+	for i := range want {
+		if got[i].Root != want[i].Root || got[i].Flags != want[i].Flags || strings.Join(got[i].Targets, "|") != strings.Join(want[i].Targets, "|") {
+			t.Errorf("got %+v, expected %+v", got[i], want[i])
+		}
+	}
+	for _, n := range []int{0, 20, len(b) - 1} {
+		if _, err := parseMappings(b[:n]); err != errInvalidMappings {
+			t.Errorf("%d bytes: got %v", n, err)
+		}
+	}
+}
+
+func TestAddMapping(t *testing.T) {
+	if err := checkAPI(); err != nil {
+		t.Skip(err)
+	}
+	dir, err := ioutil.TempDir("", "bindfilter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	root, target := filepath.Join(dir, "root"), filepath.Join(dir, "target")
+	for _, d := range []string{root, target} {
+		if err := os.Mkdir(d, 0777); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(target, "file"), []byte("data"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	err = AddMapping(root, target, ReadOnly, nil)
+	// The bind filter API returns HRESULTs rather than Win32 error codes.
+	if perr, ok := err.(*os.PathError); ok && perr.Err == cHRESULT_ERROR_ACCESS_DENIED {
+		t.Skip("requires administrator rights")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer RemoveMapping(root)
+	b, err := ioutil.ReadFile(filepath.Join(root, "file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "data" {
+		t.Fatalf("read %q through the mapping", b)
+	}
+	mappings, err := Mappings(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, m := range mappings {
+		if strings.EqualFold(strings.TrimSuffix(m.Root, `\`), strings.TrimSuffix(root[len(filepath.VolumeName(root)):], `\`)) {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("mapping not found in %+v", mappings)
+	}
+	if err := RemoveMapping(root); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "file")); !os.IsNotExist(err) {
+		t.Errorf("file still visible after removing mapping: %v", err)
+	}
+}
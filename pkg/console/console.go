@@ -0,0 +1,171 @@
+// Package console queries and changes the modes of Windows consoles and reads their
+// input events.
+package console
+
+import (
+	"os"
+	"syscall"
+)
+
+//sys getConsoleMode(console syscall.Handle, mode *uint32) (err error) = GetConsoleMode
+//sys setConsoleMode(console syscall.Handle, mode uint32) (err error) = SetConsoleMode
+//sys getConsoleScreenBufferInfo(console syscall.Handle, info *consoleScreenBufferInfo) (err error) = GetConsoleScreenBufferInfo
+
+// Mode is a console mode. A console input buffer and a console screen buffer
+// interpret the bits of the mode differently.
+type Mode uint32
+
+// Modes of console input buffers.
+const (
+	EnableProcessedInput       Mode = 0x1
+	EnableLineInput            Mode = 0x2
+	EnableEchoInput            Mode = 0x4
+	EnableWindowInput          Mode = 0x8
+	EnableMouseInput           Mode = 0x10
+	EnableInsertMode           Mode = 0x20
+	EnableQuickEditMode        Mode = 0x40
+	EnableExtendedFlags        Mode = 0x80
+	EnableAutoPosition         Mode = 0x100
+	EnableVirtualTerminalInput Mode = 0x200
+)
+
+// Modes of console screen buffers.
+const (
+	EnableProcessedOutput           Mode = 0x1
+	EnableWrapAtEOLOutput           Mode = 0x2
+	EnableVirtualTerminalProcessing Mode = 0x4
+	DisableNewlineAutoReturn        Mode = 0x8
+	EnableLVBGridWorldwide          Mode = 0x10
+)
+
+// Coord is a position or size in character cells.
+type Coord struct {
+	X, Y int16
+}
+
+type smallRect struct {
+	Left, Top, Right, Bottom int16
+}
+
+type consoleScreenBufferInfo struct {
+	Size              Coord
+	CursorPosition    Coord
+	Attributes        uint16
+	Window            smallRect
+	MaximumWindowSize Coord
+}
+
+// GetMode returns the mode of the console input buffer or screen buffer h.
+func GetMode(h syscall.Handle) (Mode, error) {
+	var mode uint32
+	if err := getConsoleMode(h, &mode); err != nil {
+		return 0, os.NewSyscallError("GetConsoleMode", err)
+	}
+	return Mode(mode), nil
+}
+
+// SetMode sets the mode of the console input buffer or screen buffer h.
+func SetMode(h syscall.Handle, mode Mode) error {
+	if err := setConsoleMode(h, uint32(mode)); err != nil {
+		return os.NewSyscallError("SetConsoleMode", err)
+	}
+	return nil
+}
+
+// updateMode sets and clears bits in the mode of h and returns the previous mode.
+func updateMode(h syscall.Handle, set, clear Mode) (Mode, error) {
+	prev, err := GetMode(h)
+	if err != nil {
+		return 0, err
+	}
+	if err := SetMode(h, prev&^clear|set); err != nil {
+		return 0, err
+	}
+	return prev, nil
+}
+
+// EnableVirtualTerminal enables the processing of VT100 escape sequences written to
+// the console screen buffer h, and returns its previous mode, which can be restored
+// with SetMode. It fails on versions of Windows before Windows 10.
+func EnableVirtualTerminal(h syscall.Handle) (Mode, error) {
+	return updateMode(h, EnableProcessedOutput|EnableVirtualTerminalProcessing, 0)
+}
+
+// MakeRaw puts the console input buffer h in raw mode, in which input is neither
+// echoed nor line buffered, Ctrl+C is read as input rather than handled by the system,
+// and keys are translated to VT100 escape sequences. It returns the previous mode,
+// which can be restored with SetMode.
+func MakeRaw(h syscall.Handle) (Mode, error) {
+	return updateMode(h, EnableVirtualTerminalInput, EnableProcessedInput|EnableLineInput|EnableEchoInput)
+}
+
+// GetSize returns the size of the visible window of the console screen buffer h.
+func GetSize(h syscall.Handle) (Coord, error) {
+	var info consoleScreenBufferInfo
+	if err := getConsoleScreenBufferInfo(h, &info); err != nil {
+		return Coord{}, os.NewSyscallError("GetConsoleScreenBufferInfo", err)
+	}
+	return Coord{
+		X: info.Window.Right - info.Window.Left + 1,
+		Y: info.Window.Bottom - info.Window.Top + 1,
+	}, nil
+}
+
+// HandleType is the kind of object a handle refers to.
+type HandleType int
+
+// Handle types.
+const (
+	HandleUnknown HandleType = iota
+	// HandleFile is a file on disk.
+	HandleFile
+	// HandlePipe is an anonymous or named pipe, or a socket.
+	HandlePipe
+	// HandleChar is a character device other than a console, such as NUL or a
+	// serial port.
+	HandleChar
+	// HandleConsole is a console input buffer or screen buffer.
+	HandleConsole
+)
+
+func (t HandleType) String() string {
+	switch t {
+	case HandleFile:
+		return "file"
+	case HandlePipe:
+		return "pipe"
+	case HandleChar:
+		return "char"
+	case HandleConsole:
+		return "console"
+	}
+	return "unknown"
+}
+
+// GetHandleType returns the kind of object h refers to, which lets programs decide
+// whether their standard handles are attached to a console, a pipe or a file.
+func GetHandleType(h syscall.Handle) (HandleType, error) {
+	t, err := syscall.GetFileType(h)
+	if err != nil {
+		return HandleUnknown, os.NewSyscallError("GetFileType", err)
+	}
+	switch t {
+	case syscall.FILE_TYPE_DISK:
+		return HandleFile, nil
+	case syscall.FILE_TYPE_PIPE:
+		return HandlePipe, nil
+	case syscall.FILE_TYPE_CHAR:
+		var mode uint32
+		if getConsoleMode(h, &mode) == nil {
+			return HandleConsole, nil
+		}
+		return HandleChar, nil
+	}
+	return HandleUnknown, nil
+}
+
+// IsConsole returns whether h is a console input buffer or screen buffer.
+func IsConsole(h syscall.Handle) bool {
+	t, _ := GetHandleType(h)
+	return t == HandleConsole
+}
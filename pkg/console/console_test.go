@@ -0,0 +1,126 @@
+package console
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"syscall"
+	"testing"
+)
+
+func TestGetHandleType(t *testing.T) {
+	f, err := ioutil.TempFile("", "tst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+	null, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer null.Close()
+
+	for _, test := range []struct {
+		f        *os.File
+		expected HandleType
+	}{
+		{f, HandleFile},
+		{r, HandlePipe},
+		{null, HandleChar},
+	} {
+		ht, err := GetHandleType(syscall.Handle(test.f.Fd()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ht != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.f.Name(), test.expected, ht)
+		}
+	}
+	if _, err := GetHandleType(syscall.InvalidHandle); err == nil {
+		t.Error("expected an error for an invalid handle")
+	}
+}
+
+func TestDecodeInputRecord(t *testing.T) {
+	r := inputRecord{EventType: keyEvent}
+	copy(r.Event[:], []byte{1, 0, 0, 0, 1, 0, 0x41, 0, 0x1e, 0, 'a', 0, 0x10, 0, 0, 0})
+	expected := &KeyEvent{KeyDown: true, RepeatCount: 1, VirtualKeyCode: 0x41, VirtualScanCode: 0x1e, Char: 'a', ControlKeyState: 0x10}
+	if e := decodeInputRecord(&r); !reflect.DeepEqual(e, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, e)
+	}
+	r = inputRecord{EventType: windowBufferSizeEvent}
+	copy(r.Event[:], []byte{80, 0, 25, 0})
+	if e := decodeInputRecord(&r); !reflect.DeepEqual(e, &WindowBufferSizeEvent{Size: Coord{80, 25}}) {
+		t.Fatalf("unexpected event %+v", e)
+	}
+	if e := decodeInputRecord(&inputRecord{EventType: 0x80}); e != nil {
+		t.Fatalf("unexpected event %+v", e)
+	}
+}
+
+func openConsole(t *testing.T, name string) syscall.Handle {
+	name16, _ := syscall.UTF16PtrFromString(name)
+	h, err := syscall.CreateFile(name16, syscall.GENERIC_READ|syscall.GENERIC_WRITE, syscall.FILE_SHARE_READ|syscall.FILE_SHARE_WRITE, nil, syscall.OPEN_EXISTING, 0, 0)
+	if err != nil {
+		t.Skipf("no console: %s", err)
+	}
+	return h
+}
+
+func TestConsoleModes(t *testing.T) {
+	in := openConsole(t, "CONIN$")
+	defer syscall.CloseHandle(in)
+	out := openConsole(t, "CONOUT$")
+	defer syscall.CloseHandle(out)
+	if !IsConsole(in) || !IsConsole(out) {
+		t.Fatal("console handles not detected")
+	}
+
+	prev, err := MakeRaw(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer SetMode(in, prev)
+	mode, err := GetMode(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode&(EnableLineInput|EnableEchoInput) != 0 || mode&EnableVirtualTerminalInput == 0 {
+		t.Fatalf("unexpected raw mode %#x", mode)
+	}
+
+	prev, err = EnableVirtualTerminal(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer SetMode(out, prev)
+	if mode, err = GetMode(out); err != nil || mode&EnableVirtualTerminalProcessing == 0 {
+		t.Fatalf("unexpected output mode %#x: %v", mode, err)
+	}
+	size, err := GetSize(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size.X <= 0 || size.Y <= 0 {
+		t.Fatalf("invalid size %+v", size)
+	}
+
+	r, err := NewInputReader(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+	for range r.Events() {
+		// Discard events that were read before the reader was closed.
+	}
+	if r.Err() != ErrReaderClosed {
+		t.Fatalf("expected ErrReaderClosed, got %v", r.Err())
+	}
+}
@@ -0,0 +1,222 @@
+package console
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"sync"
+	"syscall"
+)
+
+//sys readConsoleInput(console syscall.Handle, buf *inputRecord, length uint32, read *uint32) (err error) = ReadConsoleInputW
+//sys createEvent(sa *syscall.SecurityAttributes, manualReset bool, initialState bool, name *uint16) (h syscall.Handle, err error) = CreateEventW
+//sys setEvent(h syscall.Handle) (err error) = SetEvent
+//sys waitForMultipleObjects(count uint32, handles *syscall.Handle, waitAll bool, timeout uint32) (event uint32, err error) [failretval==0xffffffff] = WaitForMultipleObjects
+
+const (
+	keyEvent              = 0x1
+	mouseEvent            = 0x2
+	windowBufferSizeEvent = 0x4
+	menuEvent             = 0x8
+	focusEvent            = 0x10
+
+	inputBatchSize = 64
+)
+
+// ErrReaderClosed is returned by InputReader.Err once the reader has been closed.
+var ErrReaderClosed = errors.New("console input reader closed")
+
+// inputRecord is INPUT_RECORD.
+type inputRecord struct {
+	EventType uint16
+	_         uint16
+	Event     [16]byte
+}
+
+// InputEvent is an event read from a console input buffer: a *KeyEvent, *MouseEvent,
+// *WindowBufferSizeEvent, *MenuEvent or *FocusEvent.
+type InputEvent interface {
+	isInputEvent()
+}
+
+// KeyEvent reports a key being pressed or released.
+type KeyEvent struct {
+	KeyDown         bool
+	RepeatCount     uint16
+	VirtualKeyCode  uint16
+	VirtualScanCode uint16
+	// Char is the UTF-16 code unit produced by the key, or zero. Characters outside
+	// the basic multilingual plane arrive as two events holding a surrogate pair.
+	Char            uint16
+	ControlKeyState uint32
+}
+
+// MouseEvent reports mouse movement or a button press. Mouse events are only read
+// when the input mode includes EnableMouseInput.
+type MouseEvent struct {
+	Position        Coord
+	ButtonState     uint32
+	ControlKeyState uint32
+	Flags           uint32
+}
+
+// WindowBufferSizeEvent reports a change in the size of the screen buffer. These are
+// only read when the input mode includes EnableWindowInput.
+type WindowBufferSizeEvent struct {
+	Size Coord
+}
+
+// MenuEvent is used internally by the console and should be ignored.
+type MenuEvent struct {
+	CommandID uint32
+}
+
+// FocusEvent is used internally by the console and should be ignored.
+type FocusEvent struct {
+	SetFocus bool
+}
+
+func (*KeyEvent) isInputEvent()              {}
+func (*MouseEvent) isInputEvent()            {}
+func (*WindowBufferSizeEvent) isInputEvent() {}
+func (*MenuEvent) isInputEvent()             {}
+func (*FocusEvent) isInputEvent()            {}
+
+func coordAt(b []byte) Coord {
+	return Coord{X: int16(binary.LittleEndian.Uint16(b)), Y: int16(binary.LittleEndian.Uint16(b[2:]))}
+}
+
+// decodeInputRecord returns the event held by r, or nil for an unknown event type.
+func decodeInputRecord(r *inputRecord) InputEvent {
+	b := r.Event[:]
+	switch r.EventType {
+	case keyEvent:
+		return &KeyEvent{
+			KeyDown:         binary.LittleEndian.Uint32(b) != 0,
+			RepeatCount:     binary.LittleEndian.Uint16(b[4:]),
+			VirtualKeyCode:  binary.LittleEndian.Uint16(b[6:]),
+			VirtualScanCode: binary.LittleEndian.Uint16(b[8:]),
+			Char:            binary.LittleEndian.Uint16(b[10:]),
+			ControlKeyState: binary.LittleEndian.Uint32(b[12:]),
+		}
+	case mouseEvent:
+		return &MouseEvent{
+			Position:        coordAt(b),
+			ButtonState:     binary.LittleEndian.Uint32(b[4:]),
+			ControlKeyState: binary.LittleEndian.Uint32(b[8:]),
+			Flags:           binary.LittleEndian.Uint32(b[12:]),
+		}
+	case windowBufferSizeEvent:
+		return &WindowBufferSizeEvent{Size: coordAt(b)}
+	case menuEvent:
+		return &MenuEvent{CommandID: binary.LittleEndian.Uint32(b)}
+	case focusEvent:
+		return &FocusEvent{SetFocus: binary.LittleEndian.Uint32(b) != 0}
+	}
+	return nil
+}
+
+// InputReader reads the events of a console input buffer on a separate goroutine.
+// Console handles do not support overlapped IO, so without it a read of console input
+// would block until the user pressed a key, with no way to cancel it.
+type InputReader struct {
+	h      syscall.Handle
+	stop   syscall.Handle
+	events chan InputEvent
+	done   chan struct{}
+	wg     sync.WaitGroup
+
+	closeOnce sync.Once
+	m         sync.Mutex
+	err       error
+}
+
+// NewInputReader starts reading events from the console input buffer h, which must
+// remain open until the reader is closed.
+func NewInputReader(h syscall.Handle) (*InputReader, error) {
+	stop, err := createEvent(nil, true, false, nil)
+	if err != nil {
+		return nil, os.NewSyscallError("CreateEvent", err)
+	}
+	r := &InputReader{
+		h:      h,
+		stop:   stop,
+		events: make(chan InputEvent, inputBatchSize),
+		done:   make(chan struct{}),
+	}
+	r.wg.Add(1)
+	go r.run()
+	return r, nil
+}
+
+// Events returns a channel that receives the events read from the console. It is
+// closed when the reader is closed or reading fails; Err returns the reason.
+func (r *InputReader) Events() <-chan InputEvent {
+	return r.events
+}
+
+// Err returns the error that stopped the reader, or nil if it is still running.
+func (r *InputReader) Err() error {
+	r.m.Lock()
+	defer r.m.Unlock()
+	return r.err
+}
+
+func (r *InputReader) setErr(err error) {
+	r.m.Lock()
+	if r.err == nil {
+		r.err = err
+	}
+	r.m.Unlock()
+}
+
+func (r *InputReader) run() {
+	defer r.wg.Done()
+	defer close(r.events)
+	// WaitForMultipleObjects reports the first signaled handle, so the stop event
+	// comes first: once the reader is closed, it must not consume input that is
+	// still pending, which would take it from the next reader.
+	handles := [2]syscall.Handle{r.stop, r.h}
+	var buf [inputBatchSize]inputRecord
+	for {
+		// The input buffer is signaled while it holds unread events, so the read
+		// below does not block.
+		ev, err := waitForMultipleObjects(uint32(len(handles)), &handles[0], false, syscall.INFINITE)
+		if err != nil {
+			r.setErr(os.NewSyscallError("WaitForMultipleObjects", err))
+			return
+		}
+		if ev != syscall.WAIT_OBJECT_0+1 {
+			r.setErr(ErrReaderClosed)
+			return
+		}
+		var n uint32
+		if err := readConsoleInput(r.h, &buf[0], uint32(len(buf)), &n); err != nil {
+			r.setErr(os.NewSyscallError("ReadConsoleInput", err))
+			return
+		}
+		for i := range buf[:n] {
+			e := decodeInputRecord(&buf[i])
+			if e == nil {
+				continue
+			}
+			select {
+			case r.events <- e:
+			case <-r.done:
+				r.setErr(ErrReaderClosed)
+				return
+			}
+		}
+	}
+}
+
+// Close stops the reader. Events that have been read but not received are discarded.
+func (r *InputReader) Close() error {
+	r.closeOnce.Do(func() {
+		setEvent(r.stop)
+		close(r.done)
+		r.wg.Wait()
+		syscall.CloseHandle(r.stop)
+	})
+	return nil
+}
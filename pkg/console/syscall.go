@@ -0,0 +1,3 @@
+package console
+
+//go:generate go run $GOROOT/src/syscall/mksyscall_windows.go -output zsyscall.go console.go input.go
@@ -0,0 +1,192 @@
+package fs
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"syscall"
+	"unsafe"
+)
+
+//sys getFileInformationByHandleEx(h syscall.Handle, class uint32, buffer *byte, size uint32) (err error) = GetFileInformationByHandleEx
+//sys setFileInformationByHandle(h syscall.Handle, class uint32, buffer *byte, size uint32) (err error) = SetFileInformationByHandle
+
+const (
+	fileCaseSensitiveInfo = 0x17
+
+	cFILE_CS_FLAG_CASE_SENSITIVE_DIR = 0x1
+
+	cFILE_READ_ATTRIBUTES  = 0x80
+	cFILE_WRITE_ATTRIBUTES = 0x100
+)
+
+type fileCaseSensitiveInformation struct {
+	Flags uint32
+}
+
+// CaseSensitivityError is returned when the case sensitivity of a directory tree could
+// not be changed. The directories that had already been changed have been restored to
+// their previous state, unless RollbackErr is set.
+type CaseSensitivityError struct {
+	Path        string
+	Err         error
+	RollbackErr error
+}
+
+func (e *CaseSensitivityError) Error() string {
+	s := "set case sensitivity " + e.Path + ": " + e.Err.Error()
+	if e.RollbackErr != nil {
+		s += " (rollback failed: " + e.RollbackErr.Error() + ")"
+	}
+	return s
+}
+
+func openDirectory(path string, access uint32) (syscall.Handle, error) {
+	path16, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+	h, err := syscall.CreateFile(path16, access, syscall.FILE_SHARE_READ|syscall.FILE_SHARE_WRITE|syscall.FILE_SHARE_DELETE, nil, syscall.OPEN_EXISTING, syscall.FILE_FLAG_BACKUP_SEMANTICS|syscall.FILE_FLAG_OPEN_REPARSE_POINT, 0)
+	if err != nil {
+		return 0, &os.PathError{Op: "open", Path: path, Err: err}
+	}
+	return h, nil
+}
+
+// GetFileCaseSensitivity returns whether file names in a directory are case sensitive.
+// The directory must have been opened with FILE_READ_ATTRIBUTES access.
+func GetFileCaseSensitivity(f *os.File) (bool, error) {
+	var info fileCaseSensitiveInformation
+	err := getFileInformationByHandleEx(syscall.Handle(f.Fd()), fileCaseSensitiveInfo, (*byte)(unsafe.Pointer(&info)), uint32(unsafe.Sizeof(info)))
+	if err != nil {
+		return false, &os.PathError{Op: "GetFileInformationByHandleEx", Path: f.Name(), Err: err}
+	}
+	return info.Flags&cFILE_CS_FLAG_CASE_SENSITIVE_DIR != 0, nil
+}
+
+// SetFileCaseSensitivity sets whether file names in a directory are case sensitive. The
+// directory must have been opened with FILE_WRITE_ATTRIBUTES access. This requires the
+// Windows Subsystem for Linux feature to be enabled, and case sensitivity cannot be
+// disabled while the directory contains names that differ only in case.
+func SetFileCaseSensitivity(f *os.File, enable bool) error {
+	var info fileCaseSensitiveInformation
+	if enable {
+		info.Flags = cFILE_CS_FLAG_CASE_SENSITIVE_DIR
+	}
+	err := setFileInformationByHandle(syscall.Handle(f.Fd()), fileCaseSensitiveInfo, (*byte)(unsafe.Pointer(&info)), uint32(unsafe.Sizeof(info)))
+	if err != nil {
+		return &os.PathError{Op: "SetFileInformationByHandle", Path: f.Name(), Err: err}
+	}
+	return nil
+}
+
+// QueryCaseSensitivity returns whether file names in the directory at path are case
+// sensitive.
+func QueryCaseSensitivity(path string) (bool, error) {
+	h, err := openDirectory(path, cFILE_READ_ATTRIBUTES)
+	if err != nil {
+		return false, err
+	}
+	f := os.NewFile(uintptr(h), path)
+	defer f.Close()
+	return GetFileCaseSensitivity(f)
+}
+
+// setCaseSensitivity sets the case sensitivity of a single directory and returns
+// whether it changed.
+func setCaseSensitivity(path string, enable bool) (bool, error) {
+	h, err := openDirectory(path, cFILE_READ_ATTRIBUTES|cFILE_WRITE_ATTRIBUTES)
+	if err != nil {
+		return false, err
+	}
+	f := os.NewFile(uintptr(h), path)
+	defer f.Close()
+	cs, err := GetFileCaseSensitivity(f)
+	if err != nil || cs == enable {
+		return false, err
+	}
+	if err := SetFileCaseSensitivity(f, enable); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// EnableCaseSensitivity makes file names in the directory at path case sensitive, as
+// required by WSL and Linux container layers. If recursive is true, all directories
+// below path are changed as well; directory reparse points are not followed. If
+// progress is not nil, it is called with the path of each directory after it has been
+// processed.
+//
+// If any directory cannot be changed, the directories that were changed by this call
+// are restored and a *CaseSensitivityError is returned.
+func EnableCaseSensitivity(path string, recursive bool, progress func(path string)) error {
+	return setCaseSensitivityTree(path, true, recursive, progress)
+}
+
+// DisableCaseSensitivity reverses EnableCaseSensitivity.
+func DisableCaseSensitivity(path string, recursive bool, progress func(path string)) error {
+	return setCaseSensitivityTree(path, false, recursive, progress)
+}
+
+func setCaseSensitivityTree(path string, enable bool, recursive bool, progress func(path string)) error {
+	var changed []string
+	err := walkDirectories(path, recursive, func(dir string) error {
+		c, err := setCaseSensitivity(dir, enable)
+		if err != nil {
+			return err
+		}
+		if c {
+			changed = append(changed, dir)
+		}
+		if progress != nil {
+			progress(dir)
+		}
+		return nil
+	})
+	if err == nil {
+		return nil
+	}
+	cerr := &CaseSensitivityError{Path: path, Err: err}
+	for i := len(changed) - 1; i >= 0; i-- {
+		_, rerr := setCaseSensitivity(changed[i], !enable)
+		if rerr != nil && cerr.RollbackErr == nil {
+			cerr.RollbackErr = rerr
+		}
+	}
+	return cerr
+}
+
+// walkDirectories calls fn for path and, if recursive is true, for each directory below
+// it that is not a reparse point, parents before children.
+func walkDirectories(path string, recursive bool, fn func(dir string) error) error {
+	err := fn(path)
+	if err != nil || !recursive {
+		return err
+	}
+	d, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	names, err := d.Readdirnames(-1)
+	d.Close()
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		child := filepath.Join(path, name)
+		fi, err := os.Lstat(child)
+		if err != nil {
+			return err
+		}
+		attr := fi.Sys().(*syscall.Win32FileAttributeData).FileAttributes
+		if attr&syscall.FILE_ATTRIBUTE_DIRECTORY == 0 || attr&syscall.FILE_ATTRIBUTE_REPARSE_POINT != 0 {
+			continue
+		}
+		err = walkDirectories(child, true, fn)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
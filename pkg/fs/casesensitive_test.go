@@ -0,0 +1,87 @@
+package fs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEnableCaseSensitivityRecursive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sub := filepath.Join(dir, "a", "b")
+	if err = os.MkdirAll(sub, 0777); err != nil {
+		t.Fatal(err)
+	}
+
+	var dirs []string
+	err = EnableCaseSensitivity(dir, true, func(path string) { dirs = append(dirs, path) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dirs) != 3 {
+		t.Fatalf("expected progress for 3 directories, got %v", dirs)
+	}
+	cs, err := QueryCaseSensitivity(sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cs {
+		t.Fatal("expected subdirectory to be case sensitive")
+	}
+
+	err = DisableCaseSensitivity(dir, true, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs, err = QueryCaseSensitivity(sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cs {
+		t.Fatal("expected subdirectory to be case insensitive")
+	}
+}
+
+func TestCaseSensitivityRollback(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	a := filepath.Join(dir, "a")
+	b := filepath.Join(dir, "b")
+	for _, d := range []string{a, b} {
+		if err = os.Mkdir(d, 0777); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = EnableCaseSensitivity(dir, true, nil); err != nil {
+		t.Fatal(err)
+	}
+	// Case sensitivity cannot be disabled on a directory that contains names that
+	// differ only by case.
+	for _, name := range []string{"x", "X"} {
+		if err = ioutil.WriteFile(filepath.Join(b, name), nil, 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = DisableCaseSensitivity(dir, true, nil)
+	if _, ok := err.(*CaseSensitivityError); !ok {
+		t.Fatalf("expected CaseSensitivityError, got %v", err)
+	}
+	for _, d := range []string{dir, a} {
+		cs, err := QueryCaseSensitivity(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !cs {
+			t.Fatalf("expected %s to be case sensitive after rollback", d)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package fs
+
+import (
+	"os"
+	"strings"
+	"syscall"
+	"unicode/utf16"
+)
+
+//sys defineDosDevice(flags uint32, deviceName string, targetPath *uint16) (err error) = DefineDosDeviceW
+//sys queryDosDevice(deviceName *uint16, targetPath *uint16, max uint32) (n uint32, err error) [failretval==0] = QueryDosDeviceW
+
+const (
+	cDDD_RAW_TARGET_PATH       = 0x1
+	cDDD_REMOVE_DEFINITION     = 0x2
+	cDDD_EXACT_MATCH_ON_REMOVE = 0x4
+
+	cERROR_INSUFFICIENT_BUFFER = syscall.Errno(122)
+)
+
+// DefineDosDevice defines name, such as X:, as an MS-DOS device name that refers to
+// target. If raw is false, target is a Win32 path, like the targets of the subst
+// command, such as C:\dir. If raw is true, target is an NT device path, such as
+// \Device\HarddiskVolume5, which makes it possible to assign a drive letter to a
+// volume that has no mount point.
+//
+// Definitions stack: a new definition hides an existing one for the same name until it
+// is removed. Definitions are per logon session unless the caller is running as
+// LocalSystem.
+func DefineDosDevice(name string, target string, raw bool) error {
+	target16, err := syscall.UTF16PtrFromString(target)
+	if err != nil {
+		return err
+	}
+	var flags uint32
+	if raw {
+		flags |= cDDD_RAW_TARGET_PATH
+	}
+	err = defineDosDevice(flags, name, target16)
+	if err != nil {
+		return &os.PathError{Op: "DefineDosDevice", Path: name, Err: err}
+	}
+	return nil
+}
+
+// RemoveDosDevice removes the most recent definition of the MS-DOS device name. If
+// target is not empty, it instead removes the definition of name that refers to target,
+// which must be given exactly as it was passed to DefineDosDevice, along with raw.
+func RemoveDosDevice(name string, target string, raw bool) error {
+	flags := uint32(cDDD_REMOVE_DEFINITION)
+	var target16 *uint16
+	if target != "" {
+		var err error
+		target16, err = syscall.UTF16PtrFromString(target)
+		if err != nil {
+			return err
+		}
+		flags |= cDDD_EXACT_MATCH_ON_REMOVE
+		if raw {
+			flags |= cDDD_RAW_TARGET_PATH
+		}
+	}
+	err := defineDosDevice(flags, name, target16)
+	if err != nil {
+		return &os.PathError{Op: "DefineDosDevice", Path: name, Err: err}
+	}
+	return nil
+}
+
+// queryDosDevices returns the NUL-separated list returned by QueryDosDevice.
+func queryDosDevices(name *uint16) ([]string, error) {
+	buf := make([]uint16, syscall.MAX_PATH)
+	for {
+		n, err := queryDosDevice(name, &buf[0], uint32(len(buf)))
+		if err == cERROR_INSUFFICIENT_BUFFER {
+			buf = make([]uint16, len(buf)*2)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		var list []string
+		for _, s := range strings.Split(string(utf16.Decode(buf[:n])), "\x00") {
+			if s != "" {
+				list = append(list, s)
+			}
+		}
+		return list, nil
+	}
+}
+
+// QueryDosDevice returns the NT paths that the MS-DOS device name refers to, starting
+// with the current definition, followed by the definitions it hides.
+func QueryDosDevice(name string) ([]string, error) {
+	name16, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		return nil, err
+	}
+	targets, err := queryDosDevices(name16)
+	if err != nil {
+		return nil, &os.PathError{Op: "QueryDosDevice", Path: name, Err: err}
+	}
+	return targets, nil
+}
+
+// DosDevices returns the names of all MS-DOS devices visible to the caller.
+func DosDevices() ([]string, error) {
+	names, err := queryDosDevices(nil)
+	if err != nil {
+		return nil, &os.SyscallError{Syscall: "QueryDosDevice", Err: err}
+	}
+	return names, nil
+}
@@ -0,0 +1,74 @@
+package fs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func freeDriveLetter(t *testing.T) string {
+	for c := 'Z'; c >= 'D'; c-- {
+		name := string(c) + ":"
+		if _, err := QueryDosDevice(name); err != nil {
+			return name
+		}
+	}
+	t.Skip("no free drive letter")
+	return ""
+}
+
+func TestDefineDosDevice(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	err = ioutil.WriteFile(filepath.Join(dir, "file.txt"), []byte("data"), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	drive := freeDriveLetter(t)
+	err = DefineDosDevice(drive, dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer RemoveDosDevice(drive, "", false)
+
+	targets, err := QueryDosDevice(drive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(targets) != 1 || !strings.EqualFold(targets[0], `\??\`+dir) {
+		t.Fatalf("unexpected targets %v", targets)
+	}
+	b, err := ioutil.ReadFile(drive + `\file.txt`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "data" {
+		t.Fatalf("unexpected contents %q", b)
+	}
+
+	names, err := DosDevices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, n := range names {
+		found = found || n == drive
+	}
+	if !found {
+		t.Fatalf("%s not in %v", drive, names)
+	}
+
+	err = RemoveDosDevice(drive, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = QueryDosDevice(drive); err == nil {
+		t.Fatal("expected drive to be removed")
+	}
+}
@@ -0,0 +1,102 @@
+package fs
+
+import (
+	"os"
+	"strings"
+	"syscall"
+)
+
+//sys getFinalPathNameByHandle(file syscall.Handle, filePath *uint16, filePathSize uint32, flags uint32) (n uint32, err error) [failretval==0] = GetFinalPathNameByHandleW
+
+// FinalPathFlags selects the form of the path returned by GetFinalPathNameByHandle. It
+// combines one of the VolumeName values with, optionally, FileNameOpened.
+type FinalPathFlags uint32
+
+const (
+	// VolumeNameDOS returns a Win32 path with a drive letter or UNC prefix, such as
+	// \\?\C:\dir\file.txt.
+	VolumeNameDOS FinalPathFlags = 0x0
+	// VolumeNameGUID returns a path that starts with the volume's GUID path, such as
+	// \\?\Volume{...}\dir\file.txt, and so works even if the volume has no drive letter.
+	VolumeNameGUID FinalPathFlags = 0x1
+	// VolumeNameNT returns the NT path of the file, such as
+	// \Device\HarddiskVolume3\dir\file.txt.
+	VolumeNameNT FinalPathFlags = 0x2
+	// VolumeNameNone returns the path of the file relative to its volume, such as
+	// \dir\file.txt.
+	VolumeNameNone FinalPathFlags = 0x4
+
+	// FileNameOpened returns the path as it was used to open the file, rather than
+	// normalized with the long names and actual case of each component.
+	FileNameOpened FinalPathFlags = 0x8
+)
+
+// GetFinalPathNameByHandle returns the path of the file opened as h in the form selected
+// by flags, after resolving any symbolic links and mount points that were followed
+// to open it.
+func GetFinalPathNameByHandle(h syscall.Handle, flags FinalPathFlags) (string, error) {
+	buf := make([]uint16, syscall.MAX_PATH)
+	for {
+		n, err := getFinalPathNameByHandle(h, &buf[0], uint32(len(buf)), uint32(flags))
+		if err != nil {
+			return "", &os.SyscallError{Syscall: "GetFinalPathNameByHandle", Err: err}
+		}
+		// If the buffer is too small, n is the required size including the NUL.
+		if n < uint32(len(buf)) {
+			return syscall.UTF16ToString(buf[:n]), nil
+		}
+		buf = make([]uint16, n)
+	}
+}
+
+// hasPathPrefix reports whether path starts with the directory or device prefix,
+// ignoring case.
+func hasPathPrefix(path string, prefix string) bool {
+	return len(path) >= len(prefix) && strings.EqualFold(path[:len(prefix)], prefix) &&
+		(len(path) == len(prefix) || path[len(prefix)] == '\\')
+}
+
+func isDriveLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// DosPathFromNTPath converts an NT path, such as \Device\HarddiskVolume3\dir or
+// \??\C:\dir, to a Win32 path that uses a drive letter, such as C:\dir. Paths on
+// network shares are converted to UNC paths, and paths in the \??\ namespace that do
+// not start with a drive letter, such as \??\Volume{...}\dir, to \\?\ paths. If the
+// path is on a volume without a drive letter, it is returned with the \\?\GLOBALROOT
+// prefix, which Win32 APIs accept.
+func DosPathFromNTPath(path string) (string, error) {
+	switch {
+	case hasPathPrefix(path, `\??\UNC`):
+		return `\\` + strings.TrimPrefix(path[len(`\??\UNC`):], `\`), nil
+	case strings.HasPrefix(path, ntPrefix):
+		rest := path[len(ntPrefix):]
+		if len(rest) >= 2 && isDriveLetter(rest[0]) && rest[1] == ':' {
+			return rest, nil
+		}
+		// Other MS-DOS device names, such as volume GUIDs, are only accepted by
+		// Win32 with the \\?\ prefix.
+		return extendedPrefix + rest, nil
+	case hasPathPrefix(path, `\Device\Mup`):
+		return `\\` + strings.TrimPrefix(path[len(`\Device\Mup`):], `\`), nil
+	}
+	for c := 'A'; c <= 'Z'; c++ {
+		drive := string(c) + ":"
+		targets, err := QueryDosDevice(drive)
+		if err != nil || len(targets) == 0 {
+			continue
+		}
+		if hasPathPrefix(path, targets[0]) {
+			rest := path[len(targets[0]):]
+			if rest == "" {
+				rest = `\`
+			}
+			return drive + rest, nil
+		}
+	}
+	if !strings.HasPrefix(path, `\`) {
+		return "", &os.PathError{Op: "convert NT path", Path: path, Err: syscall.EINVAL}
+	}
+	return `\\?\GLOBALROOT` + path, nil
+}
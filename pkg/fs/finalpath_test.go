@@ -0,0 +1,67 @@
+package fs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestGetFinalPathNameByHandle(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dir, err = filepath.EvalSymlinks(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := openDirectory(dir, cFILE_READ_ATTRIBUTES)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer syscall.CloseHandle(h)
+
+	dosPath, err := GetFinalPathNameByHandle(h, VolumeNameDOS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.EqualFold(dosPath, `\\?\`+dir) {
+		t.Fatalf("expected %s, got %s", dir, dosPath)
+	}
+
+	ntPath, err := GetFinalPathNameByHandle(h, VolumeNameNT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(ntPath, `\Device\`) {
+		t.Fatalf("unexpected NT path %s", ntPath)
+	}
+	p, err := DosPathFromNTPath(ntPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.EqualFold(p, dir) {
+		t.Fatalf("expected %s, got %s", dir, p)
+	}
+
+	p, err = DosPathFromNTPath(`\??\UNC\server\share\file`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p != `\\server\share\file` {
+		t.Fatalf("unexpected UNC path %s", p)
+	}
+
+	const volumePath = `\??\Volume{01234567-89ab-cdef-0123-456789abcdef}\file`
+	p, err = DosPathFromNTPath(volumePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p != `\\?\`+volumePath[4:] {
+		t.Fatalf("unexpected volume path %s", p)
+	}
+}
@@ -0,0 +1,158 @@
+package fs
+
+import (
+	"os"
+	"strings"
+	"syscall"
+)
+
+//sys getFullPathName(path *uint16, size uint32, buf *uint16, filePart **uint16) (n uint32, err error) [failretval==0] = GetFullPathNameW
+
+const (
+	extendedPrefix = `\\?\`
+	devicePrefix   = `\\.\`
+	ntPrefix       = `\??\`
+)
+
+// FullPath returns the absolute form of path, resolved against the current directory
+// by the rules Win32 applies to every path it is given: / is converted to \, . and ..
+// components are removed, and trailing spaces and dots are trimmed from the last
+// component. Neither path nor the result is limited to MAX_PATH characters. Paths
+// starting with \\?\ are returned unchanged, since Win32 does not normalize them.
+func FullPath(path string) (string, error) {
+	if strings.HasPrefix(path, extendedPrefix) {
+		return path, nil
+	}
+	p, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return "", err
+	}
+	buf := make([]uint16, syscall.MAX_PATH)
+	for {
+		n, err := getFullPathName(p, uint32(len(buf)), &buf[0], nil)
+		if err != nil {
+			return "", &os.PathError{Op: "GetFullPathName", Path: path, Err: err}
+		}
+		// If the buffer is too small, n is the required size including the NUL.
+		if n < uint32(len(buf)) {
+			return syscall.UTF16ToString(buf[:n]), nil
+		}
+		buf = make([]uint16, n)
+	}
+}
+
+// ExtendedPath returns the \\?\ form of path, such as \\?\C:\dir or
+// \\?\UNC\server\share\dir, which Win32 passes to the file system without further
+// parsing and which is therefore not limited to MAX_PATH characters. The path is first
+// normalized with FullPath, so relative paths are resolved against the current
+// directory.
+func ExtendedPath(path string) (string, error) {
+	if strings.HasPrefix(path, extendedPrefix) {
+		return path, nil
+	}
+	full, err := FullPath(path)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case strings.HasPrefix(full, devicePrefix):
+		return extendedPrefix + full[len(devicePrefix):], nil
+	case strings.HasPrefix(full, `\\`):
+		return extendedPrefix + `UNC\` + full[2:], nil
+	}
+	return extendedPrefix + full, nil
+}
+
+// NTPathFromDosPath converts a Win32 path to the NT path that Win32 would pass to the
+// kernel for it, such as \??\C:\dir or \??\UNC\server\share\dir. These paths are
+// resolved through the caller's MS-DOS device names; see DevicePathFromDosPath to
+// resolve them further.
+func NTPathFromDosPath(path string) (string, error) {
+	ext, err := ExtendedPath(path)
+	if err != nil {
+		return "", err
+	}
+	return ntPrefix + ext[len(extendedPrefix):], nil
+}
+
+// DevicePathFromDosPath converts a Win32 path to a path that starts with the NT object
+// that implements it, such as \Device\HarddiskVolume3\dir for a path on a local volume
+// or \Device\Mup\server\share\dir for a path on a network share. The MS-DOS device
+// name at the start of the path, a drive letter or a volume GUID, is looked up with
+// QueryDosDevice.
+func DevicePathFromDosPath(path string) (string, error) {
+	ntPath, err := NTPathFromDosPath(path)
+	if err != nil {
+		return "", err
+	}
+	rest := ntPath[len(ntPrefix):]
+	switch {
+	case hasPathPrefix(rest, "UNC"):
+		return `\Device\Mup` + rest[len("UNC"):], nil
+	case hasPathPrefix(rest, "GLOBALROOT"):
+		return rest[len("GLOBALROOT"):], nil
+	}
+	name := rest
+	if i := strings.IndexByte(rest, '\\'); i >= 0 {
+		name = rest[:i]
+	}
+	targets, err := QueryDosDevice(name)
+	if err != nil {
+		return "", err
+	}
+	if len(targets) == 0 {
+		return "", &os.PathError{Op: "QueryDosDevice", Path: name, Err: syscall.ERROR_FILE_NOT_FOUND}
+	}
+	return targets[0] + rest[len(name):], nil
+}
+
+// VolumeGUIDPathFromDosPath converts a Win32 path on a local volume to a path that
+// starts with the volume's GUID path, such as \\?\Volume{...}\dir, which remains valid
+// if the volume's drive letter or mount point changes.
+func VolumeGUIDPathFromDosPath(path string) (string, error) {
+	full, err := FullPath(path)
+	if err != nil {
+		return "", err
+	}
+	mountPoint, err := GetVolumePathName(full)
+	if err != nil {
+		return "", err
+	}
+	volume, err := GetVolumeNameForVolumeMountPoint(mountPoint)
+	if err != nil {
+		return "", err
+	}
+	// The mount point is a prefix of the path, up to the trailing backslash.
+	rest := strings.TrimPrefix(full, extendedPrefix)
+	mp := strings.TrimPrefix(mountPoint, extendedPrefix)
+	if f := withTrailingBackslash(rest); len(f) < len(mp) || !strings.EqualFold(f[:len(mp)], mp) {
+		return "", &os.PathError{Op: "convert to volume path", Path: path, Err: syscall.EINVAL}
+	}
+	rel := ""
+	if len(rest) > len(mp) {
+		rel = rest[len(mp):]
+	}
+	return volume + rel, nil
+}
+
+// DosPathFromVolumeGUIDPath converts a path that starts with a volume GUID path, such
+// as \\?\Volume{...}\dir, to a path under the first mount point of the volume, such as
+// C:\dir. If the volume is not mounted, path is returned unchanged, since Win32 APIs
+// accept volume GUID paths.
+func DosPathFromVolumeGUIDPath(path string) (string, error) {
+	if !strings.HasPrefix(strings.ToLower(path), `\\?\volume{`) {
+		return "", &os.PathError{Op: "convert volume path", Path: path, Err: syscall.EINVAL}
+	}
+	volume, rest := path, ""
+	if i := strings.IndexByte(path[len(extendedPrefix):], '\\'); i >= 0 {
+		volume, rest = path[:len(extendedPrefix)+i+1], path[len(extendedPrefix)+i+1:]
+	}
+	mountPoints, err := VolumeMountPoints(volume)
+	if err != nil {
+		return "", err
+	}
+	if len(mountPoints) == 0 {
+		return path, nil
+	}
+	return mountPoints[0] + rest, nil
+}
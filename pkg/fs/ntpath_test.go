@@ -0,0 +1,112 @@
+package fs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestExtendedPath(t *testing.T) {
+	for _, test := range []struct {
+		path, extended, nt string
+	}{
+		{`C:\dir\..\file.txt`, `\\?\C:\file.txt`, `\??\C:\file.txt`},
+		{`C:/dir/./file. `, `\\?\C:\dir\file`, `\??\C:\dir\file`},
+		{`\\server\share\dir`, `\\?\UNC\server\share\dir`, `\??\UNC\server\share\dir`},
+		{`\\.\pipe\name`, `\\?\pipe\name`, `\??\pipe\name`},
+		{`\\?\C:\dir\..\x.`, `\\?\C:\dir\..\x.`, `\??\C:\dir\..\x.`},
+	} {
+		p, err := ExtendedPath(test.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p != test.extended {
+			t.Errorf("%s: expected %s, got %s", test.path, test.extended, p)
+		}
+		p, err = NTPathFromDosPath(test.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p != test.nt {
+			t.Errorf("%s: expected %s, got %s", test.path, test.nt, p)
+		}
+	}
+}
+
+func TestFullPathLong(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	long := dir + strings.Repeat(`\`+strings.Repeat("x", 100), 4)
+	p, err := FullPath(long + `\sub\..\.`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p != long {
+		t.Fatalf("expected %s, got %s", long, p)
+	}
+}
+
+func TestVolumePathConversions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dir, err = filepath.EvalSymlinks(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := openDirectory(dir, cFILE_READ_ATTRIBUTES)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer syscall.CloseHandle(h)
+
+	expected, err := GetFinalPathNameByHandle(h, VolumeNameNT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := DevicePathFromDosPath(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.EqualFold(p, expected) {
+		t.Fatalf("expected %s, got %s", expected, p)
+	}
+
+	expected, err = GetFinalPathNameByHandle(h, VolumeNameGUID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	guidPath, err := VolumeGUIDPathFromDosPath(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.EqualFold(guidPath, expected) {
+		t.Fatalf("expected %s, got %s", expected, guidPath)
+	}
+	p, err = DevicePathFromDosPath(guidPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(p, `\Device\`) {
+		t.Fatalf("unexpected device path %s", p)
+	}
+
+	p, err = DosPathFromVolumeGUIDPath(guidPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(p); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DosPathFromVolumeGUIDPath(dir); err == nil {
+		t.Fatal("expected error for a path without a volume GUID")
+	}
+}
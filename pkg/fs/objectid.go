@@ -0,0 +1,88 @@
+package fs
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	cFSCTL_SET_OBJECT_ID           = 0x90098
+	cFSCTL_GET_OBJECT_ID           = 0x9009c
+	cFSCTL_DELETE_OBJECT_ID        = 0x900a0
+	cFSCTL_CREATE_OR_GET_OBJECT_ID = 0x900c0
+)
+
+// ObjectID is the object identifier of a file or directory, as used by the distributed
+// link tracking service to find files that have been renamed or moved. Unlike a file
+// ID, it is preserved by backup and restore and by moves within a volume. It has the
+// layout of FILE_OBJECTID_BUFFER.
+type ObjectID struct {
+	// ID identifies the file on its volume.
+	ID [16]byte
+	// BirthVolumeID and BirthObjectID are the volume and object IDs the file had when
+	// the ID was created. The link tracking service updates ID when the file moves to
+	// another volume but leaves these unchanged.
+	BirthVolumeID [16]byte
+	BirthObjectID [16]byte
+	// DomainID is reserved and is normally zero.
+	DomainID [16]byte
+}
+
+func objectIDControl(path string, access uint32, op string, code uint32, in *ObjectID, out *ObjectID) error {
+	h, err := openDirectory(path, access)
+	if err != nil {
+		return err
+	}
+	defer syscall.CloseHandle(h)
+	var (
+		inp, outp     *byte
+		inLen, outLen uint32
+		n             uint32
+	)
+	if in != nil {
+		inp, inLen = (*byte)(unsafe.Pointer(in)), uint32(unsafe.Sizeof(ObjectID{}))
+	}
+	if out != nil {
+		outp, outLen = (*byte)(unsafe.Pointer(out)), uint32(unsafe.Sizeof(ObjectID{}))
+	}
+	err = syscall.DeviceIoControl(h, code, inp, inLen, outp, outLen, &n, nil)
+	if err != nil {
+		return &os.PathError{Op: op, Path: path, Err: err}
+	}
+	return nil
+}
+
+// GetObjectID returns the object ID of the file or directory at path. If it does not
+// have one, the error satisfies os.IsNotExist.
+func GetObjectID(path string) (*ObjectID, error) {
+	var id ObjectID
+	err := objectIDControl(path, cFILE_READ_ATTRIBUTES, "FSCTL_GET_OBJECT_ID", cFSCTL_GET_OBJECT_ID, nil, &id)
+	if err != nil {
+		return nil, err
+	}
+	return &id, nil
+}
+
+// CreateOrGetObjectID returns the object ID of the file or directory at path,
+// assigning it a new one if it does not have one.
+func CreateOrGetObjectID(path string) (*ObjectID, error) {
+	var id ObjectID
+	err := objectIDControl(path, cFILE_READ_ATTRIBUTES|cFILE_WRITE_ATTRIBUTES, "FSCTL_CREATE_OR_GET_OBJECT_ID", cFSCTL_CREATE_OR_GET_OBJECT_ID, nil, &id)
+	if err != nil {
+		return nil, err
+	}
+	return &id, nil
+}
+
+// SetObjectID sets the object ID of the file or directory at path, which must not
+// already have one. This is normally used to restore files from a backup, and requires
+// the SeRestorePrivilege.
+func SetObjectID(path string, id *ObjectID) error {
+	return objectIDControl(path, cFILE_WRITE_ATTRIBUTES, "FSCTL_SET_OBJECT_ID", cFSCTL_SET_OBJECT_ID, id, nil)
+}
+
+// DeleteObjectID removes the object ID of the file or directory at path.
+func DeleteObjectID(path string) error {
+	return objectIDControl(path, cFILE_WRITE_ATTRIBUTES, "FSCTL_DELETE_OBJECT_ID", cFSCTL_DELETE_OBJECT_ID, nil, nil)
+}
@@ -0,0 +1,67 @@
+package fs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestObjectID(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "file")
+	if err := ioutil.WriteFile(path, nil, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := GetObjectID(path); !os.IsNotExist(err) {
+		t.Fatalf("expected a not-exist error, got %v", err)
+	}
+	id, err := CreateOrGetObjectID(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id.ID == ([16]byte{}) {
+		t.Fatal("empty object ID")
+	}
+
+	// The object ID follows the file across renames.
+	renamed := filepath.Join(dir, "renamed")
+	if err := os.Rename(path, renamed); err != nil {
+		t.Fatal(err)
+	}
+	id2, err := GetObjectID(renamed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *id2 != *id {
+		t.Fatalf("expected %x, got %x", *id, *id2)
+	}
+
+	if err := DeleteObjectID(renamed); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GetObjectID(renamed); !os.IsNotExist(err) {
+		t.Fatalf("expected a not-exist error, got %v", err)
+	}
+
+	err = SetObjectID(renamed, id)
+	if perr, ok := err.(*os.PathError); ok && (perr.Err == syscall.Errno(1314) || perr.Err == syscall.ERROR_ACCESS_DENIED) {
+		t.Skip("SeRestorePrivilege is not held")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	id2, err = GetObjectID(renamed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id2.ID != id.ID {
+		t.Fatalf("expected %x, got %x", id.ID, id2.ID)
+	}
+}
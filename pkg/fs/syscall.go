@@ -0,0 +1,3 @@
+package fs
+
+//go:generate go run $GOROOT/src/syscall/mksyscall_windows.go -output zsyscall.go casesensitive.go dosdevice.go finalpath.go ntpath.go volume.go volumeinfo.go
@@ -0,0 +1,115 @@
+package fs
+
+import (
+	"os"
+	"strings"
+	"syscall"
+	"unicode/utf16"
+)
+
+//sys findFirstVolume(volumeName *uint16, size uint32) (h syscall.Handle, err error) [failretval==syscall.InvalidHandle] = FindFirstVolumeW
+//sys findNextVolume(h syscall.Handle, volumeName *uint16, size uint32) (err error) = FindNextVolumeW
+//sys findVolumeClose(h syscall.Handle) (err error) = FindVolumeClose
+//sys getVolumePathNamesForVolumeName(volumeName string, paths *uint16, size uint32, length *uint32) (err error) = GetVolumePathNamesForVolumeNameW
+//sys getVolumeNameForVolumeMountPoint(mountPoint string, volumeName *uint16, size uint32) (err error) = GetVolumeNameForVolumeMountPointW
+//sys setVolumeMountPoint(mountPoint string, volumeName string) (err error) = SetVolumeMountPointW
+//sys deleteVolumeMountPoint(mountPoint string) (err error) = DeleteVolumeMountPointW
+
+const (
+	cERROR_MORE_DATA = syscall.Errno(234)
+
+	// volumeNameSize is large enough for a volume GUID path such as
+	// \\?\Volume{26a21bda-a627-11d7-9931-806e6f6e6963}\.
+	volumeNameSize = 50
+)
+
+// withTrailingBackslash returns path with a trailing backslash, which the volume mount
+// point functions require.
+func withTrailingBackslash(path string) string {
+	if strings.HasSuffix(path, `\`) {
+		return path
+	}
+	return path + `\`
+}
+
+// Volumes returns the GUID paths of the volumes on the system, such as
+// \\?\Volume{26a21bda-a627-11d7-9931-806e6f6e6963}\.
+func Volumes() ([]string, error) {
+	var name [volumeNameSize]uint16
+	h, err := findFirstVolume(&name[0], uint32(len(name)))
+	if err != nil {
+		return nil, &os.SyscallError{Syscall: "FindFirstVolume", Err: err}
+	}
+	defer findVolumeClose(h)
+	var volumes []string
+	for {
+		volumes = append(volumes, syscall.UTF16ToString(name[:]))
+		err = findNextVolume(h, &name[0], uint32(len(name)))
+		if err == syscall.ERROR_NO_MORE_FILES {
+			return volumes, nil
+		}
+		if err != nil {
+			return nil, &os.SyscallError{Syscall: "FindNextVolume", Err: err}
+		}
+	}
+}
+
+// VolumeMountPoints returns the drive letters and directories at which volume, a volume
+// GUID path, is mounted, such as C:\ and C:\mnt\data\.
+func VolumeMountPoints(volume string) ([]string, error) {
+	volume = withTrailingBackslash(volume)
+	buf := make([]uint16, syscall.MAX_PATH)
+	for {
+		var n uint32
+		err := getVolumePathNamesForVolumeName(volume, &buf[0], uint32(len(buf)), &n)
+		if err == cERROR_MORE_DATA {
+			buf = make([]uint16, n)
+			continue
+		}
+		if err != nil {
+			return nil, &os.PathError{Op: "GetVolumePathNamesForVolumeName", Path: volume, Err: err}
+		}
+		var paths []string
+		for _, s := range strings.Split(string(utf16.Decode(buf[:n])), "\x00") {
+			if s != "" {
+				paths = append(paths, s)
+			}
+		}
+		return paths, nil
+	}
+}
+
+// GetVolumeNameForVolumeMountPoint returns the GUID path of the volume mounted at
+// mountPoint, which is a drive letter such as C:\ or a mounted folder.
+func GetVolumeNameForVolumeMountPoint(mountPoint string) (string, error) {
+	mountPoint = withTrailingBackslash(mountPoint)
+	var name [volumeNameSize]uint16
+	err := getVolumeNameForVolumeMountPoint(mountPoint, &name[0], uint32(len(name)))
+	if err != nil {
+		return "", &os.PathError{Op: "GetVolumeNameForVolumeMountPoint", Path: mountPoint, Err: err}
+	}
+	return syscall.UTF16ToString(name[:]), nil
+}
+
+// SetVolumeMountPoint mounts volume, a volume GUID path, at mountPoint, which is either
+// a drive letter such as X:\ or an empty directory on an NTFS volume. This requires
+// administrator rights.
+func SetVolumeMountPoint(mountPoint string, volume string) error {
+	mountPoint = withTrailingBackslash(mountPoint)
+	err := setVolumeMountPoint(mountPoint, withTrailingBackslash(volume))
+	if err != nil {
+		return &os.PathError{Op: "SetVolumeMountPoint", Path: mountPoint, Err: err}
+	}
+	return nil
+}
+
+// DeleteVolumeMountPoint removes the drive letter or mounted folder mountPoint. A mounted
+// folder remains as an empty directory.
+func DeleteVolumeMountPoint(mountPoint string) error {
+	mountPoint = withTrailingBackslash(mountPoint)
+	err := deleteVolumeMountPoint(mountPoint)
+	if err != nil {
+		return &os.PathError{Op: "DeleteVolumeMountPoint", Path: mountPoint, Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package fs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestVolumes(t *testing.T) {
+	volumes, err := Volumes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(volumes) == 0 {
+		t.Fatal("no volumes")
+	}
+	systemDrive := os.Getenv("SystemDrive") + `\`
+	systemVolume, err := GetVolumeNameForVolumeMountPoint(systemDrive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, v := range volumes {
+		found = found || v == systemVolume
+	}
+	if !found {
+		t.Fatalf("%s not in %v", systemVolume, volumes)
+	}
+	mountPoints, err := VolumeMountPoints(systemVolume)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found = false
+	for _, m := range mountPoints {
+		found = found || strings.EqualFold(m, systemDrive)
+	}
+	if !found {
+		t.Fatalf("%s not in %v", systemDrive, mountPoints)
+	}
+}
+
+func TestSetVolumeMountPoint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	mnt := filepath.Join(dir, "mnt")
+	if err = os.Mkdir(mnt, 0777); err != nil {
+		t.Fatal(err)
+	}
+	systemVolume, err := GetVolumeNameForVolumeMountPoint(os.Getenv("SystemDrive"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = SetVolumeMountPoint(mnt, systemVolume)
+	if perr, ok := err.(*os.PathError); ok && perr.Err == syscall.ERROR_ACCESS_DENIED {
+		t.Skip("mounting volumes requires administrator rights")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer DeleteVolumeMountPoint(mnt)
+	v, err := GetVolumeNameForVolumeMountPoint(mnt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != systemVolume {
+		t.Fatalf("expected %s, got %s", systemVolume, v)
+	}
+	err = DeleteVolumeMountPoint(mnt)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,201 @@
+package fs
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+//sys getDiskFreeSpaceEx(directory string, freeBytesAvailable *uint64, totalBytes *uint64, totalFreeBytes *uint64) (err error) = GetDiskFreeSpaceExW
+//sys getDiskFreeSpace(rootPath string, sectorsPerCluster *uint32, bytesPerSector *uint32, freeClusters *uint32, totalClusters *uint32) (err error) = GetDiskFreeSpaceW
+//sys getVolumePathName(fileName string, volumePathName *uint16, size uint32) (err error) = GetVolumePathNameW
+//sys getVolumeInformationByHandle(file syscall.Handle, volumeName *uint16, volumeNameSize uint32, serialNumber *uint32, maxComponentLength *uint32, flags *uint32, fileSystemName *uint16, fileSystemNameSize uint32) (err error) = GetVolumeInformationByHandleW
+
+const (
+	fileStorageInfo = 0x10
+
+	// maxVolumeLabelSize is large enough for a volume label or file system name,
+	// including the NUL.
+	maxVolumeLabelSize = syscall.MAX_PATH + 1
+)
+
+// DiskSpace describes the capacity of a volume.
+type DiskSpace struct {
+	// FreeBytesAvailable is the free space available to the caller, taking disk
+	// quotas into account.
+	FreeBytesAvailable uint64
+	// TotalBytes is the size of the volume that is available to the caller, taking
+	// disk quotas into account.
+	TotalBytes uint64
+	// TotalFreeBytes is the free space on the volume.
+	TotalFreeBytes uint64
+}
+
+// GetDiskFreeSpace returns the capacity of the volume containing the directory path.
+func GetDiskFreeSpace(path string) (*DiskSpace, error) {
+	var ds DiskSpace
+	err := getDiskFreeSpaceEx(path, &ds.FreeBytesAvailable, &ds.TotalBytes, &ds.TotalFreeBytes)
+	if err != nil {
+		return nil, &os.PathError{Op: "GetDiskFreeSpaceEx", Path: path, Err: err}
+	}
+	return &ds, nil
+}
+
+// GetVolumePathName returns the mount point of the volume containing path, such as C:\
+// or a mounted folder, with a trailing backslash.
+func GetVolumePathName(path string) (string, error) {
+	buf := make([]uint16, syscall.MAX_LONG_PATH)
+	err := getVolumePathName(path, &buf[0], uint32(len(buf)))
+	if err != nil {
+		return "", &os.PathError{Op: "GetVolumePathName", Path: path, Err: err}
+	}
+	return syscall.UTF16ToString(buf), nil
+}
+
+// VolumeFlags holds the FILE_* flags that describe the features of a file system, as
+// returned in VolumeInfo.
+type VolumeFlags uint32
+
+// Flags in VolumeFlags. Their names follow the FILE_* flags documented for
+// GetVolumeInformation.
+const (
+	VolumeCaseSensitiveSearch        VolumeFlags = 0x1
+	VolumeCasePreservedNames         VolumeFlags = 0x2
+	VolumeUnicodeOnDisk              VolumeFlags = 0x4
+	VolumePersistentACLs             VolumeFlags = 0x8
+	VolumeFileCompression            VolumeFlags = 0x10
+	VolumeQuotas                     VolumeFlags = 0x20
+	VolumeSupportsSparseFiles        VolumeFlags = 0x40
+	VolumeSupportsReparsePoints      VolumeFlags = 0x80
+	VolumeIsCompressed               VolumeFlags = 0x8000
+	VolumeSupportsObjectIDs          VolumeFlags = 0x10000
+	VolumeSupportsEncryption         VolumeFlags = 0x20000
+	VolumeNamedStreams               VolumeFlags = 0x40000
+	VolumeReadOnly                   VolumeFlags = 0x80000
+	VolumeSequentialWriteOnce        VolumeFlags = 0x100000
+	VolumeSupportsTransactions       VolumeFlags = 0x200000
+	VolumeSupportsHardLinks          VolumeFlags = 0x400000
+	VolumeSupportsExtendedAttributes VolumeFlags = 0x800000
+	VolumeSupportsOpenByFileID       VolumeFlags = 0x1000000
+	VolumeSupportsUsnJournal         VolumeFlags = 0x2000000
+	VolumeSupportsIntegrityStreams   VolumeFlags = 0x4000000
+	VolumeSupportsBlockRefcounting   VolumeFlags = 0x8000000
+	VolumeSupportsSparseVDL          VolumeFlags = 0x10000000
+	VolumeDAXVolume                  VolumeFlags = 0x20000000
+	VolumeSupportsGhosting           VolumeFlags = 0x40000000
+)
+
+// VolumeInfo describes a volume and its file system.
+type VolumeInfo struct {
+	// Label is the volume label, which may be empty.
+	Label string
+	// SerialNumber is the serial number assigned to the volume when it was formatted.
+	SerialNumber uint32
+	// MaxComponentLength is the maximum length of a file name component, in UTF-16
+	// characters.
+	MaxComponentLength uint32
+	// Flags describes the features supported by the file system.
+	Flags VolumeFlags
+	// FileSystem is the name of the file system, such as NTFS or ReFS.
+	FileSystem string
+}
+
+func getVolumeInfo(h syscall.Handle) (*VolumeInfo, error) {
+	var (
+		info  VolumeInfo
+		flags uint32
+		label [maxVolumeLabelSize]uint16
+		fs    [maxVolumeLabelSize]uint16
+	)
+	err := getVolumeInformationByHandle(h, &label[0], uint32(len(label)), &info.SerialNumber, &info.MaxComponentLength, &flags, &fs[0], uint32(len(fs)))
+	if err != nil {
+		return nil, err
+	}
+	info.Label = syscall.UTF16ToString(label[:])
+	info.Flags = VolumeFlags(flags)
+	info.FileSystem = syscall.UTF16ToString(fs[:])
+	return &info, nil
+}
+
+// GetVolumeInformationByHandle returns information about the volume containing the file
+// opened as h.
+func GetVolumeInformationByHandle(h syscall.Handle) (*VolumeInfo, error) {
+	info, err := getVolumeInfo(h)
+	if err != nil {
+		return nil, &os.SyscallError{Syscall: "GetVolumeInformationByHandle", Err: err}
+	}
+	return info, nil
+}
+
+// GetVolumeInformation returns information about the volume containing the file or
+// directory at path.
+func GetVolumeInformation(path string) (*VolumeInfo, error) {
+	h, err := openDirectory(path, cFILE_READ_ATTRIBUTES)
+	if err != nil {
+		return nil, err
+	}
+	defer syscall.CloseHandle(h)
+	info, err := getVolumeInfo(h)
+	if err != nil {
+		return nil, &os.PathError{Op: "GetVolumeInformationByHandle", Path: path, Err: err}
+	}
+	return info, nil
+}
+
+type fileStorageInformation struct {
+	LogicalBytesPerSector                                 uint32
+	PhysicalBytesPerSectorForAtomicity                    uint32
+	PhysicalBytesPerSectorForPerformance                  uint32
+	FileSystemEffectivePhysicalBytesPerSectorForAtomicity uint32
+	Flags                                                 uint32
+	ByteOffsetForSectorAlignment                          uint32
+	ByteOffsetForPartitionAlignment                       uint32
+}
+
+// VolumeGeometry describes the allocation units of a volume.
+type VolumeGeometry struct {
+	// BytesPerSector is the logical sector size of the volume.
+	BytesPerSector uint32
+	// PhysicalBytesPerSector is the sector size that the underlying storage device
+	// writes without a read-modify-write cycle. It is the same as BytesPerSector if the
+	// device does not report it.
+	PhysicalBytesPerSector uint32
+	// SectorsPerCluster is the number of sectors in each cluster.
+	SectorsPerCluster uint32
+	// BytesPerCluster is the cluster size, the unit in which the file system allocates
+	// space for files.
+	BytesPerCluster uint32
+	// TotalClusters and FreeClusters are the number of clusters on the volume and the
+	// number of them that are free. They saturate at 2^32-1 on very large volumes;
+	// use GetDiskFreeSpace for exact capacity.
+	TotalClusters uint32
+	FreeClusters  uint32
+}
+
+// GetVolumeGeometry returns the sector and cluster sizes of the volume containing the
+// file or directory at path.
+func GetVolumeGeometry(path string) (*VolumeGeometry, error) {
+	root, err := GetVolumePathName(path)
+	if err != nil {
+		return nil, err
+	}
+	var g VolumeGeometry
+	err = getDiskFreeSpace(root, &g.SectorsPerCluster, &g.BytesPerSector, &g.FreeClusters, &g.TotalClusters)
+	if err != nil {
+		return nil, &os.PathError{Op: "GetDiskFreeSpace", Path: root, Err: err}
+	}
+	g.BytesPerCluster = g.SectorsPerCluster * g.BytesPerSector
+	g.PhysicalBytesPerSector = g.BytesPerSector
+
+	// FileStorageInfo is only supported on Windows 8 and later.
+	h, err := openDirectory(path, cFILE_READ_ATTRIBUTES)
+	if err != nil {
+		return nil, err
+	}
+	defer syscall.CloseHandle(h)
+	var si fileStorageInformation
+	if getFileInformationByHandleEx(h, fileStorageInfo, (*byte)(unsafe.Pointer(&si)), uint32(unsafe.Sizeof(si))) == nil && si.PhysicalBytesPerSectorForPerformance != 0 {
+		g.PhysicalBytesPerSector = si.PhysicalBytesPerSectorForPerformance
+	}
+	return &g, nil
+}
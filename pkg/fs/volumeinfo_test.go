@@ -0,0 +1,51 @@
+package fs
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestGetDiskFreeSpace(t *testing.T) {
+	ds, err := GetDiskFreeSpace(os.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ds.TotalBytes == 0 || ds.TotalFreeBytes > ds.TotalBytes || ds.FreeBytesAvailable > ds.TotalBytes {
+		t.Fatalf("invalid disk space %+v", ds)
+	}
+}
+
+func TestGetVolumeInformation(t *testing.T) {
+	systemDrive := os.Getenv("SystemDrive") + `\`
+	info, err := GetVolumeInformation(systemDrive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.FileSystem == "" || info.MaxComponentLength == 0 {
+		t.Fatalf("invalid volume information %+v", info)
+	}
+	if info.Flags&VolumeCasePreservedNames == 0 {
+		t.Errorf("%s does not preserve case: %#x", systemDrive, info.Flags)
+	}
+	root, err := GetVolumePathName(os.Getenv("SystemRoot"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.EqualFold(root, systemDrive) {
+		t.Errorf("expected %s, got %s", systemDrive, root)
+	}
+}
+
+func TestGetVolumeGeometry(t *testing.T) {
+	g, err := GetVolumeGeometry(os.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.BytesPerSector == 0 || g.BytesPerSector&(g.BytesPerSector-1) != 0 {
+		t.Fatalf("invalid sector size %d", g.BytesPerSector)
+	}
+	if g.BytesPerCluster != g.BytesPerSector*g.SectorsPerCluster || g.PhysicalBytesPerSector < g.BytesPerSector {
+		t.Fatalf("invalid geometry %+v", g)
+	}
+}
@@ -0,0 +1,367 @@
+// Package mux runs many logical connections, called streams, over a single
+// connection such as a named pipe or a Hyper-V socket. Pipe instance limits and the
+// cost of registering Hyper-V socket services make a connection per stream expensive
+// for protocols that open many short-lived streams.
+//
+// Each stream has its own flow control window, so a stream whose data is not being
+// read does not prevent data from flowing on the others. The multiplexer does not
+// detect peers that have stopped responding; wrap the connection with
+// winio.NewHeartbeatConn for that.
+package mux
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+)
+
+const (
+	frameOpen = iota
+	frameData
+	frameWindow
+	frameClose
+	frameReset
+
+	// Frames are a type byte followed by the stream ID and a length, which is the
+	// size of the payload for data frames and the window increment for window
+	// frames. Other frames have no payload.
+	frameHeaderSize  = 9
+	maxFramePayload  = 64 * 1024
+	initialWindow    = 64 * 1024
+	maxStreamID      = 1<<32 - 1
+	defaultWindow    = 256 * 1024
+	defaultBacklog   = 256
+	clientFirstID    = 1
+	serverFirstID    = 2
+	streamIDInterval = 2
+)
+
+var (
+	// ErrSessionClosed is returned when using a session, or one of its streams,
+	// after the session or its underlying connection has been closed.
+	ErrSessionClosed = errors.New("multiplexer session has been closed")
+	// ErrStreamClosed is returned when using a stream after it has been closed.
+	ErrStreamClosed = errors.New("stream has been closed")
+	// ErrStreamReset is returned when the peer has abandoned a stream, including
+	// when it opened too many streams that were not accepted.
+	ErrStreamReset = errors.New("stream was reset by the peer")
+	// ErrTimeout is returned when a deadline passes.
+	ErrTimeout error = &timeoutError{}
+
+	errProtocol         = errors.New("invalid multiplexer frame")
+	errStreamsExhausted = errors.New("no stream IDs remain")
+)
+
+type controlFrame struct {
+	frameType byte
+	id        uint32
+	length    uint32
+}
+
+type timeoutError struct{}
+
+func (e *timeoutError) Error() string   { return "i/o timeout" }
+func (e *timeoutError) Timeout() bool   { return true }
+func (e *timeoutError) Temporary() bool { return true }
+
+// Config contains configuration for a session. Both ends of a connection may use
+// different configurations.
+type Config struct {
+	// ReceiveWindow is the number of bytes that may be buffered for each stream
+	// before the peer must wait for the application to read them. If zero, 256KB
+	// is used. Values smaller than 64KB are raised to 64KB.
+	ReceiveWindow uint32
+
+	// AcceptBacklog is the number of streams opened by the peer that may wait
+	// to be accepted. Further streams are reset. If zero, 256 is used.
+	AcceptBacklog int
+}
+
+// Session multiplexes streams over a connection. One end of the connection must
+// create its session with Client and the other with Server, but either end may open
+// streams. A Session is a net.Listener for the streams opened by the peer.
+type Session struct {
+	conn      net.Conn
+	cfg       Config
+	writeLock sync.Mutex
+
+	// Control frames sent in response to the peer are queued for controlLoop, since
+	// the receive loop must not block on writes.
+	controlLock   sync.Mutex
+	control       []controlFrame
+	controlNotify chan struct{}
+
+	m        sync.Mutex
+	streams  map[uint32]*Stream
+	nextID   uint64
+	acceptCh chan *Stream
+
+	closeOnce sync.Once
+	closed    chan struct{}
+	err       error
+}
+
+// Client creates a session for the client end of c. The session takes ownership of c.
+func Client(c net.Conn, cfg *Config) *Session {
+	return newSession(c, cfg, clientFirstID)
+}
+
+// Server creates a session for the server end of c. The session takes ownership of c.
+func Server(c net.Conn, cfg *Config) *Session {
+	return newSession(c, cfg, serverFirstID)
+}
+
+func newSession(c net.Conn, cfg *Config, firstID uint64) *Session {
+	s := &Session{
+		conn:          c,
+		controlNotify: make(chan struct{}, 1),
+		streams:       make(map[uint32]*Stream),
+		nextID:        firstID,
+		closed:        make(chan struct{}),
+	}
+	if cfg != nil {
+		s.cfg = *cfg
+	}
+	if s.cfg.ReceiveWindow == 0 {
+		s.cfg.ReceiveWindow = defaultWindow
+	}
+	if s.cfg.ReceiveWindow < initialWindow {
+		s.cfg.ReceiveWindow = initialWindow
+	}
+	if s.cfg.AcceptBacklog == 0 {
+		s.cfg.AcceptBacklog = defaultBacklog
+	}
+	s.acceptCh = make(chan *Stream, s.cfg.AcceptBacklog)
+	go s.recvLoop()
+	go s.controlLoop()
+	return s
+}
+
+// Open opens a new stream to the peer. It does not wait for the peer to accept the
+// stream, and data written to the stream before then is buffered by the peer.
+func (s *Session) Open() (*Stream, error) {
+	s.m.Lock()
+	if s.isClosed() {
+		s.m.Unlock()
+		return nil, s.err
+	}
+	if s.nextID > maxStreamID {
+		s.m.Unlock()
+		return nil, errStreamsExhausted
+	}
+	st := newStream(s, uint32(s.nextID))
+	s.nextID += streamIDInterval
+	s.streams[st.id] = st
+	s.m.Unlock()
+	if err := s.writeFrame(frameOpen, st.id, 0, nil); err != nil {
+		s.remove(st.id)
+		return nil, err
+	}
+	st.grantWindow()
+	return st, nil
+}
+
+// Accept waits for the peer to open a stream and returns it.
+func (s *Session) Accept() (net.Conn, error) {
+	st, err := s.AcceptStream()
+	if err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+// AcceptStream is like Accept but returns a *Stream.
+func (s *Session) AcceptStream() (*Stream, error) {
+	select {
+	case st := <-s.acceptCh:
+		st.grantWindow()
+		return st, nil
+	case <-s.closed:
+		return nil, s.err
+	}
+}
+
+// Addr returns the local address of the underlying connection.
+func (s *Session) Addr() net.Addr {
+	return s.conn.LocalAddr()
+}
+
+// Close closes the session and the underlying connection. Streams that are still
+// open fail with ErrSessionClosed.
+func (s *Session) Close() error {
+	return s.fail(ErrSessionClosed)
+}
+
+// Done returns a channel that is closed when the session has been closed, either by
+// Close or because the underlying connection failed.
+func (s *Session) Done() <-chan struct{} {
+	return s.closed
+}
+
+func (s *Session) isClosed() bool {
+	select {
+	case <-s.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// fail closes the session with err, if it is not already closed.
+func (s *Session) fail(err error) error {
+	var cerr error
+	s.closeOnce.Do(func() {
+		if err == io.EOF {
+			err = ErrSessionClosed
+		}
+		s.err = err
+		close(s.closed)
+		cerr = s.conn.Close()
+	})
+	return cerr
+}
+
+func (s *Session) writeFrame(frameType byte, id uint32, length uint32, b []byte) error {
+	var hdr [frameHeaderSize]byte
+	hdr[0] = frameType
+	binary.LittleEndian.PutUint32(hdr[1:], id)
+	binary.LittleEndian.PutUint32(hdr[5:], length)
+	s.writeLock.Lock()
+	defer s.writeLock.Unlock()
+	if s.isClosed() {
+		return s.err
+	}
+	// Write each frame with a single call so that message mode pipes do not split it.
+	if _, err := s.conn.Write(append(hdr[:], b...)); err != nil {
+		// A partial frame leaves the connection unusable.
+		s.fail(err)
+		return err
+	}
+	return nil
+}
+
+// queueControl queues a frame without a payload to be written by controlLoop.
+func (s *Session) queueControl(frameType byte, id uint32, length uint32) {
+	s.controlLock.Lock()
+	s.control = append(s.control, controlFrame{frameType, id, length})
+	s.controlLock.Unlock()
+	notify(s.controlNotify)
+}
+
+// controlLoop writes queued control frames until the session is closed. A single
+// goroutine writes them all, however many the peer provokes.
+func (s *Session) controlLoop() {
+	for {
+		select {
+		case <-s.controlNotify:
+		case <-s.closed:
+			return
+		}
+		s.controlLock.Lock()
+		frames := s.control
+		s.control = nil
+		s.controlLock.Unlock()
+		for _, f := range frames {
+			if s.writeFrame(f.frameType, f.id, f.length, nil) != nil {
+				return
+			}
+		}
+	}
+}
+
+func (s *Session) stream(id uint32) *Stream {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return s.streams[id]
+}
+
+func (s *Session) remove(id uint32) {
+	s.m.Lock()
+	delete(s.streams, id)
+	s.m.Unlock()
+}
+
+func (s *Session) recvLoop() {
+	var hdr [frameHeaderSize]byte
+	for {
+		if _, err := io.ReadFull(s.conn, hdr[:]); err != nil {
+			s.fail(err)
+			return
+		}
+		id := binary.LittleEndian.Uint32(hdr[1:])
+		length := binary.LittleEndian.Uint32(hdr[5:])
+		if hdr[0] == frameData {
+			if length > maxFramePayload {
+				s.fail(errProtocol)
+				return
+			}
+			b := make([]byte, length)
+			_, err := io.ReadFull(s.conn, b)
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			if err != nil {
+				s.fail(err)
+				return
+			}
+			// Data for streams that have been removed is discarded.
+			if st := s.stream(id); st != nil {
+				if err := st.receive(b); err != nil {
+					s.fail(err)
+					return
+				}
+			}
+			continue
+		}
+		if length != 0 && hdr[0] != frameWindow {
+			s.fail(errProtocol)
+			return
+		}
+		var err error
+		switch hdr[0] {
+		case frameOpen:
+			err = s.accept(id)
+		case frameWindow:
+			if st := s.stream(id); st != nil {
+				st.addWindow(length)
+			}
+		case frameClose:
+			if st := s.stream(id); st != nil {
+				err = st.remoteClose()
+			}
+		case frameReset:
+			if st := s.stream(id); st != nil {
+				st.remoteReset()
+			}
+		default:
+			err = errProtocol
+		}
+		if err != nil {
+			s.fail(err)
+			return
+		}
+	}
+}
+
+// accept queues a stream opened by the peer, or resets it if the backlog is full.
+func (s *Session) accept(id uint32) error {
+	s.m.Lock()
+	if id == 0 || uint64(id)%streamIDInterval == s.nextID%streamIDInterval || s.streams[id] != nil {
+		s.m.Unlock()
+		return errProtocol
+	}
+	st := newStream(s, id)
+	s.streams[id] = st
+	s.m.Unlock()
+	select {
+	case s.acceptCh <- st:
+	default:
+		s.remove(id)
+		// The receive loop must never block on writes, since the peer may be
+		// waiting for it to read before it reads itself.
+		s.queueControl(frameReset, id, 0)
+	}
+	return nil
+}
@@ -0,0 +1,280 @@
+package mux
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+func sessionPair(t *testing.T, cfg *Config) (*Session, *Session) {
+	p1, p2 := net.Pipe()
+	return Client(p1, cfg), Server(p2, cfg)
+}
+
+func TestStreams(t *testing.T) {
+	c, s := sessionPair(t, nil)
+	defer c.Close()
+	defer s.Close()
+
+	// Each side echoes the streams opened by the other.
+	echo := func(sess *Session) {
+		for {
+			st, err := sess.AcceptStream()
+			if err != nil {
+				return
+			}
+			go func() {
+				io.Copy(st, st)
+				st.CloseWrite()
+			}()
+		}
+	}
+	go echo(c)
+	go echo(s)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		sess := c
+		if i%2 == 1 {
+			sess = s
+		}
+		data := make([]byte, 100000*i+1)
+		rand.New(rand.NewSource(int64(i))).Read(data)
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			st, err := sess.Open()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer st.Close()
+			go func() {
+				st.Write(data)
+				st.CloseWrite()
+			}()
+			b, err := ioutil.ReadAll(st)
+			if err != nil {
+				t.Errorf("stream %d: %s", i, err)
+				return
+			}
+			if !bytes.Equal(b, data) {
+				t.Errorf("stream %d: data mismatch", i)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestFlowControl(t *testing.T) {
+	c, s := sessionPair(t, &Config{ReceiveWindow: initialWindow})
+	defer c.Close()
+	defer s.Close()
+	st, err := c.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	peer, err := s.AcceptStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Filling the window blocks the writer without affecting other streams.
+	st.SetWriteDeadline(time.Now().Add(50 * time.Millisecond))
+	n, err := st.Write(make([]byte, 2*initialWindow))
+	if err != ErrTimeout || n != initialWindow {
+		t.Fatalf("got %d, %v", n, err)
+	}
+	other, err := s.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPeer, err := c.AcceptStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	go other.Write([]byte("hello"))
+	b := make([]byte, 5)
+	if _, err := io.ReadFull(otherPeer, b); err != nil || string(b) != "hello" {
+		t.Fatalf("got %q, %v", b, err)
+	}
+
+	// Reading the data opens the window again.
+	st.SetWriteDeadline(time.Time{})
+	done := make(chan error)
+	go func() {
+		_, err := st.Write(make([]byte, initialWindow))
+		done <- err
+	}()
+	if _, err := io.ReadFull(peer, make([]byte, 2*initialWindow)); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCloseEOF(t *testing.T) {
+	c, s := sessionPair(t, nil)
+	defer c.Close()
+	defer s.Close()
+	st, err := c.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	peer, err := s.AcceptStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.Write([]byte("data")); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.CloseWrite(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.Write([]byte("more")); err != ErrStreamClosed {
+		t.Fatalf("expected ErrStreamClosed, got %v", err)
+	}
+	b, err := ioutil.ReadAll(peer)
+	if err != nil || string(b) != "data" {
+		t.Fatalf("got %q, %v", b, err)
+	}
+	// The stream can still be read after CloseWrite.
+	if _, err := peer.Write([]byte("reply")); err != nil {
+		t.Fatal(err)
+	}
+	peer.Close()
+	b, err = ioutil.ReadAll(st)
+	if err != nil || string(b) != "reply" {
+		t.Fatalf("got %q, %v", b, err)
+	}
+	st.Close()
+	if _, err := st.Read(b); err != ErrStreamClosed {
+		t.Fatalf("expected ErrStreamClosed, got %v", err)
+	}
+}
+
+func TestReadDeadline(t *testing.T) {
+	c, s := sessionPair(t, nil)
+	defer c.Close()
+	defer s.Close()
+	st, err := c.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+	if _, err := st.Read(make([]byte, 1)); err != ErrTimeout {
+		t.Fatalf("expected ErrTimeout, got %v", err)
+	}
+	if nerr, ok := err.(net.Error); ok && !nerr.Timeout() {
+		t.Fatal("expected a timeout")
+	}
+}
+
+func TestAcceptBacklog(t *testing.T) {
+	c, s := sessionPair(t, &Config{AcceptBacklog: 1})
+	defer c.Close()
+	defer s.Close()
+	first, err := c.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := c.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := second.Read(make([]byte, 1)); err != ErrStreamReset {
+		t.Fatalf("expected ErrStreamReset, got %v", err)
+	}
+	st, err := s.AcceptStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.ID() != first.ID() {
+		t.Fatalf("accepted stream %d, expected %d", st.ID(), first.ID())
+	}
+}
+
+func TestResetsQueued(t *testing.T) {
+	p1, p2 := net.Pipe()
+	defer p1.Close()
+	s := Server(p2, &Config{AcceptBacklog: 1})
+	defer s.Close()
+	before := runtime.NumGoroutine()
+	// Open many streams without reading the resets for those beyond the backlog.
+	const n = 1000
+	b := make([]byte, n*frameHeaderSize)
+	for i := 0; i < n; i++ {
+		b[i*frameHeaderSize] = frameOpen
+		binary.LittleEndian.PutUint32(b[i*frameHeaderSize+1:], uint32(2*i+1))
+	}
+	if _, err := p1.Write(b); err != nil {
+		t.Fatal(err)
+	}
+	if g := runtime.NumGoroutine(); g > before+2 {
+		t.Fatalf("%d goroutines after queueing resets, %d before", g, before)
+	}
+	var hdr [frameHeaderSize]byte
+	for i := 1; i < n; i++ {
+		if _, err := io.ReadFull(p1, hdr[:]); err != nil {
+			t.Fatal(err)
+		}
+		if id := binary.LittleEndian.Uint32(hdr[1:]); hdr[0] != frameReset || id != uint32(2*i+1) {
+			t.Fatalf("got frame %d for stream %d, expected a reset for %d", hdr[0], id, 2*i+1)
+		}
+	}
+}
+
+func TestSessionClose(t *testing.T) {
+	c, s := sessionPair(t, nil)
+	defer s.Close()
+	st, err := c.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	peer, err := s.AcceptStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+	if _, err := st.Write([]byte("x")); err != ErrSessionClosed {
+		t.Fatalf("expected ErrSessionClosed, got %v", err)
+	}
+	if _, err := peer.Read(make([]byte, 1)); err != ErrSessionClosed {
+		t.Fatalf("expected ErrSessionClosed, got %v", err)
+	}
+	if _, err := s.Accept(); err != ErrSessionClosed {
+		t.Fatalf("expected ErrSessionClosed, got %v", err)
+	}
+	if _, err := c.Open(); err != ErrSessionClosed {
+		t.Fatalf("expected ErrSessionClosed, got %v", err)
+	}
+}
+
+func TestProtocolError(t *testing.T) {
+	p1, p2 := net.Pipe()
+	defer p1.Close()
+	s := Server(p2, nil)
+	defer s.Close()
+	// Streams opened by the client must have odd IDs.
+	var hdr [frameHeaderSize]byte
+	hdr[0] = frameOpen
+	binary.LittleEndian.PutUint32(hdr[1:], 2)
+	go p1.Write(hdr[:])
+	select {
+	case <-s.Done():
+	case <-time.After(time.Second):
+		t.Fatal("session did not fail")
+	}
+	if _, err := s.Accept(); err != errProtocol {
+		t.Fatalf("expected errProtocol, got %v", err)
+	}
+}
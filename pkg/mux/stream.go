@@ -0,0 +1,301 @@
+package mux
+
+import (
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// Stream is a logical connection within a session.
+type Stream struct {
+	s  *Session
+	id uint32
+
+	// writeLock serializes writes so that the data of concurrent writes is not
+	// interleaved, and so that no data follows the close frame.
+	writeLock sync.Mutex
+
+	m             sync.Mutex
+	buf           []byte
+	unacked       uint32
+	sendWindow    uint32
+	readClosed    bool
+	writeClosed   bool
+	closed        bool
+	reset         bool
+	readDeadline  time.Time
+	writeDeadline time.Time
+	readNotify    chan struct{}
+	writeNotify   chan struct{}
+}
+
+func newStream(s *Session, id uint32) *Stream {
+	return &Stream{
+		s:           s,
+		id:          id,
+		sendWindow:  initialWindow,
+		readNotify:  make(chan struct{}, 1),
+		writeNotify: make(chan struct{}, 1),
+	}
+}
+
+func notify(c chan struct{}) {
+	select {
+	case c <- struct{}{}:
+	default:
+	}
+}
+
+// ID returns the stream's ID, which is unique within its session.
+func (st *Stream) ID() uint32 {
+	return st.id
+}
+
+// grantWindow tells the peer about the part of the receive window beyond the
+// window that every stream starts with.
+func (st *Stream) grantWindow() {
+	if extra := st.s.cfg.ReceiveWindow - initialWindow; extra != 0 {
+		st.s.writeFrame(frameWindow, st.id, extra, nil)
+	}
+}
+
+// wait waits for c to be signaled, the deadline to pass, or the session to close.
+func (st *Stream) wait(c chan struct{}, deadline time.Time) error {
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		d := deadline.Sub(time.Now())
+		if d <= 0 {
+			return ErrTimeout
+		}
+		t := time.NewTimer(d)
+		defer t.Stop()
+		timeout = t.C
+	}
+	select {
+	case <-c:
+	case <-st.s.closed:
+	case <-timeout:
+		return ErrTimeout
+	}
+	return nil
+}
+
+// receive buffers data sent by the peer. It is called from the session's receive
+// loop and must not block.
+func (st *Stream) receive(b []byte) error {
+	st.m.Lock()
+	defer st.m.Unlock()
+	if st.readClosed || uint64(len(st.buf))+uint64(st.unacked)+uint64(len(b)) > uint64(st.s.cfg.ReceiveWindow) {
+		return errProtocol
+	}
+	if st.closed {
+		// Nobody will read the data, so return the window to the peer at once.
+		st.s.queueControl(frameWindow, st.id, uint32(len(b)))
+		return nil
+	}
+	st.buf = append(st.buf, b...)
+	notify(st.readNotify)
+	return nil
+}
+
+func (st *Stream) addWindow(n uint32) {
+	st.m.Lock()
+	st.sendWindow += n
+	st.m.Unlock()
+	notify(st.writeNotify)
+}
+
+func (st *Stream) remoteClose() error {
+	st.m.Lock()
+	if st.readClosed {
+		st.m.Unlock()
+		return errProtocol
+	}
+	st.readClosed = true
+	done := st.writeClosed
+	st.m.Unlock()
+	notify(st.readNotify)
+	if done {
+		st.s.remove(st.id)
+	}
+	return nil
+}
+
+func (st *Stream) remoteReset() {
+	st.m.Lock()
+	st.reset = true
+	st.m.Unlock()
+	notify(st.readNotify)
+	notify(st.writeNotify)
+	st.s.remove(st.id)
+}
+
+// Read reads data sent by the peer. It returns io.EOF once the peer has closed its
+// end of the stream and all its data has been read.
+func (st *Stream) Read(b []byte) (int, error) {
+	st.m.Lock()
+	for len(st.buf) == 0 {
+		var err error
+		switch {
+		case st.closed:
+			err = ErrStreamClosed
+		case st.readClosed:
+			err = io.EOF
+		case st.reset:
+			err = ErrStreamReset
+		case st.s.isClosed():
+			err = st.s.err
+		}
+		if err != nil {
+			st.m.Unlock()
+			return 0, err
+		}
+		deadline := st.readDeadline
+		st.m.Unlock()
+		if err := st.wait(st.readNotify, deadline); err != nil {
+			return 0, err
+		}
+		st.m.Lock()
+	}
+	n := copy(b, st.buf)
+	st.buf = st.buf[n:]
+	st.unacked += uint32(n)
+	var credit uint32
+	if st.unacked >= st.s.cfg.ReceiveWindow/2 && !st.readClosed {
+		credit = st.unacked
+		st.unacked = 0
+	}
+	st.m.Unlock()
+	if credit != 0 {
+		st.s.writeFrame(frameWindow, st.id, credit, nil)
+	}
+	return n, nil
+}
+
+// Write writes data to the peer, waiting while the peer's receive window for the
+// stream is full. The write deadline only applies to this wait.
+func (st *Stream) Write(b []byte) (int, error) {
+	st.writeLock.Lock()
+	defer st.writeLock.Unlock()
+	n := 0
+	for len(b) > 0 {
+		st.m.Lock()
+		for st.sendWindow == 0 || st.closed || st.writeClosed || st.reset {
+			var err error
+			switch {
+			case st.closed || st.writeClosed:
+				err = ErrStreamClosed
+			case st.reset:
+				err = ErrStreamReset
+			case st.s.isClosed():
+				err = st.s.err
+			}
+			if err != nil {
+				st.m.Unlock()
+				return n, err
+			}
+			deadline := st.writeDeadline
+			st.m.Unlock()
+			if err := st.wait(st.writeNotify, deadline); err != nil {
+				return n, err
+			}
+			st.m.Lock()
+		}
+		chunk := len(b)
+		if chunk > maxFramePayload {
+			chunk = maxFramePayload
+		}
+		if uint32(chunk) > st.sendWindow {
+			chunk = int(st.sendWindow)
+		}
+		st.sendWindow -= uint32(chunk)
+		st.m.Unlock()
+		if err := st.s.writeFrame(frameData, st.id, uint32(chunk), b[:chunk]); err != nil {
+			return n, err
+		}
+		n += chunk
+		b = b[chunk:]
+	}
+	return n, nil
+}
+
+// CloseWrite tells the peer that no more data will be written, so that its reads
+// return io.EOF once it has read the data already written. The stream can still be
+// read.
+func (st *Stream) CloseWrite() error {
+	st.writeLock.Lock()
+	defer st.writeLock.Unlock()
+	st.m.Lock()
+	send := !st.writeClosed && !st.reset
+	st.writeClosed = true
+	done := st.readClosed || st.reset
+	st.m.Unlock()
+	notify(st.writeNotify)
+	var err error
+	if send {
+		err = st.s.writeFrame(frameClose, st.id, 0, nil)
+	}
+	if done {
+		st.s.remove(st.id)
+	}
+	return err
+}
+
+// Close closes the stream. Data that has not yet been read is discarded, and data
+// that the peer writes afterwards is discarded as it arrives.
+func (st *Stream) Close() error {
+	st.m.Lock()
+	if st.closed {
+		st.m.Unlock()
+		return nil
+	}
+	st.closed = true
+	var credit uint32
+	if !st.readClosed {
+		credit = uint32(len(st.buf)) + st.unacked
+	}
+	st.buf = nil
+	st.unacked = 0
+	st.m.Unlock()
+	notify(st.readNotify)
+	// Wake any write that is waiting for window so that it fails rather than
+	// holding writeLock.
+	notify(st.writeNotify)
+	err := st.CloseWrite()
+	if credit != 0 {
+		st.s.writeFrame(frameWindow, st.id, credit, nil)
+	}
+	return err
+}
+
+// LocalAddr returns the local address of the session's connection.
+func (st *Stream) LocalAddr() net.Addr {
+	return st.s.conn.LocalAddr()
+}
+
+// RemoteAddr returns the remote address of the session's connection.
+func (st *Stream) RemoteAddr() net.Addr {
+	return st.s.conn.RemoteAddr()
+}
+
+func (st *Stream) SetDeadline(t time.Time) error {
+	st.SetReadDeadline(t)
+	return st.SetWriteDeadline(t)
+}
+
+func (st *Stream) SetReadDeadline(t time.Time) error {
+	st.m.Lock()
+	st.readDeadline = t
+	st.m.Unlock()
+	notify(st.readNotify)
+	return nil
+}
+
+func (st *Stream) SetWriteDeadline(t time.Time) error {
+	st.m.Lock()
+	st.writeDeadline = t
+	st.m.Unlock()
+	notify(st.writeNotify)
+	return nil
+}
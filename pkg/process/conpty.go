@@ -0,0 +1,194 @@
+package process
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	winio "github.com/Microsoft/go-winio"
+)
+
+//sys createPseudoConsole(size uint32, input syscall.Handle, output syscall.Handle, flags uint32, console *syscall.Handle) (hr error) = CreatePseudoConsole
+//sys resizePseudoConsole(console syscall.Handle, size uint32) (hr error) = ResizePseudoConsole
+//sys closePseudoConsole(console syscall.Handle) = ClosePseudoConsole
+
+// Coord is the size of a pseudo console, in character cells.
+type Coord struct {
+	X, Y int16
+}
+
+func (c Coord) pack() uint32 {
+	return uint32(uint16(c.X)) | uint32(uint16(c.Y))<<16
+}
+
+// File is an asynchronous file with deadlines, as returned by winio.MakeOpenFile.
+type File interface {
+	io.ReadWriteCloser
+	SetReadDeadline(t time.Time) error
+	SetWriteDeadline(t time.Time) error
+}
+
+// CreatePseudoConsole creates a pseudo console of the given size that reads its input
+// from input and writes its output to output. The handles are duplicated and may be
+// closed once the console's processes have been started. It fails on versions of
+// Windows before Windows 10 1809.
+func CreatePseudoConsole(size Coord, input, output syscall.Handle, flags uint32) (syscall.Handle, error) {
+	if err := procCreatePseudoConsole.Find(); err != nil {
+		return 0, err
+	}
+	var h syscall.Handle
+	if err := createPseudoConsole(size.pack(), input, output, flags, &h); err != nil {
+		return 0, os.NewSyscallError("CreatePseudoConsole", err)
+	}
+	return h, nil
+}
+
+// ResizePseudoConsole changes the size of the pseudo console h.
+func ResizePseudoConsole(h syscall.Handle, size Coord) error {
+	if err := resizePseudoConsole(h, size.pack()); err != nil {
+		return os.NewSyscallError("ResizePseudoConsole", err)
+	}
+	return nil
+}
+
+// ClosePseudoConsole closes the pseudo console h, terminating any processes still
+// attached to it. It waits for the console to write its final output, so the output
+// must continue to be read until it returns.
+func ClosePseudoConsole(h syscall.Handle) {
+	closePseudoConsole(h)
+}
+
+var pipeCount uint32
+
+// asyncPipe returns the two ends of a new pipe. The server end is a connection
+// accepted by winio.ListenPipe; the client end, which is handed to the pseudo
+// console, is synchronous. If inbound is set, the client end is opened for writing,
+// and otherwise for reading.
+func asyncPipe(inbound bool) (File, syscall.Handle, error) {
+	name := fmt.Sprintf(`\\.\pipe\winio-conpty-%d-%d-%d`, os.Getpid(), atomic.AddUint32(&pipeCount, 1), time.Now().UnixNano())
+	l, err := winio.ListenPipe(name, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer l.Close()
+
+	type response struct {
+		c   net.Conn
+		err error
+	}
+	ch := make(chan response, 1)
+	go func() {
+		c, err := l.Accept()
+		ch <- response{c, err}
+	}()
+
+	access := uint32(syscall.GENERIC_READ)
+	if inbound {
+		access = syscall.GENERIC_WRITE
+	}
+	p, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		l.Close()
+		<-ch
+		return nil, 0, err
+	}
+	var client syscall.Handle
+	for {
+		client, err = syscall.CreateFile(p, access, 0, nil, syscall.OPEN_EXISTING, 0, 0)
+		if err != winio.ErrPipeBusy {
+			break
+		}
+		// The listener has not yet created an instance for Accept to wait on, or
+		// another client took it.
+		select {
+		case r := <-ch:
+			if r.c != nil {
+				r.c.Close()
+				r.err = &os.PathError{Op: "open", Path: name, Err: err}
+			}
+			return nil, 0, r.err
+		case <-time.After(time.Millisecond):
+		}
+	}
+	if err != nil {
+		l.Close()
+		if r := <-ch; r.c != nil {
+			r.c.Close()
+		}
+		return nil, 0, &os.PathError{Op: "open", Path: name, Err: err}
+	}
+	r := <-ch
+	if r.err != nil {
+		syscall.CloseHandle(client)
+		return nil, 0, r.err
+	}
+	return r.c, client, nil
+}
+
+// PseudoConsole is a pseudo console (ConPTY) connected to a pair of pipes. Terminal
+// emulators write the user's input to Input and render what is read from Output,
+// which is encoded as UTF-8 with VT sequences.
+type PseudoConsole struct {
+	Input  File
+	Output File
+
+	handle syscall.Handle
+	once   sync.Once
+}
+
+// NewPseudoConsole creates a pseudo console of the given size.
+func NewPseudoConsole(size Coord) (*PseudoConsole, error) {
+	in, inClient, err := asyncPipe(false)
+	if err != nil {
+		return nil, err
+	}
+	defer syscall.CloseHandle(inClient)
+	out, outClient, err := asyncPipe(true)
+	if err != nil {
+		in.Close()
+		return nil, err
+	}
+	defer syscall.CloseHandle(outClient)
+	h, err := CreatePseudoConsole(size, inClient, outClient, 0)
+	if err != nil {
+		in.Close()
+		out.Close()
+		return nil, err
+	}
+	return &PseudoConsole{Input: in, Output: out, handle: h}, nil
+}
+
+// Handle returns the pseudo console handle, which remains owned by c.
+func (c *PseudoConsole) Handle() syscall.Handle {
+	return c.handle
+}
+
+// Resize changes the size of the console.
+func (c *PseudoConsole) Resize(size Coord) error {
+	return ResizePseudoConsole(c.handle, size)
+}
+
+// Start starts a process attached to the console, running commandLine in the
+// directory dir with the environment env. If dir is empty, the process starts in the
+// current directory, and if env is nil, it inherits the current environment. Use the
+// package's Start function with StartOptions.PseudoConsole for more control.
+func (c *PseudoConsole) Start(commandLine string, dir string, env []string) (*Process, error) {
+	return Start(commandLine, &StartOptions{Dir: dir, Env: env, PseudoConsole: c})
+}
+
+// Close closes the console, terminating any processes attached to it, and then its
+// pipes. The console writes its final output as it closes, so Output must be read
+// until Close returns.
+func (c *PseudoConsole) Close() error {
+	c.once.Do(func() {
+		ClosePseudoConsole(c.handle)
+		c.Input.Close()
+		c.Output.Close()
+	})
+	return nil
+}
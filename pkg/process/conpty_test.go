@@ -0,0 +1,50 @@
+package process
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPseudoConsole(t *testing.T) {
+	if procCreatePseudoConsole.Find() != nil {
+		t.Skip("pseudo consoles are not supported")
+	}
+	c, err := NewPseudoConsole(Coord{X: 80, Y: 25})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Drain the output so that the console does not block closing.
+	output := make(chan []byte)
+	go func() {
+		var out []byte
+		b := make([]byte, 4096)
+		for {
+			n, err := c.Output.Read(b)
+			out = append(out, b[:n]...)
+			if err != nil {
+				break
+			}
+		}
+		output <- out
+	}()
+	if err := c.Resize(Coord{X: 100, Y: 30}); err != nil {
+		t.Fatal(err)
+	}
+	p, err := c.Start(`cmd.exe /c echo hello from conpty`, "", nil)
+	if err != nil {
+		c.Close()
+		t.Fatal(err)
+	}
+	defer p.Close()
+	code, err := p.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != 0 {
+		t.Fatalf("exit code %d", code)
+	}
+	c.Close()
+	if out := <-output; !bytes.Contains(out, []byte("hello from conpty")) {
+		t.Fatalf("unexpected output %q", out)
+	}
+}
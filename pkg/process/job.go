@@ -0,0 +1,370 @@
+package process
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"sync"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+//sys createJobObject(sa *syscall.SecurityAttributes, name *uint16) (h syscall.Handle, err error) = CreateJobObjectW
+//sys assignProcessToJobObject(job syscall.Handle, process syscall.Handle) (err error) = AssignProcessToJobObject
+//sys terminateJobObject(job syscall.Handle, exitCode uint32) (err error) = TerminateJobObject
+//sys setInformationJobObject(job syscall.Handle, class uint32, info unsafe.Pointer, length uint32) (err error) = SetInformationJobObject
+//sys queryInformationJobObject(job syscall.Handle, class uint32, info unsafe.Pointer, length uint32, returnLength *uint32) (err error) = QueryInformationJobObject
+//sys getQueuedCompletionStatus(port syscall.Handle, bytes *uint32, key *uintptr, o *uintptr, timeout uint32) (err error) = GetQueuedCompletionStatus
+
+const (
+	cJobObjectBasicProcessIdList          = 3
+	cJobObjectAssociateCompletionPortInfo = 7
+	cJobObjectExtendedLimitInformation    = 9
+	cJobObjectCpuRateControlInformation   = 15
+	cJOB_OBJECT_CPU_RATE_CONTROL_ENABLE   = 0x1
+	cJOB_OBJECT_CPU_RATE_CONTROL_HARD_CAP = 0x4
+	cERROR_MORE_DATA                      = syscall.Errno(234)
+	jobNotificationQueueSize              = 16
+)
+
+var errJobClosed = errors.New("job object has been closed")
+
+// JobMessage identifies the kind of a JobNotification.
+type JobMessage uint32
+
+// Job notification messages, from JOB_OBJECT_MSG_*.
+const (
+	JobEndOfJobTime        JobMessage = 1
+	JobEndOfProcessTime    JobMessage = 2
+	JobActiveProcessLimit  JobMessage = 3
+	JobActiveProcessZero   JobMessage = 4
+	JobNewProcess          JobMessage = 6
+	JobExitProcess         JobMessage = 7
+	JobAbnormalExitProcess JobMessage = 8
+	JobProcessMemoryLimit  JobMessage = 9
+	JobMemoryLimit         JobMessage = 10
+)
+
+var jobMessageNames = map[JobMessage]string{
+	JobEndOfJobTime:        "end of job time",
+	JobEndOfProcessTime:    "end of process time",
+	JobActiveProcessLimit:  "active process limit",
+	JobActiveProcessZero:   "active process zero",
+	JobNewProcess:          "new process",
+	JobExitProcess:         "exit process",
+	JobAbnormalExitProcess: "abnormal exit process",
+	JobProcessMemoryLimit:  "process memory limit",
+	JobMemoryLimit:         "job memory limit",
+}
+
+func (m JobMessage) String() string {
+	if s, ok := jobMessageNames[m]; ok {
+		return s
+	}
+	return "message " + strconv.Itoa(int(m))
+}
+
+// JobNotification is a message posted by the system about a job. Pid identifies the
+// process the message is about, and is zero for messages about the job as a whole.
+type JobNotification struct {
+	Message JobMessage
+	Pid     int
+}
+
+// JobLimits are the limits placed on the processes in a job. Zero values impose no
+// limit.
+type JobLimits struct {
+	// CPURate caps the CPU time used by the job, in hundredths of a percent of all
+	// processors, from 1 to 10000.
+	CPURate uint32
+	// JobMemory and ProcessMemory limit the committed memory, in bytes, of the job
+	// and of each of its processes.
+	JobMemory     uint64
+	ProcessMemory uint64
+	// ActiveProcesses limits the number of processes in the job.
+	ActiveProcesses uint32
+	// KillOnClose terminates the processes in the job when its last handle is
+	// closed.
+	KillOnClose bool
+}
+
+type jobAssociateCompletionPort struct {
+	CompletionKey  uintptr
+	CompletionPort syscall.Handle
+}
+
+type jobCPURateControl struct {
+	ControlFlags uint32
+	Value        uint32
+}
+
+// Job is a Windows job object, which groups processes so that they can be limited
+// and terminated together.
+type Job struct {
+	handleLock sync.RWMutex
+	handle     syscall.Handle
+	key        uintptr
+
+	m      sync.Mutex
+	queue  []JobNotification
+	wake   chan struct{}
+	notify chan JobNotification
+	closed chan struct{}
+	once   sync.Once
+}
+
+// The notifications of all jobs are posted to one completion port and dispatched by
+// key. This cannot be the port that go-winio uses for overlapped IO: its processor
+// takes the OVERLAPPED pointer of every completion to be an IO operation, but job
+// notifications carry a process ID in its place. For the same reason, the pointer is
+// received here as a uintptr rather than as a *windows.Overlapped.
+var (
+	jobPortOnce sync.Once
+	jobPort     syscall.Handle
+	jobPortErr  error
+	jobsMu      sync.Mutex
+	jobs        = make(map[uintptr]*Job)
+	nextJobKey  uintptr
+)
+
+func initJobPort() {
+	var h windows.Handle
+	h, jobPortErr = windows.CreateIoCompletionPort(windows.InvalidHandle, 0, 0, 0xffffffff)
+	jobPort = syscall.Handle(h)
+	if jobPortErr == nil {
+		go jobNotificationProcessor(jobPort)
+	}
+}
+
+// jobNotificationProcessor dispatches job notifications forever.
+func jobNotificationProcessor(port syscall.Handle) {
+	for {
+		var (
+			msg uint32
+			key uintptr
+			pid uintptr
+		)
+		if getQueuedCompletionStatus(port, &msg, &key, &pid, syscall.INFINITE) != nil {
+			continue
+		}
+		jobsMu.Lock()
+		j := jobs[key]
+		jobsMu.Unlock()
+		if j != nil {
+			j.post(JobNotification{Message: JobMessage(msg), Pid: int(pid)})
+		}
+	}
+}
+
+// NewJob creates an unnamed job object with the given limits, which may be nil.
+func NewJob(limits *JobLimits) (*Job, error) {
+	jobPortOnce.Do(initJobPort)
+	if jobPortErr != nil {
+		return nil, jobPortErr
+	}
+	h, err := createJobObject(nil, nil)
+	if err != nil {
+		return nil, os.NewSyscallError("CreateJobObject", err)
+	}
+	j := &Job{
+		handle: h,
+		wake:   make(chan struct{}, 1),
+		notify: make(chan JobNotification, jobNotificationQueueSize),
+		closed: make(chan struct{}),
+	}
+	jobsMu.Lock()
+	nextJobKey++
+	j.key = nextJobKey
+	jobs[j.key] = j
+	jobsMu.Unlock()
+	go j.forward()
+
+	info := jobAssociateCompletionPort{CompletionKey: j.key, CompletionPort: jobPort}
+	if err := setInformationJobObject(h, cJobObjectAssociateCompletionPortInfo, unsafe.Pointer(&info), uint32(unsafe.Sizeof(info))); err != nil {
+		j.Close()
+		return nil, os.NewSyscallError("SetInformationJobObject", err)
+	}
+	if limits != nil {
+		if err := j.SetLimits(limits); err != nil {
+			j.Close()
+			return nil, err
+		}
+	}
+	return j, nil
+}
+
+// post queues a notification. Notifications are queued without limit so that the
+// processor never blocks on a job whose notifications are not being read.
+func (j *Job) post(n JobNotification) {
+	j.m.Lock()
+	j.queue = append(j.queue, n)
+	j.m.Unlock()
+	select {
+	case j.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (j *Job) forward() {
+	defer close(j.notify)
+	for {
+		select {
+		case <-j.wake:
+		case <-j.closed:
+			return
+		}
+		for {
+			j.m.Lock()
+			if len(j.queue) == 0 {
+				j.m.Unlock()
+				break
+			}
+			n := j.queue[0]
+			j.queue = j.queue[1:]
+			j.m.Unlock()
+			select {
+			case j.notify <- n:
+			case <-j.closed:
+				return
+			}
+		}
+	}
+}
+
+// Notifications returns a channel that receives the job's notifications, such as
+// processes exiting or limits being exceeded. The channel is closed when the job is
+// closed.
+func (j *Job) Notifications() <-chan JobNotification {
+	return j.notify
+}
+
+// Handle returns the job object handle, which remains owned by j.
+func (j *Job) Handle() syscall.Handle {
+	j.handleLock.RLock()
+	defer j.handleLock.RUnlock()
+	return j.handle
+}
+
+// SetLimits replaces the limits of the job.
+func (j *Job) SetLimits(limits *JobLimits) error {
+	j.handleLock.RLock()
+	defer j.handleLock.RUnlock()
+	if j.handle == 0 {
+		return errJobClosed
+	}
+	var info windows.JOBOBJECT_EXTENDED_LIMIT_INFORMATION
+	basic := &info.BasicLimitInformation
+	if limits.KillOnClose {
+		basic.LimitFlags |= windows.JOB_OBJECT_LIMIT_KILL_ON_JOB_CLOSE
+	}
+	if limits.ActiveProcesses != 0 {
+		basic.LimitFlags |= windows.JOB_OBJECT_LIMIT_ACTIVE_PROCESS
+		basic.ActiveProcessLimit = limits.ActiveProcesses
+	}
+	if limits.JobMemory != 0 {
+		basic.LimitFlags |= windows.JOB_OBJECT_LIMIT_JOB_MEMORY
+		info.JobMemoryLimit = uintptr(limits.JobMemory)
+	}
+	if limits.ProcessMemory != 0 {
+		basic.LimitFlags |= windows.JOB_OBJECT_LIMIT_PROCESS_MEMORY
+		info.ProcessMemoryLimit = uintptr(limits.ProcessMemory)
+	}
+	if err := setInformationJobObject(j.handle, cJobObjectExtendedLimitInformation, unsafe.Pointer(&info), uint32(unsafe.Sizeof(info))); err != nil {
+		return os.NewSyscallError("SetInformationJobObject", err)
+	}
+	var rate jobCPURateControl
+	if limits.CPURate != 0 {
+		rate = jobCPURateControl{ControlFlags: cJOB_OBJECT_CPU_RATE_CONTROL_ENABLE | cJOB_OBJECT_CPU_RATE_CONTROL_HARD_CAP, Value: limits.CPURate}
+	}
+	if err := setInformationJobObject(j.handle, cJobObjectCpuRateControlInformation, unsafe.Pointer(&rate), uint32(unsafe.Sizeof(rate))); err != nil {
+		// Clearing a CPU rate that was never set fails on some versions of Windows.
+		if limits.CPURate != 0 {
+			return os.NewSyscallError("SetInformationJobObject", err)
+		}
+	}
+	return nil
+}
+
+// Assign adds the process p to the job. Processes that p creates later are added to
+// the job as well.
+func (j *Job) Assign(p *Process) error {
+	if p.handle == 0 {
+		return &ProcessError{Op: "assign", Pid: p.pid, Err: errProcessClosed}
+	}
+	return j.AssignHandle(p.handle)
+}
+
+// AssignHandle adds the process with handle h to the job.
+func (j *Job) AssignHandle(h syscall.Handle) error {
+	j.handleLock.RLock()
+	defer j.handleLock.RUnlock()
+	if j.handle == 0 {
+		return errJobClosed
+	}
+	if err := assignProcessToJobObject(j.handle, h); err != nil {
+		return os.NewSyscallError("AssignProcessToJobObject", err)
+	}
+	return nil
+}
+
+// Pids returns the IDs of the processes in the job.
+func (j *Job) Pids() ([]int, error) {
+	j.handleLock.RLock()
+	defer j.handleLock.RUnlock()
+	if j.handle == 0 {
+		return nil, errJobClosed
+	}
+	// JOBOBJECT_BASIC_PROCESS_ID_LIST is two 32-bit counts followed by an array of
+	// IDs, each the size of a pointer.
+	const idOffset = 8 / unsafe.Sizeof(uintptr(0))
+	n := 64
+	for {
+		buf := make([]uintptr, idOffset+uintptr(n))
+		err := queryInformationJobObject(j.handle, cJobObjectBasicProcessIdList, unsafe.Pointer(&buf[0]), uint32(len(buf))*uint32(unsafe.Sizeof(buf[0])), nil)
+		counts := (*[2]uint32)(unsafe.Pointer(&buf[0]))
+		if err == cERROR_MORE_DATA || (err == nil && counts[1] < counts[0]) {
+			n = int(counts[0]) + 16
+			continue
+		}
+		if err != nil {
+			return nil, os.NewSyscallError("QueryInformationJobObject", err)
+		}
+		pids := make([]int, counts[1])
+		for i := range pids {
+			pids[i] = int(buf[idOffset+uintptr(i)])
+		}
+		return pids, nil
+	}
+}
+
+// Terminate terminates all the processes in the job with the given exit code.
+func (j *Job) Terminate(exitCode uint32) error {
+	j.handleLock.RLock()
+	defer j.handleLock.RUnlock()
+	if j.handle == 0 {
+		return errJobClosed
+	}
+	if err := terminateJobObject(j.handle, exitCode); err != nil {
+		return os.NewSyscallError("TerminateJobObject", err)
+	}
+	return nil
+}
+
+// Close closes the job object handle, which terminates the job's processes if its
+// limits include KillOnClose, and closes the notification channel.
+func (j *Job) Close() error {
+	var err error
+	j.once.Do(func() {
+		jobsMu.Lock()
+		delete(jobs, j.key)
+		jobsMu.Unlock()
+		close(j.closed)
+		j.handleLock.Lock()
+		err = syscall.CloseHandle(j.handle)
+		j.handle = 0
+		j.handleLock.Unlock()
+	})
+	return err
+}
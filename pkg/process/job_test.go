@@ -0,0 +1,84 @@
+package process
+
+import (
+	"os/exec"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func waitForMessage(t *testing.T, j *Job, msg JobMessage) JobNotification {
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case n, ok := <-j.Notifications():
+			if !ok {
+				t.Fatal("notification channel closed")
+			}
+			if n.Message == msg {
+				return n
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for %s", msg)
+		}
+	}
+}
+
+func TestJob(t *testing.T) {
+	j, err := NewJob(&JobLimits{KillOnClose: true, ActiveProcesses: 4, JobMemory: 1 << 30})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+
+	cmd := exec.Command("ping", "-n", "60", "127.0.0.1")
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	h, err := syscall.OpenProcess(syscall.PROCESS_TERMINATE|0x100 /* PROCESS_SET_QUOTA */, false, uint32(cmd.Process.Pid))
+	if err != nil {
+		cmd.Process.Kill()
+		t.Fatal(err)
+	}
+	defer syscall.CloseHandle(h)
+	if err := j.AssignHandle(h); err != nil {
+		cmd.Process.Kill()
+		t.Fatal(err)
+	}
+	if n := waitForMessage(t, j, JobNewProcess); n.Pid != cmd.Process.Pid {
+		t.Fatalf("new process %d, expected %d", n.Pid, cmd.Process.Pid)
+	}
+	pids, err := j.Pids()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pids) != 1 || pids[0] != cmd.Process.Pid {
+		t.Fatalf("unexpected pids %v", pids)
+	}
+
+	if err := j.Terminate(3); err != nil {
+		t.Fatal(err)
+	}
+	waitForMessage(t, j, JobActiveProcessZero)
+	cmd.Wait()
+	if code := cmd.ProcessState.Sys().(syscall.WaitStatus).ExitStatus(); code != 3 {
+		t.Fatalf("exit code %d", code)
+	}
+
+	j.Close()
+	// The channel is closed, possibly after any notifications still queued.
+	for range j.Notifications() {
+	}
+	if err := j.Terminate(0); err == nil {
+		t.Fatal("expected error using closed job")
+	}
+}
+
+func TestJobMessageString(t *testing.T) {
+	if s := JobExitProcess.String(); s != "exit process" {
+		t.Fatal(s)
+	}
+	if s := JobMessage(99).String(); s != "message 99" {
+		t.Fatal(s)
+	}
+}
@@ -0,0 +1,397 @@
+// Package process starts and controls Windows processes in ways that os/exec does
+// not support, such as attaching them to a pseudo console or grouping them in job
+// objects.
+package process
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"sync"
+	"syscall"
+	"unicode/utf16"
+	"unsafe"
+)
+
+//sys initializeProcThreadAttributeList(list *byte, count uint32, flags uint32, size *uintptr) (err error) = InitializeProcThreadAttributeList
+//sys updateProcThreadAttribute(list *byte, flags uint32, attr uintptr, value uintptr, size uintptr, prev uintptr, returnedSize *uintptr) (err error) = UpdateProcThreadAttribute
+//sys deleteProcThreadAttributeList(list *byte) = DeleteProcThreadAttributeList
+//sys resumeThread(thread syscall.Handle) (n uint32, err error) [failretval==0xffffffff] = ResumeThread
+//sys createProcess(appName *uint16, commandLine *uint16, procSecurity *syscall.SecurityAttributes, threadSecurity *syscall.SecurityAttributes, inheritHandles bool, creationFlags uint32, env *uint16, currentDir *uint16, startupInfo *startupInfoEx, outProcInfo *syscall.ProcessInformation) (err error) = CreateProcessW
+
+const (
+	cCREATE_SUSPENDED             = 0x4
+	cCREATE_UNICODE_ENVIRONMENT   = 0x400
+	cEXTENDED_STARTUPINFO_PRESENT = 0x80000
+	cSTARTF_USESTDHANDLES         = 0x100
+
+	procThreadAttributeParentProcess    = 0x20000
+	procThreadAttributeHandleList       = 0x20002
+	procThreadAttributeMitigationPolicy = 0x20007
+	procThreadAttributePseudoConsole    = 0x20016
+)
+
+var errProcessClosed = errors.New("process handle has been closed")
+
+type startupInfoEx struct {
+	syscall.StartupInfo
+	attributeList *byte
+}
+
+// attributeList is a PROC_THREAD_ATTRIBUTE_LIST. The values of its attributes must
+// stay alive until the process has been created, so it keeps references to them.
+type attributeList struct {
+	buf    []byte
+	values []interface{}
+}
+
+func newAttributeList(count int) (*attributeList, error) {
+	var size uintptr
+	err := initializeProcThreadAttributeList(nil, uint32(count), 0, &size)
+	if err != syscall.ERROR_INSUFFICIENT_BUFFER {
+		if err == nil {
+			err = syscall.EINVAL
+		}
+		return nil, err
+	}
+	l := &attributeList{buf: make([]byte, size)}
+	if err := initializeProcThreadAttributeList(&l.buf[0], uint32(count), 0, &size); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// update sets the attribute attr to value, which is either a pointer to size bytes or,
+// for attributes such as the pseudo console, the value itself. ref keeps the memory
+// value points to alive.
+func (l *attributeList) update(attr uintptr, value uintptr, size uintptr, ref interface{}) error {
+	if ref != nil {
+		l.values = append(l.values, ref)
+	}
+	return updateProcThreadAttribute(&l.buf[0], 0, attr, value, size, 0, nil)
+}
+
+func (l *attributeList) delete() {
+	if l.buf != nil {
+		deleteProcThreadAttributeList(&l.buf[0])
+		l.buf = nil
+	}
+}
+
+// environmentBlock returns env as a block of NUL-terminated UTF-16 strings, or nil to
+// inherit the environment of the current process.
+func environmentBlock(env []string) *uint16 {
+	if env == nil {
+		return nil
+	}
+	var b []uint16
+	for _, s := range env {
+		b = append(b, utf16.Encode([]rune(s))...)
+		b = append(b, 0)
+	}
+	if len(env) == 0 {
+		b = append(b, 0)
+	}
+	b = append(b, 0)
+	return &b[0]
+}
+
+// StartOptions controls how Start creates a process. The zero value starts the
+// process in the current directory with the current environment, inheriting no
+// handles.
+type StartOptions struct {
+	// Dir is the working directory of the process.
+	Dir string
+	// Env is the environment of the process, as KEY=value strings. If it is nil, the
+	// process inherits the environment of the current process.
+	Env []string
+	// Stdin, Stdout, and Stderr are the standard handles of the process, or zero to
+	// leave them unset.
+	Stdin, Stdout, Stderr syscall.Handle
+	// InheritHandles lists additional handles for the process to inherit. Only the
+	// handles listed here and the standard handles are inherited; they need not be
+	// inheritable, since the process inherits duplicates of them.
+	InheritHandles []syscall.Handle
+	// Parent, if nonzero, is a handle to the process to be made the parent of the
+	// new process, opened with PROCESS_CREATE_PROCESS and PROCESS_DUP_HANDLE access.
+	// The new process inherits its handles and attributes from Parent rather than
+	// from the current process.
+	Parent syscall.Handle
+	// MitigationPolicy and MitigationPolicy2 are PROCESS_CREATION_MITIGATION_POLICY_*
+	// and PROCESS_CREATION_MITIGATION_POLICY2_* flags to apply to the process.
+	MitigationPolicy  uint64
+	MitigationPolicy2 uint64
+	// PseudoConsole attaches the process to a pseudo console. The standard handles
+	// must not be set.
+	PseudoConsole *PseudoConsole
+	// Job, if set, is the job object the process is assigned to before it runs.
+	Job *Job
+	// CreationFlags are additional CREATE_* flags.
+	CreationFlags uint32
+}
+
+// handleDuplicator makes inheritable duplicates of handles in the process that is to
+// be the parent of a new process, and closes them once it has been created. It holds
+// syscall.ForkLock until then, so that the duplicates are not inherited by processes
+// started concurrently, for example by os/exec.
+type handleDuplicator struct {
+	target  syscall.Handle
+	remote  bool
+	handles map[syscall.Handle]syscall.Handle
+	list    []syscall.Handle
+	closed  bool
+}
+
+func newHandleDuplicator(parent syscall.Handle) *handleDuplicator {
+	syscall.ForkLock.Lock()
+	d := &handleDuplicator{target: currentProcess, handles: make(map[syscall.Handle]syscall.Handle)}
+	if parent != 0 {
+		d.target = parent
+		d.remote = true
+	}
+	return d
+}
+
+func (d *handleDuplicator) dup(h syscall.Handle) (syscall.Handle, error) {
+	if dh, ok := d.handles[h]; ok {
+		return dh, nil
+	}
+	var dh syscall.Handle
+	if err := syscall.DuplicateHandle(currentProcess, h, d.target, &dh, 0, true, syscall.DUPLICATE_SAME_ACCESS); err != nil {
+		return 0, os.NewSyscallError("DuplicateHandle", err)
+	}
+	d.handles[h] = dh
+	d.list = append(d.list, dh)
+	return dh, nil
+}
+
+func (d *handleDuplicator) close() {
+	if d.closed {
+		return
+	}
+	d.closed = true
+	defer syscall.ForkLock.Unlock()
+	for _, h := range d.list {
+		if d.remote {
+			syscall.DuplicateHandle(d.target, h, 0, nil, 0, false, syscall.DUPLICATE_CLOSE_SOURCE)
+		} else {
+			syscall.CloseHandle(h)
+		}
+	}
+}
+
+var currentProcess, _ = syscall.GetCurrentProcess()
+
+// Start starts a process running commandLine, which is parsed by the process itself
+// (see syscall.EscapeArg), as controlled by opts, which may be nil. The process
+// inherits only the handles named in opts.
+func Start(commandLine string, opts *StartOptions) (*Process, error) {
+	var o StartOptions
+	if opts != nil {
+		o = *opts
+	}
+	cmd, err := syscall.UTF16PtrFromString(commandLine)
+	if err != nil {
+		return nil, err
+	}
+	var cwd *uint16
+	if o.Dir != "" {
+		cwd, err = syscall.UTF16PtrFromString(o.Dir)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var si startupInfoEx
+	si.Cb = uint32(unsafe.Sizeof(si))
+	d := newHandleDuplicator(o.Parent)
+	defer d.close()
+	if o.PseudoConsole != nil {
+		if o.Stdin != 0 || o.Stdout != 0 || o.Stderr != 0 {
+			return nil, &ProcessError{Op: "start", Err: errors.New("standard handles cannot be used with a pseudo console")}
+		}
+		// Without STARTF_USESTDHANDLES, the process would use the standard handles
+		// of its parent rather than those of the console when they are not console
+		// handles.
+		si.Flags |= cSTARTF_USESTDHANDLES
+	}
+	for _, std := range []struct {
+		h   syscall.Handle
+		out *syscall.Handle
+	}{{o.Stdin, &si.StdInput}, {o.Stdout, &si.StdOutput}, {o.Stderr, &si.StdErr}} {
+		if std.h != 0 {
+			if *std.out, err = d.dup(std.h); err != nil {
+				return nil, err
+			}
+			si.Flags |= cSTARTF_USESTDHANDLES
+		}
+	}
+	for _, h := range o.InheritHandles {
+		if _, err := d.dup(h); err != nil {
+			return nil, err
+		}
+	}
+
+	n := 0
+	for _, set := range []bool{len(d.list) != 0, o.Parent != 0, o.MitigationPolicy != 0 || o.MitigationPolicy2 != 0, o.PseudoConsole != nil} {
+		if set {
+			n++
+		}
+	}
+	flags := o.CreationFlags | cCREATE_UNICODE_ENVIRONMENT
+	if n != 0 {
+		attrs, err := newAttributeList(n)
+		if err != nil {
+			return nil, os.NewSyscallError("InitializeProcThreadAttributeList", err)
+		}
+		defer attrs.delete()
+		if err := o.setAttributes(attrs, d.list); err != nil {
+			return nil, os.NewSyscallError("UpdateProcThreadAttribute", err)
+		}
+		si.attributeList = &attrs.buf[0]
+		flags |= cEXTENDED_STARTUPINFO_PRESENT
+	}
+	if o.Job != nil {
+		flags |= cCREATE_SUSPENDED
+	}
+
+	var pi syscall.ProcessInformation
+	err = createProcess(nil, cmd, nil, nil, len(d.list) != 0, flags, environmentBlock(o.Env), cwd, &si, &pi)
+	d.close()
+	if err != nil {
+		return nil, &ProcessError{Op: "start", Err: err}
+	}
+	defer syscall.CloseHandle(pi.Thread)
+	p := &Process{handle: pi.Process, pid: int(pi.ProcessId)}
+	if o.Job != nil {
+		if err := o.Job.Assign(p); err != nil {
+			p.Kill()
+			p.Close()
+			return nil, err
+		}
+		if o.CreationFlags&cCREATE_SUSPENDED == 0 {
+			if _, err := resumeThread(pi.Thread); err != nil {
+				p.Kill()
+				p.Close()
+				return nil, &ProcessError{Op: "start", Pid: p.pid, Err: err}
+			}
+		}
+	}
+	return p, nil
+}
+
+func (o *StartOptions) setAttributes(attrs *attributeList, handles []syscall.Handle) error {
+	if len(handles) != 0 {
+		if err := attrs.update(procThreadAttributeHandleList, uintptr(unsafe.Pointer(&handles[0])), uintptr(len(handles))*unsafe.Sizeof(handles[0]), handles); err != nil {
+			return err
+		}
+	}
+	if o.Parent != 0 {
+		parent := new(syscall.Handle)
+		*parent = o.Parent
+		if err := attrs.update(procThreadAttributeParentProcess, uintptr(unsafe.Pointer(parent)), unsafe.Sizeof(*parent), parent); err != nil {
+			return err
+		}
+	}
+	if o.MitigationPolicy != 0 || o.MitigationPolicy2 != 0 {
+		policy := &[2]uint64{o.MitigationPolicy, o.MitigationPolicy2}
+		size := uintptr(8)
+		if o.MitigationPolicy2 != 0 {
+			size = 16
+		}
+		if err := attrs.update(procThreadAttributeMitigationPolicy, uintptr(unsafe.Pointer(policy)), size, policy); err != nil {
+			return err
+		}
+	}
+	if o.PseudoConsole != nil {
+		// The attribute's value is the console handle itself.
+		h := o.PseudoConsole.handle
+		if err := attrs.update(procThreadAttributePseudoConsole, uintptr(h), unsafe.Sizeof(h), nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ProcessError describes a failed operation on a process.
+type ProcessError struct {
+	Op  string
+	Pid int
+	Err error
+}
+
+func (e *ProcessError) Error() string {
+	s := "process " + e.Op
+	if e.Pid != 0 {
+		s += " " + strconv.Itoa(e.Pid)
+	}
+	return s + ": " + e.Err.Error()
+}
+
+// Process is a process started or opened by this package. It holds a handle to the
+// process, so its ID is not reused until Close is called.
+type Process struct {
+	handle syscall.Handle
+	pid    int
+
+	m       sync.Mutex
+	exited  chan struct{}
+	wait    syscall.Handle
+	waitKey uintptr
+}
+
+// Pid returns the process ID.
+func (p *Process) Pid() int {
+	return p.pid
+}
+
+// Handle returns the process handle, which remains owned by p.
+func (p *Process) Handle() syscall.Handle {
+	return p.handle
+}
+
+// Wait waits for the process to exit and returns its exit code.
+func (p *Process) Wait() (uint32, error) {
+	if p.handle == 0 {
+		return 0, &ProcessError{Op: "wait", Pid: p.pid, Err: errProcessClosed}
+	}
+	if _, err := syscall.WaitForSingleObject(p.handle, syscall.INFINITE); err != nil {
+		return 0, &ProcessError{Op: "wait", Pid: p.pid, Err: err}
+	}
+	return p.ExitCode()
+}
+
+// ExitCode returns the exit code of the process, which is STILL_ACTIVE (259) if it
+// has not exited.
+func (p *Process) ExitCode() (uint32, error) {
+	var code uint32
+	if p.handle == 0 {
+		return 0, &ProcessError{Op: "query", Pid: p.pid, Err: errProcessClosed}
+	}
+	if err := syscall.GetExitCodeProcess(p.handle, &code); err != nil {
+		return 0, &ProcessError{Op: "query", Pid: p.pid, Err: err}
+	}
+	return code, nil
+}
+
+// Kill terminates the process with exit code 1.
+func (p *Process) Kill() error {
+	if p.handle == 0 {
+		return &ProcessError{Op: "kill", Pid: p.pid, Err: errProcessClosed}
+	}
+	if err := syscall.TerminateProcess(p.handle, 1); err != nil {
+		return &ProcessError{Op: "kill", Pid: p.pid, Err: err}
+	}
+	return nil
+}
+
+// Close releases the process handle. It does not terminate the process.
+func (p *Process) Close() error {
+	if p.handle == 0 {
+		return nil
+	}
+	p.unregisterExitWait()
+	err := syscall.CloseHandle(p.handle)
+	p.handle = 0
+	return err
+}
@@ -0,0 +1,114 @@
+package process
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"unsafe"
+)
+
+func blockStrings(p *uint16) []string {
+	var s []string
+	for {
+		var b []uint16
+		for ; *p != 0; p = (*uint16)(unsafe.Pointer(uintptr(unsafe.Pointer(p)) + 2)) {
+			b = append(b, *p)
+		}
+		if len(b) == 0 {
+			return s
+		}
+		s = append(s, syscall.UTF16ToString(b))
+		p = (*uint16)(unsafe.Pointer(uintptr(unsafe.Pointer(p)) + 2))
+	}
+}
+
+func TestEnvironmentBlock(t *testing.T) {
+	if environmentBlock(nil) != nil {
+		t.Fatal("expected nil block to inherit the environment")
+	}
+	if s := blockStrings(environmentBlock([]string{})); len(s) != 0 {
+		t.Fatalf("unexpected strings %q", s)
+	}
+	env := []string{"A=1", "PATH=C:\\Windows", "Ü=ü"}
+	s := blockStrings(environmentBlock(env))
+	if len(s) != len(env) {
+		t.Fatalf("got %q", s)
+	}
+	for i := range s {
+		if s[i] != env[i] {
+			t.Fatalf("got %q", s)
+		}
+	}
+}
+
+func TestProcessError(t *testing.T) {
+	err := &ProcessError{Op: "kill", Pid: 42, Err: errors.New("denied")}
+	if err.Error() != "process kill 42: denied" {
+		t.Fatalf("unexpected message %q", err.Error())
+	}
+	p := &Process{pid: 7}
+	if _, err := p.Wait(); err == nil {
+		t.Fatal("expected error waiting on closed process")
+	}
+}
+
+func testStartOutput(t *testing.T, opts *StartOptions) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	opts.Stdout = syscall.Handle(w.Fd())
+	p, err := Start(`cmd.exe /c echo %GREETING%`, opts)
+	// The process holds its own duplicate of the write end.
+	w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	out, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(string(out)) != "hello" {
+		t.Fatalf("unexpected output %q", out)
+	}
+	if code, err := p.Wait(); err != nil || code != 0 {
+		t.Fatalf("exit code %d: %v", code, err)
+	}
+}
+
+func TestStart(t *testing.T) {
+	env := append(os.Environ(), "GREETING=hello")
+	testStartOutput(t, &StartOptions{Env: env})
+
+	const access = 0x80 | 0x40 // PROCESS_CREATE_PROCESS | PROCESS_DUP_HANDLE
+	parent, err := syscall.OpenProcess(access, false, uint32(os.Getpid()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer syscall.CloseHandle(parent)
+	testStartOutput(t, &StartOptions{Env: env, Parent: parent})
+}
+
+func TestStartInJob(t *testing.T) {
+	j, err := NewJob(&JobLimits{KillOnClose: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	p, err := Start(`cmd.exe /c exit 5`, &StartOptions{Job: j})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	if n := waitForMessage(t, j, JobNewProcess); n.Pid != p.Pid() {
+		t.Fatalf("new process %d, expected %d", n.Pid, p.Pid())
+	}
+	if code, err := p.Wait(); err != nil || code != 5 {
+		t.Fatalf("exit code %d: %v", code, err)
+	}
+}
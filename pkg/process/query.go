@@ -0,0 +1,203 @@
+package process
+
+import (
+	"sync"
+	"syscall"
+	"unicode/utf16"
+	"unsafe"
+
+	winio "github.com/Microsoft/go-winio"
+)
+
+//sys queryFullProcessImageName(process syscall.Handle, flags uint32, name *uint16, size *uint32) (err error) = QueryFullProcessImageNameW
+//sys ntQueryInformationProcess(process syscall.Handle, class uint32, info unsafe.Pointer, length uint32, returnLength *uint32) (status winio.NTStatus) = ntdll.NtQueryInformationProcess
+//sys registerWaitForSingleObject(wait *syscall.Handle, object syscall.Handle, callback uintptr, context uintptr, timeout uint32, flags uint32) (err error) = RegisterWaitForSingleObject
+//sys unregisterWaitEx(wait syscall.Handle, completionEvent syscall.Handle) (err error) = UnregisterWaitEx
+
+const (
+	cPROCESS_QUERY_LIMITED_INFORMATION = 0x1000
+	cSYNCHRONIZE                       = 0x100000
+	cWT_EXECUTEONLYONCE                = 0x8
+
+	cProcessCommandLineInformation = 60
+
+	cSTATUS_INFO_LENGTH_MISMATCH = winio.NTStatus(-0x3ffffffc) // 0xC0000004
+)
+
+type unicodeString struct {
+	Length        uint16
+	MaximumLength uint16
+	Buffer        uintptr
+}
+
+// ProcessEntry describes a process running on the system when Processes was called.
+type ProcessEntry struct {
+	Pid       int
+	ParentPid int
+	Threads   int
+	// Name is the file name of the process's executable, without its directory.
+	Name string
+}
+
+// Processes returns the processes running on the system. The list is a snapshot: the
+// processes in it may exit, and their IDs be reused, at any time.
+func Processes() ([]ProcessEntry, error) {
+	snap, err := syscall.CreateToolhelp32Snapshot(syscall.TH32CS_SNAPPROCESS, 0)
+	if err != nil {
+		return nil, &ProcessError{Op: "list", Err: err}
+	}
+	defer syscall.CloseHandle(snap)
+	var (
+		pe      syscall.ProcessEntry32
+		entries []ProcessEntry
+	)
+	pe.Size = uint32(unsafe.Sizeof(pe))
+	err = syscall.Process32First(snap, &pe)
+	for err == nil {
+		entries = append(entries, ProcessEntry{
+			Pid:       int(pe.ProcessID),
+			ParentPid: int(pe.ParentProcessID),
+			Threads:   int(pe.Threads),
+			Name:      syscall.UTF16ToString(pe.ExeFile[:]),
+		})
+		err = syscall.Process32Next(snap, &pe)
+	}
+	if err != syscall.ERROR_NO_MORE_FILES {
+		return nil, &ProcessError{Op: "list", Err: err}
+	}
+	return entries, nil
+}
+
+// Open opens the running process with ID pid, such as the client of a named pipe, with
+// enough access to query it and wait for it to exit. The returned process cannot be
+// killed unless it is opened with OpenAccess and PROCESS_TERMINATE access.
+func Open(pid int) (*Process, error) {
+	return OpenAccess(pid, cPROCESS_QUERY_LIMITED_INFORMATION|cSYNCHRONIZE)
+}
+
+// OpenAccess opens the running process with ID pid with the PROCESS_* access rights
+// in access.
+func OpenAccess(pid int, access uint32) (*Process, error) {
+	h, err := syscall.OpenProcess(access, false, uint32(pid))
+	if err != nil {
+		return nil, &ProcessError{Op: "open", Pid: pid, Err: err}
+	}
+	return &Process{handle: h, pid: pid}, nil
+}
+
+// ImagePath returns the full Win32 path of the process's executable.
+func (p *Process) ImagePath() (string, error) {
+	if p.handle == 0 {
+		return "", &ProcessError{Op: "query", Pid: p.pid, Err: errProcessClosed}
+	}
+	b := make([]uint16, syscall.MAX_PATH)
+	for {
+		n := uint32(len(b))
+		err := queryFullProcessImageName(p.handle, 0, &b[0], &n)
+		if err == nil {
+			return syscall.UTF16ToString(b[:n]), nil
+		}
+		if err != syscall.ERROR_INSUFFICIENT_BUFFER || len(b) >= 0x8000 {
+			return "", &ProcessError{Op: "query", Pid: p.pid, Err: err}
+		}
+		b = make([]uint16, len(b)*4)
+	}
+}
+
+// CommandLine returns the command line the process was started with. Since the process
+// can change its own copy of its command line, this should be treated as a hint rather
+// than proof of what the process runs. It requires Windows 8.1 or later.
+func (p *Process) CommandLine() (string, error) {
+	if p.handle == 0 {
+		return "", &ProcessError{Op: "query", Pid: p.pid, Err: errProcessClosed}
+	}
+	b := make([]byte, 512)
+	for {
+		var n uint32
+		status := ntQueryInformationProcess(p.handle, cProcessCommandLineInformation, unsafe.Pointer(&b[0]), uint32(len(b)), &n)
+		if status == cSTATUS_INFO_LENGTH_MISMATCH && n > uint32(len(b)) {
+			b = make([]byte, n)
+			continue
+		}
+		if err := status.Err(); err != nil {
+			return "", &ProcessError{Op: "query", Pid: p.pid, Err: err}
+		}
+		// The buffer holds a UNICODE_STRING followed by the string it points to.
+		us := (*unicodeString)(unsafe.Pointer(&b[0]))
+		off := us.Buffer - uintptr(unsafe.Pointer(&b[0]))
+		s := make([]uint16, us.Length/2)
+		for i := range s {
+			s[i] = uint16(b[off+uintptr(i)*2]) | uint16(b[off+uintptr(i)*2+1])<<8
+		}
+		return string(utf16.Decode(s)), nil
+	}
+}
+
+// Exit waits are registered with the system thread pool, which calls exitCallback
+// when a process exits. Its context is a key into exitWaits rather than a pointer,
+// since the system cannot hold Go pointers.
+var (
+	exitCallbackOnce sync.Once
+	exitCallback     uintptr
+	exitWaitsLock    sync.Mutex
+	exitWaits        = make(map[uintptr]chan struct{})
+	nextExitWaitKey  uintptr
+)
+
+func processExited(key uintptr, timedOut uintptr) uintptr {
+	exitWaitsLock.Lock()
+	c := exitWaits[key]
+	delete(exitWaits, key)
+	exitWaitsLock.Unlock()
+	if c != nil {
+		close(c)
+	}
+	return 0
+}
+
+// Exited returns a channel that is closed when the process exits. Unlike Wait, it
+// does not tie up a goroutine or thread per process, which suits servers that track
+// many clients. If p is closed before the process exits, the channel is never closed.
+func (p *Process) Exited() (<-chan struct{}, error) {
+	p.m.Lock()
+	defer p.m.Unlock()
+	if p.exited != nil {
+		return p.exited, nil
+	}
+	if p.handle == 0 {
+		return nil, &ProcessError{Op: "wait", Pid: p.pid, Err: errProcessClosed}
+	}
+	exitCallbackOnce.Do(func() {
+		exitCallback = syscall.NewCallback(processExited)
+	})
+	c := make(chan struct{})
+	exitWaitsLock.Lock()
+	nextExitWaitKey++
+	key := nextExitWaitKey
+	exitWaits[key] = c
+	exitWaitsLock.Unlock()
+	var wait syscall.Handle
+	if err := registerWaitForSingleObject(&wait, p.handle, exitCallback, key, syscall.INFINITE, cWT_EXECUTEONLYONCE); err != nil {
+		exitWaitsLock.Lock()
+		delete(exitWaits, key)
+		exitWaitsLock.Unlock()
+		return nil, &ProcessError{Op: "wait", Pid: p.pid, Err: err}
+	}
+	p.exited, p.wait, p.waitKey = c, wait, key
+	return c, nil
+}
+
+func (p *Process) unregisterExitWait() {
+	p.m.Lock()
+	defer p.m.Unlock()
+	if p.wait == 0 {
+		return
+	}
+	// Passing INVALID_HANDLE_VALUE waits for a running callback to return, so none can
+	// run once the process handle has been closed.
+	unregisterWaitEx(p.wait, syscall.InvalidHandle)
+	exitWaitsLock.Lock()
+	delete(exitWaits, p.waitKey)
+	exitWaitsLock.Unlock()
+	p.wait = 0
+}
@@ -0,0 +1,105 @@
+package process
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProcesses(t *testing.T) {
+	entries, err := Processes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if e.Pid == os.Getpid() {
+			if e.ParentPid != os.Getppid() {
+				t.Errorf("parent %d, expected %d", e.ParentPid, os.Getppid())
+			}
+			if !strings.HasSuffix(strings.ToLower(os.Args[0]), strings.ToLower(e.Name)) {
+				t.Errorf("name %s does not match %s", e.Name, os.Args[0])
+			}
+			return
+		}
+	}
+	t.Fatalf("current process %d not listed", os.Getpid())
+}
+
+func TestOpenQuery(t *testing.T) {
+	p, err := Start(`cmd.exe /c ping -n 30 127.0.0.1 >nul`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	defer p.Kill()
+
+	q, err := Open(p.Pid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	path, err := q.ImagePath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.EqualFold(path[len(path)-len(`\cmd.exe`):], `\cmd.exe`) {
+		t.Errorf("unexpected image path %s", path)
+	}
+	cmdline, err := q.CommandLine()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cmdline != `cmd.exe /c ping -n 30 127.0.0.1 >nul` {
+		t.Errorf("unexpected command line %q", cmdline)
+	}
+	if err := q.Kill(); err == nil {
+		t.Error("expected kill to fail without terminate access")
+	}
+
+	exited, err := q.Exited()
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-exited:
+		t.Fatal("process exited early")
+	case <-time.After(100 * time.Millisecond):
+	}
+	if err := p.Kill(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-exited:
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for exit")
+	}
+	if code, err := q.ExitCode(); err != nil || code != 1 {
+		t.Fatalf("exit code %d: %v", code, err)
+	}
+}
+
+func TestExitedAfterClose(t *testing.T) {
+	p, err := Start(`cmd.exe /c ping -n 30 127.0.0.1 >nul`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const access = 0x1 | cSYNCHRONIZE // PROCESS_TERMINATE
+	q, err := OpenAccess(p.Pid(), access)
+	if err != nil {
+		p.Kill()
+		t.Fatal(err)
+	}
+	defer q.Close()
+	defer q.Kill()
+	if _, err := p.Exited(); err != nil {
+		t.Fatal(err)
+	}
+	// Close must unregister the wait before releasing the handle.
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.ImagePath(); err == nil {
+		t.Fatal("expected query of closed process to fail")
+	}
+}
@@ -0,0 +1,3 @@
+package process
+
+//go:generate go run $GOROOT/src/syscall/mksyscall_windows.go -output zsyscall.go conpty.go job.go process.go query.go
@@ -0,0 +1,133 @@
+package security
+
+import (
+	"encoding/binary"
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/windows"
+)
+
+//sys accessCheck(sd *byte, token windows.Token, desired uint32, mapping *GenericMapping, privileges *byte, privilegesLength *uint32, granted *uint32, status *uint32) (err error) = advapi32.AccessCheck
+//sys duplicateTokenEx(existing windows.Token, access uint32, sa *syscall.SecurityAttributes, level uint32, tokenType uint32, token *windows.Token) (err error) = advapi32.DuplicateTokenEx
+//sys openThreadToken(thread syscall.Handle, access uint32, openAsSelf bool, token *windows.Token) (err error) = advapi32.OpenThreadToken
+//sys getCurrentThread() (h syscall.Handle) = GetCurrentThread
+
+const (
+	cERROR_NO_TOKEN = syscall.Errno(1008)
+
+	cTOKEN_DUPLICATE = 0x2
+	cTOKEN_QUERY     = 0x8
+
+	tokenTypeClass      = 8
+	cTokenImpersonation = 2
+
+	cSecurityIdentification = 1
+)
+
+// GenericMapping maps the generic access rights to the specific rights of a type of
+// object.
+type GenericMapping struct {
+	GenericRead    AccessMask
+	GenericWrite   AccessMask
+	GenericExecute AccessMask
+	GenericAll     AccessMask
+}
+
+// FileGenericMapping is the generic mapping for files and directories.
+var FileGenericMapping = GenericMapping{
+	GenericRead:    FileGenericRead,
+	GenericWrite:   FileGenericWrite,
+	GenericExecute: FileGenericExecute,
+	GenericAll:     FileAllAccess,
+}
+
+// Map replaces the generic rights in mask with the specific rights they map to.
+func (m *GenericMapping) Map(mask AccessMask) AccessMask {
+	for _, g := range []struct{ generic, specific AccessMask }{
+		{GenericRead, m.GenericRead},
+		{GenericWrite, m.GenericWrite},
+		{GenericExecute, m.GenericExecute},
+		{GenericAll, m.GenericAll},
+	} {
+		if mask&g.generic != 0 {
+			mask = mask&^g.generic | g.specific
+		}
+	}
+	return mask
+}
+
+// impersonationToken returns an impersonation token for token, or for the effective
+// token of the calling thread if token is 0. The returned token must be closed if
+// it is not token.
+func impersonationToken(token windows.Token) (windows.Token, error) {
+	if token == 0 {
+		err := openThreadToken(getCurrentThread(), cTOKEN_QUERY|cTOKEN_DUPLICATE, true, &token)
+		if err == cERROR_NO_TOKEN {
+			err = windows.OpenProcessToken(windows.CurrentProcess(), cTOKEN_QUERY|cTOKEN_DUPLICATE, &token)
+		}
+		if err != nil {
+			return 0, err
+		}
+		defer token.Close()
+	} else {
+		b, err := getTokenInfo(token, tokenTypeClass)
+		if err != nil {
+			return 0, err
+		}
+		if binary.LittleEndian.Uint32(b) == cTokenImpersonation {
+			return token, nil
+		}
+	}
+	var dup windows.Token
+	err := duplicateTokenEx(token, cTOKEN_QUERY, nil, cSecurityIdentification, cTokenImpersonation, &dup)
+	if err != nil {
+		return 0, err
+	}
+	return dup, nil
+}
+
+// AccessCheck determines whether the security descriptor sd grants desired access to
+// token, or to the effective token of the calling thread if token is 0, in the same way
+// that the system does when the object it protects is opened. token must have been
+// opened with TOKEN_QUERY access, and with TOKEN_DUPLICATE access if it is a primary
+// token.
+//
+// sd must have an owner and a group. Generic rights in desired are mapped with mapping,
+// which may be nil if desired includes none; the generic rights of ACEs in sd then
+// grant nothing. desired may include MaximumAllowed, in which case granted is the maximum access
+// that token is granted. If access is denied, ok is false and err is nil.
+func AccessCheck(sd *SecurityDescriptor, token windows.Token, desired AccessMask, mapping *GenericMapping) (granted AccessMask, ok bool, err error) {
+	if mapping == nil {
+		if desired&(GenericRead|GenericWrite|GenericExecute|GenericAll) != 0 {
+			return 0, false, &os.SyscallError{Syscall: "AccessCheck", Err: windows.ERROR_GENERIC_NOT_MAPPED}
+		}
+		mapping = &GenericMapping{}
+	}
+	b, err := sd.Bytes()
+	if err != nil {
+		return 0, false, err
+	}
+	t, err := impersonationToken(token)
+	if err != nil {
+		return 0, false, &os.SyscallError{Syscall: "AccessCheck", Err: err}
+	}
+	if t != token {
+		defer t.Close()
+	}
+	desired = mapping.Map(desired)
+	privileges := make([]byte, 256)
+	for {
+		n := uint32(len(privileges))
+		var g, status uint32
+		err = accessCheck(&b[0], t, uint32(desired), mapping, &privileges[0], &n, &g, &status)
+		if err == syscall.ERROR_INSUFFICIENT_BUFFER && int(n) > len(privileges) {
+			privileges = make([]byte, n)
+			continue
+		}
+		if err != nil {
+			return 0, false, &os.SyscallError{Syscall: "AccessCheck", Err: err}
+		}
+		return AccessMask(g), status != 0, nil
+	}
+}
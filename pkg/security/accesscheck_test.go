@@ -0,0 +1,50 @@
+package security
+
+import (
+	"errors"
+	"testing"
+
+	"golang.org/x/sys/windows"
+)
+
+func TestAccessCheck(t *testing.T) {
+	// The owner is a SID that the caller is not, since owners have implicit rights.
+	for _, test := range []struct {
+		sddl    string
+		desired AccessMask
+		granted AccessMask
+		ok      bool
+	}{
+		{"O:S-1-5-21-1-2-3-500G:S-1-5-21-1-2-3-513D:(A;;FR;;;WD)", FileGenericRead, FileGenericRead, true},
+		{"O:S-1-5-21-1-2-3-500G:S-1-5-21-1-2-3-513D:(A;;FR;;;WD)", GenericRead, FileGenericRead, true},
+		{"O:S-1-5-21-1-2-3-500G:S-1-5-21-1-2-3-513D:(A;;FR;;;WD)", MaximumAllowed, FileGenericRead, true},
+		{"O:S-1-5-21-1-2-3-500G:S-1-5-21-1-2-3-513D:(A;;FR;;;WD)", FileGenericWrite, 0, false},
+		{"O:S-1-5-21-1-2-3-500G:S-1-5-21-1-2-3-513D:(D;;FA;;;WD)(A;;FA;;;WD)", FileGenericRead, 0, false},
+	} {
+		sd, err := ParseSDDL(test.sddl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		granted, ok, err := AccessCheck(sd, 0, test.desired, &FileGenericMapping)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != test.ok || ok && granted != test.granted {
+			t.Errorf("%s %#x: got %#x %v, expected %#x %v", test.sddl, test.desired, granted, ok, test.granted, test.ok)
+		}
+	}
+}
+
+func TestAccessCheckNilMapping(t *testing.T) {
+	sd, err := ParseSDDL("O:S-1-5-21-1-2-3-500G:S-1-5-21-1-2-3-513D:(A;;FR;;;WD)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	granted, ok, err := AccessCheck(sd, 0, FileGenericRead, nil)
+	if err != nil || !ok || granted != FileGenericRead {
+		t.Fatalf("got %#x %v %v", granted, ok, err)
+	}
+	if _, _, err := AccessCheck(sd, 0, GenericRead, nil); !errors.Is(err, windows.ERROR_GENERIC_NOT_MAPPED) {
+		t.Fatalf("expected ERROR_GENERIC_NOT_MAPPED, got %v", err)
+	}
+}
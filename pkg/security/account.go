@@ -0,0 +1,157 @@
+package security
+
+import (
+	"syscall"
+)
+
+//sys lookupAccountName(systemName *uint16, accountName string, sid *byte, sidSize *uint32, refDomain *uint16, refDomainSize *uint32, sidNameUse *uint32) (err error) = advapi32.LookupAccountNameW
+//sys lookupAccountSid(systemName *uint16, sid *byte, name *uint16, nameSize *uint32, refDomain *uint16, refDomainSize *uint32, sidNameUse *uint32) (err error) = advapi32.LookupAccountSidW
+
+const cERROR_NONE_MAPPED = syscall.Errno(1332)
+
+// SidNameUse is the type of account a SID refers to.
+type SidNameUse uint32
+
+// Account types.
+const (
+	SidTypeUser           SidNameUse = 1
+	SidTypeGroup          SidNameUse = 2
+	SidTypeDomain         SidNameUse = 3
+	SidTypeAlias          SidNameUse = 4
+	SidTypeWellKnownGroup SidNameUse = 5
+	SidTypeDeletedAccount SidNameUse = 6
+	SidTypeInvalid        SidNameUse = 7
+	SidTypeUnknown        SidNameUse = 8
+	SidTypeComputer       SidNameUse = 9
+	SidTypeLabel          SidNameUse = 10
+	SidTypeLogonSession   SidNameUse = 11
+)
+
+// AccountLookupError is returned when an account name or SID cannot be looked up.
+type AccountLookupError struct {
+	Name string
+	Err  error
+}
+
+func (e *AccountLookupError) Error() string {
+	if e.Name == "" {
+		return "lookup account: empty account name specified"
+	}
+	var s string
+	switch e.Err {
+	case cERROR_NONE_MAPPED:
+		s = "not found"
+	default:
+		s = e.Err.Error()
+	}
+	return "lookup account " + e.Name + ": " + s
+}
+
+// LookupAccountName returns the SID of the account name, which may be qualified with a
+// domain, such as DOMAIN\user, and the name of the domain in which it was found.
+func LookupAccountName(name string) (sid *SID, domain string, use SidNameUse, err error) {
+	if name == "" {
+		return nil, "", 0, &AccountLookupError{name, cERROR_NONE_MAPPED}
+	}
+	var (
+		sidSize, domainSize = uint32(sidHeaderSize + 4*maxSubAuthorities), uint32(64)
+		u                   uint32
+	)
+	for {
+		b := make([]byte, sidSize)
+		d := make([]uint16, domainSize)
+		err = lookupAccountName(nil, name, &b[0], &sidSize, &d[0], &domainSize, &u)
+		if err == syscall.ERROR_INSUFFICIENT_BUFFER {
+			continue
+		}
+		if err != nil {
+			return nil, "", 0, &AccountLookupError{name, err}
+		}
+		sid, err = SidFromBytes(b)
+		if err != nil {
+			return nil, "", 0, &AccountLookupError{name, err}
+		}
+		return sid, syscall.UTF16ToString(d), SidNameUse(u), nil
+	}
+}
+
+// LookupAccountSid returns the name of the account sid refers to and the name of the
+// domain in which it was found.
+func LookupAccountSid(sid *SID) (name string, domain string, use SidNameUse, err error) {
+	b := sid.Bytes()
+	var (
+		nameSize, domainSize = uint32(64), uint32(64)
+		u                    uint32
+	)
+	for {
+		n := make([]uint16, nameSize)
+		d := make([]uint16, domainSize)
+		err = lookupAccountSid(nil, &b[0], &n[0], &nameSize, &d[0], &domainSize, &u)
+		if err == syscall.ERROR_INSUFFICIENT_BUFFER {
+			continue
+		}
+		if err != nil {
+			return "", "", 0, &AccountLookupError{sid.String(), err}
+		}
+		return syscall.UTF16ToString(n), syscall.UTF16ToString(d), SidNameUse(u), nil
+	}
+}
+
+// WellKnownSID identifies a SID that has the same value on all systems.
+type WellKnownSID int
+
+// Well-known SIDs.
+const (
+	// Everyone is S-1-1-0.
+	Everyone WellKnownSID = iota
+	// CreatorOwner is S-1-3-0, which is replaced by the owner of an object in inherited
+	// ACEs.
+	CreatorOwner
+	// AuthenticatedUsers is S-1-5-11.
+	AuthenticatedUsers
+	// LocalSystem is S-1-5-18.
+	LocalSystem
+	// LocalService is S-1-5-19.
+	LocalService
+	// NetworkService is S-1-5-20.
+	NetworkService
+	// Administrators is the BUILTIN\Administrators group, S-1-5-32-544.
+	Administrators
+	// Users is the BUILTIN\Users group, S-1-5-32-545.
+	Users
+	// VirtualMachines is the NT VIRTUAL MACHINE\Virtual Machines group, S-1-5-83-0.
+	VirtualMachines
+	// AllApplicationPackages is S-1-15-2-1, which matches all app containers.
+	AllApplicationPackages
+	// AllRestrictedApplicationPackages is S-1-15-2-2, which matches all app containers,
+	// including those that do not match AllApplicationPackages.
+	AllRestrictedApplicationPackages
+)
+
+var wellKnownSids = []struct {
+	authority uint64
+	subs      []uint32
+}{
+	Everyone:                         {1, []uint32{0}},
+	CreatorOwner:                     {3, []uint32{0}},
+	AuthenticatedUsers:               {5, []uint32{11}},
+	LocalSystem:                      {5, []uint32{18}},
+	LocalService:                     {5, []uint32{19}},
+	NetworkService:                   {5, []uint32{20}},
+	Administrators:                   {5, []uint32{32, 544}},
+	Users:                            {5, []uint32{32, 545}},
+	VirtualMachines:                  {5, []uint32{83, 0}},
+	AllApplicationPackages:           {15, []uint32{2, 1}},
+	AllRestrictedApplicationPackages: {15, []uint32{2, 2}},
+}
+
+// SID returns a new copy of the well-known SID.
+func (w WellKnownSID) SID() *SID {
+	s := wellKnownSids[w]
+	return &SID{IdentifierAuthority: s.authority, SubAuthorities: append([]uint32(nil), s.subs...)}
+}
+
+// String returns the well-known SID in string form.
+func (w WellKnownSID) String() string {
+	return w.SID().String()
+}
@@ -0,0 +1,58 @@
+package security
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/sys/windows"
+)
+
+func TestWellKnownSIDs(t *testing.T) {
+	if s := Administrators.String(); s != "S-1-5-32-544" {
+		t.Fatalf("unexpected SID %s", s)
+	}
+	if s := AllApplicationPackages.String(); s != "S-1-15-2-1" {
+		t.Fatalf("unexpected SID %s", s)
+	}
+	sid := Everyone.SID()
+	sid.SubAuthorities[0] = 1
+	if s := Everyone.String(); s != "S-1-1-0" {
+		t.Fatalf("well-known SID was modified: %s", s)
+	}
+}
+
+func TestLookupAccount(t *testing.T) {
+	name, domain, use, err := LookupAccountSid(Administrators.SID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if use != SidTypeAlias || name == "" || domain == "" {
+		t.Fatalf("unexpected account %s\\%s (%d)", domain, name, use)
+	}
+	sid, _, use, err := LookupAccountName(domain + `\` + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sid.Equal(Administrators.SID()) || use != SidTypeAlias {
+		t.Fatalf("unexpected SID %s (%d)", sid, use)
+	}
+	_, _, _, err = LookupAccountName("no such account 1b3f57d2")
+	if aerr, ok := err.(*AccountLookupError); !ok || aerr.Err != cERROR_NONE_MAPPED {
+		t.Fatalf("expected not found error, got %v", err)
+	}
+}
+
+func TestLogonSID(t *testing.T) {
+	token, err := windows.OpenCurrentProcessToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer token.Close()
+	sid, err := LogonSID(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(sid.String(), "S-1-5-5-") {
+		t.Fatalf("unexpected logon SID %s", sid)
+	}
+}
@@ -0,0 +1,371 @@
+package security
+
+import (
+	"encoding/binary"
+	"errors"
+	"sort"
+)
+
+// AceType is the type of an ACE.
+type AceType uint8
+
+// ACE types.
+const (
+	AccessAllowedACE               AceType = 0x0
+	AccessDeniedACE                AceType = 0x1
+	SystemAuditACE                 AceType = 0x2
+	SystemAlarmACE                 AceType = 0x3
+	AccessAllowedCompoundACE       AceType = 0x4
+	AccessAllowedObjectACE         AceType = 0x5
+	AccessDeniedObjectACE          AceType = 0x6
+	SystemAuditObjectACE           AceType = 0x7
+	SystemAlarmObjectACE           AceType = 0x8
+	AccessAllowedCallbackACE       AceType = 0x9
+	AccessDeniedCallbackACE        AceType = 0xa
+	AccessAllowedCallbackObjectACE AceType = 0xb
+	AccessDeniedCallbackObjectACE  AceType = 0xc
+	SystemAuditCallbackACE         AceType = 0xd
+	SystemAlarmCallbackACE         AceType = 0xe
+	SystemAuditCallbackObjectACE   AceType = 0xf
+	SystemAlarmCallbackObjectACE   AceType = 0x10
+	SystemMandatoryLabelACE        AceType = 0x11
+	SystemResourceAttributeACE     AceType = 0x12
+	SystemScopedPolicyIDACE        AceType = 0x13
+	SystemProcessTrustLabelACE     AceType = 0x14
+	SystemAccessFilterACE          AceType = 0x15
+)
+
+// IsObject reports whether ACEs of type t have the object type fields of ACE.
+func (t AceType) IsObject() bool {
+	switch t {
+	case AccessAllowedObjectACE, AccessDeniedObjectACE, SystemAuditObjectACE, SystemAlarmObjectACE,
+		AccessAllowedCallbackObjectACE, AccessDeniedCallbackObjectACE, SystemAuditCallbackObjectACE, SystemAlarmCallbackObjectACE:
+		return true
+	}
+	return false
+}
+
+func (t AceType) isAllow() bool {
+	return t == AccessAllowedACE || t == AccessAllowedCompoundACE || t == AccessAllowedObjectACE || t == AccessAllowedCallbackACE || t == AccessAllowedCallbackObjectACE
+}
+
+func (t AceType) isDeny() bool {
+	return t == AccessDeniedACE || t == AccessDeniedObjectACE || t == AccessDeniedCallbackACE || t == AccessDeniedCallbackObjectACE
+}
+
+// AceFlags controls the inheritance and auditing of an ACE.
+type AceFlags uint8
+
+// ACE flags.
+const (
+	ObjectInheritACE      AceFlags = 0x1
+	ContainerInheritACE   AceFlags = 0x2
+	NoPropagateInheritACE AceFlags = 0x4
+	InheritOnlyACE        AceFlags = 0x8
+	InheritedACE          AceFlags = 0x10
+	SuccessfulAccessACE   AceFlags = 0x40
+	FailedAccessACE       AceFlags = 0x80
+)
+
+const (
+	objectTypePresent          = 0x1
+	inheritedObjectTypePresent = 0x2
+
+	aceHeaderSize = 4
+	aclHeaderSize = 8
+	aclRevision   = 2
+	aclRevisionDS = 4
+	maxACLSize    = 0xffff
+)
+
+// AccessMask is a set of access rights.
+type AccessMask uint32
+
+// Standard and generic access rights, and the rights for files and directories.
+const (
+	Delete               AccessMask = 0x10000
+	ReadControl          AccessMask = 0x20000
+	WriteDAC             AccessMask = 0x40000
+	WriteOwner           AccessMask = 0x80000
+	Synchronize          AccessMask = 0x100000
+	AccessSystemSecurity AccessMask = 0x1000000
+	MaximumAllowed       AccessMask = 0x2000000
+	GenericAll           AccessMask = 0x10000000
+	GenericExecute       AccessMask = 0x20000000
+	GenericWrite         AccessMask = 0x40000000
+	GenericRead          AccessMask = 0x80000000
+
+	FileAllAccess      AccessMask = 0x1f01ff
+	FileGenericRead    AccessMask = 0x120089
+	FileGenericWrite   AccessMask = 0x120116
+	FileGenericExecute AccessMask = 0x1200a0
+)
+
+var errInvalidACL = errors.New("invalid ACL")
+
+// ACE is an access control entry.
+type ACE struct {
+	Type  AceType
+	Flags AceFlags
+	Mask  AccessMask
+
+	// ObjectType and InheritedObjectType are the GUIDs of object ACEs, in their binary
+	// form. ObjectFlags indicates which of them are present.
+	ObjectFlags         uint32
+	ObjectType          [16]byte
+	InheritedObjectType [16]byte
+
+	// SID is the trustee of the ACE. It is nil for compound ACEs, whose contents are
+	// kept in ApplicationData.
+	SID *SID
+
+	// ApplicationData holds the data that follows the SID, such as the condition of a
+	// callback ACE or the attribute of a resource attribute ACE.
+	ApplicationData []byte
+}
+
+// AllowACE returns an ACE that grants mask to sid.
+func AllowACE(sid *SID, mask AccessMask, flags AceFlags) ACE {
+	return ACE{Type: AccessAllowedACE, Flags: flags, Mask: mask, SID: sid}
+}
+
+// DenyACE returns an ACE that denies mask to sid.
+func DenyACE(sid *SID, mask AccessMask, flags AceFlags) ACE {
+	return ACE{Type: AccessDeniedACE, Flags: flags, Mask: mask, SID: sid}
+}
+
+func (ace *ACE) len() int {
+	n := aceHeaderSize + 4
+	if ace.Type.IsObject() {
+		n += 4
+		if ace.ObjectFlags&objectTypePresent != 0 {
+			n += 16
+		}
+		if ace.ObjectFlags&inheritedObjectTypePresent != 0 {
+			n += 16
+		}
+	}
+	if ace.SID != nil {
+		n += ace.SID.Len()
+	}
+	n += len(ace.ApplicationData)
+	return (n + 3) &^ 3
+}
+
+func decodeACE(b []byte) (ACE, int, error) {
+	if len(b) < aceHeaderSize+4 {
+		return ACE{}, 0, errInvalidACL
+	}
+	size := int(binary.LittleEndian.Uint16(b[2:4]))
+	if size < aceHeaderSize+4 || size > len(b) {
+		return ACE{}, 0, errInvalidACL
+	}
+	ace := ACE{
+		Type:  AceType(b[0]),
+		Flags: AceFlags(b[1]),
+		Mask:  AccessMask(binary.LittleEndian.Uint32(b[4:8])),
+	}
+	body := b[8:size]
+	if ace.Type == AccessAllowedCompoundACE {
+		ace.ApplicationData = append([]byte(nil), body...)
+		return ace, size, nil
+	}
+	if ace.Type.IsObject() {
+		if len(body) < 4 {
+			return ACE{}, 0, errInvalidACL
+		}
+		ace.ObjectFlags = binary.LittleEndian.Uint32(body)
+		body = body[4:]
+		for _, f := range []struct {
+			flag uint32
+			guid *[16]byte
+		}{{objectTypePresent, &ace.ObjectType}, {inheritedObjectTypePresent, &ace.InheritedObjectType}} {
+			if ace.ObjectFlags&f.flag != 0 {
+				if len(body) < 16 {
+					return ACE{}, 0, errInvalidACL
+				}
+				copy(f.guid[:], body)
+				body = body[16:]
+			}
+		}
+	}
+	sid, n, err := decodeSid(body)
+	if err != nil {
+		return ACE{}, 0, errInvalidACL
+	}
+	ace.SID = sid
+	if len(body) > n {
+		ace.ApplicationData = append([]byte(nil), body[n:]...)
+	}
+	return ace, size, nil
+}
+
+func (ace *ACE) put(b []byte) {
+	b[0] = uint8(ace.Type)
+	b[1] = uint8(ace.Flags)
+	binary.LittleEndian.PutUint16(b[2:4], uint16(len(b)))
+	binary.LittleEndian.PutUint32(b[4:8], uint32(ace.Mask))
+	off := 8
+	if ace.Type.IsObject() {
+		binary.LittleEndian.PutUint32(b[off:], ace.ObjectFlags)
+		off += 4
+		if ace.ObjectFlags&objectTypePresent != 0 {
+			off += copy(b[off:], ace.ObjectType[:])
+		}
+		if ace.ObjectFlags&inheritedObjectTypePresent != 0 {
+			off += copy(b[off:], ace.InheritedObjectType[:])
+		}
+	}
+	if ace.SID != nil {
+		ace.SID.put(b[off:])
+		off += ace.SID.Len()
+	}
+	copy(b[off:], ace.ApplicationData)
+}
+
+// ACL is an access control list, either the discretionary ACL (DACL) of a security
+// descriptor, which controls access, or its system ACL (SACL), which controls auditing
+// and holds the mandatory label.
+type ACL struct {
+	// Revision is the revision of the ACL. When encoding, it is raised as needed for
+	// the ACE types in the ACL.
+	Revision uint8
+	ACEs     []ACE
+}
+
+// decodeACL decodes a binary ACL.
+func decodeACL(b []byte) (*ACL, error) {
+	if len(b) < aclHeaderSize {
+		return nil, errInvalidACL
+	}
+	size := int(binary.LittleEndian.Uint16(b[2:4]))
+	count := int(binary.LittleEndian.Uint16(b[4:6]))
+	if size < aclHeaderSize || size > len(b) {
+		return nil, errInvalidACL
+	}
+	acl := &ACL{Revision: b[0], ACEs: make([]ACE, 0, count)}
+	b = b[aclHeaderSize:size]
+	for i := 0; i < count; i++ {
+		ace, n, err := decodeACE(b)
+		if err != nil {
+			return nil, err
+		}
+		acl.ACEs = append(acl.ACEs, ace)
+		b = b[n:]
+	}
+	return acl, nil
+}
+
+// Len returns the size of the ACL in binary form.
+func (acl *ACL) Len() int {
+	n := aclHeaderSize
+	for i := range acl.ACEs {
+		n += acl.ACEs[i].len()
+	}
+	return n
+}
+
+// Bytes returns the ACL in binary form.
+func (acl *ACL) Bytes() ([]byte, error) {
+	b := make([]byte, acl.Len())
+	if err := acl.put(b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (acl *ACL) put(b []byte) error {
+	if len(b) > maxACLSize || len(acl.ACEs) > maxACLSize {
+		return errInvalidACL
+	}
+	revision := acl.Revision
+	if revision < aclRevision {
+		revision = aclRevision
+	}
+	for i := range acl.ACEs {
+		ace := &acl.ACEs[i]
+		if ace.SID == nil && ace.Type != AccessAllowedCompoundACE || ace.SID != nil && !ace.SID.valid() {
+			return errInvalidACL
+		}
+		if ace.Type.IsObject() {
+			revision = aclRevisionDS
+		}
+	}
+	b[0] = revision
+	binary.LittleEndian.PutUint16(b[2:4], uint16(len(b)))
+	binary.LittleEndian.PutUint16(b[4:6], uint16(len(acl.ACEs)))
+	off := aclHeaderSize
+	for i := range acl.ACEs {
+		n := acl.ACEs[i].len()
+		acl.ACEs[i].put(b[off : off+n])
+		off += n
+	}
+	return nil
+}
+
+// canonicalRank returns the position of an ACE's group in canonical order: explicit deny
+// ACEs, then explicit allow and other explicit ACEs, then inherited ACEs.
+func canonicalRank(ace *ACE) int {
+	switch {
+	case ace.Flags&InheritedACE != 0:
+		return 2
+	case ace.Type.isDeny():
+		return 0
+	}
+	return 1
+}
+
+// IsCanonical reports whether the ACEs in the ACL are in canonical order.
+func (acl *ACL) IsCanonical() bool {
+	for i := 1; i < len(acl.ACEs); i++ {
+		if canonicalRank(&acl.ACEs[i]) < canonicalRank(&acl.ACEs[i-1]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Canonicalize sorts the ACEs into canonical order, in which explicit deny ACEs come
+// before explicit allow ACEs, which come before inherited ACEs. It keeps the relative
+// order of the ACEs within each group, so inherited ACEs stay in the order of the
+// ancestors they were inherited from.
+func (acl *ACL) Canonicalize() {
+	sort.SliceStable(acl.ACEs, func(i, j int) bool {
+		return canonicalRank(&acl.ACEs[i]) < canonicalRank(&acl.ACEs[j])
+	})
+}
+
+// AddACE inserts ace at the end of its group in canonical order, so that adding to a
+// canonical ACL leaves it canonical.
+func (acl *ACL) AddACE(ace ACE) {
+	rank := canonicalRank(&ace)
+	i := len(acl.ACEs)
+	for i > 0 && canonicalRank(&acl.ACEs[i-1]) > rank {
+		i--
+	}
+	acl.ACEs = append(acl.ACEs, ACE{})
+	copy(acl.ACEs[i+1:], acl.ACEs[i:])
+	acl.ACEs[i] = ace
+}
+
+// RemoveACEs removes the ACEs for which match returns true and returns the number of
+// ACEs removed.
+func (acl *ACL) RemoveACEs(match func(ace *ACE) bool) int {
+	aces := acl.ACEs[:0]
+	for i := range acl.ACEs {
+		if !match(&acl.ACEs[i]) {
+			aces = append(aces, acl.ACEs[i])
+		}
+	}
+	n := len(acl.ACEs) - len(aces)
+	acl.ACEs = aces
+	return n
+}
+
+// RemoveSID removes the explicit ACEs whose trustee is sid and returns the number of
+// ACEs removed. Inherited ACEs are kept, since they would be inherited again.
+func (acl *ACL) RemoveSID(sid *SID) int {
+	return acl.RemoveACEs(func(ace *ACE) bool {
+		return ace.Flags&InheritedACE == 0 && ace.SID != nil && ace.SID.Equal(sid)
+	})
+}
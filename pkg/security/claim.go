@@ -0,0 +1,222 @@
+package security
+
+import (
+	"encoding/binary"
+	"errors"
+	"unicode/utf16"
+)
+
+// ClaimType is the type of the values of a resource attribute.
+type ClaimType uint16
+
+// Claim value types.
+const (
+	ClaimInt64       ClaimType = 0x1
+	ClaimUint64      ClaimType = 0x2
+	ClaimString      ClaimType = 0x3
+	ClaimSID         ClaimType = 0x5
+	ClaimBoolean     ClaimType = 0x6
+	ClaimOctetString ClaimType = 0x10
+)
+
+// ClaimFlags are the CLAIM_SECURITY_ATTRIBUTE_* flags of a resource attribute.
+type ClaimFlags uint32
+
+// Claim flags.
+const (
+	ClaimNonInheritable     ClaimFlags = 0x1
+	ClaimValueCaseSensitive ClaimFlags = 0x2
+	ClaimUseForDenyOnly     ClaimFlags = 0x4
+	ClaimDisabledByDefault  ClaimFlags = 0x8
+	ClaimDisabled           ClaimFlags = 0x10
+	ClaimMandatory          ClaimFlags = 0x20
+)
+
+const claimHeaderSize = 16
+
+var errInvalidClaim = errors.New("invalid resource attribute")
+
+// ResourceAttribute is the attribute held by a SystemResourceAttributeACE, which
+// conditions such as (@Resource.Project == "alpha") refer to.
+type ResourceAttribute struct {
+	Name  string
+	Type  ClaimType
+	Flags ClaimFlags
+	// Values holds the attribute's values: int64s, uint64s, strings, *SIDs, bools,
+	// or []bytes according to Type.
+	Values []interface{}
+}
+
+// readClaimString reads the NUL-terminated UTF-16 string at off in b.
+func readClaimString(b []byte, off uint32) (string, error) {
+	var s []uint16
+	for i := uint64(off); ; i += 2 {
+		if i+2 > uint64(len(b)) {
+			return "", errInvalidClaim
+		}
+		c := binary.LittleEndian.Uint16(b[i:])
+		if c == 0 {
+			break
+		}
+		s = append(s, c)
+	}
+	return string(utf16.Decode(s)), nil
+}
+
+// ParseResourceAttribute parses a CLAIM_SECURITY_ATTRIBUTE_RELATIVE_V1 structure,
+// the application data of a SystemResourceAttributeACE.
+func ParseResourceAttribute(b []byte) (*ResourceAttribute, error) {
+	if len(b) < claimHeaderSize {
+		return nil, errInvalidClaim
+	}
+	a := &ResourceAttribute{
+		Type:  ClaimType(binary.LittleEndian.Uint16(b[4:])),
+		Flags: ClaimFlags(binary.LittleEndian.Uint32(b[8:])),
+	}
+	var err error
+	if a.Name, err = readClaimString(b, binary.LittleEndian.Uint32(b)); err != nil {
+		return nil, err
+	}
+	count := binary.LittleEndian.Uint32(b[12:])
+	if uint64(count)*4 > uint64(len(b)-claimHeaderSize) {
+		return nil, errInvalidClaim
+	}
+	for i := uint32(0); i < count; i++ {
+		off := uint64(binary.LittleEndian.Uint32(b[claimHeaderSize+i*4:]))
+		var v interface{}
+		switch a.Type {
+		case ClaimInt64, ClaimUint64, ClaimBoolean:
+			if off+8 > uint64(len(b)) {
+				return nil, errInvalidClaim
+			}
+			q := binary.LittleEndian.Uint64(b[off:])
+			switch a.Type {
+			case ClaimInt64:
+				v = int64(q)
+			case ClaimUint64:
+				v = q
+			default:
+				v = q != 0
+			}
+		case ClaimString:
+			if v, err = readClaimString(b, uint32(off)); err != nil {
+				return nil, err
+			}
+		case ClaimSID, ClaimOctetString:
+			if off+4 > uint64(len(b)) {
+				return nil, errInvalidClaim
+			}
+			n := uint64(binary.LittleEndian.Uint32(b[off:]))
+			if off+4+n > uint64(len(b)) {
+				return nil, errInvalidClaim
+			}
+			data := b[off+4 : off+4+n]
+			if a.Type == ClaimOctetString {
+				v = append([]byte(nil), data...)
+			} else {
+				sid, sn, err := decodeSid(data)
+				if err != nil || sn != len(data) {
+					return nil, errInvalidClaim
+				}
+				v = sid
+			}
+		default:
+			return nil, errInvalidClaim
+		}
+		a.Values = append(a.Values, v)
+	}
+	return a, nil
+}
+
+func appendClaimString(b []byte, s string) []byte {
+	for _, c := range utf16.Encode([]rune(s)) {
+		b = append(b, byte(c), byte(c>>8))
+	}
+	return append(b, 0, 0)
+}
+
+// Bytes returns the attribute as a CLAIM_SECURITY_ATTRIBUTE_RELATIVE_V1 structure.
+func (a *ResourceAttribute) Bytes() ([]byte, error) {
+	b := make([]byte, claimHeaderSize+4*len(a.Values))
+	binary.LittleEndian.PutUint16(b[4:], uint16(a.Type))
+	binary.LittleEndian.PutUint32(b[8:], uint32(a.Flags))
+	binary.LittleEndian.PutUint32(b[12:], uint32(len(a.Values)))
+	binary.LittleEndian.PutUint32(b, uint32(len(b)))
+	b = appendClaimString(b, a.Name)
+	for i, v := range a.Values {
+		for len(b)%4 != 0 {
+			b = append(b, 0)
+		}
+		binary.LittleEndian.PutUint32(b[claimHeaderSize+i*4:], uint32(len(b)))
+		var q uint64
+		switch v := v.(type) {
+		case int64:
+			if a.Type != ClaimInt64 {
+				return nil, errInvalidClaim
+			}
+			q = uint64(v)
+		case uint64:
+			if a.Type != ClaimUint64 {
+				return nil, errInvalidClaim
+			}
+			q = v
+		case bool:
+			if a.Type != ClaimBoolean {
+				return nil, errInvalidClaim
+			}
+			if v {
+				q = 1
+			}
+		case string:
+			if a.Type != ClaimString {
+				return nil, errInvalidClaim
+			}
+			b = appendClaimString(b, v)
+			continue
+		case []byte:
+			if a.Type != ClaimOctetString {
+				return nil, errInvalidClaim
+			}
+			b = append(appendUint32(b, uint32(len(v))), v...)
+			continue
+		case *SID:
+			if a.Type != ClaimSID || v == nil || !v.valid() {
+				return nil, errInvalidClaim
+			}
+			b = append(appendUint32(b, uint32(v.Len())), v.Bytes()...)
+			continue
+		default:
+			return nil, errInvalidClaim
+		}
+		var buf [8]byte
+		binary.LittleEndian.PutUint64(buf[:], q)
+		b = append(b, buf[:]...)
+	}
+	if len(b) > maxACLSize {
+		return nil, errInvalidClaim
+	}
+	return b, nil
+}
+
+// ResourceAttribute returns the attribute of a SystemResourceAttributeACE, or nil for
+// other types of ACE.
+func (ace *ACE) ResourceAttribute() (*ResourceAttribute, error) {
+	if ace.Type != SystemResourceAttributeACE {
+		return nil, nil
+	}
+	return ParseResourceAttribute(ace.ApplicationData)
+}
+
+// SetResourceAttribute stores a as the attribute of ace, which must be a
+// SystemResourceAttributeACE.
+func (ace *ACE) SetResourceAttribute(a *ResourceAttribute) error {
+	if ace.Type != SystemResourceAttributeACE {
+		return errInvalidClaim
+	}
+	b, err := a.Bytes()
+	if err != nil {
+		return err
+	}
+	ace.ApplicationData = b
+	return nil
+}
@@ -0,0 +1,475 @@
+package security
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// ConditionOp is the token of a node in the condition of a conditional ACE: a
+// literal, an attribute, or an operator.
+type ConditionOp uint8
+
+// Condition tokens, from MS-DTYP 2.4.4.17.
+const (
+	CondInt8        ConditionOp = 0x01
+	CondInt16       ConditionOp = 0x02
+	CondInt32       ConditionOp = 0x03
+	CondInt64       ConditionOp = 0x04
+	CondString      ConditionOp = 0x10
+	CondOctetString ConditionOp = 0x18
+	CondComposite   ConditionOp = 0x50
+	CondSID         ConditionOp = 0x51
+
+	CondEqual                ConditionOp = 0x80
+	CondNotEqual             ConditionOp = 0x81
+	CondLess                 ConditionOp = 0x82
+	CondLessOrEqual          ConditionOp = 0x83
+	CondGreater              ConditionOp = 0x84
+	CondGreaterOrEqual       ConditionOp = 0x85
+	CondContains             ConditionOp = 0x86
+	CondExists               ConditionOp = 0x87
+	CondAnyOf                ConditionOp = 0x88
+	CondMemberOf             ConditionOp = 0x89
+	CondDeviceMemberOf       ConditionOp = 0x8a
+	CondMemberOfAny          ConditionOp = 0x8b
+	CondDeviceMemberOfAny    ConditionOp = 0x8c
+	CondNotExists            ConditionOp = 0x8d
+	CondNotContains          ConditionOp = 0x8e
+	CondNotAnyOf             ConditionOp = 0x8f
+	CondNotMemberOf          ConditionOp = 0x90
+	CondNotDeviceMemberOf    ConditionOp = 0x91
+	CondNotMemberOfAny       ConditionOp = 0x92
+	CondNotDeviceMemberOfAny ConditionOp = 0x93
+	CondAnd                  ConditionOp = 0xa0
+	CondOr                   ConditionOp = 0xa1
+	CondNot                  ConditionOp = 0xa2
+
+	CondLocalAttribute    ConditionOp = 0xf8
+	CondUserAttribute     ConditionOp = 0xf9
+	CondResourceAttribute ConditionOp = 0xfa
+	CondDeviceAttribute   ConditionOp = 0xfb
+)
+
+var condNames = map[ConditionOp]string{
+	CondEqual:                "==",
+	CondNotEqual:             "!=",
+	CondLess:                 "<",
+	CondLessOrEqual:          "<=",
+	CondGreater:              ">",
+	CondGreaterOrEqual:       ">=",
+	CondContains:             "Contains",
+	CondExists:               "Exists",
+	CondAnyOf:                "Any_of",
+	CondMemberOf:             "Member_of",
+	CondDeviceMemberOf:       "Device_Member_of",
+	CondMemberOfAny:          "Member_of_Any",
+	CondDeviceMemberOfAny:    "Device_Member_of_Any",
+	CondNotExists:            "Not_Exists",
+	CondNotContains:          "Not_Contains",
+	CondNotAnyOf:             "Not_Any_of",
+	CondNotMemberOf:          "Not_Member_of",
+	CondNotDeviceMemberOf:    "Not_Device_Member_of",
+	CondNotMemberOfAny:       "Not_Member_of_Any",
+	CondNotDeviceMemberOfAny: "Not_Device_Member_of_Any",
+	CondAnd:                  "&&",
+	CondOr:                   "||",
+	CondNot:                  "!",
+}
+
+// arity returns the number of operands of op, or -1 if op is not a valid token.
+func (op ConditionOp) arity() int {
+	switch {
+	case op == CondInt8 || op == CondInt16 || op == CondInt32 || op == CondInt64,
+		op == CondString || op == CondOctetString || op == CondComposite || op == CondSID,
+		op >= CondLocalAttribute && op <= CondDeviceAttribute:
+		return 0
+	case op == CondExists || op == CondNotExists || op == CondNot,
+		op >= CondMemberOf && op <= CondDeviceMemberOfAny,
+		op >= CondNotMemberOf && op <= CondNotDeviceMemberOfAny:
+		return 1
+	case op >= CondEqual && op <= CondNotAnyOf, op == CondAnd || op == CondOr:
+		return 2
+	}
+	return -1
+}
+
+func (op ConditionOp) isInteger() bool {
+	return op >= CondInt8 && op <= CondInt64
+}
+
+// Integer literal signs and bases.
+const (
+	condSignPlus     = 1
+	condSignMinus    = 2
+	condSignNone     = 3
+	condBaseOctal    = 1
+	condBaseDecimal  = 2
+	condBaseHex      = 3
+	condIntegerSize  = 10
+	maxConditionSize = maxACLSize
+)
+
+var (
+	conditionSignature  = []byte("artx")
+	errInvalidCondition = errors.New("invalid ACE condition")
+)
+
+// Condition is a node in the parsed condition of a conditional ACE, such as
+// (@User.Project Any_of {"alpha", "beta"}).
+type Condition struct {
+	Op ConditionOp
+
+	// Operands are the operands of an operator, in the order they appear in SDDL,
+	// or the elements of a composite.
+	Operands []*Condition
+
+	// Name is the name of an attribute.
+	Name string
+
+	// Value is the value of a literal: an int64 for integers, a string, a []byte for
+	// octet strings, or a *SID.
+	Value interface{}
+
+	// Sign and Base record how an integer literal was written. Zero values mean no
+	// sign and decimal.
+	Sign uint8
+	Base uint8
+}
+
+// ParseCondition parses the binary form of a condition, which starts with the
+// signature "artx" and is stored as the application data of callback ACEs. Trailing
+// padding is ignored.
+func ParseCondition(b []byte) (*Condition, error) {
+	if len(b) < len(conditionSignature) || string(b[:len(conditionSignature)]) != string(conditionSignature) {
+		return nil, errInvalidCondition
+	}
+	b = b[len(conditionSignature):]
+	var stack []*Condition
+	for len(b) > 0 {
+		op := ConditionOp(b[0])
+		if op == 0 {
+			b = b[1:]
+			continue
+		}
+		switch op.arity() {
+		case 0:
+			c, n, err := decodeConditionOperand(b)
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, c)
+			b = b[n:]
+			continue
+		case 1, 2:
+			n := op.arity()
+			if len(stack) < n {
+				return nil, errInvalidCondition
+			}
+			c := &Condition{Op: op, Operands: append([]*Condition(nil), stack[len(stack)-n:]...)}
+			stack = append(stack[:len(stack)-n], c)
+		default:
+			return nil, errInvalidCondition
+		}
+		b = b[1:]
+	}
+	if len(stack) != 1 {
+		return nil, errInvalidCondition
+	}
+	return stack[0], nil
+}
+
+// decodeConditionOperand decodes the literal or attribute at the start of b and
+// returns its size.
+func decodeConditionOperand(b []byte) (*Condition, int, error) {
+	c := &Condition{Op: ConditionOp(b[0])}
+	b = b[1:]
+	if c.Op.isInteger() {
+		if len(b) < condIntegerSize {
+			return nil, 0, errInvalidCondition
+		}
+		c.Value = int64(binary.LittleEndian.Uint64(b))
+		c.Sign = b[8]
+		c.Base = b[9]
+		return c, 1 + condIntegerSize, nil
+	}
+	if len(b) < 4 {
+		return nil, 0, errInvalidCondition
+	}
+	size := binary.LittleEndian.Uint32(b)
+	if uint64(size) > uint64(len(b)-4) {
+		return nil, 0, errInvalidCondition
+	}
+	data := b[4 : 4+size]
+	switch c.Op {
+	case CondString, CondLocalAttribute, CondUserAttribute, CondResourceAttribute, CondDeviceAttribute:
+		if size%2 != 0 {
+			return nil, 0, errInvalidCondition
+		}
+		s := make([]uint16, size/2)
+		for i := range s {
+			s[i] = binary.LittleEndian.Uint16(data[i*2:])
+		}
+		if c.Op == CondString {
+			c.Value = string(utf16.Decode(s))
+		} else {
+			c.Name = string(utf16.Decode(s))
+		}
+	case CondOctetString:
+		c.Value = append([]byte(nil), data...)
+	case CondSID:
+		sid, n, err := decodeSid(data)
+		if err != nil || n != len(data) {
+			return nil, 0, errInvalidCondition
+		}
+		c.Value = sid
+	case CondComposite:
+		for len(data) > 0 {
+			if ConditionOp(data[0]).arity() != 0 {
+				return nil, 0, errInvalidCondition
+			}
+			e, n, err := decodeConditionOperand(data)
+			if err != nil {
+				return nil, 0, err
+			}
+			c.Operands = append(c.Operands, e)
+			data = data[n:]
+		}
+	}
+	return c, 5 + int(size), nil
+}
+
+// Bytes returns the binary form of the condition, padded to a multiple of four
+// bytes.
+func (c *Condition) Bytes() ([]byte, error) {
+	b, err := c.append(append([]byte(nil), conditionSignature...))
+	if err != nil {
+		return nil, err
+	}
+	for len(b)%4 != 0 {
+		b = append(b, 0)
+	}
+	if len(b) > maxConditionSize {
+		return nil, errInvalidCondition
+	}
+	return b, nil
+}
+
+func (c *Condition) append(b []byte) ([]byte, error) {
+	n := c.Op.arity()
+	if n < 0 {
+		return nil, errInvalidCondition
+	}
+	if n == 0 {
+		return c.appendOperand(b)
+	}
+	if len(c.Operands) != n {
+		return nil, errInvalidCondition
+	}
+	var err error
+	for _, o := range c.Operands {
+		if o == nil {
+			return nil, errInvalidCondition
+		}
+		if b, err = o.append(b); err != nil {
+			return nil, err
+		}
+	}
+	return append(b, byte(c.Op)), nil
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	return append(b, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+}
+
+func appendUTF16(b []byte, s string) []byte {
+	u := utf16.Encode([]rune(s))
+	b = appendUint32(b, uint32(len(u)*2))
+	for _, c := range u {
+		b = append(b, byte(c), byte(c>>8))
+	}
+	return b
+}
+
+func (c *Condition) appendOperand(b []byte) ([]byte, error) {
+	b = append(b, byte(c.Op))
+	switch c.Op {
+	case CondLocalAttribute, CondUserAttribute, CondResourceAttribute, CondDeviceAttribute:
+		return appendUTF16(b, c.Name), nil
+	case CondComposite:
+		start := len(b)
+		b = appendUint32(b, 0)
+		for _, e := range c.Operands {
+			if e == nil || e.Op.arity() != 0 {
+				return nil, errInvalidCondition
+			}
+			var err error
+			if b, err = e.appendOperand(b); err != nil {
+				return nil, err
+			}
+		}
+		binary.LittleEndian.PutUint32(b[start:], uint32(len(b)-start-4))
+		return b, nil
+	}
+	switch v := c.Value.(type) {
+	case int64:
+		if !c.Op.isInteger() {
+			break
+		}
+		sign, base := c.Sign, c.Base
+		if sign == 0 {
+			sign = condSignNone
+		}
+		if base == 0 {
+			base = condBaseDecimal
+		}
+		var q [8]byte
+		binary.LittleEndian.PutUint64(q[:], uint64(v))
+		return append(append(b, q[:]...), sign, base), nil
+	case string:
+		if c.Op == CondString {
+			return appendUTF16(b, v), nil
+		}
+	case []byte:
+		if c.Op == CondOctetString {
+			return append(appendUint32(b, uint32(len(v))), v...), nil
+		}
+	case *SID:
+		if c.Op == CondSID && v != nil && v.valid() {
+			return append(appendUint32(b, uint32(v.Len())), v.Bytes()...), nil
+		}
+	}
+	return nil, errInvalidCondition
+}
+
+// String returns the condition in SDDL syntax. SIDs are written in their S-1-...
+// form rather than as aliases. SDDL string literals have no escapes, so a string
+// that contains a double quote is written as <invalid>.
+func (c *Condition) String() string {
+	var sb strings.Builder
+	c.write(&sb)
+	return sb.String()
+}
+
+func (c *Condition) write(sb *strings.Builder) {
+	switch c.Op.arity() {
+	case 0:
+		c.writeOperand(sb)
+		return
+	case -1:
+		sb.WriteString("<invalid>")
+		return
+	}
+	name := condNames[c.Op]
+	sb.WriteString("(")
+	switch {
+	case len(c.Operands) == 1 && c.Op == CondNot:
+		sb.WriteString(name)
+		c.Operands[0].write(sb)
+	case len(c.Operands) == 1:
+		sb.WriteString(name)
+		sb.WriteString(" ")
+		c.Operands[0].write(sb)
+	case len(c.Operands) == 2:
+		c.Operands[0].write(sb)
+		sb.WriteString(" " + name + " ")
+		c.Operands[1].write(sb)
+	default:
+		sb.WriteString("<invalid>")
+	}
+	sb.WriteString(")")
+}
+
+func (c *Condition) writeOperand(sb *strings.Builder) {
+	switch c.Op {
+	case CondLocalAttribute:
+		sb.WriteString(c.Name)
+	case CondUserAttribute:
+		sb.WriteString("@User." + c.Name)
+	case CondResourceAttribute:
+		sb.WriteString("@Resource." + c.Name)
+	case CondDeviceAttribute:
+		sb.WriteString("@Device." + c.Name)
+	case CondComposite:
+		sb.WriteString("{")
+		for i, e := range c.Operands {
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			e.writeOperand(sb)
+		}
+		sb.WriteString("}")
+	default:
+		switch v := c.Value.(type) {
+		case int64:
+			sb.WriteString(formatConditionInt(v, c.Sign, c.Base))
+		case string:
+			if strings.ContainsRune(v, '"') {
+				sb.WriteString("<invalid>")
+			} else {
+				sb.WriteString(`"` + v + `"`)
+			}
+		case []byte:
+			sb.WriteString("#" + hex.EncodeToString(v))
+		case *SID:
+			sb.WriteString("SID(" + v.String() + ")")
+		default:
+			sb.WriteString("<invalid>")
+		}
+	}
+}
+
+func formatConditionInt(v int64, sign, base uint8) string {
+	var prefix string
+	u := uint64(v)
+	if v < 0 {
+		prefix = "-"
+		// Negate in uint64, since -v overflows for math.MinInt64.
+		u = -u
+	} else if sign == condSignPlus {
+		prefix = "+"
+	}
+	switch base {
+	case condBaseOctal:
+		return prefix + "0" + strconv.FormatUint(u, 8)
+	case condBaseHex:
+		return prefix + "0x" + strconv.FormatUint(u, 16)
+	}
+	return prefix + strconv.FormatUint(u, 10)
+}
+
+// IsCallback reports whether ACEs of type t can hold a condition in their application
+// data.
+func (t AceType) IsCallback() bool {
+	switch t {
+	case AccessAllowedCallbackACE, AccessDeniedCallbackACE, AccessAllowedCallbackObjectACE, AccessDeniedCallbackObjectACE,
+		SystemAuditCallbackACE, SystemAlarmCallbackACE, SystemAuditCallbackObjectACE, SystemAlarmCallbackObjectACE:
+		return true
+	}
+	return false
+}
+
+// Condition returns the parsed condition of a conditional ACE, or nil if ace is not a
+// callback ACE or its application data is not a condition.
+func (ace *ACE) Condition() (*Condition, error) {
+	if !ace.Type.IsCallback() || len(ace.ApplicationData) < len(conditionSignature) || string(ace.ApplicationData[:len(conditionSignature)]) != string(conditionSignature) {
+		return nil, nil
+	}
+	return ParseCondition(ace.ApplicationData)
+}
+
+// SetCondition stores c as the condition of ace, which must be a callback ACE.
+func (ace *ACE) SetCondition(c *Condition) error {
+	if !ace.Type.IsCallback() {
+		return errInvalidCondition
+	}
+	b, err := c.Bytes()
+	if err != nil {
+		return err
+	}
+	ace.ApplicationData = b
+	return nil
+}
@@ -0,0 +1,218 @@
+package security
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestConditionRoundTrip(t *testing.T) {
+	admins, _ := ParseSID("S-1-5-32-544")
+	for _, c := range []*Condition{
+		{Op: CondMemberOf, Operands: []*Condition{{Op: CondComposite, Operands: []*Condition{{Op: CondSID, Value: admins}}}}},
+		{Op: CondAnd, Operands: []*Condition{
+			{Op: CondAnyOf, Operands: []*Condition{
+				{Op: CondUserAttribute, Name: "Project"},
+				{Op: CondComposite, Operands: []*Condition{{Op: CondString, Value: "alpha"}, {Op: CondString, Value: "beta"}}},
+			}},
+			{Op: CondNot, Operands: []*Condition{
+				{Op: CondGreaterOrEqual, Operands: []*Condition{
+					{Op: CondResourceAttribute, Name: "Level"},
+					{Op: CondInt64, Value: int64(-16), Sign: condSignMinus, Base: condBaseHex},
+				}},
+			}},
+		}},
+		{Op: CondExists, Operands: []*Condition{{Op: CondDeviceAttribute, Name: "Managed"}}},
+		{Op: CondEqual, Operands: []*Condition{{Op: CondLocalAttribute, Name: "Tag"}, {Op: CondOctetString, Value: []byte{1, 2}}}},
+	} {
+		b, err := c.Bytes()
+		if err != nil {
+			t.Fatalf("%s: %s", c, err)
+		}
+		if len(b)%4 != 0 || !bytes.HasPrefix(b, conditionSignature) {
+			t.Fatalf("%s: bad encoding %x", c, b)
+		}
+		c2, err := ParseCondition(b)
+		if err != nil {
+			t.Fatalf("%s: %s", c, err)
+		}
+		if !reflect.DeepEqual(c, c2) {
+			t.Errorf("%s: round trip produced %s", c, c2)
+		}
+	}
+}
+
+func TestConditionString(t *testing.T) {
+	c := &Condition{Op: CondOr, Operands: []*Condition{
+		{Op: CondEqual, Operands: []*Condition{{Op: CondUserAttribute, Name: "Title"}, {Op: CondString, Value: "PM"}}},
+		{Op: CondLess, Operands: []*Condition{{Op: CondResourceAttribute, Name: "Level"}, {Op: CondInt64, Value: int64(8), Base: condBaseOctal}}},
+	}}
+	expected := `((@User.Title == "PM") || (@Resource.Level < 010))`
+	if s := c.String(); s != expected {
+		t.Fatalf("expected %s, got %s", expected, s)
+	}
+
+	for _, test := range []struct {
+		c        *Condition
+		expected string
+	}{
+		{&Condition{Op: CondString, Value: `C:\dir\ü`}, `"C:\dir\ü"`},
+		{&Condition{Op: CondString, Value: `say "hi"`}, `<invalid>`},
+		{&Condition{Op: CondInt64, Value: int64(math.MinInt64)}, `-9223372036854775808`},
+		{&Condition{Op: CondInt64, Value: int64(math.MinInt64), Base: condBaseHex}, `-0x8000000000000000`},
+		{&Condition{Op: CondInt64, Value: int64(math.MaxInt64), Sign: condSignPlus}, `+9223372036854775807`},
+	} {
+		if s := test.c.String(); s != test.expected {
+			t.Errorf("expected %s, got %s", test.expected, s)
+		}
+	}
+}
+
+func TestParseConditionInvalid(t *testing.T) {
+	for _, b := range [][]byte{
+		nil,
+		[]byte("artx"),
+		[]byte("xtra\x87"),
+		[]byte("artx\x80"),
+		[]byte("artx\x10\x10\x00\x00\x00a"),
+		[]byte("artx\xf9\x02\x00\x00\x00a\x00\xf9\x02\x00\x00\x00b\x00"),
+		[]byte("artx\x03\x01\x02"),
+		[]byte("artx\x77"),
+	} {
+		if c, err := ParseCondition(b); err == nil {
+			t.Errorf("%q: expected error, got %s", b, c)
+		}
+	}
+	if _, err := (&Condition{Op: CondAnd, Operands: []*Condition{{Op: CondLocalAttribute, Name: "a"}}}).Bytes(); err == nil {
+		t.Error("expected error for missing operand")
+	}
+	if _, err := (&Condition{Op: CondString, Value: 5}).Bytes(); err == nil {
+		t.Error("expected error for mistyped value")
+	}
+}
+
+func TestConditionalACE(t *testing.T) {
+	sddl := `D:(XA;;FR;;;WD;(@User.Project Any_of {"alpha", "beta"}))S:(XU;SA;FA;;;WD;(Member_of {SID(BA)}))`
+	sd, err := ParseSDDL(sddl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		ace      *ACE
+		expected string
+	}{
+		{&sd.DACL.ACEs[0], `(@User.Project Any_of {"alpha", "beta"})`},
+		{&sd.SACL.ACEs[0], `(Member_of {SID(S-1-5-32-544)})`},
+	} {
+		c, err := test.ace.Condition()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c == nil || c.String() != test.expected {
+			t.Fatalf("expected %s, got %v", test.expected, c)
+		}
+	}
+	if sd.SACL.ACEs[0].Type != SystemAuditCallbackACE || sd.SACL.ACEs[0].Flags != SuccessfulAccessACE {
+		t.Fatalf("unexpected audit ACE %+v", sd.SACL.ACEs[0])
+	}
+
+	// Edit the condition and check that Windows accepts the result.
+	c, _ := sd.DACL.ACEs[0].Condition()
+	c.Operands[1].Operands = append(c.Operands[1].Operands, &Condition{Op: CondString, Value: "gamma"})
+	if err := sd.DACL.ACEs[0].SetCondition(c); err != nil {
+		t.Fatal(err)
+	}
+	s, err := sd.SDDL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `D:(XA;;FR;;;WD;(@User.Project Any_of {"alpha", "beta", "gamma"}))S:(XU;SA;FA;;;WD;(Member_of {SID(BA)}))`
+	if s != expected {
+		t.Fatalf("expected %s, got %s", expected, s)
+	}
+}
+
+func TestResourceAttributeACE(t *testing.T) {
+	sd, err := ParseSDDL(`S:(RA;;;;;WD;("Project",TS,0x0,"alpha","beta"))(RA;;;;;WD;("Level",TI,0x0,3))`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	orig, err := sd.SDDL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []*ResourceAttribute{
+		{Name: "Project", Type: ClaimString, Values: []interface{}{"alpha", "beta"}},
+		{Name: "Level", Type: ClaimInt64, Values: []interface{}{int64(3)}},
+	}
+	for i := range sd.SACL.ACEs {
+		a, err := sd.SACL.ACEs[i].ResourceAttribute()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(a, expected[i]) {
+			t.Fatalf("expected %+v, got %+v", expected[i], a)
+		}
+		// Re-encoding must produce a descriptor that Windows reads the same way.
+		if err := sd.SACL.ACEs[i].SetResourceAttribute(a); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s, err := sd.SDDL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s != orig {
+		t.Fatalf("expected %s, got %s", orig, s)
+	}
+}
+
+func TestResourceAttributeRoundTrip(t *testing.T) {
+	sid, _ := ParseSID("S-1-5-18")
+	for _, a := range []*ResourceAttribute{
+		{Name: "i", Type: ClaimInt64, Values: []interface{}{int64(-1), int64(2)}},
+		{Name: "u", Type: ClaimUint64, Flags: ClaimNonInheritable, Values: []interface{}{uint64(1 << 63)}},
+		{Name: "s", Type: ClaimString, Flags: ClaimValueCaseSensitive, Values: []interface{}{"x", "yz"}},
+		{Name: "sid", Type: ClaimSID, Values: []interface{}{sid}},
+		{Name: "b", Type: ClaimBoolean, Values: []interface{}{true, false}},
+		{Name: "o", Type: ClaimOctetString, Values: []interface{}{[]byte{1, 2, 3}}},
+	} {
+		b, err := a.Bytes()
+		if err != nil {
+			t.Fatalf("%s: %s", a.Name, err)
+		}
+		a2, err := ParseResourceAttribute(b)
+		if err != nil {
+			t.Fatalf("%s: %s", a.Name, err)
+		}
+		if !reflect.DeepEqual(a, a2) {
+			t.Errorf("%s: round trip produced %+v", a.Name, a2)
+		}
+	}
+	if _, err := (&ResourceAttribute{Name: "x", Type: ClaimString, Values: []interface{}{1}}).Bytes(); err == nil {
+		t.Error("expected error for mistyped value")
+	}
+	if _, err := ParseResourceAttribute(make([]byte, 8)); err == nil {
+		t.Error("expected error for truncated attribute")
+	}
+}
+
+func TestSDDLRoundTripSACL(t *testing.T) {
+	for _, sddl := range []string{
+		"S:(AU;SAFA;FA;;;WD)(AU;FA;FW;;;BU)",
+		`S:(RA;;;;;WD;("Secrecy",TU,0x0,3))`,
+	} {
+		sd, err := ParseSDDL(sddl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, err := sd.SDDL()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s != sddl {
+			t.Errorf("expected %s, got %s", sddl, s)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package security
+
+// Inheritance flags for GrantAccess.
+const (
+	// InheritNone applies an ACE only to the object itself.
+	InheritNone AceFlags = 0
+	// InheritAll applies an ACE to a directory and all the files and directories below
+	// it.
+	InheritAll = ObjectInheritACE | ContainerInheritACE
+)
+
+// modifyDACL applies edit to the DACL of the file or directory at path. edit returns
+// false if the DACL does not need to change.
+func modifyDACL(path string, edit func(dacl *ACL) bool) error {
+	sd, err := GetNamedSecurityInfo(path, FileObject, DACLSecurityInformation)
+	if err != nil {
+		return err
+	}
+	// A NULL DACL grants all access to everyone, and there is nothing to revoke from
+	// it.
+	if sd.DACL == nil || !edit(sd.DACL) {
+		return nil
+	}
+	return SetNamedSecurityInfo(path, FileObject, DACLSecurityInformation, sd)
+}
+
+// GrantAccess grants mask to sid on the file or directory at path, keeping the existing
+// ACEs of its DACL. inheritance is a combination of ObjectInheritACE,
+// ContainerInheritACE, NoPropagateInheritACE, and InheritOnlyACE, such as InheritAll to
+// grant access to a whole directory tree; inheritable access is propagated to the
+// existing children of path.
+//
+// If the DACL already has an explicit ACE that grants access to sid with the same
+// inheritance, mask is added to it; otherwise a new ACE is inserted in canonical
+// order. The caller must have WRITE_DAC access to path.
+func GrantAccess(path string, sid *SID, mask AccessMask, inheritance AceFlags) error {
+	inheritance &= ObjectInheritACE | ContainerInheritACE | NoPropagateInheritACE | InheritOnlyACE
+	return modifyDACL(path, func(dacl *ACL) bool {
+		for i := range dacl.ACEs {
+			ace := &dacl.ACEs[i]
+			if ace.Type == AccessAllowedACE && ace.Flags == inheritance && ace.SID != nil && ace.SID.Equal(sid) {
+				if ace.Mask&mask == mask {
+					return false
+				}
+				ace.Mask |= mask
+				return true
+			}
+		}
+		dacl.AddACE(AllowACE(sid, mask, inheritance))
+		return true
+	})
+}
+
+// RevokeAccess removes the explicit ACEs of the DACL of the file or directory at path
+// that grant access to sid, and the ACEs they propagated to its children. Deny ACEs
+// and inherited ACEs are kept, so sid may still have access through an ACE inherited
+// from the parent of path or through its groups.
+func RevokeAccess(path string, sid *SID) error {
+	return modifyDACL(path, func(dacl *ACL) bool {
+		return dacl.RemoveACEs(func(ace *ACE) bool {
+			return ace.Type.isAllow() && ace.Flags&InheritedACE == 0 && ace.SID != nil && ace.SID.Equal(sid)
+		}) != 0
+	})
+}
@@ -0,0 +1,63 @@
+package security
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func countACEs(t *testing.T, path string, sid *SID, inherited bool) (int, AccessMask) {
+	sd, err := GetNamedSecurityInfo(path, FileObject, DACLSecurityInformation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sd.DACL.IsCanonical() {
+		t.Fatalf("DACL of %s is not canonical", path)
+	}
+	n := 0
+	var mask AccessMask
+	for _, ace := range sd.DACL.ACEs {
+		if ace.SID.Equal(sid) && (ace.Flags&InheritedACE != 0) == inherited {
+			n++
+			mask |= ace.Mask
+		}
+	}
+	return n, mask
+}
+
+func TestGrantRevokeAccess(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	child := filepath.Join(dir, "child")
+	if err := ioutil.WriteFile(child, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	sid := NetworkService.SID()
+
+	if err := GrantAccess(dir, sid, FileGenericRead, InheritAll); err != nil {
+		t.Fatal(err)
+	}
+	if err := GrantAccess(dir, sid, FileGenericExecute, InheritAll); err != nil {
+		t.Fatal(err)
+	}
+	if n, mask := countACEs(t, dir, sid, false); n != 1 || mask != FileGenericRead|FileGenericExecute {
+		t.Fatalf("unexpected ACEs on directory: %d %#x", n, mask)
+	}
+	if n, _ := countACEs(t, child, sid, true); n != 1 {
+		t.Fatalf("access was not propagated to child: %d", n)
+	}
+
+	if err := RevokeAccess(dir, sid); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := countACEs(t, dir, sid, false); n != 0 {
+		t.Fatalf("access was not revoked: %d", n)
+	}
+	if n, _ := countACEs(t, child, sid, true); n != 0 {
+		t.Fatalf("access was not revoked from child: %d", n)
+	}
+}
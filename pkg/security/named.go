@@ -0,0 +1,165 @@
+package security
+
+import (
+	"os"
+	"syscall"
+)
+
+//sys getNamedSecurityInfo(name string, objectType uint32, si uint32, owner **byte, group **byte, dacl **byte, sacl **byte, sd **byte) (win32err error) = advapi32.GetNamedSecurityInfoW
+//sys setNamedSecurityInfo(name string, objectType uint32, si uint32, owner *byte, group *byte, dacl *byte, sacl *byte) (win32err error) = advapi32.SetNamedSecurityInfoW
+//sys getSecurityInfo(handle syscall.Handle, objectType uint32, si uint32, owner **byte, group **byte, dacl **byte, sacl **byte, sd **byte) (win32err error) = advapi32.GetSecurityInfo
+//sys setSecurityInfo(handle syscall.Handle, objectType uint32, si uint32, owner *byte, group *byte, dacl *byte, sacl *byte) (win32err error) = advapi32.SetSecurityInfo
+
+// ObjectType is the type of object whose security is queried or set, SE_OBJECT_TYPE.
+type ObjectType uint32
+
+const (
+	// FileObject is a file, directory, or named pipe. Names are Win32 paths, including
+	// \\.\pipe\ paths.
+	FileObject ObjectType = 1
+	// ServiceObject is a service, named by its service name.
+	ServiceObject ObjectType = 2
+	// PrinterObject is a printer.
+	PrinterObject ObjectType = 3
+	// RegistryKey is a registry key. Names start with CLASSES_ROOT, CURRENT_USER,
+	// MACHINE, or USERS, such as MACHINE\SOFTWARE\Microsoft.
+	RegistryKey ObjectType = 4
+	// LMShare is a network share, such as \\server\share.
+	LMShare ObjectType = 5
+	// KernelObject is a kernel object such as an event, mutex, semaphore, job, or
+	// section. Named kernel objects can be queried by name, such as Global\name.
+	KernelObject ObjectType = 6
+	// WindowObject is a window station or desktop. Only handles are supported.
+	WindowObject ObjectType = 7
+	// RegistryWOW6432Key is a registry key in the 32-bit view of the registry.
+	RegistryWOW6432Key ObjectType = 12
+	// RegistryWOW6464Key is a registry key in the 64-bit view of the registry.
+	RegistryWOW6464Key ObjectType = 13
+)
+
+// SecurityInformation selects the parts of a security descriptor to query or set.
+type SecurityInformation uint32
+
+const (
+	OwnerSecurityInformation SecurityInformation = 0x1
+	GroupSecurityInformation SecurityInformation = 0x2
+	DACLSecurityInformation  SecurityInformation = 0x4
+	SACLSecurityInformation  SecurityInformation = 0x8
+	// LabelSecurityInformation selects the mandatory label, which is stored in the
+	// SACL.
+	LabelSecurityInformation SecurityInformation = 0x10
+
+	// When setting the DACL or SACL, these override the protection of the ACL from
+	// inheritable ACEs of the object's parent. By default, SetNamedSecurityInfo and
+	// SetSecurityInfo protect an ACL if the descriptor's ControlDACLProtected or
+	// ControlSACLProtected flag is set.
+	ProtectedDACLSecurityInformation   SecurityInformation = 0x80000000
+	ProtectedSACLSecurityInformation   SecurityInformation = 0x40000000
+	UnprotectedDACLSecurityInformation SecurityInformation = 0x20000000
+	UnprotectedSACLSecurityInformation SecurityInformation = 0x10000000
+)
+
+// GetNamedSecurityInfo returns the parts of the security descriptor of the object name
+// selected by si. Querying the SACL requires the security privilege.
+func GetNamedSecurityInfo(name string, objectType ObjectType, si SecurityInformation) (*SecurityDescriptor, error) {
+	var p *byte
+	err := getNamedSecurityInfo(name, uint32(objectType), uint32(si), nil, nil, nil, nil, &p)
+	if err != nil {
+		return nil, &os.PathError{Op: "GetNamedSecurityInfo", Path: name, Err: err}
+	}
+	sd, err := parseLocalSecurityDescriptor(p)
+	if err != nil {
+		return nil, &os.PathError{Op: "GetNamedSecurityInfo", Path: name, Err: err}
+	}
+	return sd, nil
+}
+
+// GetSecurityInfo returns the parts of the security descriptor of the object opened as h
+// selected by si. h must have been opened with READ_CONTROL access, and with
+// ACCESS_SYSTEM_SECURITY access to query the SACL.
+func GetSecurityInfo(h syscall.Handle, objectType ObjectType, si SecurityInformation) (*SecurityDescriptor, error) {
+	var p *byte
+	err := getSecurityInfo(h, uint32(objectType), uint32(si), nil, nil, nil, nil, &p)
+	if err != nil {
+		return nil, &os.SyscallError{Syscall: "GetSecurityInfo", Err: err}
+	}
+	sd, err := parseLocalSecurityDescriptor(p)
+	if err != nil {
+		return nil, &os.SyscallError{Syscall: "GetSecurityInfo", Err: err}
+	}
+	return sd, nil
+}
+
+// securityParts returns the binary parts of sd selected by si, and si adjusted for the
+// protection of its ACLs.
+func securityParts(sd *SecurityDescriptor, si SecurityInformation) (owner, group, dacl, sacl []byte, _ SecurityInformation, err error) {
+	if si&OwnerSecurityInformation != 0 {
+		if sd.Owner == nil {
+			return nil, nil, nil, nil, 0, errInvalidSecurityDescriptor
+		}
+		owner = sd.Owner.Bytes()
+	}
+	if si&GroupSecurityInformation != 0 {
+		if sd.Group == nil {
+			return nil, nil, nil, nil, 0, errInvalidSecurityDescriptor
+		}
+		group = sd.Group.Bytes()
+	}
+	// A nil DACL is passed as a NULL DACL, which grants all access.
+	if si&DACLSecurityInformation != 0 && sd.DACL != nil {
+		if dacl, err = sd.DACL.Bytes(); err != nil {
+			return nil, nil, nil, nil, 0, err
+		}
+	}
+	if si&(SACLSecurityInformation|LabelSecurityInformation) != 0 && sd.SACL != nil {
+		if sacl, err = sd.SACL.Bytes(); err != nil {
+			return nil, nil, nil, nil, 0, err
+		}
+	}
+	const dacls = ProtectedDACLSecurityInformation | UnprotectedDACLSecurityInformation
+	if si&DACLSecurityInformation != 0 && si&dacls == 0 && sd.Control&ControlDACLProtected != 0 {
+		si |= ProtectedDACLSecurityInformation
+	}
+	const sacls = ProtectedSACLSecurityInformation | UnprotectedSACLSecurityInformation
+	if si&SACLSecurityInformation != 0 && si&sacls == 0 && sd.Control&ControlSACLProtected != 0 {
+		si |= ProtectedSACLSecurityInformation
+	}
+	return owner, group, dacl, sacl, si, nil
+}
+
+func bytesPtr(b []byte) *byte {
+	if len(b) == 0 {
+		return nil
+	}
+	return &b[0]
+}
+
+// SetNamedSecurityInfo sets the parts of the security descriptor of the object name
+// selected by si to those of sd. If the DACL is selected and sd.DACL is nil, the object
+// is given a NULL DACL, which grants all access to everyone. For files, directories,
+// and registry keys, inheritable ACEs are propagated to the object's children.
+func SetNamedSecurityInfo(name string, objectType ObjectType, si SecurityInformation, sd *SecurityDescriptor) error {
+	owner, group, dacl, sacl, si, err := securityParts(sd, si)
+	if err == nil {
+		err = setNamedSecurityInfo(name, uint32(objectType), uint32(si), bytesPtr(owner), bytesPtr(group), bytesPtr(dacl), bytesPtr(sacl))
+	}
+	if err != nil {
+		return &os.PathError{Op: "SetNamedSecurityInfo", Path: name, Err: err}
+	}
+	return nil
+}
+
+// SetSecurityInfo sets the parts of the security descriptor of the object opened as h
+// selected by si to those of sd. h must have been opened with the WRITE_OWNER,
+// WRITE_DAC, or ACCESS_SYSTEM_SECURITY access that si requires. Unlike
+// SetNamedSecurityInfo, inheritable ACEs are not propagated to the object's children.
+func SetSecurityInfo(h syscall.Handle, objectType ObjectType, si SecurityInformation, sd *SecurityDescriptor) error {
+	owner, group, dacl, sacl, si, err := securityParts(sd, si)
+	if err == nil {
+		err = setSecurityInfo(h, uint32(objectType), uint32(si), bytesPtr(owner), bytesPtr(group), bytesPtr(dacl), bytesPtr(sacl))
+	}
+	if err != nil {
+		return &os.SyscallError{Syscall: "SetSecurityInfo", Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package security
+
+import (
+	"io/ioutil"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestSetNamedSecurityInfo(t *testing.T) {
+	f, err := ioutil.TempFile("", "tst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+
+	everyone, _ := ParseSID("S-1-1-0")
+	sd := &SecurityDescriptor{Control: ControlDACLProtected, DACL: &ACL{}}
+	sd.DACL.AddACE(AllowACE(everyone, FileAllAccess, 0))
+	err = SetNamedSecurityInfo(f.Name(), FileObject, DACLSecurityInformation, sd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sd, err = GetNamedSecurityInfo(f.Name(), FileObject, OwnerSecurityInformation|DACLSecurityInformation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sd.Owner == nil || sd.Control&ControlDACLProtected == 0 {
+		t.Fatalf("unexpected descriptor %+v", sd)
+	}
+	if len(sd.DACL.ACEs) != 1 || !sd.DACL.ACEs[0].SID.Equal(everyone) || sd.DACL.ACEs[0].Mask != FileAllAccess {
+		t.Fatalf("unexpected DACL %+v", sd.DACL)
+	}
+}
+
+func TestGetSecurityInfo(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	named, err := GetNamedSecurityInfo(dir, FileObject, OwnerSecurityInformation|GroupSecurityInformation|DACLSecurityInformation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	sd, err := GetSecurityInfo(syscall.Handle(f.Fd()), FileObject, OwnerSecurityInformation|GroupSecurityInformation|DACLSecurityInformation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s1, err := named.SDDL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s2, err := sd.SDDL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s1 != s2 {
+		t.Fatalf("%s != %s", s1, s2)
+	}
+}
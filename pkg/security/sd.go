@@ -0,0 +1,238 @@
+package security
+
+import (
+	"encoding/binary"
+	"errors"
+	"syscall"
+	"unsafe"
+)
+
+//sys convertStringSecurityDescriptorToSecurityDescriptor(str string, revision uint32, sd **byte, size *uint32) (err error) = advapi32.ConvertStringSecurityDescriptorToSecurityDescriptorW
+//sys convertSecurityDescriptorToStringSecurityDescriptor(sd *byte, revision uint32, secInfo uint32, sddl **uint16, sddlSize *uint32) (err error) = advapi32.ConvertSecurityDescriptorToStringSecurityDescriptorW
+//sys localFree(mem uintptr) = LocalFree
+//sys getSecurityDescriptorLength(sd *byte) (len uint32) = advapi32.GetSecurityDescriptorLength
+
+const (
+	sdRevision   = 1
+	sdHeaderSize = 20
+
+	// allSecurityInformation selects the owner, group, DACL, and SACL when converting
+	// to SDDL, along with the SACL entries that are selected separately: the mandatory
+	// label, resource attributes, scoped policy IDs, process trust label, and access
+	// filters.
+	allSecurityInformation = 0x1ff
+)
+
+// Control holds the SE_* control flags of a security descriptor.
+type Control uint16
+
+// Security descriptor control flags.
+const (
+	ControlOwnerDefaulted     Control = 0x1
+	ControlGroupDefaulted     Control = 0x2
+	ControlDACLPresent        Control = 0x4
+	ControlDACLDefaulted      Control = 0x8
+	ControlSACLPresent        Control = 0x10
+	ControlSACLDefaulted      Control = 0x20
+	ControlDACLAutoInheritReq Control = 0x100
+	ControlSACLAutoInheritReq Control = 0x200
+	ControlDACLAutoInherited  Control = 0x400
+	ControlSACLAutoInherited  Control = 0x800
+	ControlDACLProtected      Control = 0x1000
+	ControlSACLProtected      Control = 0x2000
+	ControlRMControlValid     Control = 0x4000
+	ControlSelfRelative       Control = 0x8000
+)
+
+var errInvalidSecurityDescriptor = errors.New("invalid security descriptor")
+
+// SecurityDescriptor is a parsed security descriptor.
+type SecurityDescriptor struct {
+	// Control holds the control flags. ControlDACLPresent and ControlSACLPresent are
+	// set when encoding if DACL or SACL is not nil. If DACL is nil but
+	// ControlDACLPresent is set, the descriptor has a NULL DACL, which grants all
+	// access to everyone.
+	Control Control
+	// RMControl is the resource manager control byte, which is only meaningful if
+	// ControlRMControlValid is set.
+	RMControl uint8
+	// Owner and Group are the owner and primary group, if present.
+	Owner *SID
+	Group *SID
+	// DACL and SACL are the discretionary and system ACLs, if present.
+	DACL *ACL
+	SACL *ACL
+}
+
+// ParseSecurityDescriptor parses a security descriptor in self-relative binary form,
+// such as one returned by winio.SddlToSecurityDescriptor or read from a backup stream.
+func ParseSecurityDescriptor(b []byte) (*SecurityDescriptor, error) {
+	if len(b) < sdHeaderSize || b[0] != sdRevision {
+		return nil, errInvalidSecurityDescriptor
+	}
+	sd := &SecurityDescriptor{
+		RMControl: b[1],
+		Control:   Control(binary.LittleEndian.Uint16(b[2:4])),
+	}
+	if sd.Control&ControlSelfRelative == 0 {
+		return nil, errInvalidSecurityDescriptor
+	}
+	offset := func(i int) (int, error) {
+		off := int(binary.LittleEndian.Uint32(b[4+4*i:]))
+		if off != 0 && (off < sdHeaderSize || off >= len(b)) {
+			return 0, errInvalidSecurityDescriptor
+		}
+		return off, nil
+	}
+	var err error
+	for i, sid := range []**SID{&sd.Owner, &sd.Group} {
+		off, oerr := offset(i)
+		if oerr != nil {
+			return nil, oerr
+		}
+		if off != 0 {
+			if *sid, _, err = decodeSid(b[off:]); err != nil {
+				return nil, errInvalidSecurityDescriptor
+			}
+		}
+	}
+	for i, acl := range []struct {
+		present Control
+		acl     **ACL
+	}{{ControlSACLPresent, &sd.SACL}, {ControlDACLPresent, &sd.DACL}} {
+		off, oerr := offset(2 + i)
+		if oerr != nil {
+			return nil, oerr
+		}
+		if off != 0 && sd.Control&acl.present != 0 {
+			if *acl.acl, err = decodeACL(b[off:]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return sd, nil
+}
+
+// Bytes returns the security descriptor in self-relative binary form.
+func (sd *SecurityDescriptor) Bytes() ([]byte, error) {
+	n := sdHeaderSize
+	for _, sid := range []*SID{sd.Owner, sd.Group} {
+		if sid != nil {
+			if !sid.valid() {
+				return nil, errInvalidSid
+			}
+			n += sid.Len()
+		}
+	}
+	for _, acl := range []*ACL{sd.SACL, sd.DACL} {
+		if acl != nil {
+			n += acl.Len()
+		}
+	}
+	b := make([]byte, n)
+	control := sd.Control | ControlSelfRelative
+	b[0] = sdRevision
+	b[1] = sd.RMControl
+	off := sdHeaderSize
+	// Lay out the parts in the same order as MakeSelfRelativeSD.
+	for i, acl := range []struct {
+		present Control
+		acl     *ACL
+	}{{ControlSACLPresent, sd.SACL}, {ControlDACLPresent, sd.DACL}} {
+		if acl.acl != nil {
+			control |= acl.present
+			binary.LittleEndian.PutUint32(b[12+4*i:], uint32(off))
+			n := acl.acl.Len()
+			if err := acl.acl.put(b[off : off+n]); err != nil {
+				return nil, err
+			}
+			off += n
+		}
+	}
+	for i, sid := range []*SID{sd.Owner, sd.Group} {
+		if sid != nil {
+			binary.LittleEndian.PutUint32(b[4+4*i:], uint32(off))
+			sid.put(b[off:])
+			off += sid.Len()
+		}
+	}
+	binary.LittleEndian.PutUint16(b[2:4], uint16(control))
+	return b, nil
+}
+
+// SddlToSecurityDescriptor converts a security descriptor in SDDL form to
+// self-relative binary form, as laid out by Windows.
+func SddlToSecurityDescriptor(sddl string) ([]byte, error) {
+	var p *byte
+	err := convertStringSecurityDescriptorToSecurityDescriptor(sddl, sdRevision, &p, nil)
+	if err != nil {
+		return nil, &SddlConversionError{sddl, err}
+	}
+	return copyLocalSecurityDescriptor(p), nil
+}
+
+// SecurityDescriptorToSddl converts a security descriptor in self-relative binary form
+// to SDDL form, including the SACL entries, such as the mandatory label and resource
+// attributes, that are selected separately from the rest of the SACL.
+func SecurityDescriptorToSddl(b []byte) (string, error) {
+	var sddl *uint16
+	err := convertSecurityDescriptorToStringSecurityDescriptor(&b[0], sdRevision, allSecurityInformation, &sddl, nil)
+	if err != nil {
+		return "", err
+	}
+	defer localFree(uintptr(unsafe.Pointer(sddl)))
+	return syscall.UTF16ToString((*[1 << 29]uint16)(unsafe.Pointer(sddl))[:]), nil
+}
+
+// ParseSDDL parses a security descriptor in SDDL form.
+func ParseSDDL(sddl string) (*SecurityDescriptor, error) {
+	b, err := SddlToSecurityDescriptor(sddl)
+	if err != nil {
+		return nil, err
+	}
+	sd, err := ParseSecurityDescriptor(b)
+	if err != nil {
+		return nil, &SddlConversionError{sddl, err}
+	}
+	return sd, nil
+}
+
+// copyLocalSecurityDescriptor copies and frees a self-relative security descriptor
+// allocated with LocalAlloc.
+func copyLocalSecurityDescriptor(p *byte) []byte {
+	defer localFree(uintptr(unsafe.Pointer(p)))
+	n := getSecurityDescriptorLength(p)
+	b := make([]byte, n)
+	copy(b, (*[1 << 30]byte)(unsafe.Pointer(p))[:n:n])
+	return b
+}
+
+// parseLocalSecurityDescriptor parses and frees a self-relative security descriptor
+// allocated with LocalAlloc.
+func parseLocalSecurityDescriptor(p *byte) (*SecurityDescriptor, error) {
+	return ParseSecurityDescriptor(copyLocalSecurityDescriptor(p))
+}
+
+// SDDL returns the security descriptor in SDDL form.
+func (sd *SecurityDescriptor) SDDL() (string, error) {
+	b, err := sd.Bytes()
+	if err != nil {
+		return "", err
+	}
+	s, err := SecurityDescriptorToSddl(b)
+	if err != nil {
+		return "", &SddlConversionError{"security descriptor", err}
+	}
+	return s, nil
+}
+
+// SddlConversionError is returned when a security descriptor cannot be converted to or
+// from SDDL.
+type SddlConversionError struct {
+	Sddl string
+	Err  error
+}
+
+func (e *SddlConversionError) Error() string {
+	return "convert " + e.Sddl + ": " + e.Err.Error()
+}
@@ -0,0 +1,105 @@
+package security
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSDDLRoundTrip(t *testing.T) {
+	for _, sddl := range []string{
+		"O:BAG:SYD:PAI(A;OICI;FA;;;SY)(A;OICI;FA;;;BA)(A;;FR;;;WD)",
+		"D:(D;;FW;;;AN)(A;;GA;;;BU)",
+		"D:NO_ACCESS_CONTROL",
+		"O:SYD:(OA;;CR;ab721a53-1e2f-11d0-9819-00aa0040529b;;WD)",
+		"D:(XA;;FR;;;WD;(Member_of {SID(BA)}))S:(ML;;NW;;;LW)",
+	} {
+		sd, err := ParseSDDL(sddl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, err := sd.SDDL()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s != sddl {
+			t.Errorf("expected %s, got %s", sddl, s)
+		}
+		b, err := sd.Bytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		sd2, err := ParseSecurityDescriptor(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b2, err := sd2.Bytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b, b2) {
+			t.Errorf("%s: binary round trip changed the descriptor", sddl)
+		}
+	}
+}
+
+func TestParseSecurityDescriptorFields(t *testing.T) {
+	sd, err := ParseSDDL("O:BAG:SYD:P(A;OICI;FA;;;SY)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sd.Owner.String() != "S-1-5-32-544" || sd.Group.String() != "S-1-5-18" {
+		t.Fatalf("unexpected owner %s and group %s", sd.Owner, sd.Group)
+	}
+	if sd.Control&ControlDACLProtected == 0 || sd.SACL != nil {
+		t.Fatalf("unexpected control %#x", sd.Control)
+	}
+	if len(sd.DACL.ACEs) != 1 {
+		t.Fatalf("expected 1 ACE, got %d", len(sd.DACL.ACEs))
+	}
+	ace := sd.DACL.ACEs[0]
+	if ace.Type != AccessAllowedACE || ace.Flags != ObjectInheritACE|ContainerInheritACE || ace.Mask != FileAllAccess || ace.SID.String() != "S-1-5-18" {
+		t.Fatalf("unexpected ACE %+v", ace)
+	}
+	if _, err := ParseSecurityDescriptor(make([]byte, 10)); err == nil {
+		t.Fatal("expected error for truncated descriptor")
+	}
+}
+
+func TestEditDACL(t *testing.T) {
+	sd, err := ParseSDDL("D:AI(A;;FA;;;SY)(A;ID;FR;;;BU)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	everyone, _ := ParseSID("S-1-1-0")
+	users, _ := ParseSID("S-1-5-32-545")
+	sd.DACL.AddACE(DenyACE(everyone, FileGenericWrite, 0))
+	sd.DACL.AddACE(AllowACE(users, FileGenericExecute, ObjectInheritACE))
+	if !sd.DACL.IsCanonical() {
+		t.Fatal("expected canonical DACL")
+	}
+	s, err := sd.SDDL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "D:AI(D;;FW;;;WD)(A;;FA;;;SY)(A;OI;FX;;;BU)(A;ID;FR;;;BU)"
+	if s != expected {
+		t.Fatalf("expected %s, got %s", expected, s)
+	}
+	if n := sd.DACL.RemoveSID(users); n != 1 {
+		t.Fatalf("expected to remove 1 ACE, removed %d", n)
+	}
+
+	sd.DACL.ACEs = append(sd.DACL.ACEs, DenyACE(users, FileGenericWrite, 0))
+	if sd.DACL.IsCanonical() {
+		t.Fatal("expected non-canonical DACL")
+	}
+	sd.DACL.Canonicalize()
+	s, err = sd.SDDL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = "D:AI(D;;FW;;;WD)(D;;FW;;;BU)(A;;FA;;;SY)(A;ID;FR;;;BU)"
+	if s != expected {
+		t.Fatalf("expected %s, got %s", expected, s)
+	}
+}
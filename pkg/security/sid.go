@@ -0,0 +1,149 @@
+package security
+
+import (
+	"encoding/binary"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+const (
+	sidRevision         = 1
+	maxSubAuthorities   = 15
+	sidHeaderSize       = 8
+	maxDecimalAuthority = 1<<32 - 1
+)
+
+var errInvalidSid = errors.New("invalid SID")
+
+// SID is a security identifier, which identifies a user, group, or other security
+// principal.
+type SID struct {
+	// IdentifierAuthority is the 48-bit top-level authority that issued the SID, such
+	// as 5 for the NT authority.
+	IdentifierAuthority uint64
+	// SubAuthorities are the relative identifiers that follow the authority. The last
+	// one is typically the RID of the principal within its domain.
+	SubAuthorities []uint32
+}
+
+// ParseSID parses a SID in string form, such as S-1-5-32-544.
+func ParseSID(s string) (*SID, error) {
+	parts := strings.Split(s, "-")
+	if len(parts) < 3 || !strings.EqualFold(parts[0], "S") || parts[1] != "1" || len(parts)-3 > maxSubAuthorities {
+		return nil, &SidError{s, errInvalidSid}
+	}
+	var (
+		sid SID
+		err error
+	)
+	if strings.HasPrefix(parts[2], "0x") || strings.HasPrefix(parts[2], "0X") {
+		sid.IdentifierAuthority, err = strconv.ParseUint(parts[2][2:], 16, 48)
+	} else {
+		sid.IdentifierAuthority, err = strconv.ParseUint(parts[2], 10, 32)
+	}
+	if err != nil {
+		return nil, &SidError{s, errInvalidSid}
+	}
+	for _, p := range parts[3:] {
+		v, err := strconv.ParseUint(p, 10, 32)
+		if err != nil {
+			return nil, &SidError{s, errInvalidSid}
+		}
+		sid.SubAuthorities = append(sid.SubAuthorities, uint32(v))
+	}
+	return &sid, nil
+}
+
+// SidFromBytes decodes a SID in binary form. Any bytes following the SID are ignored.
+func SidFromBytes(b []byte) (*SID, error) {
+	sid, _, err := decodeSid(b)
+	return sid, err
+}
+
+// decodeSid decodes a binary SID and returns its length.
+func decodeSid(b []byte) (*SID, int, error) {
+	if len(b) < sidHeaderSize || b[0] != sidRevision || b[1] > maxSubAuthorities {
+		return nil, 0, errInvalidSid
+	}
+	n := sidHeaderSize + 4*int(b[1])
+	if len(b) < n {
+		return nil, 0, errInvalidSid
+	}
+	var sid SID
+	for _, c := range b[2:8] {
+		sid.IdentifierAuthority = sid.IdentifierAuthority<<8 | uint64(c)
+	}
+	sid.SubAuthorities = make([]uint32, b[1])
+	for i := range sid.SubAuthorities {
+		sid.SubAuthorities[i] = binary.LittleEndian.Uint32(b[sidHeaderSize+4*i:])
+	}
+	return &sid, n, nil
+}
+
+// Len returns the length of the SID in binary form.
+func (sid *SID) Len() int {
+	return sidHeaderSize + 4*len(sid.SubAuthorities)
+}
+
+// Bytes returns the SID in binary form.
+func (sid *SID) Bytes() []byte {
+	b := make([]byte, sid.Len())
+	sid.put(b)
+	return b
+}
+
+func (sid *SID) put(b []byte) {
+	b[0] = sidRevision
+	b[1] = uint8(len(sid.SubAuthorities))
+	for i := 0; i < 6; i++ {
+		b[7-i] = uint8(sid.IdentifierAuthority >> (8 * uint(i)))
+	}
+	for i, v := range sid.SubAuthorities {
+		binary.LittleEndian.PutUint32(b[sidHeaderSize+4*i:], v)
+	}
+}
+
+func (sid *SID) valid() bool {
+	return sid.IdentifierAuthority < 1<<48 && len(sid.SubAuthorities) <= maxSubAuthorities
+}
+
+// String returns the SID in string form, such as S-1-5-32-544.
+func (sid *SID) String() string {
+	var b strings.Builder
+	b.WriteString("S-1-")
+	if sid.IdentifierAuthority > maxDecimalAuthority {
+		b.WriteString("0x")
+		b.WriteString(strings.ToUpper(strconv.FormatUint(sid.IdentifierAuthority, 16)))
+	} else {
+		b.WriteString(strconv.FormatUint(sid.IdentifierAuthority, 10))
+	}
+	for _, v := range sid.SubAuthorities {
+		b.WriteByte('-')
+		b.WriteString(strconv.FormatUint(uint64(v), 10))
+	}
+	return b.String()
+}
+
+// Equal reports whether sid and other are the same SID.
+func (sid *SID) Equal(other *SID) bool {
+	if sid.IdentifierAuthority != other.IdentifierAuthority || len(sid.SubAuthorities) != len(other.SubAuthorities) {
+		return false
+	}
+	for i := range sid.SubAuthorities {
+		if sid.SubAuthorities[i] != other.SubAuthorities[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// SidError is returned when a SID cannot be parsed or converted.
+type SidError struct {
+	Sid string
+	Err error
+}
+
+func (e *SidError) Error() string {
+	return "SID " + e.Sid + ": " + e.Err.Error()
+}
@@ -0,0 +1,44 @@
+package security
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSidRoundTrip(t *testing.T) {
+	for _, s := range []string{"S-1-1-0", "S-1-5-32-544", "S-1-5-21-1004336348-1177238915-682003330-512", "S-1-0x123456789ABC-1"} {
+		sid, err := ParseSID(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sid.String() != s {
+			t.Errorf("expected %s, got %s", s, sid)
+		}
+		b := sid.Bytes()
+		if len(b) != sid.Len() {
+			t.Fatalf("%s: expected %d bytes, got %d", s, sid.Len(), len(b))
+		}
+		sid2, err := SidFromBytes(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !sid.Equal(sid2) || !bytes.Equal(sid2.Bytes(), b) {
+			t.Errorf("%s: binary round trip gave %s", s, sid2)
+		}
+	}
+	admins, _ := ParseSID("S-1-5-32-544")
+	if !bytes.Equal(admins.Bytes(), []byte{1, 2, 0, 0, 0, 0, 0, 5, 32, 0, 0, 0, 0x20, 2, 0, 0}) {
+		t.Errorf("unexpected encoding %x", admins.Bytes())
+	}
+}
+
+func TestParseInvalidSid(t *testing.T) {
+	for _, s := range []string{"", "S-1", "S-2-5-32", "S-1-5-x", "X-1-5", "S-1-5-4294967296"} {
+		if _, err := ParseSID(s); err == nil {
+			t.Errorf("%q: expected error", s)
+		}
+	}
+	if _, err := SidFromBytes([]byte{1, 2, 0, 0, 0, 0, 0, 5, 32, 0, 0, 0}); err == nil {
+		t.Error("expected error for truncated SID")
+	}
+}
@@ -0,0 +1,3 @@
+package security
+
+//go:generate go run $GOROOT/src/syscall/mksyscall_windows.go -output zsyscall.go accesscheck.go account.go named.go sd.go
@@ -0,0 +1,262 @@
+package security
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+const cSE_GROUP_LOGON_ID = 0xc0000000
+
+var errNoLogonSid = errors.New("token has no logon SID")
+
+type sidAndAttributes struct {
+	Sid        *byte
+	Attributes uint32
+}
+
+type tokenGroups struct {
+	GroupCount uint32
+	Groups     [1]sidAndAttributes
+}
+
+// getTokenInfo returns the information of the given class for token.
+func getTokenInfo(token windows.Token, class uint32) ([]byte, error) {
+	n := uint32(256)
+	for {
+		b := make([]byte, n)
+		err := windows.GetTokenInformation(token, class, &b[0], n, &n)
+		if err == nil {
+			return b[:n], nil
+		}
+		if err != syscall.ERROR_INSUFFICIENT_BUFFER {
+			return nil, err
+		}
+	}
+}
+
+// sidAt decodes a SID at p, which points into a buffer returned by the system.
+func sidAt(p *byte) *SID {
+	n := sidHeaderSize + 4*int((*[2]byte)(unsafe.Pointer(p))[1])
+	sid, _, _ := decodeSid((*[sidHeaderSize + 4*maxSubAuthorities]byte)(unsafe.Pointer(p))[:n:n])
+	return sid
+}
+
+// GroupAttributes holds the SE_GROUP_* attributes of a group in a token.
+type GroupAttributes uint32
+
+// Group attributes.
+const (
+	GroupMandatory        GroupAttributes = 0x1
+	GroupEnabledByDefault GroupAttributes = 0x2
+	GroupEnabled          GroupAttributes = 0x4
+	GroupOwner            GroupAttributes = 0x8
+	GroupUseForDenyOnly   GroupAttributes = 0x10
+	GroupIntegrity        GroupAttributes = 0x20
+	GroupIntegrityEnabled GroupAttributes = 0x40
+	GroupResource         GroupAttributes = 0x20000000
+	GroupLogonID          GroupAttributes = cSE_GROUP_LOGON_ID
+)
+
+// Group is a group in a token.
+type Group struct {
+	SID        *SID
+	Attributes GroupAttributes
+}
+
+// IntegrityLevel is the mandatory integrity level of a token, which is the RID of its
+// mandatory label SID.
+type IntegrityLevel uint32
+
+// Integrity levels.
+const (
+	UntrustedIntegrity  IntegrityLevel = 0x0
+	LowIntegrity        IntegrityLevel = 0x1000
+	MediumIntegrity     IntegrityLevel = 0x2000
+	MediumPlusIntegrity IntegrityLevel = 0x2100
+	HighIntegrity       IntegrityLevel = 0x3000
+	SystemIntegrity     IntegrityLevel = 0x4000
+	ProtectedIntegrity  IntegrityLevel = 0x5000
+)
+
+// ElevationType describes how a token relates to User Account Control.
+type ElevationType uint32
+
+const (
+	// ElevationDefault is the type of tokens of users that are not subject to UAC,
+	// such as standard users and the built-in Administrator.
+	ElevationDefault ElevationType = 1
+	// ElevationFull is the type of the elevated token of a UAC-filtered administrator.
+	ElevationFull ElevationType = 2
+	// ElevationLimited is the type of the filtered token of a UAC-filtered
+	// administrator.
+	ElevationLimited ElevationType = 3
+)
+
+const (
+	tokenUserClass            = 1
+	tokenGroupsClass          = 2
+	tokenElevationTypeClass   = 18
+	tokenElevationClass       = 20
+	tokenIntegrityLevelClass  = 25
+	tokenIsAppContainerClass  = 29
+	tokenAppContainerSidClass = 31
+)
+
+func tokenError(err error) error {
+	return &os.SyscallError{Syscall: "GetTokenInformation", Err: err}
+}
+
+func getTokenUint32(token windows.Token, class uint32) (uint32, error) {
+	b, err := getTokenInfo(token, class)
+	if err != nil {
+		return 0, tokenError(err)
+	}
+	if len(b) < 4 {
+		return 0, tokenError(syscall.EINVAL)
+	}
+	return *(*uint32)(unsafe.Pointer(&b[0])), nil
+}
+
+// getTokenSid returns the SID at the start of a structure, such as TOKEN_USER, whose
+// first field points to a SID.
+func getTokenSid(token windows.Token, class uint32) (*SID, error) {
+	b, err := getTokenInfo(token, class)
+	if err != nil {
+		return nil, tokenError(err)
+	}
+	p := (*sidAndAttributes)(unsafe.Pointer(&b[0])).Sid
+	if p == nil {
+		return nil, nil
+	}
+	return sidAt(p), nil
+}
+
+// TokenUser returns the SID of the user of token. token must have been opened with
+// TOKEN_QUERY access, as must the tokens passed to the other functions that query
+// tokens.
+func TokenUser(token windows.Token) (*SID, error) {
+	return getTokenSid(token, tokenUserClass)
+}
+
+// TokenGroups returns the groups of token, including deny-only groups and its logon
+// SID.
+func TokenGroups(token windows.Token) ([]Group, error) {
+	b, err := getTokenInfo(token, tokenGroupsClass)
+	if err != nil {
+		return nil, tokenError(err)
+	}
+	sids, attrs := tokenGroupSids(b)
+	groups := make([]Group, len(sids))
+	for i := range sids {
+		groups[i] = Group{SID: sids[i], Attributes: GroupAttributes(attrs[i])}
+	}
+	return groups, nil
+}
+
+// TokenIntegrityLevel returns the integrity level of token.
+func TokenIntegrityLevel(token windows.Token) (IntegrityLevel, error) {
+	sid, err := getTokenSid(token, tokenIntegrityLevelClass)
+	if err != nil {
+		return 0, err
+	}
+	if sid == nil || len(sid.SubAuthorities) == 0 {
+		return 0, tokenError(syscall.EINVAL)
+	}
+	return IntegrityLevel(sid.SubAuthorities[len(sid.SubAuthorities)-1]), nil
+}
+
+// TokenIsElevated reports whether token is elevated, that is, whether it has
+// administrator rights that are not filtered by User Account Control.
+func TokenIsElevated(token windows.Token) (bool, error) {
+	v, err := getTokenUint32(token, tokenElevationClass)
+	return v != 0, err
+}
+
+// TokenElevationType returns the elevation type of token.
+func TokenElevationType(token windows.Token) (ElevationType, error) {
+	v, err := getTokenUint32(token, tokenElevationTypeClass)
+	return ElevationType(v), err
+}
+
+// TokenAppContainerSID returns the SID of the app container of token, or nil if token
+// is not running in an app container.
+func TokenAppContainerSID(token windows.Token) (*SID, error) {
+	v, err := getTokenUint32(token, tokenIsAppContainerClass)
+	if err != nil || v == 0 {
+		return nil, err
+	}
+	return getTokenSid(token, tokenAppContainerSidClass)
+}
+
+// TokenInfo summarizes the identity of a token.
+type TokenInfo struct {
+	User           *SID
+	Groups         []Group
+	IntegrityLevel IntegrityLevel
+	Elevated       bool
+	ElevationType  ElevationType
+	// AppContainer is the SID of the token's app container, or nil.
+	AppContainer *SID
+}
+
+// QueryTokenInfo returns the identity of token, as returned by TokenUser, TokenGroups,
+// TokenIntegrityLevel, TokenIsElevated, TokenElevationType, and TokenAppContainerSID.
+func QueryTokenInfo(token windows.Token) (*TokenInfo, error) {
+	var (
+		info TokenInfo
+		err  error
+	)
+	if info.User, err = TokenUser(token); err != nil {
+		return nil, err
+	}
+	if info.Groups, err = TokenGroups(token); err != nil {
+		return nil, err
+	}
+	if info.IntegrityLevel, err = TokenIntegrityLevel(token); err != nil {
+		return nil, err
+	}
+	if info.Elevated, err = TokenIsElevated(token); err != nil {
+		return nil, err
+	}
+	if info.ElevationType, err = TokenElevationType(token); err != nil {
+		return nil, err
+	}
+	if info.AppContainer, err = TokenAppContainerSID(token); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// tokenGroupSids returns the SIDs and attributes of the groups in a TOKEN_GROUPS
+// buffer.
+func tokenGroupSids(b []byte) ([]*SID, []uint32) {
+	tg := (*tokenGroups)(unsafe.Pointer(&b[0]))
+	groups := (*[1 << 20]sidAndAttributes)(unsafe.Pointer(&tg.Groups[0]))[:tg.GroupCount:tg.GroupCount]
+	sids := make([]*SID, len(groups))
+	attrs := make([]uint32, len(groups))
+	for i, g := range groups {
+		sids[i] = sidAt(g.Sid)
+		attrs[i] = g.Attributes
+	}
+	return sids, attrs
+}
+
+// LogonSID returns the logon SID of token, S-1-5-5-X-Y, which identifies the logon
+// session of the token and is commonly granted access to objects that should only be
+// accessible within that session.
+func LogonSID(token windows.Token) (*SID, error) {
+	groups, err := TokenGroups(token)
+	if err != nil {
+		return nil, err
+	}
+	for _, g := range groups {
+		if g.Attributes&GroupLogonID == GroupLogonID {
+			return g.SID, nil
+		}
+	}
+	return nil, errNoLogonSid
+}
@@ -0,0 +1,45 @@
+package security
+
+import (
+	"testing"
+
+	"golang.org/x/sys/windows"
+)
+
+func TestQueryTokenInfo(t *testing.T) {
+	token, err := windows.OpenCurrentProcessToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer token.Close()
+	info, err := QueryTokenInfo(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	name, _, _, err := LookupAccountSid(info.User)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name == "" {
+		t.Fatalf("no account name for %s", info.User)
+	}
+	everyone := Everyone.SID()
+	found := false
+	for _, g := range info.Groups {
+		if g.SID.Equal(everyone) && g.Attributes&GroupEnabled != 0 {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatal("token is not a member of Everyone")
+	}
+	if info.IntegrityLevel < LowIntegrity || info.IntegrityLevel > SystemIntegrity {
+		t.Fatalf("unexpected integrity level %#x", info.IntegrityLevel)
+	}
+	if info.Elevated != (info.ElevationType == ElevationFull) && info.ElevationType != ElevationDefault {
+		t.Fatalf("elevated %v with elevation type %d", info.Elevated, info.ElevationType)
+	}
+	if info.AppContainer != nil {
+		t.Fatalf("unexpected app container %s", info.AppContainer)
+	}
+}
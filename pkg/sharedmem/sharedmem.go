@@ -0,0 +1,282 @@
+// Package sharedmem shares memory between processes through named file mappings
+// backed by the page file, with a pair of named events to signal between them.
+package sharedmem
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"runtime"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+
+	winio "github.com/Microsoft/go-winio"
+)
+
+//sys createFileMapping(file syscall.Handle, sa *syscall.SecurityAttributes, protect uint32, maxSizeHigh uint32, maxSizeLow uint32, name *uint16) (h syscall.Handle, err error) [failretval==0 || e1==syscall.ERROR_ALREADY_EXISTS] = CreateFileMappingW
+//sys openFileMapping(access uint32, inheritHandle bool, name *uint16) (h syscall.Handle, err error) = OpenFileMappingW
+//sys mapViewOfFile(mapping syscall.Handle, access uint32, offsetHigh uint32, offsetLow uint32, length uintptr) (addr uintptr, err error) = MapViewOfFile
+//sys unmapViewOfFile(addr uintptr) (err error) = UnmapViewOfFile
+//sys virtualQuery(addr uintptr, info *memoryBasicInformation, length uintptr) (n uintptr, err error) [failretval==0] = VirtualQuery
+//sys createEvent(sa *syscall.SecurityAttributes, manualReset bool, initialState bool, name *uint16) (h syscall.Handle, err error) [failretval==0 || e1==syscall.ERROR_ALREADY_EXISTS] = CreateEventW
+//sys openEvent(access uint32, inheritHandle bool, name *uint16) (h syscall.Handle, err error) = OpenEventW
+//sys setEvent(h syscall.Handle) (err error) = SetEvent
+//sys waitForMultipleObjects(count uint32, handles *syscall.Handle, waitAll bool, timeout uint32) (event uint32, err error) [failretval==0xffffffff] = WaitForMultipleObjects
+
+const (
+	cPAGE_READWRITE     = 0x4
+	cFILE_MAP_WRITE     = 0x2
+	cFILE_MAP_READ      = 0x4
+	cEVENT_MODIFY_STATE = 0x2
+	cSYNCHRONIZE        = 0x100000
+	cWAIT_TIMEOUT       = 0x102
+	maxRegionSize       = 1 << 30
+	creatorEventSuffix  = "-to-creator"
+	openerEventSuffix   = "-to-opener"
+)
+
+// ErrClosed is returned by the methods of a Region once it has been closed.
+var ErrClosed = errors.New("shared memory region has been closed")
+
+type memoryBasicInformation struct {
+	BaseAddress       uintptr
+	AllocationBase    uintptr
+	AllocationProtect uint32
+	RegionSize        uintptr
+	State             uint32
+	Protect           uint32
+	Type              uint32
+}
+
+// Config contains configuration for a shared memory region.
+type Config struct {
+	// SecurityDescriptor contains a Windows security descriptor in SDDL format that
+	// controls access to the file mapping and its events. If it is empty, the default
+	// security descriptor of the caller's token applies.
+	SecurityDescriptor string
+}
+
+// Region is a shared memory region mapped into this process, together with the
+// events used to signal the processes on either end of it.
+//
+// A region named name is a file mapping called name, so native code can open it with
+// OpenFileMapping. The events are called name+"-to-creator", which the creator of the
+// region waits on, and name+"-to-opener", which the processes that open it wait on.
+// Both are auto-reset events. Names are local to the caller's session unless they
+// start with Global\, which requires the SeCreateGlobalPrivilege to create.
+type Region struct {
+	name    string
+	mapping syscall.Handle
+	addr    uintptr
+	buf     []byte
+	recv    syscall.Handle
+	send    syscall.Handle
+	closeEv syscall.Handle
+
+	m       sync.Mutex
+	closing bool
+	wg      sync.WaitGroup
+}
+
+// Create creates a shared memory region of size bytes, zero filled, called name. It
+// fails with an error satisfying os.IsExist if an object of that name already exists.
+func Create(name string, size int, c *Config) (*Region, error) {
+	if size <= 0 || size > maxRegionSize {
+		return nil, &os.PathError{Op: "create", Path: name, Err: syscall.EINVAL}
+	}
+	if c == nil {
+		c = &Config{}
+	}
+	var sa *syscall.SecurityAttributes
+	if c.SecurityDescriptor != "" {
+		sd, err := winio.SddlToSecurityDescriptor(c.SecurityDescriptor)
+		if err != nil {
+			return nil, err
+		}
+		// sa refers to sd by address, so sd must outlive the calls that use sa.
+		defer runtime.KeepAlive(sd)
+		sa = &syscall.SecurityAttributes{SecurityDescriptor: uintptr(unsafe.Pointer(&sd[0]))}
+		sa.Length = uint32(unsafe.Sizeof(*sa))
+	}
+	name16, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		return nil, err
+	}
+	r := &Region{name: name}
+	r.mapping, err = createFileMapping(syscall.InvalidHandle, sa, cPAGE_READWRITE, uint32(uint64(size)>>32), uint32(size), name16)
+	if err != nil {
+		if r.mapping != 0 {
+			syscall.CloseHandle(r.mapping)
+		}
+		return nil, &os.PathError{Op: "CreateFileMapping", Path: name, Err: err}
+	}
+	if err := r.init(size, func(suffix string) (syscall.Handle, error) {
+		n, err := syscall.UTF16PtrFromString(name + suffix)
+		if err != nil {
+			return 0, err
+		}
+		h, err := createEvent(sa, false, false, n)
+		if err != nil && h != 0 {
+			syscall.CloseHandle(h)
+			h = 0
+		}
+		return h, err
+	}, creatorEventSuffix, openerEventSuffix); err != nil {
+		return nil, &os.PathError{Op: "create", Path: name, Err: err}
+	}
+	return r, nil
+}
+
+// Open opens the shared memory region called name, which was created by Create or by
+// native code that follows the same conventions. Since the system only records the
+// size of a mapping in pages, the region has the size of the mapping rounded up to a
+// whole number of pages.
+func Open(name string) (*Region, error) {
+	name16, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		return nil, err
+	}
+	r := &Region{name: name}
+	r.mapping, err = openFileMapping(cFILE_MAP_READ|cFILE_MAP_WRITE, false, name16)
+	if err != nil {
+		return nil, &os.PathError{Op: "OpenFileMapping", Path: name, Err: err}
+	}
+	if err := r.init(0, func(suffix string) (syscall.Handle, error) {
+		n, err := syscall.UTF16PtrFromString(name + suffix)
+		if err != nil {
+			return 0, err
+		}
+		return openEvent(cEVENT_MODIFY_STATE|cSYNCHRONIZE, false, n)
+	}, openerEventSuffix, creatorEventSuffix); err != nil {
+		return nil, &os.PathError{Op: "open", Path: name, Err: err}
+	}
+	return r, nil
+}
+
+// init maps the view of r.mapping, which is closed on failure, and gets the events
+// with the given suffixes. A size of zero maps the whole mapping.
+func (r *Region) init(size int, event func(suffix string) (syscall.Handle, error), recvSuffix, sendSuffix string) (err error) {
+	defer func() {
+		if err != nil {
+			r.release()
+		}
+	}()
+	r.addr, err = mapViewOfFile(r.mapping, cFILE_MAP_READ|cFILE_MAP_WRITE, 0, 0, uintptr(size))
+	if err != nil {
+		return err
+	}
+	if size == 0 {
+		var info memoryBasicInformation
+		if _, err := virtualQuery(r.addr, &info, unsafe.Sizeof(info)); err != nil {
+			return err
+		}
+		if info.RegionSize > maxRegionSize {
+			return syscall.EINVAL
+		}
+		size = int(info.RegionSize)
+	}
+	hdr := (*reflect.SliceHeader)(unsafe.Pointer(&r.buf))
+	hdr.Data, hdr.Len, hdr.Cap = r.addr, size, size
+	if r.recv, err = event(recvSuffix); err != nil {
+		return err
+	}
+	if r.send, err = event(sendSuffix); err != nil {
+		return err
+	}
+	r.closeEv, err = createEvent(nil, true, false, nil)
+	return err
+}
+
+func (r *Region) release() {
+	if r.addr != 0 {
+		unmapViewOfFile(r.addr)
+		r.addr = 0
+		r.buf = nil
+	}
+	for _, h := range []*syscall.Handle{&r.mapping, &r.recv, &r.send, &r.closeEv} {
+		if *h != 0 {
+			syscall.CloseHandle(*h)
+			*h = 0
+		}
+	}
+}
+
+// Name returns the name of the region.
+func (r *Region) Name() string {
+	return r.name
+}
+
+// Bytes returns the shared memory. Other processes can change it at any time, so
+// access to it must be synchronized, for instance with Signal and Wait. It must not
+// be used once the region has been closed.
+func (r *Region) Bytes() []byte {
+	return r.buf
+}
+
+// Signal wakes a process waiting on the other end of the region: one of the processes
+// that opened it if r was created by Create, or its creator otherwise. The event is
+// auto-reset, so only one waiter wakes even if several processes opened the region. If
+// none is waiting, the next call to Wait on the other end returns immediately;
+// signals are not counted, so several calls before then wake a single Wait.
+func (r *Region) Signal() error {
+	r.m.Lock()
+	defer r.m.Unlock()
+	if r.closing {
+		return ErrClosed
+	}
+	if err := setEvent(r.send); err != nil {
+		return os.NewSyscallError("SetEvent", err)
+	}
+	return nil
+}
+
+// Wait waits until the other end of the region calls Signal, or until timeout has
+// passed, in which case it returns winio.ErrTimeout. A negative timeout waits
+// indefinitely. If the region is closed during the wait, Wait returns ErrClosed.
+func (r *Region) Wait(timeout time.Duration) error {
+	r.m.Lock()
+	if r.closing {
+		r.m.Unlock()
+		return ErrClosed
+	}
+	r.wg.Add(1)
+	r.m.Unlock()
+	defer r.wg.Done()
+
+	ms := uint32(syscall.INFINITE)
+	if timeout >= 0 {
+		ms = uint32((timeout + time.Millisecond - 1) / time.Millisecond)
+		if ms == syscall.INFINITE {
+			ms--
+		}
+	}
+	handles := [2]syscall.Handle{r.recv, r.closeEv}
+	ev, err := waitForMultipleObjects(uint32(len(handles)), &handles[0], false, ms)
+	switch {
+	case err != nil:
+		return os.NewSyscallError("WaitForMultipleObjects", err)
+	case ev == syscall.WAIT_OBJECT_0:
+		return nil
+	case ev == cWAIT_TIMEOUT:
+		return winio.ErrTimeout
+	}
+	return ErrClosed
+}
+
+// Close unmaps the region and closes its events, after waking any calls to Wait. The
+// region itself is destroyed once every process has closed it.
+func (r *Region) Close() error {
+	r.m.Lock()
+	if r.closing {
+		r.m.Unlock()
+		return nil
+	}
+	r.closing = true
+	r.m.Unlock()
+	setEvent(r.closeEv)
+	r.wg.Wait()
+	r.release()
+	return nil
+}
@@ -0,0 +1,100 @@
+package sharedmem
+
+import (
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	winio "github.com/Microsoft/go-winio"
+)
+
+var testCount int
+
+func testName() string {
+	testCount++
+	return "go-winio-sharedmem-" + strconv.Itoa(os.Getpid()) + "-" + strconv.Itoa(testCount)
+}
+
+func TestSharedMemory(t *testing.T) {
+	name := testName()
+	c, err := Create(name, 100, &Config{SecurityDescriptor: "D:P(A;;GA;;;SY)(A;;GA;;;OW)"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if len(c.Bytes()) != 100 {
+		t.Fatalf("size %d, expected 100", len(c.Bytes()))
+	}
+
+	o, err := Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer o.Close()
+	if len(o.Bytes()) < 100 {
+		t.Fatalf("size %d, expected at least 100", len(o.Bytes()))
+	}
+
+	copy(c.Bytes(), "ping")
+	if err := c.Signal(); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.Wait(10 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if s := string(o.Bytes()[:4]); s != "ping" {
+		t.Fatalf("read %q", s)
+	}
+	// The creator's own signal must not wake it.
+	if err := c.Wait(10 * time.Millisecond); err != winio.ErrTimeout {
+		t.Fatalf("expected timeout, got %v", err)
+	}
+
+	copy(o.Bytes(), "pong")
+	if err := o.Signal(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Wait(10 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if s := string(c.Bytes()[:4]); s != "pong" {
+		t.Fatalf("read %q", s)
+	}
+}
+
+func TestCreateExisting(t *testing.T) {
+	name := testName()
+	r, err := Create(name, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if _, err := Create(name, 1, nil); !os.IsExist(err) {
+		t.Fatalf("expected exists error, got %v", err)
+	}
+	if _, err := Open(testName()); !os.IsNotExist(err) {
+		t.Fatalf("expected not exist error, got %v", err)
+	}
+}
+
+func TestCloseDuringWait(t *testing.T) {
+	r, err := Create(testName(), 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch := make(chan error)
+	go func() {
+		ch <- r.Wait(-1)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-ch; err != ErrClosed {
+		t.Fatalf("expected ErrClosed, got %v", err)
+	}
+	if err := r.Signal(); err != ErrClosed {
+		t.Fatalf("expected ErrClosed, got %v", err)
+	}
+}
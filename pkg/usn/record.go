@@ -0,0 +1,157 @@
+package usn
+
+import (
+	"encoding/binary"
+	"errors"
+	"syscall"
+	"time"
+	"unicode/utf16"
+)
+
+const (
+	recordV2HeaderSize = 60
+	recordV3HeaderSize = 76
+	recordV4HeaderSize = 64
+	recordExtentSize   = 16
+)
+
+var errInvalidRecord = errors.New("invalid USN record")
+
+// Usn is an update sequence number, the offset of a record in the change journal.
+type Usn int64
+
+// FileID is a 128-bit file identifier. Version 2 records contain 64-bit file
+// reference numbers, which are stored in the low 8 bytes.
+type FileID [16]byte
+
+// FileIDFromReference returns the FileID of a 64-bit NTFS file reference number.
+func FileIDFromReference(ref uint64) FileID {
+	var id FileID
+	binary.LittleEndian.PutUint64(id[:], ref)
+	return id
+}
+
+// Reference returns the 64-bit file reference number in id, and whether id fits in 64
+// bits.
+func (id FileID) Reference() (uint64, bool) {
+	return binary.LittleEndian.Uint64(id[:8]), binary.LittleEndian.Uint64(id[8:]) == 0
+}
+
+// Extent is a range of a file that was modified, as reported by version 4 records.
+type Extent struct {
+	Offset int64
+	Length int64
+}
+
+// Record is a decoded USN_RECORD_V2, USN_RECORD_V3, or USN_RECORD_V4.
+type Record struct {
+	MajorVersion uint16
+	MinorVersion uint16
+	FileID       FileID
+	ParentFileID FileID
+	Usn          Usn
+	Reason       uint32
+	SourceInfo   uint32
+
+	// TimeStamp, SecurityID, FileAttributes, and FileName are not present in
+	// version 4 records.
+	TimeStamp      time.Time
+	SecurityID     uint32
+	FileAttributes uint32
+	FileName       string
+
+	// RemainingExtents and Extents are only present in version 4 records.
+	RemainingExtents uint32
+	Extents          []Extent
+}
+
+func decodeName(b []byte, offset int, length int) (string, error) {
+	if offset+length > len(b) || length%2 != 0 {
+		return "", errInvalidRecord
+	}
+	name16 := make([]uint16, length/2)
+	for i := range name16 {
+		name16[i] = binary.LittleEndian.Uint16(b[offset+i*2:])
+	}
+	return string(utf16.Decode(name16)), nil
+}
+
+func decodeTime(t uint64) time.Time {
+	ft := syscall.Filetime{LowDateTime: uint32(t), HighDateTime: uint32(t >> 32)}
+	return time.Unix(0, ft.Nanoseconds())
+}
+
+// parseRecord decodes the record at the start of b and returns its length. The record
+// is nil if its version is not supported.
+func parseRecord(b []byte) (*Record, int, error) {
+	if len(b) < 8 {
+		return nil, 0, errInvalidRecord
+	}
+	length := int(binary.LittleEndian.Uint32(b[0:4]))
+	if length < 8 || length > len(b) {
+		return nil, 0, errInvalidRecord
+	}
+	b = b[:length]
+	r := &Record{
+		MajorVersion: binary.LittleEndian.Uint16(b[4:6]),
+		MinorVersion: binary.LittleEndian.Uint16(b[6:8]),
+	}
+	var err error
+	switch r.MajorVersion {
+	case 2:
+		if length < recordV2HeaderSize {
+			return nil, 0, errInvalidRecord
+		}
+		r.FileID = FileIDFromReference(binary.LittleEndian.Uint64(b[8:16]))
+		r.ParentFileID = FileIDFromReference(binary.LittleEndian.Uint64(b[16:24]))
+		r.Usn = Usn(binary.LittleEndian.Uint64(b[24:32]))
+		r.TimeStamp = decodeTime(binary.LittleEndian.Uint64(b[32:40]))
+		r.Reason = binary.LittleEndian.Uint32(b[40:44])
+		r.SourceInfo = binary.LittleEndian.Uint32(b[44:48])
+		r.SecurityID = binary.LittleEndian.Uint32(b[48:52])
+		r.FileAttributes = binary.LittleEndian.Uint32(b[52:56])
+		r.FileName, err = decodeName(b, int(binary.LittleEndian.Uint16(b[58:60])), int(binary.LittleEndian.Uint16(b[56:58])))
+	case 3:
+		if length < recordV3HeaderSize {
+			return nil, 0, errInvalidRecord
+		}
+		copy(r.FileID[:], b[8:24])
+		copy(r.ParentFileID[:], b[24:40])
+		r.Usn = Usn(binary.LittleEndian.Uint64(b[40:48]))
+		r.TimeStamp = decodeTime(binary.LittleEndian.Uint64(b[48:56]))
+		r.Reason = binary.LittleEndian.Uint32(b[56:60])
+		r.SourceInfo = binary.LittleEndian.Uint32(b[60:64])
+		r.SecurityID = binary.LittleEndian.Uint32(b[64:68])
+		r.FileAttributes = binary.LittleEndian.Uint32(b[68:72])
+		r.FileName, err = decodeName(b, int(binary.LittleEndian.Uint16(b[74:76])), int(binary.LittleEndian.Uint16(b[72:74])))
+	case 4:
+		if length < recordV4HeaderSize {
+			return nil, 0, errInvalidRecord
+		}
+		copy(r.FileID[:], b[8:24])
+		copy(r.ParentFileID[:], b[24:40])
+		r.Usn = Usn(binary.LittleEndian.Uint64(b[40:48]))
+		r.Reason = binary.LittleEndian.Uint32(b[48:52])
+		r.SourceInfo = binary.LittleEndian.Uint32(b[52:56])
+		r.RemainingExtents = binary.LittleEndian.Uint32(b[56:60])
+		count := int(binary.LittleEndian.Uint16(b[60:62]))
+		size := int(binary.LittleEndian.Uint16(b[62:64]))
+		if size < recordExtentSize || recordV4HeaderSize+count*size > length {
+			return nil, 0, errInvalidRecord
+		}
+		for i := 0; i < count; i++ {
+			e := b[recordV4HeaderSize+i*size:]
+			r.Extents = append(r.Extents, Extent{
+				Offset: int64(binary.LittleEndian.Uint64(e[0:8])),
+				Length: int64(binary.LittleEndian.Uint64(e[8:16])),
+			})
+		}
+	default:
+		// Let the caller skip records of versions that are not understood.
+		return nil, length, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	return r, length, nil
+}
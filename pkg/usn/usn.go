@@ -0,0 +1,430 @@
+// Package usn reads the NTFS and ReFS update sequence number (USN) change journal.
+package usn
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+)
+
+//sys getCurrentThreadId() (id uint32) = GetCurrentThreadId
+//sys openThread(access uint32, inheritHandle bool, threadID uint32) (h syscall.Handle, err error) = OpenThread
+//sys cancelSynchronousIo(thread syscall.Handle) (err error) = CancelSynchronousIo
+
+const (
+	cFSCTL_ENUM_USN_DATA      = 0x000900b3
+	cFSCTL_READ_USN_JOURNAL   = 0x000900bb
+	cFSCTL_CREATE_USN_JOURNAL = 0x000900e7
+	cFSCTL_QUERY_USN_JOURNAL  = 0x000900f4
+	cFSCTL_DELETE_USN_JOURNAL = 0x000900f8
+
+	cUSN_DELETE_FLAG_DELETE = 0x1
+	cUSN_DELETE_FLAG_NOTIFY = 0x2
+
+	cTHREAD_TERMINATE = 0x1
+
+	cERROR_HANDLE_EOF        = syscall.Errno(38)
+	cERROR_INVALID_NAME      = syscall.Errno(123)
+	cERROR_OPERATION_ABORTED = syscall.Errno(995)
+
+	// Sizes of the USN_JOURNAL_DATA, READ_USN_JOURNAL_DATA_V1, MFT_ENUM_DATA_V1,
+	// CREATE_USN_JOURNAL_DATA, and DELETE_USN_JOURNAL_DATA structures.
+	journalDataV0Size     = 56
+	journalDataV1Size     = 64
+	readJournalDataV1Size = 48
+	enumDataV1Size        = 32
+	createJournalDataSize = 16
+	deleteJournalDataSize = 16
+
+	// Record buffers start with the USN or file reference number to continue from.
+	recordBufferHeaderSize = 8
+
+	readBufferSize = 64 * 1024
+)
+
+// Reasons for a change, as found in Record.Reason.
+const (
+	ReasonDataOverwrite       = 0x00000001
+	ReasonDataExtend          = 0x00000002
+	ReasonDataTruncation      = 0x00000004
+	ReasonNamedDataOverwrite  = 0x00000010
+	ReasonNamedDataExtend     = 0x00000020
+	ReasonNamedDataTruncation = 0x00000040
+	ReasonFileCreate          = 0x00000100
+	ReasonFileDelete          = 0x00000200
+	ReasonEaChange            = 0x00000400
+	ReasonSecurityChange      = 0x00000800
+	ReasonRenameOldName       = 0x00001000
+	ReasonRenameNewName       = 0x00002000
+	ReasonIndexableChange     = 0x00004000
+	ReasonBasicInfoChange     = 0x00008000
+	ReasonHardLinkChange      = 0x00010000
+	ReasonCompressionChange   = 0x00020000
+	ReasonEncryptionChange    = 0x00040000
+	ReasonObjectIDChange      = 0x00080000
+	ReasonReparsePointChange  = 0x00100000
+	ReasonStreamChange        = 0x00200000
+	ReasonTransactedChange    = 0x00400000
+	ReasonIntegrityChange     = 0x00800000
+	ReasonClose               = 0x80000000
+)
+
+var (
+	// ErrJournalNotActive is returned when the volume has no active change journal.
+	ErrJournalNotActive error = syscall.Errno(1179)
+
+	// ErrJournalDeleteInProgress is returned while the change journal is being deleted.
+	ErrJournalDeleteInProgress error = syscall.Errno(1178)
+
+	// ErrJournalEntryDeleted is returned when the requested records have been purged
+	// from the change journal.
+	ErrJournalEntryDeleted error = syscall.Errno(1181)
+)
+
+// JournalData describes the state of a change journal.
+type JournalData struct {
+	ID              uint64
+	FirstUsn        Usn
+	NextUsn         Usn
+	LowestValidUsn  Usn
+	MaxUsn          Usn
+	MaximumSize     uint64
+	AllocationDelta uint64
+
+	// MinSupportedMajorVersion and MaxSupportedMajorVersion are the record versions
+	// supported by the file system. They are zero on systems that do not report them.
+	MinSupportedMajorVersion uint16
+	MaxSupportedMajorVersion uint16
+}
+
+// Journal is an open handle to the change journal of a volume.
+type Journal struct {
+	h      syscall.Handle
+	volume string
+}
+
+// Open opens the change journal of the volume containing path, such as C:\ or
+// \\?\Volume{guid}\. Opening a volume requires administrator rights.
+func Open(path string) (*Journal, error) {
+	v := filepath.VolumeName(path)
+	if v == "" {
+		return nil, &os.PathError{Op: "open", Path: path, Err: cERROR_INVALID_NAME}
+	}
+	if !strings.HasPrefix(v, `\\`) {
+		v = `\\.\` + v
+	}
+	v16, err := syscall.UTF16PtrFromString(v)
+	if err != nil {
+		return nil, err
+	}
+	h, err := syscall.CreateFile(v16, syscall.GENERIC_READ, syscall.FILE_SHARE_READ|syscall.FILE_SHARE_WRITE, nil, syscall.OPEN_EXISTING, 0, 0)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: v, Err: err}
+	}
+	return &Journal{h: h, volume: v}, nil
+}
+
+// Close closes the volume handle.
+func (j *Journal) Close() error {
+	return syscall.CloseHandle(j.h)
+}
+
+// Handle returns the volume handle, which can be used with OpenFileById.
+func (j *Journal) Handle() syscall.Handle {
+	return j.h
+}
+
+func (j *Journal) ioctl(op string, code uint32, in []byte, out []byte) (uint32, error) {
+	var inp, outp *byte
+	if len(in) != 0 {
+		inp = &in[0]
+	}
+	if len(out) != 0 {
+		outp = &out[0]
+	}
+	var n uint32
+	err := syscall.DeviceIoControl(j.h, code, inp, uint32(len(in)), outp, uint32(len(out)), &n, nil)
+	if err != nil {
+		switch err {
+		case ErrJournalNotActive, ErrJournalDeleteInProgress, ErrJournalEntryDeleted, cERROR_HANDLE_EOF, cERROR_OPERATION_ABORTED:
+			return 0, err
+		}
+		return 0, &os.PathError{Op: op, Path: j.volume, Err: err}
+	}
+	return n, nil
+}
+
+// Query returns the state of the change journal. If the journal is not active, it
+// returns ErrJournalNotActive.
+func (j *Journal) Query() (*JournalData, error) {
+	var b [journalDataV1Size]byte
+	n, err := j.ioctl("FSCTL_QUERY_USN_JOURNAL", cFSCTL_QUERY_USN_JOURNAL, nil, b[:])
+	if err != nil {
+		return nil, err
+	}
+	if n < journalDataV0Size {
+		return nil, errInvalidRecord
+	}
+	jd := &JournalData{
+		ID:              binary.LittleEndian.Uint64(b[0:8]),
+		FirstUsn:        Usn(binary.LittleEndian.Uint64(b[8:16])),
+		NextUsn:         Usn(binary.LittleEndian.Uint64(b[16:24])),
+		LowestValidUsn:  Usn(binary.LittleEndian.Uint64(b[24:32])),
+		MaxUsn:          Usn(binary.LittleEndian.Uint64(b[32:40])),
+		MaximumSize:     binary.LittleEndian.Uint64(b[40:48]),
+		AllocationDelta: binary.LittleEndian.Uint64(b[48:56]),
+	}
+	if n >= journalDataV0Size+4 {
+		jd.MinSupportedMajorVersion = binary.LittleEndian.Uint16(b[56:58])
+		jd.MaxSupportedMajorVersion = binary.LittleEndian.Uint16(b[58:60])
+	}
+	return jd, nil
+}
+
+// Create creates the change journal, or changes the size of an existing one.
+// maximumSize and allocationDelta are in bytes; if zero, the file system chooses.
+func (j *Journal) Create(maximumSize uint64, allocationDelta uint64) error {
+	var b [createJournalDataSize]byte
+	binary.LittleEndian.PutUint64(b[0:8], maximumSize)
+	binary.LittleEndian.PutUint64(b[8:16], allocationDelta)
+	_, err := j.ioctl("FSCTL_CREATE_USN_JOURNAL", cFSCTL_CREATE_USN_JOURNAL, b[:], nil)
+	return err
+}
+
+// Delete deletes the change journal with the given ID. If wait is true, Delete does not
+// return until the deletion has completed.
+func (j *Journal) Delete(id uint64, wait bool) error {
+	var b [deleteJournalDataSize]byte
+	binary.LittleEndian.PutUint64(b[0:8], id)
+	flags := uint32(cUSN_DELETE_FLAG_DELETE)
+	if wait {
+		flags |= cUSN_DELETE_FLAG_NOTIFY
+	}
+	binary.LittleEndian.PutUint32(b[8:12], flags)
+	_, err := j.ioctl("FSCTL_DELETE_USN_JOURNAL", cFSCTL_DELETE_USN_JOURNAL, b[:], nil)
+	return err
+}
+
+// ReadOptions configures Journal.Read.
+type ReadOptions struct {
+	// JournalID is the ID of the journal to read, as returned by Query. Reads fail if the
+	// journal has been recreated since.
+	JournalID uint64
+
+	// StartUsn is the USN of the first record to return. Zero starts at the beginning of
+	// the journal.
+	StartUsn Usn
+
+	// ReasonMask selects the changes to return. If zero, all changes are returned.
+	ReasonMask uint32
+
+	// ReturnOnlyOnClose limits the records to those written when the last handle to a
+	// file is closed, which summarize all the changes made through that handle.
+	ReturnOnlyOnClose bool
+
+	// Wait makes Next block until new records are written, instead of returning io.EOF
+	// once the end of the journal has been reached.
+	Wait bool
+
+	// MinMajorVersion and MaxMajorVersion select the record versions to return. If
+	// zero, versions 2 through 4 are accepted.
+	MinMajorVersion uint16
+	MaxMajorVersion uint16
+}
+
+// Reader iterates over records of a change journal.
+type Reader struct {
+	ctx     context.Context
+	j       *Journal
+	in      []byte
+	buf     []byte
+	pending []byte
+	next    func([]byte) error
+	err     error
+}
+
+func (j *Journal) newReader(ctx context.Context, in []byte) *Reader {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return &Reader{
+		ctx: ctx,
+		j:   j,
+		in:  in,
+		buf: make([]byte, readBufferSize),
+	}
+}
+
+// Read returns a Reader for the records written to the journal. Records are returned in
+// USN order. Canceling ctx makes a blocked Next return ctx.Err().
+func (j *Journal) Read(ctx context.Context, opts *ReadOptions) *Reader {
+	if opts == nil {
+		opts = &ReadOptions{}
+	}
+	in := make([]byte, readJournalDataV1Size)
+	binary.LittleEndian.PutUint64(in[0:8], uint64(opts.StartUsn))
+	mask := opts.ReasonMask
+	if mask == 0 {
+		mask = 0xffffffff
+	}
+	binary.LittleEndian.PutUint32(in[8:12], mask)
+	if opts.ReturnOnlyOnClose {
+		binary.LittleEndian.PutUint32(in[12:16], 1)
+	}
+	if opts.Wait {
+		binary.LittleEndian.PutUint64(in[24:32], 1)
+	}
+	binary.LittleEndian.PutUint64(in[32:40], opts.JournalID)
+	minVersion, maxVersion := opts.MinMajorVersion, opts.MaxMajorVersion
+	if minVersion == 0 {
+		minVersion = 2
+	}
+	if maxVersion == 0 {
+		maxVersion = 4
+	}
+	binary.LittleEndian.PutUint16(in[40:42], minVersion)
+	binary.LittleEndian.PutUint16(in[42:44], maxVersion)
+	r := j.newReader(ctx, in)
+	r.next = func(out []byte) error {
+		n, err := r.ioctl("FSCTL_READ_USN_JOURNAL", cFSCTL_READ_USN_JOURNAL, opts.Wait, out)
+		if err != nil {
+			return err
+		}
+		if n < recordBufferHeaderSize {
+			return errInvalidRecord
+		}
+		copy(r.in[0:8], out[:recordBufferHeaderSize])
+		r.pending = out[recordBufferHeaderSize:n]
+		if len(r.pending) == 0 && !opts.Wait {
+			return io.EOF
+		}
+		return nil
+	}
+	return r
+}
+
+// Enumerate returns a Reader for the current record of each file and directory on the
+// volume whose latest change has a USN in [lowUsn, highUsn]. This reads the master file
+// table rather than the journal, so it can list the whole volume, but records are not
+// returned in USN order.
+func (j *Journal) Enumerate(ctx context.Context, lowUsn Usn, highUsn Usn) *Reader {
+	in := make([]byte, enumDataV1Size)
+	binary.LittleEndian.PutUint64(in[8:16], uint64(lowUsn))
+	binary.LittleEndian.PutUint64(in[16:24], uint64(highUsn))
+	// Version 4 records are only written to the journal.
+	binary.LittleEndian.PutUint16(in[24:26], 2)
+	binary.LittleEndian.PutUint16(in[26:28], 3)
+	r := j.newReader(ctx, in)
+	r.next = func(out []byte) error {
+		n, err := r.ioctl("FSCTL_ENUM_USN_DATA", cFSCTL_ENUM_USN_DATA, false, out)
+		if err == cERROR_HANDLE_EOF {
+			return io.EOF
+		}
+		if err != nil {
+			return err
+		}
+		if n < recordBufferHeaderSize {
+			return errInvalidRecord
+		}
+		copy(r.in[0:8], out[:recordBufferHeaderSize])
+		r.pending = out[recordBufferHeaderSize:n]
+		if len(r.pending) == 0 {
+			return io.EOF
+		}
+		return nil
+	}
+	return r
+}
+
+// ioctl issues a request for the reader, canceling it if the reader's context is done
+// while it blocks.
+func (r *Reader) ioctl(op string, code uint32, blocking bool, out []byte) (uint32, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	if !blocking {
+		return r.j.ioctl(op, code, r.in, out)
+	}
+	// The volume handle is synchronous, so the request is canceled by canceling
+	// synchronous IO on the thread that issues it. The context may be done before the
+	// request has been issued, so keep canceling until the request completes.
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	thread, err := openThread(cTHREAD_TERMINATE, false, getCurrentThreadId())
+	if err != nil {
+		return 0, err
+	}
+	defer syscall.CloseHandle(thread)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-r.ctx.Done():
+		case <-done:
+			return
+		}
+		for {
+			cancelSynchronousIo(thread)
+			select {
+			case <-done:
+				return
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+	}()
+	n, err := r.j.ioctl(op, code, r.in, out)
+	close(done)
+	// Wait for the canceling goroutine so that it cannot cancel later IO on this
+	// thread.
+	<-stopped
+	if err == cERROR_OPERATION_ABORTED && r.ctx.Err() != nil {
+		return 0, r.ctx.Err()
+	}
+	return n, err
+}
+
+// Next returns the next record. It returns io.EOF when there are no more records.
+func (r *Reader) Next() (*Record, error) {
+	for r.err == nil {
+		for len(r.pending) != 0 {
+			rec, n, err := parseRecord(r.pending)
+			if err != nil {
+				r.err = err
+				return nil, err
+			}
+			r.pending = r.pending[n:]
+			if rec != nil {
+				return rec, nil
+			}
+		}
+		err := r.next(r.buf)
+		if err != nil {
+			// Reading can resume after the end of the journal or a canceled wait.
+			if err == io.EOF || err == r.ctx.Err() {
+				return nil, err
+			}
+			r.err = err
+		}
+	}
+	return nil, r.err
+}
+
+// NextUsn returns the USN at which to resume reading the journal once the records
+// returned so far have been processed. It is only meaningful for readers returned by
+// Read.
+func (r *Reader) NextUsn() Usn {
+	if len(r.pending) != 0 {
+		rec, _, err := parseRecord(r.pending)
+		if err == nil && rec != nil {
+			return rec.Usn
+		}
+	}
+	return Usn(binary.LittleEndian.Uint64(r.in[0:8]))
+}
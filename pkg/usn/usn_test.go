@@ -0,0 +1,158 @@
+package usn
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"unicode/utf16"
+)
+
+func makeRecord(version uint16, name string) []byte {
+	name16 := utf16.Encode([]rune(name))
+	var b []byte
+	switch version {
+	case 2:
+		b = make([]byte, recordV2HeaderSize+len(name16)*2)
+		binary.LittleEndian.PutUint64(b[8:], 5)
+		binary.LittleEndian.PutUint64(b[16:], 6)
+		binary.LittleEndian.PutUint64(b[24:], 100)
+		binary.LittleEndian.PutUint32(b[40:], ReasonFileCreate)
+		binary.LittleEndian.PutUint16(b[56:], uint16(len(name16)*2))
+		binary.LittleEndian.PutUint16(b[58:], recordV2HeaderSize)
+	case 3:
+		b = make([]byte, recordV3HeaderSize+len(name16)*2)
+		b[8] = 5
+		b[23] = 1
+		b[24] = 6
+		binary.LittleEndian.PutUint64(b[40:], 100)
+		binary.LittleEndian.PutUint32(b[56:], ReasonFileCreate)
+		binary.LittleEndian.PutUint16(b[72:], uint16(len(name16)*2))
+		binary.LittleEndian.PutUint16(b[74:], recordV3HeaderSize)
+	case 4:
+		b = make([]byte, recordV4HeaderSize+recordExtentSize)
+		b[8] = 5
+		b[24] = 6
+		binary.LittleEndian.PutUint64(b[40:], 100)
+		binary.LittleEndian.PutUint32(b[48:], ReasonDataOverwrite)
+		binary.LittleEndian.PutUint16(b[60:], 1)
+		binary.LittleEndian.PutUint16(b[62:], recordExtentSize)
+		binary.LittleEndian.PutUint64(b[64:], 4096)
+		binary.LittleEndian.PutUint64(b[72:], 512)
+	}
+	binary.LittleEndian.PutUint32(b[0:], uint32(len(b)))
+	binary.LittleEndian.PutUint16(b[4:], version)
+	if version != 4 {
+		for i, c := range name16 {
+			binary.LittleEndian.PutUint16(b[len(b)-len(name16)*2+i*2:], c)
+		}
+	}
+	return b
+}
+
+func TestParseRecords(t *testing.T) {
+	for _, version := range []uint16{2, 3, 4} {
+		b := makeRecord(version, "file.txt")
+		r, n, err := parseRecord(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != len(b) || r.MajorVersion != version || r.Usn != 100 {
+			t.Fatalf("v%d: unexpected record %+v", version, r)
+		}
+		if ref, ok := r.ParentFileID.Reference(); !ok || ref != 6 {
+			t.Fatalf("v%d: unexpected parent %x", version, r.ParentFileID)
+		}
+		switch version {
+		case 2:
+			if ref, ok := r.FileID.Reference(); !ok || ref != 5 || r.FileName != "file.txt" {
+				t.Fatalf("v2: unexpected record %+v", r)
+			}
+		case 3:
+			if _, ok := r.FileID.Reference(); ok || r.FileName != "file.txt" {
+				t.Fatalf("v3: unexpected record %+v", r)
+			}
+		case 4:
+			if len(r.Extents) != 1 || r.Extents[0] != (Extent{4096, 512}) {
+				t.Fatalf("v4: unexpected extents %+v", r.Extents)
+			}
+		}
+	}
+}
+
+func TestParseTruncatedRecord(t *testing.T) {
+	b := makeRecord(2, "file.txt")
+	_, _, err := parseRecord(b[:recordV2HeaderSize])
+	if err != errInvalidRecord {
+		t.Fatalf("expected errInvalidRecord, got %v", err)
+	}
+}
+
+func TestReadJournal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	j, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	jd, err := j.Query()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, "usntest.txt"), nil, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := j.Read(context.Background(), &ReadOptions{JournalID: jd.ID, StartUsn: jd.NextUsn})
+	found := false
+	for {
+		rec, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rec.FileName == "usntest.txt" && rec.Reason&ReasonFileCreate != 0 {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatal("file creation not found in journal")
+	}
+	if r.NextUsn() <= jd.NextUsn {
+		t.Fatalf("expected next USN to advance past %d, got %d", jd.NextUsn, r.NextUsn())
+	}
+}
+
+func TestReadJournalCancel(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	j, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	jd, err := j.Query()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r := j.Read(ctx, &ReadOptions{JournalID: jd.ID, StartUsn: jd.NextUsn, Wait: true})
+	_, err = r.Next()
+	if err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
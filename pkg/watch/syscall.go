@@ -0,0 +1,3 @@
+package watch
+
+//go:generate go run $GOROOT/src/syscall/mksyscall_windows.go -output zsyscall.go watch.go
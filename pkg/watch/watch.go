@@ -0,0 +1,238 @@
+// Package watch reports changes to the contents of a directory using
+// ReadDirectoryChangesW.
+package watch
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"os"
+	"syscall"
+	"unicode/utf16"
+)
+
+//sys getOverlappedResult(h syscall.Handle, o *syscall.Overlapped, bytes *uint32, wait bool) (err error) = GetOverlappedResult
+
+const (
+	cFILE_LIST_DIRECTORY     = 0x1
+	cFILE_FLAG_OVERLAPPED    = 0x40000000
+	cERROR_OPERATION_ABORTED = syscall.Errno(995)
+	cERROR_NOTIFY_ENUM_DIR   = syscall.Errno(1022)
+
+	defaultBufferSize = 64 * 1024
+
+	// FILE_NOTIFY_INFORMATION is followed by the file name.
+	notifyInformationSize = 12
+)
+
+var errInvalidNotification = errors.New("invalid change notification")
+
+// Filter selects the kinds of changes that are reported.
+type Filter uint32
+
+const (
+	FileName   Filter = syscall.FILE_NOTIFY_CHANGE_FILE_NAME
+	DirName    Filter = syscall.FILE_NOTIFY_CHANGE_DIR_NAME
+	Attributes Filter = syscall.FILE_NOTIFY_CHANGE_ATTRIBUTES
+	Size       Filter = syscall.FILE_NOTIFY_CHANGE_SIZE
+	LastWrite  Filter = syscall.FILE_NOTIFY_CHANGE_LAST_WRITE
+	LastAccess Filter = syscall.FILE_NOTIFY_CHANGE_LAST_ACCESS
+	Creation   Filter = syscall.FILE_NOTIFY_CHANGE_CREATION
+	Security   Filter = 0x100
+
+	// DefaultFilter reports everything except changes to last access times.
+	DefaultFilter = FileName | DirName | Attributes | Size | LastWrite | Creation | Security
+)
+
+// Action is the kind of change described by an Event.
+type Action uint32
+
+const (
+	Added          Action = syscall.FILE_ACTION_ADDED
+	Removed        Action = syscall.FILE_ACTION_REMOVED
+	Modified       Action = syscall.FILE_ACTION_MODIFIED
+	RenamedOldName Action = syscall.FILE_ACTION_RENAMED_OLD_NAME
+	RenamedNewName Action = syscall.FILE_ACTION_RENAMED_NEW_NAME
+
+	// Overflow means that changes were lost because they arrived faster than they were
+	// read. The contents of the directory should be rescanned.
+	Overflow Action = 0x100
+)
+
+func (a Action) String() string {
+	switch a {
+	case Added:
+		return "added"
+	case Removed:
+		return "removed"
+	case Modified:
+		return "modified"
+	case RenamedOldName:
+		return "renamed from"
+	case RenamedNewName:
+		return "renamed to"
+	case Overflow:
+		return "overflow"
+	}
+	return "unknown"
+}
+
+// Event describes a change to a file or directory.
+type Event struct {
+	// Name is the path of the file relative to the watched directory. It is empty for
+	// Overflow events.
+	Name   string
+	Action Action
+}
+
+// Config contains configuration for Watch.
+type Config struct {
+	// Recursive makes the watch include all directories below the watched one.
+	Recursive bool
+
+	// Filter selects the changes to report. If zero, DefaultFilter is used.
+	Filter Filter
+
+	// BufferSize is the size of the buffer the system collects changes in between
+	// reads. If zero, 64KB is used. Watches of directories on remote file systems may
+	// fail with buffers larger than 64KB.
+	BufferSize int
+}
+
+// Watcher delivers the changes to a directory.
+type Watcher struct {
+	h      syscall.Handle
+	path   string
+	cfg    Config
+	events chan Event
+	err    error
+}
+
+// Watch starts watching the directory at path. Events are delivered until ctx is
+// canceled or watching fails, for example because the directory was deleted.
+func Watch(ctx context.Context, path string, cfg *Config) (*Watcher, error) {
+	w := &Watcher{
+		path:   path,
+		events: make(chan Event),
+	}
+	if cfg != nil {
+		w.cfg = *cfg
+	}
+	if w.cfg.Filter == 0 {
+		w.cfg.Filter = DefaultFilter
+	}
+	if w.cfg.BufferSize == 0 {
+		w.cfg.BufferSize = defaultBufferSize
+	}
+	path16, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, err
+	}
+	w.h, err = syscall.CreateFile(path16, cFILE_LIST_DIRECTORY, syscall.FILE_SHARE_READ|syscall.FILE_SHARE_WRITE|syscall.FILE_SHARE_DELETE, nil, syscall.OPEN_EXISTING, syscall.FILE_FLAG_BACKUP_SEMANTICS|cFILE_FLAG_OVERLAPPED, 0)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: path, Err: err}
+	}
+	go w.run(ctx)
+	return w, nil
+}
+
+// Events returns the channel on which changes are delivered. It is closed when
+// watching stops.
+func (w *Watcher) Events() <-chan Event {
+	return w.events
+}
+
+// Err returns the reason that watching stopped, once the Events channel is closed. It
+// returns the context's error if watching stopped because the context was canceled.
+func (w *Watcher) Err() error {
+	return w.err
+}
+
+func (w *Watcher) run(ctx context.Context) {
+	defer close(w.events)
+	defer syscall.CloseHandle(w.h)
+
+	// Cancel the outstanding read when the context is done. A cancellation that
+	// arrives while no read is outstanding is caught by read itself.
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			syscall.CancelIoEx(w.h, nil)
+		case <-stop:
+		}
+	}()
+
+	buf := make([]byte, w.cfg.BufferSize)
+	for {
+		events, err := w.read(ctx, buf)
+		if err == cERROR_OPERATION_ABORTED && ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		if err != nil {
+			w.err = err
+			return
+		}
+		for _, e := range events {
+			select {
+			case w.events <- e:
+			case <-ctx.Done():
+				w.err = ctx.Err()
+				return
+			}
+		}
+	}
+}
+
+func (w *Watcher) read(ctx context.Context, buf []byte) ([]Event, error) {
+	var o syscall.Overlapped
+	err := syscall.ReadDirectoryChanges(w.h, &buf[0], uint32(len(buf)), w.cfg.Recursive, uint32(w.cfg.Filter), nil, &o, 0)
+	if err != nil {
+		return nil, &os.PathError{Op: "ReadDirectoryChangesW", Path: w.path, Err: err}
+	}
+	// The context may have been canceled before the read was issued, in which case
+	// run's cancellation found nothing to cancel.
+	if ctx.Err() != nil {
+		syscall.CancelIoEx(w.h, &o)
+	}
+	var n uint32
+	err = getOverlappedResult(w.h, &o, &n, true)
+	if err == cERROR_NOTIFY_ENUM_DIR || (err == nil && n == 0) {
+		// The system's buffer overflowed and the changes were discarded.
+		return []Event{{Action: Overflow}}, nil
+	}
+	if err == cERROR_OPERATION_ABORTED {
+		return nil, err
+	}
+	if err != nil {
+		return nil, &os.PathError{Op: "ReadDirectoryChangesW", Path: w.path, Err: err}
+	}
+	return parseNotifications(buf[:n])
+}
+
+// parseNotifications decodes a buffer of FILE_NOTIFY_INFORMATION entries.
+func parseNotifications(b []byte) ([]Event, error) {
+	var events []Event
+	for len(b) != 0 {
+		if len(b) < notifyInformationSize {
+			return nil, errInvalidNotification
+		}
+		next := int(binary.LittleEndian.Uint32(b[0:4]))
+		action := Action(binary.LittleEndian.Uint32(b[4:8]))
+		nameLength := int(binary.LittleEndian.Uint32(b[8:12]))
+		if notifyInformationSize+nameLength > len(b) || next > len(b) {
+			return nil, errInvalidNotification
+		}
+		name16 := make([]uint16, nameLength/2)
+		for i := range name16 {
+			name16[i] = binary.LittleEndian.Uint16(b[notifyInformationSize+i*2:])
+		}
+		events = append(events, Event{Name: string(utf16.Decode(name16)), Action: action})
+		if next == 0 {
+			break
+		}
+		b = b[next:]
+	}
+	return events, nil
+}
@@ -0,0 +1,97 @@
+package watch
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func waitForEvent(t *testing.T, w *Watcher, name string, action Action) {
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case e, ok := <-w.Events():
+			if !ok {
+				t.Fatalf("watcher stopped: %v", w.Err())
+			}
+			if e.Name == name && e.Action == action {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for %s %s", action, name)
+		}
+	}
+}
+
+func TestWatchRecursive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err = os.Mkdir(filepath.Join(dir, "sub"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	w, err := Watch(ctx, dir, &Config{Recursive: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	name := filepath.Join("sub", "file.txt")
+	if err = ioutil.WriteFile(filepath.Join(dir, name), []byte("testing"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	waitForEvent(t, w, name, Added)
+	if err = os.Remove(filepath.Join(dir, name)); err != nil {
+		t.Fatal(err)
+	}
+	waitForEvent(t, w, name, Removed)
+}
+
+func TestWatchCancel(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ctx, cancel := context.WithCancel(context.Background())
+	w, err := Watch(ctx, dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	for range w.Events() {
+	}
+	if w.Err() != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", w.Err())
+	}
+}
+
+func TestWatchOverflow(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	w, err := Watch(ctx, dir, &Config{BufferSize: 64})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Make more changes than fit in the buffer before reading any of them.
+	for i := 0; i < 10; i++ {
+		if err = ioutil.WriteFile(filepath.Join(dir, "file-with-a-long-name.txt"), nil, 0666); err != nil {
+			t.Fatal(err)
+		}
+		if err = os.Remove(filepath.Join(dir, "file-with-a-long-name.txt")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitForEvent(t, w, "", Overflow)
+}
@@ -3,8 +3,10 @@ package winio
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"runtime"
+	"strings"
 	"sync"
 	"syscall"
 	"unicode/utf16"
@@ -24,10 +26,14 @@ import (
 const (
 	SE_PRIVILEGE_ENABLED = 2
 
+	cSE_PRIVILEGE_ENABLED_BY_DEFAULT = 0x1
+	cSE_PRIVILEGE_REMOVED            = 0x4
+
 	ERROR_NOT_ALL_ASSIGNED syscall.Errno = 1300
 
-	SeBackupPrivilege  = "SeBackupPrivilege"
-	SeRestorePrivilege = "SeRestorePrivilege"
+	SeBackupPrivilege        = "SeBackupPrivilege"
+	SeRestorePrivilege       = "SeRestorePrivilege"
+	SeTakeOwnershipPrivilege = "SeTakeOwnershipPrivilege"
 )
 
 const (
@@ -40,6 +46,8 @@ const (
 var (
 	privNames     = make(map[string]uint64)
 	privNameMutex sync.Mutex
+
+	errNotPrivilegeName = errors.New("not a programmatic privilege name such as SeBackupPrivilege")
 )
 
 // PrivilegeError represents an error enabling privileges.
@@ -65,6 +73,75 @@ func (e *PrivilegeError) Error() string {
 	return s
 }
 
+// PrivilegeLookupError is returned when a privilege name cannot be mapped to a
+// privilege value.
+type PrivilegeLookupError struct {
+	Name string
+	Err  error
+}
+
+func (e *PrivilegeLookupError) Error() string {
+	return "lookup privilege " + e.Name + ": " + e.Err.Error()
+}
+
+// isPrivilegeName returns whether name has the form of a programmatic privilege name.
+// Display names are localized and contain spaces, and account rights such as
+// SeServiceLogonRight are not privileges, so neither can be looked up.
+func isPrivilegeName(name string) bool {
+	if !strings.HasPrefix(name, "Se") || !strings.HasSuffix(name, "Privilege") {
+		return false
+	}
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+// PrivilegeValue returns the locally unique identifier of a privilege. The name must be
+// a programmatic name such as SeBackupPrivilege; localized display names are rejected.
+func PrivilegeValue(name string) (uint64, error) {
+	privileges, err := mapPrivileges([]string{name})
+	if err != nil {
+		return 0, err
+	}
+	return privileges[0], nil
+}
+
+// PrivilegeName returns the programmatic name of a privilege, which does not depend on
+// the system language and can be passed back to RunWithPrivileges.
+func PrivilegeName(luid uint64) (string, error) {
+	var nameBuffer [256]uint16
+	bufSize := uint32(len(nameBuffer))
+	err := lookupPrivilegeName("", &luid, &nameBuffer[0], &bufSize)
+	if err != nil {
+		return "", err
+	}
+	return string(utf16.Decode(nameBuffer[:bufSize])), nil
+}
+
+// PrivilegeDisplayName returns the description of a privilege in the system language,
+// given its programmatic name. The result is meant to be shown to users only; it cannot
+// be used to look the privilege up again.
+func PrivilegeDisplayName(name string) (string, error) {
+	if !isPrivilegeName(name) {
+		return "", &PrivilegeLookupError{name, errNotPrivilegeName}
+	}
+	name16, err := syscall.UTF16FromString(name)
+	if err != nil {
+		return "", err
+	}
+	var displayNameBuffer [256]uint16
+	displayBufSize := uint32(len(displayNameBuffer))
+	var langID uint32
+	err = lookupPrivilegeDisplayName("", &name16[0], &displayNameBuffer[0], &displayBufSize, &langID)
+	if err != nil {
+		return "", &PrivilegeLookupError{name, err}
+	}
+	return string(utf16.Decode(displayNameBuffer[:displayBufSize])), nil
+}
+
 // RunWithPrivilege enables a single privilege for a function call.
 func RunWithPrivilege(name string, fn func() error) error {
 	return RunWithPrivileges([]string{name}, fn)
@@ -90,6 +167,92 @@ func RunWithPrivileges(names []string, fn func() error) error {
 	return fn()
 }
 
+// RunWithTokenPrivileges enables privileges in token for a function call, and then
+// restores their previous state. Unlike RunWithPrivileges, which enables privileges in a
+// private thread token, the change is visible to every user of token, such as all the
+// threads of a process if token is its primary token. The token must have been opened
+// with TOKEN_ADJUST_PRIVILEGES and TOKEN_QUERY access.
+func RunWithTokenPrivileges(token windows.Token, names []string, fn func() error) error {
+	privileges, err := mapPrivileges(names)
+	if err != nil {
+		return err
+	}
+	prevState, err := adjustPrivilegesState(token, privileges)
+	if prevState != nil {
+		defer adjustTokenPrivileges(token, false, &prevState[0], 0, nil, nil)
+	}
+	if err != nil {
+		return err
+	}
+	return fn()
+}
+
+// EnableTokenPrivileges enables privileges in token, which must have been opened with
+// TOKEN_ADJUST_PRIVILEGES and TOKEN_QUERY access.
+func EnableTokenPrivileges(token windows.Token, names []string) error {
+	privileges, err := mapPrivileges(names)
+	if err != nil {
+		return err
+	}
+	return adjustPrivileges(token, privileges)
+}
+
+// Privilege describes a privilege held by a token.
+type Privilege struct {
+	// Name is the programmatic name of the privilege, such as SeBackupPrivilege.
+	Name string
+	LUID uint64
+	// Attributes holds the SE_PRIVILEGE_* flags of the privilege.
+	Attributes uint32
+	// Enabled is set if the privilege is currently enabled.
+	Enabled bool
+	// EnabledByDefault is set if the privilege is enabled when the token is created.
+	EnabledByDefault bool
+}
+
+// QueryPrivileges returns the privileges held by token, which must have been opened
+// with TOKEN_QUERY access.
+func QueryPrivileges(token windows.Token) ([]Privilege, error) {
+	n := uint32(1024)
+	var b []byte
+	for {
+		b = make([]byte, n)
+		err := windows.GetTokenInformation(token, windows.TokenPrivileges, &b[0], n, &n)
+		if err == nil {
+			break
+		}
+		if err != windows.ERROR_INSUFFICIENT_BUFFER {
+			return nil, err
+		}
+	}
+	r := bytes.NewReader(b[:n])
+	var count uint32
+	if err := binary.Read(r, binary.LittleEndian, &count); err != nil {
+		return nil, err
+	}
+	privileges := make([]Privilege, 0, count)
+	for i := uint32(0); i < count; i++ {
+		var la struct {
+			LUID       uint64
+			Attributes uint32
+		}
+		if err := binary.Read(r, binary.LittleEndian, &la); err != nil {
+			return nil, err
+		}
+		if la.Attributes&cSE_PRIVILEGE_REMOVED != 0 {
+			continue
+		}
+		privileges = append(privileges, Privilege{
+			Name:             getPrivilegeName(la.LUID),
+			LUID:             la.LUID,
+			Attributes:       la.Attributes,
+			Enabled:          la.Attributes&SE_PRIVILEGE_ENABLED != 0,
+			EnabledByDefault: la.Attributes&cSE_PRIVILEGE_ENABLED_BY_DEFAULT != 0,
+		})
+	}
+	return privileges, nil
+}
+
 func mapPrivileges(names []string) ([]uint64, error) {
 	var privileges []uint64
 	privNameMutex.Lock()
@@ -97,9 +260,12 @@ func mapPrivileges(names []string) ([]uint64, error) {
 	for _, name := range names {
 		p, ok := privNames[name]
 		if !ok {
+			if !isPrivilegeName(name) {
+				return nil, &PrivilegeLookupError{name, errNotPrivilegeName}
+			}
 			err := lookupPrivilegeValue("", name, &p)
 			if err != nil {
-				return nil, err
+				return nil, &PrivilegeLookupError{name, err}
 			}
 			privNames[name] = p
 		}
@@ -127,6 +293,14 @@ func EnableProcessPrivileges(names []string) error {
 }
 
 func adjustPrivileges(token windows.Token, privileges []uint64) error {
+	_, err := adjustPrivilegesState(token, privileges)
+	return err
+}
+
+// adjustPrivilegesState enables privileges in token and returns the previous state of
+// the privileges that were changed, for passing back to AdjustTokenPrivileges. The
+// previous state is returned even if not all the privileges could be enabled.
+func adjustPrivilegesState(token windows.Token, privileges []uint64) ([]byte, error) {
 	var b bytes.Buffer
 	binary.Write(&b, binary.LittleEndian, uint32(len(privileges)))
 	for _, p := range privileges {
@@ -137,31 +311,23 @@ func adjustPrivileges(token windows.Token, privileges []uint64) error {
 	reqSize := uint32(0)
 	success, err := adjustTokenPrivileges(token, false, &b.Bytes()[0], uint32(len(prevState)), &prevState[0], &reqSize)
 	if !success {
-		return err
+		return nil, err
 	}
 	if err == ERROR_NOT_ALL_ASSIGNED {
-		return &PrivilegeError{privileges}
+		return prevState, &PrivilegeError{privileges}
 	}
-	return nil
+	return prevState, nil
 }
 
+// getPrivilegeName returns the programmatic name of a privilege for use in error
+// messages. Display names are not used so that the message does not depend on the
+// system language.
 func getPrivilegeName(luid uint64) string {
-	var nameBuffer [256]uint16
-	bufSize := uint32(len(nameBuffer))
-	err := lookupPrivilegeName("", &luid, &nameBuffer[0], &bufSize)
+	name, err := PrivilegeName(luid)
 	if err != nil {
 		return fmt.Sprintf("<unknown privilege %d>", luid)
 	}
-
-	var displayNameBuffer [256]uint16
-	displayBufSize := uint32(len(displayNameBuffer))
-	var langID uint32
-	err = lookupPrivilegeDisplayName("", &nameBuffer[0], &displayNameBuffer[0], &displayBufSize, &langID)
-	if err != nil {
-		return fmt.Sprintf("<unknown privilege %s>", string(utf16.Decode(nameBuffer[:bufSize])))
-	}
-
-	return string(utf16.Decode(displayNameBuffer[:displayBufSize]))
+	return name
 }
 
 func newThreadToken() (windows.Token, error) {
@@ -1,6 +1,10 @@
 package winio
 
-import "testing"
+import (
+	"testing"
+
+	"golang.org/x/sys/windows"
+)
 
 func TestRunWithUnavailablePrivilege(t *testing.T) {
 	err := RunWithPrivilege("SeCreateTokenPrivilege", func() error { return nil })
@@ -15,3 +19,78 @@ func TestRunWithPrivileges(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestPrivilegeNameRoundTrip(t *testing.T) {
+	luid, err := PrivilegeValue(SeBackupPrivilege)
+	if err != nil {
+		t.Fatal(err)
+	}
+	name, err := PrivilegeName(luid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != SeBackupPrivilege {
+		t.Fatalf("got %s, expected %s", name, SeBackupPrivilege)
+	}
+	display, err := PrivilegeDisplayName(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if display == "" || display == name {
+		t.Fatalf("unexpected display name %q", display)
+	}
+}
+
+func TestPrivilegeDisplayNameRejected(t *testing.T) {
+	display, err := PrivilegeDisplayName(SeBackupPrivilege)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = RunWithPrivilege(display, func() error { return nil })
+	if _, ok := err.(*PrivilegeLookupError); !ok {
+		t.Fatalf("expected PrivilegeLookupError, got %v", err)
+	}
+}
+
+func tokenPrivilege(t *testing.T, token windows.Token, name string) *Privilege {
+	privileges, err := QueryPrivileges(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range privileges {
+		if privileges[i].Name == name {
+			return &privileges[i]
+		}
+	}
+	return nil
+}
+
+func TestRunWithTokenPrivileges(t *testing.T) {
+	p, _ := windows.GetCurrentProcess()
+	var token windows.Token
+	err := windows.OpenProcessToken(p, windows.TOKEN_ADJUST_PRIVILEGES|windows.TOKEN_QUERY, &token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer token.Close()
+	before := tokenPrivilege(t, token, "SeShutdownPrivilege")
+	if before == nil {
+		t.Skip("SeShutdownPrivilege is not held")
+	}
+	err = RunWithTokenPrivileges(token, []string{"SeShutdownPrivilege"}, func() error {
+		if p := tokenPrivilege(t, token, "SeShutdownPrivilege"); !p.Enabled {
+			t.Error("privilege not enabled")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after := tokenPrivilege(t, token, "SeShutdownPrivilege"); after.Enabled != before.Enabled {
+		t.Fatalf("privilege state not restored: %+v", after)
+	}
+	err = RunWithTokenPrivileges(token, []string{"SeCreateTokenPrivilege"}, func() error { return nil })
+	if _, ok := err.(*PrivilegeError); !ok {
+		t.Fatalf("expected PrivilegeError, got %v", err)
+	}
+}
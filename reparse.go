@@ -3,17 +3,63 @@ package winio
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
+	"syscall"
 	"unicode/utf16"
 	"unsafe"
+
+	"github.com/Microsoft/go-winio/pkg/fs"
 )
 
+//sys ntCreateFile(handle *syscall.Handle, access uint32, oa *objectAttributes, iosb *ioStatusBlock, allocationSize *uint64, attributes uint32, share uint32, disposition uint32, options uint32, eaBuffer *byte, eaLength uint32) (status ntstatus) = ntdll.NtCreateFile
+
 const (
-	reparseTagMountPoint = 0xA0000003
-	reparseTagSymlink    = 0xA000000C
+	cFSCTL_SET_REPARSE_POINT    = 0x000900a4
+	cFSCTL_GET_REPARSE_POINT    = 0x000900a8
+	cFSCTL_DELETE_REPARSE_POINT = 0x000900ac
+
+	// maxReparseDataBufferSize is MAXIMUM_REPARSE_DATA_BUFFER_SIZE, the largest
+	// reparse buffer a file system will store.
+	maxReparseDataBufferSize = 16 * 1024
+
+	cFILE_TRAVERSE = 0x20
+	cSYNCHRONIZE   = 0x100000
+
+	cFILE_OPEN   = 1
+	cFILE_CREATE = 2
+
+	cFILE_DIRECTORY_FILE          = 0x1
+	cFILE_SYNCHRONOUS_IO_NONALERT = 0x20
+	cFILE_NON_DIRECTORY_FILE      = 0x40
+	cFILE_OPEN_FOR_BACKUP_INTENT  = 0x4000
+	cFILE_OPEN_REPARSE_POINT      = 0x200000
+
+	cOBJ_CASE_INSENSITIVE = 0x40
+
+	// reparseGUIDSize is the size of the GUID that follows the header of a
+	// REPARSE_GUID_DATA_BUFFER, which is not counted in ReparseDataLength.
+	reparseGUIDSize = 16
 )
 
+type unicodeString struct {
+	Length        uint16
+	MaximumLength uint16
+	Buffer        *uint16
+}
+
+type objectAttributes struct {
+	Length             uintptr
+	RootDirectory      syscall.Handle
+	ObjectName         *unicodeString
+	Attributes         uintptr
+	SecurityDescriptor *byte
+	SecurityQoS        *byte
+}
+
 type reparseDataBuffer struct {
 	ReparseTag           uint32
 	ReparseDataLength    uint16
@@ -40,33 +86,99 @@ func (e *UnsupportedReparsePointError) Error() string {
 	return fmt.Sprintf("unsupported reparse point %x", e.Tag)
 }
 
+var errInvalidReparseData = errors.New("invalid reparse point data")
+
 // DecodeReparsePoint decodes a Win32 REPARSE_DATA_BUFFER structure containing either a symlink
 // or a mount point.
 func DecodeReparsePoint(b []byte) (*ReparsePoint, error) {
+	if len(b) < 8 {
+		return nil, errInvalidReparseData
+	}
 	tag := binary.LittleEndian.Uint32(b[0:4])
 	return DecodeReparsePointData(tag, b[8:])
 }
 
+// DecodeReparsePointData decodes the data of a symlink or mount point reparse point,
+// which follows the eight-byte header of the REPARSE_DATA_BUFFER. The target is the
+// print name of the reparse point, or, if it has none, the Win32 form of its substitute
+// name.
 func DecodeReparsePointData(tag uint32, b []byte) (*ReparsePoint, error) {
 	isMountPoint := false
 	switch tag {
-	case reparseTagMountPoint:
+	case ReparseTagMountPoint:
 		isMountPoint = true
-	case reparseTagSymlink:
+	case ReparseTagSymlink:
 	default:
 		return nil, &UnsupportedReparsePointError{tag}
 	}
-	nameOffset := 8 + binary.LittleEndian.Uint16(b[4:6])
-	if !isMountPoint {
-		nameOffset += 4
+	substituteName, printName, err := decodeReparseNames(b, !isMountPoint)
+	if err != nil {
+		return nil, err
+	}
+	target := printName
+	if target == "" {
+		target = win32PathFromNT(substituteName)
+	}
+	return &ReparsePoint{target, isMountPoint}, nil
+}
+
+// decodeReparseNames decodes the substitute and print names of symlink or mount point
+// reparse data. Symlink data has a flags field after the name offsets.
+func decodeReparseNames(b []byte, hasFlags bool) (substituteName, printName string, err error) {
+	if len(b) < 8 {
+		return "", "", errInvalidReparseData
 	}
-	nameLength := binary.LittleEndian.Uint16(b[6:8])
-	name := make([]uint16, nameLength/2)
-	err := binary.Read(bytes.NewReader(b[nameOffset:nameOffset+nameLength]), binary.LittleEndian, &name)
+	pathBuffer := b[8:]
+	if hasFlags {
+		if len(b) < 12 {
+			return "", "", errInvalidReparseData
+		}
+		pathBuffer = b[12:]
+	}
+	name := func(offset, length uint16) (string, error) {
+		if int(offset)+int(length) > len(pathBuffer) || length%2 != 0 {
+			return "", errInvalidReparseData
+		}
+		name16 := make([]uint16, length/2)
+		for i := range name16 {
+			name16[i] = binary.LittleEndian.Uint16(pathBuffer[int(offset)+i*2:])
+		}
+		return string(utf16.Decode(name16)), nil
+	}
+	substituteName, err = name(binary.LittleEndian.Uint16(b[0:2]), binary.LittleEndian.Uint16(b[2:4]))
+	if err != nil {
+		return "", "", err
+	}
+	printName, err = name(binary.LittleEndian.Uint16(b[4:6]), binary.LittleEndian.Uint16(b[6:8]))
+	if err != nil {
+		return "", "", err
+	}
+	return substituteName, printName, nil
+}
+
+// win32PathFromNT converts an NT path in the \??\ namespace, such as the substitute
+// name of a reparse point, to the equivalent Win32 path. Other paths, such as the
+// targets of relative symlinks, are returned unchanged.
+func win32PathFromNT(path string) string {
+	if !strings.HasPrefix(path, `\??\`) {
+		return path
+	}
+	p, err := fs.DosPathFromNTPath(path)
+	if err != nil {
+		return path
+	}
+	return p
+}
+
+// readReparsePoint returns the REPARSE_DATA_BUFFER of the file opened as f, which must
+// have been opened with FILE_FLAG_OPEN_REPARSE_POINT.
+func readReparsePoint(f *os.File) ([]byte, error) {
+	buf := make([]byte, maxReparseDataBufferSize)
+	n, err := fsctl(f, "FSCTL_GET_REPARSE_POINT", cFSCTL_GET_REPARSE_POINT, nil, buf)
 	if err != nil {
 		return nil, err
 	}
-	return &ReparsePoint{string(utf16.Decode(name)), isMountPoint}, nil
+	return buf[:n], nil
 }
 
 func isDriveLetter(c byte) bool {
@@ -97,9 +209,9 @@ func EncodeReparsePoint(rp *ReparsePoint) []byte {
 	size := int(unsafe.Sizeof(reparseDataBuffer{})) - 8
 	size += len(ntTarget16)*2 + len(target16)*2
 
-	tag := uint32(reparseTagMountPoint)
+	tag := uint32(ReparseTagMountPoint)
 	if !rp.IsMountPoint {
-		tag = reparseTagSymlink
+		tag = ReparseTagSymlink
 		size += 4 // Add room for symlink flags
 	}
 
@@ -126,3 +238,142 @@ func EncodeReparsePoint(rp *ReparsePoint) []byte {
 	binary.Write(&b, binary.LittleEndian, target16)
 	return b.Bytes()
 }
+
+// ReparsePointEntry describes a reparse point to be created by CreateReparsePoints.
+type ReparsePointEntry struct {
+	// Path is the path of the file or directory to create, relative to the root
+	// passed to CreateReparsePoints. Its parent directory must already exist.
+	Path string
+
+	// Tag is the reparse tag, such as IO_REPARSE_TAG_SYMLINK.
+	Tag uint32
+
+	// Data is the reparse data that follows the eight-byte header of the
+	// REPARSE_DATA_BUFFER. For tags that are not owned by Microsoft, it must start
+	// with the 16-byte GUID of the REPARSE_GUID_DATA_BUFFER.
+	Data []byte
+
+	// IsDir specifies whether a directory is created rather than a file.
+	IsDir bool
+}
+
+// reparseBatch creates reparse points relative to a root directory handle, keeping the
+// most recently used parent directory open.
+type reparseBatch struct {
+	root       string
+	rootH      syscall.Handle
+	parent     string
+	parentH    syscall.Handle
+	iosb       ioStatusBlock
+	reparseBuf []byte
+}
+
+func (b *reparseBatch) open(root syscall.Handle, name string, access uint32, disposition uint32, options uint32) (syscall.Handle, error) {
+	name16 := utf16.Encode([]rune(name))
+	if len(name16)*2 > 0xffff {
+		return 0, syscall.ENAMETOOLONG
+	}
+	us := unicodeString{Length: uint16(len(name16) * 2), MaximumLength: uint16(len(name16) * 2)}
+	if len(name16) > 0 {
+		us.Buffer = &name16[0]
+	}
+	oa := objectAttributes{RootDirectory: root, ObjectName: &us, Attributes: cOBJ_CASE_INSENSITIVE}
+	oa.Length = unsafe.Sizeof(oa)
+	var h syscall.Handle
+	status := ntCreateFile(&h, access|cSYNCHRONIZE, &oa, &b.iosb, nil, 0, syscall.FILE_SHARE_READ|syscall.FILE_SHARE_WRITE|syscall.FILE_SHARE_DELETE, disposition, options|cFILE_SYNCHRONOUS_IO_NONALERT|cFILE_OPEN_FOR_BACKUP_INTENT|cFILE_OPEN_REPARSE_POINT, nil, 0)
+	if err := status.Err(); err != nil {
+		return 0, err
+	}
+	return h, nil
+}
+
+func (b *reparseBatch) parentHandle(dir string) (syscall.Handle, error) {
+	if dir == "" {
+		return b.rootH, nil
+	}
+	if b.parentH != 0 && dir == b.parent {
+		return b.parentH, nil
+	}
+	b.closeParent()
+	h, err := b.open(b.rootH, dir, cFILE_LIST_DIRECTORY|cFILE_TRAVERSE, cFILE_OPEN, cFILE_DIRECTORY_FILE)
+	if err != nil {
+		return 0, &os.PathError{Op: "NtCreateFile", Path: filepath.Join(b.root, dir), Err: err}
+	}
+	b.parent, b.parentH = dir, h
+	return h, nil
+}
+
+func (b *reparseBatch) closeParent() {
+	if b.parentH != 0 {
+		syscall.CloseHandle(b.parentH)
+		b.parentH = 0
+	}
+}
+
+func (b *reparseBatch) create(e *ReparsePointEntry) error {
+	rel := filepath.Clean(filepath.FromSlash(e.Path))
+	path := filepath.Join(b.root, rel)
+	if filepath.IsAbs(rel) || filepath.VolumeName(rel) != "" || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return &os.PathError{Op: "create reparse point", Path: e.Path, Err: syscall.EINVAL}
+	}
+	buf, err := appendReparseBuffer(b.reparseBuf[:0], e.Tag, e.Data)
+	if err != nil {
+		return &os.PathError{Op: "create reparse point", Path: path, Err: err}
+	}
+	b.reparseBuf = buf
+
+	dir, name := filepath.Split(rel)
+	parent, err := b.parentHandle(strings.TrimSuffix(dir, string(filepath.Separator)))
+	if err != nil {
+		return err
+	}
+	options := uint32(cFILE_NON_DIRECTORY_FILE)
+	if e.IsDir {
+		options = cFILE_DIRECTORY_FILE
+	}
+	h, err := b.open(parent, name, syscall.GENERIC_WRITE|cFILE_READ_ATTRIBUTES, cFILE_CREATE, options)
+	if err != nil {
+		return &os.PathError{Op: "NtCreateFile", Path: path, Err: err}
+	}
+	defer syscall.CloseHandle(h)
+
+	var n uint32
+	err = syscall.DeviceIoControl(h, cFSCTL_SET_REPARSE_POINT, &buf[0], uint32(len(buf)), nil, 0, &n, nil)
+	if err != nil {
+		return &os.PathError{Op: "FSCTL_SET_REPARSE_POINT", Path: path, Err: err}
+	}
+	return nil
+}
+
+// CreateReparsePoints creates a file or directory with a reparse point for each entry,
+// relative to the directory root. It is intended for importing large numbers of reparse
+// points, such as the tombstones of a container layer: each entry is opened relative to
+// the handle of its parent directory, which is kept open for consecutive entries in the
+// same directory, and the restore privilege is enabled once for the whole batch if the
+// caller holds it.
+//
+// Entries are created in order and none of them may already exist. CreateReparsePoints
+// stops at the first failure; the entries created before it are left in place.
+func CreateReparsePoints(root string, entries []ReparsePointEntry) error {
+	create := func() error {
+		f, err := OpenForBackup(root, cFILE_LIST_DIRECTORY|cFILE_TRAVERSE|cSYNCHRONIZE, syscall.FILE_SHARE_READ|syscall.FILE_SHARE_WRITE|syscall.FILE_SHARE_DELETE, syscall.OPEN_EXISTING)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		b := &reparseBatch{root: root, rootH: syscall.Handle(f.Fd())}
+		defer b.closeParent()
+		for i := range entries {
+			err = b.create(&entries[i])
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	err := RunWithPrivilege(SeRestorePrivilege, create)
+	if _, ok := err.(*PrivilegeError); ok {
+		err = create()
+	}
+	return err
+}
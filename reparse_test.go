@@ -0,0 +1,54 @@
+package winio
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestCreateReparsePoints(t *testing.T) {
+	d, err := ioutil.TempDir("", "reparse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(d)
+	err = os.Mkdir(filepath.Join(d, "sub"), 0777)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mp := EncodeReparsePoint(&ReparsePoint{Target: d, IsMountPoint: true})
+	entries := []ReparsePointEntry{
+		{Path: "a", Tag: ReparseTagMountPoint, Data: mp[8:], IsDir: true},
+		{Path: "sub/b", Tag: ReparseTagMountPoint, Data: mp[8:], IsDir: true},
+		{Path: `sub\c`, Tag: ReparseTagMountPoint, Data: mp[8:], IsDir: true},
+	}
+	err = CreateReparsePoints(d, entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		f, err := OpenForBackup(filepath.Join(d, e.Path), cFILE_READ_ATTRIBUTES, syscall.FILE_SHARE_READ, syscall.OPEN_EXISTING)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ti, err := GetFileAttributeTagInfo(f)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ti.ReparseTag != ReparseTagMountPoint {
+			t.Fatalf("%s: unexpected reparse tag %x", e.Path, ti.ReparseTag)
+		}
+	}
+
+	// Existing files are not overwritten.
+	if err = CreateReparsePoints(d, entries[:1]); err == nil {
+		t.Fatal("expected error")
+	}
+	if err = CreateReparsePoints(d, []ReparsePointEntry{{Path: `..\escape`, Tag: ReparseTagMountPoint, Data: mp[8:]}}); err == nil {
+		t.Fatal("expected error")
+	}
+}
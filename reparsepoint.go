@@ -0,0 +1,243 @@
+package winio
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"strings"
+	"syscall"
+	"unicode/utf16"
+)
+
+// Reparse tags of the file system filters that ship with Windows.
+const (
+	ReparseTagMountPoint = 0xA0000003
+	ReparseTagSymlink    = 0xA000000C
+	// ReparseTagDedup marks a file whose data was moved to the data deduplication store.
+	ReparseTagDedup = 0x80000013
+	// ReparseTagWOF marks a file compressed or backed by the Windows Overlay Filter.
+	ReparseTagWOF = 0x80000017
+	// ReparseTagWCI marks a placeholder or tombstone of a Windows container layer.
+	ReparseTagWCI = 0x80000018
+	// ReparseTagWCI1 is the tag of WCI placeholders for directories.
+	ReparseTagWCI1 = 0x90001018
+	// ReparseTagCloud marks a cloud files placeholder, such as a OneDrive file. The
+	// cloud files filter also uses the tags 0x9000101A through 0x9000F01A; see
+	// IsReparseTagCloud.
+	ReparseTagCloud = 0x9000001A
+	// ReparseTagAppExecLink marks an app execution alias, such as the entries of
+	// %LOCALAPPDATA%\Microsoft\WindowsApps.
+	ReparseTagAppExecLink = 0x8000001B
+	// ReparseTagProjFS marks a placeholder of the Projected File System.
+	ReparseTagProjFS = 0x9000001C
+	// ReparseTagLxSymlink marks a Linux symlink created by WSL.
+	ReparseTagLxSymlink = 0xA000001D
+	// ReparseTagAFUnix marks a Unix domain socket.
+	ReparseTagAFUnix = 0x80000023
+
+	reparseTagMicrosoft     = 0x80000000
+	reparseTagNameSurrogate = 0x20000000
+	reparseTagDirectory     = 0x10000000
+
+	appExecLinkVersion = 3
+	lxSymlinkVersion   = 2
+	wciHeaderSize      = 26
+)
+
+var errInvalidReparseTag = errors.New("reparse tag does not match")
+
+// IsReparseTagMicrosoft reports whether tag is owned by Microsoft. The data of
+// reparse points with other tags starts with a GUID that identifies their owner.
+func IsReparseTagMicrosoft(tag uint32) bool {
+	return tag&reparseTagMicrosoft != 0
+}
+
+// IsReparseTagNameSurrogate reports whether reparse points with tag redirect to
+// another file or directory, as symlinks and junctions do.
+func IsReparseTagNameSurrogate(tag uint32) bool {
+	return tag&reparseTagNameSurrogate != 0
+}
+
+// IsReparseTagDirectory reports whether reparse points with tag may be set on
+// directories that have children.
+func IsReparseTagDirectory(tag uint32) bool {
+	return tag&reparseTagDirectory != 0
+}
+
+// IsReparseTagCloud reports whether tag is one of the tags of the cloud files filter.
+func IsReparseTagCloud(tag uint32) bool {
+	return tag&^0xf000 == ReparseTagCloud
+}
+
+// RawReparsePoint is a reparse point with any tag.
+type RawReparsePoint struct {
+	Tag uint32
+
+	// Data is the reparse data that follows the eight-byte header of the
+	// REPARSE_DATA_BUFFER. For tags that are not owned by Microsoft, it starts with
+	// the 16-byte GUID of the REPARSE_GUID_DATA_BUFFER. The data of ProjFS and cloud
+	// files placeholders is private to their filters.
+	Data []byte
+}
+
+// appendReparseBuffer appends the REPARSE_DATA_BUFFER or REPARSE_GUID_DATA_BUFFER for
+// tag and data to b.
+func appendReparseBuffer(b []byte, tag uint32, data []byte) ([]byte, error) {
+	dataLength := len(data)
+	if !IsReparseTagMicrosoft(tag) {
+		dataLength -= reparseGUIDSize
+	}
+	if dataLength < 0 || dataLength > maxReparseDataBufferSize-8 {
+		return nil, syscall.EINVAL
+	}
+	var hdr [8]byte
+	binary.LittleEndian.PutUint32(hdr[0:4], tag)
+	binary.LittleEndian.PutUint16(hdr[4:6], uint16(dataLength))
+	b = append(b, hdr[:]...)
+	return append(b, data...), nil
+}
+
+// GetReparsePoint returns the reparse point of the file opened as f, which must have
+// been opened with FILE_FLAG_OPEN_REPARSE_POINT, such as by OpenForBackup. If the file
+// is not a reparse point, the error wraps ERROR_NOT_A_REPARSE_POINT.
+func GetReparsePoint(f *os.File) (*RawReparsePoint, error) {
+	b, err := readReparsePoint(f)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) < 8 {
+		return nil, &os.PathError{Op: "FSCTL_GET_REPARSE_POINT", Path: f.Name(), Err: errInvalidReparseData}
+	}
+	return &RawReparsePoint{Tag: binary.LittleEndian.Uint32(b[0:4]), Data: b[8:]}, nil
+}
+
+// SetReparsePoint sets the reparse point of the file opened as f, which must have
+// been opened with write access and FILE_FLAG_OPEN_REPARSE_POINT. data is as described
+// for RawReparsePoint.Data. An existing reparse point can only be replaced by one with
+// the same tag. Most tags not owned by Microsoft, and some that are, require the
+// restore privilege.
+func SetReparsePoint(f *os.File, tag uint32, data []byte) error {
+	buf, err := appendReparseBuffer(nil, tag, data)
+	if err != nil {
+		return &os.PathError{Op: "FSCTL_SET_REPARSE_POINT", Path: f.Name(), Err: err}
+	}
+	_, err = fsctl(f, "FSCTL_SET_REPARSE_POINT", cFSCTL_SET_REPARSE_POINT, buf, nil)
+	return err
+}
+
+// DeleteReparsePoint removes the reparse point of the file opened as f, which must
+// have been opened with write access and FILE_FLAG_OPEN_REPARSE_POINT, leaving an
+// ordinary, empty file or directory.
+func DeleteReparsePoint(f *os.File) error {
+	rp, err := GetReparsePoint(f)
+	if err != nil {
+		return err
+	}
+	var data []byte
+	if !IsReparseTagMicrosoft(rp.Tag) {
+		if len(rp.Data) < reparseGUIDSize {
+			return &os.PathError{Op: "FSCTL_DELETE_REPARSE_POINT", Path: f.Name(), Err: errInvalidReparseData}
+		}
+		data = rp.Data[:reparseGUIDSize]
+	}
+	buf, _ := appendReparseBuffer(nil, rp.Tag, data)
+	_, err = fsctl(f, "FSCTL_DELETE_REPARSE_POINT", cFSCTL_DELETE_REPARSE_POINT, buf, nil)
+	return err
+}
+
+// AppExecLink is the data of an app execution alias reparse point.
+type AppExecLink struct {
+	// PackageID is the package family name of the app.
+	PackageID string
+	// AppUserModelID identifies the app within its package.
+	AppUserModelID string
+	// Target is the path of the executable that is started.
+	Target string
+	// AppType is the type of the app, such as "0" for a desktop app.
+	AppType string
+}
+
+// DecodeAppExecLink decodes the data of a ReparseTagAppExecLink reparse point.
+func DecodeAppExecLink(rp *RawReparsePoint) (*AppExecLink, error) {
+	if rp.Tag != ReparseTagAppExecLink {
+		return nil, errInvalidReparseTag
+	}
+	if len(rp.Data) < 4 || len(rp.Data)%2 != 0 || binary.LittleEndian.Uint32(rp.Data[0:4]) != appExecLinkVersion {
+		return nil, errInvalidReparseData
+	}
+	s16 := make([]uint16, (len(rp.Data)-4)/2)
+	for i := range s16 {
+		s16[i] = binary.LittleEndian.Uint16(rp.Data[4+i*2:])
+	}
+	fields := strings.Split(strings.TrimSuffix(string(utf16.Decode(s16)), "\x00"), "\x00")
+	if len(fields) < 3 {
+		return nil, errInvalidReparseData
+	}
+	l := &AppExecLink{PackageID: fields[0], AppUserModelID: fields[1], Target: fields[2]}
+	if len(fields) > 3 {
+		l.AppType = fields[3]
+	}
+	return l, nil
+}
+
+// ReparsePoint returns the reparse point for the app execution alias.
+func (l *AppExecLink) ReparsePoint() *RawReparsePoint {
+	s16 := utf16.Encode([]rune(l.PackageID + "\x00" + l.AppUserModelID + "\x00" + l.Target + "\x00" + l.AppType + "\x00"))
+	b := make([]byte, 4+len(s16)*2)
+	binary.LittleEndian.PutUint32(b[0:4], appExecLinkVersion)
+	for i, c := range s16 {
+		binary.LittleEndian.PutUint16(b[4+i*2:], c)
+	}
+	return &RawReparsePoint{Tag: ReparseTagAppExecLink, Data: b}
+}
+
+// WciReparsePoint is the data of a Windows container layer placeholder.
+type WciReparsePoint struct {
+	Version uint32
+	// LookupID identifies the layer that holds the file's data.
+	LookupID [16]byte
+	// Name is the path of the file within that layer.
+	Name string
+}
+
+// DecodeWciReparsePoint decodes the data of a ReparseTagWCI or ReparseTagWCI1 reparse
+// point.
+func DecodeWciReparsePoint(rp *RawReparsePoint) (*WciReparsePoint, error) {
+	if rp.Tag != ReparseTagWCI && rp.Tag != ReparseTagWCI1 {
+		return nil, errInvalidReparseTag
+	}
+	b := rp.Data
+	if len(b) < wciHeaderSize {
+		return nil, errInvalidReparseData
+	}
+	w := &WciReparsePoint{Version: binary.LittleEndian.Uint32(b[0:4])}
+	copy(w.LookupID[:], b[8:24])
+	n := int(binary.LittleEndian.Uint16(b[24:26]))
+	if wciHeaderSize+n*2 > len(b) {
+		return nil, errInvalidReparseData
+	}
+	name16 := make([]uint16, n)
+	for i := range name16 {
+		name16[i] = binary.LittleEndian.Uint16(b[wciHeaderSize+i*2:])
+	}
+	w.Name = string(utf16.Decode(name16))
+	return w, nil
+}
+
+// DecodeLxSymlink returns the target of a ReparseTagLxSymlink reparse point.
+func DecodeLxSymlink(rp *RawReparsePoint) (string, error) {
+	if rp.Tag != ReparseTagLxSymlink {
+		return "", errInvalidReparseTag
+	}
+	if len(rp.Data) < 4 || binary.LittleEndian.Uint32(rp.Data[0:4]) != lxSymlinkVersion {
+		return "", errInvalidReparseData
+	}
+	return string(rp.Data[4:]), nil
+}
+
+// LxSymlinkReparsePoint returns the reparse point of a WSL symlink to target.
+func LxSymlinkReparsePoint(target string) *RawReparsePoint {
+	b := make([]byte, 4, 4+len(target))
+	binary.LittleEndian.PutUint32(b, lxSymlinkVersion)
+	return &RawReparsePoint{Tag: ReparseTagLxSymlink, Data: append(b, target...)}
+}
@@ -0,0 +1,94 @@
+package winio
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestReparseTags(t *testing.T) {
+	if !IsReparseTagMicrosoft(ReparseTagSymlink) || !IsReparseTagNameSurrogate(ReparseTagMountPoint) || IsReparseTagNameSurrogate(ReparseTagWOF) {
+		t.Fatal("unexpected tag bits")
+	}
+	if !IsReparseTagDirectory(ReparseTagWCI1) || IsReparseTagDirectory(ReparseTagWCI) {
+		t.Fatal("unexpected directory bit")
+	}
+	if !IsReparseTagCloud(ReparseTagCloud) || !IsReparseTagCloud(0x9000A01A) || IsReparseTagCloud(ReparseTagProjFS) {
+		t.Fatal("unexpected cloud tag")
+	}
+}
+
+func TestDecodeReparseData(t *testing.T) {
+	l := &AppExecLink{
+		PackageID:      "Microsoft.WindowsTerminal_8wekyb3d8bbwe",
+		AppUserModelID: "Microsoft.WindowsTerminal_8wekyb3d8bbwe!App",
+		Target:         `C:\Program Files\WindowsApps\wt.exe`,
+		AppType:        "0",
+	}
+	l2, err := DecodeAppExecLink(l.ReparsePoint())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *l2 != *l {
+		t.Fatalf("unexpected app exec link %+v", l2)
+	}
+
+	target, err := DecodeLxSymlink(LxSymlinkReparsePoint("../lib/libc.so.6"))
+	if err != nil || target != "../lib/libc.so.6" {
+		t.Fatalf("unexpected LX symlink %q: %v", target, err)
+	}
+
+	name := []byte{'a', 0, '\\', 0, 'b', 0}
+	data := append([]byte{1, 0, 0, 0, 0, 0, 0, 0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 3, 0}, name...)
+	w, err := DecodeWciReparsePoint(&RawReparsePoint{Tag: ReparseTagWCI, Data: data})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.Version != 1 || w.LookupID[15] != 16 || w.Name != `a\b` {
+		t.Fatalf("unexpected WCI reparse point %+v", w)
+	}
+	if _, err := DecodeWciReparsePoint(&RawReparsePoint{Tag: ReparseTagWCI, Data: data[:27]}); err == nil {
+		t.Fatal("expected error")
+	}
+	if _, err := DecodeAppExecLink(&RawReparsePoint{Tag: ReparseTagWCI, Data: data}); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestSetReparsePoint(t *testing.T) {
+	d, err := ioutil.TempDir("", "reparse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(d)
+	p := filepath.Join(d, "mp")
+	if err := os.Mkdir(p, 0777); err != nil {
+		t.Fatal(err)
+	}
+	f, err := OpenForBackup(p, syscall.GENERIC_READ|syscall.GENERIC_WRITE, 0, syscall.OPEN_EXISTING)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	data := EncodeReparsePoint(&ReparsePoint{Target: d, IsMountPoint: true})[8:]
+	if err := SetReparsePoint(f, ReparseTagMountPoint, data); err != nil {
+		t.Fatal(err)
+	}
+	rp, err := GetReparsePoint(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rp.Tag != ReparseTagMountPoint || !bytes.Equal(rp.Data, data) {
+		t.Fatalf("unexpected reparse point %x %x", rp.Tag, rp.Data)
+	}
+	if err := DeleteReparsePoint(f); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GetReparsePoint(f); err == nil {
+		t.Fatal("expected error")
+	}
+}
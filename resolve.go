@@ -0,0 +1,155 @@
+package winio
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+const (
+	cERROR_CANT_RESOLVE_FILENAME = syscall.Errno(1921)
+
+	// defaultMaxReparseDepth is the number of reparse points the I/O manager follows
+	// when opening a file before failing with ERROR_CANT_RESOLVE_FILENAME.
+	defaultMaxReparseDepth = 63
+)
+
+// ResolveOptions controls ResolvePath.
+type ResolveOptions struct {
+	// MaxDepth is the maximum number of reparse points to follow. If it is zero, the
+	// limit of the Windows I/O manager, 63, is used.
+	MaxDepth int
+
+	// StopAtFirst stops the walk at the first reparse point, without following it.
+	StopAtFirst bool
+}
+
+// ResolveStep is a reparse point followed by ResolvePath.
+type ResolveStep struct {
+	// Path is the path of the reparse point, with the reparse points before it
+	// resolved.
+	Path string
+	// Tag is the reparse tag, such as ReparseTagSymlink.
+	Tag uint32
+	// Target is the target of the reparse point as stored in it, converted to a Win32
+	// path. The targets of relative symlinks are relative to the directory containing
+	// Path.
+	Target string
+}
+
+// ResolvePath resolves the symlinks, junctions, and app execution aliases in path, one
+// component at a time, and returns the resulting path and the reparse points that were
+// followed, in order. Unlike filepath.EvalSymlinks, it decodes the reparse points
+// itself: junctions to volume GUID paths and app execution aliases are followed, and
+// reparse points that are not name surrogates, such as deduplicated, cloud, and WCI
+// files, are treated as ordinary files.
+//
+// ".." components in symlink targets are resolved lexically, as Windows does. If a
+// component does not exist, the remaining components are appended to the result
+// unresolved, so that dangling links can be inspected. If opts.StopAtFirst is set,
+// ResolvePath returns the path of the first reparse point it finds.
+func ResolvePath(path string, opts *ResolveOptions) (string, []ResolveStep, error) {
+	var o ResolveOptions
+	if opts != nil {
+		o = *opts
+	}
+	if o.MaxDepth <= 0 {
+		o.MaxDepth = defaultMaxReparseDepth
+	}
+	abs := path
+	if !strings.HasPrefix(path, `\\?\`) {
+		var err error
+		abs, err = filepath.Abs(path)
+		if err != nil {
+			return "", nil, &os.PathError{Op: "resolve", Path: path, Err: err}
+		}
+	}
+	var chain []ResolveStep
+	vol := filepath.VolumeName(abs)
+	cur, rest := vol+`\`, abs[len(vol):]
+	for {
+		rest = strings.TrimLeft(rest, `\`)
+		if rest == "" {
+			return cur, chain, nil
+		}
+		comp := rest
+		rest = ""
+		if i := strings.IndexByte(comp, '\\'); i >= 0 {
+			comp, rest = comp[:i], comp[i:]
+		}
+		next := filepath.Join(cur, comp)
+		name16, err := syscall.UTF16FromString(next)
+		if err != nil {
+			return "", chain, &os.PathError{Op: "resolve", Path: next, Err: err}
+		}
+		attrs, err := syscall.GetFileAttributes(&name16[0])
+		if err == syscall.ERROR_FILE_NOT_FOUND || err == syscall.ERROR_PATH_NOT_FOUND {
+			return filepath.Join(next, rest), chain, nil
+		}
+		if err != nil {
+			return "", chain, &os.PathError{Op: "GetFileAttributes", Path: next, Err: err}
+		}
+		if attrs&syscall.FILE_ATTRIBUTE_REPARSE_POINT == 0 {
+			cur = next
+			continue
+		}
+		step, err := readResolveStep(next)
+		if err != nil {
+			return "", chain, err
+		}
+		if step == nil {
+			cur = next
+			continue
+		}
+		chain = append(chain, *step)
+		if o.StopAtFirst {
+			return next, chain, nil
+		}
+		if len(chain) > o.MaxDepth {
+			return "", chain, &os.PathError{Op: "resolve", Path: path, Err: cERROR_CANT_RESOLVE_FILENAME}
+		}
+		target := step.Target
+		switch {
+		case filepath.VolumeName(target) != "":
+		case strings.HasPrefix(target, `\`):
+			target = filepath.VolumeName(cur) + target
+		default:
+			target = filepath.Join(cur, target)
+		}
+		vol = filepath.VolumeName(target)
+		cur, rest = vol+`\`, target[len(vol):]+rest
+	}
+}
+
+// readResolveStep returns the step for the reparse point at path, or nil if it is not
+// a reparse point that ResolvePath follows.
+func readResolveStep(path string) (*ResolveStep, error) {
+	f, err := OpenForBackup(path, cFILE_READ_ATTRIBUTES, syscall.FILE_SHARE_READ|syscall.FILE_SHARE_WRITE|syscall.FILE_SHARE_DELETE, syscall.OPEN_EXISTING)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	rp, err := GetReparsePoint(f)
+	if err != nil {
+		return nil, err
+	}
+	step := &ResolveStep{Path: path, Tag: rp.Tag}
+	switch rp.Tag {
+	case ReparseTagSymlink, ReparseTagMountPoint:
+		substituteName, _, err := decodeReparseNames(rp.Data, rp.Tag == ReparseTagSymlink)
+		if err != nil {
+			return nil, &os.PathError{Op: "resolve", Path: path, Err: err}
+		}
+		step.Target = win32PathFromNT(substituteName)
+	case ReparseTagAppExecLink:
+		l, err := DecodeAppExecLink(rp)
+		if err != nil {
+			return nil, &os.PathError{Op: "resolve", Path: path, Err: err}
+		}
+		step.Target = l.Target
+	default:
+		return nil, nil
+	}
+	return step, nil
+}
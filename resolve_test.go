@@ -0,0 +1,79 @@
+package winio
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolvePath(t *testing.T) {
+	d, err := ioutil.TempDir("", "resolve")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(d)
+	// Resolve the temporary directory first, since it may itself be reached through
+	// a link.
+	d, _, err = ResolvePath(d, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := filepath.Join(d, "target")
+	if err := os.Mkdir(target, 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(target, "file"), nil, 0666); err != nil {
+		t.Fatal(err)
+	}
+	j1 := filepath.Join(d, "j1")
+	j2 := filepath.Join(d, "j2")
+	if err := CreateJunction(j1, target); err != nil {
+		t.Fatal(err)
+	}
+	if err := CreateJunction(j2, j1); err != nil {
+		t.Fatal(err)
+	}
+
+	final, chain, err := ResolvePath(filepath.Join(j2, "file"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if final != filepath.Join(target, "file") || len(chain) != 2 || chain[0].Path != j2 || chain[0].Target != j1 || chain[1].Tag != ReparseTagMountPoint {
+		t.Fatalf("unexpected resolution %s %+v", final, chain)
+	}
+
+	final, chain, err = ResolvePath(filepath.Join(j2, "file"), &ResolveOptions{StopAtFirst: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if final != j2 || len(chain) != 1 {
+		t.Fatalf("unexpected resolution %s %+v", final, chain)
+	}
+
+	if _, _, err = ResolvePath(j2, &ResolveOptions{MaxDepth: 1}); err == nil {
+		t.Fatal("expected error")
+	}
+
+	final, _, err = ResolvePath(filepath.Join(j1, "missing", "file"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if final != filepath.Join(target, "missing", "file") {
+		t.Fatalf("unexpected resolution %s", final)
+	}
+
+	// Creating symlinks requires a privilege or developer mode.
+	link := filepath.Join(d, "link")
+	if err := os.Symlink(`j1\..\target`, link); err != nil {
+		t.Log("skipping symlink test:", err)
+		return
+	}
+	final, chain, err = ResolvePath(filepath.Join(link, "file"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if final != filepath.Join(target, "file") || len(chain) != 1 || chain[0].Tag != ReparseTagSymlink {
+		t.Fatalf("unexpected resolution %s %+v", final, chain)
+	}
+}
@@ -0,0 +1,91 @@
+package winio
+
+import (
+	"encoding/binary"
+	"os"
+	"syscall"
+)
+
+const (
+	cFSCTL_SET_SPARSE             = 0x000900c4
+	cFSCTL_SET_ZERO_DATA          = 0x000980c8
+	cFSCTL_QUERY_ALLOCATED_RANGES = 0x000940cf
+
+	allocatedRangesPerQuery = 512
+)
+
+// FileRange is a range of bytes in a file.
+type FileRange struct {
+	Offset int64
+	Length int64
+}
+
+func fsctl(f *os.File, op string, code uint32, in []byte, out []byte) (uint32, error) {
+	var inp, outp *byte
+	if len(in) > 0 {
+		inp = &in[0]
+	}
+	if len(out) > 0 {
+		outp = &out[0]
+	}
+	var n uint32
+	err := syscall.DeviceIoControl(syscall.Handle(f.Fd()), code, inp, uint32(len(in)), outp, uint32(len(out)), &n, nil)
+	if err != nil && err != cERROR_MORE_DATA {
+		return n, &os.PathError{Op: op, Path: f.Name(), Err: err}
+	}
+	return n, err
+}
+
+// SetFileSparse marks a file as sparse, so that ranges of zeroes set with ZeroFileRange
+// are not allocated on disk, or clears the sparse flag again. The file must have been
+// opened with write access.
+func SetFileSparse(f *os.File, sparse bool) error {
+	in := []byte{0}
+	if sparse {
+		in[0] = 1
+	}
+	_, err := fsctl(f, "FSCTL_SET_SPARSE", cFSCTL_SET_SPARSE, in, nil)
+	return err
+}
+
+// ZeroFileRange sets length bytes of the file starting at offset to zero. If the file is
+// sparse, the disk space for the range is released, punching a hole in the file. The
+// file must have been opened with write access.
+func ZeroFileRange(f *os.File, offset int64, length int64) error {
+	var in [16]byte
+	binary.LittleEndian.PutUint64(in[0:8], uint64(offset))
+	binary.LittleEndian.PutUint64(in[8:16], uint64(offset+length))
+	_, err := fsctl(f, "FSCTL_SET_ZERO_DATA", cFSCTL_SET_ZERO_DATA, in[:], nil)
+	return err
+}
+
+// GetAllocatedRanges returns the ranges of the file between offset and offset+length
+// that are allocated on disk. For a file that is not sparse, the whole range is
+// allocated. Copying only the allocated ranges preserves the data of a sparse file
+// without reading its holes.
+func GetAllocatedRanges(f *os.File, offset int64, length int64) ([]FileRange, error) {
+	var ranges []FileRange
+	var in [16]byte
+	out := make([]byte, allocatedRangesPerQuery*16)
+	end := offset + length
+	for offset < end {
+		binary.LittleEndian.PutUint64(in[0:8], uint64(offset))
+		binary.LittleEndian.PutUint64(in[8:16], uint64(end-offset))
+		n, err := fsctl(f, "FSCTL_QUERY_ALLOCATED_RANGES", cFSCTL_QUERY_ALLOCATED_RANGES, in[:], out)
+		if err != nil && err != cERROR_MORE_DATA {
+			return nil, err
+		}
+		for i := uint32(0); i+16 <= n; i += 16 {
+			r := FileRange{
+				Offset: int64(binary.LittleEndian.Uint64(out[i : i+8])),
+				Length: int64(binary.LittleEndian.Uint64(out[i+8 : i+16])),
+			}
+			ranges = append(ranges, r)
+			offset = r.Offset + r.Length
+		}
+		if err == nil || n < 16 {
+			break
+		}
+	}
+	return ranges, nil
+}
@@ -0,0 +1,48 @@
+package winio
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestSparseFileRanges(t *testing.T) {
+	f, err := ioutil.TempFile("", "sparse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	err = SetFileSparse(f, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const size = 4 * 1024 * 1024
+	_, err = f.WriteAt(make([]byte, size), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ranges, err := GetAllocatedRanges(f, 0, size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ranges, []FileRange{{0, size}}) {
+		t.Fatalf("unexpected ranges %+v", ranges)
+	}
+
+	// Punch a hole in the middle of the file, on allocation unit boundaries.
+	err = ZeroFileRange(f, 1024*1024, 2*1024*1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ranges, err = GetAllocatedRanges(f, 0, size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []FileRange{{0, 1024 * 1024}, {3 * 1024 * 1024, 1024 * 1024}}
+	if !reflect.DeepEqual(ranges, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, ranges)
+	}
+}
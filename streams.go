@@ -0,0 +1,62 @@
+package winio
+
+import (
+	"os"
+	"strings"
+	"syscall"
+)
+
+//sys findFirstStream(name string, infoLevel uint32, data *win32FindStreamData, flags uint32) (h syscall.Handle, err error) [failretval==syscall.InvalidHandle] = FindFirstStreamW
+//sys findNextStream(h syscall.Handle, data *win32FindStreamData) (err error) = FindNextStreamW
+
+const findStreamInfoStandard = 0
+
+type win32FindStreamData struct {
+	StreamSize int64
+	StreamName [syscall.MAX_PATH + 36]uint16
+}
+
+// StreamInfo describes a data stream of a file.
+type StreamInfo struct {
+	// Name is the name of the stream in the form :name:$DATA. The unnamed default
+	// stream is ::$DATA.
+	Name string
+
+	// Size is the size of the stream in bytes.
+	Size int64
+
+	// Path is a path that can be passed to os.Open or OpenForBackup to open the
+	// stream.
+	Path string
+}
+
+// GetFileStreams returns the data streams of the file or directory at path, starting
+// with the default stream if there is one. Unlike NewBackupFileReader, it only returns
+// the names and sizes of the streams and does not require access to their contents.
+func GetFileStreams(path string) ([]StreamInfo, error) {
+	var data win32FindStreamData
+	h, err := findFirstStream(path, findStreamInfoStandard, &data, 0)
+	if err == cERROR_HANDLE_EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, &os.PathError{Op: "FindFirstStream", Path: path, Err: err}
+	}
+	defer syscall.FindClose(h)
+	var streams []StreamInfo
+	for {
+		name := syscall.UTF16ToString(data.StreamName[:])
+		s := StreamInfo{Name: name, Size: data.StreamSize, Path: path}
+		if name != "::$DATA" {
+			s.Path = path + strings.TrimSuffix(name, ":$DATA")
+		}
+		streams = append(streams, s)
+		err = findNextStream(h, &data)
+		if err == cERROR_HANDLE_EOF {
+			return streams, nil
+		}
+		if err != nil {
+			return nil, &os.PathError{Op: "FindNextStream", Path: path, Err: err}
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package winio
+
+import (
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+func TestGetFileStreams(t *testing.T) {
+	err := makeTestFile(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	streams, err := GetFileStreams(testFileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []StreamInfo{
+		{Name: "::$DATA", Size: 14, Path: testFileName},
+		{Name: ":ads.txt:$DATA", Size: 22, Path: testFileName + ":ads.txt"},
+	}
+	if !reflect.DeepEqual(streams, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, streams)
+	}
+
+	b, err := ioutil.ReadFile(streams[1].Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "alternate data stream\n" {
+		t.Fatalf("unexpected stream contents %q", b)
+	}
+}
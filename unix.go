@@ -0,0 +1,231 @@
+package winio
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+//sys setKernelObjectSecurity(handle syscall.Handle, si uint32, sd *byte) (err error) = advapi32.SetKernelObjectSecurity
+
+const (
+	cAF_UNIX = 1
+
+	// AcceptEx requires room for each address plus 16 bytes.
+	unixAddrBufferSize = uint32(unsafe.Sizeof(syscall.RawSockaddrUnix{})) + 16
+)
+
+// ErrUnixListenerClosed is returned for operations on AF_UNIX socket listeners that have
+// been closed. Like ErrPipeListenerClosed, its text matches net.errClosing.
+var ErrUnixListenerClosed = errors.New("use of closed network connection")
+
+// UnixConfig contains configuration for the AF_UNIX socket listener.
+type UnixConfig struct {
+	// SecurityDescriptor contains a Windows security descriptor in SDDL format. Its DACL
+	// is applied to the socket file before the listener starts accepting connections.
+	SecurityDescriptor string
+}
+
+type win32UnixConn struct {
+	*win32File
+	local  *net.UnixAddr
+	remote *net.UnixAddr
+}
+
+func (c *win32UnixConn) LocalAddr() net.Addr {
+	return c.local
+}
+
+func (c *win32UnixConn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+func (c *win32UnixConn) SetDeadline(t time.Time) error {
+	c.SetReadDeadline(t)
+	c.SetWriteDeadline(t)
+	return nil
+}
+
+// Read reads from the socket.
+func (c *win32UnixConn) Read(b []byte) (int, error) {
+	op, err := c.prepareIo()
+	if err != nil {
+		return 0, err
+	}
+	buf := syscall.WSABuf{Len: uint32(len(b))}
+	if len(b) != 0 {
+		buf.Buf = &b[0]
+	}
+	var flags, bytes uint32
+	err = syscall.WSARecv(c.handle, &buf, 1, &bytes, &flags, &op.o, nil)
+	n, err := c.asyncIo(op, c.readDeadline, bytes, err)
+	if err == nil && n == 0 && len(b) != 0 {
+		return 0, io.EOF
+	}
+	return n, err
+}
+
+// Write writes to the socket.
+func (c *win32UnixConn) Write(b []byte) (int, error) {
+	op, err := c.prepareIo()
+	if err != nil {
+		return 0, err
+	}
+	buf := syscall.WSABuf{Len: uint32(len(b))}
+	if len(b) != 0 {
+		buf.Buf = &b[0]
+	}
+	var bytes uint32
+	err = syscall.WSASend(c.handle, &buf, 1, &bytes, 0, &op.o, nil)
+	return c.asyncIo(op, c.writeDeadline, bytes, err)
+}
+
+// CloseWrite shuts down the write side of the socket.
+func (c *win32UnixConn) CloseWrite() error {
+	return syscall.Shutdown(c.handle, syscall.SHUT_WR)
+}
+
+// DialUnix connects to an AF_UNIX socket by path.
+func DialUnix(path string) (net.Conn, error) {
+	s, err := syscall.Socket(cAF_UNIX, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		return nil, os.NewSyscallError("socket", err)
+	}
+	// Connecting to a local socket completes or fails immediately, so there is no
+	// need for ConnectEx.
+	err = syscall.Connect(s, &syscall.SockaddrUnix{Name: path})
+	if err != nil {
+		syscall.Closesocket(s)
+		return nil, &net.OpError{Op: "dial", Net: "unix", Addr: &net.UnixAddr{Name: path, Net: "unix"}, Err: err}
+	}
+	f, err := makeWin32File(s)
+	if err != nil {
+		syscall.Closesocket(s)
+		return nil, err
+	}
+	f.socket = true
+	return &win32UnixConn{
+		win32File: f,
+		local:     &net.UnixAddr{Net: "unix"},
+		remote:    &net.UnixAddr{Name: path, Net: "unix"},
+	}, nil
+}
+
+type win32UnixListener struct {
+	sock *win32File
+	addr *net.UnixAddr
+}
+
+// ListenUnix creates a listener on an AF_UNIX socket path. The socket file must not
+// already exist, and it is removed when the listener is closed.
+func ListenUnix(path string, c *UnixConfig) (net.Listener, error) {
+	var (
+		sd  []byte
+		err error
+	)
+	if c == nil {
+		c = &UnixConfig{}
+	}
+	if c.SecurityDescriptor != "" {
+		sd, err = SddlToSecurityDescriptor(c.SecurityDescriptor)
+		if err != nil {
+			return nil, err
+		}
+	}
+	s, err := syscall.Socket(cAF_UNIX, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		return nil, os.NewSyscallError("socket", err)
+	}
+	err = syscall.Bind(s, &syscall.SockaddrUnix{Name: path})
+	if err != nil {
+		syscall.Closesocket(s)
+		return nil, &os.PathError{Op: "bind", Path: path, Err: err}
+	}
+	// Apply the security descriptor before listening so that no client can connect
+	// while the socket file still has its default ACL.
+	if sd != nil {
+		err = setUnixSocketSecurity(path, sd)
+		if err != nil {
+			syscall.Closesocket(s)
+			os.Remove(path)
+			return nil, err
+		}
+	}
+	err = syscall.Listen(s, syscall.SOMAXCONN)
+	if err != nil {
+		syscall.Closesocket(s)
+		os.Remove(path)
+		return nil, &os.PathError{Op: "listen", Path: path, Err: err}
+	}
+	f, err := makeWin32File(s)
+	if err != nil {
+		syscall.Closesocket(s)
+		os.Remove(path)
+		return nil, err
+	}
+	f.socket = true
+	return &win32UnixListener{sock: f, addr: &net.UnixAddr{Name: path, Net: "unix"}}, nil
+}
+
+func setUnixSocketSecurity(path string, sd []byte) error {
+	// The socket file is a reparse point, which OpenForBackup opens directly.
+	f, err := OpenForBackup(path, WRITE_DAC, syscall.FILE_SHARE_READ|syscall.FILE_SHARE_WRITE|syscall.FILE_SHARE_DELETE, syscall.OPEN_EXISTING)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	err = setKernelObjectSecurity(syscall.Handle(f.Fd()), cDACL_SECURITY_INFORMATION, &sd[0])
+	if err != nil {
+		return &os.PathError{Op: "SetKernelObjectSecurity", Path: path, Err: err}
+	}
+	return nil
+}
+
+func (l *win32UnixListener) Accept() (net.Conn, error) {
+	s, err := syscall.Socket(cAF_UNIX, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		return nil, os.NewSyscallError("socket", err)
+	}
+	c, err := l.sock.prepareIo()
+	if err != nil {
+		syscall.Closesocket(s)
+		return nil, ErrUnixListenerClosed
+	}
+	var addrBuf [unixAddrBufferSize * 2]byte
+	var bytes uint32
+	err = syscall.AcceptEx(l.sock.handle, s, &addrBuf[0], 0, unixAddrBufferSize, unixAddrBufferSize, &bytes, &c.o)
+	_, err = l.sock.asyncIo(c, time.Time{}, bytes, err)
+	if err != nil {
+		syscall.Closesocket(s)
+		if err == ErrFileClosed {
+			return nil, ErrUnixListenerClosed
+		}
+		return nil, &net.OpError{Op: "accept", Net: "unix", Addr: l.addr, Err: err}
+	}
+	err = syscall.Setsockopt(s, syscall.SOL_SOCKET, syscall.SO_UPDATE_ACCEPT_CONTEXT, (*byte)(unsafe.Pointer(&l.sock.handle)), int32(unsafe.Sizeof(l.sock.handle)))
+	if err != nil {
+		syscall.Closesocket(s)
+		return nil, os.NewSyscallError("setsockopt", err)
+	}
+	f, err := makeWin32File(s)
+	if err != nil {
+		syscall.Closesocket(s)
+		return nil, err
+	}
+	f.socket = true
+	return &win32UnixConn{win32File: f, local: l.addr, remote: &net.UnixAddr{Net: "unix"}}, nil
+}
+
+func (l *win32UnixListener) Close() error {
+	l.sock.Close()
+	os.Remove(l.addr.Name)
+	return nil
+}
+
+func (l *win32UnixListener) Addr() net.Addr {
+	return l.addr
+}
@@ -0,0 +1,202 @@
+package winio
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/Microsoft/go-winio/pkg/security"
+)
+
+var testUnixPath = filepath.Join(os.TempDir(), "winiotest.sock")
+
+func getUnixConnection() (client net.Conn, server net.Conn, err error) {
+	os.Remove(testUnixPath)
+	l, err := ListenUnix(testUnixPath, nil)
+	if err != nil {
+		return
+	}
+	defer l.Close()
+
+	type response struct {
+		c   net.Conn
+		err error
+	}
+	ch := make(chan response)
+	go func() {
+		c, err := l.Accept()
+		ch <- response{c, err}
+	}()
+
+	c, err := DialUnix(testUnixPath)
+	if err != nil {
+		return
+	}
+
+	r := <-ch
+	if err = r.err; err != nil {
+		c.Close()
+		return
+	}
+
+	client = c
+	server = r.c
+	return
+}
+
+func TestUnixDialUnknownFails(t *testing.T) {
+	os.Remove(testUnixPath)
+	_, err := DialUnix(testUnixPath)
+	if err == nil {
+		t.Fatal("expected failure")
+	}
+}
+
+func TestUnixFullListenDialReadWrite(t *testing.T) {
+	os.Remove(testUnixPath)
+	l, err := ListenUnix(testUnixPath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	ch := make(chan int)
+	go server(l, ch)
+
+	c, err := DialUnix(testUnixPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	rw := bufio.NewReadWriter(bufio.NewReader(c), bufio.NewWriter(c))
+	_, err = rw.WriteString("hello world\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = rw.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := rw.ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	ms := "got hello world\n"
+	if s != ms {
+		t.Errorf("expected '%s', got '%s'", ms, s)
+	}
+
+	<-ch
+}
+
+func TestUnixReadTimeout(t *testing.T) {
+	c, s, err := getUnixConnection()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	defer s.Close()
+
+	c.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+
+	buf := make([]byte, 10)
+	_, err = c.Read(buf)
+	if err != ErrTimeout {
+		t.Fatalf("expected ErrTimeout, got %v", err)
+	}
+}
+
+func TestUnixCloseClientEOFServer(t *testing.T) {
+	c, s, err := getUnixConnection()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	defer s.Close()
+	ensureEOFOnClose(t, s, c)
+}
+
+func TestUnixCloseWriteEOF(t *testing.T) {
+	c, s, err := getUnixConnection()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	defer s.Close()
+
+	type closeWriter interface {
+		CloseWrite() error
+	}
+
+	err = c.(closeWriter).CloseWrite()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := make([]byte, 10)
+	_, err = s.Read(b)
+	if err != io.EOF {
+		t.Fatal(err)
+	}
+}
+
+func TestUnixCloseAbortsListen(t *testing.T) {
+	os.Remove(testUnixPath)
+	l, err := ListenUnix(testUnixPath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ch := make(chan error)
+	go func() {
+		_, err := l.Accept()
+		ch <- err
+	}()
+
+	time.Sleep(30 * time.Millisecond)
+	l.Close()
+
+	err = <-ch
+	if err != ErrUnixListenerClosed {
+		t.Fatalf("expected ErrUnixListenerClosed, got %v", err)
+	}
+}
+
+func TestUnixListenWithSecurityDescriptor(t *testing.T) {
+	os.Remove(testUnixPath)
+	c := UnixConfig{
+		SecurityDescriptor: "D:P(A;;FA;;;WD)",
+	}
+	l, err := ListenUnix(testUnixPath, &c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	f, err := OpenForBackup(testUnixPath, cREAD_CONTROL, syscall.FILE_SHARE_READ|syscall.FILE_SHARE_WRITE|syscall.FILE_SHARE_DELETE, syscall.OPEN_EXISTING)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	sd, err := security.GetSecurityInfo(syscall.Handle(f.Fd()), security.FileObject, security.DACLSecurityInformation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sd.Control&security.ControlDACLProtected == 0 {
+		t.Error("DACL is not protected")
+	}
+	if sd.DACL == nil || len(sd.DACL.ACEs) != 1 {
+		t.Fatalf("unexpected DACL %+v", sd.DACL)
+	}
+	ace := sd.DACL.ACEs[0]
+	if ace.Type != security.AccessAllowedACE || ace.Mask != security.FileAllAccess || ace.SID.String() != "S-1-1-0" {
+		t.Fatalf("unexpected ACE %+v", ace)
+	}
+}
@@ -0,0 +1,232 @@
+package winio
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"syscall"
+	"unicode/utf16"
+	"unsafe"
+
+	"github.com/Microsoft/go-winio/pkg/usn"
+)
+
+//sys openFileById(volume syscall.Handle, id *fileIDDescriptor, access uint32, share uint32, sa *syscall.SecurityAttributes, flags uint32) (h syscall.Handle, err error) [failretval==syscall.InvalidHandle] = OpenFileById
+
+const (
+	cERROR_INVALID_PARAMETER = syscall.Errno(87)
+
+	fileNameInfo = 2
+
+	cFileIdType         = 0
+	cExtendedFileIdType = 2
+)
+
+// ErrUsnCheckpointExpired is returned when the USN change journal no longer contains
+// all the changes made since a checkpoint, either because the journal was deleted and
+// recreated or because old records have been purged. A full backup is required.
+var ErrUsnCheckpointExpired = errors.New("USN checkpoint has expired")
+
+type fileIDDescriptor struct {
+	Size   uint32
+	Type   uint32
+	FileID [16]byte
+}
+
+// UsnCheckpoint identifies a position in the USN change journal of a volume.
+type UsnCheckpoint struct {
+	JournalID uint64
+	NextUsn   int64
+}
+
+// UsnChange describes a file that has changed since a checkpoint.
+type UsnChange struct {
+	// Path is the path of the file relative to the root of the volume, such as
+	// \dir\file.txt. It is empty if the file was deleted along with its parent.
+	Path string
+
+	// FileID is the NTFS file reference number of the file. On volumes with 128-bit
+	// file IDs, such as ReFS, it holds the low 64 bits of the ID.
+	FileID uint64
+
+	// Reason is the union of the USN_REASON_* flags of the file's journal records.
+	Reason uint32
+
+	// Deleted is set if the file no longer exists.
+	Deleted bool
+}
+
+type usnFileChange struct {
+	UsnChange
+	id     usn.FileID
+	name   string
+	parent usn.FileID
+}
+
+// QueryUsnCheckpoint returns the current position of the USN change journal of the
+// volume containing path, such as C:\. Record the checkpoint before starting a full
+// backup so that changes made while the backup runs are included in the next
+// incremental one. The caller must be an administrator, and the volume must have an
+// active change journal.
+func QueryUsnCheckpoint(path string) (UsnCheckpoint, error) {
+	j, err := usn.Open(path)
+	if err != nil {
+		return UsnCheckpoint{}, err
+	}
+	defer j.Close()
+	jd, err := j.Query()
+	if err != nil {
+		return UsnCheckpoint{}, err
+	}
+	return UsnCheckpoint{JournalID: jd.ID, NextUsn: int64(jd.NextUsn)}, nil
+}
+
+// BackupChangesSince calls fn once for each file on the volume containing path that has
+// changed since the checkpoint cp, in the order in which the files were first changed,
+// and returns the checkpoint to use for the next incremental backup.
+//
+// For files that still exist, fn is passed the file opened for backup with read access.
+// Use NewBackupFileReader to read its backup streams and GetFileBasicInfo to read its
+// metadata. The file is closed when fn returns. For deleted files, fn is passed nil.
+//
+// The caller must be an administrator and should enable the backup privilege (see
+// RunWithPrivilege). If the journal no longer covers cp, ErrUsnCheckpointExpired is
+// returned.
+func BackupChangesSince(path string, cp UsnCheckpoint, fn func(c *UsnChange, f *os.File) error) (UsnCheckpoint, error) {
+	j, err := usn.Open(path)
+	if err != nil {
+		return UsnCheckpoint{}, err
+	}
+	defer j.Close()
+	jd, err := j.Query()
+	if err != nil {
+		return UsnCheckpoint{}, err
+	}
+	if jd.ID != cp.JournalID || usn.Usn(cp.NextUsn) < jd.LowestValidUsn || usn.Usn(cp.NextUsn) > jd.NextUsn {
+		return UsnCheckpoint{}, ErrUsnCheckpointExpired
+	}
+	changes, err := readUsnChanges(j, jd.ID, usn.Usn(cp.NextUsn), jd.NextUsn)
+	if err != nil {
+		return UsnCheckpoint{}, err
+	}
+	for _, c := range changes {
+		err = backupUsnChange(j.Handle(), c, fn)
+		if err != nil {
+			return UsnCheckpoint{}, err
+		}
+	}
+	return UsnCheckpoint{JournalID: jd.ID, NextUsn: int64(jd.NextUsn)}, nil
+}
+
+// readUsnChanges reads the journal records in [start, end) and merges them by file.
+func readUsnChanges(j *usn.Journal, journalID uint64, start usn.Usn, end usn.Usn) ([]*usnFileChange, error) {
+	var changes []*usnFileChange
+	byID := make(map[usn.FileID]*usnFileChange)
+	r := j.Read(context.Background(), &usn.ReadOptions{
+		JournalID:       journalID,
+		StartUsn:        start,
+		MaxMajorVersion: 3,
+	})
+	for {
+		rec, err := r.Next()
+		if err == usn.ErrJournalEntryDeleted || err == usn.ErrJournalNotActive {
+			return nil, ErrUsnCheckpointExpired
+		}
+		if err == io.EOF || (err == nil && rec.Usn >= end) {
+			return changes, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		c := byID[rec.FileID]
+		if c == nil {
+			ref, _ := rec.FileID.Reference()
+			c = &usnFileChange{UsnChange: UsnChange{FileID: ref}, id: rec.FileID}
+			byID[rec.FileID] = c
+			changes = append(changes, c)
+		}
+		c.Reason |= rec.Reason
+		c.name = rec.FileName
+		c.parent = rec.ParentFileID
+	}
+}
+
+// openFileByID opens a file by its 64-bit or 128-bit ID. If the upper 64 bits of id
+// are zero, it is treated as a 64-bit file reference number, which works on volumes
+// that do not support 128-bit IDs.
+func openFileByID(volume syscall.Handle, id [16]byte, access uint32, share uint32, flags uint32) (syscall.Handle, error) {
+	desc := fileIDDescriptor{
+		Size:   uint32(unsafe.Sizeof(fileIDDescriptor{})),
+		Type:   cExtendedFileIdType,
+		FileID: id,
+	}
+	if _, ok := usn.FileID(id).Reference(); ok {
+		desc.Type = cFileIdType
+	}
+	return openFileById(volume, &desc, access, share, nil, flags)
+}
+
+func openUsnFile(volume syscall.Handle, id usn.FileID) (syscall.Handle, error) {
+	return openFileByID(volume, id, syscall.GENERIC_READ, syscall.FILE_SHARE_READ|syscall.FILE_SHARE_WRITE|syscall.FILE_SHARE_DELETE, syscall.FILE_FLAG_BACKUP_SEMANTICS|syscall.FILE_FLAG_OPEN_REPARSE_POINT)
+}
+
+// OpenFileByID opens the file with the given ID, as returned by GetFileID, on the same
+// volume as volume, which may be any file or directory on the volume. IDs are 128 bits
+// wide; shorter file reference numbers, such as those in USN records, are passed
+// zero-extended. The file is opened for overlapped IO, as with OpenFile.
+func OpenFileByID(volume *os.File, id [16]byte, access uint32, share uint32) (io.ReadWriteCloser, error) {
+	h, err := openFileByID(syscall.Handle(volume.Fd()), id, access, share, syscall.FILE_FLAG_OVERLAPPED)
+	if err != nil {
+		return nil, &os.PathError{Op: "OpenFileById", Path: volume.Name(), Err: err}
+	}
+	f, err := makeWin32File(h)
+	if err != nil {
+		syscall.Close(h)
+		return nil, err
+	}
+	f.seekable = true
+	return f, nil
+}
+
+// getFileNameByHandle returns the path of a file relative to the root of its volume.
+func getFileNameByHandle(h syscall.Handle) (string, error) {
+	buf := make([]byte, 4+syscall.MAX_LONG_PATH*2)
+	err := getFileInformationByHandleEx(h, fileNameInfo, &buf[0], uint32(len(buf)))
+	if err != nil {
+		return "", err
+	}
+	name16 := make([]uint16, binary.LittleEndian.Uint32(buf[0:4])/2)
+	for i := range name16 {
+		name16[i] = binary.LittleEndian.Uint16(buf[4+i*2:])
+	}
+	return string(utf16.Decode(name16)), nil
+}
+
+func backupUsnChange(volume syscall.Handle, c *usnFileChange, fn func(c *UsnChange, f *os.File) error) error {
+	h, err := openUsnFile(volume, c.id)
+	if err == cERROR_INVALID_PARAMETER || err == syscall.ERROR_FILE_NOT_FOUND {
+		c.Deleted = true
+		if ph, err := openUsnFile(volume, c.parent); err == nil {
+			parent, err := getFileNameByHandle(ph)
+			syscall.CloseHandle(ph)
+			if err == nil {
+				c.Path = strings.TrimSuffix(parent, `\`) + `\` + c.name
+			}
+		}
+		return fn(&c.UsnChange, nil)
+	}
+	if err != nil {
+		return &os.PathError{Op: "OpenFileById", Path: c.name, Err: err}
+	}
+	c.Path, err = getFileNameByHandle(h)
+	if err != nil {
+		syscall.CloseHandle(h)
+		return &os.PathError{Op: "GetFileInformationByHandleEx", Path: c.name, Err: err}
+	}
+	f := os.NewFile(uintptr(h), c.Path)
+	defer f.Close()
+	return fn(&c.UsnChange, f)
+}
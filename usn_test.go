@@ -0,0 +1,98 @@
+package winio
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestBackupChangesSince(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cp, err := QueryUsnCheckpoint(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, "changed.txt"), []byte("testing 1 2 3\n"), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found := false
+	err = RunWithPrivilege(SeBackupPrivilege, func() error {
+		_, err := BackupChangesSince(dir, cp, func(c *UsnChange, f *os.File) error {
+			if f != nil && strings.HasSuffix(c.Path, `\changed.txt`) {
+				found = true
+				r := NewBackupFileReader(f, false)
+				defer r.Close()
+				_, err := ioutil.ReadAll(r)
+				return err
+			}
+			return nil
+		})
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !found {
+		t.Fatal("changed file not reported")
+	}
+}
+
+func TestBackupChangesSinceExpired(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cp, err := QueryUsnCheckpoint(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cp.JournalID++
+	_, err = BackupChangesSince(dir, cp, func(*UsnChange, *os.File) error { return nil })
+	if err != ErrUsnCheckpointExpired {
+		t.Fatalf("expected ErrUsnCheckpointExpired, got %v", err)
+	}
+}
+
+func TestOpenFileByID(t *testing.T) {
+	err := makeTestFile(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(testFileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fileID, err := GetFileID(f)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	volume, err := os.Open(filepath.Dir(testFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer volume.Close()
+	rwc, err := OpenFileByID(volume, fileID.FileID, syscall.GENERIC_READ, syscall.FILE_SHARE_READ)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rwc.Close()
+	b, err := ioutil.ReadAll(rwc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "testing 1 2 3\n" {
+		t.Fatalf("unexpected contents %q", b)
+	}
+}
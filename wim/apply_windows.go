@@ -0,0 +1,211 @@
+package wim
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	winio "github.com/Microsoft/go-winio"
+)
+
+// ApplyProgress reports the progress of Apply.
+type ApplyProgress struct {
+	// Path is the path of the file that was just extracted, relative to the target
+	// directory. It is empty for the root of the image.
+	Path string
+	// Files and Bytes count the files and directories, and the bytes of file data,
+	// extracted so far.
+	Files int
+	Bytes int64
+}
+
+// ApplyOptions controls how Apply extracts an image.
+type ApplyOptions struct {
+	// Progress, if set, is called after each file or directory is extracted.
+	Progress func(p *ApplyProgress)
+}
+
+type applier struct {
+	ctx      context.Context
+	opts     ApplyOptions
+	links    map[int64]string
+	progress ApplyProgress
+}
+
+// Apply extracts the image to the directory target, which is created if it does not
+// exist and whose existing contents must not conflict with those of the image. Files
+// are written with BackupWrite, which restores their data, alternate data streams,
+// security descriptors, and reparse points; hard links are recreated, and times and
+// attributes are set once each file is complete. The metadata of the root of the image
+// is applied to target. Short names are not restored, and since the package does not
+// read extended attributes, neither are they.
+//
+// Enable the backup and restore privileges first (see winio.RunWithPrivileges) to
+// restore security descriptors that name other owners or include a SACL.
+func (img *Image) Apply(ctx context.Context, target string, opts *ApplyOptions) error {
+	root, err := img.Open()
+	if err != nil {
+		return err
+	}
+	a := &applier{ctx: ctx, links: make(map[int64]string)}
+	if opts != nil {
+		a.opts = *opts
+	}
+	if err := os.MkdirAll(target, 0777); err != nil {
+		return err
+	}
+	return a.applyDir(target, "", root)
+}
+
+func (a *applier) applyDir(path, rel string, d *File) error {
+	children, err := d.Readdir()
+	if err != nil {
+		return err
+	}
+	for _, c := range children {
+		if err := a.ctx.Err(); err != nil {
+			return err
+		}
+		cpath := filepath.Join(path, c.Name)
+		crel := filepath.Join(rel, c.Name)
+		if c.IsDir() {
+			if err := os.Mkdir(cpath, 0777); err != nil {
+				return err
+			}
+			err = a.applyDir(cpath, crel, c)
+		} else {
+			err = a.applyFile(cpath, crel, c)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	// Restore the directory's own metadata after its children, so that a restrictive
+	// security descriptor or the read-only attribute does not get in their way.
+	return a.applyStreams(path, rel, d, syscall.OPEN_EXISTING)
+}
+
+func (a *applier) applyFile(path, rel string, f *File) error {
+	if f.LinkID != 0 && f.Attributes&FILE_ATTRIBUTE_REPARSE_POINT == 0 {
+		if first, ok := a.links[f.LinkID]; ok {
+			if err := winio.CreateHardLink(first, path, false); err != nil {
+				return err
+			}
+			a.report(rel, 0)
+			return nil
+		}
+		a.links[f.LinkID] = path
+	}
+	createmode := uint32(syscall.CREATE_NEW)
+	if f.Attributes&FILE_ATTRIBUTE_DIRECTORY != 0 {
+		// A directory reparse point, such as a junction.
+		if err := os.Mkdir(path, 0777); err != nil {
+			return err
+		}
+		createmode = syscall.OPEN_EXISTING
+	}
+	return a.applyStreams(path, rel, f, createmode)
+}
+
+func (a *applier) report(rel string, n int64) {
+	a.progress.Path = rel
+	a.progress.Files++
+	a.progress.Bytes += n
+	if a.opts.Progress != nil {
+		p := a.progress
+		a.opts.Progress(&p)
+	}
+}
+
+func copyBackupStream(w *winio.BackupStreamWriter, hdr *winio.BackupHeader, open func() (io.ReadCloser, error)) error {
+	if err := w.WriteHeader(hdr); err != nil {
+		return err
+	}
+	return copyAll(w, open)
+}
+
+// applyStreams writes the streams and metadata of f to the file at path.
+func (a *applier) applyStreams(path, rel string, f *File, createmode uint32) error {
+	access := uint32(syscall.GENERIC_WRITE | winio.WRITE_DAC | winio.WRITE_OWNER | winio.ACCESS_SYSTEM_SECURITY)
+	share := uint32(syscall.FILE_SHARE_READ | syscall.FILE_SHARE_WRITE | syscall.FILE_SHARE_DELETE)
+	h, err := winio.OpenForBackup(path, access, share, createmode)
+	if err != nil {
+		// Writing the SACL requires the security privilege.
+		h, err = winio.OpenForBackup(path, access&^winio.ACCESS_SYSTEM_SECURITY, share, createmode)
+		if err != nil {
+			return err
+		}
+	}
+	defer h.Close()
+	bw := winio.NewBackupFileWriter(h, true)
+	defer bw.Close()
+	w := winio.NewBackupStreamWriter(bw)
+	n := int64(0)
+	if f.Attributes&FILE_ATTRIBUTE_REPARSE_POINT != 0 {
+		// Rebuild the header of the REPARSE_DATA_BUFFER, whose data length does not
+		// include the GUID of third-party tags.
+		dataLen := f.Size
+		if !winio.IsReparseTagMicrosoft(f.ReparseTag) {
+			dataLen -= 16
+		}
+		var rp [8]byte
+		binary.LittleEndian.PutUint32(rp[0:4], f.ReparseTag)
+		binary.LittleEndian.PutUint16(rp[4:6], uint16(dataLen))
+		binary.LittleEndian.PutUint16(rp[6:8], uint16(f.ReparseReserved))
+		if err := w.WriteHeader(&winio.BackupHeader{Id: winio.BackupReparseData, Size: int64(len(rp)) + f.Size}); err != nil {
+			return err
+		}
+		if _, err := w.Write(rp[:]); err != nil {
+			return err
+		}
+		if err := copyAll(w, f.Open); err != nil {
+			return err
+		}
+	} else if !f.IsDir() {
+		if err := copyBackupStream(w, &winio.BackupHeader{Id: winio.BackupData, Size: f.Size}, f.Open); err != nil {
+			return err
+		}
+		n += f.Size
+	}
+	for _, s := range f.Streams {
+		if s.Name == "" {
+			continue
+		}
+		if err := copyBackupStream(w, &winio.BackupHeader{Id: winio.BackupAlternateData, Size: s.Size, Name: ":" + s.Name + ":$DATA"}, s.Open); err != nil {
+			return err
+		}
+		n += s.Size
+	}
+	if len(f.SecurityDescriptor) != 0 {
+		if err := w.WriteHeader(&winio.BackupHeader{Id: winio.BackupSecurity, Size: int64(len(f.SecurityDescriptor))}); err != nil {
+			return err
+		}
+		if _, err := w.Write(f.SecurityDescriptor); err != nil {
+			return err
+		}
+	}
+	bw.SetBasicInfoOnClose(&winio.FileBasicInfo{
+		CreationTime:   syscall.Filetime(f.CreationTime),
+		LastAccessTime: syscall.Filetime(f.LastAccessTime),
+		LastWriteTime:  syscall.Filetime(f.LastWriteTime),
+		FileAttributes: uintptr(f.Attributes &^ (FILE_ATTRIBUTE_DIRECTORY | FILE_ATTRIBUTE_REPARSE_POINT)),
+	})
+	if err := bw.Close(); err != nil {
+		return &os.PathError{Op: "apply", Path: path, Err: err}
+	}
+	a.report(rel, n)
+	return nil
+}
+
+func copyAll(w io.Writer, open func() (io.ReadCloser, error)) error {
+	r, err := open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	_, err = io.Copy(w, r)
+	return err
+}
@@ -0,0 +1,101 @@
+package wim
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	winio "github.com/Microsoft/go-winio"
+)
+
+func TestCaptureApply(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wimtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "src")
+	files := map[string]string{
+		`a.txt`:        "hello",
+		`a.txt:ads`:    "alternate",
+		`sub\b.txt`:    "world",
+		`sub\deep\c`:   "",
+		`sub\link.txt`: "hello",
+	}
+	if err := os.MkdirAll(filepath.Join(src, `sub\deep`), 0777); err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range files {
+		if name == `sub\link.txt` {
+			continue
+		}
+		if err := ioutil.WriteFile(filepath.Join(src, name), []byte(data), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := winio.CreateHardLink(filepath.Join(src, "a.txt"), filepath.Join(src, `sub\link.txt`), false); err != nil {
+		t.Fatal(err)
+	}
+
+	wimPath := filepath.Join(dir, "test.wim")
+	f, err := os.Create(wimPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	w, err := NewWriter(f, &WriterOptions{Compression: CompressionXpress, Integrity: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	iw, err := w.AddImage(&ImageInfo{Name: "capture"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := iw.AddDirectory(src); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	dst := filepath.Join(dir, "dst")
+	var last ApplyProgress
+	err = r.Image[0].Apply(context.Background(), dst, &ApplyOptions{
+		Progress: func(p *ApplyProgress) { last = *p },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Three directories, including the root, and four files.
+	if last.Files != 7 || last.Path != "" {
+		t.Fatalf("unexpected final progress %+v", last)
+	}
+	for name, data := range files {
+		b, err := ioutil.ReadFile(filepath.Join(dst, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != data {
+			t.Errorf("%s: got %q, expected %q", name, b, data)
+		}
+	}
+	lf, err := os.Open(filepath.Join(dst, `sub\link.txt`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lf.Close()
+	si, err := winio.GetFileStandardInfo(lf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if si.NumberOfLinks != 2 {
+		t.Fatalf("expected 2 links, got %d", si.NumberOfLinks)
+	}
+}
@@ -0,0 +1,151 @@
+package wim
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	winio "github.com/Microsoft/go-winio"
+)
+
+var (
+	errSparseStream  = errors.New("sparse files are not supported")
+	errInvalidStream = errors.New("invalid reparse data stream")
+)
+
+// AddBackupStream adds a file or directory to the image, as AddFile does, taking its
+// data, alternate data streams, security descriptor, and reparse data from r, which
+// holds a stream in the format produced by BackupRead, as returned by
+// winio.NewBackupFileReader. hdr.Size and hdr.SecurityDescriptor are ignored. Extended
+// attributes and object IDs are not stored; sparse files are not supported.
+func (iw *ImageWriter) AddBackupStream(name string, hdr *FileHeader, r io.Reader) error {
+	h := *hdr
+	h.Size = 0
+	h.SecurityDescriptor = nil
+	e, linked, err := iw.addEntry(name, &h)
+	if err != nil {
+		return err
+	}
+	if linked {
+		return nil
+	}
+	br := winio.NewBackupStreamReader(r)
+	for {
+		bhdr, err := br.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return &os.PathError{Op: "add", Path: name, Err: err}
+		}
+		switch bhdr.Id {
+		case winio.BackupData:
+			if e.isDir() {
+				break
+			}
+			e.hash, err = iw.w.writeBlob(bhdr.Size, br)
+			e.hdr.Size = bhdr.Size
+			iw.totalBytes += bhdr.Size
+		case winio.BackupAlternateData:
+			stream := strings.TrimSuffix(strings.TrimPrefix(bhdr.Name, ":"), ":$DATA")
+			err = iw.AddStream(name, stream, bhdr.Size, br)
+		case winio.BackupSecurity:
+			var sd []byte
+			sd, err = ioutil.ReadAll(br)
+			e.securityID = iw.securityID(sd)
+		case winio.BackupReparseData:
+			var b []byte
+			b, err = ioutil.ReadAll(br)
+			if err == nil && len(b) < 8 {
+				err = errInvalidStream
+			}
+			if err == nil {
+				e.hdr.Attributes |= FILE_ATTRIBUTE_REPARSE_POINT
+				e.hdr.ReparseTag = binary.LittleEndian.Uint32(b)
+				e.hdr.Size = int64(len(b) - 8)
+				e.hash, err = iw.w.writeBlob(e.hdr.Size, bytes.NewReader(b[8:]))
+			}
+		case winio.BackupSparseBlock:
+			err = errSparseStream
+		}
+		if err != nil {
+			if _, ok := err.(*os.PathError); !ok {
+				err = &os.PathError{Op: "add", Path: name, Err: err}
+			}
+			return err
+		}
+	}
+}
+
+// AddDirectory adds the contents of the directory root, and its metadata as that of
+// the root of the image, reading each file with backup semantics. Files with several
+// links within root are stored as hard links. Reparse points are stored as such and
+// are not followed.
+//
+// To capture files the caller cannot otherwise read, enable the backup privilege
+// first (see winio.RunWithPrivilege).
+func (iw *ImageWriter) AddDirectory(root string) error {
+	links := make(map[winio.FileIDInfo]int64)
+	return filepath.Walk(root, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		name, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		if name == "." {
+			name = ""
+		}
+		f, err := winio.OpenForBackup(path, syscall.GENERIC_READ|winio.ACCESS_SYSTEM_SECURITY, syscall.FILE_SHARE_READ|syscall.FILE_SHARE_WRITE|syscall.FILE_SHARE_DELETE, syscall.OPEN_EXISTING)
+		if err != nil {
+			// Reading the SACL requires the security privilege.
+			f, err = winio.OpenForBackup(path, syscall.GENERIC_READ, syscall.FILE_SHARE_READ|syscall.FILE_SHARE_WRITE|syscall.FILE_SHARE_DELETE, syscall.OPEN_EXISTING)
+			if err != nil {
+				return err
+			}
+		}
+		defer f.Close()
+		bi, err := winio.GetFileBasicInfo(f)
+		if err != nil {
+			return err
+		}
+		hdr := FileHeader{
+			Attributes:     uint32(bi.FileAttributes),
+			CreationTime:   Filetime(bi.CreationTime),
+			LastAccessTime: Filetime(bi.LastAccessTime),
+			LastWriteTime:  Filetime(bi.LastWriteTime),
+		}
+		if hdr.Attributes&FILE_ATTRIBUTE_DIRECTORY == 0 {
+			si, err := winio.GetFileStandardInfo(f)
+			if err != nil {
+				return err
+			}
+			if si.NumberOfLinks > 1 {
+				id, err := winio.GetFileID(f)
+				if err != nil {
+					return err
+				}
+				if links[*id] == 0 {
+					links[*id] = int64(len(links) + 1)
+				}
+				hdr.LinkID = links[*id]
+			}
+		}
+		br := winio.NewBackupFileReader(f, true)
+		defer br.Close()
+		if err := iw.AddBackupStream(name, &hdr, br); err != nil {
+			return err
+		}
+		if fi.IsDir() && hdr.Attributes&FILE_ATTRIBUTE_REPARSE_POINT != 0 {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+}
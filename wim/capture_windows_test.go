@@ -0,0 +1,220 @@
+package wim
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	winio "github.com/Microsoft/go-winio"
+)
+
+// captureImage writes an XPRESS-compressed image with add and returns its files by
+// path, along with the WIM file, which the caller must close.
+func captureImage(t *testing.T, dir string, add func(iw *ImageWriter) error) (*os.File, map[string]*File) {
+	f, err := os.Create(filepath.Join(dir, "test.wim"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := NewWriter(f, &WriterOptions{Compression: CompressionXpress})
+	if err != nil {
+		t.Fatal(err)
+	}
+	iw, err := w.AddImage(&ImageInfo{Name: "capture"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := add(iw); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := r.Image[0].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string]*File)
+	var walk func(prefix string, d *File)
+	walk = func(prefix string, d *File) {
+		children, err := d.Readdir()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, c := range children {
+			files[prefix+c.Name] = c
+			if c.IsDir() {
+				walk(prefix+c.Name+`\`, c)
+			}
+		}
+	}
+	walk("", root)
+	return f, files
+}
+
+func readWimFile(t *testing.T, f *File) []byte {
+	rc, err := f.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	b, err := ioutil.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func readWimStream(t *testing.T, f *File, name string) []byte {
+	for _, s := range f.Streams {
+		if s.Name == name {
+			rc, err := s.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rc.Close()
+			b, err := ioutil.ReadAll(rc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return b
+		}
+	}
+	t.Fatalf("%s: no stream %s", f.Name, name)
+	return nil
+}
+
+func writeBackupStream(t *testing.T, bw *winio.BackupStreamWriter, hdr *winio.BackupHeader, data []byte) {
+	hdr.Size = int64(len(data))
+	if err := bw.WriteHeader(hdr); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAddBackupStream(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wimtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	sd := []byte{1, 0, 4, 0x80, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+	var file bytes.Buffer
+	bw := winio.NewBackupStreamWriter(&file)
+	writeBackupStream(t, bw, &winio.BackupHeader{Id: winio.BackupSecurity}, sd)
+	writeBackupStream(t, bw, &winio.BackupHeader{Id: winio.BackupData}, []byte("data"))
+	writeBackupStream(t, bw, &winio.BackupHeader{Id: winio.BackupAlternateData, Name: ":ads:$DATA"}, []byte("alternate"))
+
+	const tag = 0xa000000c
+	rp := make([]byte, 8, 8+len("reparse data"))
+	binary.LittleEndian.PutUint32(rp, tag)
+	binary.LittleEndian.PutUint16(rp[4:], uint16(len("reparse data")))
+	rp = append(rp, "reparse data"...)
+	var link bytes.Buffer
+	bw = winio.NewBackupStreamWriter(&link)
+	writeBackupStream(t, bw, &winio.BackupHeader{Id: winio.BackupReparseData}, rp)
+
+	var sparse bytes.Buffer
+	bw = winio.NewBackupStreamWriter(&sparse)
+	writeBackupStream(t, bw, &winio.BackupHeader{Id: winio.BackupSparseBlock}, []byte("sparse"))
+
+	wf, files := captureImage(t, dir, func(iw *ImageWriter) error {
+		if err := iw.AddBackupStream("file", &FileHeader{Attributes: FILE_ATTRIBUTE_ARCHIVE, Size: 100, SecurityDescriptor: []byte{1}}, &file); err != nil {
+			return err
+		}
+		if err := iw.AddBackupStream("link", &FileHeader{Attributes: FILE_ATTRIBUTE_ARCHIVE}, &link); err != nil {
+			return err
+		}
+		err := iw.AddBackupStream("sparse", &FileHeader{Attributes: FILE_ATTRIBUTE_ARCHIVE}, &sparse)
+		if perr, ok := err.(*os.PathError); !ok || perr.Err != errSparseStream {
+			t.Errorf("expected sparse stream error, got %v", err)
+		}
+		return nil
+	})
+	defer wf.Close()
+
+	f := files["file"]
+	if f == nil {
+		t.Fatal("file was not captured")
+	}
+	if f.Size != 4 || !bytes.Equal(f.SecurityDescriptor, sd) {
+		t.Errorf("file: unexpected size %d or security descriptor %x", f.Size, f.SecurityDescriptor)
+	}
+	if b := readWimFile(t, f); string(b) != "data" {
+		t.Errorf("file: got data %q", b)
+	}
+	if b := readWimStream(t, f, "ads"); string(b) != "alternate" {
+		t.Errorf("file:ads: got data %q", b)
+	}
+
+	l := files["link"]
+	if l == nil {
+		t.Fatal("link was not captured")
+	}
+	if l.Attributes&FILE_ATTRIBUTE_REPARSE_POINT == 0 || l.ReparseTag != tag {
+		t.Errorf("link: unexpected attributes %x or tag %x", l.Attributes, l.ReparseTag)
+	}
+	if b := readWimFile(t, l); string(b) != "reparse data" {
+		t.Errorf("link: got reparse data %q", b)
+	}
+}
+
+func TestAddDirectory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wimtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "src")
+	if err := os.MkdirAll(filepath.Join(src, "sub"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range map[string]string{`a.txt`: "hello", `a.txt:ads`: "alternate", `sub\b.txt`: "world"} {
+		if err := ioutil.WriteFile(filepath.Join(src, name), []byte(data), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := winio.CreateHardLink(filepath.Join(src, "a.txt"), filepath.Join(src, `sub\link.txt`), false); err != nil {
+		t.Fatal(err)
+	}
+
+	wf, files := captureImage(t, dir, func(iw *ImageWriter) error {
+		return iw.AddDirectory(src)
+	})
+	defer wf.Close()
+
+	if len(files) != 4 {
+		t.Fatalf("captured %d files, expected 4", len(files))
+	}
+	for name, data := range map[string]string{`a.txt`: "hello", `sub\b.txt`: "world", `sub\link.txt`: "hello"} {
+		f := files[name]
+		if f == nil {
+			t.Fatalf("%s was not captured", name)
+		}
+		if b := readWimFile(t, f); string(b) != data {
+			t.Errorf("%s: got %q, expected %q", name, b, data)
+		}
+		if len(f.SecurityDescriptor) == 0 {
+			t.Errorf("%s: no security descriptor", name)
+		}
+	}
+	if b := readWimStream(t, files[`a.txt`], "ads"); string(b) != "alternate" {
+		t.Errorf("a.txt:ads: got %q", b)
+	}
+	if !files["sub"].IsDir() {
+		t.Error("sub is not a directory")
+	}
+	a, link, b := files[`a.txt`], files[`sub\link.txt`], files[`sub\b.txt`]
+	if a.LinkID == 0 || a.LinkID != link.LinkID || b.LinkID != 0 {
+		t.Errorf("unexpected link IDs %d, %d, %d", a.LinkID, link.LinkID, b.LinkID)
+	}
+}
@@ -2,24 +2,50 @@ package wim
 
 import (
 	"encoding/binary"
+	"errors"
 	"io"
 	"io/ioutil"
 
+	"github.com/Microsoft/go-winio/wim/lzms"
 	"github.com/Microsoft/go-winio/wim/lzx"
+	"github.com/Microsoft/go-winio/wim/xpress"
 )
 
 const chunkSize = 32768 // Compressed resource chunk size
 
+// compressionFormat identifies the compression format of a resource. The values are
+// those used in the headers of solid resources.
+type compressionFormat uint32
+
+const (
+	formatNone compressionFormat = iota
+	formatXpress
+	formatLzx
+	formatLzms
+)
+
+// solidHeader is the header of a solid resource, which is followed by the compressed
+// size of each of its chunks.
+type solidHeader struct {
+	OriginalSize int64
+	ChunkSize    uint32
+	Format       compressionFormat
+}
+
+const solidHeaderSize = 16
+
 type compressedReader struct {
 	r            *io.SectionReader
 	d            io.ReadCloser
 	chunks       []int64
 	curChunk     int
 	originalSize int64
+	chunkSize    int64
+	format       compressionFormat
 }
 
-func newCompressedReader(r *io.SectionReader, originalSize int64, offset int64) (*compressedReader, error) {
-	nchunks := (originalSize + chunkSize - 1) / chunkSize
+func newCompressedReader(r *io.SectionReader, originalSize int64, offset int64, format compressionFormat, chunk int64) (*compressedReader, error) {
+	nchunks := (originalSize + chunk - 1) / chunk
 	var base int64
 	chunks := make([]int64, nchunks)
 	if originalSize <= 0xffffffff {
@@ -51,21 +77,62 @@ func newCompressedReader(r *io.SectionReader, originalSize int64, offset int64)
 		r:            r,
 		chunks:       chunks,
 		originalSize: originalSize,
+		chunkSize:    chunk,
+		format:       format,
 	}
+	return cr, cr.start(offset)
+}
 
-	err := cr.reset(int(offset / chunkSize))
-	if err != nil {
+// newSolidReader returns a reader for a solid resource, which records its own size,
+// chunk size, and compression format, and whose chunk table holds the size of every
+// chunk rather than the offsets of all but the first.
+func newSolidReader(r *io.SectionReader, offset int64) (*compressedReader, error) {
+	var hdr solidHeader
+	if err := binary.Read(r, binary.LittleEndian, &hdr); err != nil {
+		return nil, err
+	}
+	if hdr.ChunkSize == 0 || hdr.ChunkSize&(hdr.ChunkSize-1) != 0 || hdr.ChunkSize > lzms.MaxBlockSize || hdr.Format > formatLzms || hdr.OriginalSize < 0 {
+		return nil, &ParseError{Oper: "solid resource", Err: errors.New("invalid header")}
+	}
+	nchunks := (hdr.OriginalSize + int64(hdr.ChunkSize) - 1) / int64(hdr.ChunkSize)
+	if solidHeaderSize+nchunks*4 > r.Size() {
+		return nil, &ParseError{Oper: "solid resource", Err: errors.New("invalid chunk table")}
+	}
+	sizes := make([]uint32, nchunks)
+	if err := binary.Read(r, binary.LittleEndian, sizes); err != nil {
 		return nil, err
 	}
+	chunks := make([]int64, nchunks)
+	off := solidHeaderSize + nchunks*4
+	for i, n := range sizes {
+		chunks[i] = off
+		off += int64(n)
+	}
+	cr := &compressedReader{
+		r:            r,
+		chunks:       chunks,
+		originalSize: hdr.OriginalSize,
+		chunkSize:    int64(hdr.ChunkSize),
+		format:       hdr.Format,
+	}
+	return cr, cr.start(offset)
+}
 
-	suboff := offset % chunkSize
+// start positions the reader at offset within the uncompressed data.
+func (r *compressedReader) start(offset int64) error {
+	err := r.reset(int(offset / r.chunkSize))
+	if err != nil {
+		return err
+	}
+
+	suboff := offset % r.chunkSize
 	if suboff != 0 {
-		_, err := io.CopyN(ioutil.Discard, cr.d, suboff)
+		_, err := io.CopyN(ioutil.Discard, r.d, suboff)
 		if err != nil {
-			return nil, err
+			return err
 		}
 	}
-	return cr, nil
+	return nil
 }
 
 func (r *compressedReader) chunkOffset(n int) int64 {
@@ -75,17 +142,17 @@ func (r *compressedReader) chunkOffset(n int) int64 {
 	return r.chunks[n]
 }
 
-func (r *compressedReader) chunkSize(n int) int {
+func (r *compressedReader) compressedSize(n int) int {
 	return int(r.chunkOffset(n+1) - r.chunkOffset(n))
 }
 
 func (r *compressedReader) uncompressedSize(n int) int {
 	if n < len(r.chunks)-1 {
-		return chunkSize
+		return int(r.chunkSize)
 	}
-	size := int(r.originalSize % chunkSize)
+	size := int(r.originalSize % r.chunkSize)
 	if size == 0 {
-		size = chunkSize
+		size = int(r.chunkSize)
 	}
 	return size
 }
@@ -98,11 +165,24 @@ func (r *compressedReader) reset(n int) error {
 		r.d.Close()
 	}
 	r.curChunk = n
-	size := r.chunkSize(n)
+	size := r.compressedSize(n)
 	uncompressedSize := r.uncompressedSize(n)
 	section := io.NewSectionReader(r.r, r.chunkOffset(n), int64(size))
 	if size != uncompressedSize {
-		d, err := lzx.NewReader(section, uncompressedSize)
+		var (
+			d   io.ReadCloser
+			err error
+		)
+		switch r.format {
+		case formatXpress:
+			d, err = xpress.NewReader(section, uncompressedSize)
+		case formatLzx:
+			d, err = lzx.NewReader(section, uncompressedSize)
+		case formatLzms:
+			d, err = lzms.NewReader(section, uncompressedSize)
+		default:
+			err = &ParseError{Oper: "compressed resource", Err: errors.New("compressed chunk in uncompressed resource")}
+		}
 		if err != nil {
 			return err
 		}
@@ -0,0 +1,685 @@
+// Package lzms implements a decompressor for the LZMS compression format used by
+// WIM and ESD files.
+//
+// LZMS is undocumented. It combines LZ77 matches and delta matches with adaptive
+// Huffman codes and an adaptive binary range coder, and preprocesses its input with a
+// filter for x86 machine code. Each buffer is compressed independently into two
+// streams that share it: the range coder's 16-bit words run forward from the start,
+// and the Huffman codewords and extra bits run backward from the end. This
+// implementation follows the description of the format in wimlib.
+package lzms
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/bits"
+	"sort"
+)
+
+const (
+	numLZReps    = 3
+	numDeltaReps = 3
+
+	numMainProbs     = 16
+	numMatchProbs    = 32
+	numLZProbs       = 64
+	numLZRepProbs    = 64
+	numDeltaProbs    = 64
+	numDeltaRepProbs = 64
+
+	probabilityBits        = 6
+	probabilityDenominator = 1 << probabilityBits
+	initialProbability     = 48
+	initialRecentBits      = 0x0000000055555555
+
+	numLiteralSyms    = 256
+	numLengthSyms     = 54
+	numDeltaPowerSyms = 8
+	maxNumOffsetSyms  = 799
+	maxCodewordLen    = 15
+
+	literalRebuildFreq     = 1024
+	lzOffsetRebuildFreq    = 1024
+	lengthRebuildFreq      = 512
+	deltaOffsetRebuildFreq = 1024
+	deltaPowerRebuildFreq  = 512
+
+	x86MaxTranslationOffset = 1023
+	x86IDWindowSize         = 65535
+
+	// MaxBlockSize is the largest buffer that can be decompressed.
+	MaxBlockSize = 1 << 30
+)
+
+var errCorrupt = errors.New("LZMS data corrupt")
+
+// The offset and length slot tables are run-length encoded by the number of slots
+// whose bases differ by each successive power of two.
+var (
+	offsetSlotRunLens = [...]uint8{
+		9, 0, 9, 7, 10, 15, 15, 20,
+		20, 30, 33, 40, 42, 45, 60, 73,
+		80, 85, 95, 105, 6,
+	}
+	lengthSlotRunLens = [...]uint8{
+		27, 4, 6, 4, 5, 2, 1, 1,
+		1, 1, 1, 0, 0, 0, 0, 0,
+		1,
+	}
+
+	offsetSlotBase  [maxNumOffsetSyms + 1]uint32
+	extraOffsetBits [maxNumOffsetSyms]uint8
+	lengthSlotBase  [numLengthSyms + 1]uint32
+	extraLengthBits [numLengthSyms]uint8
+)
+
+func init() {
+	decodeSlotBases(offsetSlotBase[:], extraOffsetBits[:], offsetSlotRunLens[:], 0x7fffffff)
+	decodeSlotBases(lengthSlotBase[:], extraLengthBits[:], lengthSlotRunLens[:], 0x400108ab)
+}
+
+func decodeSlotBases(base []uint32, extra []uint8, runLens []uint8, final uint32) {
+	var (
+		order uint8
+		delta uint32 = 1
+		b     uint32
+		slot  int
+	)
+	for _, n := range runLens {
+		for ; n > 0; n-- {
+			b += delta
+			if slot > 0 {
+				extra[slot-1] = order
+			}
+			base[slot] = b
+			slot++
+		}
+		delta <<= 1
+		order++
+	}
+	base[slot] = final
+	extra[slot-1] = uint8(bits.Len32(final-base[slot-1]) - 1)
+}
+
+// numOffsetSlots returns the number of offset slots needed for a buffer of size bytes.
+func numOffsetSlots(size int) int {
+	if size < 2 {
+		return 0
+	}
+	// Find the slot of the largest possible offset, size-1.
+	return sort.Search(maxNumOffsetSyms, func(i int) bool { return offsetSlotBase[i+1] > uint32(size-1) }) + 1
+}
+
+// probEntry tracks the bits most recently coded in one context of the range coder.
+// The probability of a zero bit is the fraction of zeroes in the last 64 bits.
+type probEntry struct {
+	zeros  uint32
+	recent uint64
+}
+
+func initProbs(p []probEntry) {
+	for i := range p {
+		p[i] = probEntry{zeros: initialProbability, recent: initialRecentBits}
+	}
+}
+
+// probability returns the probability of a zero bit, excluding 0% and 100%.
+func (p *probEntry) probability() uint32 {
+	prob := p.zeros
+	if prob == 0 {
+		prob = 1
+	} else if prob == probabilityDenominator {
+		prob--
+	}
+	return prob
+}
+
+func (p *probEntry) update(bit uint32) {
+	// The oldest bit leaves the window as the new one enters it.
+	p.zeros = uint32(int32(p.zeros) + int32(p.recent>>(probabilityDenominator-1)) - int32(bit))
+	p.recent = p.recent<<1 | uint64(bit)
+}
+
+// rangeDecoder decodes the range coder's stream of 16-bit little-endian words from the
+// start of the buffer.
+type rangeDecoder struct {
+	in   []byte
+	pos  int
+	rng  uint32
+	code uint32
+}
+
+func (d *rangeDecoder) word() uint32 {
+	if d.pos+2 > len(d.in) {
+		return 0
+	}
+	w := binary.LittleEndian.Uint16(d.in[d.pos:])
+	d.pos += 2
+	return uint32(w)
+}
+
+// decodeBit decodes a bit using the probability entry selected by state, which
+// records the last few bits decoded in this context.
+func (d *rangeDecoder) decodeBit(state *uint32, probs []probEntry) uint32 {
+	p := &probs[*state]
+	if d.rng&0xffff0000 == 0 {
+		d.rng <<= 16
+		d.code = d.code<<16 | d.word()
+	}
+	bound := (d.rng >> probabilityBits) * p.probability()
+	var bit uint32
+	if d.code < bound {
+		d.rng = bound
+	} else {
+		d.rng -= bound
+		d.code -= bound
+		bit = 1
+	}
+	p.update(bit)
+	*state = (*state<<1 | bit) & uint32(len(probs)-1)
+	return bit
+}
+
+// bitReader reads the Huffman codewords and extra bits, which are stored as 16-bit
+// little-endian words read most significant bit first, backward from the end of the
+// buffer.
+type bitReader struct {
+	in  []byte
+	pos int
+	buf uint64
+	n   uint
+}
+
+func (r *bitReader) ensure(n uint) {
+	for r.n < n {
+		var w uint64
+		if r.pos >= 2 {
+			r.pos -= 2
+			w = uint64(binary.LittleEndian.Uint16(r.in[r.pos:]))
+		}
+		r.buf |= w << (48 - r.n)
+		r.n += 16
+	}
+}
+
+func (r *bitReader) peek(n uint) uint32 {
+	return uint32(r.buf >> (64 - n))
+}
+
+func (r *bitReader) remove(n uint) {
+	r.buf <<= n
+	r.n -= n
+}
+
+func (r *bitReader) readBits(n uint) uint32 {
+	if n == 0 {
+		return 0
+	}
+	r.ensure(n)
+	v := r.peek(n)
+	r.remove(n)
+	return v
+}
+
+const (
+	symBits = 10
+	symMask = 1<<symBits - 1
+)
+
+// huffmanCode is an adaptive canonical Huffman code, which is rebuilt from the
+// frequencies of the symbols decoded after every rebuildFreq symbols.
+type huffmanCode struct {
+	freqs        []uint32
+	lens         []uint8
+	sorted       []uint16
+	work         []uint32
+	count        [maxCodewordLen + 1]uint32
+	rebuildFreq  int
+	untilRebuild int
+}
+
+func newHuffmanCode(numSyms int, rebuildFreq int) *huffmanCode {
+	c := &huffmanCode{
+		freqs:       make([]uint32, numSyms),
+		lens:        make([]uint8, numSyms),
+		sorted:      make([]uint16, numSyms+1),
+		work:        make([]uint32, numSyms),
+		rebuildFreq: rebuildFreq,
+	}
+	for i := range c.freqs {
+		c.freqs[i] = 1
+	}
+	c.rebuild()
+	return c
+}
+
+// buildLengths computes the codeword lengths of a length-limited Huffman code for
+// c.freqs. The encoder rebuilds its codes in the same way, so the tie-breaking rules
+// and the length-limiting heuristic must be followed exactly.
+func (c *huffmanCode) buildLengths() {
+	n := len(c.freqs)
+	a := c.work
+	for i := range a {
+		a[i] = uint32(i)
+	}
+	// Sort the symbols by frequency, then by symbol value.
+	sort.SliceStable(a, func(i, j int) bool { return c.freqs[a[i]] < c.freqs[a[j]] })
+	for i := range a {
+		a[i] |= c.freqs[a[i]] << symBits
+	}
+
+	// Build the tree in place. Leaves are taken from the front of the sorted symbols
+	// and internal nodes, which are created in order of increasing frequency, are
+	// stored in the entries of the leaves already consumed. The low bits of each
+	// entry keep the sorted symbol, and the high bits first hold the frequency of
+	// the node and then the index of its parent.
+	i, b, e := 0, 0, 0
+	for {
+		var m, k int
+		if i != n && (b == e || a[i]>>symBits <= a[b]>>symBits) {
+			m = i
+			i++
+		} else {
+			m = b
+			b++
+		}
+		if i != n && (b == e || a[i]>>symBits <= a[b]>>symBits) {
+			k = i
+			i++
+		} else {
+			k = b
+			b++
+		}
+		freq := a[m]&^symMask + a[k]&^symMask
+		a[m] = a[m]&symMask | uint32(e)<<symBits
+		a[k] = a[k]&symMask | uint32(e)<<symBits
+		a[e] = a[e]&symMask | freq
+		e++
+		if n-e <= 1 {
+			break
+		}
+	}
+
+	// Compute the number of codewords of each length from the depths of the
+	// internal nodes, moving any that would be too deep up to the deepest length
+	// that still has a codeword to split.
+	for l := range c.count {
+		c.count[l] = 0
+	}
+	c.count[1] = 2
+	root := n - 2
+	a[root] &= symMask
+	for node := root - 1; node >= 0; node-- {
+		parent := a[node] >> symBits
+		depth := a[parent]>>symBits + 1
+		a[node] = a[node]&symMask | depth<<symBits
+		l := depth
+		if l >= maxCodewordLen {
+			l = maxCodewordLen
+			for {
+				l--
+				if c.count[l] != 0 {
+					break
+				}
+			}
+		}
+		c.count[l]--
+		c.count[l+1] += 2
+	}
+
+	// Assign the lengths in decreasing order to the symbols in order of increasing
+	// frequency.
+	i = 0
+	for l := maxCodewordLen; l >= 1; l-- {
+		for j := c.count[l]; j > 0; j-- {
+			c.lens[a[i]&symMask] = uint8(l)
+			i++
+		}
+	}
+}
+
+func (c *huffmanCode) rebuild() {
+	n := len(c.freqs)
+	switch {
+	case n == 1:
+		// A code needs at least two codewords; the second is never valid.
+		c.count = [maxCodewordLen + 1]uint32{1: 2}
+		c.sorted[0] = 0
+		c.sorted[1] = 1
+	case n > 1:
+		c.buildLengths()
+		var offs [maxCodewordLen + 2]uint32
+		for l := 1; l <= maxCodewordLen; l++ {
+			offs[l+1] = offs[l] + c.count[l]
+		}
+		for sym, l := range c.lens {
+			c.sorted[offs[l]] = uint16(sym)
+			offs[l]++
+		}
+	}
+	for i, f := range c.freqs {
+		c.freqs[i] = f>>1 + 1
+	}
+	c.untilRebuild = c.rebuildFreq
+}
+
+// decode decodes a symbol from r and adapts the code to it.
+func (c *huffmanCode) decode(r *bitReader) (int, error) {
+	r.ensure(maxCodewordLen)
+	v := r.peek(maxCodewordLen)
+	var code, first, index uint32
+	sym := -1
+	for l := uint(1); l <= maxCodewordLen; l++ {
+		code |= v >> (maxCodewordLen - l) & 1
+		if code-first < c.count[l] {
+			sym = int(c.sorted[index+code-first])
+			r.remove(l)
+			break
+		}
+		index += c.count[l]
+		first = (first + c.count[l]) << 1
+		code <<= 1
+	}
+	if sym < 0 || sym >= len(c.freqs) {
+		return 0, errCorrupt
+	}
+	c.freqs[sym]++
+	c.untilRebuild--
+	if c.untilRebuild == 0 {
+		c.rebuild()
+	}
+	return sym, nil
+}
+
+type decompressor struct {
+	rd rangeDecoder
+	br bitReader
+
+	literal     *huffmanCode
+	lzOffset    *huffmanCode
+	length      *huffmanCode
+	deltaOffset *huffmanCode
+	deltaPower  *huffmanCode
+
+	mainState      uint32
+	matchState     uint32
+	lzState        uint32
+	lzRepStates    [numLZReps - 1]uint32
+	deltaState     uint32
+	deltaRepStates [numDeltaReps - 1]uint32
+
+	mainProbs     [numMainProbs]probEntry
+	matchProbs    [numMatchProbs]probEntry
+	lzProbs       [numLZProbs]probEntry
+	lzRepProbs    [numLZReps - 1][numLZRepProbs]probEntry
+	deltaProbs    [numDeltaProbs]probEntry
+	deltaRepProbs [numDeltaReps - 1][numDeltaRepProbs]probEntry
+}
+
+// initModels resets the adaptive codes and probabilities for a buffer of size bytes.
+func (d *decompressor) initModels(size int) {
+	numOffsetSyms := numOffsetSlots(size)
+	d.literal = newHuffmanCode(numLiteralSyms, literalRebuildFreq)
+	d.lzOffset = newHuffmanCode(numOffsetSyms, lzOffsetRebuildFreq)
+	d.length = newHuffmanCode(numLengthSyms, lengthRebuildFreq)
+	d.deltaOffset = newHuffmanCode(numOffsetSyms, deltaOffsetRebuildFreq)
+	d.deltaPower = newHuffmanCode(numDeltaPowerSyms, deltaPowerRebuildFreq)
+	initProbs(d.mainProbs[:])
+	initProbs(d.matchProbs[:])
+	initProbs(d.lzProbs[:])
+	initProbs(d.deltaProbs[:])
+	for i := range d.lzRepProbs {
+		initProbs(d.lzRepProbs[i][:])
+	}
+	for i := range d.deltaRepProbs {
+		initProbs(d.deltaRepProbs[i][:])
+	}
+}
+
+func (d *decompressor) offset(c *huffmanCode) (uint32, error) {
+	slot, err := c.decode(&d.br)
+	if err != nil {
+		return 0, err
+	}
+	return offsetSlotBase[slot] + d.br.readBits(uint(extraOffsetBits[slot])), nil
+}
+
+func (d *decompressor) matchLength() (uint32, error) {
+	slot, err := d.length.decode(&d.br)
+	if err != nil {
+		return 0, err
+	}
+	return lengthSlotBase[slot] + d.br.readBits(uint(extraLengthBits[slot])), nil
+}
+
+// Decompress decompresses a buffer of LZMS data that decompresses to
+// uncompressedSize bytes.
+func Decompress(in []byte, uncompressedSize int) ([]byte, error) {
+	if len(in) < 4 || len(in)%2 != 0 || uncompressedSize < 0 || uncompressedSize > MaxBlockSize {
+		return nil, errCorrupt
+	}
+	d := &decompressor{
+		rd: rangeDecoder{in: in, pos: 4, rng: 0xffffffff, code: uint32(binary.LittleEndian.Uint16(in))<<16 | uint32(binary.LittleEndian.Uint16(in[2:]))},
+		br: bitReader{in: in, pos: len(in)},
+	}
+	d.initModels(uncompressedSize)
+
+	// The queues of recent offsets are updated one item late. Rather than delaying
+	// the update, a repeat match that immediately follows a match of the same kind
+	// takes its offset from one slot further along.
+	var (
+		recentLZ    [numLZReps + 1]uint32
+		recentDelta [numDeltaReps + 1]uint64
+		prevItem    int // 0 for a literal, 1 for an LZ match, 2 for a delta match
+	)
+	for i := range recentLZ {
+		recentLZ[i] = uint32(i + 1)
+	}
+	for i := range recentDelta {
+		recentDelta[i] = uint64(i + 1)
+	}
+
+	out := make([]byte, 0, uncompressedSize)
+	for len(out) < uncompressedSize {
+		if d.rd.decodeBit(&d.mainState, d.mainProbs[:]) == 0 {
+			sym, err := d.literal.decode(&d.br)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, byte(sym))
+			prevItem = 0
+			continue
+		}
+
+		if d.rd.decodeBit(&d.matchState, d.matchProbs[:]) == 0 {
+			var offset uint32
+			if d.rd.decodeBit(&d.lzState, d.lzProbs[:]) == 0 {
+				var err error
+				offset, err = d.offset(d.lzOffset)
+				if err != nil {
+					return nil, err
+				}
+				recentLZ[3] = recentLZ[2]
+				recentLZ[2] = recentLZ[1]
+				recentLZ[1] = recentLZ[0]
+			} else {
+				late := prevItem & 1
+				if d.rd.decodeBit(&d.lzRepStates[0], d.lzRepProbs[0][:]) == 0 {
+					offset = recentLZ[0+late]
+					recentLZ[0+late] = recentLZ[0]
+				} else if d.rd.decodeBit(&d.lzRepStates[1], d.lzRepProbs[1][:]) == 0 {
+					offset = recentLZ[1+late]
+					recentLZ[1+late] = recentLZ[1]
+					recentLZ[1] = recentLZ[0]
+				} else {
+					offset = recentLZ[2+late]
+					recentLZ[2+late] = recentLZ[2]
+					recentLZ[2] = recentLZ[1]
+					recentLZ[1] = recentLZ[0]
+				}
+			}
+			recentLZ[0] = offset
+			prevItem = 1
+			length, err := d.matchLength()
+			if err != nil {
+				return nil, err
+			}
+			if int64(length) > int64(uncompressedSize-len(out)) || int64(offset) > int64(len(out)) {
+				return nil, errCorrupt
+			}
+			start := len(out) - int(offset)
+			for i := 0; i < int(length); i++ {
+				out = append(out, out[start+i])
+			}
+			continue
+		}
+
+		// Delta match: each byte is predicted from the byte span bytes earlier
+		// plus the difference between the corresponding pair of bytes at
+		// offset.
+		var power, rawOffset uint32
+		if d.rd.decodeBit(&d.deltaState, d.deltaProbs[:]) == 0 {
+			p, err := d.deltaPower.decode(&d.br)
+			if err != nil {
+				return nil, err
+			}
+			power = uint32(p)
+			rawOffset, err = d.offset(d.deltaOffset)
+			if err != nil {
+				return nil, err
+			}
+			recentDelta[3] = recentDelta[2]
+			recentDelta[2] = recentDelta[1]
+			recentDelta[1] = recentDelta[0]
+		} else {
+			late := prevItem >> 1
+			var v uint64
+			if d.rd.decodeBit(&d.deltaRepStates[0], d.deltaRepProbs[0][:]) == 0 {
+				v = recentDelta[0+late]
+				recentDelta[0+late] = recentDelta[0]
+			} else if d.rd.decodeBit(&d.deltaRepStates[1], d.deltaRepProbs[1][:]) == 0 {
+				v = recentDelta[1+late]
+				recentDelta[1+late] = recentDelta[1]
+				recentDelta[1] = recentDelta[0]
+			} else {
+				v = recentDelta[2+late]
+				recentDelta[2+late] = recentDelta[2]
+				recentDelta[2] = recentDelta[1]
+				recentDelta[1] = recentDelta[0]
+			}
+			power = uint32(v >> 32)
+			rawOffset = uint32(v)
+		}
+		recentDelta[0] = uint64(power)<<32 | uint64(rawOffset)
+		prevItem = 2
+		length, err := d.matchLength()
+		if err != nil {
+			return nil, err
+		}
+		if power >= 32 {
+			return nil, errCorrupt
+		}
+		span := int64(1) << power
+		offset := int64(rawOffset) << power
+		if int64(length) > int64(uncompressedSize-len(out)) || offset+span > int64(len(out)) {
+			return nil, errCorrupt
+		}
+		for i := 0; i < int(length); i++ {
+			pos := len(out)
+			m := pos - int(offset)
+			out = append(out, out[m]+out[pos-int(span)]-out[m-int(span)])
+		}
+	}
+	x86Filter(out, true)
+	return out, nil
+}
+
+// NewReader returns a reader that decompresses the LZMS buffer read from r, which
+// decompresses to uncompressedSize bytes.
+func NewReader(r io.Reader, uncompressedSize int) (io.ReadCloser, error) {
+	in, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	out, err := Decompress(in, uncompressedSize)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(bytes.NewReader(out)), nil
+}
+
+// x86Filter translates the relative addresses of likely x86 call, jump, and load
+// instructions in data into absolute ones, or back again if undo is set. The
+// translation only happens where recent instructions have referred to the same
+// target, which makes it unlikely that anything but machine code is changed.
+func x86Filter(data []byte, undo bool) {
+	size := len(data)
+	if size <= 17 {
+		return
+	}
+	var lastTargetUsages [65536]int32
+	for i := range lastTargetUsages {
+		lastTargetUsages[i] = -x86IDWindowSize - 1
+	}
+	lastX86Pos := int32(-x86MaxTranslationOffset - 1)
+	tail := size - 16
+	for p := 1; p < tail; {
+		var nbytes int
+		maxTrans := int32(x86MaxTranslationOffset)
+		switch data[p] {
+		case 0xff:
+			// Call indirect relative.
+			if data[p+1] == 0x15 {
+				nbytes = 2
+			}
+		case 0xf0:
+			// Lock add relative.
+			if data[p+1] == 0x83 && data[p+2] == 0x05 {
+				nbytes = 3
+			}
+		case 0x48, 0x4c:
+			// A REX prefix followed by a RIP-relative LEA or MOV.
+			if data[p+2]&0x07 == 0x05 && (data[p+1] == 0x8d || (data[p+1] == 0x8b && data[p]&0x04 == 0 && data[p+2]&0xf0 == 0)) {
+				nbytes = 3
+			}
+		case 0xe8:
+			// Call relative, which is common enough to need more confidence.
+			nbytes = 1
+			maxTrans >>= 1
+		case 0xe9:
+			// Jump relative is deliberately not translated.
+			p += 4
+		}
+		if nbytes == 0 {
+			p++
+			continue
+		}
+		i := int32(p)
+		p += nbytes
+		var target16 uint16
+		if !undo {
+			target16 = uint16(i) + binary.LittleEndian.Uint16(data[p:])
+		}
+		if i-lastX86Pos <= maxTrans {
+			n := binary.LittleEndian.Uint32(data[p:])
+			if undo {
+				n -= uint32(i)
+			} else {
+				n += uint32(i)
+			}
+			binary.LittleEndian.PutUint32(data[p:], n)
+		}
+		if undo {
+			target16 = uint16(i) + binary.LittleEndian.Uint16(data[p:])
+		}
+		i += int32(nbytes) + 3
+		if i-lastTargetUsages[target16] <= x86IDWindowSize {
+			lastX86Pos = i
+		}
+		lastTargetUsages[target16] = i
+		p += 4
+	}
+}
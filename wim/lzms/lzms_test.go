@@ -0,0 +1,361 @@
+package lzms
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/rand"
+	"testing"
+)
+
+// rangeEncoder is the inverse of rangeDecoder. Carries out of the low 32 bits are
+// propagated through the most recent word that is not 0xffff and the run of 0xffff
+// words following it, which are held back until it is known that they are final.
+type rangeEncoder struct {
+	low       uint64
+	rng       uint32
+	cache     uint16
+	cacheSize int
+	started   bool
+	out       []uint16
+}
+
+func (e *rangeEncoder) shiftLow() {
+	if uint32(e.low) < 0xffff0000 || e.low>>32 != 0 {
+		carry := uint16(e.low >> 32)
+		for ; e.cacheSize > 0; e.cacheSize-- {
+			// The first word held back is the initial cache, which is never part
+			// of the output.
+			if e.started {
+				e.out = append(e.out, e.cache+carry)
+			}
+			e.started = true
+			e.cache = 0xffff
+		}
+		e.cache = uint16(e.low >> 16)
+	}
+	e.cacheSize++
+	e.low = (e.low & 0xffff) << 16
+}
+
+func (e *rangeEncoder) encodeBit(state *uint32, probs []probEntry, bit uint32) {
+	p := &probs[*state]
+	bound := (e.rng >> probabilityBits) * p.probability()
+	if bit == 0 {
+		e.rng = bound
+	} else {
+		e.low += uint64(bound)
+		e.rng -= bound
+	}
+	if e.rng <= 0xffff {
+		e.rng <<= 16
+		e.shiftLow()
+	}
+	p.update(bit)
+	*state = (*state<<1 | bit) & uint32(len(probs)-1)
+}
+
+func (e *rangeEncoder) flush() {
+	for i := 0; i < 4; i++ {
+		e.shiftLow()
+	}
+}
+
+// bitWriter is the inverse of bitReader. Words are collected in the order they are
+// read and reversed when the output is assembled.
+type bitWriter struct {
+	out []uint16
+	buf uint32
+	n   uint
+}
+
+func (w *bitWriter) writeBits(v uint32, n uint) {
+	for i := int(n) - 1; i >= 0; i-- {
+		w.buf = w.buf<<1 | v>>uint(i)&1
+		w.n++
+		if w.n == 16 {
+			w.out = append(w.out, uint16(w.buf))
+			w.buf, w.n = 0, 0
+		}
+	}
+}
+
+func (w *bitWriter) flush() {
+	if w.n > 0 {
+		w.writeBits(0, 16-w.n)
+	}
+}
+
+// encodeSymbol writes the codeword for sym and adapts the code exactly as decode does.
+func (c *huffmanCode) encodeSymbol(w *bitWriter, sym int) {
+	var first, index uint32
+	l := uint32(c.lens[sym])
+	if len(c.freqs) == 1 {
+		l = 1
+	}
+	for i := uint32(1); i < l; i++ {
+		index += c.count[i]
+		first = (first + c.count[i]) << 1
+	}
+	for j := index; ; j++ {
+		if int(c.sorted[j]) == sym {
+			w.writeBits(first+j-index, uint(l))
+			break
+		}
+	}
+	c.freqs[sym]++
+	c.untilRebuild--
+	if c.untilRebuild == 0 {
+		c.rebuild()
+	}
+}
+
+func slotFor(base []uint32, v uint32) int {
+	s := 0
+	for base[s+1] <= v {
+		s++
+	}
+	return s
+}
+
+type encoder struct {
+	m  decompressor
+	rc rangeEncoder
+	bw bitWriter
+
+	recentLZ    [numLZReps + 1]uint32
+	recentDelta [numDeltaReps + 1]uint64
+	prevItem    int
+}
+
+func (e *encoder) offset(c *huffmanCode, v uint32) {
+	s := slotFor(offsetSlotBase[:], v)
+	c.encodeSymbol(&e.bw, s)
+	e.bw.writeBits(v-offsetSlotBase[s], uint(extraOffsetBits[s]))
+}
+
+func (e *encoder) length(v uint32) {
+	s := slotFor(lengthSlotBase[:], v)
+	e.m.length.encodeSymbol(&e.bw, s)
+	e.bw.writeBits(v-lengthSlotBase[s], uint(extraLengthBits[s]))
+}
+
+func (e *encoder) literal(b byte) {
+	e.rc.encodeBit(&e.m.mainState, e.m.mainProbs[:], 0)
+	e.m.literal.encodeSymbol(&e.bw, int(b))
+	e.prevItem = 0
+}
+
+func (e *encoder) lzMatch(offset, length uint32) {
+	m := &e.m
+	e.rc.encodeBit(&m.mainState, m.mainProbs[:], 1)
+	e.rc.encodeBit(&m.matchState, m.matchProbs[:], 0)
+	late := e.prevItem & 1
+	q := &e.recentLZ
+	switch offset {
+	case q[0+late]:
+		e.rc.encodeBit(&m.lzState, m.lzProbs[:], 1)
+		e.rc.encodeBit(&m.lzRepStates[0], m.lzRepProbs[0][:], 0)
+		q[0+late] = q[0]
+	case q[1+late]:
+		e.rc.encodeBit(&m.lzState, m.lzProbs[:], 1)
+		e.rc.encodeBit(&m.lzRepStates[0], m.lzRepProbs[0][:], 1)
+		e.rc.encodeBit(&m.lzRepStates[1], m.lzRepProbs[1][:], 0)
+		q[1+late] = q[1]
+		q[1] = q[0]
+	case q[2+late]:
+		e.rc.encodeBit(&m.lzState, m.lzProbs[:], 1)
+		e.rc.encodeBit(&m.lzRepStates[0], m.lzRepProbs[0][:], 1)
+		e.rc.encodeBit(&m.lzRepStates[1], m.lzRepProbs[1][:], 1)
+		q[2+late] = q[2]
+		q[2] = q[1]
+		q[1] = q[0]
+	default:
+		e.rc.encodeBit(&m.lzState, m.lzProbs[:], 0)
+		e.offset(m.lzOffset, offset)
+		q[3] = q[2]
+		q[2] = q[1]
+		q[1] = q[0]
+	}
+	q[0] = offset
+	e.prevItem = 1
+	e.length(length)
+}
+
+func (e *encoder) deltaMatch(power, rawOffset, length uint32) {
+	m := &e.m
+	e.rc.encodeBit(&m.mainState, m.mainProbs[:], 1)
+	e.rc.encodeBit(&m.matchState, m.matchProbs[:], 1)
+	late := e.prevItem >> 1
+	q := &e.recentDelta
+	v := uint64(power)<<32 | uint64(rawOffset)
+	switch v {
+	case q[0+late]:
+		e.rc.encodeBit(&m.deltaState, m.deltaProbs[:], 1)
+		e.rc.encodeBit(&m.deltaRepStates[0], m.deltaRepProbs[0][:], 0)
+		q[0+late] = q[0]
+	case q[1+late]:
+		e.rc.encodeBit(&m.deltaState, m.deltaProbs[:], 1)
+		e.rc.encodeBit(&m.deltaRepStates[0], m.deltaRepProbs[0][:], 1)
+		e.rc.encodeBit(&m.deltaRepStates[1], m.deltaRepProbs[1][:], 0)
+		q[1+late] = q[1]
+		q[1] = q[0]
+	case q[2+late]:
+		e.rc.encodeBit(&m.deltaState, m.deltaProbs[:], 1)
+		e.rc.encodeBit(&m.deltaRepStates[0], m.deltaRepProbs[0][:], 1)
+		e.rc.encodeBit(&m.deltaRepStates[1], m.deltaRepProbs[1][:], 1)
+		q[2+late] = q[2]
+		q[2] = q[1]
+		q[1] = q[0]
+	default:
+		e.rc.encodeBit(&m.deltaState, m.deltaProbs[:], 0)
+		m.deltaPower.encodeSymbol(&e.bw, int(power))
+		e.offset(m.deltaOffset, rawOffset)
+		q[3] = q[2]
+		q[2] = q[1]
+		q[1] = q[0]
+	}
+	q[0] = v
+	e.prevItem = 2
+	e.length(length)
+}
+
+// compress is a simple greedy LZMS compressor that uses every kind of item the
+// format supports, so that the decompressor can be tested against it.
+func compress(in []byte) []byte {
+	data := append([]byte(nil), in...)
+	x86Filter(data, false)
+	e := &encoder{rc: rangeEncoder{rng: 0xffffffff, cacheSize: 1}}
+	e.m.initModels(len(data))
+	for i := range e.recentLZ {
+		e.recentLZ[i] = uint32(i + 1)
+	}
+	for i := range e.recentDelta {
+		e.recentDelta[i] = uint64(i + 1)
+	}
+	const window = 4096
+	for pos := 0; pos < len(data); {
+		// Prefer a delta match, with span 1 and offset 1, over a linear sequence.
+		n := 0
+		for pos >= 2 && pos+n < len(data) && data[pos+n] == 2*data[pos+n-1]-data[pos+n-2] {
+			n++
+		}
+		if n >= 8 {
+			e.deltaMatch(0, 1, uint32(n))
+			pos += n
+			continue
+		}
+		best, bestOff := 0, 0
+		for off := 1; off <= window && off <= pos; off++ {
+			l := 0
+			for pos+l < len(data) && data[pos+l] == data[pos+l-off] {
+				l++
+			}
+			if l > best {
+				best, bestOff = l, off
+			}
+		}
+		if best >= 3 {
+			e.lzMatch(uint32(bestOff), uint32(best))
+			pos += best
+			continue
+		}
+		e.literal(data[pos])
+		pos++
+	}
+	e.rc.flush()
+	e.bw.flush()
+	out := make([]byte, 0, 2*(len(e.rc.out)+len(e.bw.out)))
+	for _, w := range e.rc.out {
+		out = append(out, byte(w), byte(w>>8))
+	}
+	for i := len(e.bw.out) - 1; i >= 0; i-- {
+		out = append(out, byte(e.bw.out[i]), byte(e.bw.out[i]>>8))
+	}
+	return out
+}
+
+func testData() map[string][]byte {
+	rng := rand.New(rand.NewSource(1))
+	random := make([]byte, 8192)
+	rng.Read(random)
+	text := bytes.Repeat([]byte("the quick brown fox jumps over the lazy dog. "), 400)
+	words := make([]byte, 0, 20000)
+	for len(words) < 20000 {
+		words = append(words, "alpha beta gamma delta epsilon "[rng.Intn(5)*6:][:6]...)
+		words = append(words, byte('0'+rng.Intn(10)))
+	}
+	ramps := make([]byte, 0, 10000)
+	for len(ramps) < 10000 {
+		start, step := byte(rng.Intn(256)), byte(rng.Intn(8))
+		for i := 0; i < 10+rng.Intn(40); i++ {
+			ramps = append(ramps, start+byte(i)*step)
+		}
+		ramps = append(ramps, byte(rng.Intn(256)))
+	}
+	// Calls to a handful of targets, which the x86 filter translates.
+	code := make([]byte, 0, 10000)
+	for len(code) < 10000 {
+		if rng.Intn(3) == 0 {
+			target := uint32(rng.Intn(4) * 1000)
+			code = append(code, 0xe8, 0, 0, 0, 0)
+			binary.LittleEndian.PutUint32(code[len(code)-4:], target-uint32(len(code)))
+		} else {
+			code = append(code, byte(rng.Intn(16)))
+		}
+	}
+	return map[string][]byte{
+		"random": random,
+		"text":   text,
+		"words":  words,
+		"ramps":  ramps,
+		"code":   code,
+		"zeroes": make([]byte, 50000),
+		"short":  []byte("ab"),
+		"one":    []byte("a"),
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for name, in := range testData() {
+		c := compress(in)
+		out, err := Decompress(c, len(in))
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if !bytes.Equal(out, in) {
+			t.Fatalf("%s: data mismatch", name)
+		}
+		if len(in) > 1000 && name != "random" && len(c) >= len(in)/2 {
+			t.Errorf("%s: compressed to %d bytes from %d", name, len(c), len(in))
+		}
+	}
+}
+
+func TestX86Filter(t *testing.T) {
+	in := testData()["code"]
+	b := append([]byte(nil), in...)
+	x86Filter(b, false)
+	if bytes.Equal(b, in) {
+		t.Fatal("filter did not translate any calls")
+	}
+	x86Filter(b, true)
+	if !bytes.Equal(b, in) {
+		t.Fatal("data mismatch")
+	}
+}
+
+func TestDecompressCorrupt(t *testing.T) {
+	in := testData()["text"]
+	c := compress(in)
+	if _, err := Decompress(c[:3], len(in)); err == nil {
+		t.Fatal("expected error for short input")
+	}
+	bad := append([]byte(nil), c...)
+	for i := range bad[:len(bad)/2] {
+		bad[i] ^= 0x5a
+	}
+	out, err := Decompress(bad, len(in))
+	if err == nil && bytes.Equal(out, in) {
+		t.Fatal("corrupt data decompressed successfully")
+	}
+}
@@ -0,0 +1,58 @@
+package lzms
+
+import (
+	"bytes"
+	"syscall"
+	"testing"
+	"unsafe"
+)
+
+// The Compression API in Windows 8 and later produces the same LZMS format as DISM.
+// With COMPRESS_RAW, Compress emits a single LZMS block without the Compression API's
+// own header, which is what a WIM chunk holds.
+var (
+	modcabinet           = syscall.NewLazyDLL("cabinet.dll")
+	procCreateCompressor = modcabinet.NewProc("CreateCompressor")
+	procCompress         = modcabinet.NewProc("Compress")
+	procCloseCompressor  = modcabinet.NewProc("CloseCompressor")
+)
+
+const (
+	cCOMPRESS_ALGORITHM_LZMS = 5
+	cCOMPRESS_RAW            = 1 << 29
+)
+
+// systemCompress compresses in with the Compression API, skipping the test if LZMS
+// is not available.
+func systemCompress(t *testing.T, in []byte) []byte {
+	if err := procCreateCompressor.Find(); err != nil {
+		t.Skip("the Compression API is not available: ", err)
+	}
+	var h uintptr
+	r, _, err := procCreateCompressor.Call(cCOMPRESS_ALGORITHM_LZMS|cCOMPRESS_RAW, 0, uintptr(unsafe.Pointer(&h)))
+	if r == 0 {
+		t.Skip("raw LZMS compression is not available: ", err)
+	}
+	defer procCloseCompressor.Call(h)
+
+	out := make([]byte, len(in)+len(in)/2+4096)
+	var n uintptr
+	r, _, err = procCompress.Call(h, uintptr(unsafe.Pointer(&in[0])), uintptr(len(in)), uintptr(unsafe.Pointer(&out[0])), uintptr(len(out)), uintptr(unsafe.Pointer(&n)))
+	if r == 0 {
+		t.Fatal("Compress: ", err)
+	}
+	return out[:n]
+}
+
+func TestDecompressSystem(t *testing.T) {
+	for name, in := range testData() {
+		c := systemCompress(t, in)
+		out, err := Decompress(c, len(in))
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if !bytes.Equal(out, in) {
+			t.Fatalf("%s: data mismatch", name)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package wim
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Microsoft/go-winio/wim/xpress"
+)
+
+// solidResource builds a solid resource holding data, compressed with XPRESS in
+// chunks of size chunk.
+func solidResource(data []byte, chunk int) []byte {
+	var sizes, chunks bytes.Buffer
+	binary.Write(&sizes, binary.LittleEndian, &solidHeader{OriginalSize: int64(len(data)), ChunkSize: uint32(chunk), Format: formatXpress})
+	for i := 0; i < len(data); i += chunk {
+		c := data[i:]
+		if len(c) > chunk {
+			c = c[:chunk]
+		}
+		if z := xpress.Compress(c); z != nil && len(z) < len(c) {
+			c = z
+		}
+		binary.Write(&sizes, binary.LittleEndian, uint32(len(c)))
+		chunks.Write(c)
+	}
+	return append(sizes.Bytes(), chunks.Bytes()...)
+}
+
+// solidWim moves the file data of the uncompressed WIM b into a run of two solid
+// resources.
+func solidWim(t *testing.T, b []byte) []byte {
+	var hdr wimHeader
+	if err := binary.Read(bytes.NewReader(b), binary.LittleEndian, &hdr); err != nil {
+		t.Fatal(err)
+	}
+	table := bytes.NewReader(b[hdr.OffsetTable.Offset : hdr.OffsetTable.Offset+hdr.OffsetTable.CompressedSize()])
+	var newTable bytes.Buffer
+	var blobs []streamDescriptor
+	var data [2][]byte
+	for {
+		var sd streamDescriptor
+		err := binary.Read(table, binary.LittleEndian, &sd)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sd.Flags()&resFlagMetadata != 0 {
+			binary.Write(&newTable, binary.LittleEndian, &sd)
+			continue
+		}
+		start, end := sd.Offset, sd.Offset+sd.CompressedSize()
+		n := len(blobs) % 2
+		sd.Offset = int64(len(data[n]))
+		data[n] = append(data[n], b[start:end]...)
+		sd.FlagsAndCompressedSize = uint64(sd.OriginalSize) | uint64(resFlagSolid)<<56
+		blobs = append(blobs, sd)
+		// Make sure the data is only available from the solid resources.
+		for i := start; i < end; i++ {
+			b[i] = 0
+		}
+	}
+	if len(blobs) < 2 {
+		t.Fatal("not enough resources")
+	}
+	// Offsets are relative to the start of the run, not of each resource.
+	for i := 1; i < len(blobs); i += 2 {
+		blobs[i].Offset += int64(len(data[0]))
+	}
+	for _, d := range data {
+		res := solidResource(d, 4096)
+		sd := streamDescriptor{
+			resourceDescriptor: resourceDescriptor{
+				FlagsAndCompressedSize: uint64(len(res)) | uint64(resFlagSolid|resFlagCompressed)<<56,
+				Offset:                 int64(len(b)),
+				OriginalSize:           solidResourceSize,
+			},
+			PartNumber: 1,
+		}
+		b = append(b, res...)
+		binary.Write(&newTable, binary.LittleEndian, &sd)
+	}
+	for i := range blobs {
+		binary.Write(&newTable, binary.LittleEndian, &blobs[i])
+	}
+	hdr.OffsetTable = resourceDescriptor{FlagsAndCompressedSize: uint64(newTable.Len()), Offset: int64(len(b)), OriginalSize: int64(newTable.Len())}
+	b = append(b, newTable.Bytes()...)
+	var hb bytes.Buffer
+	binary.Write(&hb, binary.LittleEndian, &hdr)
+	copy(b, hb.Bytes())
+	return b
+}
+
+func TestSolidResources(t *testing.T) {
+	files := map[string]*testFile{
+		"a": {data: []byte("first file")},
+		"b": {data: bytes.Repeat([]byte("second file "), 10000)},
+		"c": {data: []byte("third file")},
+		"d": {data: bytes.Repeat([]byte("fourth file "), 1000), streams: map[string][]byte{"ads": []byte("stream")}},
+	}
+	path := writeTestWim(t, nil, files, []string{"a", "b", "c", "d"})
+	defer os.RemoveAll(filepath.Dir(path))
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewReaderWithOptions(bytes.NewReader(solidWim(t, b)), &ReaderOptions{VerifyHashes: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	root, err := r.Image[0].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	children, err := root.Readdir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(children) != len(files) {
+		t.Fatalf("got %d files", len(children))
+	}
+	for _, c := range children {
+		rc, err := c.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, files[c.Name].data) {
+			t.Errorf("%s: mismatched data %q", c.Name, data)
+		}
+		for _, s := range c.Streams {
+			if s.Name == "" {
+				continue
+			}
+			rc, err := s.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := ioutil.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(data, files[c.Name].streams[s.Name]) {
+				t.Errorf("%s:%s: mismatched data %q", c.Name, s.Name, data)
+			}
+		}
+	}
+}
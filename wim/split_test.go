@@ -0,0 +1,129 @@
+package wim
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// splitWim splits the WIM b into two parts, moving all but the first file resource
+// into the second part.
+func splitWim(t *testing.T, b []byte) ([]byte, []byte) {
+	var hdr wimHeader
+	if err := binary.Read(bytes.NewReader(b), binary.LittleEndian, &hdr); err != nil {
+		t.Fatal(err)
+	}
+	table := bytes.NewReader(b[hdr.OffsetTable.Offset : hdr.OffsetTable.Offset+hdr.OffsetTable.CompressedSize()])
+	var table1, table2 bytes.Buffer
+	part2 := make([]byte, wimHeaderSize)
+	n := 0
+	for {
+		var sd streamDescriptor
+		err := binary.Read(table, binary.LittleEndian, &sd)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sd.Flags()&resFlagMetadata != 0 || n == 0 {
+			binary.Write(&table1, binary.LittleEndian, &sd)
+			if sd.Flags()&resFlagMetadata == 0 {
+				n++
+			}
+			continue
+		}
+		start, end := sd.Offset, sd.Offset+sd.CompressedSize()
+		sd.Offset = int64(len(part2))
+		sd.PartNumber = 2
+		part2 = append(part2, b[start:end]...)
+		binary.Write(&table2, binary.LittleEndian, &sd)
+		// Make sure the data is only available from the second part.
+		for i := start; i < end; i++ {
+			b[i] = 0
+		}
+		n++
+	}
+	if n < 2 {
+		t.Fatal("not enough resources to split")
+	}
+
+	hdr1 := hdr
+	hdr1.Flags |= hdrFlagSpanned
+	hdr1.TotalParts = 2
+	hdr1.OffsetTable = resourceDescriptor{FlagsAndCompressedSize: uint64(table1.Len()), Offset: int64(len(b)), OriginalSize: int64(table1.Len())}
+	part1 := append(b, table1.Bytes()...)
+	var hb bytes.Buffer
+	binary.Write(&hb, binary.LittleEndian, &hdr1)
+	copy(part1, hb.Bytes())
+
+	hdr2 := hdr1
+	hdr2.PartNumber = 2
+	hdr2.XMLData = resourceDescriptor{}
+	hdr2.OffsetTable = resourceDescriptor{FlagsAndCompressedSize: uint64(table2.Len()), Offset: int64(len(part2)), OriginalSize: int64(table2.Len())}
+	part2 = append(part2, table2.Bytes()...)
+	hb.Reset()
+	binary.Write(&hb, binary.LittleEndian, &hdr2)
+	copy(part2, hb.Bytes())
+	return part1, part2
+}
+
+func TestSplitReader(t *testing.T) {
+	files := map[string]*testFile{
+		"a": {data: []byte("first file")},
+		"b": {data: bytes.Repeat([]byte("second file "), 10000)},
+		"c": {data: []byte("third file")},
+	}
+	path := writeTestWim(t, &WriterOptions{Compression: CompressionXpress}, files, []string{"a", "b", "c"})
+	defer os.RemoveAll(filepath.Dir(path))
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part1, part2 := splitWim(t, b)
+
+	if _, err := NewReader(bytes.NewReader(part1)); err == nil {
+		t.Fatal("expected NewReader to fail on a split WIM")
+	}
+	if _, err := NewSplitReader([]io.ReaderAt{bytes.NewReader(part1)}); err == nil {
+		t.Fatal("expected missing part to fail")
+	}
+	if _, err := NewSplitReader([]io.ReaderAt{bytes.NewReader(part1), bytes.NewReader(part1)}); err == nil {
+		t.Fatal("expected duplicate part to fail")
+	}
+
+	r, err := NewSplitReaderWithOptions([]io.ReaderAt{bytes.NewReader(part2), bytes.NewReader(part1)}, &ReaderOptions{VerifyHashes: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	root, err := r.Image[0].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	children, err := root.Readdir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(children) != len(files) {
+		t.Fatalf("got %d files", len(children))
+	}
+	for _, c := range children {
+		rc, err := c.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, files[c.Name].data) {
+			t.Errorf("%s: mismatched data %q", c.Name, data)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package wim
+
+import (
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+)
+
+var errInvalidIntegrityTable = errors.New("invalid integrity table")
+
+// verifyResource reads the resource res in full and checks its hash.
+func (r *Reader) verifyResource(res *resourceDescriptor, want SHA1Hash) error {
+	rc, err := r.resourceReader(res)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	h := sha1.New()
+	if _, err := io.Copy(h, rc); err != nil {
+		return err
+	}
+	var sum SHA1Hash
+	copy(sum[:], h.Sum(nil))
+	if sum != want {
+		return ErrHashMismatch
+	}
+	return nil
+}
+
+// verifyIntegrity checks the part of a WIM whose header is hdr, and which starts at
+// offset base of r.r, against its integrity table. The table holds the SHA-1 hash of
+// each chunk of the part, from the end of the header to the end of the offset table.
+func (r *Reader) verifyIntegrity(hdr *wimHeader, base int64, fileData map[SHA1Hash]resourceDescriptor) error {
+	if hdr.Integrity.CompressedSize() == 0 {
+		return &ParseError{Oper: "integrity table", Err: ErrNoIntegrityTable}
+	}
+	res := hdr.Integrity
+	res.Offset += base
+	b, err := r.readResource(&res)
+	if err != nil {
+		return &ParseError{Oper: "integrity table", Err: err}
+	}
+	if len(b) < 12 {
+		return &ParseError{Oper: "integrity table", Err: errInvalidIntegrityTable}
+	}
+	count := int64(binary.LittleEndian.Uint32(b[4:8]))
+	chunk := int64(binary.LittleEndian.Uint32(b[8:12]))
+	end := hdr.OffsetTable.Offset + hdr.OffsetTable.CompressedSize()
+	if chunk == 0 || int64(len(b)) < 12+count*sha1.Size || count != (end-wimHeaderSize+chunk-1)/chunk {
+		return &ParseError{Oper: "integrity table", Err: errInvalidIntegrityTable}
+	}
+	for i := int64(0); i < count; i++ {
+		off := wimHeaderSize + i*chunk
+		size := end - off
+		if size > chunk {
+			size = chunk
+		}
+		h := sha1.New()
+		if _, err := io.Copy(h, io.NewSectionReader(r.r, base+off, size)); err != nil {
+			return &ParseError{Oper: "integrity check", Err: err}
+		}
+		var sum, want SHA1Hash
+		copy(sum[:], h.Sum(nil))
+		copy(want[:], b[12+i*sha1.Size:])
+		if sum != want {
+			return &ParseError{Oper: "integrity check", Path: corruptRegion(fileData, base+off, size, off), Err: ErrHashMismatch}
+		}
+	}
+	return nil
+}
+
+// corruptRegion describes the region [off, off+size) of r.r, naming a resource that
+// overlaps it if there is one. partOff is the offset of the region within its part.
+func corruptRegion(fileData map[SHA1Hash]resourceDescriptor, off, size, partOff int64) string {
+	s := fmt.Sprintf("of %d bytes at offset %d", size, partOff)
+	for hash, res := range fileData {
+		// File data in solid resources has no offset of its own.
+		if res.Flags()&resFlagSolid == 0 && res.Offset < off+size && res.Offset+res.CompressedSize() > off {
+			s += fmt.Sprintf(" (in resource %x)", hash[:])
+			break
+		}
+	}
+	return s
+}
+
+// openResource opens the resource res, verifying its contents against hash once they
+// have been read if the Reader was asked to.
+func (r *Reader) openResource(res *resourceDescriptor, hash SHA1Hash, name string) (io.ReadCloser, error) {
+	rc, err := r.resourceReader(res)
+	if err != nil || !r.opts.VerifyHashes || hash == (SHA1Hash{}) {
+		return rc, err
+	}
+	return &verifyingReader{ReadCloser: rc, h: sha1.New(), want: hash, left: res.OriginalSize, name: name}, nil
+}
+
+type verifyingReader struct {
+	io.ReadCloser
+	h    hash.Hash
+	want SHA1Hash
+	left int64
+	name string
+}
+
+func (v *verifyingReader) Read(b []byte) (int, error) {
+	n, err := v.ReadCloser.Read(b)
+	v.h.Write(b[:n])
+	v.left -= int64(n)
+	if err == io.EOF && v.left == 0 {
+		var sum SHA1Hash
+		copy(sum[:], v.h.Sum(nil))
+		if sum != v.want {
+			return n, &ParseError{Oper: "file data", Path: v.name, Err: ErrHashMismatch}
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,67 @@
+package wim
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func verifyTestWim(t *testing.T) ([]byte, []byte) {
+	data := bytes.Repeat([]byte("integrity "), 10000)
+	files := map[string]*testFile{"a": {data: data}}
+	path := writeTestWim(t, &WriterOptions{Integrity: true}, files, []string{"a"})
+	defer os.RemoveAll(filepath.Dir(path))
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b, data
+}
+
+func TestVerifyIntegrity(t *testing.T) {
+	b, _ := verifyTestWim(t)
+	if _, err := NewReaderWithOptions(bytes.NewReader(b), &ReaderOptions{VerifyIntegrity: true, VerifyHashes: true}); err != nil {
+		t.Fatal(err)
+	}
+	// Corrupt the file data, which immediately follows the header.
+	b[wimHeaderSize+100] ^= 1
+	if _, err := NewReader(bytes.NewReader(b)); err != nil {
+		t.Fatal(err)
+	}
+	_, err := NewReaderWithOptions(bytes.NewReader(b), &ReaderOptions{VerifyIntegrity: true})
+	if perr, ok := err.(*ParseError); !ok || perr.Err != ErrHashMismatch {
+		t.Fatalf("expected hash mismatch, got %v", err)
+	}
+}
+
+func TestVerifyHashes(t *testing.T) {
+	b, data := verifyTestWim(t)
+	b[wimHeaderSize+100] ^= 1
+	r, err := NewReaderWithOptions(bytes.NewReader(b), &ReaderOptions{VerifyHashes: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	root, err := r.Image[0].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	children, err := root.Readdir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc, err := children[0].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	got, err := ioutil.ReadAll(rc)
+	if perr, ok := err.(*ParseError); !ok || perr.Err != ErrHashMismatch || perr.Path != "a" {
+		t.Fatalf("expected hash mismatch, got %v", err)
+	}
+	if len(got) != len(data) {
+		t.Fatalf("got %d bytes", len(got))
+	}
+}
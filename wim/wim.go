@@ -6,7 +6,6 @@ package wim
 
 import (
 	"bytes"
-	"crypto/sha1"
 	"encoding/binary"
 	"encoding/xml"
 	"errors"
@@ -17,6 +16,8 @@ import (
 	"sync"
 	"time"
 	"unicode/utf16"
+
+	"github.com/Microsoft/go-winio/wim/lzms"
 )
 
 // File attribute constants from Windows.
@@ -60,6 +61,11 @@ const (
 
 var wimImageTag = [...]byte{'M', 'S', 'W', 'I', 'M', 0, 0, 0}
 
+const (
+	wimHeaderSize = 208
+	wimVersion    = 0x10d00
+)
+
 type guid struct {
 	Data1 uint32
 	Data2 uint16
@@ -84,11 +90,16 @@ const (
 	resFlagMetadata
 	resFlagCompressed
 	resFlagSpanned
+	resFlagSolid
 )
 
-const validate = false
+const supportedResFlags = resFlagMetadata | resFlagCompressed | resFlagSolid
 
-const supportedResFlags = resFlagMetadata | resFlagCompressed
+// solidResourceSize is the original size recorded in the offset table for a solid
+// resource, whose real size is in its header. The file data in a solid resource is
+// described by separate offset table entries that give its offset within the
+// uncompressed contents of the run of solid resources that precedes them.
+const solidResourceSize = 0x100000000
 
 func (r *resourceDescriptor) Flags() resFlag {
 	return resFlag(r.FlagsAndCompressedSize >> 56)
@@ -133,9 +144,10 @@ const (
 	hdrFlagCompressReserved hdrFlag = 1 << (iota + 16)
 	hdrFlagCompressXpress
 	hdrFlagCompressLzx
+	hdrFlagCompressLzms
 )
 
-const supportedHdrFlags = hdrFlagRpFix | hdrFlagReadOnly | hdrFlagCompressed | hdrFlagCompressLzx
+const supportedHdrFlags = hdrFlagRpFix | hdrFlagReadOnly | hdrFlagCompressed | hdrFlagCompressXpress | hdrFlagCompressLzx | hdrFlagCompressLzms
 
 type wimHeader struct {
 	ImageTag        [8]byte
@@ -151,11 +163,22 @@ type wimHeader struct {
 	XMLData         resourceDescriptor
 	BootMetadata    resourceDescriptor
 	BootIndex       uint32
-	Padding         uint32
 	Integrity       resourceDescriptor
 	Unused          [60]byte
 }
 
+// format returns the compression format of the WIM's compressed resources.
+func (hdr *wimHeader) format() compressionFormat {
+	switch {
+	case hdr.Flags&hdrFlagCompressXpress != 0:
+		return formatXpress
+	case hdr.Flags&hdrFlagCompressLzms != 0:
+		return formatLzms
+	default:
+		return formatLzx
+	}
+}
+
 type securityblockDisk struct {
 	TotalLength uint32
 	NumEntries  uint32
@@ -232,6 +255,18 @@ func (ft *Filetime) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
 	return nil
 }
 
+// MarshalXML marshals the time into a WIM XML blob.
+func (ft *Filetime) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	type time struct {
+		High string `xml:"HIGHPART"`
+		Low  string `xml:"LOWPART"`
+	}
+	return e.EncodeElement(time{
+		High: fmt.Sprintf("0x%08X", ft.HighDateTime),
+		Low:  fmt.Sprintf("0x%08X", ft.LowDateTime),
+	}, start)
+}
+
 type info struct {
 	Image []ImageInfo `xml:"IMAGE"`
 }
@@ -281,11 +316,34 @@ func (e *ParseError) Error() string {
 	return fmt.Sprintf("WIM parse error: %s %s: %s", e.Oper, e.Path, e.Err.Error())
 }
 
+var (
+	// ErrHashMismatch is returned when the contents of a resource or of a region of
+	// the file do not match their SHA-1 hash.
+	ErrHashMismatch = errors.New("SHA-1 hash mismatch")
+	// ErrNoIntegrityTable is returned when integrity verification is requested for a
+	// WIM without an integrity table.
+	ErrNoIntegrityTable = errors.New("WIM has no integrity table")
+)
+
+// ReaderOptions controls how a Reader verifies a WIM file.
+type ReaderOptions struct {
+	// VerifyIntegrity checks the file against its integrity table when it is
+	// opened, which requires reading all of it.
+	VerifyIntegrity bool
+
+	// VerifyHashes checks the SHA-1 hash of each metadata resource when the file
+	// is opened, and of file and stream data once it has been read to the end.
+	// A mismatch is reported by Read in place of io.EOF.
+	VerifyHashes bool
+}
+
 // Reader provides functions to read a WIM file.
 type Reader struct {
 	hdr      wimHeader
 	r        io.ReaderAt
+	opts     ReaderOptions
 	fileData map[SHA1Hash]resourceDescriptor
+	solid    []resourceDescriptor
 
 	XMLInfo string   // The XML information about the WIM.
 	Image   []*Image // The WIM's images.
@@ -343,36 +401,138 @@ type File struct {
 	subdirOffset int64
 }
 
-// NewReader returns a Reader that can be used to read WIM file data.
-func NewReader(f io.ReaderAt) (*Reader, error) {
-	r := &Reader{r: f}
+// partShift is the shift that places each part of a split WIM in its own range of
+// offsets, so that resource descriptors can address all the parts.
+const partShift = 48
+
+// splitReaderAt reads the parts of a split WIM as a single io.ReaderAt, with part n
+// starting at offset (n-1)<<partShift. Resources never span parts, so each read falls
+// within one part.
+type splitReaderAt []io.ReaderAt
+
+func (s splitReaderAt) ReadAt(b []byte, off int64) (int, error) {
+	i := off >> partShift
+	if i < 0 || i >= int64(len(s)) {
+		return 0, io.EOF
+	}
+	return s[i].ReadAt(b, off&(1<<partShift-1))
+}
+
+func readHeader(f io.ReaderAt) (*wimHeader, error) {
+	var hdr wimHeader
 	section := io.NewSectionReader(f, 0, 0xffff)
-	err := binary.Read(section, binary.LittleEndian, &r.hdr)
+	err := binary.Read(section, binary.LittleEndian, &hdr)
 	if err != nil {
 		return nil, err
 	}
 
-	if r.hdr.ImageTag != wimImageTag {
+	if hdr.ImageTag != wimImageTag {
 		return nil, &ParseError{Oper: "image tag", Err: errors.New("not a WIM file")}
 	}
 
-	if r.hdr.Flags&^supportedHdrFlags != 0 {
-		return nil, fmt.Errorf("unsupported WIM flags %x", r.hdr.Flags&^supportedHdrFlags)
+	flags := hdr.Flags
+	if hdr.TotalParts > 1 {
+		flags &^= hdrFlagSpanned
 	}
-
-	if r.hdr.CompressionSize != 0x8000 {
-		return nil, fmt.Errorf("unsupported compression size %d", r.hdr.CompressionSize)
+	if flags&^supportedHdrFlags != 0 {
+		return nil, fmt.Errorf("unsupported WIM flags %x", flags&^supportedHdrFlags)
 	}
 
-	if r.hdr.TotalParts != 1 {
-		return nil, errors.New("multi-part WIM not supported")
+	// LZMS compressed WIMs may use any power of two from 32KB to 1GB as the chunk size.
+	size := hdr.CompressionSize
+	if size != 0x8000 && (hdr.Flags&hdrFlagCompressLzms == 0 || size&(size-1) != 0 || size < 0x8000 || size > lzms.MaxBlockSize) {
+		return nil, fmt.Errorf("unsupported compression size %d", hdr.CompressionSize)
 	}
+	return &hdr, nil
+}
 
-	fileData, images, err := r.readOffsetTable(&r.hdr.OffsetTable)
+// NewReader returns a Reader that can be used to read WIM file data.
+func NewReader(f io.ReaderAt) (*Reader, error) {
+	return NewReaderWithOptions(f, nil)
+}
+
+// NewReaderWithOptions returns a Reader that verifies WIM file data as specified by
+// opts.
+func NewReaderWithOptions(f io.ReaderAt, opts *ReaderOptions) (*Reader, error) {
+	hdr, err := readHeader(f)
 	if err != nil {
 		return nil, err
 	}
 
+	if hdr.TotalParts != 1 {
+		return nil, errors.New("multi-part WIM must be opened with NewSplitReader")
+	}
+
+	return newReader(f, []*wimHeader{hdr}, opts)
+}
+
+// NewSplitReader returns a Reader for a split WIM, such as install.swm, install2.swm,
+// and so on, given all of its parts in any order. Images are read from the first part
+// and file data from whichever part holds it.
+func NewSplitReader(parts []io.ReaderAt) (*Reader, error) {
+	return NewSplitReaderWithOptions(parts, nil)
+}
+
+// NewSplitReaderWithOptions returns a Reader for a split WIM, as NewSplitReader does,
+// that verifies it as directed by opts.
+func NewSplitReaderWithOptions(parts []io.ReaderAt, opts *ReaderOptions) (*Reader, error) {
+	if len(parts) == 0 {
+		return nil, &ParseError{Oper: "split WIM", Err: errors.New("no parts")}
+	}
+	ordered := make(splitReaderAt, len(parts))
+	hdrs := make([]*wimHeader, len(parts))
+	for _, p := range parts {
+		hdr, err := readHeader(p)
+		if err != nil {
+			return nil, err
+		}
+		if int(hdr.TotalParts) != len(parts) {
+			return nil, &ParseError{Oper: "split WIM", Err: fmt.Errorf("WIM has %d parts, but %d were provided", hdr.TotalParts, len(parts))}
+		}
+		n := int(hdr.PartNumber)
+		if n < 1 || n > len(parts) || hdrs[n-1] != nil {
+			return nil, &ParseError{Oper: "split WIM", Err: fmt.Errorf("invalid or duplicate part number %d", n)}
+		}
+		ordered[n-1] = p
+		hdrs[n-1] = hdr
+	}
+	for _, hdr := range hdrs[1:] {
+		if hdr.WIMGuid != hdrs[0].WIMGuid {
+			return nil, &ParseError{Oper: "split WIM", Err: errors.New("parts are not from the same WIM")}
+		}
+	}
+	return newReader(ordered, hdrs, opts)
+}
+
+func newReader(f io.ReaderAt, hdrs []*wimHeader, opts *ReaderOptions) (*Reader, error) {
+	r := &Reader{r: f, hdr: *hdrs[0]}
+	if opts != nil {
+		r.opts = *opts
+	}
+	fileData := make(map[SHA1Hash]resourceDescriptor)
+	var images []*Image
+	for i, hdr := range hdrs {
+		table := hdr.OffsetTable
+		table.Offset += int64(i) << partShift
+		var err error
+		images, err = r.readOffsetTable(&table, len(hdrs), fileData, images)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(images) != int(r.hdr.ImageCount) {
+		return nil, &ParseError{Oper: "offset table", Err: errors.New("mismatched image count")}
+	}
+
+	if r.opts.VerifyIntegrity {
+		for i, hdr := range hdrs {
+			if err := r.verifyIntegrity(hdr, int64(i)<<partShift, fileData); err != nil {
+				return nil, err
+			}
+		}
+	}
+
 	xmlinfo, err := r.readXML()
 	if err != nil {
 		return nil, err
@@ -413,12 +573,20 @@ func (r *Reader) resourceReader(hdr *resourceDescriptor) (io.ReadCloser, error)
 
 func (r *Reader) resourceReaderWithOffset(hdr *resourceDescriptor, offset int64) (io.ReadCloser, error) {
 	var sr io.ReadCloser
+	if hdr.Flags()&resFlagSolid != 0 {
+		res := &r.solid[hdr.CompressedSize()]
+		cr, err := newSolidReader(io.NewSectionReader(r.r, res.Offset, res.CompressedSize()), hdr.Offset+offset)
+		if err != nil {
+			return nil, err
+		}
+		return &solidReader{io.LimitReader(cr, hdr.OriginalSize-offset), cr}, nil
+	}
 	section := io.NewSectionReader(r.r, hdr.Offset, hdr.CompressedSize())
 	if hdr.Flags()&resFlagCompressed == 0 {
 		section.Seek(offset, 0)
 		sr = ioutil.NopCloser(section)
 	} else {
-		cr, err := newCompressedReader(section, hdr.OriginalSize, offset)
+		cr, err := newCompressedReader(section, hdr.OriginalSize, offset, r.hdr.format(), int64(r.hdr.CompressionSize))
 		if err != nil {
 			return nil, err
 		}
@@ -428,6 +596,12 @@ func (r *Reader) resourceReaderWithOffset(hdr *resourceDescriptor, offset int64)
 	return sr, nil
 }
 
+// solidReader reads a piece of file data from a solid resource.
+type solidReader struct {
+	io.Reader
+	io.Closer
+}
+
 func (r *Reader) readResource(hdr *resourceDescriptor) ([]byte, error) {
 	rsrc, err := r.resourceReader(hdr)
 	if err != nil {
@@ -460,49 +634,64 @@ func (r *Reader) readXML() (string, error) {
 	return string(utf16.Decode(XMLData[1:])), nil
 }
 
-func (r *Reader) readOffsetTable(res *resourceDescriptor) (map[SHA1Hash]resourceDescriptor, []*Image, error) {
-	fileData := make(map[SHA1Hash]resourceDescriptor)
-	var images []*Image
-
+// readOffsetTable reads the offset table of one part of a WIM, adding its resources
+// to fileData and images.
+func (r *Reader) readOffsetTable(res *resourceDescriptor, parts int, fileData map[SHA1Hash]resourceDescriptor, images []*Image) ([]*Image, error) {
 	offsetTable, err := r.readResource(res)
 	if err != nil {
-		return nil, nil, &ParseError{Oper: "offset table", Err: err}
+		return nil, &ParseError{Oper: "offset table", Err: err}
 	}
 
 	br := bytes.NewReader(offsetTable)
-	for i := 0; ; i++ {
+	var (
+		run        []int // indexes in r.solid of the current run of solid resources
+		inRunFiles bool
+	)
+	for {
 		var res streamDescriptor
 		err := binary.Read(br, binary.LittleEndian, &res)
 		if err == io.EOF {
 			break
 		}
 		if err != nil {
-			return nil, nil, &ParseError{Oper: "offset table", Err: err}
+			return nil, &ParseError{Oper: "offset table", Err: err}
 		}
 		if res.Flags()&^supportedResFlags != 0 {
-			return nil, nil, &ParseError{Oper: "offset table", Err: errors.New("unsupported resource flag")}
+			return nil, &ParseError{Oper: "offset table", Err: errors.New("unsupported resource flag")}
 		}
 
-		// Validation for ad-hoc testing
-		if validate {
-			sec, err := r.resourceReader(&res.resourceDescriptor)
+		if res.Flags()&resFlagSolid != 0 && res.OriginalSize != solidResourceSize {
+			desc, err := r.solidDescriptor(&res.resourceDescriptor, run)
 			if err != nil {
-				panic(fmt.Sprint(i, err))
+				return nil, err
 			}
-			hash := sha1.New()
-			_, err = io.Copy(hash, sec)
-			sec.Close()
-			if err != nil {
-				panic(fmt.Sprint(i, err))
+			res.resourceDescriptor = desc
+			inRunFiles = true
+		} else if parts > 1 {
+			if res.PartNumber < 1 || int(res.PartNumber) > parts {
+				return nil, &ParseError{Oper: "offset table", Err: fmt.Errorf("invalid part number %d", res.PartNumber)}
 			}
-			var cmphash SHA1Hash
-			copy(cmphash[:], hash.Sum(nil))
-			if cmphash != res.Hash {
-				panic(fmt.Sprint(i, "hash mismatch"))
+			res.Offset += int64(res.PartNumber-1) << partShift
+		}
+
+		// Metadata resources are always read in full, so verify them up front. File
+		// data is verified as it is read.
+		if r.opts.VerifyHashes && res.Flags()&resFlagMetadata != 0 {
+			if err := r.verifyResource(&res.resourceDescriptor, res.Hash); err != nil {
+				return nil, &ParseError{Oper: "metadata resource", Path: fmt.Sprintf("%d", len(images)+1), Err: err}
 			}
 		}
 
-		if res.Flags()&resFlagMetadata != 0 {
+		if res.Flags()&resFlagSolid != 0 && res.OriginalSize == solidResourceSize {
+			if inRunFiles {
+				run = nil
+				inRunFiles = false
+			}
+			if err := r.addSolidResource(&res.resourceDescriptor); err != nil {
+				return nil, err
+			}
+			run = append(run, len(r.solid)-1)
+		} else if res.Flags()&resFlagMetadata != 0 {
 			image := &Image{
 				wim:    r,
 				offset: res.resourceDescriptor,
@@ -513,11 +702,40 @@ func (r *Reader) readOffsetTable(res *resourceDescriptor) (map[SHA1Hash]resource
 		}
 	}
 
-	if len(images) != int(r.hdr.ImageCount) {
-		return nil, nil, &ParseError{Oper: "offset table", Err: errors.New("mismatched image count")}
+	return images, nil
+}
+
+// addSolidResource adds the solid resource res to r.solid, replacing its original size
+// with the one from its header.
+func (r *Reader) addSolidResource(res *resourceDescriptor) error {
+	var hdr solidHeader
+	if err := binary.Read(io.NewSectionReader(r.r, res.Offset, res.CompressedSize()), binary.LittleEndian, &hdr); err != nil {
+		return &ParseError{Oper: "solid resource", Err: err}
 	}
+	desc := *res
+	desc.OriginalSize = hdr.OriginalSize
+	r.solid = append(r.solid, desc)
+	return nil
+}
 
-	return fileData, images, nil
+// solidDescriptor returns the descriptor used to read the file data described by res,
+// which lies in the run of solid resources run. It has resFlagSolid set, the index
+// of the resource in r.solid in place of the compressed size, and the offset and size
+// of the data within that resource.
+func (r *Reader) solidDescriptor(res *resourceDescriptor, run []int) (resourceDescriptor, error) {
+	off := res.Offset
+	for _, i := range run {
+		size := r.solid[i].OriginalSize
+		if off >= 0 && off+res.OriginalSize <= size {
+			return resourceDescriptor{
+				FlagsAndCompressedSize: uint64(i) | uint64(resFlagSolid)<<56,
+				Offset:                 off,
+				OriginalSize:           res.OriginalSize,
+			}, nil
+		}
+		off -= size
+	}
+	return resourceDescriptor{}, &ParseError{Oper: "offset table", Err: errors.New("file data outside of solid resources")}
 }
 
 func (r *Reader) readSecurityDescriptors(rsrc io.Reader) (sds [][]byte, n int64, err error) {
@@ -843,12 +1061,12 @@ func (img *Image) readNextStream(r io.Reader) (*Stream, int64, error) {
 
 // Open returns an io.ReadCloser that can be used to read the stream's contents.
 func (s *Stream) Open() (io.ReadCloser, error) {
-	return s.wim.resourceReader(&s.offset)
+	return s.wim.openResource(&s.offset, s.Hash, s.Name)
 }
 
 // Open returns an io.ReadCloser that can be used to read the file's contents.
 func (f *File) Open() (io.ReadCloser, error) {
-	return f.img.wim.resourceReader(&f.offset)
+	return f.img.wim.openResource(&f.offset, f.Hash, f.Name)
 }
 
 // Readdir reads the directory entries.
@@ -0,0 +1,708 @@
+package wim
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/Microsoft/go-winio/wim/xpress"
+)
+
+// CompressionType selects how a Writer compresses file data and metadata.
+type CompressionType int
+
+const (
+	// CompressionNone stores resources uncompressed.
+	CompressionNone CompressionType = iota
+	// CompressionXpress compresses each 32KB chunk of a resource with XPRESS Huffman,
+	// which is what DISM uses by default for images that are applied directly.
+	CompressionXpress
+)
+
+// integrityChunkSize is the size of the regions of the file hashed by the integrity
+// table.
+const integrityChunkSize = 10 * 1024 * 1024
+
+var (
+	errImageOpen     = errors.New("the previous image has not been closed")
+	errClosed        = errors.New("WIM writer is closed")
+	errShortData     = errors.New("data is shorter than its size")
+	errNoReaderAt    = errors.New("writing an integrity table requires an io.ReaderAt")
+	errNotADirectory = errors.New("parent is not a directory")
+)
+
+// WriterOptions controls how a Writer lays out a WIM file.
+type WriterOptions struct {
+	Compression CompressionType
+
+	// Integrity adds an integrity table, which holds the SHA-1 hashes of the
+	// contents of the file so that tools such as DISM can verify it. The
+	// io.WriteSeeker passed to NewWriter must also implement io.ReaderAt, as
+	// *os.File does.
+	Integrity bool
+}
+
+// Writer writes a new WIM file. Add images to it with AddImage, then call Close to
+// write the offset table, XML data, and header.
+//
+// File data is stored once for each distinct SHA-1 hash, so files with the same
+// contents share a resource.
+type Writer struct {
+	w        io.WriteSeeker
+	opts     WriterOptions
+	offset   int64
+	blobs    map[SHA1Hash]*streamDescriptor
+	order    []SHA1Hash
+	metadata []streamDescriptor
+	images   []imageXML
+	cur      *ImageWriter
+	chunk    []byte
+	closed   bool
+}
+
+type imageXML struct {
+	Index        int          `xml:"INDEX,attr"`
+	DirCount     int          `xml:"DIRCOUNT"`
+	FileCount    int          `xml:"FILECOUNT"`
+	TotalBytes   int64        `xml:"TOTALBYTES"`
+	CreationTime Filetime     `xml:"CREATIONTIME"`
+	ModTime      Filetime     `xml:"LASTMODIFICATIONTIME"`
+	Windows      *WindowsInfo `xml:"WINDOWS,omitempty"`
+	Name         string       `xml:"NAME,omitempty"`
+}
+
+type wimXML struct {
+	XMLName    xml.Name   `xml:"WIM"`
+	TotalBytes int64      `xml:"TOTALBYTES"`
+	Image      []imageXML `xml:"IMAGE"`
+}
+
+// NewWriter returns a Writer that writes a WIM file to w, starting at offset zero.
+func NewWriter(w io.WriteSeeker, opts *WriterOptions) (*Writer, error) {
+	ww := &Writer{
+		w:      w,
+		offset: wimHeaderSize,
+		blobs:  make(map[SHA1Hash]*streamDescriptor),
+	}
+	if opts != nil {
+		ww.opts = *opts
+	}
+	if _, ok := w.(io.ReaderAt); ww.opts.Integrity && !ok {
+		return nil, errNoReaderAt
+	}
+	if _, err := w.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	// Reserve space for the header, which is written by Close.
+	if _, err := w.Write(make([]byte, wimHeaderSize)); err != nil {
+		return nil, err
+	}
+	return ww, nil
+}
+
+func filetimeFromTime(t time.Time) Filetime {
+	n := t.UnixNano()/100 + 116444736000000000
+	return Filetime{LowDateTime: uint32(n), HighDateTime: uint32(n >> 32)}
+}
+
+// writeResource writes size bytes read from r as a new resource at the end of the
+// file and returns its descriptor and the SHA-1 hash of its contents.
+func (w *Writer) writeResource(size int64, r io.Reader) (resourceDescriptor, SHA1Hash, error) {
+	var hash SHA1Hash
+	start := w.offset
+	if _, err := w.w.Seek(start, io.SeekStart); err != nil {
+		return resourceDescriptor{}, hash, err
+	}
+	h := sha1.New()
+	desc := resourceDescriptor{Offset: start, OriginalSize: size}
+	if w.opts.Compression == CompressionNone {
+		_, err := io.CopyN(io.MultiWriter(w.w, h), r, size)
+		if err == io.EOF {
+			err = errShortData
+		}
+		if err != nil {
+			return resourceDescriptor{}, hash, err
+		}
+		desc.FlagsAndCompressedSize = uint64(size)
+	} else {
+		// The chunk table holds the offset of each chunk but the first, relative to
+		// the end of the table. Reserve it and fill it in once the chunks are
+		// written.
+		nchunks := (size + chunkSize - 1) / chunkSize
+		entrySize := int64(4)
+		if size > 0xffffffff {
+			entrySize = 8
+		}
+		table := make([]byte, (nchunks-1)*entrySize)
+		if _, err := w.w.Write(table); err != nil {
+			return resourceDescriptor{}, hash, err
+		}
+		if w.chunk == nil {
+			w.chunk = make([]byte, chunkSize)
+		}
+		var pos int64
+		for i := int64(0); i < nchunks; i++ {
+			n := int64(chunkSize)
+			if i == nchunks-1 {
+				n = size - i*chunkSize
+			}
+			chunk := w.chunk[:n]
+			if _, err := io.ReadFull(r, chunk); err != nil {
+				if err == io.EOF || err == io.ErrUnexpectedEOF {
+					err = errShortData
+				}
+				return resourceDescriptor{}, hash, err
+			}
+			h.Write(chunk)
+			if i > 0 {
+				if entrySize == 4 {
+					binary.LittleEndian.PutUint32(table[(i-1)*4:], uint32(pos))
+				} else {
+					binary.LittleEndian.PutUint64(table[(i-1)*8:], uint64(pos))
+				}
+			}
+			// Chunks that do not compress are stored as is, which the reader
+			// detects from their size.
+			if c := xpress.Compress(chunk); c != nil {
+				chunk = c
+			}
+			if _, err := w.w.Write(chunk); err != nil {
+				return resourceDescriptor{}, hash, err
+			}
+			pos += int64(len(chunk))
+		}
+		if len(table) > 0 {
+			if _, err := w.w.Seek(start, io.SeekStart); err != nil {
+				return resourceDescriptor{}, hash, err
+			}
+			if _, err := w.w.Write(table); err != nil {
+				return resourceDescriptor{}, hash, err
+			}
+		}
+		desc.FlagsAndCompressedSize = uint64(int64(len(table))+pos) | uint64(resFlagCompressed)<<56
+	}
+	copy(hash[:], h.Sum(nil))
+	return desc, hash, nil
+}
+
+// writeBlob writes size bytes of file data read from r, unless data with the same
+// hash has already been written, and returns the hash.
+func (w *Writer) writeBlob(size int64, r io.Reader) (SHA1Hash, error) {
+	if size == 0 {
+		return SHA1Hash{}, nil
+	}
+	desc, hash, err := w.writeResource(size, r)
+	if err != nil {
+		return hash, err
+	}
+	if b := w.blobs[hash]; b != nil {
+		// Discard the duplicate by overwriting it with whatever comes next.
+		b.RefCount++
+		return hash, nil
+	}
+	w.offset = desc.Offset + desc.CompressedSize()
+	w.blobs[hash] = &streamDescriptor{resourceDescriptor: desc, PartNumber: 1, RefCount: 1, Hash: hash}
+	w.order = append(w.order, hash)
+	return hash, nil
+}
+
+// writeUncompressed writes b as an uncompressed resource at the end of the file.
+func (w *Writer) writeUncompressed(b []byte) (resourceDescriptor, error) {
+	desc := resourceDescriptor{FlagsAndCompressedSize: uint64(len(b)), Offset: w.offset, OriginalSize: int64(len(b))}
+	if _, err := w.w.Seek(w.offset, io.SeekStart); err != nil {
+		return desc, err
+	}
+	if _, err := w.w.Write(b); err != nil {
+		return desc, err
+	}
+	w.offset += int64(len(b))
+	return desc, nil
+}
+
+// AddImage starts a new image described by info, whose index is assigned by the
+// Writer. If its times are zero, they are set to the current time. The image returned
+// by the previous call must have been closed.
+func (w *Writer) AddImage(info *ImageInfo) (*ImageWriter, error) {
+	if w.closed {
+		return nil, errClosed
+	}
+	if w.cur != nil {
+		return nil, errImageOpen
+	}
+	iw := &ImageWriter{
+		w:       w,
+		entries: make(map[string]*writerEntry),
+		links:   make(map[int64]*writerEntry),
+		sdIDs:   make(map[string]uint32),
+	}
+	if info != nil {
+		iw.info = *info
+	}
+	iw.info.Index = len(w.images) + 1
+	now := filetimeFromTime(time.Now())
+	if iw.info.CreationTime == (Filetime{}) {
+		iw.info.CreationTime = now
+	}
+	if iw.info.ModTime == (Filetime{}) {
+		iw.info.ModTime = now
+	}
+	iw.root = &writerEntry{hdr: FileHeader{Attributes: FILE_ATTRIBUTE_DIRECTORY, CreationTime: now, LastAccessTime: now, LastWriteTime: now}, securityID: 0xffffffff}
+	iw.entries[""] = iw.root
+	w.cur = iw
+	return iw, nil
+}
+
+// Close closes the current image, if any, and writes the offset table, the XML data,
+// the integrity table, and the header. It does not close the underlying writer.
+func (w *Writer) Close() error {
+	if w.closed {
+		return errClosed
+	}
+	if w.cur != nil {
+		if err := w.cur.Close(); err != nil {
+			return err
+		}
+	}
+	w.closed = true
+
+	var table bytes.Buffer
+	for i := range w.metadata {
+		binary.Write(&table, binary.LittleEndian, &w.metadata[i])
+	}
+	for _, hash := range w.order {
+		binary.Write(&table, binary.LittleEndian, w.blobs[hash])
+	}
+	offsetTable, err := w.writeUncompressed(table.Bytes())
+	if err != nil {
+		return err
+	}
+
+	x, err := xml.Marshal(&wimXML{TotalBytes: w.offset, Image: w.images})
+	if err != nil {
+		return err
+	}
+	x16 := utf16.Encode([]rune("\ufeff" + string(x)))
+	xb := make([]byte, len(x16)*2)
+	for i, c := range x16 {
+		binary.LittleEndian.PutUint16(xb[i*2:], c)
+	}
+	xmlData, err := w.writeUncompressed(xb)
+	if err != nil {
+		return err
+	}
+
+	hdr := wimHeader{
+		ImageTag:        wimImageTag,
+		Size:            wimHeaderSize,
+		Version:         wimVersion,
+		CompressionSize: chunkSize,
+		PartNumber:      1,
+		TotalParts:      1,
+		ImageCount:      uint32(len(w.images)),
+		OffsetTable:     offsetTable,
+		XMLData:         xmlData,
+	}
+	if w.opts.Compression == CompressionXpress {
+		hdr.Flags = hdrFlagCompressed | hdrFlagCompressXpress
+	}
+	if err := binary.Read(rand.Reader, binary.LittleEndian, &hdr.WIMGuid); err != nil {
+		return err
+	}
+	if w.opts.Integrity {
+		b, err := integrityTable(w.w.(io.ReaderAt), wimHeaderSize, offsetTable.Offset+offsetTable.CompressedSize())
+		if err != nil {
+			return err
+		}
+		if hdr.Integrity, err = w.writeUncompressed(b); err != nil {
+			return err
+		}
+	}
+	if _, err := w.w.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err := binary.Write(w.w, binary.LittleEndian, &hdr); err != nil {
+		return err
+	}
+	// Remove any duplicate data that was written past the end of the file.
+	if t, ok := w.w.(interface{ Truncate(int64) error }); ok {
+		if err := t.Truncate(w.offset); err != nil {
+			return err
+		}
+	}
+	_, err = w.w.Seek(w.offset, io.SeekStart)
+	return err
+}
+
+// integrityTable returns the integrity table for the region [start, end) of r, which
+// holds the SHA-1 hash of each 10MB chunk of the region.
+func integrityTable(r io.ReaderAt, start, end int64) ([]byte, error) {
+	n := (end - start + integrityChunkSize - 1) / integrityChunkSize
+	b := make([]byte, 12, 12+n*sha1.Size)
+	binary.LittleEndian.PutUint32(b[0:4], uint32(cap(b)))
+	binary.LittleEndian.PutUint32(b[4:8], uint32(n))
+	binary.LittleEndian.PutUint32(b[8:12], integrityChunkSize)
+	for off := start; off < end; off += integrityChunkSize {
+		size := end - off
+		if size > integrityChunkSize {
+			size = integrityChunkSize
+		}
+		h := sha1.New()
+		if _, err := io.Copy(h, io.NewSectionReader(r, off, size)); err != nil {
+			return nil, err
+		}
+		b = h.Sum(b)
+	}
+	return b, nil
+}
+
+// ImageWriter adds files to an image being written by a Writer.
+type ImageWriter struct {
+	w          *Writer
+	info       ImageInfo
+	root       *writerEntry
+	entries    map[string]*writerEntry
+	links      map[int64]*writerEntry
+	sds        [][]byte
+	sdIDs      map[string]uint32
+	dirCount   int
+	fileCount  int
+	totalBytes int64
+	closed     bool
+}
+
+type writerEntry struct {
+	hdr          FileHeader
+	securityID   uint32
+	hash         SHA1Hash
+	streams      []StreamHeader
+	link         *writerEntry
+	children     []*writerEntry
+	subdirOffset int64
+}
+
+func (e *writerEntry) isDir() bool {
+	return e.hdr.IsDir()
+}
+
+// streamEntries returns the stream entries that follow the directory entry. If the
+// file has named streams, its unnamed stream is stored in the first entry rather than
+// in the directory entry.
+func (e *writerEntry) streamEntries() []StreamHeader {
+	src := e
+	if e.link != nil {
+		src = e.link
+	}
+	if len(src.streams) == 0 {
+		return nil
+	}
+	return append([]StreamHeader{{Hash: src.hash}}, src.streams...)
+}
+
+func (e *writerEntry) len() int64 {
+	n := direntrySize + int64(len(utf16.Encode([]rune(e.hdr.Name))))*2 + 2
+	if e.hdr.ShortName != "" {
+		n += int64(len(utf16.Encode([]rune(e.hdr.ShortName))))*2 + 2
+	}
+	return align8(n)
+}
+
+func (e *writerEntry) lenWithStreams() int64 {
+	n := e.len()
+	for _, s := range e.streamEntries() {
+		n += streamEntryLen(s.Name)
+	}
+	return n
+}
+
+func streamEntryLen(name string) int64 {
+	if name == "" {
+		return align8(streamentrySize)
+	}
+	return align8(streamentrySize + int64(len(utf16.Encode([]rune(name))))*2 + 2)
+}
+
+func align8(n int64) int64 {
+	return (n + 7) &^ 7
+}
+
+func writeUTF16(b *bytes.Buffer, s string, nul bool) {
+	for _, c := range utf16.Encode([]rune(s)) {
+		binary.Write(b, binary.LittleEndian, c)
+	}
+	if nul {
+		b.Write([]byte{0, 0})
+	}
+}
+
+func pad8(b *bytes.Buffer, start int) {
+	for (b.Len()-start)%8 != 0 {
+		b.WriteByte(0)
+	}
+}
+
+func (e *writerEntry) write(b *bytes.Buffer) {
+	src := e
+	if e.link != nil {
+		src = e.link
+	}
+	streams := e.streamEntries()
+	d := direntry{
+		Attributes:     e.hdr.Attributes,
+		SecurityID:     src.securityID,
+		SubdirOffset:   e.subdirOffset,
+		CreationTime:   e.hdr.CreationTime,
+		LastAccessTime: e.hdr.LastAccessTime,
+		LastWriteTime:  e.hdr.LastWriteTime,
+		StreamCount:    uint16(len(streams)),
+	}
+	if len(streams) == 0 {
+		d.Hash = src.hash
+	}
+	if e.hdr.Attributes&FILE_ATTRIBUTE_REPARSE_POINT != 0 {
+		d.ReparseHardLink = int64(uint64(e.hdr.ReparseReserved)<<32 | uint64(e.hdr.ReparseTag))
+	} else {
+		d.ReparseHardLink = e.hdr.LinkID
+	}
+	d.FileNameLength = uint16(len(utf16.Encode([]rune(e.hdr.Name))) * 2)
+	d.ShortNameLength = uint16(len(utf16.Encode([]rune(e.hdr.ShortName))) * 2)
+
+	start := b.Len()
+	binary.Write(b, binary.LittleEndian, e.len())
+	binary.Write(b, binary.LittleEndian, &d)
+	writeUTF16(b, e.hdr.Name, true)
+	if e.hdr.ShortName != "" {
+		writeUTF16(b, e.hdr.ShortName, true)
+	}
+	pad8(b, start)
+
+	for _, s := range streams {
+		start := b.Len()
+		binary.Write(b, binary.LittleEndian, streamEntryLen(s.Name))
+		se := streamentry{Hash: s.Hash, NameLength: int16(len(utf16.Encode([]rune(s.Name))) * 2)}
+		binary.Write(b, binary.LittleEndian, &se)
+		writeUTF16(b, s.Name, s.Name != "")
+		pad8(b, start)
+	}
+}
+
+// splitPath normalizes name, a path relative to the root of the image, and returns it
+// along with the index of its last component.
+func splitPath(name string) (string, int, error) {
+	name = strings.Trim(strings.Replace(name, "/", `\`, -1), `\`)
+	if name == "" {
+		return "", 0, nil
+	}
+	for _, c := range strings.Split(name, `\`) {
+		if c == "" || c == "." || c == ".." {
+			return "", 0, &os.PathError{Op: "add", Path: name, Err: os.ErrInvalid}
+		}
+	}
+	return name, strings.LastIndex(name, `\`) + 1, nil
+}
+
+func (iw *ImageWriter) securityID(sd []byte) uint32 {
+	if len(sd) == 0 {
+		return 0xffffffff
+	}
+	if id, ok := iw.sdIDs[string(sd)]; ok {
+		return id
+	}
+	id := uint32(len(iw.sds))
+	iw.sds = append(iw.sds, append([]byte(nil), sd...))
+	iw.sdIDs[string(sd)] = id
+	return id
+}
+
+// addEntry adds the directory entry for name and reports whether it is a hard link to
+// a file that was added earlier.
+func (iw *ImageWriter) addEntry(name string, hdr *FileHeader) (*writerEntry, bool, error) {
+	if iw.closed {
+		return nil, false, errClosed
+	}
+	name, i, err := splitPath(name)
+	if err != nil {
+		return nil, false, err
+	}
+	e := &writerEntry{hdr: *hdr, securityID: iw.securityID(hdr.SecurityDescriptor)}
+	e.hdr.SecurityDescriptor = nil
+	if e.hdr.Attributes == 0 {
+		e.hdr.Attributes = FILE_ATTRIBUTE_NORMAL
+	}
+	if name == "" {
+		// Set the metadata of the root directory.
+		if !e.isDir() {
+			return nil, false, &os.PathError{Op: "add", Path: `\`, Err: errNotADirectory}
+		}
+		e.hdr.Name = ""
+		e.hdr.ShortName = ""
+		e.children = iw.root.children
+		*iw.root = *e
+		return iw.root, false, nil
+	}
+	key := strings.ToUpper(name)
+	if iw.entries[key] != nil {
+		return nil, false, &os.PathError{Op: "add", Path: name, Err: os.ErrExist}
+	}
+	parent := iw.entries[strings.ToUpper(strings.TrimSuffix(name[:i], `\`))]
+	if parent == nil {
+		return nil, false, &os.PathError{Op: "add", Path: name, Err: os.ErrNotExist}
+	}
+	if !parent.isDir() {
+		return nil, false, &os.PathError{Op: "add", Path: name, Err: errNotADirectory}
+	}
+	e.hdr.Name = name[i:]
+	linked := false
+	if e.isDir() {
+		iw.dirCount++
+	} else {
+		iw.fileCount++
+		if hdr.LinkID != 0 {
+			if first := iw.links[hdr.LinkID]; first != nil {
+				e.link = first
+				linked = true
+			} else {
+				iw.links[hdr.LinkID] = e
+			}
+		}
+		if !linked {
+			iw.totalBytes += hdr.Size
+		}
+	}
+	parent.children = append(parent.children, e)
+	iw.entries[key] = e
+	return e, linked, nil
+}
+
+// AddFile adds a file or directory to the image. name is its path relative to the
+// root of the image, with \ or / separators; its parent directory must already have
+// been added. An empty name sets the metadata of the root directory. The name and
+// short name of the file are taken from name and hdr.ShortName; hdr.Size and the
+// other fields of hdr describe the file.
+//
+// For a file, r supplies its hdr.Size bytes of data. For a reparse point, r supplies
+// hdr.Size bytes of reparse data, which follow the eight-byte header of the
+// REPARSE_DATA_BUFFER, and hdr.ReparseTag holds its tag. r is not read for
+// directories, or for a file whose nonzero hdr.LinkID matches that of a file added
+// earlier, which makes it a hard link to that file.
+func (iw *ImageWriter) AddFile(name string, hdr *FileHeader, r io.Reader) error {
+	e, linked, err := iw.addEntry(name, hdr)
+	if err != nil {
+		return err
+	}
+	if linked || e.isDir() {
+		return nil
+	}
+	e.hash, err = iw.w.writeBlob(hdr.Size, r)
+	if err != nil {
+		return &os.PathError{Op: "add", Path: name, Err: err}
+	}
+	return nil
+}
+
+// AddStream adds the alternate data stream stream, with size bytes of data read from
+// r, to the file or directory name, which must already have been added. Hard links
+// share the streams of the first file in their group, so r is not read for them.
+func (iw *ImageWriter) AddStream(name string, stream string, size int64, r io.Reader) error {
+	if iw.closed {
+		return errClosed
+	}
+	key, _, err := splitPath(name)
+	if err != nil {
+		return err
+	}
+	e := iw.entries[strings.ToUpper(key)]
+	if e == nil {
+		return &os.PathError{Op: "add stream", Path: name, Err: os.ErrNotExist}
+	}
+	if stream == "" {
+		return &os.PathError{Op: "add stream", Path: name, Err: os.ErrInvalid}
+	}
+	if e.link != nil {
+		return nil
+	}
+	hash, err := iw.w.writeBlob(size, r)
+	if err != nil {
+		return &os.PathError{Op: "add stream", Path: name + ":" + stream, Err: err}
+	}
+	e.streams = append(e.streams, StreamHeader{Name: stream, Hash: hash, Size: size})
+	return nil
+}
+
+// Close writes the metadata resource of the image. No more files can be added to it.
+func (iw *ImageWriter) Close() error {
+	if iw.closed {
+		return errClosed
+	}
+	iw.closed = true
+	w := iw.w
+	w.cur = nil
+
+	var b bytes.Buffer
+	sdLen := securityblockDiskSize + 8*len(iw.sds)
+	for _, sd := range iw.sds {
+		sdLen += len(sd)
+	}
+	binary.Write(&b, binary.LittleEndian, &securityblockDisk{TotalLength: uint32(sdLen), NumEntries: uint32(len(iw.sds))})
+	for _, sd := range iw.sds {
+		binary.Write(&b, binary.LittleEndian, uint64(len(sd)))
+	}
+	for _, sd := range iw.sds {
+		b.Write(sd)
+	}
+	pad8(&b, 0)
+
+	// Lay out the directories breadth first: the root's entry, then the list
+	// of the children of each directory in turn, each ending with a zero length.
+	dirs := []*writerEntry{iw.root}
+	pos := int64(b.Len()) + iw.root.lenWithStreams() + 8
+	for i := 0; i < len(dirs); i++ {
+		d := dirs[i]
+		sort.SliceStable(d.children, func(i, j int) bool {
+			return strings.ToUpper(d.children[i].hdr.Name) < strings.ToUpper(d.children[j].hdr.Name)
+		})
+		d.subdirOffset = pos
+		for _, c := range d.children {
+			pos += c.lenWithStreams()
+			if c.isDir() {
+				dirs = append(dirs, c)
+			}
+		}
+		pos += 8
+	}
+	iw.root.write(&b)
+	b.Write(make([]byte, 8))
+	for _, d := range dirs {
+		for _, c := range d.children {
+			c.write(&b)
+		}
+		b.Write(make([]byte, 8))
+	}
+
+	desc, hash, err := w.writeResource(int64(b.Len()), &b)
+	if err != nil {
+		return err
+	}
+	w.offset = desc.Offset + desc.CompressedSize()
+	desc.FlagsAndCompressedSize |= uint64(resFlagMetadata) << 56
+	w.metadata = append(w.metadata, streamDescriptor{resourceDescriptor: desc, PartNumber: 1, RefCount: 1, Hash: hash})
+	w.images = append(w.images, imageXML{
+		Index:        iw.info.Index,
+		DirCount:     iw.dirCount,
+		FileCount:    iw.fileCount,
+		TotalBytes:   iw.totalBytes,
+		CreationTime: iw.info.CreationTime,
+		ModTime:      iw.info.ModTime,
+		Windows:      iw.info.Windows,
+		Name:         iw.info.Name,
+	})
+	return nil
+}
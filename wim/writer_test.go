@@ -0,0 +1,207 @@
+package wim
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type testFile struct {
+	hdr     FileHeader
+	data    []byte
+	streams map[string][]byte
+}
+
+func writeTestWim(t *testing.T, opts *WriterOptions, files map[string]*testFile, order []string) string {
+	dir, err := ioutil.TempDir("", "wimtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "test.wim")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	w, err := NewWriter(f, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iw, err := w.AddImage(&ImageInfo{Name: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range order {
+		tf := files[name]
+		hdr := tf.hdr
+		hdr.Size = int64(len(tf.data))
+		if err := iw.AddFile(name, &hdr, bytes.NewReader(tf.data)); err != nil {
+			t.Fatal(err)
+		}
+		for s, data := range tf.streams {
+			if err := iw.AddStream(name, s, int64(len(data)), bytes.NewReader(data)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := iw.AddFile(order[0], &files[order[0]].hdr, nil); !os.IsExist(err) {
+		t.Fatalf("expected exists error, got %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func testWriter(t *testing.T, opts *WriterOptions) {
+	big := bytes.Repeat([]byte("the quick brown fox jumps over the lazy dog. "), 5000)
+	sd := []byte{1, 0, 4, 0x80, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+	ft := Filetime{LowDateTime: 0x12345678, HighDateTime: 0x01d00000}
+	files := map[string]*testFile{
+		"dir":          {hdr: FileHeader{Attributes: FILE_ATTRIBUTE_DIRECTORY, LastWriteTime: ft, SecurityDescriptor: sd}},
+		`dir\big.txt`:  {hdr: FileHeader{Attributes: FILE_ATTRIBUTE_ARCHIVE, CreationTime: ft, LinkID: 1}, data: big},
+		"dir/link.txt": {hdr: FileHeader{Attributes: FILE_ATTRIBUTE_ARCHIVE, CreationTime: ft, LinkID: 1}},
+		"copy.txt":     {hdr: FileHeader{ShortName: "COPY~1.TXT", SecurityDescriptor: sd}, data: big},
+		"streams.txt":  {data: []byte("data"), streams: map[string][]byte{"ads": []byte("alternate")}},
+		"empty":        {},
+		"symlink":      {hdr: FileHeader{Attributes: FILE_ATTRIBUTE_REPARSE_POINT, ReparseTag: 0xa000000c}, data: []byte("reparse data")},
+	}
+	order := []string{"dir", `dir\big.txt`, "dir/link.txt", "copy.txt", "streams.txt", "empty", "symlink"}
+	path := writeTestWim(t, opts, files, order)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r, err := NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if len(r.Image) != 1 || r.Image[0].Name != "test" || r.Image[0].Index != 1 {
+		t.Fatalf("unexpected images %+v", r.Image)
+	}
+	root, err := r.Image[0].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found := 0
+	var walk func(prefix string, d *File)
+	walk = func(prefix string, d *File) {
+		children, err := d.Readdir()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, c := range children {
+			name := prefix + c.Name
+			var tf *testFile
+			for n, f := range files {
+				if strings.Replace(n, "/", `\`, -1) == name {
+					tf = f
+				}
+			}
+			if tf == nil {
+				t.Fatalf("unexpected file %s", name)
+			}
+			found++
+			attr := tf.hdr.Attributes
+			if attr == 0 {
+				attr = FILE_ATTRIBUTE_NORMAL
+			}
+			if c.Attributes != attr || c.CreationTime != tf.hdr.CreationTime || c.LastWriteTime != tf.hdr.LastWriteTime || c.ShortName != tf.hdr.ShortName {
+				t.Errorf("%s: mismatched header %+v", name, c.FileHeader)
+			}
+			if !bytes.Equal(c.SecurityDescriptor, tf.hdr.SecurityDescriptor) {
+				t.Errorf("%s: mismatched security descriptor %x", name, c.SecurityDescriptor)
+			}
+			if c.LinkID != tf.hdr.LinkID || c.ReparseTag != tf.hdr.ReparseTag {
+				t.Errorf("%s: mismatched link ID %d or tag %x", name, c.LinkID, c.ReparseTag)
+			}
+			if c.IsDir() {
+				walk(name+`\`, c)
+				continue
+			}
+			data := tf.data
+			if name == `dir\link.txt` {
+				data = big
+			}
+			rc, err := c.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := ioutil.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(b, data) {
+				t.Errorf("%s: mismatched data %q", name, b)
+			}
+			var streams []*Stream
+			for _, s := range c.Streams {
+				if s.Name != "" {
+					streams = append(streams, s)
+				}
+			}
+			if len(streams) != len(tf.streams) {
+				t.Fatalf("%s: got %d streams", name, len(streams))
+			}
+			for _, s := range streams {
+				rc, err := s.Open()
+				if err != nil {
+					t.Fatal(err)
+				}
+				b, err := ioutil.ReadAll(rc)
+				rc.Close()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(b, tf.streams[s.Name]) {
+					t.Errorf("%s:%s: mismatched data %q", name, s.Name, b)
+				}
+			}
+		}
+	}
+	walk("", root)
+	if found != len(files) {
+		t.Fatalf("found %d files, expected %d", found, len(files))
+	}
+}
+
+func TestWriterUncompressed(t *testing.T) {
+	testWriter(t, nil)
+}
+
+func TestWriterXpress(t *testing.T) {
+	testWriter(t, &WriterOptions{Compression: CompressionXpress, Integrity: true})
+}
+
+func TestWriterDedup(t *testing.T) {
+	data := bytes.Repeat([]byte{1, 2, 3, 4}, 100000)
+	files := map[string]*testFile{
+		"a": {data: data},
+		"b": {data: data},
+	}
+	path := writeTestWim(t, &WriterOptions{Compression: CompressionXpress}, files, []string{"a", "b"})
+	defer os.RemoveAll(filepath.Dir(path))
+	single := writeTestWim(t, &WriterOptions{Compression: CompressionXpress}, map[string]*testFile{"a": {data: data}}, []string{"a"})
+	defer os.RemoveAll(filepath.Dir(single))
+	fi1, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fi2, err := os.Stat(single)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The second copy should only add a directory entry.
+	if fi1.Size()-fi2.Size() > 512 {
+		t.Fatalf("duplicate data was not shared: %d vs %d bytes", fi1.Size(), fi2.Size())
+	}
+}
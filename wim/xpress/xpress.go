@@ -0,0 +1,481 @@
+// Package xpress implements a compressor and decompressor for the XPRESS Huffman
+// compression format used by WIM files.
+//
+// The format is documented in section 2.1 of [MS-XCA] at
+// https://msdn.microsoft.com/en-us/library/hh554002.aspx. WIM files compress each
+// chunk of a resource independently, so unlike the general format, a compressed
+// buffer here always holds a single block of at most 64KB.
+package xpress
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/bits"
+	"sort"
+)
+
+const (
+	numChars       = 256
+	numSymbols     = 512
+	endOfData      = 256
+	maxCodewordLen = 15
+	tableSize      = numSymbols / 2
+	minMatchLen    = 3
+	maxMatchLen    = 0xffff + minMatchLen
+	maxOffset      = 0xffff
+
+	// MaxBlockSize is the largest buffer that can be compressed as a single block.
+	MaxBlockSize = 65536
+
+	hashBits = 15
+	maxChain = 64
+)
+
+var errCorrupt = errors.New("XPRESS data corrupt")
+
+// bitReader reads the bitstream of a block, which consists of 16-bit little-endian
+// words read most significant bit first, interleaved with the extra length bytes of
+// long matches.
+type bitReader struct {
+	in  []byte
+	pos int
+	buf uint32
+	n   uint
+}
+
+func (r *bitReader) ensure(n uint) {
+	if r.n >= n {
+		return
+	}
+	if r.pos+2 > len(r.in) {
+		// Past the end of the input, treat the bitstream as zeroes. Callers detect
+		// truncation through the symbols this produces.
+		r.n = 32
+		return
+	}
+	r.buf |= uint32(binary.LittleEndian.Uint16(r.in[r.pos:])) << (16 - r.n)
+	r.pos += 2
+	r.n += 16
+}
+
+func (r *bitReader) peek(n uint) uint32 {
+	return r.buf >> (32 - n)
+}
+
+func (r *bitReader) remove(n uint) {
+	r.buf <<= n
+	r.n -= n
+}
+
+func (r *bitReader) readByte() int {
+	if r.pos >= len(r.in) {
+		return 0
+	}
+	b := r.in[r.pos]
+	r.pos++
+	return int(b)
+}
+
+func (r *bitReader) readUint16() int {
+	if r.pos+2 > len(r.in) {
+		return 0
+	}
+	v := binary.LittleEndian.Uint16(r.in[r.pos:])
+	r.pos += 2
+	return int(v)
+}
+
+// canonicalCodes returns the codewords of the canonical Huffman code with the given
+// codeword lengths, in which shorter codewords come first and codewords of the same
+// length are ordered by symbol. It fails if the lengths over-subscribe the code space.
+func canonicalCodes(lens []uint8) ([]uint16, error) {
+	var count [maxCodewordLen + 1]int
+	for _, l := range lens {
+		count[l]++
+	}
+	count[0] = 0
+	var next [maxCodewordLen + 2]int
+	code := 0
+	for l := 1; l <= maxCodewordLen; l++ {
+		code = (code + count[l-1]) << 1
+		next[l] = code
+		if code+count[l] > 1<<uint(l) {
+			return nil, errCorrupt
+		}
+	}
+	codes := make([]uint16, len(lens))
+	for sym, l := range lens {
+		if l != 0 {
+			codes[sym] = uint16(next[l])
+			next[l]++
+		}
+	}
+	return codes, nil
+}
+
+// buildDecodeTable returns a table indexed by the next 15 bits of the bitstream whose
+// entries hold the symbol in the upper bits and its codeword length in the low four
+// bits. Entries for unused codewords are zero.
+func buildDecodeTable(lens []uint8) ([]uint16, error) {
+	codes, err := canonicalCodes(lens)
+	if err != nil {
+		return nil, err
+	}
+	table := make([]uint16, 1<<maxCodewordLen)
+	for sym, l := range lens {
+		if l == 0 {
+			continue
+		}
+		shift := uint(maxCodewordLen - l)
+		e := uint16(sym)<<4 | uint16(l)
+		start := int(codes[sym]) << shift
+		for i := start; i < start+1<<shift; i++ {
+			table[i] = e
+		}
+	}
+	return table, nil
+}
+
+// Decompress decompresses a block of XPRESS Huffman data that decompresses to
+// uncompressedSize bytes.
+func Decompress(in []byte, uncompressedSize int) ([]byte, error) {
+	if len(in) < tableSize {
+		return nil, errCorrupt
+	}
+	var lens [numSymbols]uint8
+	for i, b := range in[:tableSize] {
+		lens[i*2] = b & 0xf
+		lens[i*2+1] = b >> 4
+	}
+	table, err := buildDecodeTable(lens[:])
+	if err != nil {
+		return nil, err
+	}
+	r := bitReader{in: in[tableSize:]}
+	out := make([]byte, 0, uncompressedSize)
+	for len(out) < uncompressedSize {
+		r.ensure(maxCodewordLen)
+		e := table[r.peek(maxCodewordLen)]
+		if e == 0 {
+			return nil, errCorrupt
+		}
+		r.remove(uint(e & 0xf))
+		sym := int(e >> 4)
+		if sym < numChars {
+			out = append(out, byte(sym))
+			continue
+		}
+		length := sym & 0xf
+		log2Offset := uint(sym>>4) & 0xf
+		r.ensure(16)
+		offset := 1<<log2Offset | int(r.peek(log2Offset))
+		r.remove(log2Offset)
+		if length == 0xf {
+			length += r.readByte()
+			if length == 0xf+0xff {
+				length = r.readUint16()
+			}
+		}
+		length += minMatchLen
+		if offset > len(out) || length > uncompressedSize-len(out) {
+			return nil, errCorrupt
+		}
+		start := len(out) - offset
+		for i := 0; i < length; i++ {
+			out = append(out, out[start+i])
+		}
+	}
+	return out, nil
+}
+
+// NewReader returns a reader that decompresses the XPRESS Huffman block read from r,
+// which decompresses to uncompressedSize bytes.
+func NewReader(r io.Reader, uncompressedSize int) (io.ReadCloser, error) {
+	in, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	out, err := Decompress(in, uncompressedSize)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(bytes.NewReader(out)), nil
+}
+
+// huffmanLengths returns length-limited codeword lengths for a Huffman code for the
+// symbol frequencies freq. If the lengths of the optimal code exceed maxLen, the
+// frequencies are flattened and the code rebuilt. The code is always complete, so at
+// least two symbols are given codewords.
+func huffmanLengths(freq []uint32, maxLen int) []uint8 {
+	type node struct {
+		freq   uint32
+		parent int
+	}
+	f := append([]uint32(nil), freq...)
+	lens := make([]uint8, len(f))
+	for {
+		var syms []int
+		for sym, n := range f {
+			if n != 0 {
+				syms = append(syms, sym)
+			}
+		}
+		for len(syms) < 2 {
+			// Give an unused symbol a codeword to complete the code.
+			for sym := range f {
+				if f[sym] == 0 {
+					f[sym] = 1
+					syms = append(syms, sym)
+					break
+				}
+			}
+		}
+		sort.SliceStable(syms, func(i, j int) bool { return f[syms[i]] < f[syms[j]] })
+
+		// Build the tree with two queues: the sorted leaves and the internal nodes,
+		// which are created in order of increasing frequency.
+		nodes := make([]node, len(syms), 2*len(syms)-1)
+		for i, sym := range syms {
+			nodes[i] = node{freq: f[sym], parent: -1}
+		}
+		leaf, internal := 0, len(syms)
+		pick := func() int {
+			if leaf < len(syms) && (internal == len(nodes) || nodes[leaf].freq <= nodes[internal].freq) {
+				leaf++
+				return leaf - 1
+			}
+			internal++
+			return internal - 1
+		}
+		for len(nodes) < cap(nodes) {
+			a, b := pick(), pick()
+			nodes = append(nodes, node{freq: nodes[a].freq + nodes[b].freq, parent: -1})
+			nodes[a].parent = len(nodes) - 1
+			nodes[b].parent = len(nodes) - 1
+		}
+
+		depth := make([]int, len(nodes))
+		for i := len(nodes) - 2; i >= 0; i-- {
+			depth[i] = depth[nodes[i].parent] + 1
+		}
+		tooLong := false
+		for i, sym := range syms {
+			if depth[i] > maxLen {
+				tooLong = true
+				break
+			}
+			lens[sym] = uint8(depth[i])
+		}
+		if !tooLong {
+			return lens
+		}
+		for sym := range f {
+			lens[sym] = 0
+			if f[sym] != 0 {
+				f[sym] = (f[sym] + 1) / 2
+			}
+		}
+	}
+}
+
+// bitWriter writes a bitstream in the layout read by bitReader. Since the decoder reads
+// the extra length bytes of a match from after the 16-bit words it has loaded, the
+// writer keeps space for the next two words before the next byte.
+type bitWriter struct {
+	out       []byte
+	buf       uint32
+	n         uint
+	nextBits  int
+	nextBits2 int
+	nextByte  int
+	overflow  bool
+}
+
+func newBitWriter(out []byte) *bitWriter {
+	return &bitWriter{out: out, nextBits: 0, nextBits2: 2, nextByte: 4}
+}
+
+func (w *bitWriter) writeBits(bits uint32, n uint) {
+	w.buf = w.buf<<n | bits
+	w.n += n
+	if w.n > 16 {
+		w.n -= 16
+		if w.nextByte+2 > len(w.out) {
+			w.overflow = true
+			return
+		}
+		binary.LittleEndian.PutUint16(w.out[w.nextBits:], uint16(w.buf>>w.n))
+		w.nextBits = w.nextBits2
+		w.nextBits2 = w.nextByte
+		w.nextByte += 2
+	}
+}
+
+func (w *bitWriter) writeByte(b byte) {
+	if w.nextByte >= len(w.out) {
+		w.overflow = true
+		return
+	}
+	w.out[w.nextByte] = b
+	w.nextByte++
+}
+
+func (w *bitWriter) writeUint16(v uint16) {
+	if w.nextByte+2 > len(w.out) {
+		w.overflow = true
+		return
+	}
+	binary.LittleEndian.PutUint16(w.out[w.nextByte:], v)
+	w.nextByte += 2
+}
+
+func (w *bitWriter) flush() []byte {
+	if w.overflow {
+		return nil
+	}
+	binary.LittleEndian.PutUint16(w.out[w.nextBits:], uint16(w.buf<<(16-w.n)))
+	binary.LittleEndian.PutUint16(w.out[w.nextBits2:], 0)
+	return w.out[:w.nextByte]
+}
+
+// item is a literal, if length is zero, or a match.
+type item struct {
+	length  int
+	literal byte
+	offset  int
+}
+
+func (it *item) symbol() (sym int, adjustedLength int, log2Offset uint) {
+	if it.length == 0 {
+		return int(it.literal), 0, 0
+	}
+	adjustedLength = it.length - minMatchLen
+	log2Offset = uint(bits.Len(uint(it.offset)) - 1)
+	header := adjustedLength
+	if header > 0xf {
+		header = 0xf
+	}
+	return numChars | int(log2Offset)<<4 | header, adjustedLength, log2Offset
+}
+
+func hash3(b []byte) int {
+	return int((uint32(b[0])<<16 | uint32(b[1])<<8 | uint32(b[2])) * 2654435761 >> (32 - hashBits))
+}
+
+// findItems splits in into literals and matches, greedily taking the longest match
+// found in a bounded search of the hash chain of each position.
+func findItems(in []byte) []item {
+	var head [1 << hashBits]int32
+	for i := range head {
+		head[i] = -1
+	}
+	prev := make([]int32, len(in))
+	insert := func(i int) {
+		if i+minMatchLen <= len(in) {
+			h := hash3(in[i:])
+			prev[i] = head[h]
+			head[h] = int32(i)
+		}
+	}
+	items := make([]item, 0, len(in)/2)
+	for i := 0; i < len(in); {
+		bestLen, bestOffset := 0, 0
+		if i+minMatchLen <= len(in) {
+			limit := len(in) - i
+			if limit > maxMatchLen {
+				limit = maxMatchLen
+			}
+			cand := head[hash3(in[i:])]
+			for chain := 0; cand >= 0 && chain < maxChain; chain++ {
+				offset := i - int(cand)
+				if offset > maxOffset {
+					break
+				}
+				if in[int(cand)+bestLen] == in[i+bestLen] {
+					l := 0
+					for l < limit && in[int(cand)+l] == in[i+l] {
+						l++
+					}
+					if l > bestLen {
+						bestLen, bestOffset = l, offset
+						if l == limit {
+							break
+						}
+					}
+				}
+				cand = prev[cand]
+			}
+		}
+		if bestLen >= minMatchLen {
+			items = append(items, item{length: bestLen, offset: bestOffset})
+			for j := i; j < i+bestLen; j++ {
+				insert(j)
+			}
+			i += bestLen
+		} else {
+			items = append(items, item{literal: in[i]})
+			insert(i)
+			i++
+		}
+	}
+	return items
+}
+
+// Compress compresses in, which must be at most MaxBlockSize bytes, as a single
+// XPRESS Huffman block. It returns nil if the compressed block would not be smaller
+// than in, in which case WIM files store the data uncompressed.
+func Compress(in []byte) []byte {
+	if len(in) == 0 || len(in) > MaxBlockSize {
+		return nil
+	}
+	items := findItems(in)
+	freq := make([]uint32, numSymbols)
+	for i := range items {
+		sym, _, _ := items[i].symbol()
+		freq[sym]++
+	}
+	// Microsoft's decompressor expects the end-of-data symbol to have a codeword,
+	// although it is never decoded.
+	freq[endOfData]++
+	lens := huffmanLengths(freq, maxCodewordLen)
+	codes, err := canonicalCodes(lens)
+	if err != nil {
+		panic(err)
+	}
+
+	out := make([]byte, len(in))
+	if len(out) <= tableSize+4 {
+		return nil
+	}
+	for i := 0; i < tableSize; i++ {
+		out[i] = lens[i*2] | lens[i*2+1]<<4
+	}
+	w := newBitWriter(out[tableSize:])
+	for i := range items {
+		sym, adjustedLength, log2Offset := items[i].symbol()
+		w.writeBits(uint32(codes[sym]), uint(lens[sym]))
+		if sym < numChars {
+			continue
+		}
+		if adjustedLength >= 0xf {
+			b := adjustedLength - 0xf
+			if b > 0xff {
+				b = 0xff
+			}
+			w.writeByte(byte(b))
+			if b == 0xff {
+				w.writeUint16(uint16(adjustedLength))
+			}
+		}
+		w.writeBits(uint32(items[i].offset)^1<<log2Offset, log2Offset)
+	}
+	w.writeBits(uint32(codes[endOfData]), uint(lens[endOfData]))
+	b := w.flush()
+	if b == nil || tableSize+len(b) >= len(in) {
+		return nil
+	}
+	return out[:tableSize+len(b)]
+}
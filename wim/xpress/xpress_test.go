@@ -0,0 +1,72 @@
+package xpress
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func testRoundTrip(t *testing.T, name string, in []byte, wantCompressed bool) {
+	c := Compress(in)
+	if c == nil {
+		if wantCompressed {
+			t.Fatalf("%s: data was not compressed", name)
+		}
+		return
+	}
+	if len(c) >= len(in) {
+		t.Fatalf("%s: compressed to %d bytes from %d", name, len(c), len(in))
+	}
+	out, err := Decompress(c, len(in))
+	if err != nil {
+		t.Fatalf("%s: %s", name, err)
+	}
+	if !bytes.Equal(out, in) {
+		t.Fatalf("%s: data mismatch", name)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	random := make([]byte, 32768)
+	rng.Read(random)
+	text := bytes.Repeat([]byte("the quick brown fox jumps over the lazy dog. "), 800)[:32768]
+	words := make([]byte, 0, 65536)
+	for len(words) < 65536-16 {
+		words = append(words, "alpha beta gamma delta epsilon "[rng.Intn(5)*6:][:6]...)
+		words = append(words, byte('0'+rng.Intn(10)))
+	}
+	skewed := make([]byte, 40000)
+	for i := range skewed {
+		// A steep distribution produces long codewords that must be limited.
+		n := 0
+		for n < 40 && rng.Intn(2) == 0 {
+			n++
+		}
+		skewed[i] = byte(n)
+	}
+	testRoundTrip(t, "random", random, false)
+	testRoundTrip(t, "text", text, true)
+	testRoundTrip(t, "words", words, true)
+	testRoundTrip(t, "zeroes", make([]byte, 65536), true)
+	testRoundTrip(t, "skewed", skewed, true)
+	testRoundTrip(t, "short", []byte("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"), true)
+}
+
+func TestDecompressCorrupt(t *testing.T) {
+	in := bytes.Repeat([]byte("corrupt me "), 1000)
+	c := Compress(in)
+	if c == nil {
+		t.Fatal("data was not compressed")
+	}
+	if _, err := Decompress(c[:100], len(in)); err == nil {
+		t.Fatal("expected error for truncated table")
+	}
+	bad := append([]byte(nil), c...)
+	for i := 0; i < tableSize; i++ {
+		bad[i] = 0x11
+	}
+	if _, err := Decompress(bad, len(in)); err == nil {
+		t.Fatal("expected error for over-subscribed code")
+	}
+}
@@ -0,0 +1,119 @@
+package xpress
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"syscall"
+	"testing"
+	"unsafe"
+)
+
+// The XPRESS Huffman format of ntdll's compression routines is the one WIM files use,
+// so they serve as an independent encoder and decoder for single chunks.
+var (
+	modntdll                           = syscall.NewLazyDLL("ntdll.dll")
+	procRtlGetCompressionWorkSpaceSize = modntdll.NewProc("RtlGetCompressionWorkSpaceSize")
+	procRtlCompressBuffer              = modntdll.NewProc("RtlCompressBuffer")
+	procRtlDecompressBufferEx          = modntdll.NewProc("RtlDecompressBufferEx")
+)
+
+const cCOMPRESSION_FORMAT_XPRESS_HUFF = 4
+
+func ntError(op string, status uintptr) error {
+	return fmt.Errorf("%s: NTSTATUS 0x%08x", op, uint32(status))
+}
+
+func workSpace() ([]byte, error) {
+	var size, fragmentSize uint32
+	status, _, _ := procRtlGetCompressionWorkSpaceSize.Call(cCOMPRESSION_FORMAT_XPRESS_HUFF, uintptr(unsafe.Pointer(&size)), uintptr(unsafe.Pointer(&fragmentSize)))
+	if int32(status) < 0 {
+		return nil, ntError("RtlGetCompressionWorkSpaceSize", status)
+	}
+	return make([]byte, size+1), nil
+}
+
+func systemCompress(in []byte) ([]byte, error) {
+	ws, err := workSpace()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, len(in)+len(in)/8+1024)
+	var n uint32
+	status, _, _ := procRtlCompressBuffer.Call(cCOMPRESSION_FORMAT_XPRESS_HUFF, uintptr(unsafe.Pointer(&in[0])), uintptr(len(in)), uintptr(unsafe.Pointer(&out[0])), uintptr(len(out)), 4096, uintptr(unsafe.Pointer(&n)), uintptr(unsafe.Pointer(&ws[0])))
+	if int32(status) < 0 {
+		return nil, ntError("RtlCompressBuffer", status)
+	}
+	return out[:n], nil
+}
+
+func systemDecompress(in []byte, uncompressedSize int) ([]byte, error) {
+	ws, err := workSpace()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, uncompressedSize)
+	var n uint32
+	status, _, _ := procRtlDecompressBufferEx.Call(cCOMPRESSION_FORMAT_XPRESS_HUFF, uintptr(unsafe.Pointer(&out[0])), uintptr(len(out)), uintptr(unsafe.Pointer(&in[0])), uintptr(len(in)), uintptr(unsafe.Pointer(&n)), uintptr(unsafe.Pointer(&ws[0])))
+	if int32(status) < 0 {
+		return nil, ntError("RtlDecompressBufferEx", status)
+	}
+	return out[:n], nil
+}
+
+func systemTestData() map[string][]byte {
+	rng := rand.New(rand.NewSource(1))
+	words := make([]byte, 0, 32768)
+	for len(words) < 32768-16 {
+		words = append(words, "alpha beta gamma delta epsilon "[rng.Intn(5)*6:][:6]...)
+		words = append(words, byte('0'+rng.Intn(10)))
+	}
+	nibbles := make([]byte, 32768)
+	for i := range nibbles {
+		nibbles[i] = byte(rng.Intn(16) * rng.Intn(16))
+	}
+	return map[string][]byte{
+		"text":    bytes.Repeat([]byte("the quick brown fox jumps over the lazy dog. "), 800)[:32768],
+		"words":   words,
+		"nibbles": nibbles,
+		"short":   bytes.Repeat([]byte("abc"), 100),
+	}
+}
+
+func TestDecompressSystem(t *testing.T) {
+	if err := procRtlDecompressBufferEx.Find(); err != nil {
+		t.Skip("RtlDecompressBufferEx is not available: ", err)
+	}
+	for name, in := range systemTestData() {
+		c, err := systemCompress(in)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		out, err := Decompress(c, len(in))
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if !bytes.Equal(out, in) {
+			t.Fatalf("%s: data mismatch", name)
+		}
+	}
+}
+
+func TestCompressSystem(t *testing.T) {
+	if err := procRtlDecompressBufferEx.Find(); err != nil {
+		t.Skip("RtlDecompressBufferEx is not available: ", err)
+	}
+	for name, in := range systemTestData() {
+		c := Compress(in)
+		if c == nil {
+			t.Fatalf("%s: data was not compressed", name)
+		}
+		out, err := systemDecompress(c, len(in))
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if !bytes.Equal(out, in) {
+			t.Fatalf("%s: data mismatch", name)
+		}
+	}
+}
@@ -15,36 +15,49 @@ var (
 	modkernel32 = syscall.NewLazyDLL("kernel32.dll")
 	modwinmm    = syscall.NewLazyDLL("winmm.dll")
 	modadvapi32 = syscall.NewLazyDLL("advapi32.dll")
-
-	procCancelIoEx                                           = modkernel32.NewProc("CancelIoEx")
-	procCreateIoCompletionPort                               = modkernel32.NewProc("CreateIoCompletionPort")
-	procGetQueuedCompletionStatus                            = modkernel32.NewProc("GetQueuedCompletionStatus")
-	procSetFileCompletionNotificationModes                   = modkernel32.NewProc("SetFileCompletionNotificationModes")
-	proctimeBeginPeriod                                      = modwinmm.NewProc("timeBeginPeriod")
-	procConnectNamedPipe                                     = modkernel32.NewProc("ConnectNamedPipe")
-	procCreateNamedPipeW                                     = modkernel32.NewProc("CreateNamedPipeW")
-	procCreateFileW                                          = modkernel32.NewProc("CreateFileW")
-	procWaitNamedPipeW                                       = modkernel32.NewProc("WaitNamedPipeW")
-	procGetNamedPipeInfo                                     = modkernel32.NewProc("GetNamedPipeInfo")
-	procGetNamedPipeHandleStateW                             = modkernel32.NewProc("GetNamedPipeHandleStateW")
-	procLookupAccountNameW                                   = modadvapi32.NewProc("LookupAccountNameW")
-	procConvertSidToStringSidW                               = modadvapi32.NewProc("ConvertSidToStringSidW")
-	procConvertStringSecurityDescriptorToSecurityDescriptorW = modadvapi32.NewProc("ConvertStringSecurityDescriptorToSecurityDescriptorW")
-	procConvertSecurityDescriptorToStringSecurityDescriptorW = modadvapi32.NewProc("ConvertSecurityDescriptorToStringSecurityDescriptorW")
-	procLocalFree                                            = modkernel32.NewProc("LocalFree")
-	procGetSecurityDescriptorLength                          = modadvapi32.NewProc("GetSecurityDescriptorLength")
-	procGetFileInformationByHandleEx                         = modkernel32.NewProc("GetFileInformationByHandleEx")
-	procSetFileInformationByHandle                           = modkernel32.NewProc("SetFileInformationByHandle")
-	procAdjustTokenPrivileges                                = modadvapi32.NewProc("AdjustTokenPrivileges")
-	procImpersonateSelf                                      = modadvapi32.NewProc("ImpersonateSelf")
-	procRevertToSelf                                         = modadvapi32.NewProc("RevertToSelf")
-	procOpenThreadToken                                      = modadvapi32.NewProc("OpenThreadToken")
-	procGetCurrentThread                                     = modkernel32.NewProc("GetCurrentThread")
-	procLookupPrivilegeValueW                                = modadvapi32.NewProc("LookupPrivilegeValueW")
-	procLookupPrivilegeNameW                                 = modadvapi32.NewProc("LookupPrivilegeNameW")
-	procLookupPrivilegeDisplayNameW                          = modadvapi32.NewProc("LookupPrivilegeDisplayNameW")
-	procBackupRead                                           = modkernel32.NewProc("BackupRead")
-	procBackupWrite                                          = modkernel32.NewProc("BackupWrite")
+	modntdll    = syscall.NewLazyDLL("ntdll.dll")
+
+	procCancelIoEx                         = modkernel32.NewProc("CancelIoEx")
+	procCreateIoCompletionPort             = modkernel32.NewProc("CreateIoCompletionPort")
+	procGetQueuedCompletionStatus          = modkernel32.NewProc("GetQueuedCompletionStatus")
+	procSetFileCompletionNotificationModes = modkernel32.NewProc("SetFileCompletionNotificationModes")
+	proctimeBeginPeriod                    = modwinmm.NewProc("timeBeginPeriod")
+	procConnectNamedPipe                   = modkernel32.NewProc("ConnectNamedPipe")
+	procDisconnectNamedPipe                = modkernel32.NewProc("DisconnectNamedPipe")
+	procCreateNamedPipeW                   = modkernel32.NewProc("CreateNamedPipeW")
+	procCreateFileW                        = modkernel32.NewProc("CreateFileW")
+	procWaitNamedPipeW                     = modkernel32.NewProc("WaitNamedPipeW")
+	procGetNamedPipeInfo                   = modkernel32.NewProc("GetNamedPipeInfo")
+	procGetNamedPipeHandleStateW           = modkernel32.NewProc("GetNamedPipeHandleStateW")
+	procImpersonateNamedPipeClient         = modadvapi32.NewProc("ImpersonateNamedPipeClient")
+	procGetFileInformationByHandleEx       = modkernel32.NewProc("GetFileInformationByHandleEx")
+	procSetFileInformationByHandle         = modkernel32.NewProc("SetFileInformationByHandle")
+	procAdjustTokenPrivileges              = modadvapi32.NewProc("AdjustTokenPrivileges")
+	procImpersonateSelf                    = modadvapi32.NewProc("ImpersonateSelf")
+	procRevertToSelf                       = modadvapi32.NewProc("RevertToSelf")
+	procOpenThreadToken                    = modadvapi32.NewProc("OpenThreadToken")
+	procGetCurrentThread                   = modkernel32.NewProc("GetCurrentThread")
+	procLookupPrivilegeValueW              = modadvapi32.NewProc("LookupPrivilegeValueW")
+	procLookupPrivilegeNameW               = modadvapi32.NewProc("LookupPrivilegeNameW")
+	procLookupPrivilegeDisplayNameW        = modadvapi32.NewProc("LookupPrivilegeDisplayNameW")
+	procBackupRead                         = modkernel32.NewProc("BackupRead")
+	procBackupWrite                        = modkernel32.NewProc("BackupWrite")
+	procBackupSeek                         = modkernel32.NewProc("BackupSeek")
+	procSetSecurityInfo                    = modadvapi32.NewProc("SetSecurityInfo")
+	procTreeResetNamedSecurityInfoW        = modadvapi32.NewProc("TreeResetNamedSecurityInfoW")
+	procSetKernelObjectSecurity            = modadvapi32.NewProc("SetKernelObjectSecurity")
+	procOpenFileById                       = modkernel32.NewProc("OpenFileById")
+	procNtQueryEaFile                      = modntdll.NewProc("NtQueryEaFile")
+	procNtSetEaFile                        = modntdll.NewProc("NtSetEaFile")
+	procNtSetInformationFile               = modntdll.NewProc("NtSetInformationFile")
+	procFindFirstFileNameW                 = modkernel32.NewProc("FindFirstFileNameW")
+	procFindNextFileNameW                  = modkernel32.NewProc("FindNextFileNameW")
+	procFindFirstStreamW                   = modkernel32.NewProc("FindFirstStreamW")
+	procFindNextStreamW                    = modkernel32.NewProc("FindNextStreamW")
+	procNtCreateFile                       = modntdll.NewProc("NtCreateFile")
+	procLogonUserW                         = modadvapi32.NewProc("LogonUserW")
+	procImpersonateLoggedOnUser            = modadvapi32.NewProc("ImpersonateLoggedOnUser")
+	procRtlNtStatusToDosErrorNoTeb         = modntdll.NewProc("RtlNtStatusToDosErrorNoTeb")
 )
 
 func cancelIoEx(file syscall.Handle, o *syscall.Overlapped) (err error) {
@@ -114,6 +127,18 @@ func connectNamedPipe(pipe syscall.Handle, o *syscall.Overlapped) (err error) {
 	return
 }
 
+func disconnectNamedPipe(pipe syscall.Handle) (err error) {
+	r1, _, e1 := syscall.Syscall(procDisconnectNamedPipe.Addr(), 1, uintptr(pipe), 0, 0)
+	if r1 == 0 {
+		if e1 != 0 {
+			err = error(e1)
+		} else {
+			err = syscall.EINVAL
+		}
+	}
+	return
+}
+
 func createNamedPipe(name string, flags uint32, pipeMode uint32, maxInstances uint32, outSize uint32, inSize uint32, defaultTimeout uint32, sa *securityAttributes) (handle syscall.Handle, err error) {
 	var _p0 *uint16
 	_p0, err = syscall.UTF16PtrFromString(name)
@@ -203,62 +228,8 @@ func getNamedPipeHandleState(pipe syscall.Handle, state *uint32, curInstances *u
 	return
 }
 
-func lookupAccountName(systemName *uint16, accountName string, sid *byte, sidSize *uint32, refDomain *uint16, refDomainSize *uint32, sidNameUse *uint32) (err error) {
-	var _p0 *uint16
-	_p0, err = syscall.UTF16PtrFromString(accountName)
-	if err != nil {
-		return
-	}
-	return _lookupAccountName(systemName, _p0, sid, sidSize, refDomain, refDomainSize, sidNameUse)
-}
-
-func _lookupAccountName(systemName *uint16, accountName *uint16, sid *byte, sidSize *uint32, refDomain *uint16, refDomainSize *uint32, sidNameUse *uint32) (err error) {
-	r1, _, e1 := syscall.Syscall9(procLookupAccountNameW.Addr(), 7, uintptr(unsafe.Pointer(systemName)), uintptr(unsafe.Pointer(accountName)), uintptr(unsafe.Pointer(sid)), uintptr(unsafe.Pointer(sidSize)), uintptr(unsafe.Pointer(refDomain)), uintptr(unsafe.Pointer(refDomainSize)), uintptr(unsafe.Pointer(sidNameUse)), 0, 0)
-	if r1 == 0 {
-		if e1 != 0 {
-			err = error(e1)
-		} else {
-			err = syscall.EINVAL
-		}
-	}
-	return
-}
-
-func convertSidToStringSid(sid *byte, str **uint16) (err error) {
-	r1, _, e1 := syscall.Syscall(procConvertSidToStringSidW.Addr(), 2, uintptr(unsafe.Pointer(sid)), uintptr(unsafe.Pointer(str)), 0)
-	if r1 == 0 {
-		if e1 != 0 {
-			err = error(e1)
-		} else {
-			err = syscall.EINVAL
-		}
-	}
-	return
-}
-
-func convertStringSecurityDescriptorToSecurityDescriptor(str string, revision uint32, sd *uintptr, size *uint32) (err error) {
-	var _p0 *uint16
-	_p0, err = syscall.UTF16PtrFromString(str)
-	if err != nil {
-		return
-	}
-	return _convertStringSecurityDescriptorToSecurityDescriptor(_p0, revision, sd, size)
-}
-
-func _convertStringSecurityDescriptorToSecurityDescriptor(str *uint16, revision uint32, sd *uintptr, size *uint32) (err error) {
-	r1, _, e1 := syscall.Syscall6(procConvertStringSecurityDescriptorToSecurityDescriptorW.Addr(), 4, uintptr(unsafe.Pointer(str)), uintptr(revision), uintptr(unsafe.Pointer(sd)), uintptr(unsafe.Pointer(size)), 0, 0)
-	if r1 == 0 {
-		if e1 != 0 {
-			err = error(e1)
-		} else {
-			err = syscall.EINVAL
-		}
-	}
-	return
-}
-
-func convertSecurityDescriptorToStringSecurityDescriptor(sd *byte, revision uint32, secInfo uint32, sddl **uint16, sddlSize *uint32) (err error) {
-	r1, _, e1 := syscall.Syscall6(procConvertSecurityDescriptorToStringSecurityDescriptorW.Addr(), 5, uintptr(unsafe.Pointer(sd)), uintptr(revision), uintptr(secInfo), uintptr(unsafe.Pointer(sddl)), uintptr(unsafe.Pointer(sddlSize)), 0)
+func impersonateNamedPipeClient(pipe syscall.Handle) (err error) {
+	r1, _, e1 := syscall.Syscall(procImpersonateNamedPipeClient.Addr(), 1, uintptr(pipe), 0, 0)
 	if r1 == 0 {
 		if e1 != 0 {
 			err = error(e1)
@@ -269,17 +240,6 @@ func convertSecurityDescriptorToStringSecurityDescriptor(sd *byte, revision uint
 	return
 }
 
-func localFree(mem uintptr) {
-	syscall.Syscall(procLocalFree.Addr(), 1, uintptr(mem), 0, 0)
-	return
-}
-
-func getSecurityDescriptorLength(sd uintptr) (len uint32) {
-	r0, _, _ := syscall.Syscall(procGetSecurityDescriptorLength.Addr(), 1, uintptr(sd), 0, 0)
-	len = uint32(r0)
-	return
-}
-
 func getFileInformationByHandleEx(h syscall.Handle, class uint32, buffer *byte, size uint32) (err error) {
 	r1, _, e1 := syscall.Syscall6(procGetFileInformationByHandleEx.Addr(), 4, uintptr(h), uintptr(class), uintptr(unsafe.Pointer(buffer)), uintptr(size), 0, 0)
 	if r1 == 0 {
@@ -494,3 +454,207 @@ func backupWrite(h syscall.Handle, b []byte, bytesWritten *uint32, abort bool, p
 	}
 	return
 }
+
+func backupSeek(h syscall.Handle, lowBytesToSeek uint32, highBytesToSeek uint32, lowBytesSeeked *uint32, highBytesSeeked *uint32, context *uintptr) (err error) {
+	r1, _, e1 := syscall.Syscall6(procBackupSeek.Addr(), 6, uintptr(h), uintptr(lowBytesToSeek), uintptr(highBytesToSeek), uintptr(unsafe.Pointer(lowBytesSeeked)), uintptr(unsafe.Pointer(highBytesSeeked)), uintptr(unsafe.Pointer(context)))
+	if r1 == 0 {
+		if e1 != 0 {
+			err = error(e1)
+		} else {
+			err = syscall.EINVAL
+		}
+	}
+	return
+}
+
+func setSecurityInfo(handle syscall.Handle, objectType uint32, si uint32, owner *byte, group *byte, dacl *byte, sacl *byte) (win32err error) {
+	r0, _, _ := syscall.Syscall9(procSetSecurityInfo.Addr(), 7, uintptr(handle), uintptr(objectType), uintptr(si), uintptr(unsafe.Pointer(owner)), uintptr(unsafe.Pointer(group)), uintptr(unsafe.Pointer(dacl)), uintptr(unsafe.Pointer(sacl)), 0, 0)
+	if r0 != 0 {
+		win32err = syscall.Errno(r0)
+	}
+	return
+}
+
+func treeResetNamedSecurityInfo(name string, objectType uint32, si uint32, owner *byte, group *byte, dacl *byte, sacl *byte, keepExplicit bool, progress uintptr, invokeSetting uint32, args uintptr) (win32err error) {
+	var _p0 *uint16
+	_p0, win32err = syscall.UTF16PtrFromString(name)
+	if win32err != nil {
+		return
+	}
+	return _treeResetNamedSecurityInfo(_p0, objectType, si, owner, group, dacl, sacl, keepExplicit, progress, invokeSetting, args)
+}
+
+func _treeResetNamedSecurityInfo(name *uint16, objectType uint32, si uint32, owner *byte, group *byte, dacl *byte, sacl *byte, keepExplicit bool, progress uintptr, invokeSetting uint32, args uintptr) (win32err error) {
+	var _p1 uint32
+	if keepExplicit {
+		_p1 = 1
+	} else {
+		_p1 = 0
+	}
+	r0, _, _ := syscall.Syscall12(procTreeResetNamedSecurityInfoW.Addr(), 11, uintptr(unsafe.Pointer(name)), uintptr(objectType), uintptr(si), uintptr(unsafe.Pointer(owner)), uintptr(unsafe.Pointer(group)), uintptr(unsafe.Pointer(dacl)), uintptr(unsafe.Pointer(sacl)), uintptr(_p1), uintptr(progress), uintptr(invokeSetting), uintptr(args), 0)
+	if r0 != 0 {
+		win32err = syscall.Errno(r0)
+	}
+	return
+}
+
+func setKernelObjectSecurity(handle syscall.Handle, si uint32, sd *byte) (err error) {
+	r1, _, e1 := syscall.Syscall(procSetKernelObjectSecurity.Addr(), 3, uintptr(handle), uintptr(si), uintptr(unsafe.Pointer(sd)))
+	if r1 == 0 {
+		if e1 != 0 {
+			err = error(e1)
+		} else {
+			err = syscall.EINVAL
+		}
+	}
+	return
+}
+
+func openFileById(volume syscall.Handle, id *fileIDDescriptor, access uint32, share uint32, sa *syscall.SecurityAttributes, flags uint32) (h syscall.Handle, err error) {
+	r0, _, e1 := syscall.Syscall6(procOpenFileById.Addr(), 6, uintptr(volume), uintptr(unsafe.Pointer(id)), uintptr(access), uintptr(share), uintptr(unsafe.Pointer(sa)), uintptr(flags))
+	h = syscall.Handle(r0)
+	if h == syscall.InvalidHandle {
+		if e1 != 0 {
+			err = error(e1)
+		} else {
+			err = syscall.EINVAL
+		}
+	}
+	return
+}
+
+func ntQueryEaFile(handle syscall.Handle, iosb *ioStatusBlock, buf *byte, length uint32, returnSingleEntry bool, eaList *byte, eaListLength uint32, eaIndex *uint32, restartScan bool) (status ntstatus) {
+	var _p0 uint32
+	if returnSingleEntry {
+		_p0 = 1
+	} else {
+		_p0 = 0
+	}
+	var _p1 uint32
+	if restartScan {
+		_p1 = 1
+	} else {
+		_p1 = 0
+	}
+	r0, _, _ := syscall.Syscall9(procNtQueryEaFile.Addr(), 9, uintptr(handle), uintptr(unsafe.Pointer(iosb)), uintptr(unsafe.Pointer(buf)), uintptr(length), uintptr(_p0), uintptr(unsafe.Pointer(eaList)), uintptr(eaListLength), uintptr(unsafe.Pointer(eaIndex)), uintptr(_p1))
+	status = ntstatus(r0)
+	return
+}
+
+func ntSetEaFile(handle syscall.Handle, iosb *ioStatusBlock, buf *byte, length uint32) (status ntstatus) {
+	r0, _, _ := syscall.Syscall6(procNtSetEaFile.Addr(), 4, uintptr(handle), uintptr(unsafe.Pointer(iosb)), uintptr(unsafe.Pointer(buf)), uintptr(length), 0, 0)
+	status = ntstatus(r0)
+	return
+}
+
+func ntSetInformationFile(handle syscall.Handle, iosb *ioStatusBlock, info *byte, length uint32, class uint32) (status ntstatus) {
+	r0, _, _ := syscall.Syscall6(procNtSetInformationFile.Addr(), 5, uintptr(handle), uintptr(unsafe.Pointer(iosb)), uintptr(unsafe.Pointer(info)), uintptr(length), uintptr(class), 0)
+	status = ntstatus(r0)
+	return
+}
+
+func findFirstFileName(name string, flags uint32, length *uint32, buffer *uint16) (h syscall.Handle, err error) {
+	var _p0 *uint16
+	_p0, err = syscall.UTF16PtrFromString(name)
+	if err != nil {
+		return
+	}
+	return _findFirstFileName(_p0, flags, length, buffer)
+}
+
+func _findFirstFileName(name *uint16, flags uint32, length *uint32, buffer *uint16) (h syscall.Handle, err error) {
+	r0, _, e1 := syscall.Syscall6(procFindFirstFileNameW.Addr(), 4, uintptr(unsafe.Pointer(name)), uintptr(flags), uintptr(unsafe.Pointer(length)), uintptr(unsafe.Pointer(buffer)), 0, 0)
+	h = syscall.Handle(r0)
+	if h == syscall.InvalidHandle {
+		if e1 != 0 {
+			err = error(e1)
+		} else {
+			err = syscall.EINVAL
+		}
+	}
+	return
+}
+
+func findNextFileName(h syscall.Handle, length *uint32, buffer *uint16) (err error) {
+	r1, _, e1 := syscall.Syscall(procFindNextFileNameW.Addr(), 3, uintptr(h), uintptr(unsafe.Pointer(length)), uintptr(unsafe.Pointer(buffer)))
+	if r1 == 0 {
+		if e1 != 0 {
+			err = error(e1)
+		} else {
+			err = syscall.EINVAL
+		}
+	}
+	return
+}
+
+func findFirstStream(name string, infoLevel uint32, data *win32FindStreamData, flags uint32) (h syscall.Handle, err error) {
+	var _p0 *uint16
+	_p0, err = syscall.UTF16PtrFromString(name)
+	if err != nil {
+		return
+	}
+	return _findFirstStream(_p0, infoLevel, data, flags)
+}
+
+func _findFirstStream(name *uint16, infoLevel uint32, data *win32FindStreamData, flags uint32) (h syscall.Handle, err error) {
+	r0, _, e1 := syscall.Syscall6(procFindFirstStreamW.Addr(), 4, uintptr(unsafe.Pointer(name)), uintptr(infoLevel), uintptr(unsafe.Pointer(data)), uintptr(flags), 0, 0)
+	h = syscall.Handle(r0)
+	if h == syscall.InvalidHandle {
+		if e1 != 0 {
+			err = error(e1)
+		} else {
+			err = syscall.EINVAL
+		}
+	}
+	return
+}
+
+func findNextStream(h syscall.Handle, data *win32FindStreamData) (err error) {
+	r1, _, e1 := syscall.Syscall(procFindNextStreamW.Addr(), 2, uintptr(h), uintptr(unsafe.Pointer(data)), 0)
+	if r1 == 0 {
+		if e1 != 0 {
+			err = error(e1)
+		} else {
+			err = syscall.EINVAL
+		}
+	}
+	return
+}
+
+func ntCreateFile(handle *syscall.Handle, access uint32, oa *objectAttributes, iosb *ioStatusBlock, allocationSize *uint64, attributes uint32, share uint32, disposition uint32, options uint32, eaBuffer *byte, eaLength uint32) (status ntstatus) {
+	r0, _, _ := syscall.Syscall12(procNtCreateFile.Addr(), 11, uintptr(unsafe.Pointer(handle)), uintptr(access), uintptr(unsafe.Pointer(oa)), uintptr(unsafe.Pointer(iosb)), uintptr(unsafe.Pointer(allocationSize)), uintptr(attributes), uintptr(share), uintptr(disposition), uintptr(options), uintptr(unsafe.Pointer(eaBuffer)), uintptr(eaLength), 0)
+	status = ntstatus(r0)
+	return
+}
+
+func logonUser(username *uint16, domain *uint16, password *uint16, logonType uint32, logonProvider uint32, token *windows.Token) (err error) {
+	r1, _, e1 := syscall.Syscall6(procLogonUserW.Addr(), 6, uintptr(unsafe.Pointer(username)), uintptr(unsafe.Pointer(domain)), uintptr(unsafe.Pointer(password)), uintptr(logonType), uintptr(logonProvider), uintptr(unsafe.Pointer(token)))
+	if r1 == 0 {
+		if e1 != 0 {
+			err = error(e1)
+		} else {
+			err = syscall.EINVAL
+		}
+	}
+	return
+}
+
+func impersonateLoggedOnUser(token windows.Token) (err error) {
+	r1, _, e1 := syscall.Syscall(procImpersonateLoggedOnUser.Addr(), 1, uintptr(token), 0, 0)
+	if r1 == 0 {
+		if e1 != 0 {
+			err = error(e1)
+		} else {
+			err = syscall.EINVAL
+		}
+	}
+	return
+}
+
+func rtlNtStatusToDosError(status ntstatus) (winerr error) {
+	r0, _, _ := syscall.Syscall(procRtlNtStatusToDosErrorNoTeb.Addr(), 1, uintptr(status), 0, 0)
+	if r0 != 0 {
+		winerr = syscall.Errno(r0)
+	}
+	return
+}